@@ -0,0 +1,485 @@
+package configs
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Severity of a configuration problem.
+type Severity int
+
+// Severity definitions.
+const (
+	// SeverityWarning is a problem the server can run with.
+	SeverityWarning Severity = iota
+	// SeverityError is a problem which fails the server or its functions.
+	SeverityError
+)
+
+func (s Severity) String() string {
+	if s == SeverityError {
+		return "ERROR"
+	}
+	return "WARNING"
+}
+
+// Problem is a misconfiguration found by Check.
+type Problem struct {
+	Severity Severity
+	Message  string
+}
+
+// SectionReport is the result of checking a section of the configurations,
+// named by its yaml key.
+type SectionReport struct {
+	Section  string
+	Problems []Problem
+}
+
+// Report is the result of checking every section of the configurations.
+type Report struct {
+	Sections []SectionReport
+}
+
+// HasErrors reports whether any section has a problem of SeverityError.
+func (r Report) HasErrors() bool {
+	for _, section := range r.Sections {
+		for _, problem := range section.Problems {
+			if problem.Severity == SeverityError {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// WriteTo writes the report of every section in a human readable format.
+func (r Report) WriteTo(w io.Writer) (int64, error) {
+	var b strings.Builder
+	errs, warnings := 0, 0
+	for _, section := range r.Sections {
+		if len(section.Problems) == 0 {
+			fmt.Fprintf(&b, "[OK]      %s\n", section.Section)
+			continue
+		}
+		for _, problem := range section.Problems {
+			if problem.Severity == SeverityError {
+				errs++
+			} else {
+				warnings++
+			}
+			fmt.Fprintf(&b, "[%-7s] %s: %s\n", problem.Severity, section.Section, problem.Message)
+		}
+	}
+	fmt.Fprintf(&b, "%d error(s), %d warning(s)\n", errs, warnings)
+
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+// CheckOptions are the references the configurations are checked against.
+type CheckOptions struct {
+	// Functions are the names of the function operations which should be
+	// granted to some role by the permissions.
+	Functions []string
+	// Roles are the valid role names.
+	Roles []string
+	// StationExists reports whether the station exists. The stations are not
+	// checked if it is nil.
+	StationExists func(ctx context.Context, id string) (bool, error)
+	// ParseIDRule parses the pattern of an ID rule. The rules are not checked
+	// if it is nil.
+	ParseIDRule func(pattern string) error
+	// ParseScaleProtocol parses the protocol of a scale. The protocols are not
+	// checked if it is nil.
+	ParseScaleProtocol func(name string) error
+}
+
+// checker collects the problems of the section being checked.
+type checker struct {
+	report  Report
+	current *SectionReport
+}
+
+func (c *checker) section(name string) {
+	c.report.Sections = append(c.report.Sections, SectionReport{Section: name})
+	c.current = &c.report.Sections[len(c.report.Sections)-1]
+}
+
+func (c *checker) errorf(format string, args ...interface{}) {
+	c.current.Problems = append(c.current.Problems, Problem{
+		Severity: SeverityError,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+func (c *checker) warnf(format string, args ...interface{}) {
+	c.current.Problems = append(c.current.Problems, Problem{
+		Severity: SeverityWarning,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// Check validates every section of the configurations and reports all the
+// problems found instead of stopping at the first one. In the multi-plant
+// mode, the sections inherited by the plants are left to CheckPlant, which
+// checks them with the stations of every plant.
+func Check(ctx context.Context, cfgs Configs, opts CheckOptions) Report {
+	c := &checker{}
+
+	c.section("ui_distribution_directory")
+	if cfgs.UIDir != "" {
+		checkDir(c, cfgs.UIDir)
+	} else if cfgs.CreateUIConfig {
+		c.errorf("required by create_ui_configuration")
+	}
+
+	c.section("timeout")
+	if cfgs.Timeout < 0 {
+		c.errorf("negative timeout %s", cfgs.Timeout)
+	}
+
+	c.section("web_service_endpoint")
+	if cfgs.WebServiceEndpoint != "" {
+		checkURL(c, cfgs.WebServiceEndpoint)
+	}
+
+	c.section("postgres")
+	if cfgs.PostgreSQL.Name == "" {
+		c.errorf("missing name")
+	}
+	if cfgs.PostgreSQL.Address == "" {
+		c.errorf("missing address")
+	}
+	checkPort(c, cfgs.PostgreSQL.Port)
+
+	c.section("active_directory")
+	if !cfgs.ActiveDirectory.IsEmpty() {
+		if cfgs.ActiveDirectory.Host == "" {
+			c.errorf("missing host")
+		}
+		checkPort(c, cfgs.ActiveDirectory.Port)
+		if cfgs.ActiveDirectory.DN == "" {
+			c.errorf("missing base_dn")
+		}
+	}
+
+	c.section("cors_allowed_origins")
+	for _, origin := range cfgs.CorsAllowedOrigins {
+		if origin != "*" {
+			checkURL(c, origin)
+		}
+	}
+
+	c.section("token_expired_in_seconds")
+	if cfgs.TokenExpiredSeconds < 0 {
+		c.errorf("negative token lifetime %d", cfgs.TokenExpiredSeconds)
+	}
+
+	c.section("permissions")
+	checkPermissions(c, cfgs.FunctionRolePermissions, opts)
+
+	c.section("font_path")
+	if cfgs.FontPath == "" {
+		c.errorf("missing font path")
+	} else if info, err := os.Stat(cfgs.FontPath); err != nil {
+		c.errorf("%v", err)
+	} else if info.IsDir() {
+		c.errorf("%s is a directory", cfgs.FontPath)
+	}
+
+	c.section("trusted_proxies")
+	for _, proxy := range cfgs.TrustedProxies {
+		if _, _, err := net.ParseCIDR(proxy); err != nil && net.ParseIP(proxy) == nil {
+			c.errorf("invalid IP address or CIDR range %q", proxy)
+		}
+	}
+
+	c.section("login_protection")
+	lp := cfgs.LoginProtection
+	if lp.MaxAccountFailures < 0 || lp.MaxIPFailures < 0 {
+		c.errorf("negative max failures")
+	}
+	if lp.LockoutDuration < 0 || lp.FailureWindow < 0 || lp.Delay < 0 || lp.MaxDelay < 0 {
+		c.errorf("negative duration")
+	}
+	if lp.Delay > 0 && lp.MaxDelay > 0 && lp.Delay > lp.MaxDelay {
+		c.errorf("delay %s is longer than max_delay %s", lp.Delay, lp.MaxDelay)
+	}
+
+	c.section("password_policy")
+	pp := cfgs.PasswordPolicy
+	if pp.MinLength < 0 {
+		c.errorf("negative min_length %d", pp.MinLength)
+	}
+	if pp.History < 0 {
+		c.errorf("negative history %d", pp.History)
+	}
+	if pp.MaxAge < 0 {
+		c.errorf("negative max_age %s", pp.MaxAge)
+	}
+
+	if len(cfgs.Plants) == 0 {
+		checkPlantSections(ctx, c, cfgs, opts)
+	}
+
+	c.section("plants")
+	checkPlants(c, cfgs.Plants)
+
+	return c.report
+}
+
+// CheckPlant validates the sections of the configurations which the plant
+// may override, cfgs is returned by Configs.ForPlant.
+func CheckPlant(ctx context.Context, cfgs Configs, opts CheckOptions) Report {
+	c := &checker{}
+	checkPlantSections(ctx, c, cfgs, opts)
+	return c.report
+}
+
+func checkPlantSections(ctx context.Context, c *checker, cfgs Configs, opts CheckOptions) {
+	c.section("printers")
+	for _, station := range sortedKeys(cfgs.Printers) {
+		if cfgs.Printers[station] == "" {
+			c.errorf("missing printer of station %s", station)
+		}
+		checkStation(ctx, c, opts, station)
+	}
+
+	c.section("station_function_config")
+	for _, station := range sortedKeys(cfgs.StationFunctionConfig) {
+		paths := cfgs.StationFunctionConfig[station]
+		for _, path := range []string{paths.LoadWorkOrderAPIPath, paths.ClosedWorkOrderAPIPath, paths.BindResourceAPIPath} {
+			if path != "" {
+				checkURL(c, path)
+			}
+		}
+		checkStation(ctx, c, opts, station)
+	}
+
+	c.section("mes_path")
+	if cfgs.MesPath != "" {
+		checkURL(c, cfgs.MesPath)
+	}
+
+	c.section("id_rules")
+	checkIDRules(ctx, c, cfgs.IDRules, opts)
+
+	c.section("scales")
+	checkScales(ctx, c, cfgs.Scales, opts)
+
+	c.section("oee")
+	checkShifts(c, cfgs.OEE.Shifts)
+}
+
+// checkPlants checks the settings of the plants themselves, the inherited
+// configurations of every plant are checked by CheckPlant.
+func checkPlants(c *checker, plants []Plant) {
+	names := make(map[string]struct{}, len(plants))
+	departments := make(map[string]string)
+	for i, p := range plants {
+		if p.Name == "" {
+			c.errorf("missing name of plant %d", i)
+		} else if _, ok := names[p.Name]; ok {
+			c.errorf("duplicated plant %s", p.Name)
+		}
+		names[p.Name] = struct{}{}
+
+		if p.Schema == "" {
+			c.errorf("missing schema of plant %s", p.Name)
+		}
+		for _, department := range p.Departments {
+			if other, ok := departments[department]; ok {
+				c.errorf("department %s is in both plant %s and %s", department, other, p.Name)
+			}
+			departments[department] = p.Name
+		}
+		if i > 0 && len(p.Departments) == 0 {
+			c.warnf("plant %s has no department, the requests are routed to it only by the plant header or the token", p.Name)
+		}
+	}
+}
+
+func checkShifts(c *checker, shifts []Shift) {
+	names := make(map[string]struct{}, len(shifts))
+	starts := make(map[time.Time]string, len(shifts))
+	for i, shift := range shifts {
+		if shift.Name == "" {
+			c.errorf("missing name of shift %d", i)
+		} else if _, ok := names[shift.Name]; ok {
+			c.errorf("duplicated shift %s", shift.Name)
+		}
+		names[shift.Name] = struct{}{}
+
+		start, err := time.Parse("15:04", shift.Start)
+		if err != nil {
+			c.errorf("shift %s: invalid start %q", shift.Name, shift.Start)
+			continue
+		}
+		if other, ok := starts[start]; ok {
+			c.errorf("shift %s starts at the same time as shift %s", shift.Name, other)
+		}
+		starts[start] = shift.Name
+	}
+}
+
+func checkIDRules(ctx context.Context, c *checker, rules IDRules, opts CheckOptions) {
+	if opts.ParseIDRule == nil {
+		return
+	}
+	check := func(owner string, rule IDRule) {
+		if rule.LotNumber != "" {
+			if err := opts.ParseIDRule(rule.LotNumber); err != nil {
+				c.errorf("%s lot_number: %v", owner, err)
+			}
+		}
+		if rule.ResourceID != "" {
+			if err := opts.ParseIDRule(rule.ResourceID); err != nil {
+				c.errorf("%s resource_id: %v", owner, err)
+			}
+		}
+	}
+
+	check("default", rules.Default)
+	for _, station := range sortedKeys(rules.Stations) {
+		check("station "+station, rules.Stations[station])
+		checkStation(ctx, c, opts, station)
+	}
+	for _, productType := range sortedKeys(rules.ProductTypes) {
+		check("product type "+productType, rules.ProductTypes[productType])
+	}
+}
+
+func checkScales(ctx context.Context, c *checker, scales []Scale, opts CheckOptions) {
+	ids := make(map[string]struct{}, len(scales))
+	stations := make(map[string]string)
+	for i, scale := range scales {
+		if scale.ID == "" {
+			c.errorf("missing id of scale %d", i)
+		} else if _, ok := ids[scale.ID]; ok {
+			c.errorf("duplicated scale %s", scale.ID)
+		}
+		ids[scale.ID] = struct{}{}
+
+		if _, _, err := net.SplitHostPort(scale.Address); err != nil {
+			c.errorf("scale %s: invalid address %q", scale.ID, scale.Address)
+		}
+		if opts.ParseScaleProtocol != nil {
+			if err := opts.ParseScaleProtocol(scale.Protocol); err != nil {
+				c.errorf("scale %s: %v", scale.ID, err)
+			}
+		}
+		if scale.Timeout < 0 {
+			c.errorf("scale %s: negative timeout %s", scale.ID, scale.Timeout)
+		}
+		if scale.StableReadings < 0 {
+			c.errorf("scale %s: negative stable_readings %d", scale.ID, scale.StableReadings)
+		}
+		if len(scale.Stations) == 0 {
+			c.warnf("scale %s is not placed at any station", scale.ID)
+		}
+		for _, station := range scale.Stations {
+			if other, ok := stations[station]; ok {
+				c.errorf("station %s has both scale %s and %s", station, other, scale.ID)
+				continue
+			}
+			stations[station] = scale.ID
+			checkStation(ctx, c, opts, station)
+		}
+	}
+}
+
+func checkPermissions(c *checker, perms map[string][]string, opts CheckOptions) {
+	functions := make(map[string]struct{}, len(opts.Functions))
+	for _, name := range opts.Functions {
+		functions[name] = struct{}{}
+	}
+	roles := make(map[string]struct{}, len(opts.Roles))
+	for _, name := range opts.Roles {
+		roles[name] = struct{}{}
+	}
+
+	for _, function := range sortedKeys(perms) {
+		if _, ok := functions[function]; !ok {
+			c.errorf("unknown function %s", function)
+		}
+		for _, role := range perms[function] {
+			if _, ok := roles[role]; !ok {
+				c.errorf("unknown role %s of function %s", role, function)
+			}
+		}
+	}
+
+	// the permissions only seed the database, so the uncovered functions
+	// may have been granted by the permission management APIs.
+	uncovered := []string{}
+	for _, function := range opts.Functions {
+		if len(perms[function]) == 0 {
+			uncovered = append(uncovered, function)
+		}
+	}
+	if len(uncovered) > 0 {
+		sort.Strings(uncovered)
+		c.warnf("functions not granted to any role: %s", strings.Join(uncovered, ", "))
+	}
+}
+
+func checkStation(ctx context.Context, c *checker, opts CheckOptions, id string) {
+	if opts.StationExists == nil {
+		return
+	}
+	ok, err := opts.StationExists(ctx, id)
+	if err != nil {
+		// a failed query does not mean the station is misconfigured, so the
+		// server is not stopped by a database outage.
+		c.warnf("failed to check station %s: %v", id, err)
+		return
+	}
+	if !ok {
+		c.errorf("station %s not found", id)
+	}
+}
+
+func checkURL(c *checker, rawURL string) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		c.errorf("%v", err)
+		return
+	}
+	if u.Scheme == "" || u.Host == "" {
+		c.errorf("%q is not an absolute URL", rawURL)
+	}
+}
+
+func checkPort(c *checker, port int) {
+	if port <= 0 || port > 65535 {
+		c.errorf("invalid port %d", port)
+	}
+}
+
+func checkDir(c *checker, dir string) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		c.errorf("%v", err)
+		return
+	}
+	if !info.IsDir() {
+		c.errorf("%s is not a directory", dir)
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
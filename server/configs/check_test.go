@@ -0,0 +1,229 @@
+package configs
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheck(t *testing.T) {
+	assert := assert.New(t)
+
+	dir := t.TempDir()
+	fontPath := filepath.Join(dir, "font.ttf")
+	assert.NoError(os.WriteFile(fontPath, nil, 0o600))
+
+	opts := CheckOptions{
+		Functions: []string{"GET_PLAN_LIST", "ADD_PLAN"},
+		Roles:     []string{"ADMINISTRATOR", "PLANNER"},
+		StationExists: func(_ context.Context, id string) (bool, error) {
+			switch id {
+			case "S1":
+				return true, nil
+			case "S2":
+				return false, nil
+			}
+			return false, errors.New("connection refused")
+		},
+		ParseIDRule: func(pattern string) error {
+			if strings.Contains(pattern, "{bad}") {
+				return errors.New("unknown token {bad}")
+			}
+			return nil
+		},
+		ParseScaleProtocol: func(name string) error {
+			if name != "and" {
+				return errors.New("unknown scale protocol")
+			}
+			return nil
+		},
+	}
+	good := Configs{
+		UIDir:      dir,
+		PostgreSQL: DBConnection{Name: "mes", Address: "localhost", Port: 5432},
+		FunctionRolePermissions: map[string][]string{
+			"GET_PLAN_LIST": {"ADMINISTRATOR", "PLANNER"},
+			"ADD_PLAN":      {"PLANNER"},
+		},
+		Printers: map[string]string{"S1": "printer-1"},
+		FontPath: fontPath,
+		StationFunctionConfig: map[string]FunctionAPIPath{
+			"S1": {LoadWorkOrderAPIPath: "http://mes-agent/load"},
+		},
+		MesPath: "http://mes",
+		IDRules: IDRules{
+			Default:  IDRule{ResourceID: "{YY}{seq:6}"},
+			Stations: map[string]IDRule{"S1": {LotNumber: "{station:2}{MM}{DD}"}},
+		},
+		Scales: []Scale{
+			{ID: "SCALE-1", Address: "10.0.0.1:4001", Protocol: "and", Stations: []string{"S1"}},
+		},
+		OEE: OEE{
+			Shifts: []Shift{{Name: "A", Start: "07:00"}, {Name: "B", Start: "15:00"}, {Name: "C", Start: "23:00"}},
+		},
+	}
+
+	{ // good configurations.
+		report := Check(context.Background(), good, opts)
+		assert.False(report.HasErrors())
+		for _, section := range report.Sections {
+			assert.Empty(section.Problems, section.Section)
+		}
+
+		var b strings.Builder
+		_, err := report.WriteTo(&b)
+		assert.NoError(err)
+		assert.Contains(b.String(), "[OK]      permissions\n")
+		assert.True(strings.HasSuffix(b.String(), "0 error(s), 0 warning(s)\n"))
+	}
+	{ // bad configurations.
+		bad := good
+		bad.UIDir = fontPath
+		bad.PostgreSQL.Port = 0
+		bad.FunctionRolePermissions = map[string][]string{
+			"GET_PLAN_LIST": {"PLANER"},
+			"GET_PLAN":      {"PLANNER"},
+		}
+		bad.Printers = map[string]string{"S1": "", "S2": "printer-2"}
+		bad.FontPath = filepath.Join(dir, "missing.ttf")
+		bad.StationFunctionConfig = map[string]FunctionAPIPath{
+			"S3": {BindResourceAPIPath: "mes-agent/bind"},
+		}
+		bad.TrustedProxies = []string{"10.0.0.0/8", "10.1.1.254", "proxy"}
+		bad.LoginProtection = LoginProtection{Delay: time.Minute, MaxDelay: time.Second}
+		bad.IDRules = IDRules{
+			Default:      IDRule{LotNumber: "{bad}"},
+			Stations:     map[string]IDRule{"S2": {ResourceID: "{seq:4}"}},
+			ProductTypes: map[string]IDRule{"TIRE": {ResourceID: "T{bad}"}},
+		}
+		bad.Scales = []Scale{
+			{ID: "SCALE-1", Address: "10.0.0.1", Protocol: "toledo", Stations: []string{"S1"}},
+			{ID: "SCALE-1", Address: "10.0.0.2:4001", Protocol: "and", Stations: []string{"S1"}, Timeout: -time.Second},
+			{ID: "SCALE-3", Address: "10.0.0.3:4001", Protocol: "and"},
+		}
+		bad.OEE.Shifts = []Shift{
+			{Name: "A", Start: "07:00"},
+			{Name: "A", Start: "7 am"},
+			{Start: "08:00"},
+			{Name: "C", Start: "07:00"},
+		}
+
+		report := Check(context.Background(), bad, opts)
+		assert.True(report.HasErrors())
+
+		problems := map[string][]Problem{}
+		for _, section := range report.Sections {
+			if len(section.Problems) > 0 {
+				problems[section.Section] = section.Problems
+			}
+		}
+		assert.Len(problems, 11)
+		assert.Equal([]Problem{
+			{Severity: SeverityError, Message: fontPath + " is not a directory"},
+		}, problems["ui_distribution_directory"])
+		assert.Equal([]Problem{
+			{Severity: SeverityError, Message: "invalid port 0"},
+		}, problems["postgres"])
+		assert.Equal([]Problem{
+			{Severity: SeverityError, Message: "unknown function GET_PLAN"},
+			{Severity: SeverityError, Message: "unknown role PLANER of function GET_PLAN_LIST"},
+			{Severity: SeverityWarning, Message: "functions not granted to any role: ADD_PLAN"},
+		}, problems["permissions"])
+		assert.Equal([]Problem{
+			{Severity: SeverityError, Message: "missing printer of station S1"},
+			{Severity: SeverityError, Message: "station S2 not found"},
+		}, problems["printers"])
+		assert.Equal(SeverityError, problems["font_path"][0].Severity)
+		assert.Equal([]Problem{
+			{Severity: SeverityError, Message: `"mes-agent/bind" is not an absolute URL`},
+			{Severity: SeverityWarning, Message: "failed to check station S3: connection refused"},
+		}, problems["station_function_config"])
+		assert.Equal([]Problem{
+			{Severity: SeverityError, Message: `invalid IP address or CIDR range "proxy"`},
+		}, problems["trusted_proxies"])
+		assert.Equal([]Problem{
+			{Severity: SeverityError, Message: "delay 1m0s is longer than max_delay 1s"},
+		}, problems["login_protection"])
+		assert.Equal([]Problem{
+			{Severity: SeverityError, Message: "default lot_number: unknown token {bad}"},
+			{Severity: SeverityError, Message: "station S2 not found"},
+			{Severity: SeverityError, Message: "product type TIRE resource_id: unknown token {bad}"},
+		}, problems["id_rules"])
+		assert.Equal([]Problem{
+			{Severity: SeverityError, Message: `scale SCALE-1: invalid address "10.0.0.1"`},
+			{Severity: SeverityError, Message: "scale SCALE-1: unknown scale protocol"},
+			{Severity: SeverityError, Message: "duplicated scale SCALE-1"},
+			{Severity: SeverityError, Message: "scale SCALE-1: negative timeout -1s"},
+			{Severity: SeverityError, Message: "station S1 has both scale SCALE-1 and SCALE-1"},
+			{Severity: SeverityWarning, Message: "scale SCALE-3 is not placed at any station"},
+		}, problems["scales"])
+		assert.Equal([]Problem{
+			{Severity: SeverityError, Message: "duplicated shift A"},
+			{Severity: SeverityError, Message: `shift A: invalid start "7 am"`},
+			{Severity: SeverityError, Message: "missing name of shift 2"},
+			{Severity: SeverityError, Message: "shift C starts at the same time as shift A"},
+		}, problems["oee"])
+	}
+	{ // bad plants.
+		cfgs := good
+		cfgs.Plants = []Plant{
+			{Name: "P1", Schema: "p1", Departments: []string{"M2110"}},
+			{Name: "P1", Departments: []string{"M2110"}},
+			{Name: "P2", Schema: "p2"},
+		}
+		report := Check(context.Background(), cfgs, opts)
+		assert.True(report.HasErrors())
+
+		var problems []Problem
+		for _, section := range report.Sections {
+			if section.Section == "plants" {
+				problems = section.Problems
+			}
+		}
+		assert.Equal([]Problem{
+			{Severity: SeverityError, Message: "duplicated plant P1"},
+			{Severity: SeverityError, Message: "missing schema of plant P1"},
+			{Severity: SeverityError, Message: "department M2110 is in both plant P1 and P1"},
+			{Severity: SeverityWarning, Message: "plant P2 has no department, the requests are routed to it only by the plant header or the token"},
+		}, problems)
+	}
+	{ // the inherited sections are checked by the plants.
+		cfgs := good
+		cfgs.Printers = map[string]string{"S2": "printer-2"}
+		cfgs.Plants = []Plant{{Name: "P1", Schema: "p1", Printers: map[string]string{"S1": "printer-1"}}}
+		report := Check(context.Background(), cfgs, opts)
+		assert.False(report.HasErrors())
+		for _, section := range report.Sections {
+			assert.NotEqual("printers", section.Section)
+		}
+
+		report = CheckPlant(context.Background(), cfgs.ForPlant(cfgs.Plants[0]), opts)
+		assert.False(report.HasErrors())
+		sections := make([]string, len(report.Sections))
+		for i, section := range report.Sections {
+			sections[i] = section.Section
+		}
+		assert.Equal([]string{"printers", "station_function_config", "mes_path", "id_rules", "scales", "oee"}, sections)
+
+		report = CheckPlant(context.Background(), cfgs, opts)
+		assert.True(report.HasErrors())
+	}
+	{ // warnings only.
+		cfgs := good
+		cfgs.FunctionRolePermissions = nil
+		report := Check(context.Background(), cfgs, CheckOptions{Functions: opts.Functions})
+		assert.False(report.HasErrors())
+
+		var b strings.Builder
+		_, err := report.WriteTo(&b)
+		assert.NoError(err)
+		assert.Contains(b.String(), "[WARNING] permissions: functions not granted to any role: ADD_PLAN, GET_PLAN_LIST\n")
+		assert.True(strings.HasSuffix(b.String(), "0 error(s), 1 warning(s)\n"))
+	}
+}
@@ -1,15 +1,13 @@
 package configs
 
 import (
-	"fmt"
-	"os"
-	"strconv"
 	"time"
 )
 
 // Options for the implementation
 type Options struct {
 	ServerConfig string `short:"c" long:"server-config" description:"server configuration file" required:"true"`
+	CheckConfig  bool   `long:"check-config" description:"check the server configuration, print the report and exit"`
 }
 
 // DBConnection set PostgreSQL connection settings.
@@ -32,107 +30,6 @@ type ActiveDirectory struct {
 	WithTLS       bool   `yaml:"with_tls"`
 }
 
-// UnmarshalYAML unmarshal the yaml document and replace ${var} or $var
-// in the string according to the values of the current environment variables.
-func (ad *ActiveDirectory) UnmarshalYAML(unmarshal func(interface{}) error) error {
-	type tempActiveDirectory struct {
-		Host          string      `yaml:"host"`
-		Port          interface{} `yaml:"port"`
-		DN            string      `yaml:"base_dn"`
-		QueryUser     string      `yaml:"query_user"`
-		QueryPassword string      `yaml:"query_password"`
-		WithTLS       bool        `yaml:"with_tls"`
-	}
-	var t tempActiveDirectory
-	if err := unmarshal(&t); err != nil {
-		return err
-	}
-
-	port := 0
-	switch type_ := t.Port.(type) {
-	case int8:
-		port = int(type_)
-	case int16:
-		port = int(type_)
-	case int32:
-		port = int(type_)
-	case int64:
-		port = int(type_)
-	case int:
-		port = type_
-	case string:
-		type_ = os.ExpandEnv(type_)
-
-		i, err := strconv.Atoi(type_)
-		if err != nil {
-			return fmt.Errorf("invalid active directory port: %v", err)
-		}
-		port = i
-	default:
-		return fmt.Errorf("invalid type: %T", type_)
-	}
-
-	*ad = ActiveDirectory{
-		Host:          os.ExpandEnv(t.Host),
-		Port:          port,
-		DN:            os.ExpandEnv(t.DN),
-		QueryUser:     os.ExpandEnv(t.QueryUser),
-		QueryPassword: os.ExpandEnv(t.QueryPassword),
-		WithTLS:       t.WithTLS,
-	}
-
-	return nil
-}
-
-func (ad *DBConnection) UnmarshalYAML(unmarshal func(interface{}) error) error {
-	type tempDBConnection struct {
-		Name     string      `yaml:"name"`
-		Address  string      `yaml:"address"`
-		Port     interface{} `yaml:"port"`
-		UserName string      `yaml:"username"`
-		Password string      `yaml:"password"`
-		Schema   string      `yaml:"schema"`
-	}
-	var t tempDBConnection
-	if err := unmarshal(&t); err != nil {
-		return err
-	}
-
-	port := 0
-	switch type_ := t.Port.(type) {
-	case int8:
-		port = int(type_)
-	case int16:
-		port = int(type_)
-	case int32:
-		port = int(type_)
-	case int64:
-		port = int(type_)
-	case int:
-		port = type_
-	case string:
-		type_ = os.ExpandEnv(type_)
-
-		i, err := strconv.Atoi(type_)
-		if err != nil {
-			return fmt.Errorf("invalid PostgreSQL port: %v", err)
-		}
-		port = i
-	default:
-		return fmt.Errorf("invalid type: %T", type_)
-	}
-
-	*ad = DBConnection{
-		Name:     os.ExpandEnv(t.Name),
-		Address:  os.ExpandEnv(t.Address),
-		Port:     port,
-		UserName: os.ExpandEnv(t.UserName),
-		Password: os.ExpandEnv(t.Password),
-		Schema:   os.ExpandEnv(t.Schema),
-	}
-	return nil
-}
-
 // IsEmpty checks if ad configuration is set
 func (ad ActiveDirectory) IsEmpty() bool {
 	return ad.Host == "" &&
@@ -148,21 +45,167 @@ type FunctionAPIPath struct {
 	BindResourceAPIPath    string `yaml:"bindResource"`
 }
 
+// LoginProtection settings of the protection against the password guessing,
+// the defaults are used for the unset fields.
+type LoginProtection struct {
+	// MaxAccountFailures is the number of consecutive failed logins before an
+	// account is locked.
+	MaxAccountFailures int `yaml:"max_account_failures"`
+	// MaxIPFailures is the number of failed logins before an IP is locked.
+	MaxIPFailures   int           `yaml:"max_ip_failures"`
+	LockoutDuration time.Duration `yaml:"lockout_duration"`
+	// FailureWindow is the time after the last failure when the failures are forgotten.
+	FailureWindow time.Duration `yaml:"failure_window"`
+	// Delay is the time to wait after the first failed login of an account,
+	// which is doubled for every further failure up to MaxDelay.
+	Delay    time.Duration `yaml:"delay"`
+	MaxDelay time.Duration `yaml:"max_delay"`
+}
+
+// PasswordPolicy settings of the MES accounts, the zero value accepts every
+// password which never expires.
+type PasswordPolicy struct {
+	MinLength        int  `yaml:"min_length"`
+	RequireUppercase bool `yaml:"require_uppercase"`
+	RequireLowercase bool `yaml:"require_lowercase"`
+	RequireDigit     bool `yaml:"require_digit"`
+	RequireSymbol    bool `yaml:"require_symbol"`
+	// History is the number of the latest passwords which cannot be reused.
+	History int `yaml:"history"`
+	// MaxAge is the time after which a password expires, never if it is 0.
+	MaxAge time.Duration `yaml:"max_age"`
+}
+
+// IDRule patterns of the generated IDs, the empty ones are not defined.
+// See package impl/utils/idrule for the tokens of the patterns.
+type IDRule struct {
+	LotNumber  string `yaml:"lot_number"`
+	ResourceID string `yaml:"resource_id"`
+}
+
+// IDRules of the generated IDs. The rule of a station takes precedence over
+// the one of a product type, which takes precedence over the default one.
+type IDRules struct {
+	Default      IDRule            `yaml:"default"`
+	Stations     map[string]IDRule `yaml:"stations"`
+	ProductTypes map[string]IDRule `yaml:"product_types"`
+}
+
+// IsEmpty checks if any rule is set.
+func (r IDRules) IsEmpty() bool {
+	return r.Default == (IDRule{}) && len(r.Stations) == 0 && len(r.ProductTypes) == 0
+}
+
+// Scale settings of a weighing scale read over TCP, including the indicators
+// behind the serial-over-IP converters.
+type Scale struct {
+	ID string `yaml:"id"`
+	// Address is the host:port of the scale.
+	Address string `yaml:"address"`
+	// Protocol is the format of the indicator, see package impl/utils/scale
+	// for the protocols.
+	Protocol string   `yaml:"protocol"`
+	Stations []string `yaml:"stations"`
+	// Timeout of reading a stable weight, the default is used if it is 0.
+	Timeout time.Duration `yaml:"timeout"`
+	// StableReadings is the number of the same consecutive readings by which
+	// the weight is stable if the protocol does not flag the stable weights.
+	StableReadings int `yaml:"stable_readings"`
+	// NetWeight skips the gross weights flagged by the indicator, so only the
+	// net weights are collected.
+	NetWeight bool `yaml:"net_weight"`
+}
+
+// OEE settings of the OEE calculation.
+type OEE struct {
+	// Shifts of a day, each lasts until the start of the next one. The whole
+	// day is a shift if no shift is defined.
+	Shifts []Shift `yaml:"shifts"`
+	// CycleTimeControl is the name of the common control of the recipes whose
+	// standard value is the standard cycle time of a batch in seconds,
+	// CYCLE_TIME if it is not set.
+	CycleTimeControl string `yaml:"cycle_time_control"`
+}
+
+// IsEmpty checks if any setting is set.
+func (o OEE) IsEmpty() bool {
+	return len(o.Shifts) == 0 && o.CycleTimeControl == ""
+}
+
+// Shift of a day.
+type Shift struct {
+	Name string `yaml:"name"`
+	// Start is the time of the day in the format of "15:04".
+	Start string `yaml:"start"`
+}
+
+// Plant settings in the multi-plant mode, each plant has its own PostgreSQL
+// schema, and the unset settings are inherited from the top level ones.
+type Plant struct {
+	Name   string `yaml:"name"`
+	Schema string `yaml:"schema"`
+	// Departments are the departments of the plant, by which the requests
+	// with a department are routed to the plant.
+	Departments           []string                   `yaml:"departments"`
+	MesPath               string                     `yaml:"mes_path"`
+	Printers              map[string]string          `yaml:"printers"`
+	StationFunctionConfig map[string]FunctionAPIPath `yaml:"station_function_config"`
+	IDRules               IDRules                    `yaml:"id_rules"`
+	Scales                []Scale                    `yaml:"scales"`
+	OEE                   OEE                        `yaml:"oee"`
+}
+
 // Configs for
 type Configs struct {
 	DevMode        bool   `yaml:"development_mode"`
 	UIDir          string `yaml:"ui_distribution_directory"`
 	CreateUIConfig bool   `yaml:"create_ui_configuration"`
 
-	Timeout                 time.Duration              `yaml:"timeout"`
-	WebServiceEndpoint      string                     `yaml:"web_service_endpoint"`
-	PostgreSQL              DBConnection               `yaml:"postgres"`
-	ActiveDirectory         ActiveDirectory            `yaml:"active_directory"`
-	CorsAllowedOrigins      []string                   `yaml:"cors_allowed_origins"`
+	Timeout            time.Duration   `yaml:"timeout"`
+	WebServiceEndpoint string          `yaml:"web_service_endpoint"`
+	PostgreSQL         DBConnection    `yaml:"postgres"`
+	ActiveDirectory    ActiveDirectory `yaml:"active_directory"`
+	CorsAllowedOrigins []string        `yaml:"cors_allowed_origins"`
+	// TrustedProxies are the IP addresses or CIDR ranges of the proxies whose
+	// X-Forwarded-For headers are trusted.
+	TrustedProxies          []string                   `yaml:"trusted_proxies"`
 	TokenExpiredSeconds     int                        `yaml:"token_expired_in_seconds"`
 	FunctionRolePermissions map[string][]string        `yaml:"permissions"`
 	Printers                map[string]string          `yaml:"printers"`
 	FontPath                string                     `yaml:"font_path"`
 	StationFunctionConfig   map[string]FunctionAPIPath `yaml:"station_function_config"`
 	MesPath                 string                     `yaml:"mes_path"`
+	LoginProtection         LoginProtection            `yaml:"login_protection"`
+	PasswordPolicy          PasswordPolicy             `yaml:"password_policy"`
+	IDRules                 IDRules                    `yaml:"id_rules"`
+	Scales                  []Scale                    `yaml:"scales"`
+	OEE                     OEE                        `yaml:"oee"`
+	// Plants enables the multi-plant mode if it is not empty, the first plant
+	// is the default one.
+	Plants []Plant `yaml:"plants"`
+}
+
+// ForPlant returns the configurations of the plant.
+func (c Configs) ForPlant(p Plant) Configs {
+	c.PostgreSQL.Schema = p.Schema
+	if p.MesPath != "" {
+		c.MesPath = p.MesPath
+	}
+	if p.Printers != nil {
+		c.Printers = p.Printers
+	}
+	if p.StationFunctionConfig != nil {
+		c.StationFunctionConfig = p.StationFunctionConfig
+	}
+	if !p.IDRules.IsEmpty() {
+		c.IDRules = p.IDRules
+	}
+	if p.Scales != nil {
+		c.Scales = p.Scales
+	}
+	if !p.OEE.IsEmpty() {
+		c.OEE = p.OEE
+	}
+	c.Plants = nil
+	return c
 }
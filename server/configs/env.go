@@ -0,0 +1,149 @@
+package configs
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// EnvPrefix is the prefix of the environment variables overriding the
+// configurations, e.g. MUI_POSTGRES_PASSWORD overrides the password of
+// postgres, and MUI_POSTGRES_PASSWORD_FILE reads it from a file.
+const EnvPrefix = "MUI"
+
+// fileSuffix is the suffix of the environment variables naming the files to
+// read the configuration values from, such as the mounted secrets.
+const fileSuffix = "_FILE"
+
+// envRef matches the ${var} references to the environment variables.
+var envRef = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// Load parses the configuration file, replaces ${var} in the values according
+// to the environment variables, and then applies the overrides of the prefixed
+// environment variables.
+func Load(data []byte) (*Configs, error) {
+	data, err := expandYAML(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var cfgs Configs
+	if err := yaml.UnmarshalStrict(data, &cfgs); err != nil {
+		return nil, err
+	}
+	if err := applyEnv(reflect.ValueOf(&cfgs).Elem(), EnvPrefix); err != nil {
+		return nil, err
+	}
+	return &cfgs, nil
+}
+
+// expandYAML replaces ${var} in the scalars of the yaml document, so that the
+// values of any type, e.g. port: ${PORT}, may refer to the environment
+// variables. The other $ are kept literally, e.g. in a password.
+func expandYAML(data []byte) ([]byte, error) {
+	var doc yamlv3.Node
+	if err := yamlv3.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	if doc.Kind == 0 { // empty document.
+		return data, nil
+	}
+	expandNode(&doc)
+	return yamlv3.Marshal(&doc)
+}
+
+// expandNode expands the scalars of the node and its children. The expanded
+// scalars are resolved again by the types of the fields they are decoded to.
+func expandNode(n *yamlv3.Node) {
+	if n.Kind == yamlv3.ScalarNode {
+		if value := expandEnv(n.Value); value != n.Value {
+			n.Value, n.Tag, n.Style = value, "", 0
+		}
+		return
+	}
+	for _, c := range n.Content {
+		expandNode(c)
+	}
+}
+
+// expandEnv replaces ${var} in s by the value of the environment variable,
+// which is empty if the variable is not set.
+func expandEnv(s string) string {
+	return envRef.ReplaceAllStringFunc(s, func(ref string) string {
+		return os.Getenv(ref[2 : len(ref)-1])
+	})
+}
+
+// applyEnv overrides the fields of the struct by the environment variables
+// named after their yaml keys.
+func applyEnv(v reflect.Value, name string) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		key := strings.Split(t.Field(i).Tag.Get("yaml"), ",")[0]
+		if key == "" || key == "-" {
+			continue
+		}
+		envName := name + "_" + strings.ToUpper(key)
+
+		field := v.Field(i)
+		if field.Kind() == reflect.Struct {
+			if err := applyEnv(field, envName); err != nil {
+				return err
+			}
+			continue
+		}
+
+		value, ok, err := lookupEnv(envName)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		if err := setValue(field, value); err != nil {
+			return fmt.Errorf("invalid %s: %v", envName, err)
+		}
+	}
+	return nil
+}
+
+// lookupEnv returns the value of the environment variable, or the content of
+// the file named by the variable with fileSuffix.
+func lookupEnv(name string) (string, bool, error) {
+	value, ok := os.LookupEnv(name)
+	path, fromFile := os.LookupEnv(name + fileSuffix)
+	if ok && fromFile {
+		return "", false, fmt.Errorf("both %s and %s%s are set", name, name, fileSuffix)
+	}
+	if !fromFile {
+		return value, ok, nil
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to read %s%s: %v", name, fileSuffix, err)
+	}
+	// the trailing newline is usually added by the editors.
+	return strings.TrimRight(string(content), "\r\n"), true, nil
+}
+
+// setValue sets the strings as they are, and decodes the other values as
+// yaml, e.g. 30s for a time.Duration or [a, b] for a slice.
+func setValue(v reflect.Value, value string) error {
+	if v.Kind() == reflect.String {
+		v.SetString(value)
+		return nil
+	}
+
+	ptr := reflect.New(v.Type())
+	if err := yaml.UnmarshalStrict([]byte(value), ptr.Interface()); err != nil {
+		return err
+	}
+	v.Set(ptr.Elem())
+	return nil
+}
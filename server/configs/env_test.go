@@ -0,0 +1,156 @@
+package configs
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoad(t *testing.T) {
+	assert := assert.New(t)
+
+	secret := filepath.Join(t.TempDir(), "secret")
+	assert.NoError(os.WriteFile(secret, []byte("s3cr3t\n"), 0o600))
+
+	t.Setenv("TEST_MES_HOST", "mes-host")
+	t.Setenv("TEST_PRINTER", "printer-1")
+	t.Setenv("MUI_POSTGRES_PORT", "5433")
+	t.Setenv("MUI_POSTGRES_PASSWORD_FILE", secret)
+	t.Setenv("MUI_ACTIVE_DIRECTORY_QUERY_PASSWORD", "ad-password")
+	t.Setenv("MUI_TIMEOUT", "30s")
+	t.Setenv("MUI_CORS_ALLOWED_ORIGINS", "[http://a, http://b]")
+	t.Setenv("MUI_LOGIN_PROTECTION_MAX_DELAY", "1m")
+	t.Setenv("MUI_PASSWORD_POLICY_REQUIRE_DIGIT", "true")
+
+	cfgs, err := Load([]byte(`
+timeout: 10s
+postgres:
+  name: mes
+  address: localhost
+  port: 5432
+  password: in-yaml
+active_directory:
+  host: ad-host
+  port: 389
+printers:
+  S1: ${TEST_PRINTER}
+station_function_config:
+  S1:
+    loadWorkOrder: http://${TEST_MES_HOST}/load
+mes_path: http://${TEST_MES_HOST}
+login_protection:
+  delay: 1s
+`))
+	assert.NoError(err)
+	assert.Equal(&Configs{
+		Timeout: 30 * time.Second,
+		PostgreSQL: DBConnection{
+			Name:     "mes",
+			Address:  "localhost",
+			Port:     5433,
+			Password: "s3cr3t",
+		},
+		ActiveDirectory: ActiveDirectory{
+			Host:          "ad-host",
+			Port:          389,
+			QueryPassword: "ad-password",
+		},
+		CorsAllowedOrigins: []string{"http://a", "http://b"},
+		Printers:           map[string]string{"S1": "printer-1"},
+		StationFunctionConfig: map[string]FunctionAPIPath{
+			"S1": {LoadWorkOrderAPIPath: "http://mes-host/load"},
+		},
+		MesPath: "http://mes-host",
+		LoginProtection: LoginProtection{
+			Delay:    time.Second,
+			MaxDelay: time.Minute,
+		},
+		PasswordPolicy: PasswordPolicy{
+			RequireDigit: true,
+		},
+	}, cfgs)
+
+	{ // both the value and the file are set.
+		t.Setenv("MUI_POSTGRES_PASSWORD", "password")
+		_, err := Load([]byte("postgres:\n  port: 5432\n"))
+		assert.EqualError(err, "both MUI_POSTGRES_PASSWORD and MUI_POSTGRES_PASSWORD_FILE are set")
+	}
+	{ // bad value.
+		t.Setenv("MUI_POSTGRES_PASSWORD_FILE", "")
+		os.Unsetenv("MUI_POSTGRES_PASSWORD_FILE")
+		t.Setenv("MUI_TIMEOUT", "soon")
+		_, err := Load([]byte("postgres:\n  port: 5432\n"))
+		if assert.Error(err) {
+			assert.Contains(err.Error(), "invalid MUI_TIMEOUT")
+		}
+	}
+}
+
+func TestLoad_expandEnv(t *testing.T) {
+	assert := assert.New(t)
+
+	t.Setenv("TEST_HOST", "my-host")
+	t.Setenv("TEST_PORT", "1234")
+	t.Setenv("TEST_BASE_DN", "my-base-dn")
+	t.Setenv("TEST_PASSWORD", "007")
+	t.Setenv("TEST_TLS", "true")
+	t.Setenv("TEST_SCHEMA", "a: b")
+
+	{ // values from environment variables.
+		cfgs, err := Load([]byte(`
+postgres:
+  address: ${TEST_HOST}
+  port: ${TEST_PORT}
+  password: "${TEST_PASSWORD}"
+  schema: ${TEST_SCHEMA}
+active_directory:
+  host: ${TEST_HOST}
+  port: "${TEST_PORT}"
+  base_dn: ${TEST_BASE_DN}
+  query_password: ${TEST_PASSWORD}
+  with_tls: ${TEST_TLS}
+`))
+		assert.NoError(err)
+		assert.Equal(DBConnection{
+			Address:  "my-host",
+			Port:     1234,
+			Password: "007",
+			Schema:   "a: b",
+		}, cfgs.PostgreSQL)
+		assert.Equal(ActiveDirectory{
+			Host:          "my-host",
+			Port:          1234,
+			DN:            "my-base-dn",
+			QueryPassword: "007",
+			WithTLS:       true,
+		}, cfgs.ActiveDirectory)
+	}
+	{ // literal $ are kept.
+		cfgs, err := Load([]byte(`
+postgres:
+  address: $TEST_HOST
+  password: pa$$word${TEST_PASSWORD}$
+`))
+		assert.NoError(err)
+		assert.Equal(DBConnection{
+			Address:  "$TEST_HOST",
+			Password: "pa$$word007$",
+		}, cfgs.PostgreSQL)
+	}
+	{ // bad case: string type port.
+		_, err := Load([]byte("active_directory:\n  port: TEST_PORT\n"))
+		assert.Error(err)
+	}
+	{ // bad case: port from a non-integer variable.
+		_, err := Load([]byte("postgres:\n  port: ${TEST_HOST}\n"))
+		assert.Error(err)
+	}
+	{ // empty document.
+		cfgs, err := Load(nil)
+		assert.NoError(err)
+		assert.Equal(&Configs{}, cfgs)
+	}
+}
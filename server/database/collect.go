@@ -0,0 +1,164 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// MesCollect is a collect record created by MES through MUI, which can not be
+// reversed in MUI alone.
+type MesCollect struct {
+	WorkOrder  string `gorm:"primaryKey"`
+	Sequence   int16  `gorm:"primaryKey;autoIncrement:false"`
+	Station    string `gorm:"not null"`
+	ResourceID string
+	CreatedBy  string `gorm:"not null"`
+	CreatedAt  time.Time
+}
+
+// TableName implements gorm.Tabler interface.
+func (MesCollect) TableName() string {
+	return "mui_mes_collects"
+}
+
+// CollectReversal is the reversal of a collect record, which is voided since
+// the data manager keeps the collect records forever.
+type CollectReversal struct {
+	ID         int64  `gorm:"primaryKey"`
+	WorkOrder  string `gorm:"uniqueIndex:idx_mui_collect_reversals_record;not null"`
+	Sequence   int16  `gorm:"uniqueIndex:idx_mui_collect_reversals_record;not null"`
+	ResourceID string `gorm:"index"`
+	// Carrier is the carrier which the resource was unbound from.
+	Carrier string
+	// Quantity is the collected quantity.
+	Quantity decimal.Decimal `gorm:"type:numeric;not null"`
+	// AdjustedQuantity is the corrected quantity of the resource, or null if
+	// the resource was deactivated.
+	AdjustedQuantity decimal.NullDecimal `gorm:"type:numeric"`
+	Reason           string              `gorm:"not null"`
+	CreatedBy        string              `gorm:"not null"`
+	CreatedAt        time.Time
+}
+
+// TableName implements gorm.Tabler interface.
+func (CollectReversal) TableName() string {
+	return "mui_collect_reversals"
+}
+
+// CollectStore stores the sources and the reversals of the collect records.
+type CollectStore interface {
+	// CreateMesCollect records a collect created by MES.
+	CreateMesCollect(ctx context.Context, collect MesCollect) error
+	// GetMesCollect returns the specified collect created by MES.
+	// It returns ErrRecordNotFound if the collect was not created by MES.
+	GetMesCollect(ctx context.Context, workOrder string, sequence int16) (MesCollect, error)
+	// CreateCollectReversal records the reversal of a collect record.
+	// It returns ErrRecordExisted if the collect record has been reversed.
+	CreateCollectReversal(ctx context.Context, reversal CollectReversal) error
+	// GetCollectReversal returns the reversal of the specified collect record.
+	// It returns ErrRecordNotFound if the collect record is not reversed.
+	GetCollectReversal(ctx context.Context, workOrder string, sequence int16) (CollectReversal, error)
+	// DeleteCollectReversal deletes the reversal of the specified collect
+	// record, which is not reversed then.
+	DeleteCollectReversal(ctx context.Context, workOrder string, sequence int16) error
+	// SumReversedQuantities sums the quantities taken off the collects of the
+	// work orders by the reversals, by work order.
+	SumReversedQuantities(ctx context.Context, workOrders []string) (map[string]decimal.Decimal, error)
+}
+
+type collectStore struct {
+	db *gorm.DB
+}
+
+// NewCollectStore returns a CollectStore and migrates its tables.
+func NewCollectStore(db *gorm.DB) (CollectStore, error) {
+	if err := db.AutoMigrate(&MesCollect{}, &CollectReversal{}); err != nil {
+		return nil, err
+	}
+	return collectStore{db: db}, nil
+}
+
+// CreateMesCollect implements CollectStore interface.
+func (s collectStore) CreateMesCollect(ctx context.Context, collect MesCollect) error {
+	return s.db.WithContext(ctx).Create(&collect).Error
+}
+
+// GetMesCollect implements CollectStore interface.
+func (s collectStore) GetMesCollect(ctx context.Context, workOrder string, sequence int16) (MesCollect, error) {
+	var collect MesCollect
+	if err := s.db.WithContext(ctx).
+		Where("work_order = ? AND sequence = ?", workOrder, sequence).
+		Take(&collect).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return MesCollect{}, ErrRecordNotFound
+		}
+		return MesCollect{}, err
+	}
+	return collect, nil
+}
+
+// CreateCollectReversal implements CollectStore interface.
+func (s collectStore) CreateCollectReversal(ctx context.Context, reversal CollectReversal) error {
+	// the unique index keeps the concurrent reversals of a collect record from
+	// both being created.
+	result := s.db.WithContext(ctx).
+		Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&reversal)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrRecordExisted
+	}
+	return nil
+}
+
+// GetCollectReversal implements CollectStore interface.
+func (s collectStore) GetCollectReversal(ctx context.Context, workOrder string, sequence int16) (CollectReversal, error) {
+	var reversal CollectReversal
+	if err := s.db.WithContext(ctx).
+		Where("work_order = ? AND sequence = ?", workOrder, sequence).
+		Take(&reversal).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return CollectReversal{}, ErrRecordNotFound
+		}
+		return CollectReversal{}, err
+	}
+	return reversal, nil
+}
+
+// DeleteCollectReversal implements CollectStore interface.
+func (s collectStore) DeleteCollectReversal(ctx context.Context, workOrder string, sequence int16) error {
+	return s.db.WithContext(ctx).
+		Where("work_order = ? AND sequence = ?", workOrder, sequence).
+		Delete(&CollectReversal{}).Error
+}
+
+// SumReversedQuantities implements CollectStore interface.
+func (s collectStore) SumReversedQuantities(ctx context.Context, workOrders []string) (map[string]decimal.Decimal, error) {
+	if len(workOrders) == 0 {
+		return map[string]decimal.Decimal{}, nil
+	}
+	var sums []struct {
+		WorkOrder string
+		Quantity  decimal.Decimal
+	}
+	if err := s.db.WithContext(ctx).Model(&CollectReversal{}).
+		// a voided collect takes off all the collected quantity.
+		Select("work_order, SUM(quantity - COALESCE(adjusted_quantity, 0)) AS quantity").
+		Where("work_order IN ?", workOrders).
+		Group("work_order").
+		Scan(&sums).Error; err != nil {
+		return nil, err
+	}
+	reversed := make(map[string]decimal.Decimal, len(sums))
+	for _, sum := range sums {
+		reversed[sum.WorkOrder] = sum.Quantity
+	}
+	return reversed, nil
+}
@@ -0,0 +1,64 @@
+package database
+
+import (
+	"context"
+	"testing"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+
+	"gitlab.kenda.com.tw/kenda/mui/server/database/dbtest"
+)
+
+func TestCollectStore_reversal(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	store, err := NewCollectStore(dbtest.Open(t))
+	assert.NoError(err)
+
+	reversal := CollectReversal{
+		WorkOrder:  "WO1",
+		Sequence:   1,
+		ResourceID: "R1",
+		Quantity:   decimal.NewFromInt(10),
+		Reason:     "wrong quantity",
+		CreatedBy:  "tester",
+	}
+	assert.NoError(store.CreateCollectReversal(ctx, reversal))
+	assert.ErrorIs(store.CreateCollectReversal(ctx, reversal), ErrRecordExisted)
+
+	got, err := store.GetCollectReversal(ctx, "WO1", 1)
+	assert.NoError(err)
+	assert.Equal("R1", got.ResourceID)
+	assert.True(decimal.NewFromInt(10).Equal(got.Quantity))
+
+	{ // the deleted reversal can be recorded again.
+		assert.NoError(store.DeleteCollectReversal(ctx, "WO1", 1))
+		_, err := store.GetCollectReversal(ctx, "WO1", 1)
+		assert.ErrorIs(err, ErrRecordNotFound)
+		assert.NoError(store.CreateCollectReversal(ctx, reversal))
+	}
+}
+
+func TestCollectStore_SumReversedQuantities(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	store, err := NewCollectStore(dbtest.Open(t))
+	assert.NoError(err)
+
+	for _, reversal := range []CollectReversal{
+		{WorkOrder: "WO1", Sequence: 1, Quantity: decimal.NewFromInt(10)},
+		{WorkOrder: "WO1", Sequence: 2, Quantity: decimal.NewFromInt(10), AdjustedQuantity: decimal.NewNullDecimal(decimal.NewFromInt(7))},
+		{WorkOrder: "WO2", Sequence: 1, Quantity: decimal.NewFromInt(5)},
+	} {
+		reversal.Reason, reversal.CreatedBy = "wrong quantity", "tester"
+		assert.NoError(store.CreateCollectReversal(ctx, reversal))
+	}
+
+	got, err := store.SumReversedQuantities(ctx, []string{"WO1", "WO3"})
+	assert.NoError(err)
+	assert.Len(got, 1)
+	assert.True(decimal.NewFromInt(13).Equal(got["WO1"]))
+}
@@ -0,0 +1,51 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// SequenceCounter is a counter of the generated IDs.
+type SequenceCounter struct {
+	// Key identifies the counter, including the rule and the reset period.
+	Key       string `gorm:"primaryKey"`
+	Value     int64  `gorm:"not null"`
+	UpdatedAt time.Time
+}
+
+// TableName implements gorm.Tabler interface.
+func (SequenceCounter) TableName() string {
+	return "mui_sequence_counters"
+}
+
+// CounterStore stores the counters of the generated IDs.
+type CounterStore interface {
+	// Next increases the counter of the key and returns the increased value,
+	// starting from 1. It is safe for the concurrent requests.
+	Next(ctx context.Context, key string) (int64, error)
+}
+
+type counterStore struct {
+	db *gorm.DB
+}
+
+// NewCounterStore returns a CounterStore and migrates its tables.
+func NewCounterStore(db *gorm.DB) (CounterStore, error) {
+	if err := db.AutoMigrate(&SequenceCounter{}); err != nil {
+		return nil, err
+	}
+	return counterStore{db: db}, nil
+}
+
+// Next implements CounterStore interface.
+func (s counterStore) Next(ctx context.Context, key string) (int64, error) {
+	var value int64
+	if err := s.db.WithContext(ctx).Raw(`INSERT INTO mui_sequence_counters (key, value, updated_at) VALUES (?, 1, ?)
+ON CONFLICT (key) DO UPDATE SET value = mui_sequence_counters.value + 1, updated_at = EXCLUDED.updated_at
+RETURNING value`, key, time.Now()).Scan(&value).Error; err != nil {
+		return 0, err
+	}
+	return value, nil
+}
@@ -0,0 +1,31 @@
+package database
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"gitlab.kenda.com.tw/kenda/mui/server/database/dbtest"
+)
+
+func TestCounterStore_Next(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	store, err := NewCounterStore(dbtest.Open(t))
+	assert.NoError(err)
+
+	for want := int64(1); want <= 3; want++ {
+		got, err := store.Next(ctx, "RULE/2022-12")
+		assert.NoError(err)
+		assert.Equal(want, got)
+	}
+	// the keys are counted separately.
+	got, err := store.Next(ctx, "RULE/2023-01")
+	assert.NoError(err)
+	assert.Equal(int64(1), got)
+	got, err = store.Next(ctx, "RULE/2022-12")
+	assert.NoError(err)
+	assert.Equal(int64(4), got)
+}
@@ -0,0 +1,55 @@
+// Package database provides the data stored by MUI itself, such as the data
+// which are not maintained by the data manager.
+//
+// All tables are prefixed with "mui_" to avoid conflicts with the tables
+// maintained by the data manager inside the same schema.
+package database
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrRecordNotFound is returned when the specified record does not exist.
+	ErrRecordNotFound = errors.New("record not found")
+	// ErrRecordExisted is returned when the specified record has already existed.
+	ErrRecordExisted = errors.New("record existed")
+	// ErrVersionConflict is returned when the specified record has been modified
+	// by others since it was read.
+	ErrVersionConflict = errors.New("record version conflict")
+	// ErrRecordLocked is returned when the specified record is locked by others.
+	ErrRecordLocked = errors.New("record locked")
+)
+
+// Strings is a list of strings stored as a JSON array.
+type Strings []string
+
+// Value implements driver.Valuer interface.
+func (s Strings) Value() (driver.Value, error) {
+	if s == nil {
+		return "[]", nil
+	}
+	b, err := json.Marshal(s)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+// Scan implements sql.Scanner interface.
+func (s *Strings) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case []byte:
+		return json.Unmarshal(v, s)
+	case string:
+		return json.Unmarshal([]byte(v), s)
+	case nil:
+		*s = nil
+		return nil
+	default:
+		return fmt.Errorf("unsupported type %T for Strings", src)
+	}
+}
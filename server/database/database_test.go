@@ -0,0 +1,62 @@
+package database
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStrings(t *testing.T) {
+	assert := assert.New(t)
+
+	{ // value.
+		v, err := Strings{"ADMINISTRATOR", "LEADER"}.Value()
+		assert.NoError(err)
+		assert.Equal(`["ADMINISTRATOR","LEADER"]`, v)
+
+		v, err = Strings(nil).Value()
+		assert.NoError(err)
+		assert.Equal("[]", v)
+	}
+	{ // scan.
+		var s Strings
+		assert.NoError(s.Scan([]byte(`["ADMINISTRATOR"]`)))
+		assert.Equal(Strings{"ADMINISTRATOR"}, s)
+
+		assert.NoError(s.Scan(`["LEADER","OPERATOR"]`))
+		assert.Equal(Strings{"LEADER", "OPERATOR"}, s)
+
+		assert.NoError(s.Scan(nil))
+		assert.Nil(s)
+
+		assert.EqualError(s.Scan(1), "unsupported type int for Strings")
+	}
+}
+
+func TestDefectKind_Valid(t *testing.T) {
+	assert := assert.New(t)
+	assert.True(DefectKindDefect.Valid())
+	assert.True(DefectKindScrap.Valid())
+	assert.False(DefectKind("").Valid())
+	assert.False(DefectKind("REWORK").Valid())
+}
+
+func TestAgingHold_Active(t *testing.T) {
+	assert := assert.New(t)
+	now := time.Now()
+	released := now.Add(-time.Minute)
+
+	assert.True(AgingHold{Until: now.Add(time.Hour)}.Active(now))
+	assert.False(AgingHold{Until: now}.Active(now))
+	assert.False(AgingHold{Until: now.Add(-time.Hour)}.Active(now))
+	assert.False(AgingHold{Until: now.Add(time.Hour), ReleasedAt: &released}.Active(now))
+}
+
+func TestFeedRecord_consumedResources(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal([]string{"R1"}, FeedRecord{ResourceID: "R1"}.consumedResources())
+	assert.Equal([]string{"R1", "R2"}, FeedRecord{SiteResources: []string{"R1", "", "R2"}}.consumedResources())
+	assert.Equal([]string{"R1", "R2"}, FeedRecord{ResourceID: "R1", SiteResources: []string{"R1", "R2"}}.consumedResources())
+	assert.Empty(FeedRecord{}.consumedResources())
+}
@@ -0,0 +1,259 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// DefectKind is the kind of the quantity which is not collected as good.
+type DefectKind string
+
+// DefectKind definitions.
+const (
+	// DefectKindDefect is the quantity which may be reworked.
+	DefectKindDefect DefectKind = "DEFECT"
+	// DefectKindScrap is the quantity which is thrown away.
+	DefectKindScrap DefectKind = "SCRAP"
+)
+
+// Valid reports whether the kind is defined.
+func (k DefectKind) Valid() bool {
+	return k == DefectKindDefect || k == DefectKindScrap
+}
+
+// DefectReason is the master data of the reasons of the defective and the
+// scrap quantities.
+type DefectReason struct {
+	Code        string     `gorm:"primaryKey"`
+	Kind        DefectKind `gorm:"not null"`
+	Description string
+	// Disabled reasons are kept for the recorded defects but can not be used
+	// anymore.
+	Disabled  bool
+	UpdatedBy string `gorm:"not null"`
+	UpdatedAt time.Time
+}
+
+// TableName implements gorm.Tabler interface.
+func (DefectReason) TableName() string {
+	return "mui_defect_reasons"
+}
+
+// CollectDefect is a defective or a scrap quantity recorded with a collect.
+type CollectDefect struct {
+	ID        int64  `gorm:"primaryKey"`
+	WorkOrder string `gorm:"index:idx_mui_collect_defects_collect;uniqueIndex:idx_mui_collect_defects_reason;not null"`
+	Sequence  int16  `gorm:"index:idx_mui_collect_defects_collect;uniqueIndex:idx_mui_collect_defects_reason;not null"`
+	Batch     int16  `gorm:"not null"`
+	Station   string `gorm:"index;not null"`
+	// ReasonCode and Kind are copied from the reason at the time of recording.
+	ReasonCode string          `gorm:"uniqueIndex:idx_mui_collect_defects_reason;not null"`
+	Kind       DefectKind      `gorm:"not null"`
+	Quantity   decimal.Decimal `gorm:"type:numeric;not null"`
+	CreatedBy  string          `gorm:"not null"`
+	CreatedAt  time.Time
+}
+
+// TableName implements gorm.Tabler interface.
+func (CollectDefect) TableName() string {
+	return "mui_collect_defects"
+}
+
+// DefectSum is the total quantity of a reason in a work order.
+type DefectSum struct {
+	WorkOrder  string
+	ReasonCode string
+	Kind       DefectKind
+	Quantity   decimal.Decimal
+}
+
+// DefectStore stores the defect reasons and the defects recorded with the
+// collects.
+type DefectStore interface {
+	// ListDefectReasons lists all the defect reasons in code order.
+	ListDefectReasons(ctx context.Context) ([]DefectReason, error)
+	// CreateDefectReason creates a defect reason.
+	// It returns ErrRecordExisted if the code has existed.
+	CreateDefectReason(ctx context.Context, reason DefectReason) error
+	// UpdateDefectReason replaces the defect reason of the same code.
+	// It returns ErrRecordNotFound if the code does not exist.
+	UpdateDefectReason(ctx context.Context, reason DefectReason) error
+	// CreateCollectDefects records the defects of a collect. All the defects
+	// must belong to the same collect, and the ones of the same reason are
+	// summed. It returns ErrRecordExisted if the defects of the collect have
+	// been recorded.
+	CreateCollectDefects(ctx context.Context, defects []CollectDefect) error
+	// DeleteCollectDefects deletes the defects of a collect.
+	DeleteCollectDefects(ctx context.Context, workOrder string, sequence int16) error
+	// SumCollectDefects sums the defects of the work orders by reason, the
+	// defects of the voided collects are excluded.
+	SumCollectDefects(ctx context.Context, workOrders []string) ([]DefectSum, error)
+	// ListCollectDefects lists the filtered defects in time order, the filter
+	// of the product is not applied.
+	ListCollectDefects(ctx context.Context, filter RecordFilter) ([]CollectDefect, error)
+}
+
+type defectStore struct {
+	db *gorm.DB
+}
+
+// NewDefectStore returns a DefectStore and migrates its tables.
+func NewDefectStore(db *gorm.DB) (DefectStore, error) {
+	if err := mergeCollectDefects(db); err != nil {
+		return nil, err
+	}
+	if err := db.AutoMigrate(&DefectReason{}, &CollectDefect{}); err != nil {
+		return nil, err
+	}
+	return defectStore{db: db}, nil
+}
+
+// mergeCollectDefects sums the defects of the same reason in a collect, which
+// were recorded separately before they were unique.
+func mergeCollectDefects(db *gorm.DB) error {
+	const table = "mui_collect_defects"
+	if !db.Migrator().HasTable(table) {
+		return nil
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("UPDATE " + table + " SET quantity = (" +
+			"SELECT SUM(d.quantity) FROM " + table + " d WHERE d.work_order = " + table + ".work_order AND d.sequence = " + table + ".sequence AND d.reason_code = " + table + ".reason_code" +
+			") WHERE id IN (SELECT MIN(id) FROM " + table + " GROUP BY work_order, sequence, reason_code HAVING COUNT(*) > 1)").Error; err != nil {
+			return err
+		}
+		return tx.Exec("DELETE FROM " + table + " WHERE id NOT IN (SELECT MIN(id) FROM " + table + " GROUP BY work_order, sequence, reason_code)").Error
+	})
+}
+
+// ListDefectReasons implements DefectStore interface.
+func (s defectStore) ListDefectReasons(ctx context.Context) ([]DefectReason, error) {
+	var reasons []DefectReason
+	if err := s.db.WithContext(ctx).Order("code").Find(&reasons).Error; err != nil {
+		return nil, err
+	}
+	return reasons, nil
+}
+
+// CreateDefectReason implements DefectStore interface.
+func (s defectStore) CreateDefectReason(ctx context.Context, reason DefectReason) error {
+	// the primary key keeps the concurrent creations of a code from both
+	// being created.
+	result := s.db.WithContext(ctx).
+		Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&reason)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrRecordExisted
+	}
+	return nil
+}
+
+// UpdateDefectReason implements DefectStore interface.
+func (s defectStore) UpdateDefectReason(ctx context.Context, reason DefectReason) error {
+	result := s.db.WithContext(ctx).Model(&DefectReason{}).
+		Where("code = ?", reason.Code).
+		Updates(map[string]interface{}{
+			"kind":        reason.Kind,
+			"description": reason.Description,
+			"disabled":    reason.Disabled,
+			"updated_by":  reason.UpdatedBy,
+			"updated_at":  time.Now(),
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// CreateCollectDefects implements DefectStore interface.
+func (s defectStore) CreateCollectDefects(ctx context.Context, defects []CollectDefect) error {
+	if len(defects) == 0 {
+		return nil
+	}
+	merged := make([]CollectDefect, 0, len(defects))
+	reasons := make(map[string]int, len(defects))
+	for _, defect := range defects {
+		if defect.WorkOrder != defects[0].WorkOrder || defect.Sequence != defects[0].Sequence {
+			return errors.New("defects of different collects")
+		}
+		if i, ok := reasons[defect.ReasonCode]; ok {
+			merged[i].Quantity = merged[i].Quantity.Add(defect.Quantity)
+			continue
+		}
+		reasons[defect.ReasonCode] = len(merged)
+		merged = append(merged, defect)
+	}
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&CollectDefect{}).
+			Where("work_order = ? AND sequence = ?", merged[0].WorkOrder, merged[0].Sequence).
+			Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrRecordExisted
+		}
+		// the unique index keeps the concurrent recordings of a reason from
+		// both being created.
+		result := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "work_order"}, {Name: "sequence"}, {Name: "reason_code"}},
+			DoNothing: true,
+		}).Create(&merged)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected < int64(len(merged)) {
+			return ErrRecordExisted
+		}
+		return nil
+	})
+}
+
+// DeleteCollectDefects implements DefectStore interface.
+func (s defectStore) DeleteCollectDefects(ctx context.Context, workOrder string, sequence int16) error {
+	return s.db.WithContext(ctx).
+		Where("work_order = ? AND sequence = ?", workOrder, sequence).
+		Delete(&CollectDefect{}).Error
+}
+
+// SumCollectDefects implements DefectStore interface.
+func (s defectStore) SumCollectDefects(ctx context.Context, workOrders []string) ([]DefectSum, error) {
+	if len(workOrders) == 0 {
+		return nil, nil
+	}
+	var sums []DefectSum
+	if err := s.db.WithContext(ctx).Model(&CollectDefect{}).
+		Select("work_order, reason_code, kind, SUM(quantity) AS quantity").
+		Where("work_order IN ?", workOrders).
+		// the collects reversed to a corrected quantity are kept.
+		Where("NOT EXISTS (SELECT 1 FROM mui_collect_reversals r WHERE r.work_order = mui_collect_defects.work_order AND r.sequence = mui_collect_defects.sequence AND r.adjusted_quantity IS NULL)").
+		Group("work_order, reason_code, kind").
+		Order("work_order, reason_code").
+		Scan(&sums).Error; err != nil {
+		return nil, err
+	}
+	return sums, nil
+}
+
+// ListCollectDefects implements DefectStore interface.
+func (s defectStore) ListCollectDefects(ctx context.Context, filter RecordFilter) ([]CollectDefect, error) {
+	const table = "mui_collect_defects"
+	filter.ProductID, filter.ResourceID, filter.LotNumber = "", "", ""
+	var defects []CollectDefect
+	if err := filter.apply(s.db.WithContext(ctx).Table(table), table).
+		Order("created_at, id").
+		Find(&defects).Error; err != nil {
+		return nil, err
+	}
+	return defects, nil
+}
@@ -0,0 +1,146 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+
+	"gitlab.kenda.com.tw/kenda/mui/server/database/dbtest"
+)
+
+func TestDefectStore_SumCollectDefects(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	db := dbtest.Open(t)
+	store, err := NewDefectStore(db)
+	assert.NoError(err)
+	collects, err := NewCollectStore(db)
+	assert.NoError(err)
+
+	for sequence := int16(1); sequence <= 3; sequence++ {
+		assert.NoError(store.CreateCollectDefects(ctx, []CollectDefect{
+			{
+				WorkOrder:  "WO1",
+				Sequence:   sequence,
+				Station:    "S1",
+				ReasonCode: "R01",
+				Kind:       DefectKindScrap,
+				Quantity:   decimal.NewFromInt(2),
+				CreatedBy:  "tester",
+			},
+		}))
+	}
+	// the second collect is voided and the third is corrected.
+	assert.NoError(collects.CreateCollectReversal(ctx, CollectReversal{
+		WorkOrder: "WO1",
+		Sequence:  2,
+		Quantity:  decimal.NewFromInt(10),
+		Reason:    "wrong output",
+		CreatedBy: "tester",
+	}))
+	assert.NoError(collects.CreateCollectReversal(ctx, CollectReversal{
+		WorkOrder:        "WO1",
+		Sequence:         3,
+		Quantity:         decimal.NewFromInt(10),
+		AdjustedQuantity: decimal.NewNullDecimal(decimal.NewFromInt(8)),
+		Reason:           "wrong quantity",
+		CreatedBy:        "tester",
+	}))
+
+	sums, err := store.SumCollectDefects(ctx, []string{"WO1"})
+	assert.NoError(err)
+	if assert.Len(sums, 1) {
+		assert.Equal("R01", sums[0].ReasonCode)
+		assert.True(decimal.NewFromInt(4).Equal(sums[0].Quantity), sums[0].Quantity.String())
+	}
+}
+
+func TestDefectStore_CreateDefectReason(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	store, err := NewDefectStore(dbtest.Open(t))
+	assert.NoError(err)
+
+	reason := DefectReason{Code: "R01", Kind: DefectKindScrap, UpdatedBy: "tester"}
+	assert.NoError(store.CreateDefectReason(ctx, reason))
+	assert.ErrorIs(store.CreateDefectReason(ctx, reason), ErrRecordExisted)
+}
+
+func TestDefectStore_CreateCollectDefects(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	store, err := NewDefectStore(dbtest.Open(t))
+	assert.NoError(err)
+
+	newDefect := func(reasonCode string, quantity int64) CollectDefect {
+		return CollectDefect{
+			WorkOrder:  "WO1",
+			Sequence:   1,
+			Station:    "S1",
+			ReasonCode: reasonCode,
+			Kind:       DefectKindScrap,
+			Quantity:   decimal.NewFromInt(quantity),
+			CreatedBy:  "tester",
+		}
+	}
+	// the defects of the same reason are summed.
+	assert.NoError(store.CreateCollectDefects(ctx, []CollectDefect{newDefect("R01", 2), newDefect("R02", 1), newDefect("R01", 3)}))
+	assert.ErrorIs(store.CreateCollectDefects(ctx, []CollectDefect{newDefect("R01", 2)}), ErrRecordExisted)
+
+	defects, err := store.ListCollectDefects(ctx, RecordFilter{})
+	assert.NoError(err)
+	quantities := make(map[string]string, len(defects))
+	for _, defect := range defects {
+		quantities[defect.ReasonCode] = defect.Quantity.String()
+	}
+	assert.Equal(map[string]string{"R01": "5", "R02": "1"}, quantities)
+}
+
+// legacyCollectDefect is CollectDefect before its reasons were unique.
+type legacyCollectDefect struct {
+	ID         int64 `gorm:"primaryKey"`
+	WorkOrder  string
+	Sequence   int16
+	Batch      int16
+	Station    string
+	ReasonCode string
+	Kind       DefectKind
+	Quantity   decimal.Decimal `gorm:"type:numeric"`
+	CreatedBy  string
+	CreatedAt  time.Time
+}
+
+func (legacyCollectDefect) TableName() string {
+	return "mui_collect_defects"
+}
+
+func TestNewDefectStore_mergeCollectDefects(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	db := dbtest.Open(t)
+	assert.NoError(db.AutoMigrate(&legacyCollectDefect{}))
+	for _, defect := range []legacyCollectDefect{
+		{WorkOrder: "WO1", Sequence: 1, ReasonCode: "R01", Kind: DefectKindScrap, Quantity: decimal.NewFromInt(2)},
+		{WorkOrder: "WO1", Sequence: 1, ReasonCode: "R01", Kind: DefectKindScrap, Quantity: decimal.NewFromInt(3)},
+		{WorkOrder: "WO1", Sequence: 2, ReasonCode: "R01", Kind: DefectKindScrap, Quantity: decimal.NewFromInt(4)},
+	} {
+		assert.NoError(db.Create(&defect).Error)
+	}
+
+	store, err := NewDefectStore(db)
+	assert.NoError(err)
+	defects, err := store.ListCollectDefects(ctx, RecordFilter{})
+	assert.NoError(err)
+	quantities := make(map[int16]string, len(defects))
+	for _, defect := range defects {
+		quantities[defect.Sequence] = defect.Quantity.String()
+	}
+	assert.Equal(map[int16]string{1: "5", 2: "4"}, quantities)
+}
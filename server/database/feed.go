@@ -0,0 +1,146 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+// UnfeedRecord is the return of a fed quantity. The feed records of the data
+// manager are kept as they are, so the feed history is traced by both.
+type UnfeedRecord struct {
+	ID        int64  `gorm:"primaryKey"`
+	WorkOrder string `gorm:"index:idx_mui_unfeed_records_batch;not null"`
+	Batch     int16  `gorm:"index:idx_mui_unfeed_records_batch;not null"`
+	// FeedRecordID is the feed record which the quantity was returned from,
+	// empty if not specified.
+	FeedRecordID string `gorm:"index"`
+	// ResourceID is the fed resource.
+	ResourceID  string          `gorm:"index;not null"`
+	ProductType string          `gorm:"not null"`
+	Quantity    decimal.Decimal `gorm:"type:numeric;not null"`
+	// NewResourceID is the remainder resource with a new label, empty if the
+	// quantity was restored to the fed resource.
+	NewResourceID string `gorm:"index"`
+	// Station, SiteName and SiteIndex are the site which the resource was
+	// bound to, empty if not bound.
+	Station   string
+	SiteName  string
+	SiteIndex int16
+	// Warehouse and Location are where the resource was moved to, empty if
+	// not moved.
+	Warehouse string
+	Location  string
+	Reason    string
+	CreatedBy string `gorm:"not null"`
+	CreatedAt time.Time
+}
+
+// TableName implements gorm.Tabler interface.
+func (UnfeedRecord) TableName() string {
+	return "mui_unfeed_records"
+}
+
+// UnfeedLimit limits the returns of a resource to a batch.
+type UnfeedLimit struct {
+	// Fed is the quantity of the resource fed to the batch.
+	Fed decimal.Decimal
+	// FeedRecordIDs are the feed records of the batch, including the empty
+	// one, whose returns are counted. The returns of the failed feeds are not.
+	FeedRecordIDs []string
+}
+
+// UnfeedExceededError is returned if a return together with the earlier
+// returns exceeds the fed quantity.
+type UnfeedExceededError struct {
+	Fed      decimal.Decimal
+	Returned decimal.Decimal
+}
+
+// Error implements error interface.
+func (e *UnfeedExceededError) Error() string {
+	return fmt.Sprintf("%s fed and %s returned", e.Fed, e.Returned)
+}
+
+// FeedStore stores the returns of the fed quantities.
+type FeedStore interface {
+	// CreateUnfeedRecord creates an unfeed record.
+	CreateUnfeedRecord(ctx context.Context, record UnfeedRecord) error
+	// ReserveUnfeed creates the unfeed record of a return before the return
+	// is done, and returns its ID. If limit is not nil, the earlier returns
+	// are checked in the same transaction, and an *UnfeedExceededError is
+	// returned if the return exceeds the fed quantity.
+	ReserveUnfeed(ctx context.Context, record UnfeedRecord, limit *UnfeedLimit) (int64, error)
+	// SetUnfeedNewResource sets the remainder resource of an unfeed record.
+	SetUnfeedNewResource(ctx context.Context, id int64, newResourceID string) error
+	// DeleteUnfeedRecord deletes the unfeed record of a failed return.
+	DeleteUnfeedRecord(ctx context.Context, id int64) error
+}
+
+type feedStore struct {
+	db *gorm.DB
+}
+
+// NewFeedStore returns a FeedStore and migrates its tables.
+func NewFeedStore(db *gorm.DB) (FeedStore, error) {
+	if err := db.AutoMigrate(&UnfeedRecord{}); err != nil {
+		return nil, err
+	}
+	return feedStore{db: db}, nil
+}
+
+// CreateUnfeedRecord implements FeedStore interface.
+func (s feedStore) CreateUnfeedRecord(ctx context.Context, record UnfeedRecord) error {
+	return s.db.WithContext(ctx).Create(&record).Error
+}
+
+// ReserveUnfeed implements FeedStore interface.
+func (s feedStore) ReserveUnfeed(ctx context.Context, record UnfeedRecord, limit *UnfeedLimit) (int64, error) {
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if limit != nil {
+			// the concurrent returns are checked one after another.
+			if err := lockUnfeeds(tx); err != nil {
+				return err
+			}
+			var returned struct {
+				Quantity decimal.NullDecimal
+			}
+			if err := tx.Model(&UnfeedRecord{}).
+				Select("SUM(quantity) AS quantity").
+				Where("work_order = ? AND batch = ? AND resource_id = ? AND feed_record_id IN ?",
+					record.WorkOrder, record.Batch, record.ResourceID, limit.FeedRecordIDs).
+				Scan(&returned).Error; err != nil {
+				return err
+			}
+			if returned.Quantity.Decimal.Add(record.Quantity).GreaterThan(limit.Fed) {
+				return &UnfeedExceededError{Fed: limit.Fed, Returned: returned.Quantity.Decimal}
+			}
+		}
+		return tx.Create(&record).Error
+	})
+	return record.ID, err
+}
+
+// SetUnfeedNewResource implements FeedStore interface.
+func (s feedStore) SetUnfeedNewResource(ctx context.Context, id int64, newResourceID string) error {
+	return s.db.WithContext(ctx).Model(&UnfeedRecord{}).
+		Where("id = ?", id).
+		Update("new_resource_id", newResourceID).Error
+}
+
+// DeleteUnfeedRecord implements FeedStore interface.
+func (s feedStore) DeleteUnfeedRecord(ctx context.Context, id int64) error {
+	return s.db.WithContext(ctx).Delete(&UnfeedRecord{}, id).Error
+}
+
+// lockUnfeeds locks the unfeed records until the end of the transaction.
+func lockUnfeeds(tx *gorm.DB) error {
+	if tx.Dialector.Name() != "postgres" {
+		// SQLite used by the tests serializes the writes by itself.
+		return nil
+	}
+	return tx.Exec("LOCK TABLE " + UnfeedRecord{}.TableName() + " IN EXCLUSIVE MODE").Error
+}
@@ -0,0 +1,53 @@
+package database
+
+import (
+	"context"
+	"testing"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+
+	"gitlab.kenda.com.tw/kenda/mui/server/database/dbtest"
+)
+
+func TestFeedStore_ReserveUnfeed(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	db := dbtest.Open(t)
+	store, err := NewFeedStore(db)
+	assert.NoError(err)
+
+	newRecord := func(feedRecordID string, quantity int64) UnfeedRecord {
+		return UnfeedRecord{
+			WorkOrder:    "WO1",
+			Batch:        1,
+			FeedRecordID: feedRecordID,
+			ResourceID:   "R1",
+			ProductType:  "TYPE",
+			Quantity:     decimal.NewFromInt(quantity),
+			CreatedBy:    "tester",
+		}
+	}
+	limit := &UnfeedLimit{Fed: decimal.NewFromInt(10), FeedRecordIDs: []string{"", "F1"}}
+
+	// the returns of a failed feed are not counted.
+	assert.NoError(store.CreateUnfeedRecord(ctx, newRecord("FAILED", 7)))
+	first, err := store.ReserveUnfeed(ctx, newRecord("F1", 6), limit)
+	assert.NoError(err)
+	_, err = store.ReserveUnfeed(ctx, newRecord("", 5), limit)
+	assert.Equal(&UnfeedExceededError{Fed: decimal.NewFromInt(10), Returned: decimal.NewFromInt(6)}, err)
+	// not limited.
+	_, err = store.ReserveUnfeed(ctx, newRecord("", 5), nil)
+	assert.NoError(err)
+
+	assert.NoError(store.SetUnfeedNewResource(ctx, first, "NEW"))
+	var record UnfeedRecord
+	assert.NoError(db.First(&record, first).Error)
+	assert.Equal("NEW", record.NewResourceID)
+
+	// the deleted returns are not counted.
+	assert.NoError(store.DeleteUnfeedRecord(ctx, first))
+	_, err = store.ReserveUnfeed(ctx, newRecord("F1", 4), &UnfeedLimit{Fed: decimal.NewFromInt(10), FeedRecordIDs: []string{"F1"}})
+	assert.NoError(err)
+}
@@ -0,0 +1,133 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// AgingHold holds a produced resource until its minimum aging time elapses.
+type AgingHold struct {
+	ResourceID  string    `gorm:"primaryKey"`
+	ProductType string    `gorm:"primaryKey"`
+	Until       time.Time `gorm:"index;not null"`
+	// ReleasedBy, ReleaseReason and ReleasedAt are set if the resource was
+	// bound in force before Until.
+	ReleasedBy    string
+	ReleaseReason string
+	ReleasedAt    *time.Time
+	CreatedAt     time.Time
+}
+
+// TableName implements gorm.Tabler interface.
+func (AgingHold) TableName() string {
+	return "mui_aging_holds"
+}
+
+// Active reports whether the resource is still held at the time.
+func (h AgingHold) Active(t time.Time) bool {
+	return h.ReleasedAt == nil && t.Before(h.Until)
+}
+
+// HoldStore stores the aging holds of the produced resources.
+type HoldStore interface {
+	// CreateAgingHolds holds the resources.
+	CreateAgingHolds(ctx context.Context, holds []AgingHold) error
+	// ListActiveAgingHolds returns the holds of the resources which are still
+	// active at the time. The holds of all the product types are returned,
+	// since the resources to bind or to feed may come without the product
+	// type, which match the holds of any product type.
+	ListActiveAgingHolds(ctx context.Context, t time.Time, resourceIDs []string) ([]AgingHold, error)
+	// ReleaseAgingHolds releases the holds of the resources before their
+	// aging times elapse.
+	ReleaseAgingHolds(ctx context.Context, holds []AgingHold, releasedBy, reason string) error
+	// RestoreAgingHolds restores the holds released by an operation failed
+	// afterwards.
+	RestoreAgingHolds(ctx context.Context, holds []AgingHold) error
+	// DeleteAgingHolds deletes the holds of the resources, which are created
+	// by an operation failed afterwards.
+	DeleteAgingHolds(ctx context.Context, productType string, resourceIDs []string) error
+}
+
+type holdStore struct {
+	db *gorm.DB
+}
+
+// NewHoldStore returns a HoldStore and migrates its tables.
+func NewHoldStore(db *gorm.DB) (HoldStore, error) {
+	if err := db.AutoMigrate(&AgingHold{}); err != nil {
+		return nil, err
+	}
+	return holdStore{db: db}, nil
+}
+
+// CreateAgingHolds implements HoldStore interface.
+func (s holdStore) CreateAgingHolds(ctx context.Context, holds []AgingHold) error {
+	if len(holds) == 0 {
+		return nil
+	}
+	return s.db.WithContext(ctx).Create(&holds).Error
+}
+
+// ListActiveAgingHolds implements HoldStore interface.
+func (s holdStore) ListActiveAgingHolds(ctx context.Context, t time.Time, resourceIDs []string) ([]AgingHold, error) {
+	if len(resourceIDs) == 0 {
+		return nil, nil
+	}
+	var holds []AgingHold
+	if err := s.db.WithContext(ctx).
+		Where("resource_id IN ? AND released_at IS NULL AND until > ?", resourceIDs, t).
+		Order("resource_id").
+		Find(&holds).Error; err != nil {
+		return nil, err
+	}
+	return holds, nil
+}
+
+// ReleaseAgingHolds implements HoldStore interface.
+func (s holdStore) ReleaseAgingHolds(ctx context.Context, holds []AgingHold, releasedBy, reason string) error {
+	now := time.Now()
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, hold := range holds {
+			if err := tx.Model(&AgingHold{}).
+				Where("resource_id = ? AND product_type = ? AND released_at IS NULL", hold.ResourceID, hold.ProductType).
+				Updates(map[string]interface{}{
+					"released_by":    releasedBy,
+					"release_reason": reason,
+					"released_at":    now,
+				}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// RestoreAgingHolds implements HoldStore interface.
+func (s holdStore) RestoreAgingHolds(ctx context.Context, holds []AgingHold) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, hold := range holds {
+			if err := tx.Model(&AgingHold{}).
+				Where("resource_id = ? AND product_type = ?", hold.ResourceID, hold.ProductType).
+				Updates(map[string]interface{}{
+					"released_by":    "",
+					"release_reason": "",
+					"released_at":    nil,
+				}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// DeleteAgingHolds implements HoldStore interface.
+func (s holdStore) DeleteAgingHolds(ctx context.Context, productType string, resourceIDs []string) error {
+	if len(resourceIDs) == 0 {
+		return nil
+	}
+	return s.db.WithContext(ctx).
+		Where("product_type = ? AND resource_id IN ?", productType, resourceIDs).
+		Delete(&AgingHold{}).Error
+}
@@ -0,0 +1,46 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"gitlab.kenda.com.tw/kenda/mui/server/database/dbtest"
+)
+
+func TestHoldStore_RestoreAgingHolds(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	store, err := NewHoldStore(dbtest.Open(t))
+	assert.NoError(err)
+
+	now := time.Now()
+	holds := []AgingHold{
+		{ResourceID: "R1", ProductType: "TYPE", Until: now.Add(time.Hour)},
+		{ResourceID: "R1", ProductType: "OTHER", Until: now.Add(time.Hour)},
+	}
+	assert.NoError(store.CreateAgingHolds(ctx, holds))
+
+	// the holds of all the product types are listed.
+	active, err := store.ListActiveAgingHolds(ctx, now, []string{"R1"})
+	assert.NoError(err)
+	assert.Len(active, 2)
+
+	assert.NoError(store.ReleaseAgingHolds(ctx, holds[:1], "tester", "urgent"))
+	active, err = store.ListActiveAgingHolds(ctx, now, []string{"R1"})
+	assert.NoError(err)
+	if assert.Len(active, 1) {
+		assert.Equal("OTHER", active[0].ProductType)
+	}
+
+	assert.NoError(store.RestoreAgingHolds(ctx, holds[:1]))
+	active, err = store.ListActiveAgingHolds(ctx, now, []string{"R1"})
+	assert.NoError(err)
+	if assert.Len(active, 2) {
+		assert.Equal("", active[0].ReleasedBy)
+		assert.Equal("", active[1].ReleaseReason)
+	}
+}
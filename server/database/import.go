@@ -0,0 +1,100 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// WorkOrderImport is a validated preview of an uploaded work order file,
+// which is committed by referencing its ID.
+type WorkOrderImport struct {
+	ID         string `gorm:"primaryKey"`
+	Department string `gorm:"not null"`
+	// Data is the JSON of the validated work orders.
+	Data        string    `gorm:"type:text;not null"`
+	CreatedBy   string    `gorm:"not null"`
+	CreatedAt   time.Time `gorm:"not null"`
+	ExpiresAt   time.Time `gorm:"index;not null"`
+	CommittedAt *time.Time
+}
+
+// TableName implements gorm.Tabler interface.
+func (WorkOrderImport) TableName() string {
+	return "mui_work_order_imports"
+}
+
+// WorkOrderImportStore keeps the previews of the work order imports.
+type WorkOrderImportStore interface {
+	// CreateWorkOrderImport keeps a preview. The expired previews are deleted
+	// at the same time.
+	CreateWorkOrderImport(ctx context.Context, imp WorkOrderImport) error
+	// ClaimWorkOrderImport marks a preview created by the user as committed
+	// at t and returns it. It returns ErrRecordNotFound if the preview does
+	// not exist, has expired or was created by another user, and
+	// ErrRecordExisted if the preview has been committed.
+	ClaimWorkOrderImport(ctx context.Context, id, user string, t time.Time) (WorkOrderImport, error)
+	// ReleaseWorkOrderImport reverts the claim of a preview whose commit
+	// failed, so it can be committed again.
+	ReleaseWorkOrderImport(ctx context.Context, id string) error
+}
+
+type workOrderImportStore struct {
+	db *gorm.DB
+}
+
+// NewWorkOrderImportStore returns a WorkOrderImportStore and migrates its
+// tables.
+func NewWorkOrderImportStore(db *gorm.DB) (WorkOrderImportStore, error) {
+	if err := db.AutoMigrate(&WorkOrderImport{}); err != nil {
+		return nil, err
+	}
+	return workOrderImportStore{db: db}, nil
+}
+
+// CreateWorkOrderImport implements WorkOrderImportStore interface.
+func (s workOrderImportStore) CreateWorkOrderImport(ctx context.Context, imp WorkOrderImport) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("expires_at < ?", imp.CreatedAt).Delete(&WorkOrderImport{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&imp).Error
+	})
+}
+
+// ClaimWorkOrderImport implements WorkOrderImportStore interface.
+func (s workOrderImportStore) ClaimWorkOrderImport(ctx context.Context, id, user string, t time.Time) (WorkOrderImport, error) {
+	var imp WorkOrderImport
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("id = ? AND created_by = ? AND expires_at >= ?", id, user, t).Take(&imp).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrRecordNotFound
+			}
+			return err
+		}
+		result := tx.Model(&WorkOrderImport{}).
+			Where("id = ? AND committed_at IS NULL", id).
+			Update("committed_at", t)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrRecordExisted
+		}
+		imp.CommittedAt = &t
+		return nil
+	})
+	if err != nil {
+		return WorkOrderImport{}, err
+	}
+	return imp, nil
+}
+
+// ReleaseWorkOrderImport implements WorkOrderImportStore interface.
+func (s workOrderImportStore) ReleaseWorkOrderImport(ctx context.Context, id string) error {
+	return s.db.WithContext(ctx).Model(&WorkOrderImport{}).
+		Where("id = ?", id).
+		Update("committed_at", nil).Error
+}
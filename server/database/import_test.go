@@ -0,0 +1,65 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"gitlab.kenda.com.tw/kenda/mui/server/database/dbtest"
+)
+
+func TestWorkOrderImportStore_ClaimWorkOrderImport(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	store, err := NewWorkOrderImportStore(dbtest.Open(t))
+	assert.NoError(err)
+
+	now := time.Now()
+	assert.NoError(store.CreateWorkOrderImport(ctx, WorkOrderImport{
+		ID:         "IMPORT-1",
+		Department: "D1",
+		Data:       "[]",
+		CreatedBy:  "tester",
+		CreatedAt:  now,
+		ExpiresAt:  now.Add(time.Hour),
+	}))
+
+	{ // another user.
+		_, err := store.ClaimWorkOrderImport(ctx, "IMPORT-1", "other", now)
+		assert.ErrorIs(err, ErrRecordNotFound)
+	}
+	{ // expired.
+		_, err := store.ClaimWorkOrderImport(ctx, "IMPORT-1", "tester", now.Add(2*time.Hour))
+		assert.ErrorIs(err, ErrRecordNotFound)
+	}
+	{ // claimed once.
+		imp, err := store.ClaimWorkOrderImport(ctx, "IMPORT-1", "tester", now)
+		assert.NoError(err)
+		assert.Equal("D1", imp.Department)
+		assert.NotNil(imp.CommittedAt)
+
+		_, err = store.ClaimWorkOrderImport(ctx, "IMPORT-1", "tester", now)
+		assert.ErrorIs(err, ErrRecordExisted)
+	}
+	{ // claimed again after released.
+		assert.NoError(store.ReleaseWorkOrderImport(ctx, "IMPORT-1"))
+		_, err := store.ClaimWorkOrderImport(ctx, "IMPORT-1", "tester", now)
+		assert.NoError(err)
+	}
+	{ // the expired previews are deleted by the next preview.
+		assert.NoError(store.CreateWorkOrderImport(ctx, WorkOrderImport{
+			ID:         "IMPORT-2",
+			Department: "D1",
+			Data:       "[]",
+			CreatedBy:  "tester",
+			CreatedAt:  now.Add(2 * time.Hour),
+			ExpiresAt:  now.Add(3 * time.Hour),
+		}))
+		assert.NoError(store.ReleaseWorkOrderImport(ctx, "IMPORT-1"))
+		_, err := store.ClaimWorkOrderImport(ctx, "IMPORT-1", "tester", now)
+		assert.ErrorIs(err, ErrRecordNotFound)
+	}
+}
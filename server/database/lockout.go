@@ -0,0 +1,243 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// LockoutAction is the action of a login lockout event.
+type LockoutAction string
+
+// LockoutAction definitions.
+const (
+	LockoutLocked   LockoutAction = "LOCKED"
+	LockoutUnlocked LockoutAction = "UNLOCKED"
+)
+
+// LockoutEvent is the audit entry of a login lockout.
+type LockoutEvent struct {
+	ID int64 `gorm:"primaryKey"`
+	// Kind is the kind of the locked target, ACCOUNT or IP.
+	Kind   string        `gorm:"not null"`
+	Target string        `gorm:"index;not null"`
+	Action LockoutAction `gorm:"not null"`
+	// Failures is the number of failed logins which caused the lockout.
+	Failures    int
+	LockedUntil *time.Time
+	// CreatedBy is the user who unlocked the target, empty if the event was
+	// caused by the failed logins.
+	CreatedBy string
+	CreatedAt time.Time `gorm:"index"`
+}
+
+// TableName implements gorm.Tabler interface.
+func (LockoutEvent) TableName() string {
+	return "mui_lockout_events"
+}
+
+// LockoutEventStore stores the audit entries of the login lockouts.
+type LockoutEventStore interface {
+	// CreateLockoutEvent creates a lockout event.
+	CreateLockoutEvent(ctx context.Context, event LockoutEvent) error
+	// ListLockoutEvents lists the lockout events created since the specified
+	// time, the latest first.
+	ListLockoutEvents(ctx context.Context, since time.Time) ([]LockoutEvent, error)
+}
+
+type lockoutEventStore struct {
+	db *gorm.DB
+}
+
+// NewLockoutEventStore returns a LockoutEventStore and migrates its tables.
+func NewLockoutEventStore(db *gorm.DB) (LockoutEventStore, error) {
+	if err := db.AutoMigrate(&LockoutEvent{}); err != nil {
+		return nil, err
+	}
+	return lockoutEventStore{db: db}, nil
+}
+
+// CreateLockoutEvent implements LockoutEventStore interface.
+func (s lockoutEventStore) CreateLockoutEvent(ctx context.Context, event LockoutEvent) error {
+	return s.db.WithContext(ctx).Create(&event).Error
+}
+
+// ListLockoutEvents implements LockoutEventStore interface.
+func (s lockoutEventStore) ListLockoutEvents(ctx context.Context, since time.Time) ([]LockoutEvent, error) {
+	var events []LockoutEvent
+	if err := s.db.WithContext(ctx).
+		Where("created_at >= ?", since).
+		Order("created_at DESC, id DESC").
+		Find(&events).Error; err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// LoginTarget identifies a target whose failed logins are tracked.
+type LoginTarget struct {
+	// Kind is ACCOUNT or IP.
+	Kind   string `gorm:"primaryKey"`
+	Target string `gorm:"primaryKey"`
+}
+
+// LoginFailure is the failed logins of a target.
+type LoginFailure struct {
+	LoginTarget
+	Failures    int `gorm:"not null"`
+	LastFailure time.Time
+	// LockedUntil is zero if the target has never been locked.
+	LockedUntil time.Time `gorm:"index"`
+}
+
+// TableName implements gorm.Tabler interface.
+func (LoginFailure) TableName() string {
+	return "mui_login_failures"
+}
+
+// LoginFailureStore stores the failed logins, which are shared by the servers
+// using the same database.
+type LoginFailureStore interface {
+	// ListLoginFailures lists the failed logins of the targets, the targets
+	// without any failure are omitted.
+	ListLoginFailures(ctx context.Context, targets []LoginTarget) ([]LoginFailure, error)
+	// UpdateLoginFailures calls update with the failed logins of the targets
+	// in order, zero failures for the ones without any failure, and saves the
+	// returned failed logins in one transaction. The targets are locked from
+	// the other updates until the end of the transaction, and the ones not
+	// returned or returned with no failure are deleted.
+	UpdateLoginFailures(ctx context.Context, targets []LoginTarget, update func([]LoginFailure) []LoginFailure) error
+	// DeleteLoginFailure deletes the failed logins of the target and returns
+	// them. It returns ErrRecordNotFound if the target has no failure.
+	DeleteLoginFailure(ctx context.Context, target LoginTarget) (LoginFailure, error)
+	// ListLockedLoginFailures lists the failed logins of the targets locked at
+	// the specified time.
+	ListLockedLoginFailures(ctx context.Context, at time.Time) ([]LoginFailure, error)
+	// DeleteStaleLoginFailures deletes the failed logins of the targets which
+	// are not locked at the specified time and have no failure since the
+	// specified time.
+	DeleteStaleLoginFailures(ctx context.Context, at, failedSince time.Time) error
+}
+
+type loginFailureStore struct {
+	db *gorm.DB
+}
+
+// NewLoginFailureStore returns a LoginFailureStore and migrates its tables.
+func NewLoginFailureStore(db *gorm.DB) (LoginFailureStore, error) {
+	if err := db.AutoMigrate(&LoginFailure{}); err != nil {
+		return nil, err
+	}
+	return loginFailureStore{db: db}, nil
+}
+
+func whereLoginTargets(tx *gorm.DB, targets []LoginTarget) *gorm.DB {
+	cond := tx.Where("1 = 0")
+	for _, target := range targets {
+		cond = cond.Or("kind = ? AND target = ?", target.Kind, target.Target)
+	}
+	return tx.Where(cond)
+}
+
+// ListLoginFailures implements LoginFailureStore interface.
+func (s loginFailureStore) ListLoginFailures(ctx context.Context, targets []LoginTarget) ([]LoginFailure, error) {
+	if len(targets) == 0 {
+		return nil, nil
+	}
+	var list []LoginFailure
+	if err := whereLoginTargets(s.db.WithContext(ctx), targets).Find(&list).Error; err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// UpdateLoginFailures implements LoginFailureStore interface.
+func (s loginFailureStore) UpdateLoginFailures(ctx context.Context, targets []LoginTarget, update func([]LoginFailure) []LoginFailure) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// the rows are created first to be locked by SELECT FOR UPDATE.
+		placeholders := make([]LoginFailure, len(targets))
+		for i, target := range targets {
+			placeholders[i] = LoginFailure{LoginTarget: target}
+		}
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&placeholders).Error; err != nil {
+			return err
+		}
+
+		query := whereLoginTargets(tx, targets)
+		if tx.Dialector.Name() == "postgres" {
+			// SQLite used by the tests serializes the writes by itself.
+			query = query.Clauses(clause.Locking{Strength: "UPDATE"})
+		}
+		var found []LoginFailure
+		if err := query.Find(&found).Error; err != nil {
+			return err
+		}
+
+		current := make([]LoginFailure, len(targets))
+		for i, target := range targets {
+			current[i] = LoginFailure{LoginTarget: target}
+			for _, f := range found {
+				if f.LoginTarget == target {
+					current[i] = f
+				}
+			}
+		}
+
+		saved := make(map[LoginTarget]bool, len(targets))
+		for _, f := range update(current) {
+			if f.Failures == 0 && f.LockedUntil.IsZero() {
+				continue
+			}
+			if err := tx.Save(&f).Error; err != nil {
+				return err
+			}
+			saved[f.LoginTarget] = true
+		}
+		for _, target := range targets {
+			if saved[target] {
+				continue
+			}
+			if err := tx.Delete(&LoginFailure{LoginTarget: target}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// DeleteLoginFailure implements LoginFailureStore interface.
+func (s loginFailureStore) DeleteLoginFailure(ctx context.Context, target LoginTarget) (LoginFailure, error) {
+	var f LoginFailure
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("kind = ? AND target = ?", target.Kind, target.Target).Take(&f).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrRecordNotFound
+			}
+			return err
+		}
+		return tx.Delete(&LoginFailure{LoginTarget: target}).Error
+	})
+	return f, err
+}
+
+// ListLockedLoginFailures implements LoginFailureStore interface.
+func (s loginFailureStore) ListLockedLoginFailures(ctx context.Context, at time.Time) ([]LoginFailure, error) {
+	var list []LoginFailure
+	if err := s.db.WithContext(ctx).
+		Where("locked_until > ?", at).
+		Order("locked_until, target").
+		Find(&list).Error; err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// DeleteStaleLoginFailures implements LoginFailureStore interface.
+func (s loginFailureStore) DeleteStaleLoginFailures(ctx context.Context, at, failedSince time.Time) error {
+	return s.db.WithContext(ctx).
+		Where("locked_until <= ? AND last_failure < ?", at, failedSince).
+		Delete(&LoginFailure{}).Error
+}
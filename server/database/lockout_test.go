@@ -0,0 +1,94 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"gitlab.kenda.com.tw/kenda/mui/server/database/dbtest"
+)
+
+func TestLoginFailureStore(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	store, err := NewLoginFailureStore(dbtest.Open(t))
+	assert.NoError(err)
+
+	now := time.Date(2022, 5, 1, 8, 0, 0, 0, time.UTC)
+	account := LoginTarget{Kind: "ACCOUNT", Target: "tester"}
+	ip := LoginTarget{Kind: "IP", Target: "10.1.1.1"}
+
+	{ // update the targets without failures.
+		assert.NoError(store.UpdateLoginFailures(ctx, []LoginTarget{account, ip}, func(failures []LoginFailure) []LoginFailure {
+			assert.Equal([]LoginFailure{{LoginTarget: account}, {LoginTarget: ip}}, failures)
+			failures[0].Failures = 1
+			failures[0].LastFailure = now
+			failures[0].LockedUntil = now.Add(time.Hour)
+			// the IP is not saved.
+			return failures[:1]
+		}))
+
+		failures, err := store.ListLoginFailures(ctx, []LoginTarget{account, ip})
+		assert.NoError(err)
+		assert.Equal([]LoginFailure{{
+			LoginTarget: account,
+			Failures:    1,
+			LastFailure: now,
+			LockedUntil: now.Add(time.Hour),
+		}}, failures)
+	}
+	{ // update the existing failures.
+		assert.NoError(store.UpdateLoginFailures(ctx, []LoginTarget{account}, func(failures []LoginFailure) []LoginFailure {
+			assert.Equal(1, failures[0].Failures)
+			failures[0].Failures++
+			return failures
+		}))
+
+		failures, err := store.ListLoginFailures(ctx, []LoginTarget{account})
+		assert.NoError(err)
+		if assert.Len(failures, 1) {
+			assert.Equal(2, failures[0].Failures)
+		}
+	}
+	{ // locked.
+		failures, err := store.ListLockedLoginFailures(ctx, now)
+		assert.NoError(err)
+		assert.Len(failures, 1)
+
+		failures, err = store.ListLockedLoginFailures(ctx, now.Add(time.Hour))
+		assert.NoError(err)
+		assert.Empty(failures)
+	}
+	{ // stale.
+		assert.NoError(store.DeleteStaleLoginFailures(ctx, now.Add(time.Minute), now.Add(time.Minute)))
+		failures, err := store.ListLoginFailures(ctx, []LoginTarget{account})
+		assert.NoError(err)
+		assert.Len(failures, 1, "locked")
+
+		assert.NoError(store.DeleteStaleLoginFailures(ctx, now.Add(time.Hour), now))
+		failures, err = store.ListLoginFailures(ctx, []LoginTarget{account})
+		assert.NoError(err)
+		assert.Len(failures, 1, "failed recently")
+
+		assert.NoError(store.DeleteStaleLoginFailures(ctx, now.Add(time.Hour), now.Add(time.Minute)))
+		failures, err = store.ListLoginFailures(ctx, []LoginTarget{account})
+		assert.NoError(err)
+		assert.Empty(failures)
+	}
+	{ // delete.
+		assert.NoError(store.UpdateLoginFailures(ctx, []LoginTarget{ip}, func(failures []LoginFailure) []LoginFailure {
+			failures[0].Failures = 1
+			failures[0].LastFailure = now
+			return failures
+		}))
+		f, err := store.DeleteLoginFailure(ctx, ip)
+		assert.NoError(err)
+		assert.Equal(1, f.Failures)
+
+		_, err = store.DeleteLoginFailure(ctx, ip)
+		assert.ErrorIs(err, ErrRecordNotFound)
+	}
+}
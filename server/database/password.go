@@ -0,0 +1,71 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// PasswordRecord is a password set to a MES account.
+type PasswordRecord struct {
+	ID     int64  `gorm:"primaryKey"`
+	UserID string `gorm:"index;not null"`
+	// Hash is the bcrypt hash of the password, empty if the password was set
+	// to the default password by the data manager.
+	Hash string
+	// MustChange is true if the password has to be changed at the next login.
+	MustChange bool
+	CreatedAt  time.Time
+}
+
+// TableName implements gorm.Tabler interface.
+func (PasswordRecord) TableName() string {
+	return "mui_password_history"
+}
+
+// PasswordStore stores the password history of the MES accounts.
+type PasswordStore interface {
+	// AddPassword adds a password record to the history.
+	AddPassword(ctx context.Context, record PasswordRecord) error
+	// ListPasswords lists at most limit password records of the user, the
+	// latest first.
+	ListPasswords(ctx context.Context, userID string, limit int) ([]PasswordRecord, error)
+	// DeletePasswords deletes the password history of the user.
+	DeletePasswords(ctx context.Context, userID string) error
+}
+
+type passwordStore struct {
+	db *gorm.DB
+}
+
+// NewPasswordStore returns a PasswordStore and migrates its tables.
+func NewPasswordStore(db *gorm.DB) (PasswordStore, error) {
+	if err := db.AutoMigrate(&PasswordRecord{}); err != nil {
+		return nil, err
+	}
+	return passwordStore{db: db}, nil
+}
+
+// AddPassword implements PasswordStore interface.
+func (s passwordStore) AddPassword(ctx context.Context, record PasswordRecord) error {
+	return s.db.WithContext(ctx).Create(&record).Error
+}
+
+// ListPasswords implements PasswordStore interface.
+func (s passwordStore) ListPasswords(ctx context.Context, userID string, limit int) ([]PasswordRecord, error) {
+	var records []PasswordRecord
+	if err := s.db.WithContext(ctx).
+		Where("user_id = ?", userID).
+		Order("created_at DESC, id DESC").
+		Limit(limit).
+		Find(&records).Error; err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// DeletePasswords implements PasswordStore interface.
+func (s passwordStore) DeletePasswords(ctx context.Context, userID string) error {
+	return s.db.WithContext(ctx).Where("user_id = ?", userID).Delete(&PasswordRecord{}).Error
+}
@@ -0,0 +1,306 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+
+	"gitlab.kenda.com.tw/kenda/mui/server/protobuf/kenda"
+)
+
+// PermissionAction is the action of a function permission change.
+type PermissionAction string
+
+// PermissionAction definitions.
+const (
+	PermissionCreated PermissionAction = "CREATED"
+	PermissionUpdated PermissionAction = "UPDATED"
+	PermissionDeleted PermissionAction = "DELETED"
+)
+
+// FunctionPermission is the list of roles allowed to use a function.
+type FunctionPermission struct {
+	FunctionID kenda.FunctionOperationID `gorm:"primaryKey;autoIncrement:false"`
+	// Roles are the role names defined in mcom roles library.
+	Roles     Strings `gorm:"type:jsonb;not null"`
+	Version   int     `gorm:"not null"`
+	UpdatedBy string  `gorm:"not null"`
+	UpdatedAt time.Time
+}
+
+// TableName implements gorm.Tabler interface.
+func (FunctionPermission) TableName() string {
+	return "mui_function_permissions"
+}
+
+// FunctionPermissionChange is the history of a function permission.
+type FunctionPermissionChange struct {
+	ID         int64                     `gorm:"primaryKey"`
+	FunctionID kenda.FunctionOperationID `gorm:"index;not null"`
+	Version    int                       `gorm:"not null"`
+	Action     PermissionAction          `gorm:"not null"`
+	// Roles are the roles after the change, empty if the permission was deleted.
+	Roles     Strings `gorm:"type:jsonb;not null"`
+	CreatedBy string  `gorm:"not null"`
+	CreatedAt time.Time
+}
+
+// TableName implements gorm.Tabler interface.
+func (FunctionPermissionChange) TableName() string {
+	return "mui_function_permission_changes"
+}
+
+// PermissionStore stores the function permissions and their change history.
+type PermissionStore interface {
+	// SeedPermissions creates the specified permissions in one transaction if
+	// no permission has ever been stored. It reports whether the permissions
+	// were created.
+	SeedPermissions(ctx context.Context, perms map[kenda.FunctionOperationID][]string, user string) (bool, error)
+	// Revision returns a number which changes whenever a permission is
+	// created, updated or deleted, 0 if no permission has ever been stored.
+	Revision(ctx context.Context) (int64, error)
+	// ListPermissions lists all the function permissions.
+	ListPermissions(ctx context.Context) ([]FunctionPermission, error)
+	// CreatePermission creates the permission of a function which has no permission yet.
+	// It returns ErrRecordExisted if the function permission has existed.
+	CreatePermission(ctx context.Context, id kenda.FunctionOperationID, roles []string, user string) (FunctionPermission, error)
+	// UpdatePermission replaces the roles of a function permission whose version
+	// is the specified version. It returns ErrRecordNotFound if the function
+	// permission does not exist and ErrVersionConflict if the version does not match.
+	UpdatePermission(ctx context.Context, id kenda.FunctionOperationID, roles []string, version int, user string) (FunctionPermission, error)
+	// DeletePermission deletes a function permission whose version is the
+	// specified version. The returned errors are the same as UpdatePermission.
+	DeletePermission(ctx context.Context, id kenda.FunctionOperationID, version int, user string) error
+	// ListPermissionChanges lists the change history of a function permission
+	// in version order.
+	ListPermissionChanges(ctx context.Context, id kenda.FunctionOperationID) ([]FunctionPermissionChange, error)
+}
+
+type permissionStore struct {
+	db *gorm.DB
+}
+
+// NewPermissionStore returns a PermissionStore and migrates its tables.
+func NewPermissionStore(db *gorm.DB) (PermissionStore, error) {
+	if err := db.AutoMigrate(&FunctionPermission{}, &FunctionPermissionChange{}); err != nil {
+		return nil, err
+	}
+	return permissionStore{db: db}, nil
+}
+
+// SeedPermissions implements PermissionStore interface.
+func (s permissionStore) SeedPermissions(ctx context.Context, perms map[kenda.FunctionOperationID][]string, user string) (bool, error) {
+	ids := make([]int, 0, len(perms))
+	for id := range perms {
+		ids = append(ids, int(id))
+	}
+	sort.Ints(ids)
+
+	seeded := false
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// the replicas starting at the same time seed one after another.
+		if err := lockPermissions(tx); err != nil {
+			return err
+		}
+
+		var count int64
+		if err := tx.Model(&FunctionPermissionChange{}).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return nil
+		}
+
+		now := time.Now()
+		for _, id := range ids {
+			perm := FunctionPermission{
+				FunctionID: kenda.FunctionOperationID(id),
+				Roles:      perms[kenda.FunctionOperationID(id)],
+				Version:    1,
+				UpdatedBy:  user,
+				UpdatedAt:  now,
+			}
+			if err := tx.Create(&perm).Error; err != nil {
+				return err
+			}
+			if err := createPermissionChange(tx, perm, PermissionCreated); err != nil {
+				return err
+			}
+		}
+		seeded = true
+		return nil
+	})
+	return seeded, err
+}
+
+// Revision implements PermissionStore interface. Every write takes
+// lockPermissions before its change is created, so the changes are committed
+// in the order of their IDs and the revision never skips a change.
+func (s permissionStore) Revision(ctx context.Context) (int64, error) {
+	var revision int64
+	err := s.db.WithContext(ctx).Model(&FunctionPermissionChange{}).
+		Select("COALESCE(MAX(id), 0)").
+		Scan(&revision).Error
+	return revision, err
+}
+
+// ListPermissions implements PermissionStore interface.
+func (s permissionStore) ListPermissions(ctx context.Context) ([]FunctionPermission, error) {
+	var list []FunctionPermission
+	if err := s.db.WithContext(ctx).Order("function_id").Find(&list).Error; err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// CreatePermission implements PermissionStore interface.
+func (s permissionStore) CreatePermission(ctx context.Context, id kenda.FunctionOperationID, roles []string, user string) (FunctionPermission, error) {
+	var perm FunctionPermission
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// the concurrent creations of a permission are done one after another.
+		if err := lockPermissions(tx); err != nil {
+			return err
+		}
+
+		var count int64
+		if err := tx.Model(&FunctionPermission{}).Where("function_id = ?", id).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrRecordExisted
+		}
+
+		// versions keep increasing even if the permission was deleted before.
+		version, err := lastPermissionVersion(tx, id)
+		if err != nil {
+			return err
+		}
+
+		perm = FunctionPermission{
+			FunctionID: id,
+			Roles:      roles,
+			Version:    version + 1,
+			UpdatedBy:  user,
+			UpdatedAt:  time.Now(),
+		}
+		if err := tx.Create(&perm).Error; err != nil {
+			return err
+		}
+		return createPermissionChange(tx, perm, PermissionCreated)
+	})
+	return perm, err
+}
+
+// UpdatePermission implements PermissionStore interface.
+func (s permissionStore) UpdatePermission(ctx context.Context, id kenda.FunctionOperationID, roles []string, version int, user string) (FunctionPermission, error) {
+	var perm FunctionPermission
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := lockPermissions(tx); err != nil {
+			return err
+		}
+
+		perm = FunctionPermission{
+			FunctionID: id,
+			Roles:      roles,
+			Version:    version + 1,
+			UpdatedBy:  user,
+			UpdatedAt:  time.Now(),
+		}
+		res := tx.Model(&FunctionPermission{}).
+			Where("function_id = ? AND version = ?", id, version).
+			Updates(map[string]interface{}{
+				"roles":      perm.Roles,
+				"version":    perm.Version,
+				"updated_by": perm.UpdatedBy,
+				"updated_at": perm.UpdatedAt,
+			})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return notAffectedError(tx, id)
+		}
+		return createPermissionChange(tx, perm, PermissionUpdated)
+	})
+	return perm, err
+}
+
+// DeletePermission implements PermissionStore interface.
+func (s permissionStore) DeletePermission(ctx context.Context, id kenda.FunctionOperationID, version int, user string) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := lockPermissions(tx); err != nil {
+			return err
+		}
+
+		res := tx.Where("function_id = ? AND version = ?", id, version).Delete(&FunctionPermission{})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return notAffectedError(tx, id)
+		}
+		return createPermissionChange(tx, FunctionPermission{
+			FunctionID: id,
+			Roles:      Strings{},
+			Version:    version + 1,
+			UpdatedBy:  user,
+			UpdatedAt:  time.Now(),
+		}, PermissionDeleted)
+	})
+}
+
+// ListPermissionChanges implements PermissionStore interface.
+func (s permissionStore) ListPermissionChanges(ctx context.Context, id kenda.FunctionOperationID) ([]FunctionPermissionChange, error) {
+	var list []FunctionPermissionChange
+	if err := s.db.WithContext(ctx).
+		Where("function_id = ?", id).
+		Order("version").
+		Find(&list).Error; err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// lockPermissions locks the permission tables until the end of the transaction.
+func lockPermissions(tx *gorm.DB) error {
+	if tx.Dialector.Name() != "postgres" {
+		// SQLite used by the tests serializes the writes by itself.
+		return nil
+	}
+	return tx.Exec("LOCK TABLE " + FunctionPermissionChange{}.TableName() + " IN EXCLUSIVE MODE").Error
+}
+
+func lastPermissionVersion(tx *gorm.DB, id kenda.FunctionOperationID) (int, error) {
+	var version int
+	err := tx.Model(&FunctionPermissionChange{}).
+		Where("function_id = ?", id).
+		Select("COALESCE(MAX(version), 0)").
+		Scan(&version).Error
+	return version, err
+}
+
+func createPermissionChange(tx *gorm.DB, perm FunctionPermission, action PermissionAction) error {
+	return tx.Create(&FunctionPermissionChange{
+		FunctionID: perm.FunctionID,
+		Version:    perm.Version,
+		Action:     action,
+		Roles:      perm.Roles,
+		CreatedBy:  perm.UpdatedBy,
+		CreatedAt:  perm.UpdatedAt,
+	}).Error
+}
+
+// notAffectedError returns the reason why no function permission was affected.
+func notAffectedError(tx *gorm.DB, id kenda.FunctionOperationID) error {
+	var perm FunctionPermission
+	if err := tx.Where("function_id = ?", id).Take(&perm).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrRecordNotFound
+		}
+		return err
+	}
+	return ErrVersionConflict
+}
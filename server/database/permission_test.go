@@ -0,0 +1,88 @@
+package database
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"gitlab.kenda.com.tw/kenda/mui/server/database/dbtest"
+	"gitlab.kenda.com.tw/kenda/mui/server/protobuf/kenda"
+)
+
+func TestPermissionStore(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	store, err := NewPermissionStore(dbtest.Open(t))
+	assert.NoError(err)
+
+	revision, err := store.Revision(ctx)
+	assert.NoError(err)
+	assert.Equal(int64(0), revision)
+
+	{ // seed an empty store.
+		seeded, err := store.SeedPermissions(ctx, map[kenda.FunctionOperationID][]string{
+			kenda.FunctionOperationID_STATION_FORCE_SIGN_IN: {"LEADER"},
+			kenda.FunctionOperationID_GET_ROLE_LIST:         {"OPERATOR"},
+		}, "SYSTEM")
+		assert.NoError(err)
+		assert.True(seeded)
+
+		perms, err := store.ListPermissions(ctx)
+		assert.NoError(err)
+		if assert.Len(perms, 2) {
+			assert.Equal(1, perms[0].Version)
+			assert.Equal("SYSTEM", perms[0].UpdatedBy)
+		}
+	}
+	{ // seed a used store.
+		seeded, err := store.SeedPermissions(ctx, map[kenda.FunctionOperationID][]string{
+			kenda.FunctionOperationID_GET_PLAN_LIST: {"LEADER"},
+		}, "SYSTEM")
+		assert.NoError(err)
+		assert.False(seeded)
+
+		perms, err := store.ListPermissions(ctx)
+		assert.NoError(err)
+		assert.Len(perms, 2)
+	}
+
+	seedRevision, err := store.Revision(ctx)
+	assert.NoError(err)
+	assert.NotZero(seedRevision)
+
+	{ // update.
+		perm, err := store.UpdatePermission(ctx, kenda.FunctionOperationID_STATION_FORCE_SIGN_IN, []string{"OPERATOR"}, 1, "tester")
+		assert.NoError(err)
+		assert.Equal(2, perm.Version)
+
+		_, err = store.UpdatePermission(ctx, kenda.FunctionOperationID_STATION_FORCE_SIGN_IN, []string{"LEADER"}, 1, "tester")
+		assert.ErrorIs(err, ErrVersionConflict)
+		_, err = store.UpdatePermission(ctx, kenda.FunctionOperationID_GET_PLAN_LIST, []string{"LEADER"}, 1, "tester")
+		assert.ErrorIs(err, ErrRecordNotFound)
+
+		revision, err := store.Revision(ctx)
+		assert.NoError(err)
+		assert.Greater(revision, seedRevision)
+	}
+	{ // delete and create again.
+		assert.NoError(store.DeletePermission(ctx, kenda.FunctionOperationID_STATION_FORCE_SIGN_IN, 2, "tester"))
+		assert.ErrorIs(store.DeletePermission(ctx, kenda.FunctionOperationID_STATION_FORCE_SIGN_IN, 3, "tester"), ErrRecordNotFound)
+
+		perm, err := store.CreatePermission(ctx, kenda.FunctionOperationID_STATION_FORCE_SIGN_IN, []string{"LEADER"}, "tester")
+		assert.NoError(err)
+		assert.Equal(4, perm.Version)
+		_, err = store.CreatePermission(ctx, kenda.FunctionOperationID_STATION_FORCE_SIGN_IN, []string{"LEADER"}, "tester")
+		assert.ErrorIs(err, ErrRecordExisted)
+	}
+	{ // history.
+		changes, err := store.ListPermissionChanges(ctx, kenda.FunctionOperationID_STATION_FORCE_SIGN_IN)
+		assert.NoError(err)
+		actions := make([]PermissionAction, len(changes))
+		for i, change := range changes {
+			actions[i] = change.Action
+		}
+		assert.Equal([]PermissionAction{PermissionCreated, PermissionUpdated, PermissionDeleted, PermissionCreated}, actions)
+	}
+}
@@ -0,0 +1,361 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+// FeedRecord is a fed quantity, by the site or by the resource, recorded by
+// MUI for the queries of the production records.
+type FeedRecord struct {
+	ID        int64  `gorm:"primaryKey"`
+	WorkOrder string `gorm:"index:idx_mui_feed_records_batch;not null"`
+	Batch     int16  `gorm:"index:idx_mui_feed_records_batch;not null"`
+	Station   string `gorm:"index;not null"`
+	// FeedRecordID is the feed record of the data manager, empty if fed
+	// through MES.
+	FeedRecordID string `gorm:"index"`
+	// ProductID is the product of the work order.
+	ProductID string `gorm:"index"`
+	// SiteName and SiteIndex are the site fed from, empty if fed by the
+	// resource.
+	SiteName  string
+	SiteIndex int16
+	// ResourceID is the fed resource, empty if fed by the site.
+	ResourceID string `gorm:"index"`
+	// Quantity is null if the quantity is according to the recipe.
+	Quantity  decimal.NullDecimal `gorm:"type:numeric"`
+	CreatedBy string              `gorm:"index;not null"`
+	CreatedAt time.Time           `gorm:"index"`
+	// SiteResources are the resources bound to the site when fed, which are
+	// stored with ResourceID as the consumed resources of the feed.
+	SiteResources []string `gorm:"-"`
+	// Returned is the quantity returned by the unfeed records of the same
+	// feed record and of the resources consumed by the feed, it is not
+	// stored. The unfeeds without the feed record are of the feeds through
+	// MES, which have none.
+	Returned decimal.Decimal `gorm:"->;-:migration"`
+}
+
+// TableName implements gorm.Tabler interface.
+func (FeedRecord) TableName() string {
+	return "mui_feed_records"
+}
+
+// consumedResources returns the resources consumed by the feed.
+func (r FeedRecord) consumedResources() []string {
+	ids := make([]string, 0, len(r.SiteResources)+1)
+	if r.ResourceID != "" {
+		ids = append(ids, r.ResourceID)
+	}
+	for _, id := range r.SiteResources {
+		if id != "" && id != r.ResourceID {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// FeedRecordResource is a resource consumed by a feed, by which the
+// genealogy of the resources is traced.
+type FeedRecordResource struct {
+	FeedRecordID int64  `gorm:"primaryKey;autoIncrement:false"`
+	ResourceID   string `gorm:"primaryKey;index"`
+}
+
+// TableName implements gorm.Tabler interface.
+func (FeedRecordResource) TableName() string {
+	return "mui_feed_record_resources"
+}
+
+// BatchKey identifies a batch of a work order.
+type BatchKey struct {
+	WorkOrder string
+	Batch     int16
+}
+
+// CollectRecord is a collected output recorded by MUI for the queries of the
+// production records.
+type CollectRecord struct {
+	ID        int64  `gorm:"primaryKey"`
+	WorkOrder string `gorm:"uniqueIndex:idx_mui_collect_records_sequence;not null"`
+	Sequence  int16  `gorm:"uniqueIndex:idx_mui_collect_records_sequence;not null"`
+	// Batch is null if the collect is not bound to a batch, e.g. collected
+	// through MES.
+	Batch      *int16
+	Station    string `gorm:"index;not null"`
+	ProductID  string `gorm:"index"`
+	LotNumber  string
+	ResourceID string          `gorm:"index"`
+	Quantity   decimal.Decimal `gorm:"type:numeric;not null"`
+	CreatedBy  string          `gorm:"index;not null"`
+	CreatedAt  time.Time       `gorm:"index"`
+	// FirstSequence is the sequence of the first output collected by the
+	// same request, by which the outputs of a cycle without the batch are
+	// grouped. It is 0 for the records kept before it was recorded.
+	FirstSequence int16 `gorm:"not null;default:0"`
+	// Reversed is true if the collect has a reversal, it is not stored.
+	Reversed bool `gorm:"->;-:migration"`
+	// AdjustedQuantity is the quantity corrected by the reversal, null if the
+	// collect is not reversed or is voided, it is not stored.
+	AdjustedQuantity decimal.NullDecimal `gorm:"->;-:migration"`
+}
+
+// TableName implements gorm.Tabler interface.
+func (CollectRecord) TableName() string {
+	return "mui_collect_records"
+}
+
+// RecordFilter filters the production records, the zero fields are not
+// applied.
+type RecordFilter struct {
+	WorkOrder string
+	Batch     *int16
+	Station   string
+	// Operator is the user who created the records.
+	Operator  string
+	ProductID string
+	// ResourceID and LotNumber are the produced resource and lot, which are
+	// applied to the collect records only.
+	ResourceID string
+	LotNumber  string
+	// Since and Until are the range of the created time, Until is exclusive.
+	Since time.Time
+	Until time.Time
+}
+
+func (f RecordFilter) apply(db *gorm.DB, table string) *gorm.DB {
+	if f.WorkOrder != "" {
+		db = db.Where(table+".work_order = ?", f.WorkOrder)
+	}
+	if f.Batch != nil {
+		db = db.Where(table+".batch = ?", *f.Batch)
+	}
+	if f.Station != "" {
+		db = db.Where(table+".station = ?", f.Station)
+	}
+	if f.Operator != "" {
+		db = db.Where(table+".created_by = ?", f.Operator)
+	}
+	if f.ProductID != "" {
+		db = db.Where(table+".product_id = ?", f.ProductID)
+	}
+	if f.ResourceID != "" {
+		db = db.Where(table+".resource_id = ?", f.ResourceID)
+	}
+	if f.LotNumber != "" {
+		db = db.Where(table+".lot_number = ?", f.LotNumber)
+	}
+	if !f.Since.IsZero() {
+		db = db.Where(table+".created_at >= ?", f.Since)
+	}
+	if !f.Until.IsZero() {
+		db = db.Where(table+".created_at < ?", f.Until)
+	}
+	return db
+}
+
+// Pagination of the listed records. Page starts from 1, and all the records
+// are listed if Limit is not positive.
+type Pagination struct {
+	Page  int
+	Limit int
+}
+
+func (p Pagination) apply(db *gorm.DB) *gorm.DB {
+	if p.Limit <= 0 {
+		return db
+	}
+	page := p.Page
+	if page < 1 {
+		page = 1
+	}
+	return db.Offset((page - 1) * p.Limit).Limit(p.Limit)
+}
+
+// RecordTotals are the totals of all the filtered records regardless of the
+// pagination.
+type RecordTotals struct {
+	Count int64
+	// Quantity is the sum of the quantities, counting the reversed collects
+	// by their adjusted quantities and excluding the returned quantities and
+	// the feeds according to the recipe.
+	Quantity decimal.Decimal
+}
+
+// RecordStore stores the feed and the collect records.
+type RecordStore interface {
+	// CreateRecords records the fed quantities and the collected outputs of
+	// an operation, all or none of them.
+	CreateRecords(ctx context.Context, feeds []FeedRecord, collects []CollectRecord) error
+	// ListFeedRecords lists the filtered feed records, the latest first.
+	ListFeedRecords(ctx context.Context, filter RecordFilter, page Pagination) ([]FeedRecord, RecordTotals, error)
+	// ListCollectRecords lists the filtered collect records, the latest first.
+	ListCollectRecords(ctx context.Context, filter RecordFilter, page Pagination) ([]CollectRecord, RecordTotals, error)
+	// ListConsumedResources lists the resources consumed by the feeds of the
+	// batch, or of all the batches of the work order if batch is nil.
+	ListConsumedResources(ctx context.Context, workOrder string, batch *int16) ([]string, error)
+	// ListConsumingBatches lists the batches which consumed the resource.
+	ListConsumingBatches(ctx context.Context, resourceID string) ([]BatchKey, error)
+	// ListResourceFeeds lists the feed records of the batch which consumed
+	// the resource, the earliest first.
+	ListResourceFeeds(ctx context.Context, workOrder string, batch int16, resourceID string) ([]FeedRecord, error)
+}
+
+type recordStore struct {
+	db *gorm.DB
+}
+
+// NewRecordStore returns a RecordStore and migrates its tables.
+func NewRecordStore(db *gorm.DB) (RecordStore, error) {
+	if err := db.AutoMigrate(&FeedRecord{}, &FeedRecordResource{}, &CollectRecord{}); err != nil {
+		return nil, err
+	}
+	return recordStore{db: db}, nil
+}
+
+// CreateRecords implements RecordStore interface.
+func (s recordStore) CreateRecords(ctx context.Context, feeds []FeedRecord, collects []CollectRecord) error {
+	if len(feeds) == 0 && len(collects) == 0 {
+		return nil
+	}
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if len(feeds) != 0 {
+			if err := tx.Create(&feeds).Error; err != nil {
+				return err
+			}
+		}
+		var resources []FeedRecordResource
+		for _, record := range feeds {
+			for _, id := range record.consumedResources() {
+				resources = append(resources, FeedRecordResource{
+					FeedRecordID: record.ID,
+					ResourceID:   id,
+				})
+			}
+		}
+		if len(resources) != 0 {
+			if err := tx.Create(&resources).Error; err != nil {
+				return err
+			}
+		}
+		if len(collects) == 0 {
+			return nil
+		}
+		return tx.Create(&collects).Error
+	})
+}
+
+// ListFeedRecords implements RecordStore interface.
+func (s recordStore) ListFeedRecords(ctx context.Context, filter RecordFilter, page Pagination) ([]FeedRecord, RecordTotals, error) {
+	const table = "mui_feed_records"
+	db := s.db.WithContext(ctx)
+	returned := "(SELECT COALESCE(SUM(u.quantity), 0) FROM mui_unfeed_records u WHERE u.work_order = " + table + ".work_order" +
+		" AND u.batch = " + table + ".batch AND u.feed_record_id = " + table + ".feed_record_id" +
+		" AND u.resource_id IN (SELECT c.resource_id FROM mui_feed_record_resources c WHERE c.feed_record_id = " + table + ".id))"
+
+	var totals struct {
+		Count    int64
+		Quantity decimal.NullDecimal
+		Returned decimal.NullDecimal
+	}
+	if err := filter.apply(db.Table(table), table).
+		Select("COUNT(*) AS count, SUM(quantity) AS quantity, SUM(CASE WHEN quantity IS NULL THEN 0 ELSE " + returned + " END) AS returned").
+		Scan(&totals).Error; err != nil {
+		return nil, RecordTotals{}, err
+	}
+
+	var records []FeedRecord
+	if err := page.apply(filter.apply(db.Table(table), table)).
+		Select(table + ".*, " + returned + " AS returned").
+		Order("created_at DESC, id DESC").
+		Find(&records).Error; err != nil {
+		return nil, RecordTotals{}, err
+	}
+	return records, RecordTotals{
+		Count:    totals.Count,
+		Quantity: totals.Quantity.Decimal.Sub(totals.Returned.Decimal),
+	}, nil
+}
+
+// ListCollectRecords implements RecordStore interface.
+func (s recordStore) ListCollectRecords(ctx context.Context, filter RecordFilter, page Pagination) ([]CollectRecord, RecordTotals, error) {
+	const table = "mui_collect_records"
+	db := s.db.WithContext(ctx)
+	reversal := "FROM mui_collect_reversals r WHERE r.work_order = " + table + ".work_order AND r.sequence = " + table + ".sequence"
+	reversed := "EXISTS (SELECT 1 " + reversal + ")"
+	adjusted := "(SELECT r.adjusted_quantity " + reversal + ")"
+
+	var totals struct {
+		Count    int64
+		Quantity decimal.NullDecimal
+	}
+	// a collect has a reversal at most, which counts the adjusted quantity,
+	// or none if the collect is voided.
+	if err := filter.apply(db.Table(table), table).
+		Joins("LEFT JOIN mui_collect_reversals r ON r.work_order = " + table + ".work_order AND r.sequence = " + table + ".sequence").
+		Select("COUNT(*) AS count, SUM(CASE WHEN r.id IS NULL THEN " + table + ".quantity ELSE COALESCE(r.adjusted_quantity, 0) END) AS quantity").
+		Scan(&totals).Error; err != nil {
+		return nil, RecordTotals{}, err
+	}
+
+	var records []CollectRecord
+	if err := page.apply(filter.apply(db.Table(table), table)).
+		Select(table + ".*, " + reversed + " AS reversed, " + adjusted + " AS adjusted_quantity").
+		Order("created_at DESC, id DESC").
+		Find(&records).Error; err != nil {
+		return nil, RecordTotals{}, err
+	}
+	return records, RecordTotals{Count: totals.Count, Quantity: totals.Quantity.Decimal}, nil
+}
+
+// ListConsumedResources implements RecordStore interface.
+func (s recordStore) ListConsumedResources(ctx context.Context, workOrder string, batch *int16) ([]string, error) {
+	db := s.db.WithContext(ctx).
+		Table("mui_feed_record_resources r").
+		Joins("JOIN mui_feed_records f ON f.id = r.feed_record_id").
+		Where("f.work_order = ?", workOrder)
+	if batch != nil {
+		db = db.Where("f.batch = ?", *batch)
+	}
+	var ids []string
+	if err := db.Distinct("r.resource_id").
+		Order("r.resource_id").
+		Pluck("r.resource_id", &ids).Error; err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// ListConsumingBatches implements RecordStore interface.
+func (s recordStore) ListConsumingBatches(ctx context.Context, resourceID string) ([]BatchKey, error) {
+	var batches []BatchKey
+	if err := s.db.WithContext(ctx).
+		Table("mui_feed_record_resources r").
+		Joins("JOIN mui_feed_records f ON f.id = r.feed_record_id").
+		Where("r.resource_id = ?", resourceID).
+		Distinct("f.work_order", "f.batch").
+		Order("f.work_order, f.batch").
+		Scan(&batches).Error; err != nil {
+		return nil, err
+	}
+	return batches, nil
+}
+
+// ListResourceFeeds implements RecordStore interface.
+func (s recordStore) ListResourceFeeds(ctx context.Context, workOrder string, batch int16, resourceID string) ([]FeedRecord, error) {
+	var records []FeedRecord
+	if err := s.db.WithContext(ctx).
+		Where("work_order = ? AND batch = ?", workOrder, batch).
+		Where("id IN (?)", s.db.Table("mui_feed_record_resources").
+			Select("feed_record_id").
+			Where("resource_id = ?", resourceID)).
+		Order("created_at, id").
+		Find(&records).Error; err != nil {
+		return nil, err
+	}
+	return records, nil
+}
@@ -0,0 +1,187 @@
+package database
+
+import (
+	"context"
+	"testing"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+
+	"gitlab.kenda.com.tw/kenda/mui/server/database/dbtest"
+)
+
+func TestRecordStore_ListResourceFeeds(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	store, err := NewRecordStore(dbtest.Open(t))
+	assert.NoError(err)
+
+	assert.NoError(store.CreateRecords(ctx, []FeedRecord{
+		{
+			WorkOrder:     "WO1",
+			Batch:         1,
+			Station:       "S1",
+			FeedRecordID:  "F1",
+			SiteName:      "SITE",
+			Quantity:      decimal.NewNullDecimal(decimal.NewFromInt(10)),
+			CreatedBy:     "tester",
+			SiteResources: []string{"R1", "R2"},
+		},
+		{
+			WorkOrder:  "WO1",
+			Batch:      1,
+			Station:    "S1",
+			ResourceID: "R1",
+			CreatedBy:  "tester",
+		},
+		{ // another batch.
+			WorkOrder:  "WO1",
+			Batch:      2,
+			Station:    "S1",
+			ResourceID: "R1",
+			CreatedBy:  "tester",
+		},
+	}, nil))
+
+	records, err := store.ListResourceFeeds(ctx, "WO1", 1, "R1")
+	assert.NoError(err)
+	if assert.Len(records, 2) {
+		assert.Equal("F1", records[0].FeedRecordID)
+		assert.True(decimal.NewFromInt(10).Equal(records[0].Quantity.Decimal))
+		assert.False(records[1].Quantity.Valid)
+	}
+
+	records, err = store.ListResourceFeeds(ctx, "WO1", 1, "R2")
+	assert.NoError(err)
+	assert.Len(records, 1)
+
+	records, err = store.ListResourceFeeds(ctx, "WO1", 1, "R3")
+	assert.NoError(err)
+	assert.Empty(records)
+}
+
+func TestRecordStore_ListFeedRecords(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	db := dbtest.Open(t)
+	store, err := NewRecordStore(db)
+	assert.NoError(err)
+	feeds, err := NewFeedStore(db)
+	assert.NoError(err)
+
+	assert.NoError(store.CreateRecords(ctx, []FeedRecord{
+		{
+			WorkOrder:     "WO1",
+			Batch:         1,
+			Station:       "S1",
+			FeedRecordID:  "F1",
+			SiteName:      "SITE",
+			Quantity:      decimal.NewNullDecimal(decimal.NewFromInt(10)),
+			CreatedBy:     "tester",
+			SiteResources: []string{"R1"},
+		},
+		{ // through MES.
+			WorkOrder:  "WO1",
+			Batch:      1,
+			Station:    "S1",
+			ResourceID: "R2",
+			Quantity:   decimal.NewNullDecimal(decimal.NewFromInt(5)),
+			CreatedBy:  "tester",
+		},
+		{ // according to the recipe.
+			WorkOrder:  "WO1",
+			Batch:      1,
+			Station:    "S1",
+			ResourceID: "R3",
+			CreatedBy:  "tester",
+		},
+	}, nil))
+	for _, unfeed := range []UnfeedRecord{
+		{WorkOrder: "WO1", Batch: 1, FeedRecordID: "F1", ResourceID: "R1", Quantity: decimal.NewFromInt(3)},
+		{WorkOrder: "WO1", Batch: 1, FeedRecordID: "F1", ResourceID: "R1", Quantity: decimal.NewFromInt(1)},
+		{WorkOrder: "WO1", Batch: 1, ResourceID: "R2", Quantity: decimal.NewFromInt(2)},
+		{WorkOrder: "WO1", Batch: 1, ResourceID: "R3", Quantity: decimal.NewFromInt(2)},
+		// another feed record, another batch and another resource.
+		{WorkOrder: "WO1", Batch: 1, FeedRecordID: "F2", ResourceID: "R1", Quantity: decimal.NewFromInt(7)},
+		{WorkOrder: "WO1", Batch: 2, FeedRecordID: "F1", ResourceID: "R1", Quantity: decimal.NewFromInt(7)},
+		{WorkOrder: "WO1", Batch: 1, FeedRecordID: "F1", ResourceID: "R9", Quantity: decimal.NewFromInt(7)},
+	} {
+		unfeed.ProductType = "TYPE"
+		unfeed.CreatedBy = "tester"
+		assert.NoError(feeds.CreateUnfeedRecord(ctx, unfeed))
+	}
+
+	records, totals, err := store.ListFeedRecords(ctx, RecordFilter{WorkOrder: "WO1"}, Pagination{})
+	assert.NoError(err)
+	assert.Equal(int64(3), totals.Count)
+	assert.Equal("9", totals.Quantity.String())
+	returned := make(map[string]string, len(records))
+	for _, record := range records {
+		returned[record.FeedRecordID+record.ResourceID] = record.Returned.String()
+	}
+	assert.Equal(map[string]string{"F1": "4", "R2": "2", "R3": "2"}, returned)
+}
+
+func TestRecordStore_ListCollectRecords(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	db := dbtest.Open(t)
+	store, err := NewRecordStore(db)
+	assert.NoError(err)
+	collects, err := NewCollectStore(db)
+	assert.NoError(err)
+
+	batch := int16(1)
+	assert.NoError(store.CreateRecords(ctx, nil, []CollectRecord{
+		{WorkOrder: "WO1", Sequence: 1, Batch: &batch, Station: "S1", ResourceID: "R1", Quantity: decimal.NewFromInt(10), CreatedBy: "tester"},
+		{WorkOrder: "WO1", Sequence: 2, Batch: &batch, FirstSequence: 1, Station: "S1", ResourceID: "R2", Quantity: decimal.NewFromInt(20), CreatedBy: "tester"},
+		{WorkOrder: "WO2", Sequence: 1, Station: "S1", ResourceID: "R3", Quantity: decimal.NewFromInt(30), CreatedBy: "tester"},
+	}))
+	// the same sequence of another work order is not reversed.
+	assert.NoError(collects.CreateCollectReversal(ctx, CollectReversal{
+		WorkOrder:  "WO1",
+		Sequence:   2,
+		ResourceID: "R2",
+		Quantity:   decimal.NewFromInt(20),
+		Reason:     "wrong product",
+		CreatedBy:  "tester",
+	}))
+	// the adjusted collect counts the adjusted quantity.
+	assert.NoError(collects.CreateCollectReversal(ctx, CollectReversal{
+		WorkOrder:        "WO2",
+		Sequence:         1,
+		ResourceID:       "R3",
+		Quantity:         decimal.NewFromInt(30),
+		AdjustedQuantity: decimal.NewNullDecimal(decimal.NewFromInt(25)),
+		Reason:           "wrong quantity",
+		CreatedBy:        "tester",
+	}))
+
+	records, totals, err := store.ListCollectRecords(ctx, RecordFilter{}, Pagination{})
+	assert.NoError(err)
+	assert.Equal(int64(3), totals.Count)
+	assert.Equal("35", totals.Quantity.String())
+	reversed := make(map[string]bool, len(records))
+	adjusted := make(map[string]string, len(records))
+	for _, record := range records {
+		reversed[record.ResourceID] = record.Reversed
+		if record.AdjustedQuantity.Valid {
+			adjusted[record.ResourceID] = record.AdjustedQuantity.Decimal.String()
+		}
+	}
+	assert.Equal(map[string]bool{"R1": false, "R2": true, "R3": true}, reversed)
+	assert.Equal(map[string]string{"R3": "25"}, adjusted)
+
+	records, totals, err = store.ListCollectRecords(ctx, RecordFilter{WorkOrder: "WO1"}, Pagination{Page: 1, Limit: 1})
+	assert.NoError(err)
+	assert.Equal(int64(2), totals.Count)
+	assert.Equal("10", totals.Quantity.String())
+	if assert.Len(records, 1) {
+		assert.Equal("R2", records[0].ResourceID)
+		assert.True(records[0].Reversed)
+		assert.Equal(int16(1), records[0].FirstSequence)
+	}
+}
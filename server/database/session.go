@@ -0,0 +1,133 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Session is a login session of a user.
+type Session struct {
+	ID string `gorm:"primaryKey"`
+	// Token is the token signed in by the data manager, which is never exposed
+	// by the APIs except for the login.
+	Token  string `gorm:"uniqueIndex;not null"`
+	UserID string `gorm:"index;not null"`
+	// Device is the user agent of the login request.
+	Device    string
+	IP        string
+	LoginAt   time.Time
+	ExpiresAt time.Time
+	RevokedAt *time.Time
+	// RevokedBy is empty if the user logged out.
+	RevokedBy string
+}
+
+// TableName implements gorm.Tabler interface.
+func (Session) TableName() string {
+	return "mui_sessions"
+}
+
+// SessionStore stores the login sessions.
+type SessionStore interface {
+	// CreateSession creates a session.
+	CreateSession(ctx context.Context, session Session) error
+	// GetSession returns the specified session.
+	// It returns ErrRecordNotFound if the session does not exist.
+	GetSession(ctx context.Context, id string) (Session, error)
+	// GetSessionByToken is the same as GetSession but finding the session by its token.
+	GetSessionByToken(ctx context.Context, token string) (Session, error)
+	// ListActiveSessions lists the sessions of the user which are neither
+	// revoked nor expired, ordered by login time.
+	ListActiveSessions(ctx context.Context, userID string) ([]Session, error)
+	// RevokeSession marks the specified session revoked, nothing changes if it
+	// has been revoked. It returns ErrRecordNotFound if the session does not exist.
+	RevokeSession(ctx context.Context, id string, revokedBy string) error
+	// RevokeSessionByToken is the same as RevokeSession but finding the session by its token.
+	RevokeSessionByToken(ctx context.Context, token string, revokedBy string) error
+}
+
+type sessionStore struct {
+	db *gorm.DB
+}
+
+// NewSessionStore returns a SessionStore and migrates its tables.
+func NewSessionStore(db *gorm.DB) (SessionStore, error) {
+	if err := db.AutoMigrate(&Session{}); err != nil {
+		return nil, err
+	}
+	return sessionStore{db: db}, nil
+}
+
+// CreateSession implements SessionStore interface.
+func (s sessionStore) CreateSession(ctx context.Context, session Session) error {
+	return s.db.WithContext(ctx).Create(&session).Error
+}
+
+// GetSession implements SessionStore interface.
+func (s sessionStore) GetSession(ctx context.Context, id string) (Session, error) {
+	return s.get(ctx, "id = ?", id)
+}
+
+// GetSessionByToken implements SessionStore interface.
+func (s sessionStore) GetSessionByToken(ctx context.Context, token string) (Session, error) {
+	return s.get(ctx, "token = ?", token)
+}
+
+func (s sessionStore) get(ctx context.Context, query string, arg string) (Session, error) {
+	var session Session
+	if err := s.db.WithContext(ctx).Where(query, arg).Take(&session).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return Session{}, ErrRecordNotFound
+		}
+		return Session{}, err
+	}
+	return session, nil
+}
+
+// ListActiveSessions implements SessionStore interface.
+func (s sessionStore) ListActiveSessions(ctx context.Context, userID string) ([]Session, error) {
+	var sessions []Session
+	if err := s.db.WithContext(ctx).
+		Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Order("login_at").
+		Find(&sessions).Error; err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// RevokeSession implements SessionStore interface.
+func (s sessionStore) RevokeSession(ctx context.Context, id string, revokedBy string) error {
+	return s.revoke(ctx, "id = ?", id, revokedBy)
+}
+
+// RevokeSessionByToken implements SessionStore interface.
+func (s sessionStore) RevokeSessionByToken(ctx context.Context, token string, revokedBy string) error {
+	return s.revoke(ctx, "token = ?", token, revokedBy)
+}
+
+func (s sessionStore) revoke(ctx context.Context, query string, arg string, revokedBy string) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var session Session
+		if err := tx.Where(query, arg).Take(&session).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrRecordNotFound
+			}
+			return err
+		}
+		if session.RevokedAt != nil {
+			return nil
+		}
+
+		now := time.Now()
+		return tx.Model(&Session{}).
+			Where("id = ?", session.ID).
+			Updates(map[string]interface{}{
+				"revoked_at": now,
+				"revoked_by": revokedBy,
+			}).Error
+	})
+}
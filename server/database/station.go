@@ -0,0 +1,141 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// StationSignIn is a sign-in of a station site recorded by MUI, by which the
+// operating time of the station is calculated.
+type StationSignIn struct {
+	ID      int64  `gorm:"primaryKey"`
+	Station string `gorm:"index:idx_mui_station_sign_ins_site;not null"`
+	// SiteName is empty if all the sites of the station are signed in together.
+	SiteName   string `gorm:"index:idx_mui_station_sign_ins_site"`
+	Group      int16
+	WorkDate   time.Time `gorm:"type:date"`
+	CreatedBy  string    `gorm:"not null"`
+	SignedInAt time.Time `gorm:"index;not null"`
+	// SignedOutAt is null until the site is signed out or signed in again.
+	SignedOutAt *time.Time `gorm:"index"`
+}
+
+// TableName implements gorm.Tabler interface.
+func (StationSignIn) TableName() string {
+	return "mui_station_sign_ins"
+}
+
+// Downtime is a time when a signed-in station does not run, e.g. for a
+// breakdown or a changeover.
+type Downtime struct {
+	ID        int64     `gorm:"primaryKey"`
+	Station   string    `gorm:"index;not null"`
+	Reason    string    `gorm:"not null"`
+	StartedAt time.Time `gorm:"index;not null"`
+	EndedAt   time.Time `gorm:"not null"`
+	CreatedBy string    `gorm:"not null"`
+	CreatedAt time.Time
+}
+
+// TableName implements gorm.Tabler interface.
+func (Downtime) TableName() string {
+	return "mui_station_downtimes"
+}
+
+// StationSite is a site of a station, the empty SiteName is all the sites.
+type StationSite struct {
+	Station  string
+	SiteName string
+}
+
+// StationLogStore stores the sign-ins and the downtimes of the stations.
+type StationLogStore interface {
+	// SignInStation records the sign-in, the sign-in of the same site which is
+	// not signed out is signed out at the same time.
+	SignInStation(ctx context.Context, signIn StationSignIn) error
+	// SignOutStations signs out the sites at the time.
+	SignOutStations(ctx context.Context, sites []StationSite, t time.Time) error
+	// CreateDowntime records a downtime.
+	CreateDowntime(ctx context.Context, downtime Downtime) error
+	// ListStationSignIns lists the sign-ins overlapping the time range in
+	// sign-in order, of all the stations if station is empty.
+	ListStationSignIns(ctx context.Context, station string, since, until time.Time) ([]StationSignIn, error)
+	// ListDowntimes lists the downtimes overlapping the time range in start
+	// order, of all the stations if station is empty.
+	ListDowntimes(ctx context.Context, station string, since, until time.Time) ([]Downtime, error)
+}
+
+type stationLogStore struct {
+	db *gorm.DB
+}
+
+// NewStationLogStore returns a StationLogStore and migrates its tables.
+func NewStationLogStore(db *gorm.DB) (StationLogStore, error) {
+	if err := db.AutoMigrate(&StationSignIn{}, &Downtime{}); err != nil {
+		return nil, err
+	}
+	return stationLogStore{db: db}, nil
+}
+
+// SignInStation implements StationLogStore interface.
+func (s stationLogStore) SignInStation(ctx context.Context, signIn StationSignIn) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := signOut(tx, StationSite{Station: signIn.Station, SiteName: signIn.SiteName}, signIn.SignedInAt); err != nil {
+			return err
+		}
+		return tx.Create(&signIn).Error
+	})
+}
+
+// SignOutStations implements StationLogStore interface.
+func (s stationLogStore) SignOutStations(ctx context.Context, sites []StationSite, t time.Time) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, site := range sites {
+			if err := signOut(tx, site, t); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func signOut(tx *gorm.DB, site StationSite, t time.Time) error {
+	return tx.Model(&StationSignIn{}).
+		Where("station = ? AND site_name = ? AND signed_out_at IS NULL", site.Station, site.SiteName).
+		Update("signed_out_at", t).Error
+}
+
+// CreateDowntime implements StationLogStore interface.
+func (s stationLogStore) CreateDowntime(ctx context.Context, downtime Downtime) error {
+	return s.db.WithContext(ctx).Create(&downtime).Error
+}
+
+// ListStationSignIns implements StationLogStore interface.
+func (s stationLogStore) ListStationSignIns(ctx context.Context, station string, since, until time.Time) ([]StationSignIn, error) {
+	db := s.db.WithContext(ctx).
+		Where("signed_in_at < ? AND (signed_out_at IS NULL OR signed_out_at > ?)", until, since)
+	if station != "" {
+		db = db.Where("station = ?", station)
+	}
+	var signIns []StationSignIn
+	if err := db.Order("signed_in_at, id").Find(&signIns).Error; err != nil {
+		return nil, err
+	}
+	return signIns, nil
+}
+
+// ListDowntimes implements StationLogStore interface.
+func (s stationLogStore) ListDowntimes(ctx context.Context, station string, since, until time.Time) ([]Downtime, error) {
+	db := s.db.WithContext(ctx).
+		Where("started_at < ? AND ended_at > ?", until, since)
+	if station != "" {
+		db = db.Where("station = ?", station)
+	}
+	var downtimes []Downtime
+	if err := db.Order("started_at, id").Find(&downtimes).Error; err != nil {
+		return nil, err
+	}
+	return downtimes, nil
+}
@@ -0,0 +1,78 @@
+// Package storetest provides the stores on the test databases for the tests
+// of the handlers.
+package storetest
+
+import (
+	"testing"
+
+	"gorm.io/gorm"
+
+	"gitlab.kenda.com.tw/kenda/mui/server/database"
+	"gitlab.kenda.com.tw/kenda/mui/server/database/dbtest"
+)
+
+// Stores are the stores sharing a test database, by which the queries across
+// the tables of the stores work as in production.
+type Stores struct {
+	DB            *gorm.DB
+	Collects      database.CollectStore
+	Defects       database.DefectStore
+	Feeds         database.FeedStore
+	Holds         database.HoldStore
+	LockoutEvents database.LockoutEventStore
+	Passwords     database.PasswordStore
+	Records       database.RecordStore
+	Sessions      database.SessionStore
+	StationLogs   database.StationLogStore
+	Syncs         database.SyncStore
+}
+
+// New returns the stores on a new test database, which is dropped at the end
+// of the test.
+func New(t testing.TB) Stores {
+	db := dbtest.Open(t)
+	stores := Stores{DB: db}
+	var err error
+	if stores.Collects, err = database.NewCollectStore(db); err != nil {
+		t.Fatal(err)
+	}
+	if stores.Defects, err = database.NewDefectStore(db); err != nil {
+		t.Fatal(err)
+	}
+	if stores.Feeds, err = database.NewFeedStore(db); err != nil {
+		t.Fatal(err)
+	}
+	if stores.Holds, err = database.NewHoldStore(db); err != nil {
+		t.Fatal(err)
+	}
+	if stores.LockoutEvents, err = database.NewLockoutEventStore(db); err != nil {
+		t.Fatal(err)
+	}
+	if stores.Passwords, err = database.NewPasswordStore(db); err != nil {
+		t.Fatal(err)
+	}
+	if stores.Records, err = database.NewRecordStore(db); err != nil {
+		t.Fatal(err)
+	}
+	if stores.Sessions, err = database.NewSessionStore(db); err != nil {
+		t.Fatal(err)
+	}
+	if stores.StationLogs, err = database.NewStationLogStore(db); err != nil {
+		t.Fatal(err)
+	}
+	if stores.Syncs, err = database.NewSyncStore(db); err != nil {
+		t.Fatal(err)
+	}
+	return stores
+}
+
+// Close closes the database, by which all the stores fail afterwards.
+func (s Stores) Close(t testing.TB) {
+	sqlDB, err := s.DB.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sqlDB.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
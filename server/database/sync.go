@@ -0,0 +1,151 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// SyncStatus is the status of an operation synchronized by a client.
+type SyncStatus string
+
+// SyncStatus definitions.
+const (
+	// SyncStatusPending is the operation being replayed.
+	SyncStatusPending SyncStatus = "PENDING"
+	// SyncStatusSucceeded is the operation replayed successfully.
+	SyncStatusSucceeded SyncStatus = "SUCCEEDED"
+)
+
+// SyncOperation is an operation queued by an offline client and replayed by
+// the server, which is kept to make the resending of the operation safe. Only
+// the pending and the succeeded operations are kept, so the failed ones can
+// be resent.
+type SyncOperation struct {
+	// ID is generated by the client, which is unique among the operations of
+	// the user.
+	ID         string     `gorm:"primaryKey"`
+	CreatedBy  string     `gorm:"primaryKey"`
+	Kind       string     `gorm:"not null"`
+	Station    string     `gorm:"index"`
+	ClientTime time.Time  `gorm:"not null"`
+	Status     SyncStatus `gorm:"not null"`
+	// Data is the JSON data replied by the operation.
+	Data string `gorm:"type:text"`
+	// ExpiresAt is when the claim of a pending operation expires, after which
+	// the operation can be claimed again, e.g. if the server stopped while
+	// replaying it.
+	ExpiresAt time.Time
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// TableName implements gorm.Tabler interface.
+func (SyncOperation) TableName() string {
+	return "mui_sync_operations"
+}
+
+// SyncStore stores the operations synchronized by the offline clients.
+type SyncStore interface {
+	// CreateSyncOperation claims an operation as pending for the lease before
+	// it is replayed. It returns ErrRecordExisted with the kept operation if
+	// the operation of the same user has succeeded, or has been claimed and
+	// the claim has not expired.
+	CreateSyncOperation(ctx context.Context, op SyncOperation, lease time.Duration) (SyncOperation, error)
+	// CompleteSyncOperation marks a pending operation of the user as succeeded
+	// with the replied data.
+	CompleteSyncOperation(ctx context.Context, user, id string, data string) error
+	// DeleteSyncOperation deletes a pending operation of the user which
+	// failed, so it can be resent.
+	DeleteSyncOperation(ctx context.Context, user, id string) error
+}
+
+type syncStore struct {
+	db *gorm.DB
+}
+
+// NewSyncStore returns a SyncStore and migrates its tables.
+func NewSyncStore(db *gorm.DB) (SyncStore, error) {
+	if err := db.AutoMigrate(&SyncOperation{}); err != nil {
+		return nil, err
+	}
+	return syncStore{db: db}, nil
+}
+
+// CreateSyncOperation implements SyncStore interface.
+func (s syncStore) CreateSyncOperation(ctx context.Context, op SyncOperation, lease time.Duration) (SyncOperation, error) {
+	now := time.Now()
+	op.Status = SyncStatusPending
+	op.ExpiresAt = now.Add(lease)
+
+	var kept SyncOperation
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("created_by = ? AND id = ?", op.CreatedBy, op.ID).Take(&kept).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&op)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				// claimed at the same time.
+				kept = SyncOperation{ID: op.ID, CreatedBy: op.CreatedBy, Status: SyncStatusPending}
+				return ErrRecordExisted
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if kept.Status != SyncStatusPending || kept.ExpiresAt.After(now) {
+			return ErrRecordExisted
+		}
+
+		// the expired claim is taken over, only one of the concurrent claims
+		// succeeds since the new claim has not expired.
+		result := tx.Model(&SyncOperation{}).
+			Where("created_by = ? AND id = ? AND status = ? AND expires_at <= ?", op.CreatedBy, op.ID, SyncStatusPending, now).
+			Updates(map[string]interface{}{
+				"kind":        op.Kind,
+				"station":     op.Station,
+				"client_time": op.ClientTime,
+				"expires_at":  op.ExpiresAt,
+				"updated_at":  now,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrRecordExisted
+		}
+		return nil
+	})
+	return kept, err
+}
+
+// CompleteSyncOperation implements SyncStore interface.
+func (s syncStore) CompleteSyncOperation(ctx context.Context, user, id string, data string) error {
+	result := s.db.WithContext(ctx).Model(&SyncOperation{}).
+		Where("created_by = ? AND id = ? AND status = ?", user, id, SyncStatusPending).
+		Updates(map[string]interface{}{
+			"status":     SyncStatusSucceeded,
+			"data":       data,
+			"updated_at": time.Now(),
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// DeleteSyncOperation implements SyncStore interface.
+func (s syncStore) DeleteSyncOperation(ctx context.Context, user, id string) error {
+	return s.db.WithContext(ctx).
+		Where("created_by = ? AND id = ? AND status = ?", user, id, SyncStatusPending).
+		Delete(&SyncOperation{}).Error
+}
@@ -0,0 +1,68 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"gitlab.kenda.com.tw/kenda/mui/server/database/dbtest"
+)
+
+func TestSyncStore(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	store, err := NewSyncStore(dbtest.Open(t))
+	assert.NoError(err)
+
+	clientTime := time.Date(2024, 3, 7, 8, 0, 0, 0, time.UTC)
+	newOperation := func(id, user string) SyncOperation {
+		return SyncOperation{
+			ID:         id,
+			CreatedBy:  user,
+			Kind:       "FEED",
+			Station:    "S1",
+			ClientTime: clientTime,
+		}
+	}
+
+	{ // claim and complete.
+		_, err := store.CreateSyncOperation(ctx, newOperation("OP-1", "tester"), time.Minute)
+		assert.NoError(err)
+
+		kept, err := store.CreateSyncOperation(ctx, newOperation("OP-1", "tester"), time.Minute)
+		assert.ErrorIs(err, ErrRecordExisted)
+		assert.Equal(SyncStatusPending, kept.Status)
+
+		assert.NoError(store.CompleteSyncOperation(ctx, "tester", "OP-1", `{"ok":true}`))
+		assert.ErrorIs(store.CompleteSyncOperation(ctx, "tester", "OP-1", `{}`), ErrRecordNotFound)
+
+		kept, err = store.CreateSyncOperation(ctx, newOperation("OP-1", "tester"), time.Minute)
+		assert.ErrorIs(err, ErrRecordExisted)
+		assert.Equal(SyncStatusSucceeded, kept.Status)
+		assert.Equal(`{"ok":true}`, kept.Data)
+	}
+	{ // the IDs of the other users are not shared.
+		_, err := store.CreateSyncOperation(ctx, newOperation("OP-1", "other"), time.Minute)
+		assert.NoError(err)
+	}
+	{ // the expired claim is claimed again, but not the succeeded operation.
+		_, err := store.CreateSyncOperation(ctx, newOperation("OP-2", "tester"), -time.Second)
+		assert.NoError(err)
+		_, err = store.CreateSyncOperation(ctx, newOperation("OP-2", "tester"), time.Minute)
+		assert.NoError(err)
+		_, err = store.CreateSyncOperation(ctx, newOperation("OP-2", "tester"), time.Minute)
+		assert.ErrorIs(err, ErrRecordExisted)
+	}
+	{ // the failed operation is released.
+		assert.NoError(store.DeleteSyncOperation(ctx, "tester", "OP-2"))
+		_, err := store.CreateSyncOperation(ctx, newOperation("OP-2", "tester"), time.Minute)
+		assert.NoError(err)
+		// the succeeded operation is kept.
+		assert.NoError(store.DeleteSyncOperation(ctx, "tester", "OP-1"))
+		_, err = store.CreateSyncOperation(ctx, newOperation("OP-1", "tester"), time.Minute)
+		assert.ErrorIs(err, ErrRecordExisted)
+	}
+}
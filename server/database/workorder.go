@@ -0,0 +1,152 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// WorkOrderMerge links a work order merged into another one, since the merged
+// work order is only skipped in the data manager.
+type WorkOrderMerge struct {
+	// Source is the merged work order.
+	Source string `gorm:"primaryKey"`
+	// Target is the work order into which the source is merged.
+	Target    string    `gorm:"index;not null"`
+	CreatedBy string    `gorm:"not null"`
+	CreatedAt time.Time `gorm:"not null"`
+}
+
+// TableName implements gorm.Tabler interface.
+func (WorkOrderMerge) TableName() string {
+	return "mui_work_order_merges"
+}
+
+// WorkOrderLock serializes the updates of a work order which are checked
+// against its updated time, since the data manager can not update a work order
+// on the condition of its updated time.
+type WorkOrderLock struct {
+	WorkOrder string `gorm:"primaryKey"`
+	// Owner is generated by the locking request to unlock its own locks.
+	Owner string `gorm:"not null"`
+	// ExpiresAt is when the lock expires, after which the work order can be
+	// locked again, e.g. if the server stopped while updating it.
+	ExpiresAt time.Time `gorm:"not null"`
+}
+
+// TableName implements gorm.Tabler interface.
+func (WorkOrderLock) TableName() string {
+	return "mui_work_order_locks"
+}
+
+// WorkOrderStore keeps the states of the work orders which are not maintained
+// by the data manager.
+type WorkOrderStore interface {
+	// CreateWorkOrderMerges records the merges. It returns ErrRecordExisted
+	// if any of the sources has been merged.
+	CreateWorkOrderMerges(ctx context.Context, merges []WorkOrderMerge) error
+	// DeleteWorkOrderMerges deletes the merges of the sources, which is used
+	// if the merge fails.
+	DeleteWorkOrderMerges(ctx context.Context, sources []string) error
+	// LockWorkOrders locks all of the work orders for the owner until the
+	// lease expires. It returns ErrRecordLocked and locks none of them if any
+	// of them is locked by others.
+	LockWorkOrders(ctx context.Context, owner string, workOrders []string, lease time.Duration) error
+	// UnlockWorkOrders releases the locks of the owner on the work orders.
+	UnlockWorkOrders(ctx context.Context, owner string, workOrders []string) error
+}
+
+type workOrderStore struct {
+	db *gorm.DB
+}
+
+// NewWorkOrderStore returns a WorkOrderStore and migrates its tables.
+func NewWorkOrderStore(db *gorm.DB) (WorkOrderStore, error) {
+	if err := db.AutoMigrate(&WorkOrderMerge{}, &WorkOrderLock{}); err != nil {
+		return nil, err
+	}
+	return workOrderStore{db: db}, nil
+}
+
+// CreateWorkOrderMerges implements WorkOrderStore interface.
+func (s workOrderStore) CreateWorkOrderMerges(ctx context.Context, merges []WorkOrderMerge) error {
+	if len(merges) == 0 {
+		return nil
+	}
+	sources := make([]string, len(merges))
+	for i, m := range merges {
+		sources[i] = m.Source
+	}
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&WorkOrderMerge{}).Where("source IN ?", sources).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrRecordExisted
+		}
+		return tx.Create(&merges).Error
+	})
+}
+
+// DeleteWorkOrderMerges implements WorkOrderStore interface.
+func (s workOrderStore) DeleteWorkOrderMerges(ctx context.Context, sources []string) error {
+	if len(sources) == 0 {
+		return nil
+	}
+	return s.db.WithContext(ctx).Where("source IN ?", sources).Delete(&WorkOrderMerge{}).Error
+}
+
+// LockWorkOrders implements WorkOrderStore interface.
+func (s workOrderStore) LockWorkOrders(ctx context.Context, owner string, workOrders []string, lease time.Duration) error {
+	now := time.Now()
+	expiresAt := now.Add(lease)
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		locked := make(map[string]bool, len(workOrders))
+		for _, id := range workOrders {
+			if locked[id] {
+				continue
+			}
+			locked[id] = true
+
+			result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&WorkOrderLock{
+				WorkOrder: id,
+				Owner:     owner,
+				ExpiresAt: expiresAt,
+			})
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected > 0 {
+				continue
+			}
+
+			// the expired lock is taken over.
+			result = tx.Model(&WorkOrderLock{}).
+				Where("work_order = ? AND expires_at <= ?", id, now).
+				Updates(map[string]interface{}{
+					"owner":      owner,
+					"expires_at": expiresAt,
+				})
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return ErrRecordLocked
+			}
+		}
+		return nil
+	})
+}
+
+// UnlockWorkOrders implements WorkOrderStore interface.
+func (s workOrderStore) UnlockWorkOrders(ctx context.Context, owner string, workOrders []string) error {
+	if len(workOrders) == 0 {
+		return nil
+	}
+	return s.db.WithContext(ctx).
+		Where("owner = ? AND work_order IN ?", owner, workOrders).
+		Delete(&WorkOrderLock{}).Error
+}
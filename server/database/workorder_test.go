@@ -0,0 +1,81 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"gitlab.kenda.com.tw/kenda/mui/server/database/dbtest"
+)
+
+func TestWorkOrderStore_WorkOrderMerges(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	db := dbtest.Open(t)
+	store, err := NewWorkOrderStore(db)
+	assert.NoError(err)
+
+	now := time.Now()
+	assert.NoError(store.CreateWorkOrderMerges(ctx, []WorkOrderMerge{
+		{Source: "WO-2", Target: "WO-1", CreatedBy: "tester", CreatedAt: now},
+		{Source: "WO-3", Target: "WO-1", CreatedBy: "tester", CreatedAt: now},
+	}))
+
+	{ // merged twice.
+		err := store.CreateWorkOrderMerges(ctx, []WorkOrderMerge{
+			{Source: "WO-4", Target: "WO-5", CreatedBy: "tester", CreatedAt: now},
+			{Source: "WO-3", Target: "WO-5", CreatedBy: "tester", CreatedAt: now},
+		})
+		assert.ErrorIs(err, ErrRecordExisted)
+	}
+
+	var merges []WorkOrderMerge
+	assert.NoError(db.Order("source").Find(&merges).Error)
+	if assert.Len(merges, 2) {
+		assert.Equal("WO-2", merges[0].Source)
+		assert.Equal("WO-1", merges[0].Target)
+		assert.Equal("WO-3", merges[1].Source)
+		assert.Equal("WO-1", merges[1].Target)
+	}
+
+	assert.NoError(store.DeleteWorkOrderMerges(ctx, []string{"WO-2"}))
+	merges = nil
+	assert.NoError(db.Find(&merges).Error)
+	if assert.Len(merges, 1) {
+		assert.Equal("WO-3", merges[0].Source)
+	}
+}
+
+func TestWorkOrderStore_LockWorkOrders(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	store, err := NewWorkOrderStore(dbtest.Open(t))
+	assert.NoError(err)
+
+	assert.NoError(store.LockWorkOrders(ctx, "owner-1", []string{"WO-1", "WO-2", "WO-1"}, time.Minute))
+
+	{ // locked by others, none of them is locked.
+		err := store.LockWorkOrders(ctx, "owner-2", []string{"WO-3", "WO-2"}, time.Minute)
+		assert.ErrorIs(err, ErrRecordLocked)
+		assert.NoError(store.LockWorkOrders(ctx, "owner-3", []string{"WO-3"}, time.Minute))
+	}
+	{ // unlocked by others.
+		assert.NoError(store.UnlockWorkOrders(ctx, "owner-2", []string{"WO-1"}))
+		err := store.LockWorkOrders(ctx, "owner-2", []string{"WO-1"}, time.Minute)
+		assert.ErrorIs(err, ErrRecordLocked)
+	}
+	{ // unlocked by the owner.
+		assert.NoError(store.UnlockWorkOrders(ctx, "owner-1", []string{"WO-1", "WO-2"}))
+		assert.NoError(store.LockWorkOrders(ctx, "owner-2", []string{"WO-1", "WO-2"}, time.Minute))
+	}
+	{ // expired.
+		assert.NoError(store.LockWorkOrders(ctx, "owner-4", []string{"WO-4"}, -time.Second))
+		assert.NoError(store.LockWorkOrders(ctx, "owner-5", []string{"WO-4"}, time.Minute))
+		err := store.LockWorkOrders(ctx, "owner-4", []string{"WO-4"}, time.Minute)
+		assert.ErrorIs(err, ErrRecordLocked)
+	}
+}
@@ -2,8 +2,10 @@ package account
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
+	"sort"
 	"time"
 
 	apiErrors "github.com/go-openapi/errors"
@@ -15,9 +17,13 @@ import (
 	"gitlab.kenda.com.tw/kenda/mcom"
 	mcomErrors "gitlab.kenda.com.tw/kenda/mcom/errors"
 
+	"gitlab.kenda.com.tw/kenda/mui/server/database"
 	handlerUtils "gitlab.kenda.com.tw/kenda/mui/server/impl/handlers/mcom/utils"
 	"gitlab.kenda.com.tw/kenda/mui/server/impl/service"
 	"gitlab.kenda.com.tw/kenda/mui/server/impl/utils"
+	"gitlab.kenda.com.tw/kenda/mui/server/impl/utils/lockout"
+	"gitlab.kenda.com.tw/kenda/mui/server/impl/utils/password"
+	"gitlab.kenda.com.tw/kenda/mui/server/impl/utils/role"
 	"gitlab.kenda.com.tw/kenda/mui/server/protobuf/kenda"
 	"gitlab.kenda.com.tw/kenda/mui/server/swagger/models"
 	"gitlab.kenda.com.tw/kenda/mui/server/swagger/restapi/operations/account"
@@ -31,22 +37,40 @@ const (
 	tokenExpiredError = "token expired"
 )
 
+// Config definitions.
+type Config struct {
+	TokenLifeTime time.Duration
+	// Sessions stores the login sessions.
+	Sessions database.SessionStore
+	// Lockouts tracks the failed logins, every login is allowed if it is nil.
+	Lockouts *lockout.Tracker
+	// TrustedProxies are the proxies whose X-Forwarded-For headers are used
+	// to find the client IPs of the logins.
+	TrustedProxies handlerUtils.TrustedProxies
+	// LockoutEvents stores the audit entries of the login lockouts.
+	LockoutEvents database.LockoutEventStore
+	// PasswordPolicy applies to the MES accounts.
+	PasswordPolicy password.Policy
+	// Passwords stores the password history of the MES accounts.
+	Passwords database.PasswordStore
+}
+
 // Authorization definitions.
 type Authorization struct {
-	dm mcom.DataManager
+	dm     mcom.DataManager
+	config Config
 
 	hasPermission func(id kenda.FunctionOperationID, roles []models.Role) bool
-	tokenLifeTime time.Duration
 }
 
 // NewAuthorization returns Authorization service.
 func NewAuthorization(
 	dm mcom.DataManager,
-	hasPermission func(id kenda.FunctionOperationID, roles []models.Role) bool, tokenLifeTime time.Duration) service.AccountAuthorization {
+	hasPermission func(id kenda.FunctionOperationID, roles []models.Role) bool, config Config) service.AccountAuthorization {
 	return Authorization{
 		dm:            dm,
+		config:        config,
 		hasPermission: hasPermission,
-		tokenLifeTime: tokenLifeTime,
 	}
 }
 
@@ -82,6 +106,16 @@ func (a Authorization) Auth(token string) (*models.Principal, error) {
 // Login handler implementation.
 func (a Authorization) Login(params account.LoginParams) middleware.Responder {
 	id := *params.Body.ID
+	ip := a.config.TrustedProxies.ClientIP(params.HTTPRequest)
+	if err := a.config.Lockouts.Check(params.HTTPRequest.Context(), id, ip); err != nil {
+		if _, ok := err.(lockout.BlockedError); ok {
+			return loginBlocked(err)
+		}
+		return account.NewLoginInternalServerError().WithPayload(&models.Error{
+			Details: err.Error(),
+		})
+	}
+
 	signInRequest := mcom.SignInRequest{
 		Account:  id,
 		Password: *params.Body.Password,
@@ -92,13 +126,14 @@ func (a Authorization) Login(params account.LoginParams) middleware.Responder {
 	}
 
 	var options []mcom.SignInOption
-	if a.tokenLifeTime > 0 {
-		options = append(options, mcom.WithTokenExpiredAfter(a.tokenLifeTime))
+	if a.config.TokenLifeTime > 0 {
+		options = append(options, mcom.WithTokenExpiredAfter(a.config.TokenLifeTime))
 	}
 
 	signInReply, err := a.dm.SignIn(params.HTTPRequest.Context(), signInRequest, options...)
 	if err != nil {
 		if e, ok := mcomErrors.As(err); ok {
+			a.loginFailed(params.HTTPRequest.Context(), id, ip)
 			return account.NewLoginBadRequest().WithPayload(&models.Error{
 				Code:    int64(e.Code),
 				Details: e.Details,
@@ -109,11 +144,23 @@ func (a Authorization) Login(params account.LoginParams) middleware.Responder {
 		})
 	}
 
+	if err := a.config.Lockouts.Succeed(params.HTTPRequest.Context(), id); err != nil {
+		zap.L().Error("failed to reset login failures", zap.String("user", id), zap.Error(err))
+	}
+	a.createSession(params.HTTPRequest, id, signInReply.Token, signInReply.TokenExpiry)
+
+	// the password policy applies to the MES accounts only.
+	passwordExpired := false
+	if !signInRequest.ADUser {
+		passwordExpired = a.isPasswordExpired(params.HTTPRequest.Context(), id, signInRequest.Password)
+	}
+
 	return account.NewLoginOK().WithPayload(&account.LoginOKBody{Data: &models.LoginResponse{
 		Token:                 signInReply.Token,
 		TokenExpiry:           strfmt.DateTime(signInReply.TokenExpiry),
 		Roles:                 handlerUtils.ToModelsRoles(signInReply.Roles),
 		AuthorizedDepartments: handlerUtils.ToDepartmentsModel(signInReply.Departments),
+		PasswordExpired:       passwordExpired,
 	}})
 }
 
@@ -134,6 +181,10 @@ func (a Authorization) Logout(params account.LogoutParams) middleware.Responder
 		logFunc("logout failed..", zap.String("token", token), zap.Error(err))
 	}
 
+	if err := a.config.Sessions.RevokeSessionByToken(ctx, token, ""); err != nil && !errors.Is(err, database.ErrRecordNotFound) {
+		zap.L().Error("failed to revoke session", zap.Error(err))
+	}
+
 	return account.NewLogoutOK()
 }
 
@@ -144,6 +195,10 @@ func (a Authorization) ChangePassword(params account.ChangePasswordParams, princ
 	}
 
 	ctx := commonsCtx.WithUserID(params.HTTPRequest.Context(), principal.ID)
+	if err := a.checkNewPassword(ctx, principal.ID, *params.Body.CurrentPassword, *params.Body.NewPassword); err != nil {
+		return utils.ParseError(ctx, account.NewChangePasswordDefault(0), err)
+	}
+
 	if err := a.dm.UpdateAccount(ctx, mcom.UpdateAccountRequest{
 		UserID: principal.ID,
 		ChangePassword: &struct {
@@ -157,6 +212,10 @@ func (a Authorization) ChangePassword(params account.ChangePasswordParams, princ
 		return utils.ParseError(ctx, account.NewChangePasswordDefault(0), err)
 	}
 
+	if err := a.recordPassword(ctx, principal.ID, *params.Body.NewPassword); err != nil {
+		return utils.ParseError(ctx, account.NewChangePasswordDefault(0), err)
+	}
+
 	return account.NewChangePasswordOK()
 }
 
@@ -254,6 +313,11 @@ func (a Authorization) CreateAccountAuthorization(params account.CreateAccountAu
 		return utils.ParseError(ctx, account.NewCreateAccountAuthorizationDefault(0), err)
 	}
 
+	// the default password has to be changed at the first login.
+	if err := a.requirePasswordChange(ctx, *params.Body.EmployeeID); err != nil {
+		return utils.ParseError(ctx, account.NewCreateAccountAuthorizationDefault(0), err)
+	}
+
 	return account.NewCreateAccountAuthorizationOK()
 }
 
@@ -277,6 +341,17 @@ func (a Authorization) UpdateAccountAuthorization(params account.UpdateAccountAu
 		return utils.ParseError(ctx, account.NewUpdateAccountAuthorizationDefault(0), err)
 	}
 
+	if *params.Body.ResetPassword {
+		if err := a.requirePasswordChange(ctx, params.EmployeeID); err != nil {
+			return utils.ParseError(ctx, account.NewUpdateAccountAuthorizationDefault(0), err)
+		}
+	}
+
+	// the roles of the signed in tokens are out of date.
+	if err := a.revokeSessions(ctx, params.EmployeeID, principal.ID); err != nil {
+		return utils.ParseError(ctx, account.NewUpdateAccountAuthorizationDefault(0), err)
+	}
+
 	return account.NewUpdateAccountAuthorizationOK()
 }
 
@@ -291,5 +366,46 @@ func (a Authorization) DeleteAccount(params account.DeleteAccountParams, princip
 		return utils.ParseError(ctx, account.NewDeleteAccountDefault(0), err)
 	}
 
+	if err := a.revokeSessions(ctx, params.EmployeeID, principal.ID); err != nil {
+		return utils.ParseError(ctx, account.NewDeleteAccountDefault(0), err)
+	}
+
+	if err := a.config.Passwords.DeletePasswords(ctx, params.EmployeeID); err != nil {
+		return utils.ParseError(ctx, account.NewDeleteAccountDefault(0), err)
+	}
+
 	return account.NewDeleteAccountOK()
 }
+
+// ListPermissions implementations
+func (a Authorization) ListPermissions(params account.ListPermissionsParams, principal *models.Principal) middleware.Responder {
+	ids := make([]int, 0, len(kenda.FunctionOperationID_name))
+	for id := range kenda.FunctionOperationID_name {
+		ids = append(ids, int(id))
+	}
+	sort.Ints(ids)
+
+	data := []*account.ListPermissionsOKBodyDataItems0{}
+	for _, v := range ids {
+		id := kenda.FunctionOperationID(v)
+		if !a.hasPermission(id, principal.Roles) {
+			continue
+		}
+
+		routes := role.Routes(id)
+		items := make([]*account.ListPermissionsOKBodyDataItems0RoutesItems0, len(routes))
+		for i, route := range routes {
+			items[i] = &account.ListPermissionsOKBodyDataItems0RoutesItems0{
+				Method: route.Method,
+				Path:   route.Path,
+			}
+		}
+		data = append(data, &account.ListPermissionsOKBodyDataItems0{
+			ID:     int64(id),
+			Name:   id.String(),
+			Routes: items,
+		})
+	}
+
+	return account.NewListPermissionsOK().WithPayload(&account.ListPermissionsOKBody{Data: data})
+}
@@ -114,7 +114,7 @@ func TestAuthorization(t *testing.T) {
 
 		u := NewAuthorization(dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
 			return false
-		}, 0)
+		}, Config{Sessions: newSessionStore(t), Passwords: newPasswordStore(t)})
 
 		params := authorization.LoginParams{
 			HTTPRequest: httpRequest,
@@ -152,7 +152,7 @@ func TestAuthorization(t *testing.T) {
 
 		u := NewAuthorization(dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
 			return false
-		}, 0)
+		}, Config{Sessions: newSessionStore(t), Passwords: newPasswordStore(t)})
 
 		_, err = u.Auth(tokenFor + brokenUser)
 		assert.Equal(apiErrors.New(http.StatusUnauthorized, fmt.Sprintf("%v", mcomErrors.Error{
@@ -180,7 +180,7 @@ func TestAuthorization(t *testing.T) {
 
 		u := NewAuthorization(dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
 			return false
-		}, 0)
+		}, Config{Sessions: newSessionStore(t), Passwords: newPasswordStore(t)})
 
 		logoutRequest := httptest.NewRequest(http.MethodPost, "/logout", nil)
 		logoutRequest.Header.Set(AuthorizationKey, tokenFor+brokenUser)
@@ -217,7 +217,7 @@ func TestAuthorization(t *testing.T) {
 
 		u := NewAuthorization(dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
 			return false
-		}, 8*60*60*time.Second)
+		}, Config{TokenLifeTime: 8 * 60 * 60 * time.Second, Sessions: newSessionStore(t), Passwords: newPasswordStore(t)})
 
 		params := authorization.LoginParams{
 			HTTPRequest: httpRequest,
@@ -263,7 +263,7 @@ func TestAuthorization(t *testing.T) {
 
 		u := NewAuthorization(dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
 			return true
-		}, 0)
+		}, Config{Sessions: newSessionStore(t), Passwords: newPasswordStore(t)})
 
 		windowsLoginType := models.LoginType(1)
 
@@ -310,7 +310,7 @@ func TestAuthorization(t *testing.T) {
 
 		u := NewAuthorization(dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
 			return false
-		}, 0)
+		}, Config{Sessions: newSessionStore(t), Passwords: newPasswordStore(t)})
 
 		_, err = u.Auth(tokenFor + userID)
 		assert.NoError(err)
@@ -335,7 +335,7 @@ func TestAuthorization(t *testing.T) {
 
 		u := NewAuthorization(dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
 			return false
-		}, 0)
+		}, Config{Sessions: newSessionStore(t), Passwords: newPasswordStore(t)})
 
 		_, err = u.Auth(tokenFor + userID)
 		assert.EqualError(err, internalError)
@@ -363,7 +363,7 @@ func TestAuthorization(t *testing.T) {
 
 		u := NewAuthorization(dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
 			return false
-		}, 0)
+		}, Config{Sessions: newSessionStore(t), Passwords: newPasswordStore(t)})
 
 		_, err = u.Auth(tokenFor + userID)
 		assert.Equal(apiErrors.New(http.StatusUnauthorized, fmt.Sprintf("%v", mcomErrors.Error{
@@ -397,7 +397,7 @@ func TestAuthorization(t *testing.T) {
 
 		u := NewAuthorization(dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
 			return false
-		}, 0)
+		}, Config{Sessions: newSessionStore(t), Passwords: newPasswordStore(t)})
 
 		_, err = u.Auth(tokenFor + userID)
 		assert.EqualError(err, invalidUserError)
@@ -428,7 +428,7 @@ func TestAuthorization(t *testing.T) {
 
 		u := NewAuthorization(dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
 			return false
-		}, 0)
+		}, Config{Sessions: newSessionStore(t), Passwords: newPasswordStore(t)})
 
 		_, err = u.Auth(tokenFor + userID)
 		assert.EqualError(err, tokenExpiredError)
@@ -450,7 +450,7 @@ func TestAuthorization(t *testing.T) {
 
 		u := NewAuthorization(dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
 			return false
-		}, 0)
+		}, Config{Sessions: newSessionStore(t), Passwords: newPasswordStore(t)})
 
 		logoutRequest := httptest.NewRequest(http.MethodPost, "/logout", nil)
 		logoutRequest.Header.Set(AuthorizationKey, tokenFor+userID)
@@ -481,7 +481,7 @@ func TestAuthorization(t *testing.T) {
 
 		u := NewAuthorization(dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
 			return false
-		}, 0)
+		}, Config{Sessions: newSessionStore(t), Passwords: newPasswordStore(t)})
 
 		logoutRequest := httptest.NewRequest(http.MethodPost, "/logout", nil)
 		logoutRequest.Header.Set(AuthorizationKey, tokenFor+userID)
@@ -509,7 +509,7 @@ func TestAuthorization(t *testing.T) {
 
 		u := NewAuthorization(dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
 			return false
-		}, 0)
+		}, Config{Sessions: newSessionStore(t), Passwords: newPasswordStore(t)})
 
 		logoutRequest := httptest.NewRequest(http.MethodPost, "/logout", nil)
 		logoutRequest.Header.Set(AuthorizationKey, tokenFor+userID)
@@ -541,7 +541,7 @@ func TestAuthorization(t *testing.T) {
 
 		u := NewAuthorization(dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
 			return false
-		}, 0)
+		}, Config{Sessions: newSessionStore(t), Passwords: newPasswordStore(t)})
 
 		params := authorization.LoginParams{
 			HTTPRequest: httpRequest,
@@ -582,7 +582,7 @@ func TestAuthorization(t *testing.T) {
 
 		u := NewAuthorization(dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
 			return false
-		}, 0)
+		}, Config{Sessions: newSessionStore(t), Passwords: newPasswordStore(t)})
 
 		password := ""
 		params := authorization.LoginParams{
@@ -625,7 +625,7 @@ func TestAuthorization(t *testing.T) {
 
 		u := NewAuthorization(dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
 			return false
-		}, 0)
+		}, Config{Sessions: newSessionStore(t), Passwords: newPasswordStore(t)})
 
 		// missing user
 		userID, password = "", "p4s5w0rd"
@@ -778,7 +778,7 @@ func TestAuthorization_ChangePassword(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			u := NewAuthorization(dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
 				return true
-			}, 0)
+			}, Config{Sessions: newSessionStore(t), Passwords: newPasswordStore(t)})
 			if got := u.ChangePassword(tt.args.params, tt.args.principal); !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("ChangePassword() = %v, want %v", got, tt.want)
 			}
@@ -791,7 +791,7 @@ func TestAuthorization_ChangePassword(t *testing.T) {
 		assert.NoError(err)
 		r := NewAuthorization(dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
 			return false
-		}, 0)
+		}, Config{Sessions: newSessionStore(t), Passwords: newPasswordStore(t)})
 		rep, ok := r.ChangePassword(authorization.ChangePasswordParams{
 			HTTPRequest: httpRequestWithHeader,
 			Body: authorization.ChangePasswordBody{
@@ -920,7 +920,7 @@ func TestAuthorization_ListAuthorizedAccount(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			a := NewAuthorization(dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
 				return true
-			}, 0)
+			}, Config{Sessions: newSessionStore(t), Passwords: newPasswordStore(t)})
 			if got := a.ListAuthorizedAccount(tt.args.params, tt.args.principal); !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("ListAuthorizedAccount() = %v, want %v", got, tt.want)
 			}
@@ -930,7 +930,7 @@ func TestAuthorization_ListAuthorizedAccount(t *testing.T) {
 	{ // forbidden access
 		a := NewAuthorization(dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
 			return false
-		}, 0)
+		}, Config{Sessions: newSessionStore(t), Passwords: newPasswordStore(t)})
 		rep, ok := a.ListAuthorizedAccount(authorization.ListAuthorizedAccountParams{
 			HTTPRequest:   httpRequestWithHeader,
 			DepartmentOID: testDepartmentOID,
@@ -1053,7 +1053,7 @@ func TestAuthorization_ListUnauthorizedAccount(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			a := NewAuthorization(dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
 				return true
-			}, 0)
+			}, Config{Sessions: newSessionStore(t), Passwords: newPasswordStore(t)})
 			if got := a.ListUnauthorizedAccount(tt.args.params, tt.args.principal); !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("ListUnauthorizedAccount() = %v, want %v", got, tt.want)
 			}
@@ -1063,7 +1063,7 @@ func TestAuthorization_ListUnauthorizedAccount(t *testing.T) {
 	{ // forbidden access
 		a := NewAuthorization(dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
 			return false
-		}, 0)
+		}, Config{Sessions: newSessionStore(t), Passwords: newPasswordStore(t)})
 		rep, ok := a.ListUnauthorizedAccount(authorization.ListUnauthorizedAccountParams{
 			HTTPRequest:   httpRequestWithHeader,
 			DepartmentOID: testDepartmentOID,
@@ -1209,7 +1209,7 @@ func TestAuthorization_GetRoleList(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			a := NewAuthorization(dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
 				return true
-			}, 0)
+			}, Config{Sessions: newSessionStore(t), Passwords: newPasswordStore(t)})
 			if got := a.GetRoleList(tt.args.params, tt.args.principal); !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("GetRoleList() = %v, want %v", got, tt.want)
 			}
@@ -1219,7 +1219,7 @@ func TestAuthorization_GetRoleList(t *testing.T) {
 	{ // forbidden access
 		a := NewAuthorization(dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
 			return false
-		}, 0)
+		}, Config{Sessions: newSessionStore(t), Passwords: newPasswordStore(t)})
 		rep, ok := a.GetRoleList(authorization.GetRoleListParams{
 			HTTPRequest: httpRequestWithHeader,
 		}, principal).(*authorization.GetRoleListDefault)
@@ -1339,7 +1339,7 @@ func TestAuthorization_Create(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			a := NewAuthorization(dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
 				return true
-			}, 0)
+			}, Config{Sessions: newSessionStore(t), Passwords: newPasswordStore(t)})
 			if got := a.CreateAccountAuthorization(tt.args.params, tt.args.principal); !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("Create() = %v, want %v", got, tt.want)
 			}
@@ -1349,7 +1349,7 @@ func TestAuthorization_Create(t *testing.T) {
 	{ // forbidden access
 		a := NewAuthorization(dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
 			return false
-		}, 0)
+		}, Config{Sessions: newSessionStore(t), Passwords: newPasswordStore(t)})
 		rep, ok := a.CreateAccountAuthorization(authorization.CreateAccountAuthorizationParams{
 			HTTPRequest: httpRequestWithHeader,
 			Body: authorization.CreateAccountAuthorizationBody{
@@ -1496,7 +1496,7 @@ func TestAuthorization_UpdateAccount(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			a := NewAuthorization(dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
 				return true
-			}, 0)
+			}, Config{Sessions: newSessionStore(t), Passwords: newPasswordStore(t)})
 			if got := a.UpdateAccountAuthorization(tt.args.params, tt.args.principal); !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("Update() = %v, want %v", got, tt.want)
 			}
@@ -1506,7 +1506,7 @@ func TestAuthorization_UpdateAccount(t *testing.T) {
 	{ // forbidden access
 		a := NewAuthorization(dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
 			return false
-		}, 0)
+		}, Config{Sessions: newSessionStore(t), Passwords: newPasswordStore(t)})
 		rep, ok := a.UpdateAccountAuthorization(authorization.UpdateAccountAuthorizationParams{
 			HTTPRequest: httpRequestWithHeader,
 			EmployeeID:  testUsernameSpencer,
@@ -1613,7 +1613,7 @@ func TestAuthorization_DeleteAccount(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			a := NewAuthorization(dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
 				return true
-			}, 0)
+			}, Config{Sessions: newSessionStore(t), Passwords: newPasswordStore(t)})
 			if got := a.DeleteAccount(tt.args.params, tt.args.principal); !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("DeleteAccount() = %v, want %v", got, tt.want)
 			}
@@ -1623,7 +1623,7 @@ func TestAuthorization_DeleteAccount(t *testing.T) {
 	{ // forbidden access
 		a := NewAuthorization(dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
 			return false
-		}, 0)
+		}, Config{Sessions: newSessionStore(t), Passwords: newPasswordStore(t)})
 		rep, ok := a.DeleteAccount(authorization.DeleteAccountParams{
 			HTTPRequest: httpRequestWithHeader,
 			EmployeeID:  testUsernameSpencer,
@@ -1632,3 +1632,89 @@ func TestAuthorization_DeleteAccount(t *testing.T) {
 		assert.Equal(authorization.NewDeleteAccountDefault(http.StatusForbidden), rep)
 	}
 }
+
+func TestAuthorization_ListPermissions(t *testing.T) {
+	assert := assert.New(t)
+	dm, err := mock.New([]mock.Script{})
+	assert.NoError(err)
+
+	httpRequestWithHeader := httptest.NewRequest("GET", "/user/permissions", nil)
+	httpRequestWithHeader.Header.Set(AuthorizationKey, "token-for-tester")
+
+	type args struct {
+		params    authorization.ListPermissionsParams
+		principal *models.Principal
+	}
+	tests := []struct {
+		name          string
+		args          args
+		hasPermission func(id kenda.FunctionOperationID, roles []models.Role) bool
+		want          middleware.Responder
+	}{
+		{
+			name: "partial permissions",
+			args: args{
+				params: authorization.ListPermissionsParams{
+					HTTPRequest: httpRequestWithHeader,
+				},
+				principal: principal,
+			},
+			hasPermission: func(id kenda.FunctionOperationID, roles []models.Role) bool {
+				return id == kenda.FunctionOperationID_CHANGE_USER_PASSWORD ||
+					id == kenda.FunctionOperationID_GET_PRODUCT_TYPE_LIST
+			},
+			want: authorization.NewListPermissionsOK().WithPayload(&authorization.ListPermissionsOKBody{
+				Data: []*authorization.ListPermissionsOKBodyDataItems0{
+					{
+						ID:   int64(kenda.FunctionOperationID_GET_PRODUCT_TYPE_LIST),
+						Name: kenda.FunctionOperationID_GET_PRODUCT_TYPE_LIST.String(),
+						Routes: []*authorization.ListPermissionsOKBodyDataItems0RoutesItems0{
+							{
+								Method: http.MethodGet,
+								Path:   "/product/active-product-types/department-oid/{departmentOID}",
+							},
+							{
+								Method: http.MethodGet,
+								Path:   "/product/active-product-types",
+							},
+						},
+					},
+					{
+						ID:   int64(kenda.FunctionOperationID_CHANGE_USER_PASSWORD),
+						Name: kenda.FunctionOperationID_CHANGE_USER_PASSWORD.String(),
+						Routes: []*authorization.ListPermissionsOKBodyDataItems0RoutesItems0{
+							{
+								Method: http.MethodPut,
+								Path:   "/user/change-password",
+							},
+						},
+					},
+				},
+			}),
+		},
+		{
+			name: "no permission",
+			args: args{
+				params: authorization.ListPermissionsParams{
+					HTTPRequest: httpRequestWithHeader,
+				},
+				principal: principal,
+			},
+			hasPermission: func(id kenda.FunctionOperationID, roles []models.Role) bool {
+				return false
+			},
+			want: authorization.NewListPermissionsOK().WithPayload(&authorization.ListPermissionsOKBody{
+				Data: []*authorization.ListPermissionsOKBodyDataItems0{},
+			}),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := NewAuthorization(dm, tt.hasPermission, Config{Sessions: newSessionStore(t), Passwords: newPasswordStore(t)})
+			if got := a.ListPermissions(tt.args.params, tt.args.principal); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ListPermissions() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	assert.NoError(dm.Close())
+}
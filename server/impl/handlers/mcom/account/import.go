@@ -0,0 +1,324 @@
+package account
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/go-openapi/runtime/middleware"
+
+	commonsCtx "gitlab.kenda.com.tw/kenda/commons/v2/utils/context"
+	"gitlab.kenda.com.tw/kenda/mcom"
+	mcomErrors "gitlab.kenda.com.tw/kenda/mcom/errors"
+	mcomRoles "gitlab.kenda.com.tw/kenda/mcom/utils/roles"
+
+	handlerUtils "gitlab.kenda.com.tw/kenda/mui/server/impl/handlers/mcom/utils"
+	"gitlab.kenda.com.tw/kenda/mui/server/impl/utils"
+	"gitlab.kenda.com.tw/kenda/mui/server/protobuf/kenda"
+	"gitlab.kenda.com.tw/kenda/mui/server/swagger/models"
+	"gitlab.kenda.com.tw/kenda/mui/server/swagger/restapi/operations/account"
+)
+
+const (
+	colImportEmployeeID = 0
+	colImportDepartment = 1
+	colImportRoles      = 2
+)
+
+// import actions.
+const (
+	importCreate    = "CREATE"
+	importUpdate    = "UPDATE"
+	importUnchanged = "UNCHANGED"
+)
+
+// importRow is a validated row of the uploaded account file.
+type importRow struct {
+	index      int64
+	employeeID string
+	department string
+	roles      []mcomRoles.Role
+	action     string
+}
+
+// departmentUsers are the users of a department.
+type departmentUsers struct {
+	// found is false if the department does not exist.
+	found        bool
+	authorized   map[string][]mcomRoles.Role
+	unauthorized map[string]struct{}
+}
+
+// ImportAccounts implementations
+func (a Authorization) ImportAccounts(params account.ImportAccountsParams, principal *models.Principal) middleware.Responder {
+	if !a.hasPermission(kenda.FunctionOperationID_IMPORT_ACCOUNTS, principal.Roles) {
+		return account.NewImportAccountsDefault(http.StatusForbidden)
+	}
+	ctx := commonsCtx.WithUserID(params.HTTPRequest.Context(), principal.ID)
+
+	defer params.UploadFile.Close()
+	rows, err := handlerUtils.ReadRows(params.UploadFile, handlerUtils.SheetXLSX, handlerUtils.SheetCSV)
+	if err != nil {
+		return utils.ParseError(ctx, account.NewImportAccountsDefault(0), err)
+	}
+
+	importRows, failData, err := a.parseImportRows(ctx, principal.ID, rows)
+	if err != nil {
+		return utils.ParseError(ctx, account.NewImportAccountsDefault(0), err)
+	}
+
+	data := &account.ImportAccountsOKBodyData{
+		Rows:     toImportRowsItems(importRows),
+		FailData: failData,
+	}
+	// nothing is applied if any row is invalid.
+	if len(failData) > 0 || (params.DryRun != nil && *params.DryRun) {
+		return account.NewImportAccountsOK().WithPayload(&account.ImportAccountsOKBody{Data: data})
+	}
+
+	data.FailData, err = a.applyImportRows(ctx, principal.ID, importRows)
+	if err != nil {
+		return utils.ParseError(ctx, account.NewImportAccountsDefault(0), err)
+	}
+	data.Applied = true
+	return account.NewImportAccountsOK().WithPayload(&account.ImportAccountsOKBody{Data: data})
+}
+
+// parseImportRows validates the rows of the uploaded file and decides whether
+// the account of each row is to be created or updated.
+func (a Authorization) parseImportRows(ctx context.Context, principalID string, rows [][]string) ([]importRow, []*account.ImportAccountsOKBodyDataFailDataItems0, error) {
+	/*
+		excel column name
+		0 row[colImportEmployeeID]	employeeID
+		1 row[colImportDepartment]	departmentID
+		2 row[colImportRoles]		role names separated by commas, e.g. OPERATOR,LEADER
+	*/
+
+	// if file empty
+	if len(rows) <= 1 {
+		return nil, nil, mcomErrors.Error{
+			Code:    mcomErrors.Code_INSUFFICIENT_REQUEST,
+			Details: "file empty",
+		}
+	}
+
+	header := handlerUtils.Row(rows[0])
+	departments := make(map[string]departmentUsers)
+	seen := make(map[string]struct{})
+
+	importRows := []importRow{}
+	failData := []*account.ImportAccountsOKBodyDataFailDataItems0{}
+	for i, r := range rows[1:] {
+		row := handlerUtils.Row(r)
+		index := int64(i + 2)
+		fail := func(details string, columns ...int) {
+			failData = append(failData, &account.ImportAccountsOKBodyDataFailDataItems0{
+				Index:   index,
+				Columns: handlerUtils.BadColumns(header, columns),
+				Details: details,
+			})
+		}
+
+		employeeID := strings.TrimSpace(row.Column(colImportEmployeeID))
+		department := strings.TrimSpace(row.Column(colImportDepartment))
+		if employeeID == "" && department == "" && strings.TrimSpace(row.Column(colImportRoles)) == "" {
+			continue // skip blank rows.
+		}
+
+		var failColumns []int
+		if employeeID == "" {
+			failColumns = append(failColumns, colImportEmployeeID)
+		}
+		if department == "" {
+			failColumns = append(failColumns, colImportDepartment)
+		}
+		roles, ok := parseImportRoles(row.Column(colImportRoles))
+		if !ok {
+			failColumns = append(failColumns, colImportRoles)
+		}
+		if len(failColumns) > 0 {
+			fail("missing or bad values", failColumns...)
+			continue
+		}
+
+		if employeeID == principalID {
+			fail("cannot import the account of the current user", colImportEmployeeID)
+			continue
+		}
+		if _, ok := seen[employeeID]; ok {
+			fail("duplicated employee", colImportEmployeeID)
+			continue
+		}
+		seen[employeeID] = struct{}{}
+
+		users, ok := departments[department]
+		if !ok {
+			var err error
+			if users, err = a.listDepartmentUsers(ctx, department); err != nil {
+				return nil, nil, err
+			}
+			departments[department] = users
+		}
+		if !users.found {
+			fail("department not found", colImportDepartment)
+			continue
+		}
+
+		action := importCreate
+		if current, ok := users.authorized[employeeID]; ok {
+			action = importUpdate
+			if sameRoles(current, roles) {
+				action = importUnchanged
+			}
+		} else if _, ok := users.unauthorized[employeeID]; !ok {
+			fail("employee not found in the department", colImportEmployeeID, colImportDepartment)
+			continue
+		}
+
+		importRows = append(importRows, importRow{
+			index:      index,
+			employeeID: employeeID,
+			department: department,
+			roles:      roles,
+			action:     action,
+		})
+	}
+	return importRows, failData, nil
+}
+
+// applyImportRows creates and updates the accounts one by one, the rows
+// failed by the data manager are returned instead of stopping the import.
+func (a Authorization) applyImportRows(ctx context.Context, principalID string, rows []importRow) ([]*account.ImportAccountsOKBodyDataFailDataItems0, error) {
+	failData := []*account.ImportAccountsOKBodyDataFailDataItems0{}
+	for _, row := range rows {
+		var err error
+		switch row.action {
+		case importCreate:
+			err = a.dm.CreateAccounts(ctx, mcom.CreateAccountsRequest{
+				mcom.CreateAccountRequest{
+					ID:    row.employeeID,
+					Roles: row.roles,
+				}.WithDefaultPassword(),
+			})
+		case importUpdate:
+			err = a.dm.UpdateAccount(ctx, mcom.UpdateAccountRequest{
+				UserID: row.employeeID,
+				Roles:  row.roles,
+			})
+		default:
+			continue
+		}
+		if err != nil {
+			e, ok := mcomErrors.As(err)
+			if !ok {
+				return nil, err
+			}
+			failData = append(failData, &account.ImportAccountsOKBodyDataFailDataItems0{
+				Index:   row.index,
+				Columns: []string{},
+				Details: e.Details,
+			})
+			continue
+		}
+
+		if row.action == importCreate {
+			// the default password has to be changed at the first login.
+			if err := a.requirePasswordChange(ctx, row.employeeID); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		// the roles of the signed in tokens are out of date.
+		if err := a.revokeSessions(ctx, row.employeeID, principalID); err != nil {
+			return nil, err
+		}
+	}
+	return failData, nil
+}
+
+func (a Authorization) listDepartmentUsers(ctx context.Context, department string) (departmentUsers, error) {
+	authorized, err := a.dm.ListUserRoles(ctx, mcom.ListUserRolesRequest{
+		DepartmentID: department,
+	})
+	if err != nil {
+		if e, ok := mcomErrors.As(err); ok && e.Code == mcomErrors.Code_DEPARTMENT_NOT_FOUND {
+			return departmentUsers{}, nil
+		}
+		return departmentUsers{}, err
+	}
+	unauthorized, err := a.dm.ListUnauthorizedUsers(ctx, mcom.ListUnauthorizedUsersRequest{
+		DepartmentID: department,
+	})
+	if err != nil {
+		return departmentUsers{}, err
+	}
+
+	users := departmentUsers{
+		found:        true,
+		authorized:   make(map[string][]mcomRoles.Role, len(authorized.Users)),
+		unauthorized: make(map[string]struct{}, len(unauthorized)),
+	}
+	for _, user := range authorized.Users {
+		users.authorized[user.ID] = user.Roles
+	}
+	for _, user := range unauthorized {
+		users.unauthorized[user] = struct{}{}
+	}
+	return users, nil
+}
+
+// parseImportRoles parses the role names separated by commas or spaces.
+func parseImportRoles(s string) ([]mcomRoles.Role, bool) {
+	names := strings.FieldsFunc(s, func(r rune) bool {
+		return r == ',' || r == '、' || r == ' '
+	})
+	if len(names) == 0 {
+		return nil, false
+	}
+
+	roles := make([]mcomRoles.Role, 0, len(names))
+	exists := make(map[mcomRoles.Role]struct{}, len(names))
+	for _, name := range names {
+		value, ok := mcomRoles.Role_value[strings.ToUpper(name)]
+		if !ok {
+			return nil, false
+		}
+		role := mcomRoles.Role(value)
+		if _, ok := exists[role]; ok {
+			continue
+		}
+		exists[role] = struct{}{}
+		roles = append(roles, role)
+	}
+	return roles, true
+}
+
+func sameRoles(a, b []mcomRoles.Role) bool {
+	set := make(map[mcomRoles.Role]struct{}, len(a))
+	for _, role := range a {
+		set[role] = struct{}{}
+	}
+	if len(set) != len(b) {
+		return false
+	}
+	for _, role := range b {
+		if _, ok := set[role]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func toImportRowsItems(rows []importRow) []*account.ImportAccountsOKBodyDataRowsItems0 {
+	items := make([]*account.ImportAccountsOKBodyDataRowsItems0, len(rows))
+	for i, row := range rows {
+		items[i] = &account.ImportAccountsOKBodyDataRowsItems0{
+			Index:        row.index,
+			EmployeeID:   row.employeeID,
+			DepartmentID: row.department,
+			Roles:        handlerUtils.ToModelsRoles(row.roles),
+			Action:       row.action,
+		}
+	}
+	return items
+}
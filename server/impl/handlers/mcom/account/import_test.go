@@ -0,0 +1,321 @@
+package account
+
+import (
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-openapi/runtime"
+	"github.com/stretchr/testify/assert"
+
+	"gitlab.kenda.com.tw/kenda/mcom"
+	mcomErrors "gitlab.kenda.com.tw/kenda/mcom/errors"
+	"gitlab.kenda.com.tw/kenda/mcom/mock"
+	mcomRoles "gitlab.kenda.com.tw/kenda/mcom/utils/roles"
+
+	"gitlab.kenda.com.tw/kenda/mui/server/database/storetest"
+	"gitlab.kenda.com.tw/kenda/mui/server/impl/handlers/mcom/utils"
+	"gitlab.kenda.com.tw/kenda/mui/server/protobuf/kenda"
+	"gitlab.kenda.com.tw/kenda/mui/server/swagger/models"
+	authorization "gitlab.kenda.com.tw/kenda/mui/server/swagger/restapi/operations/account"
+)
+
+const testImportHeader = "employeeID,department,roles\n"
+
+func newImportAccountsParams(file string, dryRun bool) authorization.ImportAccountsParams {
+	return authorization.ImportAccountsParams{
+		HTTPRequest: httptest.NewRequest(http.MethodPost, "/account/authorization/upload", nil),
+		UploadFile:  uploadFile("accounts.csv", file),
+		DryRun:      &dryRun,
+	}
+}
+
+type memFile struct {
+	*strings.Reader
+}
+
+func (memFile) Close() error {
+	return nil
+}
+
+func uploadFile(name, content string) *runtime.File {
+	return &runtime.File{
+		Data:   memFile{strings.NewReader(content)},
+		Header: &multipart.FileHeader{Filename: name},
+	}
+}
+
+func departmentScripts(department string) []mock.Script {
+	return []mock.Script{
+		{
+			Name: mock.FuncListUserRoles,
+			Input: mock.Input{
+				Request: mcom.ListUserRolesRequest{
+					DepartmentID: department,
+				},
+			},
+			Output: mock.Output{
+				Response: mcom.ListUserRolesReply{
+					Users: []mcom.UserRoles{
+						{
+							ID:    testUsernameDan,
+							Roles: testDanRoles,
+						},
+						{
+							ID:    testUsernameSpencer,
+							Roles: testSpencerRoles,
+						},
+					},
+				},
+			},
+		},
+		{
+			Name: mock.FuncListUnauthorizedUsers,
+			Input: mock.Input{
+				Request: mcom.ListUnauthorizedUsersRequest{
+					DepartmentID: department,
+				},
+			},
+			Output: mock.Output{
+				Response: mcom.ListUnauthorizedUsersReply([]string{"kevin", "amy"}),
+			},
+		},
+	}
+}
+
+func TestAuthorization_ImportAccounts(t *testing.T) {
+	assert := assert.New(t)
+
+	user := &models.Principal{ID: "tester"}
+	file := testImportHeader +
+		testUsernameDan + "," + testDepartmentOID + ",\"INSPECTOR, QUALITY_CONTROLLER\"\n" +
+		testUsernameSpencer + "," + testDepartmentOID + ",OPERATOR\n" +
+		",,\n" +
+		"kevin," + testDepartmentOID + ",operator\n" +
+		"amy," + testDepartmentOID + ",LEADER\n"
+	rows := []*authorization.ImportAccountsOKBodyDataRowsItems0{
+		{
+			Index:        2,
+			EmployeeID:   testUsernameDan,
+			DepartmentID: testDepartmentOID,
+			Roles:        utils.ToModelsRoles(testDanRoles),
+			Action:       importUnchanged,
+		},
+		{
+			Index:        3,
+			EmployeeID:   testUsernameSpencer,
+			DepartmentID: testDepartmentOID,
+			Roles:        utils.ToModelsRoles([]mcomRoles.Role{mcomRoles.Role_OPERATOR}),
+			Action:       importUpdate,
+		},
+		{
+			Index:        5,
+			EmployeeID:   "kevin",
+			DepartmentID: testDepartmentOID,
+			Roles:        utils.ToModelsRoles([]mcomRoles.Role{mcomRoles.Role_OPERATOR}),
+			Action:       importCreate,
+		},
+		{
+			Index:        6,
+			EmployeeID:   "amy",
+			DepartmentID: testDepartmentOID,
+			Roles:        utils.ToModelsRoles([]mcomRoles.Role{mcomRoles.Role_LEADER}),
+			Action:       importCreate,
+		},
+	}
+
+	scripts := departmentScripts(testDepartmentOID)
+	scripts = append(scripts, departmentScripts(testDepartmentOID)...)
+	scripts = append(scripts,
+		mock.Script{
+			Name: mock.FuncUpdateAccount,
+			Input: mock.Input{
+				Request: mcom.UpdateAccountRequest{
+					UserID: testUsernameSpencer,
+					Roles:  []mcomRoles.Role{mcomRoles.Role_OPERATOR},
+				},
+			},
+			Output: mock.Output{
+				Error: mcomErrors.Error{
+					Code:    mcomErrors.Code_RECORD_NOT_FOUND,
+					Details: "account not found",
+				},
+			},
+		},
+		mock.Script{
+			Name: mock.FuncCreateAccounts,
+			Input: mock.Input{
+				Request: mcom.CreateAccountsRequest{
+					mcom.CreateAccountRequest{
+						ID:    "kevin",
+						Roles: []mcomRoles.Role{mcomRoles.Role_OPERATOR},
+					}.WithDefaultPassword(),
+				},
+			},
+			Output: mock.Output{},
+		},
+		// the failed creation does not stop the others.
+		mock.Script{
+			Name: mock.FuncCreateAccounts,
+			Input: mock.Input{
+				Request: mcom.CreateAccountsRequest{
+					mcom.CreateAccountRequest{
+						ID:    "amy",
+						Roles: []mcomRoles.Role{mcomRoles.Role_LEADER},
+					}.WithDefaultPassword(),
+				},
+			},
+			Output: mock.Output{
+				Error: mcomErrors.Error{
+					Code:    mcomErrors.Code_RECORD_ALREADY_EXISTS,
+					Details: "account existed",
+				},
+			},
+		},
+	)
+	dm, err := mock.New(scripts)
+	assert.NoError(err)
+
+	stores := storetest.New(t)
+	a := NewAuthorization(dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
+		return true
+	}, Config{
+		Sessions:  stores.Sessions,
+		Passwords: stores.Passwords,
+	})
+
+	// dry run.
+	assert.Equal(authorization.NewImportAccountsOK().WithPayload(&authorization.ImportAccountsOKBody{
+		Data: &authorization.ImportAccountsOKBodyData{
+			Applied:  false,
+			Rows:     rows,
+			FailData: []*authorization.ImportAccountsOKBodyDataFailDataItems0{},
+		},
+	}), a.ImportAccounts(newImportAccountsParams(file, true), user))
+	assert.Empty(listPasswords(t, stores.DB))
+
+	// apply.
+	assert.Equal(authorization.NewImportAccountsOK().WithPayload(&authorization.ImportAccountsOKBody{
+		Data: &authorization.ImportAccountsOKBodyData{
+			Applied: true,
+			Rows:    rows,
+			FailData: []*authorization.ImportAccountsOKBodyDataFailDataItems0{
+				{
+					Index:   3,
+					Columns: []string{},
+					Details: "account not found",
+				},
+				{
+					Index:   6,
+					Columns: []string{},
+					Details: "account existed",
+				},
+			},
+		},
+	}), a.ImportAccounts(newImportAccountsParams(file, false), user))
+	if records := listPasswords(t, stores.DB); assert.Len(records, 1) {
+		assert.Equal("kevin", records[0].UserID)
+		assert.True(records[0].MustChange)
+	}
+}
+
+func TestAuthorization_ImportAccountsFailData(t *testing.T) {
+	assert := assert.New(t)
+
+	user := &models.Principal{ID: "tester"}
+	scripts := []mock.Script{
+		{
+			Name: mock.FuncListUserRoles,
+			Input: mock.Input{
+				Request: mcom.ListUserRolesRequest{
+					DepartmentID: "X9999",
+				},
+			},
+			Output: mock.Output{
+				Error: mcomErrors.Error{
+					Code: mcomErrors.Code_DEPARTMENT_NOT_FOUND,
+				},
+			},
+		},
+	}
+	scripts = append(scripts, departmentScripts(testDepartmentOID)...)
+	dm, err := mock.New(scripts)
+	assert.NoError(err)
+
+	a := NewAuthorization(dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
+		return true
+	}, Config{
+		Sessions:  newSessionStore(t),
+		Passwords: newPasswordStore(t),
+	})
+
+	file := testImportHeader +
+		testUsernameDan + "," + testDepartmentOID + ",ROOT\n" +
+		",,OPERATOR\n" +
+		"kevin,X9999,OPERATOR\n" +
+		"nobody," + testDepartmentOID + ",OPERATOR\n" +
+		"tester," + testDepartmentOID + ",OPERATOR\n" +
+		"kevin," + testDepartmentOID + ",OPERATOR\n" +
+		testUsernameSpencer + "," + testDepartmentOID + ",OPERATOR\n"
+	assert.Equal(authorization.NewImportAccountsOK().WithPayload(&authorization.ImportAccountsOKBody{
+		Data: &authorization.ImportAccountsOKBodyData{
+			Applied: false,
+			Rows: []*authorization.ImportAccountsOKBodyDataRowsItems0{
+				{
+					Index:        8,
+					EmployeeID:   testUsernameSpencer,
+					DepartmentID: testDepartmentOID,
+					Roles:        utils.ToModelsRoles([]mcomRoles.Role{mcomRoles.Role_OPERATOR}),
+					Action:       importUpdate,
+				},
+			},
+			FailData: []*authorization.ImportAccountsOKBodyDataFailDataItems0{
+				{
+					Index:   2,
+					Columns: []string{"C(roles)"},
+					Details: "missing or bad values",
+				},
+				{
+					Index:   3,
+					Columns: []string{"A(employeeID)", "B(department)"},
+					Details: "missing or bad values",
+				},
+				{
+					Index:   4,
+					Columns: []string{"B(department)"},
+					Details: "department not found",
+				},
+				{
+					Index:   5,
+					Columns: []string{"A(employeeID)", "B(department)"},
+					Details: "employee not found in the department",
+				},
+				{
+					Index:   6,
+					Columns: []string{"A(employeeID)"},
+					Details: "cannot import the account of the current user",
+				},
+				{
+					Index:   7,
+					Columns: []string{"A(employeeID)"},
+					Details: "duplicated employee",
+				},
+			},
+		},
+	}), a.ImportAccounts(newImportAccountsParams(file, false), user))
+
+	// empty file.
+	assert.Equal(authorization.NewImportAccountsDefault(http.StatusBadRequest).WithPayload(&models.Error{
+		Code:    int64(mcomErrors.Code_INSUFFICIENT_REQUEST),
+		Details: "file empty",
+	}), a.ImportAccounts(newImportAccountsParams(testImportHeader, false), user))
+
+	// forbidden.
+	a = NewAuthorization(dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
+		return false
+	}, Config{})
+	assert.Equal(authorization.NewImportAccountsDefault(http.StatusForbidden),
+		a.ImportAccounts(newImportAccountsParams(testImportHeader, false), user))
+}
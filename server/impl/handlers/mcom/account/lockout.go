@@ -0,0 +1,158 @@
+package account
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/go-openapi/runtime/middleware"
+	"github.com/go-openapi/strfmt"
+	"go.uber.org/zap"
+
+	commonsCtx "gitlab.kenda.com.tw/kenda/commons/v2/utils/context"
+
+	"gitlab.kenda.com.tw/kenda/mui/server/database"
+	"gitlab.kenda.com.tw/kenda/mui/server/impl/utils"
+	"gitlab.kenda.com.tw/kenda/mui/server/impl/utils/lockout"
+	"gitlab.kenda.com.tw/kenda/mui/server/protobuf/kenda"
+	"gitlab.kenda.com.tw/kenda/mui/server/swagger/models"
+	"gitlab.kenda.com.tw/kenda/mui/server/swagger/restapi/operations/account"
+)
+
+// defaultLockoutEventsPeriod is the period of the lockout events listed if
+// the start time is not specified.
+const defaultLockoutEventsPeriod = 7 * 24 * time.Hour
+
+// ListLoginLockouts implementations
+func (a Authorization) ListLoginLockouts(params account.ListLoginLockoutsParams, principal *models.Principal) middleware.Responder {
+	if !a.hasPermission(kenda.FunctionOperationID_LIST_LOGIN_LOCKOUTS, principal.Roles) {
+		return account.NewListLoginLockoutsDefault(http.StatusForbidden)
+	}
+
+	ctx := commonsCtx.WithUserID(params.HTTPRequest.Context(), principal.ID)
+	lockouts, err := a.config.Lockouts.Lockouts(ctx)
+	if err != nil {
+		return utils.ParseError(ctx, account.NewListLoginLockoutsDefault(0), err)
+	}
+	data := make([]*account.ListLoginLockoutsOKBodyDataItems0, len(lockouts))
+	for i, l := range lockouts {
+		data[i] = &account.ListLoginLockoutsOKBodyDataItems0{
+			Type:        string(l.Kind),
+			Target:      l.Target,
+			Failures:    int64(l.Failures),
+			LockedUntil: strfmt.DateTime(l.LockedUntil),
+		}
+	}
+	return account.NewListLoginLockoutsOK().WithPayload(&account.ListLoginLockoutsOKBody{Data: data})
+}
+
+// UnlockLoginLockout implementations
+func (a Authorization) UnlockLoginLockout(params account.UnlockLoginLockoutParams, principal *models.Principal) middleware.Responder {
+	if !a.hasPermission(kenda.FunctionOperationID_UNLOCK_LOGIN_LOCKOUT, principal.Roles) {
+		return account.NewUnlockLoginLockoutDefault(http.StatusForbidden)
+	}
+
+	ctx := commonsCtx.WithUserID(params.HTTPRequest.Context(), principal.ID)
+	l, ok, err := a.config.Lockouts.Unlock(ctx, lockout.Key{
+		Kind:   lockout.Kind(params.Type),
+		Target: params.Target,
+	})
+	if err != nil {
+		return utils.ParseError(ctx, account.NewUnlockLoginLockoutDefault(0), err)
+	}
+	if !ok {
+		return account.NewUnlockLoginLockoutOK()
+	}
+
+	zap.L().Info("login lockout unlocked",
+		zap.String("type", string(l.Kind)),
+		zap.String("target", l.Target),
+		zap.String("by", principal.ID))
+	if err := a.config.LockoutEvents.CreateLockoutEvent(ctx, database.LockoutEvent{
+		Kind:        string(l.Kind),
+		Target:      l.Target,
+		Action:      database.LockoutUnlocked,
+		Failures:    l.Failures,
+		LockedUntil: &l.LockedUntil,
+		CreatedBy:   principal.ID,
+	}); err != nil {
+		return utils.ParseError(ctx, account.NewUnlockLoginLockoutDefault(0), err)
+	}
+	return account.NewUnlockLoginLockoutOK()
+}
+
+// ListLockoutEvents implementations
+func (a Authorization) ListLockoutEvents(params account.ListLockoutEventsParams, principal *models.Principal) middleware.Responder {
+	if !a.hasPermission(kenda.FunctionOperationID_LIST_LOGIN_LOCKOUTS, principal.Roles) {
+		return account.NewListLockoutEventsDefault(http.StatusForbidden)
+	}
+
+	ctx := commonsCtx.WithUserID(params.HTTPRequest.Context(), principal.ID)
+	since := time.Now().Add(-defaultLockoutEventsPeriod)
+	if params.Since != nil {
+		since = time.Time(*params.Since)
+	}
+	events, err := a.config.LockoutEvents.ListLockoutEvents(ctx, since)
+	if err != nil {
+		return utils.ParseError(ctx, account.NewListLockoutEventsDefault(0), err)
+	}
+
+	data := make([]*account.ListLockoutEventsOKBodyDataItems0, len(events))
+	for i, event := range events {
+		var lockedUntil *strfmt.DateTime
+		if event.LockedUntil != nil {
+			t := strfmt.DateTime(*event.LockedUntil)
+			lockedUntil = &t
+		}
+		data[i] = &account.ListLockoutEventsOKBodyDataItems0{
+			Type:        event.Kind,
+			Target:      event.Target,
+			Action:      string(event.Action),
+			Failures:    int64(event.Failures),
+			LockedUntil: lockedUntil,
+			CreatedBy:   event.CreatedBy,
+			CreatedAt:   strfmt.DateTime(event.CreatedAt),
+		}
+	}
+	return account.NewListLockoutEventsOK().WithPayload(&account.ListLockoutEventsOKBody{Data: data})
+}
+
+// loginBlocked returns the response of a login rejected by the lockout tracker.
+func loginBlocked(err error) middleware.Responder {
+	r := account.NewLoginTooManyRequests().WithPayload(&models.Error{
+		Details: err.Error(),
+	})
+	if e, ok := err.(lockout.BlockedError); ok {
+		r = r.WithRetryAfter(int64(math.Ceil(e.RetryAfter.Seconds())))
+	}
+	return r
+}
+
+// loginFailed records the failed login and the audit entries of the lockouts
+// caused by it, the login response is not affected if it fails.
+func (a Authorization) loginFailed(ctx context.Context, userID, ip string) {
+	lockouts, err := a.config.Lockouts.Fail(ctx, userID, ip)
+	if err != nil {
+		zap.L().Error("failed to record login failure", zap.String("user", userID), zap.Error(err))
+		return
+	}
+	for _, l := range lockouts {
+		zap.L().Warn("login locked",
+			zap.String("type", string(l.Kind)),
+			zap.String("target", l.Target),
+			zap.Int("failures", l.Failures),
+			zap.Time("until", l.LockedUntil))
+
+		lockedUntil := l.LockedUntil
+		if err := a.config.LockoutEvents.CreateLockoutEvent(ctx, database.LockoutEvent{
+			Kind:        string(l.Kind),
+			Target:      l.Target,
+			Action:      database.LockoutLocked,
+			Failures:    l.Failures,
+			LockedUntil: &lockedUntil,
+		}); err != nil {
+			zap.L().Error("failed to create lockout event", zap.Error(err))
+		}
+	}
+}
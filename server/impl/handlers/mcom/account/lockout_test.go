@@ -0,0 +1,337 @@
+package account
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-openapi/strfmt"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+
+	"gitlab.kenda.com.tw/kenda/mcom"
+	mcomErrors "gitlab.kenda.com.tw/kenda/mcom/errors"
+	"gitlab.kenda.com.tw/kenda/mcom/mock"
+
+	"gitlab.kenda.com.tw/kenda/mui/server/database"
+	"gitlab.kenda.com.tw/kenda/mui/server/database/dbtest"
+	"gitlab.kenda.com.tw/kenda/mui/server/database/storetest"
+	"gitlab.kenda.com.tw/kenda/mui/server/impl/utils/lockout"
+	"gitlab.kenda.com.tw/kenda/mui/server/protobuf/kenda"
+	"gitlab.kenda.com.tw/kenda/mui/server/swagger/models"
+	authorization "gitlab.kenda.com.tw/kenda/mui/server/swagger/restapi/operations/account"
+)
+
+// listLockoutEvents lists the lockout events in the order of creation.
+func listLockoutEvents(t *testing.T, db *gorm.DB) []database.LockoutEvent {
+	var events []database.LockoutEvent
+	if err := db.Order("id").Find(&events).Error; err != nil {
+		t.Fatal(err)
+	}
+	return events
+}
+
+// newClosedLockoutEventStore returns a LockoutEventStore whose database is
+// closed.
+func newClosedLockoutEventStore(t *testing.T) database.LockoutEventStore {
+	stores := storetest.New(t)
+	stores.Close(t)
+	return stores.LockoutEvents
+}
+
+func newLockoutTracker(t *testing.T, config lockout.Config) *lockout.Tracker {
+	store, err := database.NewLoginFailureStore(dbtest.Open(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return lockout.NewTracker(config, store)
+}
+
+func TestAuthorization_LoginLockout(t *testing.T) {
+	assert := assert.New(t)
+
+	user, pass := "tester", "p4s5w0rd"
+	dm, err := mock.New([]mock.Script{
+		{
+			Name: mock.FuncSignIn,
+			Input: mock.Input{
+				Request: mcom.SignInRequest{
+					Account:  user,
+					Password: pass,
+				},
+			},
+			Output: mock.Output{
+				Error: mcomErrors.Error{
+					Code: mcomErrors.Code_ACCOUNT_NOT_FOUND_OR_BAD_PASSWORD,
+				},
+			},
+		},
+		{ // after unlocked.
+			Name: mock.FuncSignIn,
+			Input: mock.Input{
+				Request: mcom.SignInRequest{
+					Account:  user,
+					Password: pass,
+				},
+			},
+			Output: mock.Output{
+				Response: mcom.SignInReply{
+					Token:       tokenFor + user,
+					TokenExpiry: tokenExpiry,
+					Departments: departments,
+					Roles:       roles,
+				},
+			},
+		},
+	})
+	assert.NoError(err)
+
+	stores := storetest.New(t)
+	a := NewAuthorization(dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
+		return true
+	}, Config{
+		Sessions:  stores.Sessions,
+		Passwords: stores.Passwords,
+		Lockouts: newLockoutTracker(t, lockout.Config{
+			MaxAccountFailures: 1,
+			LockoutDuration:    time.Hour,
+		}),
+		LockoutEvents: stores.LockoutEvents,
+	})
+
+	loginParams := authorization.LoginParams{
+		HTTPRequest: httptest.NewRequest(http.MethodPost, "/user/login", nil),
+		Body: &models.LoginRequest{
+			ID:        &user,
+			Password:  &pass,
+			LoginType: &loginType,
+		},
+	}
+	loginParams.HTTPRequest.RemoteAddr = "10.1.1.1:51234"
+
+	// bad password.
+	_, ok := a.Login(loginParams).(*authorization.LoginBadRequest)
+	assert.True(ok)
+	events := listLockoutEvents(t, stores.DB)
+	if assert.Len(events, 1) {
+		assert.Equal(string(lockout.KindAccount), events[0].Kind)
+		assert.Equal(user, events[0].Target)
+		assert.Equal(database.LockoutLocked, events[0].Action)
+		assert.Equal(1, events[0].Failures)
+		assert.NotNil(events[0].LockedUntil)
+		assert.Empty(events[0].CreatedBy)
+	}
+
+	// locked, the data manager is not called.
+	r, ok := a.Login(loginParams).(*authorization.LoginTooManyRequests)
+	if assert.True(ok) {
+		assert.Equal(int64(time.Hour/time.Second), r.RetryAfter)
+		assert.Contains(r.Payload.Details, "ACCOUNT tester is locked")
+	}
+
+	// list lockouts.
+	listResponse, ok := a.ListLoginLockouts(authorization.ListLoginLockoutsParams{
+		HTTPRequest: httptest.NewRequest(http.MethodGet, "/account/lockouts", nil),
+	}, principal).(*authorization.ListLoginLockoutsOK)
+	if assert.True(ok) && assert.Len(listResponse.Payload.Data, 1) {
+		assert.Equal(&authorization.ListLoginLockoutsOKBodyDataItems0{
+			Type:        string(lockout.KindAccount),
+			Target:      user,
+			Failures:    1,
+			LockedUntil: strfmt.DateTime(*events[0].LockedUntil),
+		}, listResponse.Payload.Data[0])
+	}
+
+	// unlock.
+	assert.Equal(authorization.NewUnlockLoginLockoutOK(), a.UnlockLoginLockout(authorization.UnlockLoginLockoutParams{
+		HTTPRequest: httptest.NewRequest(http.MethodDelete, "/account/lockouts/ACCOUNT/tester", nil),
+		Type:        string(lockout.KindAccount),
+		Target:      user,
+	}, principal))
+	events = listLockoutEvents(t, stores.DB)
+	if assert.Len(events, 2) {
+		assert.Equal(database.LockoutUnlocked, events[1].Action)
+		assert.Equal(principal.ID, events[1].CreatedBy)
+	}
+
+	// unlock again, nothing happens.
+	assert.Equal(authorization.NewUnlockLoginLockoutOK(), a.UnlockLoginLockout(authorization.UnlockLoginLockoutParams{
+		HTTPRequest: httptest.NewRequest(http.MethodDelete, "/account/lockouts/ACCOUNT/tester", nil),
+		Type:        string(lockout.KindAccount),
+		Target:      user,
+	}, principal))
+	assert.Len(listLockoutEvents(t, stores.DB), 2)
+
+	// login after unlocked.
+	_, ok = a.Login(loginParams).(*authorization.LoginOK)
+	assert.True(ok)
+	assert.NoError(dm.Close())
+}
+
+func TestAuthorization_UnlockLoginLockout(t *testing.T) {
+	assert := assert.New(t)
+	dm, err := mock.New([]mock.Script{})
+	assert.NoError(err)
+
+	ctx := context.Background()
+	tracker := newLockoutTracker(t, lockout.Config{MaxIPFailures: 1})
+	params := authorization.UnlockLoginLockoutParams{
+		HTTPRequest: httptest.NewRequest(http.MethodDelete, "/account/lockouts/IP/10.1.1.1", nil),
+		Type:        string(lockout.KindIP),
+		Target:      "10.1.1.1",
+	}
+
+	{ // internal error.
+		_, err := tracker.Fail(ctx, testUsernameDan, "10.1.1.1")
+		assert.NoError(err)
+		a := NewAuthorization(dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
+			return true
+		}, Config{Lockouts: tracker, LockoutEvents: newClosedLockoutEventStore(t)})
+		assert.Equal(authorization.NewUnlockLoginLockoutDefault(http.StatusInternalServerError).WithPayload(&models.Error{
+			Details: "sql: database is closed",
+		}), a.UnlockLoginLockout(params, principal))
+		assert.NoError(tracker.Check(ctx, testUsernameSpencer, "10.1.1.1"))
+	}
+	{ // forbidden.
+		_, err := tracker.Fail(ctx, testUsernameDan, "10.1.1.1")
+		assert.NoError(err)
+		a := NewAuthorization(dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
+			return false
+		}, Config{Lockouts: tracker, LockoutEvents: storetest.New(t).LockoutEvents})
+		assert.Equal(authorization.NewUnlockLoginLockoutDefault(http.StatusForbidden), a.UnlockLoginLockout(params, principal))
+		assert.Error(tracker.Check(ctx, testUsernameSpencer, "10.1.1.1"))
+	}
+	assert.NoError(dm.Close())
+}
+
+func TestAuthorization_ListLoginLockouts(t *testing.T) {
+	assert := assert.New(t)
+	dm, err := mock.New([]mock.Script{})
+	assert.NoError(err)
+
+	{ // no lockout.
+		a := NewAuthorization(dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
+			return true
+		}, Config{Lockouts: newLockoutTracker(t, lockout.Config{})})
+		assert.Equal(authorization.NewListLoginLockoutsOK().WithPayload(&authorization.ListLoginLockoutsOKBody{
+			Data: []*authorization.ListLoginLockoutsOKBodyDataItems0{},
+		}), a.ListLoginLockouts(authorization.ListLoginLockoutsParams{
+			HTTPRequest: httptest.NewRequest(http.MethodGet, "/account/lockouts", nil),
+		}, principal))
+	}
+	{ // forbidden.
+		a := NewAuthorization(dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
+			return false
+		}, Config{Lockouts: newLockoutTracker(t, lockout.Config{})})
+		assert.Equal(authorization.NewListLoginLockoutsDefault(http.StatusForbidden), a.ListLoginLockouts(authorization.ListLoginLockoutsParams{
+			HTTPRequest: httptest.NewRequest(http.MethodGet, "/account/lockouts", nil),
+		}, principal))
+	}
+	assert.NoError(dm.Close())
+}
+
+func TestAuthorization_ListLockoutEvents(t *testing.T) {
+	assert := assert.New(t)
+	dm, err := mock.New([]mock.Script{})
+	assert.NoError(err)
+
+	now := time.Now().UTC()
+	lockedUntil := now.Add(time.Hour)
+	events := storetest.New(t).LockoutEvents
+	for _, event := range []database.LockoutEvent{
+		{
+			ID:          1,
+			Kind:        string(lockout.KindIP),
+			Target:      "10.1.1.1",
+			Action:      database.LockoutLocked,
+			Failures:    50,
+			LockedUntil: &lockedUntil,
+			CreatedAt:   now.Add(-8 * 24 * time.Hour),
+		},
+		{
+			ID:          2,
+			Kind:        string(lockout.KindAccount),
+			Target:      testUsernameDan,
+			Action:      database.LockoutLocked,
+			Failures:    5,
+			LockedUntil: &lockedUntil,
+			CreatedAt:   now.Add(-time.Minute),
+		},
+		{
+			ID:          3,
+			Kind:        string(lockout.KindAccount),
+			Target:      testUsernameDan,
+			Action:      database.LockoutUnlocked,
+			Failures:    5,
+			LockedUntil: &lockedUntil,
+			CreatedBy:   principal.ID,
+			CreatedAt:   now,
+		},
+	} {
+		assert.NoError(events.CreateLockoutEvent(context.Background(), event))
+	}
+	until := strfmt.DateTime(lockedUntil)
+
+	{ // the last 7 days by default.
+		a := NewAuthorization(dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
+			return true
+		}, Config{LockoutEvents: events})
+		assert.Equal(authorization.NewListLockoutEventsOK().WithPayload(&authorization.ListLockoutEventsOKBody{
+			Data: []*authorization.ListLockoutEventsOKBodyDataItems0{
+				{
+					Type:        string(lockout.KindAccount),
+					Target:      testUsernameDan,
+					Action:      string(database.LockoutUnlocked),
+					Failures:    5,
+					LockedUntil: &until,
+					CreatedBy:   principal.ID,
+					CreatedAt:   strfmt.DateTime(now),
+				},
+				{
+					Type:        string(lockout.KindAccount),
+					Target:      testUsernameDan,
+					Action:      string(database.LockoutLocked),
+					Failures:    5,
+					LockedUntil: &until,
+					CreatedAt:   strfmt.DateTime(now.Add(-time.Minute)),
+				},
+			},
+		}), a.ListLockoutEvents(authorization.ListLockoutEventsParams{
+			HTTPRequest: httptest.NewRequest(http.MethodGet, "/account/lockout-events", nil),
+		}, principal))
+	}
+	{ // since.
+		a := NewAuthorization(dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
+			return true
+		}, Config{LockoutEvents: events})
+		since := strfmt.DateTime(now)
+		r, ok := a.ListLockoutEvents(authorization.ListLockoutEventsParams{
+			HTTPRequest: httptest.NewRequest(http.MethodGet, "/account/lockout-events", nil),
+			Since:       &since,
+		}, principal).(*authorization.ListLockoutEventsOK)
+		if assert.True(ok) {
+			assert.Len(r.Payload.Data, 1)
+		}
+	}
+	{ // internal error.
+		a := NewAuthorization(dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
+			return true
+		}, Config{LockoutEvents: newClosedLockoutEventStore(t)})
+		assert.Equal(authorization.NewListLockoutEventsDefault(http.StatusInternalServerError).WithPayload(&models.Error{
+			Details: "sql: database is closed",
+		}), a.ListLockoutEvents(authorization.ListLockoutEventsParams{
+			HTTPRequest: httptest.NewRequest(http.MethodGet, "/account/lockout-events", nil),
+		}, principal))
+	}
+	{ // forbidden.
+		a := NewAuthorization(dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
+			return false
+		}, Config{LockoutEvents: events})
+		assert.Equal(authorization.NewListLockoutEventsDefault(http.StatusForbidden), a.ListLockoutEvents(authorization.ListLockoutEventsParams{
+			HTTPRequest: httptest.NewRequest(http.MethodGet, "/account/lockout-events", nil),
+		}, principal))
+	}
+	assert.NoError(dm.Close())
+}
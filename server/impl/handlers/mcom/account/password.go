@@ -0,0 +1,82 @@
+package account
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+
+	mcomErrors "gitlab.kenda.com.tw/kenda/mcom/errors"
+
+	"gitlab.kenda.com.tw/kenda/mui/server/database"
+	"gitlab.kenda.com.tw/kenda/mui/server/impl/utils/password"
+)
+
+const passwordReusedError = "the password has been used recently"
+
+// checkNewPassword returns an error if the new password does not comply with
+// the password policy or has been used recently.
+func (a Authorization) checkNewPassword(ctx context.Context, userID, currentPassword, newPassword string) error {
+	policy := a.config.PasswordPolicy
+	if err := policy.Validate(newPassword); err != nil {
+		return err
+	}
+	if policy.History <= 0 {
+		return nil
+	}
+
+	if newPassword == currentPassword {
+		return mcomErrors.Error{Code: mcomErrors.Code_BAD_REQUEST, Details: passwordReusedError}
+	}
+	records, err := a.config.Passwords.ListPasswords(ctx, userID, policy.History)
+	if err != nil {
+		return err
+	}
+	for _, record := range records {
+		if record.Hash != "" && password.Matches(record.Hash, newPassword) {
+			return mcomErrors.Error{Code: mcomErrors.Code_BAD_REQUEST, Details: passwordReusedError}
+		}
+	}
+	return nil
+}
+
+// recordPassword adds the password of the user to the password history.
+func (a Authorization) recordPassword(ctx context.Context, userID, pwd string) error {
+	hash, err := password.Hash(pwd)
+	if err != nil {
+		return err
+	}
+	return a.config.Passwords.AddPassword(ctx, database.PasswordRecord{
+		UserID:    userID,
+		Hash:      hash,
+		CreatedAt: time.Now(),
+	})
+}
+
+// requirePasswordChange records that the user has the default password which
+// has to be changed at the next login.
+func (a Authorization) requirePasswordChange(ctx context.Context, userID string) error {
+	return a.config.Passwords.AddPassword(ctx, database.PasswordRecord{
+		UserID:     userID,
+		MustChange: true,
+		CreatedAt:  time.Now(),
+	})
+}
+
+// isPasswordExpired reports whether the user signed in with the password has
+// to change it. The age of the password is counted from the first login if it
+// has no history, and the login is not interrupted by the errors.
+func (a Authorization) isPasswordExpired(ctx context.Context, userID, pwd string) bool {
+	records, err := a.config.Passwords.ListPasswords(ctx, userID, 1)
+	if err != nil {
+		zap.L().Error("failed to list password history", zap.String("user", userID), zap.Error(err))
+		return false
+	}
+	if len(records) == 0 {
+		if err := a.recordPassword(ctx, userID, pwd); err != nil {
+			zap.L().Error("failed to record password", zap.String("user", userID), zap.Error(err))
+		}
+		return false
+	}
+	return records[0].MustChange || a.config.PasswordPolicy.IsExpired(records[0].CreatedAt, time.Now())
+}
@@ -0,0 +1,334 @@
+package account
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+
+	"gitlab.kenda.com.tw/kenda/mcom"
+	mcomErrors "gitlab.kenda.com.tw/kenda/mcom/errors"
+	"gitlab.kenda.com.tw/kenda/mcom/mock"
+
+	"gitlab.kenda.com.tw/kenda/mui/server/database"
+	"gitlab.kenda.com.tw/kenda/mui/server/database/storetest"
+	handlerUtils "gitlab.kenda.com.tw/kenda/mui/server/impl/handlers/mcom/utils"
+	"gitlab.kenda.com.tw/kenda/mui/server/impl/service"
+	"gitlab.kenda.com.tw/kenda/mui/server/impl/utils/password"
+	"gitlab.kenda.com.tw/kenda/mui/server/protobuf/kenda"
+	"gitlab.kenda.com.tw/kenda/mui/server/swagger/models"
+	authorization "gitlab.kenda.com.tw/kenda/mui/server/swagger/restapi/operations/account"
+)
+
+// newPasswordStores returns the stores on a test database with the password
+// records added in order.
+func newPasswordStores(t *testing.T, records ...database.PasswordRecord) storetest.Stores {
+	stores := storetest.New(t)
+	for _, record := range records {
+		if err := stores.Passwords.AddPassword(context.Background(), record); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return stores
+}
+
+func newPasswordStore(t *testing.T, records ...database.PasswordRecord) database.PasswordStore {
+	return newPasswordStores(t, records...).Passwords
+}
+
+// listPasswords lists the password records of all the users in the order of
+// addition.
+func listPasswords(t *testing.T, db *gorm.DB) []database.PasswordRecord {
+	var records []database.PasswordRecord
+	if err := db.Order("id").Find(&records).Error; err != nil {
+		t.Fatal(err)
+	}
+	return records
+}
+
+func mustHash(t *testing.T, pwd string) string {
+	hash, err := password.Hash(pwd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hash
+}
+
+func TestAuthorization_ChangePasswordPolicy(t *testing.T) {
+	assert := assert.New(t)
+
+	const (
+		currentPassword = "p4s5w0rd"
+		usedPassword    = "0ldp4ss"
+		newPassword     = "n3wp4ss"
+	)
+	dm, err := mock.New([]mock.Script{
+		{
+			Name: mock.FuncUpdateAccount,
+			Input: mock.Input{
+				Request: mcom.UpdateAccountRequest{
+					UserID: principal.ID,
+					ChangePassword: &struct {
+						NewPassword string
+						OldPassword string
+					}{
+						NewPassword: newPassword,
+						OldPassword: currentPassword,
+					},
+				},
+			},
+			Output: mock.Output{},
+		},
+	})
+	assert.NoError(err)
+
+	stores := newPasswordStores(t,
+		database.PasswordRecord{UserID: principal.ID, Hash: mustHash(t, usedPassword)},
+		database.PasswordRecord{UserID: principal.ID, Hash: mustHash(t, currentPassword)},
+	)
+	a := NewAuthorization(dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
+		return true
+	}, Config{
+		PasswordPolicy: password.Policy{
+			MinLength:    6,
+			RequireDigit: true,
+			History:      2,
+		},
+		Passwords: stores.Passwords,
+	})
+
+	newParams := func(current, next string) authorization.ChangePasswordParams {
+		return authorization.ChangePasswordParams{
+			HTTPRequest: httptest.NewRequest(http.MethodPut, "/user/change-password", nil),
+			Body: authorization.ChangePasswordBody{
+				CurrentPassword: &current,
+				NewPassword:     &next,
+			},
+		}
+	}
+
+	// bad password.
+	assert.Equal(authorization.NewChangePasswordDefault(http.StatusBadRequest).WithPayload(&models.Error{
+		Code:    int64(mcomErrors.Code_BAD_REQUEST),
+		Details: "the password must contain a digit",
+	}), a.ChangePassword(newParams(currentPassword, "password"), principal))
+
+	// the current password.
+	assert.Equal(authorization.NewChangePasswordDefault(http.StatusBadRequest).WithPayload(&models.Error{
+		Code:    int64(mcomErrors.Code_BAD_REQUEST),
+		Details: passwordReusedError,
+	}), a.ChangePassword(newParams(currentPassword, currentPassword), principal))
+
+	// used password.
+	assert.Equal(authorization.NewChangePasswordDefault(http.StatusBadRequest).WithPayload(&models.Error{
+		Code:    int64(mcomErrors.Code_BAD_REQUEST),
+		Details: passwordReusedError,
+	}), a.ChangePassword(newParams(currentPassword, usedPassword), principal))
+
+	// success.
+	assert.Equal(authorization.NewChangePasswordOK(), a.ChangePassword(newParams(currentPassword, newPassword), principal))
+	if records := listPasswords(t, stores.DB); assert.Len(records, 3) {
+		assert.Equal(principal.ID, records[2].UserID)
+		assert.True(password.Matches(records[2].Hash, newPassword))
+		assert.False(records[2].MustChange)
+	}
+
+	{ // internal error.
+		stores := storetest.New(t)
+		stores.Close(t)
+		a := NewAuthorization(dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
+			return true
+		}, Config{
+			PasswordPolicy: password.Policy{History: 2},
+			Passwords:      stores.Passwords,
+		})
+		assert.Equal(authorization.NewChangePasswordDefault(http.StatusInternalServerError).WithPayload(&models.Error{
+			Details: "sql: database is closed",
+		}), a.ChangePassword(newParams(currentPassword, newPassword), principal))
+	}
+	assert.NoError(dm.Close())
+}
+
+func TestAuthorization_LoginPasswordExpired(t *testing.T) {
+	assert := assert.New(t)
+
+	user, pass := "tester", "p4s5w0rd"
+	adLoginType := models.LoginType(1)
+	signIn := func(adUser bool) mock.Script {
+		return mock.Script{
+			Name: mock.FuncSignIn,
+			Input: mock.Input{
+				Request: mcom.SignInRequest{
+					Account:  user,
+					Password: pass,
+					ADUser:   adUser,
+				},
+			},
+			Output: mock.Output{
+				Response: mcom.SignInReply{
+					Token:       tokenFor + user,
+					TokenExpiry: tokenExpiry,
+					Departments: departments,
+					Roles:       roles,
+				},
+			},
+		}
+	}
+	dm, err := mock.New([]mock.Script{
+		signIn(false),
+		signIn(false),
+		signIn(false),
+		signIn(false),
+		signIn(true),
+	})
+	assert.NoError(err)
+
+	login := func(a service.AccountAuthorization, loginType models.LoginType) bool {
+		r, ok := a.Login(authorization.LoginParams{
+			HTTPRequest: httptest.NewRequest(http.MethodPost, "/user/login", nil),
+			Body: &models.LoginRequest{
+				ID:        &user,
+				Password:  &pass,
+				LoginType: &loginType,
+			},
+		}).(*authorization.LoginOK)
+		if !assert.True(ok) {
+			return false
+		}
+		return r.Payload.Data.PasswordExpired
+	}
+	policy := password.Policy{MaxAge: 90 * 24 * time.Hour}
+
+	{ // no history, the current password is recorded.
+		stores := storetest.New(t)
+		a := NewAuthorization(dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
+			return true
+		}, Config{Sessions: newSessionStore(t), PasswordPolicy: policy, Passwords: stores.Passwords})
+		assert.False(login(a, loginType))
+		if records := listPasswords(t, stores.DB); assert.Len(records, 1) {
+			assert.True(password.Matches(records[0].Hash, pass))
+		}
+	}
+	{ // default password.
+		a := NewAuthorization(dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
+			return true
+		}, Config{Sessions: newSessionStore(t), PasswordPolicy: policy, Passwords: newPasswordStore(t,
+			database.PasswordRecord{UserID: user, MustChange: true, CreatedAt: time.Now()},
+		)})
+		assert.True(login(a, loginType))
+	}
+	{ // expired.
+		a := NewAuthorization(dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
+			return true
+		}, Config{Sessions: newSessionStore(t), PasswordPolicy: policy, Passwords: newPasswordStore(t,
+			database.PasswordRecord{UserID: user, Hash: mustHash(t, pass), CreatedAt: time.Now().Add(-91 * 24 * time.Hour)},
+		)})
+		assert.True(login(a, loginType))
+	}
+	{ // failed to list the history, the login is not interrupted.
+		stores := storetest.New(t)
+		stores.Close(t)
+		a := NewAuthorization(dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
+			return true
+		}, Config{Sessions: newSessionStore(t), PasswordPolicy: policy, Passwords: stores.Passwords})
+		assert.False(login(a, loginType))
+	}
+	{ // AD account.
+		stores := newPasswordStores(t,
+			database.PasswordRecord{UserID: user, MustChange: true, CreatedAt: time.Now()},
+		)
+		a := NewAuthorization(dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
+			return true
+		}, Config{Sessions: newSessionStore(t), PasswordPolicy: policy, Passwords: stores.Passwords})
+		assert.False(login(a, adLoginType))
+		assert.Len(listPasswords(t, stores.DB), 1)
+	}
+	assert.NoError(dm.Close())
+}
+
+func TestAuthorization_RequirePasswordChange(t *testing.T) {
+	assert := assert.New(t)
+
+	dm, err := mock.New([]mock.Script{
+		{
+			Name: mock.FuncCreateAccounts,
+			Input: mock.Input{
+				Request: mcom.CreateAccountsRequest{
+					mcom.CreateAccountRequest{
+						ID:    testUsernameDan,
+						Roles: testDanRoles,
+					}.WithDefaultPassword(),
+				},
+			},
+			Output: mock.Output{},
+		},
+		{
+			Name: mock.FuncUpdateAccount,
+			Input: mock.Input{
+				Request: mcom.UpdateAccountRequest{
+					UserID: testUsernameDan,
+					Roles:  testDanRoles,
+				},
+				Options: []interface{}{mcom.ResetPassword()},
+			},
+			Output: mock.Output{},
+		},
+		{
+			Name: mock.FuncDeleteAccount,
+			Input: mock.Input{
+				Request: mcom.DeleteAccountRequest{
+					ID: testUsernameDan,
+				},
+			},
+			Output: mock.Output{},
+		},
+	})
+	assert.NoError(err)
+
+	stores := newPasswordStores(t, database.PasswordRecord{UserID: testUsernameSpencer, Hash: "hash"})
+	a := NewAuthorization(dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
+		return true
+	}, Config{Sessions: newSessionStore(t), Passwords: stores.Passwords})
+
+	// created.
+	assert.Equal(authorization.NewCreateAccountAuthorizationOK(), a.CreateAccountAuthorization(authorization.CreateAccountAuthorizationParams{
+		HTTPRequest: httptest.NewRequest(http.MethodPost, "/account/authorization", nil),
+		Body: authorization.CreateAccountAuthorizationBody{
+			EmployeeID: &testUsernameDan,
+			Roles:      handlerUtils.ToModelsRoles(testDanRoles),
+		},
+	}, principal))
+	if records := listPasswords(t, stores.DB); assert.Len(records, 2) {
+		assert.Equal(testUsernameDan, records[1].UserID)
+		assert.True(records[1].MustChange)
+	}
+
+	// reset.
+	assert.Equal(authorization.NewUpdateAccountAuthorizationOK(), a.UpdateAccountAuthorization(authorization.UpdateAccountAuthorizationParams{
+		HTTPRequest: httptest.NewRequest(http.MethodPut, "/account/authorization/dan", nil),
+		EmployeeID:  testUsernameDan,
+		Body: authorization.UpdateAccountAuthorizationBody{
+			Roles:         handlerUtils.ToModelsRoles(testDanRoles),
+			ResetPassword: &trueReset,
+		},
+	}, principal))
+	if records := listPasswords(t, stores.DB); assert.Len(records, 3) {
+		assert.Equal(testUsernameDan, records[2].UserID)
+		assert.True(records[2].MustChange)
+	}
+
+	// deleted.
+	assert.Equal(authorization.NewDeleteAccountOK(), a.DeleteAccount(authorization.DeleteAccountParams{
+		HTTPRequest: httptest.NewRequest(http.MethodDelete, "/account/authorization/dan", nil),
+		EmployeeID:  testUsernameDan,
+	}, principal))
+	if records := listPasswords(t, stores.DB); assert.Len(records, 1) {
+		assert.Equal(testUsernameSpencer, records[0].UserID)
+		assert.Equal("hash", records[0].Hash)
+	}
+	assert.NoError(dm.Close())
+}
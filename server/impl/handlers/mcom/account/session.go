@@ -0,0 +1,128 @@
+package account
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/go-openapi/runtime/middleware"
+	"github.com/go-openapi/strfmt"
+	"github.com/rs/xid"
+	"go.uber.org/zap"
+
+	commonsCtx "gitlab.kenda.com.tw/kenda/commons/v2/utils/context"
+	"gitlab.kenda.com.tw/kenda/mcom"
+	mcomErrors "gitlab.kenda.com.tw/kenda/mcom/errors"
+
+	"gitlab.kenda.com.tw/kenda/mui/server/database"
+	handlerUtils "gitlab.kenda.com.tw/kenda/mui/server/impl/handlers/mcom/utils"
+	"gitlab.kenda.com.tw/kenda/mui/server/impl/utils"
+	"gitlab.kenda.com.tw/kenda/mui/server/protobuf/kenda"
+	"gitlab.kenda.com.tw/kenda/mui/server/swagger/models"
+	"gitlab.kenda.com.tw/kenda/mui/server/swagger/restapi/operations/account"
+)
+
+// ListUserSessions implementations
+func (a Authorization) ListUserSessions(params account.ListUserSessionsParams, principal *models.Principal) middleware.Responder {
+	if !a.hasPermission(kenda.FunctionOperationID_LIST_USER_SESSIONS, principal.Roles) {
+		return account.NewListUserSessionsDefault(http.StatusForbidden)
+	}
+
+	ctx := commonsCtx.WithUserID(params.HTTPRequest.Context(), principal.ID)
+	sessions, err := a.config.Sessions.ListActiveSessions(ctx, params.EmployeeID)
+	if err != nil {
+		return utils.ParseError(ctx, account.NewListUserSessionsDefault(0), err)
+	}
+
+	data := make([]*account.ListUserSessionsOKBodyDataItems0, len(sessions))
+	for i, session := range sessions {
+		data[i] = &account.ListUserSessionsOKBodyDataItems0{
+			ID:        session.ID,
+			Device:    session.Device,
+			IP:        session.IP,
+			LoginAt:   strfmt.DateTime(session.LoginAt),
+			ExpiresAt: strfmt.DateTime(session.ExpiresAt),
+		}
+	}
+	return account.NewListUserSessionsOK().WithPayload(&account.ListUserSessionsOKBody{Data: data})
+}
+
+// RevokeUserSession implementations
+func (a Authorization) RevokeUserSession(params account.RevokeUserSessionParams, principal *models.Principal) middleware.Responder {
+	if !a.hasPermission(kenda.FunctionOperationID_REVOKE_USER_SESSIONS, principal.Roles) {
+		return account.NewRevokeUserSessionDefault(http.StatusForbidden)
+	}
+
+	ctx := commonsCtx.WithUserID(params.HTTPRequest.Context(), principal.ID)
+	session, err := a.config.Sessions.GetSession(ctx, params.SessionID)
+	if err != nil {
+		return utils.ParseError(ctx, account.NewRevokeUserSessionDefault(0), err)
+	}
+	if session.UserID != params.EmployeeID {
+		return utils.ParseError(ctx, account.NewRevokeUserSessionDefault(0), database.ErrRecordNotFound)
+	}
+
+	if err := a.revokeSession(ctx, session, principal.ID); err != nil {
+		return utils.ParseError(ctx, account.NewRevokeUserSessionDefault(0), err)
+	}
+	return account.NewRevokeUserSessionOK()
+}
+
+// RevokeUserSessions implementations
+func (a Authorization) RevokeUserSessions(params account.RevokeUserSessionsParams, principal *models.Principal) middleware.Responder {
+	if !a.hasPermission(kenda.FunctionOperationID_REVOKE_USER_SESSIONS, principal.Roles) {
+		return account.NewRevokeUserSessionsDefault(http.StatusForbidden)
+	}
+
+	ctx := commonsCtx.WithUserID(params.HTTPRequest.Context(), principal.ID)
+	if err := a.revokeSessions(ctx, params.EmployeeID, principal.ID); err != nil {
+		return utils.ParseError(ctx, account.NewRevokeUserSessionsDefault(0), err)
+	}
+	return account.NewRevokeUserSessionsOK()
+}
+
+// createSession records the session of the signed in token, the login is
+// not interrupted if it fails.
+func (a Authorization) createSession(r *http.Request, userID, token string, expiry time.Time) {
+	if err := a.config.Sessions.CreateSession(r.Context(), database.Session{
+		ID:        xid.New().String(),
+		Token:     token,
+		UserID:    userID,
+		Device:    r.UserAgent(),
+		IP:        a.config.TrustedProxies.ClientIP(r),
+		LoginAt:   time.Now(),
+		ExpiresAt: expiry,
+	}); err != nil {
+		zap.L().Error("failed to create session", zap.String("user", userID), zap.Error(err))
+	}
+}
+
+// revokeSessions signs out all the active sessions of the user.
+func (a Authorization) revokeSessions(ctx context.Context, userID, revokedBy string) error {
+	sessions, err := a.config.Sessions.ListActiveSessions(ctx, userID)
+	if err != nil {
+		return err
+	}
+	for _, session := range sessions {
+		if err := a.revokeSession(ctx, session, revokedBy); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (a Authorization) revokeSession(ctx context.Context, session database.Session, revokedBy string) error {
+	if err := a.dm.SignOut(ctx, mcom.SignOutRequest{
+		Token: session.Token,
+	}); err != nil {
+		// the token may have been signed out or removed along with the account.
+		if _, ok := mcomErrors.As(err); !ok {
+			return err
+		}
+		zap.L().Warn("failed to sign out session",
+			zap.String("session", session.ID),
+			zap.String("user", session.UserID),
+			zap.Error(err))
+	}
+	return a.config.Sessions.RevokeSession(ctx, session.ID, revokedBy)
+}
@@ -0,0 +1,419 @@
+package account
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-openapi/strfmt"
+	"github.com/stretchr/testify/assert"
+
+	"gitlab.kenda.com.tw/kenda/mcom"
+	mcomErrors "gitlab.kenda.com.tw/kenda/mcom/errors"
+	"gitlab.kenda.com.tw/kenda/mcom/mock"
+
+	"gitlab.kenda.com.tw/kenda/mui/server/database"
+	"gitlab.kenda.com.tw/kenda/mui/server/database/storetest"
+	handlerUtils "gitlab.kenda.com.tw/kenda/mui/server/impl/handlers/mcom/utils"
+	"gitlab.kenda.com.tw/kenda/mui/server/protobuf/kenda"
+	"gitlab.kenda.com.tw/kenda/mui/server/swagger/models"
+	authorization "gitlab.kenda.com.tw/kenda/mui/server/swagger/restapi/operations/account"
+)
+
+// newSessionStore returns a SessionStore on a test database with the sessions
+// created.
+func newSessionStore(t *testing.T, sessions ...database.Session) database.SessionStore {
+	store := storetest.New(t).Sessions
+	for _, session := range sessions {
+		if err := store.CreateSession(context.Background(), session); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return store
+}
+
+func mustGetSession(t *testing.T, store database.SessionStore, id string) database.Session {
+	session, err := store.GetSession(context.Background(), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return session
+}
+
+func testSession(id, user string, loginAt time.Time) database.Session {
+	return database.Session{
+		ID:        id,
+		Token:     tokenFor + id,
+		UserID:    user,
+		Device:    "PDA",
+		IP:        "10.1.1.1",
+		LoginAt:   loginAt,
+		ExpiresAt: loginAt.Add(8 * time.Hour),
+	}
+}
+
+func TestAuthorization_LoginSession(t *testing.T) {
+	assert := assert.New(t)
+
+	user, pass := "tester", "p4s5w0rd"
+
+	dm, err := mock.New([]mock.Script{
+		{
+			Name: mock.FuncSignIn,
+			Input: mock.Input{
+				Request: mcom.SignInRequest{
+					Account:  user,
+					Password: pass,
+				},
+			},
+			Output: mock.Output{
+				Response: mcom.SignInReply{
+					Token:       tokenFor + user,
+					TokenExpiry: tokenExpiry,
+					Departments: departments,
+					Roles:       roles,
+				},
+			},
+		},
+		{
+			Name: mock.FuncSignOut,
+			Input: mock.Input{
+				Request: mcom.SignOutRequest{
+					Token: tokenFor + user,
+				},
+			},
+			Output: mock.Output{},
+		},
+	})
+	assert.NoError(err)
+
+	store := newSessionStore(t)
+	a := NewAuthorization(dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
+		return false
+	}, Config{Sessions: store, Passwords: newPasswordStore(t)})
+
+	loginRequest := httptest.NewRequest(http.MethodPost, "/user/login", nil)
+	loginRequest.RemoteAddr = "10.1.1.1:51234"
+	loginRequest.Header.Set("User-Agent", "PDA")
+	_, ok := a.Login(authorization.LoginParams{
+		HTTPRequest: loginRequest,
+		Body: &models.LoginRequest{
+			ID:        &user,
+			Password:  &pass,
+			LoginType: &loginType,
+		},
+	}).(*authorization.LoginOK)
+	assert.True(ok)
+
+	// the session is recorded.
+	sessions, err := store.ListActiveSessions(context.Background(), user)
+	assert.NoError(err)
+	if assert.Len(sessions, 1) {
+		assert.NotEmpty(sessions[0].ID)
+		assert.Equal(tokenFor+user, sessions[0].Token)
+		assert.Equal("PDA", sessions[0].Device)
+		assert.Equal("10.1.1.1", sessions[0].IP)
+		assert.True(tokenExpiry.Equal(sessions[0].ExpiresAt))
+	}
+
+	// the session is revoked after logout.
+	logoutRequest := httptest.NewRequest(http.MethodPost, "/user/logout", nil)
+	logoutRequest.Header.Set(AuthorizationKey, tokenFor+user)
+	_, ok = a.Logout(authorization.LogoutParams{HTTPRequest: logoutRequest}).(*authorization.LogoutOK)
+	assert.True(ok)
+
+	sessions, err = store.ListActiveSessions(context.Background(), user)
+	assert.NoError(err)
+	assert.Empty(sessions)
+	assert.NoError(dm.Close())
+}
+
+func TestAuthorization_ListUserSessions(t *testing.T) {
+	assert := assert.New(t)
+	dm, err := mock.New([]mock.Script{})
+	assert.NoError(err)
+
+	now := time.Now().UTC()
+	expired := testSession("expired", testUsernameDan, now.Add(-9*time.Hour))
+	first := testSession("first", testUsernameDan, now.Add(-2*time.Hour))
+	second := testSession("second", testUsernameDan, now.Add(-time.Hour))
+	others := testSession("others", testUsernameSpencer, now)
+
+	params := authorization.ListUserSessionsParams{
+		HTTPRequest: httptest.NewRequest(http.MethodGet, "/account/sessions/dan", nil),
+		EmployeeID:  testUsernameDan,
+	}
+
+	{ // success.
+		a := NewAuthorization(dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
+			return true
+		}, Config{Sessions: newSessionStore(t, expired, first, second, others)})
+		assert.Equal(authorization.NewListUserSessionsOK().WithPayload(&authorization.ListUserSessionsOKBody{
+			Data: []*authorization.ListUserSessionsOKBodyDataItems0{
+				{
+					ID:        first.ID,
+					Device:    first.Device,
+					IP:        first.IP,
+					LoginAt:   strfmt.DateTime(first.LoginAt),
+					ExpiresAt: strfmt.DateTime(first.ExpiresAt),
+				},
+				{
+					ID:        second.ID,
+					Device:    second.Device,
+					IP:        second.IP,
+					LoginAt:   strfmt.DateTime(second.LoginAt),
+					ExpiresAt: strfmt.DateTime(second.ExpiresAt),
+				},
+			},
+		}), a.ListUserSessions(params, principal))
+	}
+	{ // internal error.
+		stores := storetest.New(t)
+		stores.Close(t)
+		a := NewAuthorization(dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
+			return true
+		}, Config{Sessions: stores.Sessions})
+		assert.Equal(authorization.NewListUserSessionsDefault(http.StatusInternalServerError).WithPayload(&models.Error{
+			Details: "sql: database is closed",
+		}), a.ListUserSessions(params, principal))
+	}
+	{ // forbidden.
+		a := NewAuthorization(dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
+			return false
+		}, Config{Sessions: newSessionStore(t)})
+		assert.Equal(authorization.NewListUserSessionsDefault(http.StatusForbidden), a.ListUserSessions(params, principal))
+	}
+	assert.NoError(dm.Close())
+}
+
+func TestAuthorization_RevokeUserSession(t *testing.T) {
+	assert := assert.New(t)
+	dm, err := mock.New([]mock.Script{
+		{
+			Name: mock.FuncSignOut,
+			Input: mock.Input{
+				Request: mcom.SignOutRequest{
+					Token: tokenFor + "first",
+				},
+			},
+			Output: mock.Output{},
+		},
+		{ // the token has been signed out.
+			Name: mock.FuncSignOut,
+			Input: mock.Input{
+				Request: mcom.SignOutRequest{
+					Token: tokenFor + "second",
+				},
+			},
+			Output: mock.Output{
+				Error: mcomErrors.Error{
+					Code: mcomErrors.Code_USER_UNKNOWN_TOKEN,
+				},
+			},
+		},
+		{
+			Name: mock.FuncSignOut,
+			Input: mock.Input{
+				Request: mcom.SignOutRequest{
+					Token: tokenFor + "third",
+				},
+			},
+			Output: mock.Output{
+				Error: errors.New(testInternalServerError),
+			},
+		},
+	})
+	assert.NoError(err)
+
+	now := time.Now()
+	store := newSessionStore(t,
+		testSession("first", testUsernameDan, now),
+		testSession("second", testUsernameDan, now),
+		testSession("third", testUsernameDan, now),
+	)
+	a := NewAuthorization(dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
+		return true
+	}, Config{Sessions: store})
+
+	newParams := func(user, session string) authorization.RevokeUserSessionParams {
+		return authorization.RevokeUserSessionParams{
+			HTTPRequest: httptest.NewRequest(http.MethodDelete, "/account/sessions/"+user+"/"+session, nil),
+			EmployeeID:  user,
+			SessionID:   session,
+		}
+	}
+
+	// success.
+	assert.Equal(authorization.NewRevokeUserSessionOK(), a.RevokeUserSession(newParams(testUsernameDan, "first"), principal))
+	assert.NotNil(mustGetSession(t, store, "first").RevokedAt)
+	assert.Equal(principal.ID, mustGetSession(t, store, "first").RevokedBy)
+
+	// the token has been signed out.
+	assert.Equal(authorization.NewRevokeUserSessionOK(), a.RevokeUserSession(newParams(testUsernameDan, "second"), principal))
+	assert.NotNil(mustGetSession(t, store, "second").RevokedAt)
+
+	// failed to sign out.
+	assert.Equal(authorization.NewRevokeUserSessionDefault(http.StatusInternalServerError).WithPayload(&models.Error{
+		Details: testInternalServerError,
+	}), a.RevokeUserSession(newParams(testUsernameDan, "third"), principal))
+	assert.Nil(mustGetSession(t, store, "third").RevokedAt)
+
+	// session of the other user.
+	assert.Equal(authorization.NewRevokeUserSessionDefault(http.StatusNotFound).WithPayload(&models.Error{
+		Code:    int64(mcomErrors.Code_RECORD_NOT_FOUND),
+		Details: database.ErrRecordNotFound.Error(),
+	}), a.RevokeUserSession(newParams(testUsernameSpencer, "third"), principal))
+
+	// session not found.
+	assert.Equal(authorization.NewRevokeUserSessionDefault(http.StatusNotFound).WithPayload(&models.Error{
+		Code:    int64(mcomErrors.Code_RECORD_NOT_FOUND),
+		Details: database.ErrRecordNotFound.Error(),
+	}), a.RevokeUserSession(newParams(testUsernameDan, "not-found"), principal))
+
+	{ // forbidden.
+		a := NewAuthorization(dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
+			return false
+		}, Config{Sessions: store})
+		assert.Equal(authorization.NewRevokeUserSessionDefault(http.StatusForbidden),
+			a.RevokeUserSession(newParams(testUsernameDan, "third"), principal))
+	}
+	assert.NoError(dm.Close())
+}
+
+func TestAuthorization_RevokeUserSessions(t *testing.T) {
+	assert := assert.New(t)
+	dm, err := mock.New([]mock.Script{
+		{
+			Name: mock.FuncSignOut,
+			Input: mock.Input{
+				Request: mcom.SignOutRequest{
+					Token: tokenFor + "first",
+				},
+			},
+			Output: mock.Output{},
+		},
+		{
+			Name: mock.FuncSignOut,
+			Input: mock.Input{
+				Request: mcom.SignOutRequest{
+					Token: tokenFor + "second",
+				},
+			},
+			Output: mock.Output{},
+		},
+	})
+	assert.NoError(err)
+
+	now := time.Now()
+	store := newSessionStore(t,
+		testSession("first", testUsernameDan, now.Add(-time.Hour)),
+		testSession("second", testUsernameDan, now),
+		testSession("others", testUsernameSpencer, now),
+	)
+	a := NewAuthorization(dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
+		return true
+	}, Config{Sessions: store})
+
+	params := authorization.RevokeUserSessionsParams{
+		HTTPRequest: httptest.NewRequest(http.MethodDelete, "/account/sessions/dan", nil),
+		EmployeeID:  testUsernameDan,
+	}
+	assert.Equal(authorization.NewRevokeUserSessionsOK(), a.RevokeUserSessions(params, principal))
+	assert.NotNil(mustGetSession(t, store, "first").RevokedAt)
+	assert.NotNil(mustGetSession(t, store, "second").RevokedAt)
+	assert.Nil(mustGetSession(t, store, "others").RevokedAt)
+
+	{ // forbidden.
+		a := NewAuthorization(dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
+			return false
+		}, Config{Sessions: store})
+		assert.Equal(authorization.NewRevokeUserSessionsDefault(http.StatusForbidden), a.RevokeUserSessions(params, principal))
+	}
+	assert.NoError(dm.Close())
+}
+
+func TestAuthorization_DeleteAccountRevokeSessions(t *testing.T) {
+	assert := assert.New(t)
+	dm, err := mock.New([]mock.Script{
+		{
+			Name: mock.FuncDeleteAccount,
+			Input: mock.Input{
+				Request: mcom.DeleteAccountRequest{
+					ID: testUsernameDan,
+				},
+			},
+			Output: mock.Output{},
+		},
+		{
+			Name: mock.FuncSignOut,
+			Input: mock.Input{
+				Request: mcom.SignOutRequest{
+					Token: tokenFor + "first",
+				},
+			},
+			Output: mock.Output{
+				Error: mcomErrors.Error{
+					Code: mcomErrors.Code_USER_UNKNOWN_TOKEN,
+				},
+			},
+		},
+	})
+	assert.NoError(err)
+
+	store := newSessionStore(t, testSession("first", testUsernameDan, time.Now()))
+	a := NewAuthorization(dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
+		return true
+	}, Config{Sessions: store, Passwords: newPasswordStore(t)})
+
+	assert.Equal(authorization.NewDeleteAccountOK(), a.DeleteAccount(authorization.DeleteAccountParams{
+		HTTPRequest: httptest.NewRequest(http.MethodDelete, "/account/authorization/dan", nil),
+		EmployeeID:  testUsernameDan,
+	}, principal))
+	assert.NotNil(mustGetSession(t, store, "first").RevokedAt)
+	assert.NoError(dm.Close())
+}
+
+func TestAuthorization_UpdateAccountRevokeSessions(t *testing.T) {
+	assert := assert.New(t)
+	dm, err := mock.New([]mock.Script{
+		{
+			Name: mock.FuncUpdateAccount,
+			Input: mock.Input{
+				Request: mcom.UpdateAccountRequest{
+					UserID: testUsernameDan,
+					Roles:  testDanRoles,
+				},
+			},
+			Output: mock.Output{},
+		},
+		{
+			Name: mock.FuncSignOut,
+			Input: mock.Input{
+				Request: mcom.SignOutRequest{
+					Token: tokenFor + "first",
+				},
+			},
+			Output: mock.Output{},
+		},
+	})
+	assert.NoError(err)
+
+	store := newSessionStore(t, testSession("first", testUsernameDan, time.Now()))
+	a := NewAuthorization(dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
+		return true
+	}, Config{Sessions: store, Passwords: newPasswordStore(t)})
+
+	assert.Equal(authorization.NewUpdateAccountAuthorizationOK(), a.UpdateAccountAuthorization(authorization.UpdateAccountAuthorizationParams{
+		HTTPRequest: httptest.NewRequest(http.MethodPut, "/account/authorization/dan", nil),
+		EmployeeID:  testUsernameDan,
+		Body: authorization.UpdateAccountAuthorizationBody{
+			Roles:         handlerUtils.ToModelsRoles(testDanRoles),
+			ResetPassword: &falseReset,
+		},
+	}, principal))
+	assert.NotNil(mustGetSession(t, store, "first").RevokedAt)
+	assert.NoError(dm.Close())
+}
@@ -30,6 +30,12 @@ type PrintData struct {
 }
 
 func CreateResourcesPDF(ctx context.Context, fieldName models.MaterialResourceLabelFieldName, dataIn PrintData, generator barcodes.Generator, fontPath string) (io.ReadCloser, error) {
+	return CreateResourceLabelsPDF(ctx, fieldName, []PrintData{dataIn}, generator, fontPath)
+}
+
+// CreateResourceLabelsPDF creates a PDF with a page of label for each of the
+// resources, so the labels are printed by a single print job.
+func CreateResourceLabelsPDF(ctx context.Context, fieldName models.MaterialResourceLabelFieldName, data []PrintData, generator barcodes.Generator, fontPath string) (io.ReadCloser, error) {
 	if (fieldName == models.MaterialResourceLabelFieldName{}) {
 		fieldName = models.MaterialResourceLabelFieldName{
 			Station:        "工程機台別",
@@ -58,6 +64,24 @@ func CreateResourcesPDF(ctx context.Context, fieldName models.MaterialResourceLa
 	// if use gofpdf.AddUTF8Font import fonts, you can not set styleStr(ex:boldataIn...)
 	// gofpdf can not use *.ttc file
 	pdf.AddUTF8Font("font", "", fontPath)
+
+	for _, dataIn := range data {
+		if err := addResourceLabel(pdf, fieldName, dataIn, generator, font); err != nil {
+			return nil, err
+		}
+	}
+
+	pipeReader, pipeWriter := io.Pipe()
+	go func() {
+		if err := pdf.OutputAndClose(pipeWriter); err != nil {
+			commonsCtx.Logger(ctx).Warn("failed to output and close pdf file", zap.Error(err))
+		}
+	}()
+
+	return ioutil.NopCloser(pipeReader), nil
+}
+
+func addResourceLabel(pdf *gofpdf.Fpdf, fieldName models.MaterialResourceLabelFieldName, dataIn PrintData, generator barcodes.Generator, font float64) error {
 	pdf.SetFont("Helvetica", "BI", font*2)
 
 	pageWidth, pageHeight := pdf.GetPageSize()
@@ -128,20 +152,12 @@ func CreateResourcesPDF(ctx context.Context, fieldName models.MaterialResourceLa
 	//Generate Barcode
 	key, err := generator.Generate(dataIn.ResourceID, int(barcodeWidth)*10, int(font)*2)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	x += barcodeWidth * 1.25
 	y += 1
 	pdf.SetXY(x, y)
 
 	barcode.Barcode(pdf, key, x, y, dataWidth*0.8, font*1.5, false)
-
-	pipeReader, pipeWriter := io.Pipe()
-	go func() {
-		if err := pdf.OutputAndClose(pipeWriter); err != nil {
-			commonsCtx.Logger(ctx).Warn("failed to output and close pdf file", zap.Error(err))
-		}
-	}()
-
-	return ioutil.NopCloser(pipeReader), nil
+	return nil
 }
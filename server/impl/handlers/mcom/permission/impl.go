@@ -0,0 +1,194 @@
+package permission
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/go-openapi/runtime/middleware"
+	"github.com/go-openapi/strfmt"
+
+	commonsCtx "gitlab.kenda.com.tw/kenda/commons/v2/utils/context"
+	mcomErrors "gitlab.kenda.com.tw/kenda/mcom/errors"
+	mcomRoles "gitlab.kenda.com.tw/kenda/mcom/utils/roles"
+
+	"gitlab.kenda.com.tw/kenda/mui/server/database"
+	handlerUtils "gitlab.kenda.com.tw/kenda/mui/server/impl/handlers/mcom/utils"
+	"gitlab.kenda.com.tw/kenda/mui/server/impl/service"
+	"gitlab.kenda.com.tw/kenda/mui/server/impl/utils"
+	"gitlab.kenda.com.tw/kenda/mui/server/protobuf/kenda"
+	"gitlab.kenda.com.tw/kenda/mui/server/swagger/models"
+	"gitlab.kenda.com.tw/kenda/mui/server/swagger/restapi/operations/permission"
+)
+
+// Manager manages the stored role permissions, see role.Manager.
+type Manager interface {
+	ListPermissions(ctx context.Context) ([]database.FunctionPermission, error)
+	CreatePermission(ctx context.Context, id kenda.FunctionOperationID, roles []mcomRoles.Role, user string) (database.FunctionPermission, error)
+	UpdatePermission(ctx context.Context, id kenda.FunctionOperationID, roles []mcomRoles.Role, version int, user string) (database.FunctionPermission, error)
+	DeletePermission(ctx context.Context, id kenda.FunctionOperationID, version int, user string) error
+	ListPermissionChanges(ctx context.Context, id kenda.FunctionOperationID) ([]database.FunctionPermissionChange, error)
+}
+
+// Permission definitions.
+type Permission struct {
+	manager Manager
+
+	hasPermission func(id kenda.FunctionOperationID, roles []models.Role) bool
+}
+
+// NewPermission returns Permission service.
+func NewPermission(
+	manager Manager,
+	hasPermission func(id kenda.FunctionOperationID, roles []models.Role) bool) service.Permission {
+	return Permission{
+		manager:       manager,
+		hasPermission: hasPermission,
+	}
+}
+
+// ListRolePermissions implementation.
+func (p Permission) ListRolePermissions(params permission.ListRolePermissionsParams, principal *models.Principal) middleware.Responder {
+	if !p.hasPermission(kenda.FunctionOperationID_MANAGE_ROLE_PERMISSIONS, principal.Roles) {
+		return permission.NewListRolePermissionsDefault(http.StatusForbidden)
+	}
+
+	ctx := commonsCtx.WithUserID(params.HTTPRequest.Context(), principal.ID)
+	list, err := p.manager.ListPermissions(ctx)
+	if err != nil {
+		return utils.ParseError(ctx, permission.NewListRolePermissionsDefault(0), err)
+	}
+
+	data := make([]*models.RolePermission, len(list))
+	for i, perm := range list {
+		data[i] = toRolePermission(perm)
+	}
+	return permission.NewListRolePermissionsOK().WithPayload(&permission.ListRolePermissionsOKBody{Data: data})
+}
+
+// CreateRolePermission implementation.
+func (p Permission) CreateRolePermission(params permission.CreateRolePermissionParams, principal *models.Principal) middleware.Responder {
+	if !p.hasPermission(kenda.FunctionOperationID_MANAGE_ROLE_PERMISSIONS, principal.Roles) {
+		return permission.NewCreateRolePermissionDefault(http.StatusForbidden)
+	}
+
+	ctx := commonsCtx.WithUserID(params.HTTPRequest.Context(), principal.ID)
+	id, err := parseFunctionOperationID(*params.Body.FunctionOperationID)
+	if err != nil {
+		return utils.ParseError(ctx, permission.NewCreateRolePermissionDefault(0), err)
+	}
+
+	perm, err := p.manager.CreatePermission(ctx, id, handlerUtils.FromModelsRoles(params.Body.Roles), principal.ID)
+	if err != nil {
+		return utils.ParseError(ctx, permission.NewCreateRolePermissionDefault(0), err)
+	}
+	return permission.NewCreateRolePermissionOK().WithPayload(&permission.CreateRolePermissionOKBody{
+		Data: toRolePermission(perm),
+	})
+}
+
+// UpdateRolePermission implementation.
+func (p Permission) UpdateRolePermission(params permission.UpdateRolePermissionParams, principal *models.Principal) middleware.Responder {
+	if !p.hasPermission(kenda.FunctionOperationID_MANAGE_ROLE_PERMISSIONS, principal.Roles) {
+		return permission.NewUpdateRolePermissionDefault(http.StatusForbidden)
+	}
+
+	ctx := commonsCtx.WithUserID(params.HTTPRequest.Context(), principal.ID)
+	id, err := parseFunctionOperationID(params.FunctionOperationID)
+	if err != nil {
+		return utils.ParseError(ctx, permission.NewUpdateRolePermissionDefault(0), err)
+	}
+
+	perm, err := p.manager.UpdatePermission(ctx,
+		id,
+		handlerUtils.FromModelsRoles(params.Body.Roles),
+		int(*params.Body.Version),
+		principal.ID)
+	if err != nil {
+		return utils.ParseError(ctx, permission.NewUpdateRolePermissionDefault(0), err)
+	}
+	return permission.NewUpdateRolePermissionOK().WithPayload(&permission.UpdateRolePermissionOKBody{
+		Data: toRolePermission(perm),
+	})
+}
+
+// DeleteRolePermission implementation.
+func (p Permission) DeleteRolePermission(params permission.DeleteRolePermissionParams, principal *models.Principal) middleware.Responder {
+	if !p.hasPermission(kenda.FunctionOperationID_MANAGE_ROLE_PERMISSIONS, principal.Roles) {
+		return permission.NewDeleteRolePermissionDefault(http.StatusForbidden)
+	}
+
+	ctx := commonsCtx.WithUserID(params.HTTPRequest.Context(), principal.ID)
+	id, err := parseFunctionOperationID(params.FunctionOperationID)
+	if err != nil {
+		return utils.ParseError(ctx, permission.NewDeleteRolePermissionDefault(0), err)
+	}
+
+	if err := p.manager.DeletePermission(ctx, id, int(params.Version), principal.ID); err != nil {
+		return utils.ParseError(ctx, permission.NewDeleteRolePermissionDefault(0), err)
+	}
+	return permission.NewDeleteRolePermissionOK()
+}
+
+// ListRolePermissionChanges implementation.
+func (p Permission) ListRolePermissionChanges(params permission.ListRolePermissionChangesParams, principal *models.Principal) middleware.Responder {
+	if !p.hasPermission(kenda.FunctionOperationID_MANAGE_ROLE_PERMISSIONS, principal.Roles) {
+		return permission.NewListRolePermissionChangesDefault(http.StatusForbidden)
+	}
+
+	ctx := commonsCtx.WithUserID(params.HTTPRequest.Context(), principal.ID)
+	id, err := parseFunctionOperationID(params.FunctionOperationID)
+	if err != nil {
+		return utils.ParseError(ctx, permission.NewListRolePermissionChangesDefault(0), err)
+	}
+
+	list, err := p.manager.ListPermissionChanges(ctx, id)
+	if err != nil {
+		return utils.ParseError(ctx, permission.NewListRolePermissionChangesDefault(0), err)
+	}
+
+	data := make([]*models.RolePermissionChange, len(list))
+	for i, change := range list {
+		data[i] = &models.RolePermissionChange{
+			Version:   int64(change.Version),
+			Action:    string(change.Action),
+			Roles:     toModelsRoles(change.Roles),
+			CreatedBy: change.CreatedBy,
+			CreatedAt: strfmt.DateTime(change.CreatedAt),
+		}
+	}
+	return permission.NewListRolePermissionChangesOK().WithPayload(&permission.ListRolePermissionChangesOKBody{Data: data})
+}
+
+func parseFunctionOperationID(name string) (kenda.FunctionOperationID, error) {
+	id, ok := kenda.FunctionOperationID_value[name]
+	if !ok {
+		return 0, mcomErrors.Error{
+			Code:    mcomErrors.Code_BAD_REQUEST,
+			Details: fmt.Sprintf("function %s was not in the list", name),
+		}
+	}
+	return kenda.FunctionOperationID(id), nil
+}
+
+func toRolePermission(perm database.FunctionPermission) *models.RolePermission {
+	return &models.RolePermission{
+		FunctionOperationID: perm.FunctionID.String(),
+		Roles:               toModelsRoles(perm.Roles),
+		Version:             int64(perm.Version),
+		UpdatedBy:           perm.UpdatedBy,
+		UpdatedAt:           strfmt.DateTime(perm.UpdatedAt),
+	}
+}
+
+// toModelsRoles converts the stored role names to models roles, the unknown
+// names are ignored.
+func toModelsRoles(names []string) models.Roles {
+	roles := models.Roles{}
+	for _, name := range names {
+		if r, ok := mcomRoles.Role_value[name]; ok {
+			roles = append(roles, models.Role(r))
+		}
+	}
+	return roles
+}
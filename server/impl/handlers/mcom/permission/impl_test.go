@@ -0,0 +1,309 @@
+package permission
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-openapi/strfmt"
+	"github.com/stretchr/testify/assert"
+
+	mcomErrors "gitlab.kenda.com.tw/kenda/mcom/errors"
+	mcomRoles "gitlab.kenda.com.tw/kenda/mcom/utils/roles"
+
+	"gitlab.kenda.com.tw/kenda/mui/server/database"
+	"gitlab.kenda.com.tw/kenda/mui/server/protobuf/kenda"
+	"gitlab.kenda.com.tw/kenda/mui/server/swagger/models"
+	"gitlab.kenda.com.tw/kenda/mui/server/swagger/restapi/operations/permission"
+)
+
+const (
+	testUser          = "tester"
+	testInternalError = "internal error"
+)
+
+var (
+	principal = &models.Principal{
+		ID: testUser,
+		Roles: []models.Role{
+			models.Role(mcomRoles.Role_ADMINISTRATOR),
+		},
+	}
+
+	testTime = time.Date(2022, 12, 1, 8, 0, 0, 0, time.Local)
+
+	testPermission = database.FunctionPermission{
+		FunctionID: kenda.FunctionOperationID_STATION_FORCE_SIGN_IN,
+		Roles:      database.Strings{"ADMINISTRATOR", "LEADER"},
+		Version:    2,
+		UpdatedBy:  testUser,
+		UpdatedAt:  testTime,
+	}
+	testModelsPermission = &models.RolePermission{
+		FunctionOperationID: "STATION_FORCE_SIGN_IN",
+		Roles: models.Roles{
+			models.Role(mcomRoles.Role_ADMINISTRATOR),
+			models.Role(mcomRoles.Role_LEADER),
+		},
+		Version:   2,
+		UpdatedBy: testUser,
+		UpdatedAt: strfmt.DateTime(testTime),
+	}
+)
+
+type fakeManager struct {
+	perms   []database.FunctionPermission
+	changes []database.FunctionPermissionChange
+	err     error
+
+	// the arguments of the last call.
+	id      kenda.FunctionOperationID
+	roles   []mcomRoles.Role
+	version int
+	user    string
+}
+
+func (m *fakeManager) ListPermissions(context.Context) ([]database.FunctionPermission, error) {
+	return m.perms, m.err
+}
+
+func (m *fakeManager) CreatePermission(_ context.Context, id kenda.FunctionOperationID, roles []mcomRoles.Role, user string) (database.FunctionPermission, error) {
+	m.id, m.roles, m.user = id, roles, user
+	if m.err != nil {
+		return database.FunctionPermission{}, m.err
+	}
+	return testPermission, nil
+}
+
+func (m *fakeManager) UpdatePermission(_ context.Context, id kenda.FunctionOperationID, roles []mcomRoles.Role, version int, user string) (database.FunctionPermission, error) {
+	m.id, m.roles, m.version, m.user = id, roles, version, user
+	if m.err != nil {
+		return database.FunctionPermission{}, m.err
+	}
+	return testPermission, nil
+}
+
+func (m *fakeManager) DeletePermission(_ context.Context, id kenda.FunctionOperationID, version int, user string) error {
+	m.id, m.version, m.user = id, version, user
+	return m.err
+}
+
+func (m *fakeManager) ListPermissionChanges(_ context.Context, id kenda.FunctionOperationID) ([]database.FunctionPermissionChange, error) {
+	m.id = id
+	return m.changes, m.err
+}
+
+func allow(kenda.FunctionOperationID, []models.Role) bool {
+	return true
+}
+
+func deny(kenda.FunctionOperationID, []models.Role) bool {
+	return false
+}
+
+func TestPermission_ListRolePermissions(t *testing.T) {
+	assert := assert.New(t)
+	params := permission.ListRolePermissionsParams{
+		HTTPRequest: httptest.NewRequest(http.MethodGet, "/api/role-permissions", nil),
+	}
+
+	{ // success.
+		p := NewPermission(&fakeManager{perms: []database.FunctionPermission{testPermission}}, allow)
+		assert.Equal(permission.NewListRolePermissionsOK().WithPayload(&permission.ListRolePermissionsOKBody{
+			Data: []*models.RolePermission{testModelsPermission},
+		}), p.ListRolePermissions(params, principal))
+	}
+	{ // internal error.
+		p := NewPermission(&fakeManager{err: errors.New(testInternalError)}, allow)
+		assert.Equal(permission.NewListRolePermissionsDefault(http.StatusInternalServerError).WithPayload(&models.Error{
+			Details: testInternalError,
+		}), p.ListRolePermissions(params, principal))
+	}
+	{ // forbidden.
+		p := NewPermission(&fakeManager{}, deny)
+		assert.Equal(permission.NewListRolePermissionsDefault(http.StatusForbidden), p.ListRolePermissions(params, principal))
+	}
+}
+
+func TestPermission_CreateRolePermission(t *testing.T) {
+	assert := assert.New(t)
+	newParams := func(name string) permission.CreateRolePermissionParams {
+		return permission.CreateRolePermissionParams{
+			HTTPRequest: httptest.NewRequest(http.MethodPost, "/api/role-permissions", nil),
+			Body: permission.CreateRolePermissionBody{
+				FunctionOperationID: &name,
+				Roles: models.Roles{
+					models.Role(mcomRoles.Role_ADMINISTRATOR),
+					models.Role(mcomRoles.Role_LEADER),
+				},
+			},
+		}
+	}
+
+	{ // success.
+		m := &fakeManager{}
+		p := NewPermission(m, allow)
+		assert.Equal(permission.NewCreateRolePermissionOK().WithPayload(&permission.CreateRolePermissionOKBody{
+			Data: testModelsPermission,
+		}), p.CreateRolePermission(newParams("STATION_FORCE_SIGN_IN"), principal))
+		assert.Equal(kenda.FunctionOperationID_STATION_FORCE_SIGN_IN, m.id)
+		assert.Equal([]mcomRoles.Role{mcomRoles.Role_ADMINISTRATOR, mcomRoles.Role_LEADER}, m.roles)
+		assert.Equal(testUser, m.user)
+	}
+	{ // function not found.
+		p := NewPermission(&fakeManager{}, allow)
+		assert.Equal(permission.NewCreateRolePermissionDefault(http.StatusBadRequest).WithPayload(&models.Error{
+			Code:    int64(mcomErrors.Code_BAD_REQUEST),
+			Details: "function NOT_EXISTED was not in the list",
+		}), p.CreateRolePermission(newParams("NOT_EXISTED"), principal))
+	}
+	{ // existed.
+		p := NewPermission(&fakeManager{err: database.ErrRecordExisted}, allow)
+		assert.Equal(permission.NewCreateRolePermissionDefault(http.StatusConflict).WithPayload(&models.Error{
+			Code:    int64(mcomErrors.Code_RECORD_ALREADY_EXISTS),
+			Details: database.ErrRecordExisted.Error(),
+		}), p.CreateRolePermission(newParams("STATION_FORCE_SIGN_IN"), principal))
+	}
+	{ // forbidden.
+		p := NewPermission(&fakeManager{}, deny)
+		assert.Equal(permission.NewCreateRolePermissionDefault(http.StatusForbidden),
+			p.CreateRolePermission(newParams("STATION_FORCE_SIGN_IN"), principal))
+	}
+}
+
+func TestPermission_UpdateRolePermission(t *testing.T) {
+	assert := assert.New(t)
+	version := int64(1)
+	params := permission.UpdateRolePermissionParams{
+		HTTPRequest:         httptest.NewRequest(http.MethodPut, "/api/role-permissions/STATION_FORCE_SIGN_IN", nil),
+		FunctionOperationID: "STATION_FORCE_SIGN_IN",
+		Body: permission.UpdateRolePermissionBody{
+			Roles: models.Roles{
+				models.Role(mcomRoles.Role_ADMINISTRATOR),
+				models.Role(mcomRoles.Role_LEADER),
+			},
+			Version: &version,
+		},
+	}
+
+	{ // success.
+		m := &fakeManager{}
+		p := NewPermission(m, allow)
+		assert.Equal(permission.NewUpdateRolePermissionOK().WithPayload(&permission.UpdateRolePermissionOKBody{
+			Data: testModelsPermission,
+		}), p.UpdateRolePermission(params, principal))
+		assert.Equal(kenda.FunctionOperationID_STATION_FORCE_SIGN_IN, m.id)
+		assert.Equal(1, m.version)
+	}
+	{ // version conflict.
+		p := NewPermission(&fakeManager{err: database.ErrVersionConflict}, allow)
+		assert.Equal(permission.NewUpdateRolePermissionDefault(http.StatusConflict).WithPayload(&models.Error{
+			Code:    int64(mcomErrors.Code_NONE),
+			Details: database.ErrVersionConflict.Error(),
+		}), p.UpdateRolePermission(params, principal))
+	}
+	{ // not found.
+		p := NewPermission(&fakeManager{err: database.ErrRecordNotFound}, allow)
+		assert.Equal(permission.NewUpdateRolePermissionDefault(http.StatusNotFound).WithPayload(&models.Error{
+			Code:    int64(mcomErrors.Code_RECORD_NOT_FOUND),
+			Details: database.ErrRecordNotFound.Error(),
+		}), p.UpdateRolePermission(params, principal))
+	}
+	{ // forbidden.
+		p := NewPermission(&fakeManager{}, deny)
+		assert.Equal(permission.NewUpdateRolePermissionDefault(http.StatusForbidden), p.UpdateRolePermission(params, principal))
+	}
+}
+
+func TestPermission_DeleteRolePermission(t *testing.T) {
+	assert := assert.New(t)
+	params := permission.DeleteRolePermissionParams{
+		HTTPRequest:         httptest.NewRequest(http.MethodDelete, "/api/role-permissions/STATION_FORCE_SIGN_IN?version=2", nil),
+		FunctionOperationID: "STATION_FORCE_SIGN_IN",
+		Version:             2,
+	}
+
+	{ // success.
+		m := &fakeManager{}
+		p := NewPermission(m, allow)
+		assert.Equal(permission.NewDeleteRolePermissionOK(), p.DeleteRolePermission(params, principal))
+		assert.Equal(kenda.FunctionOperationID_STATION_FORCE_SIGN_IN, m.id)
+		assert.Equal(2, m.version)
+		assert.Equal(testUser, m.user)
+	}
+	{ // version conflict.
+		p := NewPermission(&fakeManager{err: database.ErrVersionConflict}, allow)
+		assert.Equal(permission.NewDeleteRolePermissionDefault(http.StatusConflict).WithPayload(&models.Error{
+			Code:    int64(mcomErrors.Code_NONE),
+			Details: database.ErrVersionConflict.Error(),
+		}), p.DeleteRolePermission(params, principal))
+	}
+	{ // forbidden.
+		p := NewPermission(&fakeManager{}, deny)
+		assert.Equal(permission.NewDeleteRolePermissionDefault(http.StatusForbidden), p.DeleteRolePermission(params, principal))
+	}
+}
+
+func TestPermission_ListRolePermissionChanges(t *testing.T) {
+	assert := assert.New(t)
+	params := permission.ListRolePermissionChangesParams{
+		HTTPRequest:         httptest.NewRequest(http.MethodGet, "/api/role-permissions/STATION_FORCE_SIGN_IN/history", nil),
+		FunctionOperationID: "STATION_FORCE_SIGN_IN",
+	}
+
+	{ // success.
+		m := &fakeManager{changes: []database.FunctionPermissionChange{
+			{
+				ID:         1,
+				FunctionID: kenda.FunctionOperationID_STATION_FORCE_SIGN_IN,
+				Version:    1,
+				Action:     database.PermissionCreated,
+				Roles:      database.Strings{"LEADER"},
+				CreatedBy:  testUser,
+				CreatedAt:  testTime,
+			},
+			{
+				ID:         2,
+				FunctionID: kenda.FunctionOperationID_STATION_FORCE_SIGN_IN,
+				Version:    2,
+				Action:     database.PermissionDeleted,
+				Roles:      database.Strings{},
+				CreatedBy:  testUser,
+				CreatedAt:  testTime,
+			},
+		}}
+		p := NewPermission(m, allow)
+		assert.Equal(permission.NewListRolePermissionChangesOK().WithPayload(&permission.ListRolePermissionChangesOKBody{
+			Data: []*models.RolePermissionChange{
+				{
+					Version:   1,
+					Action:    string(database.PermissionCreated),
+					Roles:     models.Roles{models.Role(mcomRoles.Role_LEADER)},
+					CreatedBy: testUser,
+					CreatedAt: strfmt.DateTime(testTime),
+				},
+				{
+					Version:   2,
+					Action:    string(database.PermissionDeleted),
+					Roles:     models.Roles{},
+					CreatedBy: testUser,
+					CreatedAt: strfmt.DateTime(testTime),
+				},
+			},
+		}), p.ListRolePermissionChanges(params, principal))
+		assert.Equal(kenda.FunctionOperationID_STATION_FORCE_SIGN_IN, m.id)
+	}
+	{ // internal error.
+		p := NewPermission(&fakeManager{err: errors.New(testInternalError)}, allow)
+		assert.Equal(permission.NewListRolePermissionChangesDefault(http.StatusInternalServerError).WithPayload(&models.Error{
+			Details: testInternalError,
+		}), p.ListRolePermissionChanges(params, principal))
+	}
+	{ // forbidden.
+		p := NewPermission(&fakeManager{}, deny)
+		assert.Equal(permission.NewListRolePermissionChangesDefault(http.StatusForbidden), p.ListRolePermissionChanges(params, principal))
+	}
+}
@@ -0,0 +1,75 @@
+package produce
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/shopspring/decimal"
+
+	mcomErrors "gitlab.kenda.com.tw/kenda/mcom/errors"
+
+	"gitlab.kenda.com.tw/kenda/mui/server/swagger/models"
+)
+
+// errMesCollectRejected is returned by the step of a collect rejected by MES.
+var errMesCollectRejected = errors.New("rejected by MES")
+
+// collectOutput is a resource produced by a collect.
+type collectOutput struct {
+	sequence   int16
+	quantity   decimal.Decimal
+	resourceID string
+	carrier    string
+	print      bool
+}
+
+type collectOutputs []collectOutput
+
+// print reports whether any label of the outputs is printed.
+func (outputs collectOutputs) print() bool {
+	for _, output := range outputs {
+		if output.print {
+			return true
+		}
+	}
+	return false
+}
+
+// parseCollectOutputs returns the outputs of a collect numbered by sequential
+// sequences from the sequence of single, or single itself if no output is
+// specified.
+func parseCollectOutputs(outputs models.CollectOutputs, single collectOutput) (collectOutputs, error) {
+	if len(outputs) == 0 {
+		return collectOutputs{single}, nil
+	}
+
+	resourceIDs := make(map[string]struct{}, len(outputs))
+	results := make(collectOutputs, len(outputs))
+	for i, output := range outputs {
+		quantity, err := decimal.NewFromString(*output.Quantity)
+		if err != nil || !quantity.IsPositive() {
+			return nil, mcomErrors.Error{
+				Code:    mcomErrors.Code_INVALID_NUMBER,
+				Details: fmt.Sprintf("invalid_number=%s", *output.Quantity),
+			}
+		}
+		if output.ResourceID != "" {
+			if _, ok := resourceIDs[output.ResourceID]; ok {
+				return nil, mcomErrors.Error{
+					Code:    mcomErrors.Code_BAD_REQUEST,
+					Details: fmt.Sprintf("duplicated resource: %s", output.ResourceID),
+				}
+			}
+			resourceIDs[output.ResourceID] = struct{}{}
+		}
+
+		results[i] = collectOutput{
+			sequence:   single.sequence + int16(i),
+			quantity:   quantity,
+			resourceID: output.ResourceID,
+			carrier:    output.CarrierResource,
+			print:      output.Print,
+		}
+	}
+	return results, nil
+}
@@ -0,0 +1,79 @@
+package produce
+
+import (
+	"testing"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+
+	mcomErrors "gitlab.kenda.com.tw/kenda/mcom/errors"
+
+	"gitlab.kenda.com.tw/kenda/mui/server/swagger/models"
+)
+
+func Test_parseCollectOutputs(t *testing.T) {
+	var (
+		quantity1 = "10"
+		quantity2 = "2.5"
+		invalid   = "-1"
+	)
+	single := collectOutput{
+		sequence:   5,
+		quantity:   decimal.RequireFromString("7"),
+		resourceID: testResourceID,
+		carrier:    "CARRIER",
+		print:      true,
+	}
+
+	tests := []struct {
+		name    string
+		outputs models.CollectOutputs
+		want    collectOutputs
+		wantErr error
+	}{
+		{
+			name: "single output",
+			want: collectOutputs{single},
+		},
+		{
+			name: "sequential sequences",
+			outputs: models.CollectOutputs{
+				{Quantity: &quantity1, ResourceID: "A", CarrierResource: "CARRIER", Print: true},
+				{Quantity: &quantity2},
+			},
+			want: collectOutputs{
+				{sequence: 5, quantity: decimal.RequireFromString(quantity1), resourceID: "A", carrier: "CARRIER", print: true},
+				{sequence: 6, quantity: decimal.RequireFromString(quantity2)},
+			},
+		},
+		{
+			name: "invalid quantity",
+			outputs: models.CollectOutputs{
+				{Quantity: &quantity1},
+				{Quantity: &invalid},
+			},
+			wantErr: mcomErrors.Error{
+				Code:    mcomErrors.Code_INVALID_NUMBER,
+				Details: "invalid_number=-1",
+			},
+		},
+		{
+			name: "duplicated resource",
+			outputs: models.CollectOutputs{
+				{Quantity: &quantity1, ResourceID: "A"},
+				{Quantity: &quantity2, ResourceID: "A"},
+			},
+			wantErr: mcomErrors.Error{
+				Code:    mcomErrors.Code_BAD_REQUEST,
+				Details: "duplicated resource: A",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseCollectOutputs(tt.outputs, single)
+			assert.Equal(t, tt.wantErr, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
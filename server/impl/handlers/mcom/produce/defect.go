@@ -0,0 +1,145 @@
+package produce
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/go-openapi/runtime/middleware"
+	"github.com/shopspring/decimal"
+
+	commonsCtx "gitlab.kenda.com.tw/kenda/commons/v2/utils/context"
+	mcomErrors "gitlab.kenda.com.tw/kenda/mcom/errors"
+
+	"gitlab.kenda.com.tw/kenda/mui/server/database"
+	"gitlab.kenda.com.tw/kenda/mui/server/impl/utils"
+	"gitlab.kenda.com.tw/kenda/mui/server/protobuf/kenda"
+	"gitlab.kenda.com.tw/kenda/mui/server/swagger/models"
+	"gitlab.kenda.com.tw/kenda/mui/server/swagger/restapi/operations/produce"
+)
+
+// ListDefectReasons implements.
+func (p Produce) ListDefectReasons(params produce.ListDefectReasonsParams, principal *models.Principal) middleware.Responder {
+	if !p.hasPermission(kenda.FunctionOperationID_LIST_DEFECT_REASONS, principal.Roles) {
+		return produce.NewListDefectReasonsDefault(http.StatusForbidden)
+	}
+	ctx := commonsCtx.WithUserID(params.HTTPRequest.Context(), principal.ID)
+
+	reasons, err := p.config.Defects.ListDefectReasons(ctx)
+	if err != nil {
+		return utils.ParseError(ctx, produce.NewListDefectReasonsDefault(0), err)
+	}
+
+	data := make([]*models.DefectReason, len(reasons))
+	for i, reason := range reasons {
+		code, kind := reason.Code, models.DefectKind(reason.Kind)
+		data[i] = &models.DefectReason{
+			Code:        &code,
+			Kind:        &kind,
+			Description: reason.Description,
+			Disabled:    reason.Disabled,
+		}
+	}
+	return produce.NewListDefectReasonsOK().WithPayload(&produce.ListDefectReasonsOKBody{
+		Data: data,
+	})
+}
+
+// CreateDefectReason implements.
+func (p Produce) CreateDefectReason(params produce.CreateDefectReasonParams, principal *models.Principal) middleware.Responder {
+	if !p.hasPermission(kenda.FunctionOperationID_CREATE_DEFECT_REASON, principal.Roles) {
+		return produce.NewCreateDefectReasonDefault(http.StatusForbidden)
+	}
+	ctx := commonsCtx.WithUserID(params.HTTPRequest.Context(), principal.ID)
+
+	kind := database.DefectKind(*params.Body.Kind)
+	if !kind.Valid() {
+		return utils.ParseError(ctx, produce.NewCreateDefectReasonDefault(0), mcomErrors.Error{
+			Code:    mcomErrors.Code_BAD_REQUEST,
+			Details: fmt.Sprintf("invalid defect kind: %s", kind),
+		})
+	}
+
+	if err := p.config.Defects.CreateDefectReason(ctx, database.DefectReason{
+		Code:        *params.Body.Code,
+		Kind:        kind,
+		Description: params.Body.Description,
+		Disabled:    params.Body.Disabled,
+		UpdatedBy:   principal.ID,
+	}); err != nil {
+		return utils.ParseError(ctx, produce.NewCreateDefectReasonDefault(0),
+			fmt.Errorf("defect reason %s: %w", *params.Body.Code, err))
+	}
+	return produce.NewCreateDefectReasonOK()
+}
+
+// UpdateDefectReason implements.
+func (p Produce) UpdateDefectReason(params produce.UpdateDefectReasonParams, principal *models.Principal) middleware.Responder {
+	if !p.hasPermission(kenda.FunctionOperationID_UPDATE_DEFECT_REASON, principal.Roles) {
+		return produce.NewUpdateDefectReasonDefault(http.StatusForbidden)
+	}
+	ctx := commonsCtx.WithUserID(params.HTTPRequest.Context(), principal.ID)
+
+	kind := database.DefectKind(*params.Body.Kind)
+	if !kind.Valid() {
+		return utils.ParseError(ctx, produce.NewUpdateDefectReasonDefault(0), mcomErrors.Error{
+			Code:    mcomErrors.Code_BAD_REQUEST,
+			Details: fmt.Sprintf("invalid defect kind: %s", kind),
+		})
+	}
+
+	if err := p.config.Defects.UpdateDefectReason(ctx, database.DefectReason{
+		Code:        params.Code,
+		Kind:        kind,
+		Description: params.Body.Description,
+		Disabled:    params.Body.Disabled,
+		UpdatedBy:   principal.ID,
+	}); err != nil {
+		return utils.ParseError(ctx, produce.NewUpdateDefectReasonDefault(0),
+			fmt.Errorf("defect reason %s: %w", params.Code, err))
+	}
+	return produce.NewUpdateDefectReasonOK()
+}
+
+// parseCollectDefects checks the defects of a collect against the defect
+// reasons, and returns them recorded against the specified collect.
+func (p Produce) parseCollectDefects(ctx context.Context, defects models.CollectDefects, collect database.CollectDefect) ([]database.CollectDefect, error) {
+	if len(defects) == 0 {
+		return nil, nil
+	}
+
+	reasons, err := p.config.Defects.ListDefectReasons(ctx)
+	if err != nil {
+		return nil, err
+	}
+	kinds := make(map[string]database.DefectKind, len(reasons))
+	for _, reason := range reasons {
+		if !reason.Disabled {
+			kinds[reason.Code] = reason.Kind
+		}
+	}
+
+	records := make([]database.CollectDefect, len(defects))
+	for i, defect := range defects {
+		kind, ok := kinds[*defect.ReasonCode]
+		if !ok {
+			return nil, mcomErrors.Error{
+				Code:    mcomErrors.Code_BAD_REQUEST,
+				Details: fmt.Sprintf("unknown or disabled defect reason: %s", *defect.ReasonCode),
+			}
+		}
+		quantity, err := decimal.NewFromString(*defect.Quantity)
+		if err != nil || !quantity.IsPositive() {
+			return nil, mcomErrors.Error{
+				Code:    mcomErrors.Code_INVALID_NUMBER,
+				Details: fmt.Sprintf("invalid_number=%s", *defect.Quantity),
+			}
+		}
+
+		records[i] = collect
+		records[i].ReasonCode = *defect.ReasonCode
+		records[i].Kind = kind
+		records[i].Quantity = quantity
+	}
+	return records, nil
+}
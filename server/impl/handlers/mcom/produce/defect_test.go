@@ -0,0 +1,214 @@
+package produce
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+
+	mcomErrors "gitlab.kenda.com.tw/kenda/mcom/errors"
+	"gitlab.kenda.com.tw/kenda/mcom/mock"
+
+	"gitlab.kenda.com.tw/kenda/mui/server/database"
+	"gitlab.kenda.com.tw/kenda/mui/server/database/storetest"
+	"gitlab.kenda.com.tw/kenda/mui/server/protobuf/kenda"
+	"gitlab.kenda.com.tw/kenda/mui/server/swagger/models"
+	"gitlab.kenda.com.tw/kenda/mui/server/swagger/restapi/operations/produce"
+)
+
+// newDefectStore returns a defect store of the reasons.
+func newDefectStore(t *testing.T, reasons ...database.DefectReason) database.DefectStore {
+	store := storetest.New(t).Defects
+	for _, reason := range reasons {
+		if err := store.CreateDefectReason(context.Background(), reason); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return store
+}
+
+func TestProduce_DefectReasons(t *testing.T) {
+	var (
+		testCode    = "BUBBLE"
+		testNewCode = "BURNT"
+		defect      = models.DefectKind(database.DefectKindDefect)
+		scrap       = models.DefectKind(database.DefectKindScrap)
+		unknown     = models.DefectKind("UNKNOWN")
+	)
+	assert := assert.New(t)
+	httpRequest := httptest.NewRequest("GET", "/production-flow/defect-reasons", nil)
+	allow := func(id kenda.FunctionOperationID, roles []models.Role) bool {
+		return true
+	}
+
+	dm, err := mock.New(nil)
+	assert.NoError(err)
+	store := newDefectStore(t, database.DefectReason{
+		Code:        testCode,
+		Kind:        database.DefectKindDefect,
+		Description: "bubbles",
+	})
+	s := NewProduce(dm, allow, Config{Defects: store})
+
+	{ // create.
+		assert.Equal(produce.NewCreateDefectReasonOK(), s.CreateDefectReason(produce.CreateDefectReasonParams{
+			HTTPRequest: httpRequest,
+			Body: &models.DefectReason{
+				Code: &testNewCode,
+				Kind: &scrap,
+			},
+		}, principal))
+		reasons, err := store.ListDefectReasons(context.Background())
+		assert.NoError(err)
+		if assert.Len(reasons, 2) {
+			reasons[1].UpdatedAt = time.Time{}
+			assert.Equal(database.DefectReason{
+				Code:      testNewCode,
+				Kind:      database.DefectKindScrap,
+				UpdatedBy: userID,
+			}, reasons[1])
+		}
+	}
+	{ // create existed.
+		assert.Equal(produce.NewCreateDefectReasonDefault(http.StatusConflict).WithPayload(&models.Error{
+			Code:    int64(mcomErrors.Code_RECORD_ALREADY_EXISTS),
+			Details: fmt.Sprintf("defect reason %s: record existed", testCode),
+		}), s.CreateDefectReason(produce.CreateDefectReasonParams{
+			HTTPRequest: httpRequest,
+			Body: &models.DefectReason{
+				Code: &testCode,
+				Kind: &defect,
+			},
+		}, principal))
+	}
+	{ // create with unknown kind.
+		assert.Equal(produce.NewCreateDefectReasonDefault(http.StatusBadRequest).WithPayload(&models.Error{
+			Code:    int64(mcomErrors.Code_BAD_REQUEST),
+			Details: "invalid defect kind: UNKNOWN",
+		}), s.CreateDefectReason(produce.CreateDefectReasonParams{
+			HTTPRequest: httpRequest,
+			Body: &models.DefectReason{
+				Code: &testCode,
+				Kind: &unknown,
+			},
+		}, principal))
+	}
+	{ // disable.
+		assert.Equal(produce.NewUpdateDefectReasonOK(), s.UpdateDefectReason(produce.UpdateDefectReasonParams{
+			HTTPRequest: httpRequest,
+			Code:        testCode,
+			Body: produce.UpdateDefectReasonBody{
+				Kind:        &defect,
+				Description: "bubbles",
+				Disabled:    true,
+			},
+		}, principal))
+	}
+	{ // update not found.
+		assert.Equal(produce.NewUpdateDefectReasonDefault(http.StatusNotFound).WithPayload(&models.Error{
+			Code:    int64(mcomErrors.Code_RECORD_NOT_FOUND),
+			Details: "defect reason NOTFOUND: record not found",
+		}), s.UpdateDefectReason(produce.UpdateDefectReasonParams{
+			HTTPRequest: httpRequest,
+			Code:        "NOTFOUND",
+			Body: produce.UpdateDefectReasonBody{
+				Kind: &defect,
+			},
+		}, principal))
+	}
+	{ // list.
+		assert.Equal(produce.NewListDefectReasonsOK().WithPayload(&produce.ListDefectReasonsOKBody{
+			Data: []*models.DefectReason{
+				{
+					Code:        &testCode,
+					Kind:        &defect,
+					Description: "bubbles",
+					Disabled:    true,
+				},
+				{
+					Code: &testNewCode,
+					Kind: &scrap,
+				},
+			},
+		}), s.ListDefectReasons(produce.ListDefectReasonsParams{HTTPRequest: httpRequest}, principal))
+	}
+	assert.NoError(dm.Close())
+
+	{ // forbidden access
+		dm, err := mock.New(nil)
+		assert.NoError(err)
+		s := NewProduce(dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
+			return false
+		}, Config{Defects: newDefectStore(t)})
+		assert.Equal(produce.NewListDefectReasonsDefault(http.StatusForbidden),
+			s.ListDefectReasons(produce.ListDefectReasonsParams{HTTPRequest: httpRequest}, principal))
+		assert.Equal(produce.NewCreateDefectReasonDefault(http.StatusForbidden),
+			s.CreateDefectReason(produce.CreateDefectReasonParams{HTTPRequest: httpRequest}, principal))
+		assert.Equal(produce.NewUpdateDefectReasonDefault(http.StatusForbidden),
+			s.UpdateDefectReason(produce.UpdateDefectReasonParams{HTTPRequest: httpRequest}, principal))
+		assert.NoError(dm.Close())
+	}
+}
+
+func TestProduce_parseCollectDefects(t *testing.T) {
+	assert := assert.New(t)
+	p := Produce{config: Config{Defects: newDefectStore(t,
+		database.DefectReason{Code: "BUBBLE", Kind: database.DefectKindDefect},
+		database.DefectReason{Code: "BURNT", Kind: database.DefectKindScrap},
+		database.DefectReason{Code: "OLD", Kind: database.DefectKindScrap, Disabled: true},
+	)}}
+	newDefect := func(code, quantity string) *models.CollectDefectsItems0 {
+		return &models.CollectDefectsItems0{
+			ReasonCode: &code,
+			Quantity:   &quantity,
+		}
+	}
+	collect := database.CollectDefect{
+		WorkOrder: testWorkOrder1,
+		Sequence:  int16(testSequence),
+		Batch:     1,
+		Station:   testStationA,
+		CreatedBy: userID,
+	}
+
+	{ // no defects.
+		defects, err := p.parseCollectDefects(context.Background(), nil, collect)
+		assert.NoError(err)
+		assert.Nil(defects)
+	}
+	{ // good case.
+		defects, err := p.parseCollectDefects(context.Background(), models.CollectDefects{
+			newDefect("BUBBLE", "1.5"),
+			newDefect("BURNT", "2"),
+		}, collect)
+		assert.NoError(err)
+
+		bubble, burnt := collect, collect
+		bubble.ReasonCode, bubble.Kind, bubble.Quantity = "BUBBLE", database.DefectKindDefect, decimal.RequireFromString("1.5")
+		burnt.ReasonCode, burnt.Kind, burnt.Quantity = "BURNT", database.DefectKindScrap, decimal.RequireFromString("2")
+		assert.Equal([]database.CollectDefect{bubble, burnt}, defects)
+	}
+	{ // disabled reason.
+		_, err := p.parseCollectDefects(context.Background(), models.CollectDefects{
+			newDefect("OLD", "1"),
+		}, collect)
+		assert.Equal(mcomErrors.Error{
+			Code:    mcomErrors.Code_BAD_REQUEST,
+			Details: "unknown or disabled defect reason: OLD",
+		}, err)
+	}
+	{ // invalid quantity.
+		_, err := p.parseCollectDefects(context.Background(), models.CollectDefects{
+			newDefect("BUBBLE", "-1"),
+		}, collect)
+		assert.Equal(mcomErrors.Error{
+			Code:    mcomErrors.Code_INVALID_NUMBER,
+			Details: "invalid_number=-1",
+		}, err)
+	}
+}
@@ -0,0 +1,164 @@
+package produce
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/shopspring/decimal"
+
+	"gitlab.kenda.com.tw/kenda/mcom"
+	mcomErrors "gitlab.kenda.com.tw/kenda/mcom/errors"
+	mcomModels "gitlab.kenda.com.tw/kenda/mcom/impl/orm/models"
+
+	"gitlab.kenda.com.tw/kenda/mui/server/database"
+	handlerUtils "gitlab.kenda.com.tw/kenda/mui/server/impl/handlers/mcom/utils"
+	"gitlab.kenda.com.tw/kenda/mui/server/swagger/restapi/operations/produce"
+)
+
+// feedCompensationReason is the reason of the unfeed records by which a
+// failed feed collect returns the fed quantities.
+const feedCompensationReason = "feed collect failed"
+
+// feedSources are the fed sites and their resources before the feed.
+type feedSources struct {
+	// siteResources are the resources bound to each of the fed sites.
+	siteResources [][]string
+	// materials are the resources bound to the fed sites, by which the fed
+	// quantities are restored.
+	materials []mcom.MaterialReply
+}
+
+// siteStock is the quantity bound to a site and the quantity fed from it.
+type siteStock struct {
+	quantity decimal.Decimal
+	// limited is false if the quantity of any resource of the site is not
+	// known, and then the site is not checked.
+	limited bool
+	fed     decimal.Decimal
+}
+
+// checkFeedSources lists the resources of the fed sites and checks that every
+// site has the fed quantity and no resource in aging before anything is
+// changed.
+func (p Produce) checkFeedSources(ctx context.Context, sources []*produce.FeedCollectParamsBodyFeedSourceItems0) (feedSources, error) {
+	result := feedSources{siteResources: make([][]string, len(sources))}
+	sites := make([]mcomModels.UniqueSite, len(sources))
+	stocks := make(map[mcomModels.UniqueSite]*siteStock, len(sources))
+	listed := make(map[string]struct{})
+	for i, source := range sources {
+		sites[i] = mcomModels.UniqueSite{
+			Station: source.SiteInfo.StationID,
+			SiteID: mcomModels.SiteID{
+				Name:  source.SiteInfo.SiteName,
+				Index: int16(source.SiteInfo.SiteIndex),
+			},
+		}
+		materials, err := p.dm.ListSiteMaterials(ctx, mcom.ListSiteMaterialsRequest{
+			Station: sites[i].Station,
+			Site:    sites[i].SiteID,
+		})
+		if err != nil {
+			return feedSources{}, err
+		}
+
+		stock, ok := stocks[sites[i]]
+		if !ok {
+			stock = &siteStock{limited: true}
+			stocks[sites[i]] = stock
+		}
+		stock.fed = stock.fed.Add(decimal.NewFromFloat(source.Quantity))
+		for _, material := range materials {
+			result.siteResources[i] = append(result.siteResources[i], material.ResourceID)
+			if ok {
+				continue
+			}
+			if material.Quantity == nil {
+				stock.limited = false
+			} else {
+				stock.quantity = stock.quantity.Add(*material.Quantity)
+			}
+
+			if _, ok := listed[material.ResourceID]; ok {
+				continue
+			}
+			listed[material.ResourceID] = struct{}{}
+			replies, err := p.dm.GetMaterialResource(ctx, mcom.GetMaterialResourceRequest{
+				ResourceID: material.ResourceID,
+			})
+			if err != nil {
+				return feedSources{}, err
+			}
+			result.materials = append(result.materials, replies...)
+		}
+	}
+
+	for i, site := range sites {
+		stock := stocks[site]
+		if stock.limited && stock.quantity.LessThan(stock.fed) {
+			return feedSources{}, mcomErrors.Error{
+				Code: mcomErrors.Code_RESOURCE_MATERIAL_SHORTAGE,
+				Details: fmt.Sprintf("site %s(%d) of station %s has %s, less than the fed quantity %s",
+					sources[i].SiteInfo.SiteName, sources[i].SiteInfo.SiteIndex, site.Station, stock.quantity, stock.fed),
+			}
+		}
+	}
+
+	// the resources bound through MES are not checked until they are fed.
+	resources := make([]mcom.BindMaterialResource, len(result.materials))
+	for i, material := range result.materials {
+		resources[i] = mcom.BindMaterialResource{
+			ResourceID:  material.Material.ResourceID,
+			ProductType: material.Material.Type,
+		}
+	}
+	if _, err := handlerUtils.CheckAgingHolds(ctx, p.config.Holds, resources, false, ""); err != nil {
+		return feedSources{}, err
+	}
+	return result, nil
+}
+
+// restore returns the quantities consumed since the sources were listed to
+// the resources, and records them as the unfeeds of the feed record since the
+// feed records can not be removed.
+func (sources feedSources) restore(ctx context.Context, p Produce, batch mcom.BatchID, feedRecordID, user string) error {
+	for _, before := range sources.materials {
+		replies, err := p.dm.GetMaterialResource(ctx, mcom.GetMaterialResourceRequest{
+			ResourceID: before.Material.ResourceID,
+		})
+		if err != nil {
+			return err
+		}
+		for _, after := range replies {
+			if after.Material.Type != before.Material.Type {
+				continue
+			}
+			consumed := before.Material.Quantity.Sub(after.Material.Quantity)
+			if !consumed.IsPositive() {
+				continue
+			}
+
+			if err := p.dm.UpdateMaterialResource(ctx, mcom.UpdateMaterialResourceRequest{
+				ResourceID:  before.Material.ResourceID,
+				ProductType: before.Material.Type,
+				Status:      before.Material.Status,
+				Quantity:    before.Material.Quantity,
+				Remark:      before.Material.Remark,
+			}); err != nil {
+				return err
+			}
+			if err := p.config.Feeds.CreateUnfeedRecord(ctx, database.UnfeedRecord{
+				WorkOrder:    batch.WorkOrder,
+				Batch:        batch.Number,
+				FeedRecordID: feedRecordID,
+				ResourceID:   before.Material.ResourceID,
+				ProductType:  before.Material.Type,
+				Quantity:     consumed,
+				Reason:       feedCompensationReason,
+				CreatedBy:    user,
+			}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -1,6 +1,8 @@
 package produce
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
@@ -8,6 +10,7 @@ import (
 
 	"github.com/go-openapi/runtime/middleware"
 	"github.com/shopspring/decimal"
+	"go.uber.org/zap"
 
 	"gitlab.kenda.com.tw/kenda/commons/v2/proto/golang/mes/v2/workorder"
 	commonsCtx "gitlab.kenda.com.tw/kenda/commons/v2/utils/context"
@@ -17,15 +20,21 @@ import (
 	utilsResources "gitlab.kenda.com.tw/kenda/mcom/utils/resources"
 	"gitlab.kenda.com.tw/kenda/mcom/utils/stations"
 
+	"gitlab.kenda.com.tw/kenda/mui/server/database"
 	"gitlab.kenda.com.tw/kenda/mui/server/impl/handlers/mcom/internal/printer"
 	handlerUtils "gitlab.kenda.com.tw/kenda/mui/server/impl/handlers/mcom/utils"
 	"gitlab.kenda.com.tw/kenda/mui/server/impl/handlers/mcom/utils/barcodes"
 	"gitlab.kenda.com.tw/kenda/mui/server/impl/service"
 	"gitlab.kenda.com.tw/kenda/mui/server/impl/utils"
+	"gitlab.kenda.com.tw/kenda/mui/server/impl/utils/idrule"
+	"gitlab.kenda.com.tw/kenda/mui/server/impl/utils/oee"
+	"gitlab.kenda.com.tw/kenda/mui/server/impl/utils/saga"
 	mesModels "gitlab.kenda.com.tw/kenda/mui/server/mes"
 	"gitlab.kenda.com.tw/kenda/mui/server/protobuf/kenda"
 	"gitlab.kenda.com.tw/kenda/mui/server/swagger/models"
 	"gitlab.kenda.com.tw/kenda/mui/server/swagger/restapi/operations/produce"
+	"gitlab.kenda.com.tw/kenda/mui/server/swagger/restapi/operations/site"
+	"gitlab.kenda.com.tw/kenda/mui/server/swagger/restapi/operations/station"
 )
 
 const (
@@ -36,6 +45,34 @@ type Config struct {
 	Printers map[string]string
 	FontPath string
 	MesPath  string
+	// Collects keeps the collects created by MES and the reversals.
+	Collects database.CollectStore
+	// Feeds keeps the returns of the fed quantities.
+	Feeds database.FeedStore
+	// Defects keeps the defect reasons and the defects of the collects.
+	Defects database.DefectStore
+	// IDRules generates the lot numbers and the resource IDs.
+	IDRules *idrule.Generator
+	// Scales reads the weights of the weighed collects.
+	Scales ScaleReader
+	// Syncs keeps the operations synchronized by the offline PDAs.
+	Syncs database.SyncStore
+	// Holds keeps the collected resources until their minimum aging times
+	// elapse, before which they can not be fed.
+	Holds database.HoldStore
+	// Records keeps the feed and the collect records for the queries.
+	Records database.RecordStore
+	// StationLogs keeps the sign-ins and the downtimes of the stations, and
+	// Shifts are the shifts by which the OEE is calculated.
+	StationLogs database.StationLogStore
+	Shifts      []oee.Shift
+	// CycleTimeControl is the common control of the recipes whose value is
+	// the standard cycle time in seconds, DefaultCycleTimeControl if empty.
+	CycleTimeControl string
+	// BindSiteResources and SignInStation are the handlers by which the
+	// operations of the offline PDAs are replayed.
+	BindSiteResources func(params site.AutoBindSiteResourcesParams, principal *models.Principal) middleware.Responder
+	SignInStation     func(params station.StationForceSignInParams, principal *models.Principal) middleware.Responder
 }
 
 // Produce definitions
@@ -60,7 +97,9 @@ func NewProduce(
 	}
 }
 
-// FeedCollect implements.
+// FeedCollect implements. The feed and the collect are done as a saga: the
+// request is checked before anything is changed, and the completed steps are
+// compensated if a later step fails.
 func (p Produce) FeedCollect(params produce.FeedCollectParams, principal *models.Principal) middleware.Responder {
 	if !p.hasPermission(kenda.FunctionOperationID_FEED_COLLECT, principal.Roles) {
 		return produce.NewFeedCollectDefault(http.StatusForbidden)
@@ -69,7 +108,21 @@ func (p Produce) FeedCollect(params produce.FeedCollectParams, principal *models
 
 	ctx := commonsCtx.WithUserID(params.HTTPRequest.Context(), principal.ID)
 
-	// Feed steps
+	batchID := mcom.BatchID{
+		WorkOrder: params.WorkOrderID,
+		Number:    int16(params.Body.Feed.Batch),
+	}
+	outputs, err := parseCollectOutputs(params.Body.Collect.Outputs, collectOutput{
+		sequence:   int16(params.Body.Collect.Sequence),
+		quantity:   decimal.NewFromFloat(params.Body.Collect.Quantity),
+		resourceID: params.Body.Collect.ResourceID,
+		carrier:    params.Body.Collect.CarrierResource,
+		print:      params.Body.Collect.Print,
+	})
+	if err != nil {
+		return utils.ParseError(ctx, produce.NewFeedCollectDefault(0), err)
+	}
+
 	// Check work order
 	getWorkOrder, err := p.dm.GetWorkOrder(ctx, mcom.GetWorkOrderRequest{
 		ID: params.WorkOrderID,
@@ -77,34 +130,27 @@ func (p Produce) FeedCollect(params produce.FeedCollectParams, principal *models
 	if err != nil {
 		return utils.ParseError(ctx, produce.NewFeedCollectDefault(0), err)
 	}
+	if params.Body.Collect.Weighed {
+		if outputs[0].quantity, err = p.weighCollect(ctx, params.Body.StationID, getWorkOrder.Unit, params.Body.Collect.Outputs); err != nil {
+			return utils.ParseError(ctx, produce.NewFeedCollectDefault(0), err)
+		}
+	}
 
-	// Check batch
+	// Check batch, which is created later if not exist
+	batchExisted := true
 	batch, err := p.dm.GetBatch(ctx, mcom.GetBatchRequest{
-		WorkOrder: getWorkOrder.ID,
-		Number:    int16(params.Body.Feed.Batch),
+		WorkOrder: batchID.WorkOrder,
+		Number:    batchID.Number,
 	})
 	if err != nil {
-		e, ok := mcomErrors.As(err)
-		if !ok {
+		if e, ok := mcomErrors.As(err); !ok || e.Code != mcomErrors.Code_BATCH_NOT_FOUND {
 			return utils.ParseError(ctx, produce.NewFeedCollectDefault(0), err)
 		}
-		// if batch not exist, create batch
-		if e.Code == mcomErrors.Code_BATCH_NOT_FOUND {
-			if err := p.dm.CreateBatch(ctx, mcom.CreateBatchRequest{
-				WorkOrder: params.WorkOrderID,
-				Number:    int16(params.Body.Feed.Batch),
-				Status:    workOrderBatchStarted,
-			}); err != nil {
-				return utils.ParseError(ctx, produce.NewFeedCollectDefault(0), err)
-			}
-		} else {
-			return utils.ParseError(ctx, produce.NewFeedCollectDefault(0), err)
-		}
-
+		batchExisted = false
 		batch = mcom.GetBatchReply{
 			Info: mcom.BatchInfo{
-				WorkOrder: params.WorkOrderID,
-				Number:    int16(params.Body.Feed.Batch),
+				WorkOrder: batchID.WorkOrder,
+				Number:    batchID.Number,
 				Status:    int32(workOrderBatchStarted),
 			},
 		}
@@ -118,142 +164,362 @@ func (p Produce) FeedCollect(params produce.FeedCollectParams, principal *models
 		})
 	}
 
-	// Feed
-	_, err = p.dm.Feed(ctx, mcom.FeedRequest{
-		Batch: mcom.BatchID{
-			WorkOrder: params.WorkOrderID,
-			Number:    int16(params.Body.Feed.Batch),
-		},
-		FeedContent: parseFeedResource(params.Body.Feed.Source),
+	// Get station code
+	getStation, err := p.dm.GetStation(ctx, mcom.GetStationRequest{
+		ID: params.Body.StationID,
 	})
 	if err != nil {
 		return utils.ParseError(ctx, produce.NewFeedCollectDefault(0), err)
 	}
-
-	// closing the batch
-	if err := p.dm.UpdateBatch(ctx, mcom.UpdateBatchRequest{
-		WorkOrder: params.WorkOrderID,
-		Number:    int16(params.Body.Feed.Batch),
-		Status:    workorder.BatchStatus_BATCH_CLOSING,
-	}); err != nil {
-		return utils.ParseError(ctx, produce.NewFeedCollectDefault(0), err)
+	idValues := idrule.Values{
+		Time:        date,
+		Group:       int(params.Body.Collect.Group),
+		Station:     params.Body.StationID,
+		StationCode: getStation.Information.Code,
+		ProductID:   getWorkOrder.Product.ID,
+		ProductType: getWorkOrder.Product.Type,
 	}
-
-	// Collect steps
-	// Get station code
-	getStation, err := p.dm.GetStation(ctx, mcom.GetStationRequest{
-		ID: params.Body.StationID,
-	})
+	lotNumber, err := p.config.IDRules.LotNumber(ctx, idValues)
 	if err != nil {
 		return utils.ParseError(ctx, produce.NewFeedCollectDefault(0), err)
 	}
-	stationCode := getStation.Information.Code
-	if len(stationCode) == 1 {
-		stationCode = "0" + stationCode
+	for i := range outputs {
+		if outputs[i].resourceID != "" {
+			continue
+		}
+		if outputs[i].resourceID, err = p.config.IDRules.ResourceID(ctx, idValues); err != nil {
+			return utils.ParseError(ctx, produce.NewFeedCollectDefault(0), err)
+		}
 	}
-	lotNumber := fmt.Sprintf("%d%s-%02d%02d", params.Body.Collect.Group, stationCode[0:2], date.Month(), date.Day())
 
-	carrier := params.Body.Collect.CarrierResource
-	if carrier != "" {
+	// the outputs in the same carrier replace its current resources together.
+	var carriers []string
+	carrierContents := make(map[string][]string)
+	for _, output := range outputs {
+		if output.carrier == "" {
+			continue
+		}
+		if _, ok := carrierContents[output.carrier]; ok {
+			continue
+		}
 		// check if the carrier is existed
-		_, err := p.dm.GetCarrier(ctx, mcom.GetCarrierRequest{
-			ID: params.Body.Collect.CarrierResource,
+		getCarrier, err := p.dm.GetCarrier(ctx, mcom.GetCarrierRequest{
+			ID: output.carrier,
 		})
 		if err != nil {
 			return utils.ParseError(ctx, produce.NewFeedCollectDefault(0), err)
 		}
+		carriers = append(carriers, output.carrier)
+		carrierContents[output.carrier] = getCarrier.Contents
 	}
 
-	// Get resource oid
-	now := time.Now()
 	getLimitaryHour, err := p.dm.GetLimitaryHour(ctx, mcom.GetLimitaryHourRequest{ProductType: getWorkOrder.Product.Type})
 	if err != nil {
 		if e, ok := mcomErrors.As(err); !ok || e.Code != mcomErrors.Code_LIMITARY_HOUR_NOT_FOUND {
 			return utils.ParseError(ctx, produce.NewFeedCollectDefault(0), err)
 		}
 	}
-	expiryTime := now.Add(time.Duration(getLimitaryHour.LimitaryHour.Max) * time.Hour)
 
-	resources, err := p.dm.CreateMaterialResources(ctx, mcom.CreateMaterialResourcesRequest{
-		Materials: []mcom.CreateMaterialResourcesRequestDetail{
-			{
-				ID:             getWorkOrder.Product.ID,
-				Type:           getWorkOrder.Product.Type,
-				Status:         utilsResources.MaterialStatus_AVAILABLE,
-				Quantity:       decimal.NewFromFloat(params.Body.Collect.Quantity),
-				Unit:           getWorkOrder.Unit,
-				LotNumber:      lotNumber,
-				ResourceID:     params.Body.Collect.ResourceID,
-				CarrierID:      carrier,
-				ProductionTime: now,
-				ExpiryTime:     expiryTime,
-			},
-		},
+	stationPrinter := p.config.Printers[getWorkOrder.Station]
+	if outputs.print() && stationPrinter == "" {
+		return utils.ParseError(ctx, produce.NewFeedCollectDefault(0), mcomErrors.Error{
+			Code:    mcomErrors.Code_STATION_PRINTER_NOT_DEFINED,
+			Details: fmt.Sprintf("station %s no defined printer", getWorkOrder.Station),
+		})
+	}
+
+	defects, err := p.parseCollectDefects(ctx, params.Body.Collect.Defects, database.CollectDefect{
+		WorkOrder: params.WorkOrderID,
+		Sequence:  int16(params.Body.Collect.Sequence),
+		Batch:     batchID.Number,
+		Station:   params.Body.StationID,
+		CreatedBy: principal.ID,
 	})
 	if err != nil {
 		return utils.ParseError(ctx, produce.NewFeedCollectDefault(0), err)
 	}
 
-	if carrier != "" {
-		// replace the current resource in the carrier
-		err = p.dm.UpdateCarrier(ctx, mcom.UpdateCarrierRequest{
-			ID:     carrier,
-			Action: mcom.ClearResources{},
+	// the resources bound to the fed sites are kept with the feed records for
+	// the genealogy of the outputs, and restored if the feed is compensated.
+	sources, err := p.checkFeedSources(ctx, params.Body.Feed.Source)
+	if err != nil {
+		return utils.ParseError(ctx, produce.NewFeedCollectDefault(0), err)
+	}
+
+	now := time.Now()
+	expiryTime := now.Add(time.Duration(getLimitaryHour.LimitaryHour.Max) * time.Hour)
+
+	var (
+		feedRecordID string
+		resources    mcom.CreateMaterialResourcesReply
+		steps        []saga.Step
+	)
+	if !batchExisted {
+		steps = append(steps, saga.Step{
+			Name: "CREATE_BATCH",
+			Do: func(ctx context.Context) error {
+				return p.dm.CreateBatch(ctx, mcom.CreateBatchRequest{
+					WorkOrder: batchID.WorkOrder,
+					Number:    batchID.Number,
+					Status:    workOrderBatchStarted,
+				})
+			},
+			Compensate: func(ctx context.Context) error {
+				return p.dm.UpdateBatch(ctx, mcom.UpdateBatchRequest{
+					WorkOrder: batchID.WorkOrder,
+					Number:    batchID.Number,
+					Status:    workorder.BatchStatus_BATCH_CANCELLED,
+				})
+			},
 		})
-		if err != nil {
-			return utils.ParseError(ctx, produce.NewFeedCollectDefault(0), err)
+	}
+	steps = append(steps,
+		saga.Step{
+			Name: "FEED",
+			Do: func(ctx context.Context) error {
+				reply, err := p.dm.Feed(ctx, mcom.FeedRequest{
+					Batch:       batchID,
+					FeedContent: parseFeedResource(params.Body.Feed.Source),
+				})
+				feedRecordID = reply.FeedRecordID
+				return err
+			},
+			Compensate: func(ctx context.Context) error {
+				return sources.restore(ctx, p, batchID, feedRecordID, principal.ID)
+			},
+		},
+		saga.Step{
+			Name: "CLOSE_BATCH",
+			Do: func(ctx context.Context) error {
+				return p.dm.UpdateBatch(ctx, mcom.UpdateBatchRequest{
+					WorkOrder: batchID.WorkOrder,
+					Number:    batchID.Number,
+					Status:    workorder.BatchStatus_BATCH_CLOSING,
+				})
+			},
+			Compensate: func(ctx context.Context) error {
+				return p.dm.UpdateBatch(ctx, mcom.UpdateBatchRequest{
+					WorkOrder: batchID.WorkOrder,
+					Number:    batchID.Number,
+					Status:    workorder.BatchStatus(batch.Info.Status),
+				})
+			},
+		},
+		saga.Step{
+			Name: "CREATE_RESOURCE",
+			Do: func(ctx context.Context) error {
+				materials := make([]mcom.CreateMaterialResourcesRequestDetail, len(outputs))
+				for i, output := range outputs {
+					materials[i] = mcom.CreateMaterialResourcesRequestDetail{
+						ID:             getWorkOrder.Product.ID,
+						Type:           getWorkOrder.Product.Type,
+						Status:         utilsResources.MaterialStatus_AVAILABLE,
+						Quantity:       output.quantity,
+						Unit:           getWorkOrder.Unit,
+						LotNumber:      lotNumber,
+						ResourceID:     output.resourceID,
+						CarrierID:      output.carrier,
+						ProductionTime: now,
+						ExpiryTime:     expiryTime,
+					}
+				}
+				var err error
+				resources, err = p.dm.CreateMaterialResources(ctx, mcom.CreateMaterialResourcesRequest{
+					Materials: materials,
+				})
+				return err
+			},
+			// the created resources can not be removed, they are left unavailable.
+			Compensate: func(ctx context.Context) error {
+				for _, resource := range resources {
+					if err := p.dm.UpdateMaterialResource(ctx, mcom.UpdateMaterialResourceRequest{
+						ResourceID:  resource.ID,
+						ProductType: getWorkOrder.Product.Type,
+						Status:      utilsResources.MaterialStatus_UNAVAILABLE,
+						Quantity:    decimal.Zero,
+						Remark:      feedCompensationReason,
+					}); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		},
+	)
+	if getLimitaryHour.LimitaryHour.Min > 0 {
+		var ids []string
+		steps = append(steps, saga.Step{
+			Name: "HOLD_RESOURCE",
+			Do: func(ctx context.Context) error {
+				ids = make([]string, len(resources))
+				for i, resource := range resources {
+					ids[i] = resource.ID
+				}
+				return p.config.Holds.CreateAgingHolds(ctx, handlerUtils.AgingHolds(now, getLimitaryHour.LimitaryHour, getWorkOrder.Product.Type, ids...))
+			},
+			Compensate: func(ctx context.Context) error {
+				return p.config.Holds.DeleteAgingHolds(ctx, getWorkOrder.Product.Type, ids)
+			},
+		})
+	}
+	for _, carrier := range carriers {
+		carrier := carrier
+		clearName, bindName := "CLEAR_CARRIER", "BIND_CARRIER"
+		if len(carriers) > 1 {
+			clearName, bindName = clearName+"("+carrier+")", bindName+"("+carrier+")"
 		}
-
-		err = p.dm.UpdateCarrier(ctx, mcom.UpdateCarrierRequest{
-			ID: carrier,
-			Action: mcom.BindResources{
-				ResourcesID: []string{resources[0].ID},
+		// replace the current resources in the carrier
+		clearCarrier := func(ctx context.Context) error {
+			return p.dm.UpdateCarrier(ctx, mcom.UpdateCarrierRequest{
+				ID:     carrier,
+				Action: mcom.ClearResources{},
+			})
+		}
+		steps = append(steps,
+			saga.Step{
+				Name: clearName,
+				Do:   clearCarrier,
+				Compensate: func(ctx context.Context) error {
+					if len(carrierContents[carrier]) == 0 {
+						return nil
+					}
+					return p.dm.UpdateCarrier(ctx, mcom.UpdateCarrierRequest{
+						ID:     carrier,
+						Action: mcom.BindResources{ResourcesID: carrierContents[carrier]},
+					})
+				},
+			},
+			saga.Step{
+				Name: bindName,
+				Do: func(ctx context.Context) error {
+					var ids []string
+					for i, output := range outputs {
+						if output.carrier == carrier {
+							ids = append(ids, resources[i].ID)
+						}
+					}
+					return p.dm.UpdateCarrier(ctx, mcom.UpdateCarrierRequest{
+						ID: carrier,
+						Action: mcom.BindResources{
+							ResourcesID: ids,
+						},
+					})
+				},
+				Compensate: clearCarrier,
+			},
+		)
+	}
+	if len(defects) != 0 {
+		steps = append(steps, saga.Step{
+			Name: "RECORD_DEFECTS",
+			Do: func(ctx context.Context) error {
+				return p.config.Defects.CreateCollectDefects(ctx, defects)
+			},
+			Compensate: func(ctx context.Context) error {
+				return p.config.Defects.DeleteCollectDefects(ctx, params.WorkOrderID, int16(params.Body.Collect.Sequence))
 			},
 		})
-		if err != nil {
-			return utils.ParseError(ctx, produce.NewFeedCollectDefault(0), err)
+	}
+	for i, output := range outputs {
+		i, output := i, output
+		name := "COLLECT"
+		if len(outputs) > 1 {
+			name = fmt.Sprintf("COLLECT(%d)", output.sequence)
 		}
+		steps = append(steps, saga.Step{
+			Name: name,
+			Do: func(ctx context.Context) error {
+				return p.dm.CreateCollectRecord(ctx, mcom.CreateCollectRecordRequest{
+					WorkOrder:   params.WorkOrderID,
+					LotNumber:   lotNumber,
+					Sequence:    output.sequence,
+					Quantity:    output.quantity,
+					Station:     params.Body.StationID,
+					ResourceOID: resources[i].OID,
+				})
+			},
+			// the collect records can not be removed, they are voided by their
+			// reversals if a later output fails.
+			Compensate: func(ctx context.Context) error {
+				return p.config.Collects.CreateCollectReversal(ctx, database.CollectReversal{
+					WorkOrder:  params.WorkOrderID,
+					Sequence:   output.sequence,
+					ResourceID: resources[i].ID,
+					Quantity:   output.quantity,
+					Reason:     feedCompensationReason,
+					CreatedBy:  principal.ID,
+				})
+			},
+		})
 	}
 
-	// Collect
-	err = p.dm.CreateCollectRecord(ctx, mcom.CreateCollectRecordRequest{
-		WorkOrder:   params.WorkOrderID,
-		LotNumber:   lotNumber,
-		Sequence:    int16(params.Body.Collect.Sequence),
-		Quantity:    decimal.NewFromFloat(params.Body.Collect.Quantity),
-		Station:     params.Body.StationID,
-		ResourceOID: resources[0].OID,
+	// the records are kept with the production, which is compensated if they
+	// fail.
+	steps = append(steps, saga.Step{
+		Name: "RECORD_PRODUCTION",
+		Do: func(ctx context.Context) error {
+			feeds := make([]database.FeedRecord, len(params.Body.Feed.Source))
+			for i, source := range params.Body.Feed.Source {
+				feeds[i] = database.FeedRecord{
+					WorkOrder:     params.WorkOrderID,
+					Batch:         batchID.Number,
+					Station:       params.Body.StationID,
+					FeedRecordID:  feedRecordID,
+					ProductID:     getWorkOrder.Product.ID,
+					SiteName:      source.SiteInfo.SiteName,
+					SiteIndex:     int16(source.SiteInfo.SiteIndex),
+					Quantity:      decimal.NewNullDecimal(decimal.NewFromFloat(source.Quantity)),
+					CreatedBy:     principal.ID,
+					SiteResources: sources.siteResources[i],
+				}
+			}
+			collects := make([]database.CollectRecord, len(outputs))
+			for i, output := range outputs {
+				collects[i] = database.CollectRecord{
+					WorkOrder:     params.WorkOrderID,
+					Sequence:      output.sequence,
+					Batch:         &batchID.Number,
+					FirstSequence: outputs[0].sequence,
+					Station:       params.Body.StationID,
+					ProductID:     getWorkOrder.Product.ID,
+					LotNumber:     lotNumber,
+					ResourceID:    resources[i].ID,
+					Quantity:      output.quantity,
+					CreatedBy:     principal.ID,
+				}
+			}
+			return p.recordProduction(ctx, feeds, collects)
+		},
 	})
-	if err != nil {
-		return utils.ParseError(ctx, produce.NewFeedCollectDefault(0), err)
+
+	if err := saga.Run(ctx, steps...); err != nil {
+		return utils.ParseError(ctx, produce.NewFeedCollectDefault(0), handlerUtils.ParseSagaError(err))
 	}
 
 	// Print
-	if params.Body.Collect.Print {
-		printData := printer.PrintData{
+	var printData []printer.PrintData
+	for _, output := range outputs {
+		if !output.print {
+			continue
+		}
+		printData = append(printData, printer.PrintData{
 			StationID:      getWorkOrder.Station,
 			NextStationID:  "",
 			ProductID:      getWorkOrder.Product.ID,
 			ProductionDate: now,
 			ExpiryDate:     expiryTime,
-			Quantity:       decimal.NewFromFloat(params.Body.Collect.Quantity),
-			ResourceID:     params.Body.Collect.ResourceID,
-		}
-
+			Quantity:       output.quantity,
+			ResourceID:     output.resourceID,
+		})
+	}
+	if len(printData) != 0 {
 		// Read Config Printer
-		pdf, err := printer.CreateResourcesPDF(ctx, models.MaterialResourceLabelFieldName{}, printData, barcodes.Code39{}, p.config.FontPath)
+		pdf, err := printer.CreateResourceLabelsPDF(ctx, models.MaterialResourceLabelFieldName{}, printData, barcodes.Code39{}, p.config.FontPath)
 		if err != nil {
 			return utils.ParseError(ctx, produce.NewFeedCollectDefault(0), err)
 		}
 
-		if printer := p.config.Printers[getWorkOrder.Station]; printer == "" {
-			return utils.ParseError(ctx, produce.NewFeedCollectDefault(0), mcomErrors.Error{
-				Code:    mcomErrors.Code_STATION_PRINTER_NOT_DEFINED,
-				Details: fmt.Sprintf("station %s no defined printer", getWorkOrder.Station),
-			})
-		}
-
-		err = mcom.Print(ctx, p.config.Printers[getWorkOrder.Station], pdf)
+		err = mcom.Print(ctx, stationPrinter, pdf)
 		if err != nil {
 			return utils.ParseError(ctx, produce.NewFeedCollectDefault(0), err)
 		}
@@ -313,6 +579,17 @@ func (p Produce) MesFeed(params produce.MesFeedParams, principal *models.Princip
 		return utils.ParseError(ctx, produce.NewMesFeedDefault(0), err)
 	}
 	mesFeedRequest.Feeds = mesFeedResources
+
+	// the resources bound through MES are not checked until they are fed.
+	heldResources := make([]mcom.BindMaterialResource, len(params.Body.Resource))
+	for i, resource := range params.Body.Resource {
+		heldResources[i] = mcom.BindMaterialResource{ResourceID: resource.ID}
+	}
+	holds, err := handlerUtils.CheckAgingHolds(ctx, p.config.Holds, heldResources, params.Body.ForceFeed.Force, params.Body.ForceFeed.Reason)
+	if err != nil {
+		return utils.ParseError(ctx, produce.NewMesFeedDefault(0), err)
+	}
+
 	if config.SplitFeedAndCollect {
 		siteName = config.Feed.OperatorSites[0].SiteID.Name
 	}
@@ -333,6 +610,14 @@ func (p Produce) MesFeed(params produce.MesFeedParams, principal *models.Princip
 	mesFeedResponse.EnableForce = httpResponse.Enforceable
 	if httpResponse.Results == nil || httpResponse.EnforceDone {
 		mesFeedResponse.Success = true
+		if err := p.recordMesFeed(ctx, params, principal.ID, accordingRecipe); err != nil {
+			mesFeedResponse.Error = append(mesFeedResponse.Error, recordingError(err))
+		}
+		if len(holds) != 0 {
+			if err := p.config.Holds.ReleaseAgingHolds(ctx, holds, principal.ID, params.Body.ForceFeed.Reason); err != nil {
+				commonsCtx.Logger(ctx).Error("failed to release the aging holds", zap.Error(err))
+			}
+		}
 	} else {
 		mesFeedResponse.Error = parseMesFeedError(httpResponse.Results)
 	}
@@ -342,6 +627,31 @@ func (p Produce) MesFeed(params produce.MesFeedParams, principal *models.Princip
 	})
 }
 
+// recordMesFeed keeps the feed records of a feed through MES.
+func (p Produce) recordMesFeed(ctx context.Context, params produce.MesFeedParams, userID string, accordingRecipe bool) error {
+	// the product is only for the queries.
+	var productID string
+	if workOrder, err := p.dm.GetWorkOrder(ctx, mcom.GetWorkOrderRequest{ID: *params.Body.WorkOrderID}); err == nil {
+		productID = workOrder.Product.ID
+	}
+	feeds := make([]database.FeedRecord, len(params.Body.Resource))
+	for i, resource := range params.Body.Resource {
+		feeds[i] = database.FeedRecord{
+			WorkOrder:  *params.Body.WorkOrderID,
+			Batch:      int16(*params.Body.Batch),
+			Station:    params.StationID,
+			ProductID:  productID,
+			ResourceID: resource.ID,
+			CreatedBy:  userID,
+		}
+		if !accordingRecipe {
+			// the quantities are validated before sending to MES.
+			feeds[i].Quantity = decimal.NewNullDecimal(decimal.RequireFromString(resource.Quantity))
+		}
+	}
+	return p.recordProduction(ctx, feeds, nil)
+}
+
 // MesCollect implements.
 func (p Produce) MesCollect(params produce.MesCollectParams, principal *models.Principal) middleware.Responder {
 	if !p.hasPermission(kenda.FunctionOperationID_MES_COLLECT, principal.Roles) {
@@ -372,12 +682,23 @@ func (p Produce) MesCollect(params produce.MesCollectParams, principal *models.P
 		return utils.ParseError(ctx, produce.NewMesCollectDefault(0), err)
 	}
 
-	// get actionMode & quantity
+	// get actionMode & outputs
 	actionMode := mesModels.CheckActionModeACTIONAUTO
 	if params.Body.ForceCollect.Force {
 		actionMode = mesModels.CheckActionModeACTIONFORCE
 	}
-	quantity, err := decimal.NewFromString(params.Body.Quantity)
+	single := collectOutput{
+		sequence:   int16(*params.Body.Sequence),
+		resourceID: params.Body.ResourceID,
+		carrier:    params.Body.CarrierResource,
+		print:      params.Body.Print,
+	}
+	if !params.Body.Weighed && len(params.Body.Outputs) == 0 {
+		if single.quantity, err = decimal.NewFromString(params.Body.Quantity); err != nil {
+			return utils.ParseError(ctx, produce.NewMesCollectDefault(0), err)
+		}
+	}
+	outputs, err := parseCollectOutputs(params.Body.Outputs, single)
 	if err != nil {
 		return utils.ParseError(ctx, produce.NewMesCollectDefault(0), err)
 	}
@@ -389,29 +710,27 @@ func (p Produce) MesCollect(params produce.MesCollectParams, principal *models.P
 	if err != nil {
 		return utils.ParseError(ctx, produce.NewMesCollectDefault(0), err)
 	}
+	if params.Body.Weighed {
+		if outputs[0].quantity, err = p.weighCollect(ctx, params.StationID, workOrder.Unit, params.Body.Outputs); err != nil {
+			return utils.ParseError(ctx, produce.NewMesCollectDefault(0), err)
+		}
+	}
 
-	mesCollectRequest := mesModels.APICollectRequest{
-		ActionMode: &actionMode,
-		WorkOrder:  *params.Body.WorkOrderID,
-		Carrier:    params.Body.CarrierResource,
-		Sequence:   int32(*params.Body.Sequence),
-		Quantity: &mesModels.V2commonsDecimal{
-			Exp:   quantity.Exponent(),
-			Value: quantity.Coefficient().String(),
-		},
-		Resource: &mesModels.ResourceID{
-			ID: params.Body.ResourceID,
-		},
-		Feed: &mesModels.CollectRequestFeed{
-			AccordingRecipe: true,
-			Feeds:           []*mesModels.APIResourceFeed{},
-		},
-		LabelFields: []string{
-			"manufacture_date",
-			"expiry",
-		},
+	defects, err := p.parseCollectDefects(ctx, params.Body.Defects, database.CollectDefect{
+		WorkOrder: *params.Body.WorkOrderID,
+		Sequence:  int16(*params.Body.Sequence),
+		Batch:     int16(workOrder.CurrentBatch),
+		Station:   params.StationID,
+		CreatedBy: principal.ID,
+	})
+	if err != nil {
+		return utils.ParseError(ctx, produce.NewMesCollectDefault(0), err)
 	}
 
+	mesFeed := &mesModels.CollectRequestFeed{
+		AccordingRecipe: true,
+		Feeds:           []*mesModels.APIResourceFeed{},
+	}
 	if config.SplitFeedAndCollect {
 		siteName = config.Collect.OperatorSites[0].SiteID.Name
 	} else {
@@ -423,13 +742,15 @@ func (p Produce) MesCollect(params produce.MesCollectParams, principal *models.P
 				},
 			}
 		}
-		mesCollectRequest.Feed = &mesModels.CollectRequestFeed{
+		mesFeed = &mesModels.CollectRequestFeed{
 			Feeds:           mesFeedResources,
 			AccordingRecipe: true,
 		}
 	}
 
-	// send mes collect request to MES
+	// send mes collect requests to MES. MES can not reverse the collects, so
+	// the outputs of a multiple collect are prechecked before any of them is
+	// collected.
 	mesCollectPath := fmt.Sprintf("%s/mes/api/v2/resource/collect", p.config.MesPath)
 	mesHeader := handlerUtils.MesHeader{
 		UserID:  principal.ID,
@@ -437,101 +758,240 @@ func (p Produce) MesCollect(params produce.MesCollectParams, principal *models.P
 		Site:    siteName,
 		TrackID: handlerUtils.GetContextValue(params.HTTPRequest, "rid"),
 	}
-	httpResponse, err := handlerUtils.SendMesPOSTRequest[*mesModels.APICollectReply](mesCollectRequest, mesHeader, mesCollectPath)
-	if err != nil {
-		return utils.ParseError(ctx, produce.NewMesFeedDefault(0), err)
+	requests := make([]mesModels.APICollectRequest, len(outputs))
+	for i, output := range outputs {
+		requests[i] = mesModels.APICollectRequest{
+			WorkOrder: *params.Body.WorkOrderID,
+			Carrier:   output.carrier,
+			Sequence:  int32(output.sequence),
+			Quantity: &mesModels.V2commonsDecimal{
+				Exp:   output.quantity.Exponent(),
+				Value: output.quantity.Coefficient().String(),
+			},
+			Resource: &mesModels.ResourceID{
+				ID: output.resourceID,
+			},
+			Feed: &mesModels.CollectRequestFeed{
+				AccordingRecipe: true,
+				Feeds:           []*mesModels.APIResourceFeed{},
+			},
+			LabelFields: []string{
+				"manufacture_date",
+				"expiry",
+			},
+		}
 	}
+	// the resources are fed along with the first output.
+	requests[0].Feed = mesFeed
 
-	mesCollectResponse.EnableForce = httpResponse.Enforceable
-	if checkMesCollectError(httpResponse.Error) || httpResponse.EnforceDone {
-		mesCollectResponse.Success = true
-	} else {
+	replies := make([]*mesModels.APICollectReply, len(outputs))
+	var rejected *mesModels.APICollectReply
+	collect := func(i int, mode mesModels.CheckActionMode) error {
+		request := requests[i]
+		request.ActionMode = &mode
+		httpResponse, err := handlerUtils.SendMesPOSTRequest[*mesModels.APICollectReply](request, mesHeader, mesCollectPath)
+		if err != nil {
+			return err
+		}
+		replies[i] = httpResponse
+		if checkMesCollectError(httpResponse.Error) || httpResponse.EnforceDone {
+			return nil
+		}
 		if *httpResponse.Error.Code == mesModels.ErrorCodeERRORINTERNAL {
-			return produce.NewMesCollectDefault(http.StatusInternalServerError).WithPayload(&models.Error{
-				Details: "mes internal error",
-			})
+			return errors.New("mes internal error")
 		}
+		rejected = httpResponse
+		return errMesCollectRejected
+	}
+	// recordErr is the failure of recording the collected outputs.
+	var recordErr error
+	rejectedResponse := func(collected []*models.CollectedOutput) middleware.Responder {
+		mesCollectResponse.EnableForce = rejected.Enforceable
 		mesCollectResponse.Error = []*models.MesResponseErrorItems0{
 			{
-				Code:    utils.ParseMesErrorCode(string(*httpResponse.Error.Code)),
-				Details: httpResponse.Error.Details,
+				Code:    utils.ParseMesErrorCode(string(*rejected.Error.Code)),
+				Details: rejected.Error.Details,
 			},
 		}
+		if recordErr != nil {
+			mesCollectResponse.Error = append(mesCollectResponse.Error, recordingError(recordErr))
+		}
+		return produce.NewMesCollectOK().WithPayload(&produce.MesCollectOKBody{
+			Data: &produce.MesCollectOKBodyData{
+				MesResponse: &mesCollectResponse,
+				Outputs:     collected,
+			},
+		})
 	}
 
-	if mesCollectResponse.Success {
-		// Print
-		if params.Body.Print {
-			// parse mesTime
-			mesTime, err := parseMesTime([]string{"manufacture_date", "expiry"}, httpResponse.LabelFields)
-			if err != nil {
-				printResponse = &produce.MesCollectOKBodyDataPrint{
-					Success: false,
-					Error: &models.ErrorResponse{
-						Code:    int64(mcomErrors.Code_FAILED_TO_PRINT_RESOURCE),
-						Details: "mes time parse fail.",
-					},
-				}
-			} else {
-				printData := printer.PrintData{
-					StationID:      params.StationID,
-					NextStationID:  "",
-					ProductID:      workOrder.Product.ID,
-					ProductionDate: mesTime["manufacture_date"],
-					ExpiryDate:     mesTime["expiry"],
-					Quantity:       quantity,
-					ResourceID:     params.Body.ResourceID,
+	if len(outputs) > 1 && actionMode == mesModels.CheckActionModeACTIONAUTO {
+		for i := range outputs {
+			if err := collect(i, mesModels.CheckActionModeACTIONPRECHECK); err != nil {
+				if errors.Is(err, errMesCollectRejected) {
+					return rejectedResponse(nil)
 				}
+				return utils.ParseError(ctx, produce.NewMesCollectDefault(0), err)
+			}
+		}
+	}
 
-				// create pdf
-				pdf, err := printer.CreateResourcesPDF(ctx, models.MaterialResourceLabelFieldName{}, printData, barcodes.Code39{}, p.config.FontPath)
-				if err != nil {
-					printResponse = &produce.MesCollectOKBodyDataPrint{
-						Success: false,
-						Error: &models.ErrorResponse{
-							Code:    int64(mcomErrors.Code_FAILED_TO_PRINT_RESOURCE),
-							Details: "create pdf fail.",
-						},
-					}
-				} else {
-					// check printer
-					if printer := p.config.Printers[params.StationID]; printer == "" {
-						printResponse = &produce.MesCollectOKBodyDataPrint{
-							Success: false,
-							Error: &models.ErrorResponse{
-								Code:    int64(mcomErrors.Code_STATION_PRINTER_NOT_DEFINED),
-								Details: fmt.Sprintf("station %s no defined printer", params.StationID),
-							},
-						}
-					} else {
-						// print pdf
-						err = mcom.Print(ctx, p.config.Printers[params.StationID], pdf)
-						if err != nil {
-							printResponse = &produce.MesCollectOKBodyDataPrint{
-								Success: false,
-								Error: &models.ErrorResponse{
-									Code:    int64(mcomErrors.Code_FAILED_TO_PRINT_RESOURCE),
-									Details: "print fail.",
-								},
-							}
-						} else {
-							printResponse = &produce.MesCollectOKBodyDataPrint{
-								Success: true,
-							}
-						}
-					}
-				}
+	// the defects are removed if the first output is not collected, and kept
+	// with it otherwise.
+	var steps []saga.Step
+	if len(defects) != 0 {
+		steps = append(steps, saga.Step{
+			Name: "RECORD_DEFECTS",
+			Do: func(ctx context.Context) error {
+				return p.config.Defects.CreateCollectDefects(ctx, defects)
+			},
+			Compensate: func(ctx context.Context) error {
+				return p.config.Defects.DeleteCollectDefects(ctx, *params.Body.WorkOrderID, int16(*params.Body.Sequence))
+			},
+		})
+	}
+	steps = append(steps, saga.Step{
+		Name: fmt.Sprintf("MES_COLLECT(%d)", outputs[0].sequence),
+		Do: func(ctx context.Context) error {
+			return collect(0, actionMode)
+		},
+	})
+	// count is the number of the collected outputs, which are kept even if a
+	// later output fails.
+	count := 0
+	err = saga.Run(ctx, steps...)
+	if err == nil {
+		for count = 1; count < len(outputs); count++ {
+			if err = collect(count, actionMode); err != nil {
+				break
 			}
 		}
 	}
+
+	collected := make([]*models.CollectedOutput, count)
+	records := make([]database.CollectRecord, count)
+	mesCollects := make([]database.MesCollect, count)
+	for i, output := range outputs[:count] {
+		collected[i] = &models.CollectedOutput{
+			Sequence:   int64(output.sequence),
+			ResourceID: output.resourceID,
+		}
+		records[i] = database.CollectRecord{
+			WorkOrder:     *params.Body.WorkOrderID,
+			Sequence:      output.sequence,
+			FirstSequence: outputs[0].sequence,
+			Station:       params.StationID,
+			ProductID:     workOrder.Product.ID,
+			ResourceID:    output.resourceID,
+			Quantity:      output.quantity,
+			CreatedBy:     principal.ID,
+		}
+		// keep the collects created by MES, which can not be reversed in MUI.
+		mesCollects[i] = database.MesCollect{
+			WorkOrder:  *params.Body.WorkOrderID,
+			Sequence:   output.sequence,
+			Station:    params.StationID,
+			ResourceID: output.resourceID,
+			CreatedBy:  principal.ID,
+		}
+	}
+	recordErr = p.recordProduction(ctx, nil, records, mesCollects...)
+
+	if err != nil {
+		if errors.Is(err, errMesCollectRejected) {
+			return rejectedResponse(collected)
+		}
+		if count == 0 {
+			// the error of the only step is reported as is.
+			if e, ok := err.(*saga.Error); ok && len(e.Compensated) == 0 && len(e.Uncompensated) == 0 {
+				err = e.Err
+			}
+			return utils.ParseError(ctx, produce.NewMesCollectDefault(0), handlerUtils.ParseSagaError(err))
+		}
+		if recordErr != nil {
+			return utils.ParseError(ctx, produce.NewMesCollectDefault(0),
+				fmt.Errorf("%w, the outputs before sequence %d are left collected, and %v", err, outputs[count].sequence, recordErr))
+		}
+		return utils.ParseError(ctx, produce.NewMesCollectDefault(0),
+			fmt.Errorf("%w, the outputs before sequence %d are left collected", err, outputs[count].sequence))
+	}
+	mesCollectResponse.Success = true
+	mesCollectResponse.EnableForce = replies[len(replies)-1].Enforceable
+	if recordErr != nil {
+		mesCollectResponse.Error = append(mesCollectResponse.Error, recordingError(recordErr))
+	}
+
+	// Print
+	if outputs.print() {
+		printResponse = p.printMesCollectLabels(ctx, params.StationID, workOrder.Product.ID, outputs, replies)
+	}
 	return produce.NewMesCollectOK().WithPayload(&produce.MesCollectOKBody{
 		Data: &produce.MesCollectOKBodyData{
 			MesResponse: &mesCollectResponse,
 			Print:       printResponse,
+			Outputs:     collected,
 		},
 	})
 }
 
+// printMesCollectLabels prints the labels of the outputs to be printed by a
+// single print job, with the times replied by MES.
+func (p Produce) printMesCollectLabels(
+	ctx context.Context,
+	stationID string,
+	productID string,
+	outputs collectOutputs,
+	replies []*mesModels.APICollectReply,
+) *produce.MesCollectOKBodyDataPrint {
+	printFailed := func(code mcomErrors.Code, details string) *produce.MesCollectOKBodyDataPrint {
+		return &produce.MesCollectOKBodyDataPrint{
+			Success: false,
+			Error: &models.ErrorResponse{
+				Code:    int64(code),
+				Details: details,
+			},
+		}
+	}
+
+	var printData []printer.PrintData
+	for i, output := range outputs {
+		if !output.print {
+			continue
+		}
+		// parse mesTime
+		mesTime, err := parseMesTime([]string{"manufacture_date", "expiry"}, replies[i].LabelFields)
+		if err != nil {
+			return printFailed(mcomErrors.Code_FAILED_TO_PRINT_RESOURCE, "mes time parse fail.")
+		}
+		printData = append(printData, printer.PrintData{
+			StationID:      stationID,
+			NextStationID:  "",
+			ProductID:      productID,
+			ProductionDate: mesTime["manufacture_date"],
+			ExpiryDate:     mesTime["expiry"],
+			Quantity:       output.quantity,
+			ResourceID:     output.resourceID,
+		})
+	}
+
+	// create pdf
+	pdf, err := printer.CreateResourceLabelsPDF(ctx, models.MaterialResourceLabelFieldName{}, printData, barcodes.Code39{}, p.config.FontPath)
+	if err != nil {
+		return printFailed(mcomErrors.Code_FAILED_TO_PRINT_RESOURCE, "create pdf fail.")
+	}
+	// check printer
+	stationPrinter := p.config.Printers[stationID]
+	if stationPrinter == "" {
+		return printFailed(mcomErrors.Code_STATION_PRINTER_NOT_DEFINED, fmt.Sprintf("station %s no defined printer", stationID))
+	}
+	// print pdf
+	if err := mcom.Print(ctx, stationPrinter, pdf); err != nil {
+		return printFailed(mcomErrors.Code_FAILED_TO_PRINT_RESOURCE, "print fail.")
+	}
+	return &produce.MesCollectOKBodyDataPrint{
+		Success: true,
+	}
+}
+
 func parseFeedResource(dataIn []*produce.FeedCollectParamsBodyFeedSourceItems0) []mcom.FeedPerSite {
 	dataOut := make([]mcom.FeedPerSite, len(dataIn))
 	for i, data := range dataIn {
@@ -22,8 +22,10 @@ import (
 	"gitlab.kenda.com.tw/kenda/mcom/utils/resources"
 	mcomRoles "gitlab.kenda.com.tw/kenda/mcom/utils/roles"
 
+	"gitlab.kenda.com.tw/kenda/mui/server/database/storetest"
 	"gitlab.kenda.com.tw/kenda/mui/server/impl/handlers/mcom/account"
 	"gitlab.kenda.com.tw/kenda/mui/server/impl/service"
+	"gitlab.kenda.com.tw/kenda/mui/server/impl/utils/idrule"
 	"gitlab.kenda.com.tw/kenda/mui/server/protobuf/kenda"
 	"gitlab.kenda.com.tw/kenda/mui/server/swagger/models"
 	"gitlab.kenda.com.tw/kenda/mui/server/swagger/restapi/operations/produce"
@@ -62,15 +64,24 @@ var (
 
 func TestProduce_FeedCollect(t *testing.T) {
 	var (
-		testBatch             = 19
-		testCarrierResourceID = "CARRIERRESOURCEID"
-		testCarrierID         = "CARRIERID"
-		testUnit              = "UNIT"
-		testResourceOID       = "RESOURCEOID"
-		date                  = time.Time(testSchedulingDate)
-		testLotNumber         = fmt.Sprintf("%1s%s-%02d%02d", "1", "99", date.Month(), date.Day())
-		testLimitaryHourMin   = 0
-		testLimitaryHourMax   = 144
+		testBatch              = 19
+		testCarrierResourceID  = "CARRIERRESOURCEID"
+		testCarrierID          = "CARRIERID"
+		testPreviousResourceID = "PREVIOUSRESOURCEID"
+		testUnit               = "UNIT"
+		testResourceOID        = "RESOURCEOID"
+		date                   = time.Time(testSchedulingDate)
+		testLotNumber          = fmt.Sprintf("%1s%s-%02d%02d", "1", "99", date.Month(), date.Day())
+		testLimitaryHourMin    = 0
+		testLimitaryHourMax    = 144
+		testDefectReason       = "BUBBLE"
+		testDefectQuantity     = "1"
+		testResourceID2        = "TESTRESOURCEID2"
+		testResourceOID2       = "RESOURCEOID2"
+		testOutputQuantity1    = "30"
+		testOutputQuantity2    = "40.5"
+		testInvalidQuantity    = "0"
+		testSiteQuantity       = decimal.NewFromInt(50)
 	)
 
 	timeNow := time.Now()
@@ -167,47 +178,6 @@ func TestProduce_FeedCollect(t *testing.T) {
 						},
 					},
 				},
-				{
-					Name: mock.FuncFeed,
-					Input: mock.Input{
-						Request: mcom.FeedRequest{
-							Batch: mcom.BatchID{
-								WorkOrder: testWorkOrder1,
-								Number:    int16(testBatch),
-							},
-							FeedContent: []mcom.FeedPerSite{
-								mcom.FeedPerSiteType1{
-									Site: mcomModels.UniqueSite{
-										SiteID: mcomModels.SiteID{
-											Name:  testSiteName1,
-											Index: 0,
-										},
-										Station: testStationA,
-									},
-									Quantity: testQuantity,
-								},
-							},
-						},
-					},
-					Output: mock.Output{
-						Response: mcom.FeedReply{
-							FeedRecordID: "my-feed-id",
-						},
-					},
-				},
-				{
-					Name: mock.FuncUpdateBatch,
-					Input: mock.Input{
-						Request: mcom.UpdateBatchRequest{
-							WorkOrder: testWorkOrder1,
-							Number:    int16(testBatch),
-							Status:    workorder.BatchStatus_BATCH_CLOSING,
-						},
-					},
-					Output: mock.Output{
-						Error: nil,
-					},
-				},
 				{
 					Name: mock.FuncGetStation,
 					Input: mock.Input{
@@ -252,6 +222,83 @@ func TestProduce_FeedCollect(t *testing.T) {
 						},
 					},
 				},
+				{
+					Name: mock.FuncListSiteMaterials,
+					Input: mock.Input{
+						Request: mcom.ListSiteMaterialsRequest{
+							Station: testStationA,
+							Site: mcomModels.SiteID{
+								Name:  testSiteName1,
+								Index: 0,
+							},
+						},
+					},
+					Output: mock.Output{
+						Response: mcom.ListSiteMaterialsReply{
+							{ResourceID: testPreviousResourceID},
+						},
+					},
+				},
+				{
+					Name: mock.FuncGetMaterialResource,
+					Input: mock.Input{
+						Request: mcom.GetMaterialResourceRequest{
+							ResourceID: testPreviousResourceID,
+						},
+					},
+					Output: mock.Output{
+						Response: mcom.GetMaterialResourceReply{
+							{
+								Material: mcom.Material{
+									ResourceID: testPreviousResourceID,
+									Type:       testWorkOrder1ProductType,
+									Quantity:   testQuantity,
+								},
+							},
+						},
+					},
+				},
+				{
+					Name: mock.FuncFeed,
+					Input: mock.Input{
+						Request: mcom.FeedRequest{
+							Batch: mcom.BatchID{
+								WorkOrder: testWorkOrder1,
+								Number:    int16(testBatch),
+							},
+							FeedContent: []mcom.FeedPerSite{
+								mcom.FeedPerSiteType1{
+									Site: mcomModels.UniqueSite{
+										SiteID: mcomModels.SiteID{
+											Name:  testSiteName1,
+											Index: 0,
+										},
+										Station: testStationA,
+									},
+									Quantity: testQuantity,
+								},
+							},
+						},
+					},
+					Output: mock.Output{
+						Response: mcom.FeedReply{
+							FeedRecordID: "my-feed-id",
+						},
+					},
+				},
+				{
+					Name: mock.FuncUpdateBatch,
+					Input: mock.Input{
+						Request: mcom.UpdateBatchRequest{
+							WorkOrder: testWorkOrder1,
+							Number:    int16(testBatch),
+							Status:    workorder.BatchStatus_BATCH_CLOSING,
+						},
+					},
+					Output: mock.Output{
+						Error: nil,
+					},
+				},
 				{
 					Name: mock.FuncCreateMaterialResources,
 					Input: mock.Input{
@@ -316,7 +363,7 @@ func TestProduce_FeedCollect(t *testing.T) {
 			},
 		},
 		{
-			name: "not batch, create batch, success",
+			name: "multiple outputs",
 			args: args{
 				params: produce.FeedCollectParams{
 					HTTPRequest: httpRequest,
@@ -324,27 +371,26 @@ func TestProduce_FeedCollect(t *testing.T) {
 					Body: produce.FeedCollectBody{
 						StationID: testStationA,
 						Feed: &produce.FeedCollectParamsBodyFeed{
-							Batch: int64(testBatch),
-							Source: []*produce.FeedCollectParamsBodyFeedSourceItems0{
+							Batch:  int64(testBatch),
+							Source: []*produce.FeedCollectParamsBodyFeedSourceItems0{},
+						},
+						Collect: &produce.FeedCollectParamsBodyCollect{
+							Group:    1,
+							WorkDate: strfmt.Date(testSchedulingDate),
+							Sequence: int64(testSequence),
+							Outputs: models.CollectOutputs{
 								{
-									SiteInfo: &models.SiteInfo{
-										StationID: testStationA,
-										SiteName:  testSiteName1,
-										SiteIndex: 0,
-									},
-									Quantity: testQuantity.InexactFloat64(),
+									Quantity:        &testOutputQuantity1,
+									ResourceID:      testResourceID,
+									CarrierResource: testCarrierResourceID,
+								},
+								{
+									Quantity:        &testOutputQuantity2,
+									ResourceID:      testResourceID2,
+									CarrierResource: testCarrierResourceID,
 								},
 							},
 						},
-						Collect: &produce.FeedCollectParamsBodyCollect{
-							Group:           1,
-							WorkDate:        strfmt.Date(testSchedulingDate),
-							ResourceID:      testResourceID,
-							CarrierResource: testCarrierResourceID,
-							Sequence:        int64(testSequence),
-							Quantity:        testQuantity.InexactFloat64(),
-							Print:           false,
-						},
 					},
 				},
 				principal: principal,
@@ -379,62 +425,14 @@ func TestProduce_FeedCollect(t *testing.T) {
 						},
 					},
 					Output: mock.Output{
-						Error: mcomErrors.Error{
-							Code: mcomErrors.Code_BATCH_NOT_FOUND,
-						},
-					},
-				},
-				{
-					Name: mock.FuncCreateBatch,
-					Input: mock.Input{
-						Request: mcom.CreateBatchRequest{
-							WorkOrder: testWorkOrder1,
-							Number:    int16(testBatch),
-							Status:    workOrderBatchStarted,
-						},
-					},
-					Output: mock.Output{},
-				},
-				{
-					Name: mock.FuncFeed,
-					Input: mock.Input{
-						Request: mcom.FeedRequest{
-							Batch: mcom.BatchID{
+						Response: mcom.GetBatchReply{
+							Info: mcom.BatchInfo{
 								WorkOrder: testWorkOrder1,
 								Number:    int16(testBatch),
-							},
-							FeedContent: []mcom.FeedPerSite{
-								mcom.FeedPerSiteType1{
-									Site: mcomModels.UniqueSite{
-										SiteID: mcomModels.SiteID{
-											Name:  testSiteName1,
-											Index: 0,
-										},
-										Station: testStationA,
-									},
-									Quantity: testQuantity,
-								},
+								Status:    int32(workOrderBatchStarted),
 							},
 						},
 					},
-					Output: mock.Output{
-						Response: mcom.FeedReply{
-							FeedRecordID: "my-feed-id",
-						},
-					},
-				},
-				{
-					Name: mock.FuncUpdateBatch,
-					Input: mock.Input{
-						Request: mcom.UpdateBatchRequest{
-							WorkOrder: testWorkOrder1,
-							Number:    int16(testBatch),
-							Status:    workorder.BatchStatus_BATCH_CLOSING,
-						},
-					},
-					Output: mock.Output{
-						Error: nil,
-					},
 				},
 				{
 					Name: mock.FuncGetStation,
@@ -480,22 +478,63 @@ func TestProduce_FeedCollect(t *testing.T) {
 						},
 					},
 				},
+				{
+					Name: mock.FuncFeed,
+					Input: mock.Input{
+						Request: mcom.FeedRequest{
+							Batch: mcom.BatchID{
+								WorkOrder: testWorkOrder1,
+								Number:    int16(testBatch),
+							},
+							FeedContent: []mcom.FeedPerSite{},
+						},
+					},
+					Output: mock.Output{
+						Response: mcom.FeedReply{
+							FeedRecordID: "my-feed-id",
+						},
+					},
+				},
+				{
+					Name: mock.FuncUpdateBatch,
+					Input: mock.Input{
+						Request: mcom.UpdateBatchRequest{
+							WorkOrder: testWorkOrder1,
+							Number:    int16(testBatch),
+							Status:    workorder.BatchStatus_BATCH_CLOSING,
+						},
+					},
+				},
 				{
 					Name: mock.FuncCreateMaterialResources,
 					Input: mock.Input{
 						Request: mcom.CreateMaterialResourcesRequest{
-							Materials: []mcom.CreateMaterialResourcesRequestDetail{{
-								Type:           testWorkOrder1ProductType,
-								ID:             testWorkOrder1ProductA,
-								Status:         resources.MaterialStatus_AVAILABLE,
-								Quantity:       testQuantity,
-								Unit:           testUnit,
-								LotNumber:      testLotNumber,
-								ResourceID:     testResourceID,
-								CarrierID:      testCarrierResourceID,
-								ProductionTime: timeNow,
-								ExpiryTime:     expiryTime,
-							}},
+							Materials: []mcom.CreateMaterialResourcesRequestDetail{
+								{
+									Type:           testWorkOrder1ProductType,
+									ID:             testWorkOrder1ProductA,
+									Status:         resources.MaterialStatus_AVAILABLE,
+									Quantity:       decimal.RequireFromString(testOutputQuantity1),
+									Unit:           testUnit,
+									LotNumber:      testLotNumber,
+									ResourceID:     testResourceID,
+									CarrierID:      testCarrierResourceID,
+									ProductionTime: timeNow,
+									ExpiryTime:     expiryTime,
+								},
+								{
+									Type:           testWorkOrder1ProductType,
+									ID:             testWorkOrder1ProductA,
+									Status:         resources.MaterialStatus_AVAILABLE,
+									Quantity:       decimal.RequireFromString(testOutputQuantity2),
+									Unit:           testUnit,
+									LotNumber:      testLotNumber,
+									ResourceID:     testResourceID2,
+									CarrierID:      testCarrierResourceID,
+									ProductionTime: timeNow,
+									ExpiryTime:     expiryTime,
+								},
+							},
 						},
 					},
 					Output: mock.Output{
@@ -504,6 +543,10 @@ func TestProduce_FeedCollect(t *testing.T) {
 								ID:  testResourceID,
 								OID: testResourceOID,
 							},
+							{
+								ID:  testResourceID2,
+								OID: testResourceOID2,
+							},
 						},
 					},
 				},
@@ -522,7 +565,7 @@ func TestProduce_FeedCollect(t *testing.T) {
 						Request: mcom.UpdateCarrierRequest{
 							ID: testCarrierResourceID,
 							Action: mcom.BindResources{
-								ResourcesID: []string{testResourceID},
+								ResourcesID: []string{testResourceID, testResourceID2},
 							},
 						},
 					},
@@ -535,43 +578,346 @@ func TestProduce_FeedCollect(t *testing.T) {
 							LotNumber:   testLotNumber,
 							WorkOrder:   testWorkOrder1,
 							Station:     testStationA,
-							Quantity:    testQuantity,
+							Quantity:    decimal.RequireFromString(testOutputQuantity1),
 							ResourceOID: testResourceOID,
 						},
 					},
-					Output: mock.Output{},
+				},
+				{
+					Name: mock.FuncCreateCollectRecord,
+					Input: mock.Input{
+						Request: mcom.CreateCollectRecordRequest{
+							Sequence:    int16(testSequence + 1),
+							LotNumber:   testLotNumber,
+							WorkOrder:   testWorkOrder1,
+							Station:     testStationA,
+							Quantity:    decimal.RequireFromString(testOutputQuantity2),
+							ResourceOID: testResourceOID2,
+						},
+					},
 				},
 			},
 		},
 		{
-			name: "not found work order",
+			name: "invalid quantity of output, nothing changed",
 			args: args{
 				params: produce.FeedCollectParams{
 					HTTPRequest: httpRequest,
-					WorkOrderID: testWorkOrderError1,
+					WorkOrderID: testWorkOrder1,
 					Body: produce.FeedCollectBody{
 						StationID: testStationA,
 						Feed: &produce.FeedCollectParamsBodyFeed{
 							Batch: int64(testBatch),
-							Source: []*produce.FeedCollectParamsBodyFeedSourceItems0{
-								{
-									SiteInfo: &models.SiteInfo{
-										StationID: testStationA,
-										SiteName:  testSiteName1,
-										SiteIndex: 0,
-									},
-									Quantity: testQuantity.InexactFloat64(),
-								},
-							},
 						},
 						Collect: &produce.FeedCollectParamsBodyCollect{
-							Group:           1,
-							WorkDate:        strfmt.Date(testSchedulingDate),
-							ResourceID:      testResourceID,
-							CarrierResource: testCarrierResourceID,
-							Sequence:        int64(testSequence),
-							Quantity:        testQuantity.InexactFloat64(),
-							Print:           false,
+							Sequence: int64(testSequence),
+							Outputs: models.CollectOutputs{
+								{Quantity: &testOutputQuantity1},
+								{Quantity: &testInvalidQuantity},
+							},
+						},
+					},
+				},
+				principal: principal,
+			},
+			want: produce.NewFeedCollectDefault(http.StatusBadRequest).WithPayload(&models.Error{
+				Code:    int64(mcomErrors.Code_INVALID_NUMBER),
+				Details: "invalid_number=" + testInvalidQuantity,
+			}),
+		},
+		{
+			name: "not batch, create batch, success",
+			args: args{
+				params: produce.FeedCollectParams{
+					HTTPRequest: httpRequest,
+					WorkOrderID: testWorkOrder1,
+					Body: produce.FeedCollectBody{
+						StationID: testStationA,
+						Feed: &produce.FeedCollectParamsBodyFeed{
+							Batch: int64(testBatch),
+							Source: []*produce.FeedCollectParamsBodyFeedSourceItems0{
+								{
+									SiteInfo: &models.SiteInfo{
+										StationID: testStationA,
+										SiteName:  testSiteName1,
+										SiteIndex: 0,
+									},
+									Quantity: testQuantity.InexactFloat64(),
+								},
+							},
+						},
+						Collect: &produce.FeedCollectParamsBodyCollect{
+							Group:           1,
+							WorkDate:        strfmt.Date(testSchedulingDate),
+							ResourceID:      testResourceID,
+							CarrierResource: testCarrierResourceID,
+							Sequence:        int64(testSequence),
+							Quantity:        testQuantity.InexactFloat64(),
+							Print:           false,
+						},
+					},
+				},
+				principal: principal,
+			},
+			want: produce.NewFeedCollectOK(),
+			script: []mock.Script{
+				{
+					Name: mock.FuncGetWorkOrder,
+					Input: mock.Input{
+						Request: mcom.GetWorkOrderRequest{
+							ID: testWorkOrder1,
+						},
+					},
+					Output: mock.Output{
+						Response: mcom.GetWorkOrderReply{
+							ID: testWorkOrder1,
+							Product: mcom.Product{
+								ID:   testWorkOrder1ProductA,
+								Type: testWorkOrder1ProductType,
+							},
+							Unit:   testUnit,
+							Status: workorder.Status_ACTIVE,
+						},
+					},
+				},
+				{
+					Name: mock.FuncGetBatch,
+					Input: mock.Input{
+						Request: mcom.GetBatchRequest{
+							WorkOrder: testWorkOrder1,
+							Number:    int16(testBatch),
+						},
+					},
+					Output: mock.Output{
+						Error: mcomErrors.Error{
+							Code: mcomErrors.Code_BATCH_NOT_FOUND,
+						},
+					},
+				},
+				{
+					Name: mock.FuncGetStation,
+					Input: mock.Input{
+						Request: mcom.GetStationRequest{
+							ID: testStationA,
+						},
+					},
+					Output: mock.Output{
+						Response: mcom.GetStationReply{
+							Information: mcom.StationInformation{
+								Code: "99",
+							},
+						},
+					},
+				},
+				{
+					Name: mock.FuncGetCarrier,
+					Input: mock.Input{
+						Request: mcom.GetCarrierRequest{
+							ID: testCarrierResourceID,
+						},
+					},
+					Output: mock.Output{
+						Response: mcom.GetCarrierReply{
+							ID: testCarrierID,
+						},
+					},
+				},
+				{
+					Name: mock.FuncGetLimitaryHour,
+					Input: mock.Input{
+						Request: mcom.GetLimitaryHourRequest{
+							ProductType: testWorkOrder1ProductType,
+						},
+					},
+					Output: mock.Output{
+						Response: mcom.GetLimitaryHourReply{
+							LimitaryHour: mcom.LimitaryHourParameter{
+								Min: int32(testLimitaryHourMin),
+								Max: int32(testLimitaryHourMax),
+							},
+						},
+					},
+				},
+				{
+					Name: mock.FuncListSiteMaterials,
+					Input: mock.Input{
+						Request: mcom.ListSiteMaterialsRequest{
+							Station: testStationA,
+							Site: mcomModels.SiteID{
+								Name:  testSiteName1,
+								Index: 0,
+							},
+						},
+					},
+					Output: mock.Output{
+						Response: mcom.ListSiteMaterialsReply{
+							{ResourceID: testPreviousResourceID},
+						},
+					},
+				},
+				{
+					Name: mock.FuncGetMaterialResource,
+					Input: mock.Input{
+						Request: mcom.GetMaterialResourceRequest{
+							ResourceID: testPreviousResourceID,
+						},
+					},
+					Output: mock.Output{
+						Response: mcom.GetMaterialResourceReply{
+							{
+								Material: mcom.Material{
+									ResourceID: testPreviousResourceID,
+									Type:       testWorkOrder1ProductType,
+									Quantity:   testQuantity,
+								},
+							},
+						},
+					},
+				},
+				{
+					Name: mock.FuncCreateBatch,
+					Input: mock.Input{
+						Request: mcom.CreateBatchRequest{
+							WorkOrder: testWorkOrder1,
+							Number:    int16(testBatch),
+							Status:    workOrderBatchStarted,
+						},
+					},
+					Output: mock.Output{},
+				},
+				{
+					Name: mock.FuncFeed,
+					Input: mock.Input{
+						Request: mcom.FeedRequest{
+							Batch: mcom.BatchID{
+								WorkOrder: testWorkOrder1,
+								Number:    int16(testBatch),
+							},
+							FeedContent: []mcom.FeedPerSite{
+								mcom.FeedPerSiteType1{
+									Site: mcomModels.UniqueSite{
+										SiteID: mcomModels.SiteID{
+											Name:  testSiteName1,
+											Index: 0,
+										},
+										Station: testStationA,
+									},
+									Quantity: testQuantity,
+								},
+							},
+						},
+					},
+					Output: mock.Output{
+						Response: mcom.FeedReply{
+							FeedRecordID: "my-feed-id",
+						},
+					},
+				},
+				{
+					Name: mock.FuncUpdateBatch,
+					Input: mock.Input{
+						Request: mcom.UpdateBatchRequest{
+							WorkOrder: testWorkOrder1,
+							Number:    int16(testBatch),
+							Status:    workorder.BatchStatus_BATCH_CLOSING,
+						},
+					},
+					Output: mock.Output{
+						Error: nil,
+					},
+				},
+				{
+					Name: mock.FuncCreateMaterialResources,
+					Input: mock.Input{
+						Request: mcom.CreateMaterialResourcesRequest{
+							Materials: []mcom.CreateMaterialResourcesRequestDetail{{
+								Type:           testWorkOrder1ProductType,
+								ID:             testWorkOrder1ProductA,
+								Status:         resources.MaterialStatus_AVAILABLE,
+								Quantity:       testQuantity,
+								Unit:           testUnit,
+								LotNumber:      testLotNumber,
+								ResourceID:     testResourceID,
+								CarrierID:      testCarrierResourceID,
+								ProductionTime: timeNow,
+								ExpiryTime:     expiryTime,
+							}},
+						},
+					},
+					Output: mock.Output{
+						Response: mcom.CreateMaterialResourcesReply{
+							{
+								ID:  testResourceID,
+								OID: testResourceOID,
+							},
+						},
+					},
+				},
+				{
+					Name: mock.FuncUpdateCarrier,
+					Input: mock.Input{
+						Request: mcom.UpdateCarrierRequest{
+							ID:     testCarrierResourceID,
+							Action: mcom.ClearResources{},
+						},
+					},
+				},
+				{
+					Name: mock.FuncUpdateCarrier,
+					Input: mock.Input{
+						Request: mcom.UpdateCarrierRequest{
+							ID: testCarrierResourceID,
+							Action: mcom.BindResources{
+								ResourcesID: []string{testResourceID},
+							},
+						},
+					},
+				},
+				{
+					Name: mock.FuncCreateCollectRecord,
+					Input: mock.Input{
+						Request: mcom.CreateCollectRecordRequest{
+							Sequence:    int16(testSequence),
+							LotNumber:   testLotNumber,
+							WorkOrder:   testWorkOrder1,
+							Station:     testStationA,
+							Quantity:    testQuantity,
+							ResourceOID: testResourceOID,
+						},
+					},
+					Output: mock.Output{},
+				},
+			},
+		},
+		{
+			name: "not found work order",
+			args: args{
+				params: produce.FeedCollectParams{
+					HTTPRequest: httpRequest,
+					WorkOrderID: testWorkOrderError1,
+					Body: produce.FeedCollectBody{
+						StationID: testStationA,
+						Feed: &produce.FeedCollectParamsBodyFeed{
+							Batch: int64(testBatch),
+							Source: []*produce.FeedCollectParamsBodyFeedSourceItems0{
+								{
+									SiteInfo: &models.SiteInfo{
+										StationID: testStationA,
+										SiteName:  testSiteName1,
+										SiteIndex: 0,
+									},
+									Quantity: testQuantity.InexactFloat64(),
+								},
+							},
+						},
+						Collect: &produce.FeedCollectParamsBodyCollect{
+							Group:           1,
+							WorkDate:        strfmt.Date(testSchedulingDate),
+							ResourceID:      testResourceID,
+							CarrierResource: testCarrierResourceID,
+							Sequence:        int64(testSequence),
+							Quantity:        testQuantity.InexactFloat64(),
+							Print:           false,
 						},
 					},
 				},
@@ -585,33 +931,281 @@ func TestProduce_FeedCollect(t *testing.T) {
 				{ // fail of work order not found
 					Name: mock.FuncGetWorkOrder,
 					Input: mock.Input{
-						Request: mcom.GetWorkOrderRequest{
-							ID: testWorkOrderError1,
+						Request: mcom.GetWorkOrderRequest{
+							ID: testWorkOrderError1,
+						},
+					},
+					Output: mock.Output{
+						Error: mcomErrors.Error{
+							Code:    mcomErrors.Code_WORKORDER_NOT_FOUND,
+							Details: "work order not found",
+						}},
+				},
+			},
+		},
+		{
+			name: "batch already exists",
+			args: args{
+				params: produce.FeedCollectParams{
+					HTTPRequest: httpRequest,
+					WorkOrderID: testWorkOrder1,
+					Body: produce.FeedCollectBody{
+						StationID: testStationA,
+						Feed: &produce.FeedCollectParamsBodyFeed{
+							Batch: int64(testBatch),
+							Source: []*produce.FeedCollectParamsBodyFeedSourceItems0{
+								{
+									SiteInfo: &models.SiteInfo{
+										StationID: testStationA,
+										SiteName:  testSiteName1,
+										SiteIndex: 0,
+									},
+									Quantity: testQuantity.InexactFloat64(),
+								},
+							},
+						},
+						Collect: &produce.FeedCollectParamsBodyCollect{
+							Group:           1,
+							WorkDate:        strfmt.Date(testSchedulingDate),
+							ResourceID:      testResourceID,
+							CarrierResource: testCarrierResourceID,
+							Sequence:        int64(testSequence),
+							Quantity:        testQuantity.InexactFloat64(),
+							Print:           false,
+						},
+					},
+				},
+				principal: principal,
+			},
+			want: produce.NewFeedCollectDefault(http.StatusBadRequest).WithPayload(&models.Error{
+				Code: int64(mcomErrors.Code_BATCH_ALREADY_EXISTS),
+				Details: fmt.Sprintf("step CREATE_BATCH failed: %v", mcomErrors.Error{
+					Code: mcomErrors.Code_BATCH_ALREADY_EXISTS,
+				}),
+			}),
+			script: []mock.Script{
+				{
+					Name: mock.FuncGetWorkOrder,
+					Input: mock.Input{
+						Request: mcom.GetWorkOrderRequest{
+							ID: testWorkOrder1,
+						},
+					},
+					Output: mock.Output{
+						Response: mcom.GetWorkOrderReply{
+							ID: testWorkOrder1,
+							Product: mcom.Product{
+								ID:   testWorkOrder1ProductA,
+								Type: testWorkOrder1ProductType,
+							},
+							Unit:   testUnit,
+							Status: workorder.Status_ACTIVE,
+						},
+					},
+				},
+				{
+					Name: mock.FuncGetBatch,
+					Input: mock.Input{
+						Request: mcom.GetBatchRequest{
+							WorkOrder: testWorkOrder1,
+							Number:    int16(testBatch),
+						},
+					},
+					Output: mock.Output{
+						Error: mcomErrors.Error{
+							Code: mcomErrors.Code_BATCH_NOT_FOUND,
+						},
+					},
+				},
+				{
+					Name: mock.FuncGetStation,
+					Input: mock.Input{
+						Request: mcom.GetStationRequest{
+							ID: testStationA,
+						},
+					},
+					Output: mock.Output{
+						Response: mcom.GetStationReply{
+							Information: mcom.StationInformation{
+								Code: "99",
+							},
+						},
+					},
+				},
+				{
+					Name: mock.FuncGetCarrier,
+					Input: mock.Input{
+						Request: mcom.GetCarrierRequest{
+							ID: testCarrierResourceID,
+						},
+					},
+					Output: mock.Output{
+						Response: mcom.GetCarrierReply{
+							ID: testCarrierID,
+						},
+					},
+				},
+				{
+					Name: mock.FuncGetLimitaryHour,
+					Input: mock.Input{
+						Request: mcom.GetLimitaryHourRequest{
+							ProductType: testWorkOrder1ProductType,
+						},
+					},
+					Output: mock.Output{
+						Response: mcom.GetLimitaryHourReply{
+							LimitaryHour: mcom.LimitaryHourParameter{
+								Min: int32(testLimitaryHourMin),
+								Max: int32(testLimitaryHourMax),
+							},
+						},
+					},
+				},
+				{
+					Name: mock.FuncListSiteMaterials,
+					Input: mock.Input{
+						Request: mcom.ListSiteMaterialsRequest{
+							Station: testStationA,
+							Site: mcomModels.SiteID{
+								Name:  testSiteName1,
+								Index: 0,
+							},
+						},
+					},
+					Output: mock.Output{
+						Response: mcom.ListSiteMaterialsReply{
+							{ResourceID: testPreviousResourceID},
+						},
+					},
+				},
+				{
+					Name: mock.FuncGetMaterialResource,
+					Input: mock.Input{
+						Request: mcom.GetMaterialResourceRequest{
+							ResourceID: testPreviousResourceID,
+						},
+					},
+					Output: mock.Output{
+						Response: mcom.GetMaterialResourceReply{
+							{
+								Material: mcom.Material{
+									ResourceID: testPreviousResourceID,
+									Type:       testWorkOrder1ProductType,
+									Quantity:   testQuantity,
+								},
+							},
+						},
+					},
+				},
+				{
+					Name: mock.FuncCreateBatch,
+					Input: mock.Input{
+						Request: mcom.CreateBatchRequest{
+							WorkOrder: testWorkOrder1,
+							Number:    int16(testBatch),
+							Status:    workOrderBatchStarted,
+						},
+					},
+					Output: mock.Output{
+						Error: mcomErrors.Error{
+							Code: mcomErrors.Code_BATCH_ALREADY_EXISTS,
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "batch status not preparing or started",
+			args: args{
+				params: produce.FeedCollectParams{
+					HTTPRequest: httpRequest,
+					WorkOrderID: testWorkOrder1,
+					Body: produce.FeedCollectBody{
+						StationID: testStationA,
+						Feed: &produce.FeedCollectParamsBodyFeed{
+							Batch: int64(testBatch),
+							Source: []*produce.FeedCollectParamsBodyFeedSourceItems0{
+								{
+									SiteInfo: &models.SiteInfo{
+										StationID: testStationA,
+										SiteName:  testSiteName1,
+										SiteIndex: 0,
+									},
+									Quantity: testQuantity.InexactFloat64(),
+								},
+							},
+						},
+						Collect: &produce.FeedCollectParamsBodyCollect{
+							Group:           1,
+							WorkDate:        strfmt.Date(testSchedulingDate),
+							ResourceID:      testResourceID,
+							CarrierResource: testCarrierResourceID,
+							Sequence:        int64(testSequence),
+							Quantity:        testQuantity.InexactFloat64(),
+							Print:           false,
+						},
+					},
+				},
+				principal: principal,
+			},
+			want: produce.NewFeedCollectDefault(http.StatusBadRequest).WithPayload(&models.Error{
+				Details: fmt.Sprintf("bad status: status=%s", workorder.BatchStatus_BATCH_CANCELLED),
+			}),
+			script: []mock.Script{
+				{
+					Name: mock.FuncGetWorkOrder,
+					Input: mock.Input{
+						Request: mcom.GetWorkOrderRequest{
+							ID: testWorkOrder1,
+						},
+					},
+					Output: mock.Output{
+						Response: mcom.GetWorkOrderReply{
+							ID: testWorkOrder1,
+							Product: mcom.Product{
+								ID:   testWorkOrder1ProductA,
+								Type: testWorkOrder1ProductType,
+							},
+							Unit:   testUnit,
+							Status: workorder.Status_ACTIVE,
+						},
+					},
+				},
+				{
+					Name: mock.FuncGetBatch,
+					Input: mock.Input{
+						Request: mcom.GetBatchRequest{
+							WorkOrder: testWorkOrder1,
+							Number:    int16(testBatch),
 						},
 					},
 					Output: mock.Output{
-						Error: mcomErrors.Error{
-							Code:    mcomErrors.Code_WORKORDER_NOT_FOUND,
-							Details: "work order not found",
-						}},
+						Response: mcom.GetBatchReply{
+							Info: mcom.BatchInfo{
+								WorkOrder: testWorkOrder1,
+								Number:    int16(testBatch),
+								Status:    int32(workorder.BatchStatus_BATCH_CANCELLED),
+							},
+						},
+					},
 				},
 			},
 		},
 		{
-			name: "batch already exists",
+			name: "not found station site",
 			args: args{
 				params: produce.FeedCollectParams{
 					HTTPRequest: httpRequest,
 					WorkOrderID: testWorkOrder1,
 					Body: produce.FeedCollectBody{
-						StationID: testStationA,
+						StationID: testStationErrorID,
 						Feed: &produce.FeedCollectParamsBodyFeed{
 							Batch: int64(testBatch),
 							Source: []*produce.FeedCollectParamsBodyFeedSourceItems0{
 								{
 									SiteInfo: &models.SiteInfo{
-										StationID: testStationA,
-										SiteName:  testSiteName1,
+										StationID: testStationErrorID,
+										SiteName:  testSiteErrorName1,
 										SiteIndex: 0,
 									},
 									Quantity: testQuantity.InexactFloat64(),
@@ -619,23 +1213,23 @@ func TestProduce_FeedCollect(t *testing.T) {
 							},
 						},
 						Collect: &produce.FeedCollectParamsBodyCollect{
-							Group:           1,
-							WorkDate:        strfmt.Date(testSchedulingDate),
-							ResourceID:      testResourceID,
-							CarrierResource: testCarrierResourceID,
-							Sequence:        int64(testSequence),
-							Quantity:        testQuantity.InexactFloat64(),
-							Print:           false,
+							Group:      1,
+							WorkDate:   strfmt.Date(testSchedulingDate),
+							ResourceID: testResourceID,
+							Sequence:   int64(testSequence),
+							Quantity:   testQuantity.InexactFloat64(),
+							Print:      false,
 						},
 					},
 				},
 				principal: principal,
 			},
 			want: produce.NewFeedCollectDefault(http.StatusBadRequest).WithPayload(&models.Error{
-				Code: int64(mcomErrors.Code_BATCH_ALREADY_EXISTS),
+				Code:    int64(mcomErrors.Code_STATION_SITE_NOT_FOUND),
+				Details: "station site not found",
 			}),
 			script: []mock.Script{
-				{
+				{ // fail to list the resources of the fed site, nothing changed
 					Name: mock.FuncGetWorkOrder,
 					Input: mock.Input{
 						Request: mcom.GetWorkOrderRequest{
@@ -663,30 +1257,68 @@ func TestProduce_FeedCollect(t *testing.T) {
 						},
 					},
 					Output: mock.Output{
-						Error: mcomErrors.Error{
-							Code: mcomErrors.Code_BATCH_NOT_FOUND,
+						Response: mcom.GetBatchReply{
+							Info: mcom.BatchInfo{
+								WorkOrder: testWorkOrder1,
+								Number:    int16(testBatch),
+								Status:    int32(workOrderBatchStarted),
+							},
 						},
 					},
 				},
 				{
-					Name: mock.FuncCreateBatch,
+					Name: mock.FuncGetStation,
 					Input: mock.Input{
-						Request: mcom.CreateBatchRequest{
-							WorkOrder: testWorkOrder1,
-							Number:    int16(testBatch),
-							Status:    workOrderBatchStarted,
+						Request: mcom.GetStationRequest{
+							ID: testStationErrorID,
+						},
+					},
+					Output: mock.Output{
+						Response: mcom.GetStationReply{
+							Information: mcom.StationInformation{
+								Code: "99",
+							},
+						},
+					},
+				},
+				{
+					Name: mock.FuncGetLimitaryHour,
+					Input: mock.Input{
+						Request: mcom.GetLimitaryHourRequest{
+							ProductType: testWorkOrder1ProductType,
+						},
+					},
+					Output: mock.Output{
+						Response: mcom.GetLimitaryHourReply{
+							LimitaryHour: mcom.LimitaryHourParameter{
+								Min: int32(testLimitaryHourMin),
+								Max: int32(testLimitaryHourMax),
+							},
+						},
+					},
+				},
+				{
+					Name: mock.FuncListSiteMaterials,
+					Input: mock.Input{
+						Request: mcom.ListSiteMaterialsRequest{
+							Station: testStationErrorID,
+							Site: mcomModels.SiteID{
+								Name:  testSiteErrorName1,
+								Index: 0,
+							},
 						},
 					},
 					Output: mock.Output{
 						Error: mcomErrors.Error{
-							Code: mcomErrors.Code_BATCH_ALREADY_EXISTS,
+							Code:    mcomErrors.Code_STATION_SITE_NOT_FOUND,
+							Details: "station site not found",
 						},
 					},
 				},
 			},
 		},
 		{
-			name: "batch status not preparing or started",
+			name: "site shortage, nothing changed",
 			args: args{
 				params: produce.FeedCollectParams{
 					HTTPRequest: httpRequest,
@@ -707,20 +1339,20 @@ func TestProduce_FeedCollect(t *testing.T) {
 							},
 						},
 						Collect: &produce.FeedCollectParamsBodyCollect{
-							Group:           1,
-							WorkDate:        strfmt.Date(testSchedulingDate),
-							ResourceID:      testResourceID,
-							CarrierResource: testCarrierResourceID,
-							Sequence:        int64(testSequence),
-							Quantity:        testQuantity.InexactFloat64(),
-							Print:           false,
+							Group:      1,
+							WorkDate:   strfmt.Date(testSchedulingDate),
+							ResourceID: testResourceID,
+							Sequence:   int64(testSequence),
+							Quantity:   testQuantity.InexactFloat64(),
+							Print:      false,
 						},
 					},
 				},
 				principal: principal,
 			},
 			want: produce.NewFeedCollectDefault(http.StatusBadRequest).WithPayload(&models.Error{
-				Details: fmt.Sprintf("bad status: status=%s", workorder.BatchStatus_BATCH_CANCELLED),
+				Code:    int64(mcomErrors.Code_RESOURCE_MATERIAL_SHORTAGE),
+				Details: fmt.Sprintf("site %s(0) of station %s has 50, less than the fed quantity %s", testSiteName1, testStationA, testQuantity),
 			}),
 			script: []mock.Script{
 				{
@@ -755,7 +1387,74 @@ func TestProduce_FeedCollect(t *testing.T) {
 							Info: mcom.BatchInfo{
 								WorkOrder: testWorkOrder1,
 								Number:    int16(testBatch),
-								Status:    int32(workorder.BatchStatus_BATCH_CANCELLED),
+								Status:    int32(workOrderBatchStarted),
+							},
+						},
+					},
+				},
+				{
+					Name: mock.FuncGetStation,
+					Input: mock.Input{
+						Request: mcom.GetStationRequest{
+							ID: testStationA,
+						},
+					},
+					Output: mock.Output{
+						Response: mcom.GetStationReply{
+							Information: mcom.StationInformation{
+								Code: "99",
+							},
+						},
+					},
+				},
+				{
+					Name: mock.FuncGetLimitaryHour,
+					Input: mock.Input{
+						Request: mcom.GetLimitaryHourRequest{
+							ProductType: testWorkOrder1ProductType,
+						},
+					},
+					Output: mock.Output{
+						Response: mcom.GetLimitaryHourReply{
+							LimitaryHour: mcom.LimitaryHourParameter{
+								Min: int32(testLimitaryHourMin),
+								Max: int32(testLimitaryHourMax),
+							},
+						},
+					},
+				},
+				{
+					Name: mock.FuncListSiteMaterials,
+					Input: mock.Input{
+						Request: mcom.ListSiteMaterialsRequest{
+							Station: testStationA,
+							Site: mcomModels.SiteID{
+								Name:  testSiteName1,
+								Index: 0,
+							},
+						},
+					},
+					Output: mock.Output{
+						Response: mcom.ListSiteMaterialsReply{
+							{ResourceID: testPreviousResourceID, Quantity: &testSiteQuantity},
+						},
+					},
+				},
+				{
+					Name: mock.FuncGetMaterialResource,
+					Input: mock.Input{
+						Request: mcom.GetMaterialResourceRequest{
+							ResourceID: testPreviousResourceID,
+						},
+					},
+					Output: mock.Output{
+						Response: mcom.GetMaterialResourceReply{
+							{
+								Material: mcom.Material{
+									ResourceID: testPreviousResourceID,
+									Type:       testWorkOrder1ProductType,
+									Quantity:   testSiteQuantity,
+								},
 							},
 						},
 					},
@@ -763,20 +1462,20 @@ func TestProduce_FeedCollect(t *testing.T) {
 			},
 		},
 		{
-			name: "not found station site",
+			name: "station not found",
 			args: args{
 				params: produce.FeedCollectParams{
 					HTTPRequest: httpRequest,
 					WorkOrderID: testWorkOrder1,
 					Body: produce.FeedCollectBody{
-						StationID: testStationErrorID,
+						StationID: testStationA,
 						Feed: &produce.FeedCollectParamsBodyFeed{
 							Batch: int64(testBatch),
 							Source: []*produce.FeedCollectParamsBodyFeedSourceItems0{
 								{
 									SiteInfo: &models.SiteInfo{
-										StationID: testStationErrorID,
-										SiteName:  testSiteErrorName1,
+										StationID: testStationA,
+										SiteName:  testSiteName1,
 										SiteIndex: 0,
 									},
 									Quantity: testQuantity.InexactFloat64(),
@@ -784,23 +1483,23 @@ func TestProduce_FeedCollect(t *testing.T) {
 							},
 						},
 						Collect: &produce.FeedCollectParamsBodyCollect{
-							Group:      1,
-							WorkDate:   strfmt.Date(testSchedulingDate),
-							ResourceID: testResourceID,
-							Sequence:   int64(testSequence),
-							Quantity:   testQuantity.InexactFloat64(),
-							Print:      false,
+							Group:           1,
+							WorkDate:        strfmt.Date(testSchedulingDate),
+							ResourceID:      testResourceID,
+							CarrierResource: testCarrierResourceID,
+							Sequence:        int64(testSequence),
+							Quantity:        testQuantity.InexactFloat64(),
+							Print:           false,
 						},
 					},
 				},
 				principal: principal,
 			},
 			want: produce.NewFeedCollectDefault(http.StatusBadRequest).WithPayload(&models.Error{
-				Code:    int64(mcomErrors.Code_STATION_SITE_NOT_FOUND),
-				Details: "station site not found",
+				Code: int64(mcomErrors.Code_STATION_NOT_FOUND),
 			}),
 			script: []mock.Script{
-				{ // fail feed of station site not found
+				{
 					Name: mock.FuncGetWorkOrder,
 					Input: mock.Input{
 						Request: mcom.GetWorkOrderRequest{
@@ -838,38 +1537,22 @@ func TestProduce_FeedCollect(t *testing.T) {
 					},
 				},
 				{
-					Name: mock.FuncFeed,
+					Name: mock.FuncGetStation,
 					Input: mock.Input{
-						Request: mcom.FeedRequest{
-							Batch: mcom.BatchID{
-								WorkOrder: testWorkOrder1,
-								Number:    int16(testBatch),
-							},
-							FeedContent: []mcom.FeedPerSite{
-								mcom.FeedPerSiteType1{
-									Site: mcomModels.UniqueSite{
-										SiteID: mcomModels.SiteID{
-											Name:  testSiteErrorName1,
-											Index: 0,
-										},
-										Station: testStationErrorID,
-									},
-									Quantity: testQuantity,
-								},
-							},
+						Request: mcom.GetStationRequest{
+							ID: testStationA,
 						},
 					},
 					Output: mock.Output{
-						Response: mcom.FeedReply{},
 						Error: mcomErrors.Error{
-							Code:    mcomErrors.Code_STATION_SITE_NOT_FOUND,
-							Details: "station site not found",
-						}},
+							Code: mcomErrors.Code_STATION_NOT_FOUND,
+						},
+					},
 				},
 			},
 		},
 		{
-			name: "station not found",
+			name: "carrier not found",
 			args: args{
 				params: produce.FeedCollectParams{
 					HTTPRequest: httpRequest,
@@ -903,7 +1586,7 @@ func TestProduce_FeedCollect(t *testing.T) {
 				principal: principal,
 			},
 			want: produce.NewFeedCollectDefault(http.StatusBadRequest).WithPayload(&models.Error{
-				Code: int64(mcomErrors.Code_STATION_NOT_FOUND),
+				Code: int64(mcomErrors.Code_CARRIER_NOT_FOUND),
 			}),
 			script: []mock.Script{
 				{
@@ -944,63 +1627,37 @@ func TestProduce_FeedCollect(t *testing.T) {
 					},
 				},
 				{
-					Name: mock.FuncFeed,
-					Input: mock.Input{
-						Request: mcom.FeedRequest{
-							Batch: mcom.BatchID{
-								WorkOrder: testWorkOrder1,
-								Number:    int16(testBatch),
-							},
-							FeedContent: []mcom.FeedPerSite{
-								mcom.FeedPerSiteType1{
-									Site: mcomModels.UniqueSite{
-										SiteID: mcomModels.SiteID{
-											Name:  testSiteName1,
-											Index: 0,
-										},
-										Station: testStationA,
-									},
-									Quantity: testQuantity,
-								},
-							},
-						},
-					},
-					Output: mock.Output{
-						Response: mcom.FeedReply{
-							FeedRecordID: "my-feed-id",
-						},
-					},
-				},
-				{
-					Name: mock.FuncUpdateBatch,
+					Name: mock.FuncGetStation,
 					Input: mock.Input{
-						Request: mcom.UpdateBatchRequest{
-							WorkOrder: testWorkOrder1,
-							Number:    int16(testBatch),
-							Status:    workorder.BatchStatus_BATCH_CLOSING,
+						Request: mcom.GetStationRequest{
+							ID: testStationA,
 						},
 					},
 					Output: mock.Output{
-						Error: nil,
+						Response: mcom.GetStationReply{
+							Information: mcom.StationInformation{
+								Code: "99",
+							},
+						},
 					},
 				},
 				{
-					Name: mock.FuncGetStation,
+					Name: mock.FuncGetCarrier,
 					Input: mock.Input{
-						Request: mcom.GetStationRequest{
-							ID: testStationA,
+						Request: mcom.GetCarrierRequest{
+							ID: testCarrierResourceID,
 						},
 					},
 					Output: mock.Output{
 						Error: mcomErrors.Error{
-							Code: mcomErrors.Code_STATION_NOT_FOUND,
+							Code: mcomErrors.Code_CARRIER_NOT_FOUND,
 						},
 					},
 				},
 			},
 		},
 		{
-			name: "carrier not found",
+			name: "resource existed",
 			args: args{
 				params: produce.FeedCollectParams{
 					HTTPRequest: httpRequest,
@@ -1034,7 +1691,10 @@ func TestProduce_FeedCollect(t *testing.T) {
 				principal: principal,
 			},
 			want: produce.NewFeedCollectDefault(http.StatusBadRequest).WithPayload(&models.Error{
-				Code: int64(mcomErrors.Code_CARRIER_NOT_FOUND),
+				Code: int64(mcomErrors.Code_RESOURCE_EXISTED),
+				Details: fmt.Sprintf("step CREATE_RESOURCE failed: %v; compensated: CLOSE_BATCH, FEED", mcomErrors.Error{
+					Code: mcomErrors.Code_RESOURCE_EXISTED,
+				}),
 			}),
 			script: []mock.Script{
 				{
@@ -1074,6 +1734,86 @@ func TestProduce_FeedCollect(t *testing.T) {
 						},
 					},
 				},
+				{
+					Name: mock.FuncGetStation,
+					Input: mock.Input{
+						Request: mcom.GetStationRequest{
+							ID: testStationA,
+						},
+					},
+					Output: mock.Output{
+						Response: mcom.GetStationReply{
+							Information: mcom.StationInformation{
+								Code: "99",
+							},
+						},
+					},
+				},
+				{
+					Name: mock.FuncGetCarrier,
+					Input: mock.Input{
+						Request: mcom.GetCarrierRequest{
+							ID: testCarrierResourceID,
+						},
+					},
+					Output: mock.Output{
+						Response: mcom.GetCarrierReply{
+							ID: testCarrierID,
+						},
+					},
+				},
+				{
+					Name: mock.FuncGetLimitaryHour,
+					Input: mock.Input{
+						Request: mcom.GetLimitaryHourRequest{
+							ProductType: testWorkOrder1ProductType,
+						},
+					},
+					Output: mock.Output{
+						Response: mcom.GetLimitaryHourReply{
+							LimitaryHour: mcom.LimitaryHourParameter{
+								Min: int32(testLimitaryHourMin),
+								Max: int32(testLimitaryHourMax),
+							},
+						},
+					},
+				},
+				{
+					Name: mock.FuncListSiteMaterials,
+					Input: mock.Input{
+						Request: mcom.ListSiteMaterialsRequest{
+							Station: testStationA,
+							Site: mcomModels.SiteID{
+								Name:  testSiteName1,
+								Index: 0,
+							},
+						},
+					},
+					Output: mock.Output{
+						Response: mcom.ListSiteMaterialsReply{
+							{ResourceID: testPreviousResourceID},
+						},
+					},
+				},
+				{
+					Name: mock.FuncGetMaterialResource,
+					Input: mock.Input{
+						Request: mcom.GetMaterialResourceRequest{
+							ResourceID: testPreviousResourceID,
+						},
+					},
+					Output: mock.Output{
+						Response: mcom.GetMaterialResourceReply{
+							{
+								Material: mcom.Material{
+									ResourceID: testPreviousResourceID,
+									Type:       testWorkOrder1ProductType,
+									Quantity:   testQuantity,
+								},
+							},
+						},
+					},
+				},
 				{
 					Name: mock.FuncFeed,
 					Input: mock.Input{
@@ -1116,37 +1856,72 @@ func TestProduce_FeedCollect(t *testing.T) {
 					},
 				},
 				{
-					Name: mock.FuncGetStation,
+					Name: mock.FuncCreateMaterialResources,
 					Input: mock.Input{
-						Request: mcom.GetStationRequest{
-							ID: testStationA,
+						Request: mcom.CreateMaterialResourcesRequest{
+							Materials: []mcom.CreateMaterialResourcesRequestDetail{{
+								Type:           testWorkOrder1ProductType,
+								ID:             testWorkOrder1ProductA,
+								Status:         resources.MaterialStatus_AVAILABLE,
+								Quantity:       testQuantity,
+								Unit:           testUnit,
+								LotNumber:      testLotNumber,
+								ResourceID:     testResourceID,
+								CarrierID:      testCarrierResourceID,
+								ProductionTime: timeNow,
+								ExpiryTime:     expiryTime,
+							}},
 						},
 					},
 					Output: mock.Output{
-						Response: mcom.GetStationReply{
-							Information: mcom.StationInformation{
-								Code: "99",
-							},
+						Error: mcomErrors.Error{
+							Code: mcomErrors.Code_RESOURCE_EXISTED,
 						},
 					},
 				},
 				{
-					Name: mock.FuncGetCarrier,
+					Name: mock.FuncUpdateBatch,
 					Input: mock.Input{
-						Request: mcom.GetCarrierRequest{
-							ID: testCarrierResourceID,
+						Request: mcom.UpdateBatchRequest{
+							WorkOrder: testWorkOrder1,
+							Number:    int16(testBatch),
+							Status:    workOrderBatchStarted,
+						},
+					},
+				},
+				{
+					Name: mock.FuncGetMaterialResource,
+					Input: mock.Input{
+						Request: mcom.GetMaterialResourceRequest{
+							ResourceID: testPreviousResourceID,
 						},
 					},
 					Output: mock.Output{
-						Error: mcomErrors.Error{
-							Code: mcomErrors.Code_CARRIER_NOT_FOUND,
+						Response: mcom.GetMaterialResourceReply{
+							{
+								Material: mcom.Material{
+									ResourceID: testPreviousResourceID,
+									Type:       testWorkOrder1ProductType,
+									Quantity:   decimal.Zero,
+								},
+							},
+						},
+					},
+				},
+				{
+					Name: mock.FuncUpdateMaterialResource,
+					Input: mock.Input{
+						Request: mcom.UpdateMaterialResourceRequest{
+							ResourceID:  testPreviousResourceID,
+							ProductType: testWorkOrder1ProductType,
+							Quantity:    testQuantity,
 						},
 					},
 				},
 			},
 		},
 		{
-			name: "resource existed",
+			name: "not assign resource id",
 			args: args{
 				params: produce.FeedCollectParams{
 					HTTPRequest: httpRequest,
@@ -1169,7 +1944,7 @@ func TestProduce_FeedCollect(t *testing.T) {
 						Collect: &produce.FeedCollectParamsBodyCollect{
 							Group:           1,
 							WorkDate:        strfmt.Date(testSchedulingDate),
-							ResourceID:      testResourceID,
+							ResourceID:      "",
 							CarrierResource: testCarrierResourceID,
 							Sequence:        int64(testSequence),
 							Quantity:        testQuantity.InexactFloat64(),
@@ -1179,9 +1954,7 @@ func TestProduce_FeedCollect(t *testing.T) {
 				},
 				principal: principal,
 			},
-			want: produce.NewFeedCollectDefault(http.StatusBadRequest).WithPayload(&models.Error{
-				Code: int64(mcomErrors.Code_RESOURCE_EXISTED),
-			}),
+			want: produce.NewFeedCollectOK(),
 			script: []mock.Script{
 				{
 					Name: mock.FuncGetWorkOrder,
@@ -1220,47 +1993,6 @@ func TestProduce_FeedCollect(t *testing.T) {
 						},
 					},
 				},
-				{
-					Name: mock.FuncFeed,
-					Input: mock.Input{
-						Request: mcom.FeedRequest{
-							Batch: mcom.BatchID{
-								WorkOrder: testWorkOrder1,
-								Number:    int16(testBatch),
-							},
-							FeedContent: []mcom.FeedPerSite{
-								mcom.FeedPerSiteType1{
-									Site: mcomModels.UniqueSite{
-										SiteID: mcomModels.SiteID{
-											Name:  testSiteName1,
-											Index: 0,
-										},
-										Station: testStationA,
-									},
-									Quantity: testQuantity,
-								},
-							},
-						},
-					},
-					Output: mock.Output{
-						Response: mcom.FeedReply{
-							FeedRecordID: "my-feed-id",
-						},
-					},
-				},
-				{
-					Name: mock.FuncUpdateBatch,
-					Input: mock.Input{
-						Request: mcom.UpdateBatchRequest{
-							WorkOrder: testWorkOrder1,
-							Number:    int16(testBatch),
-							Status:    workorder.BatchStatus_BATCH_CLOSING,
-						},
-					},
-					Output: mock.Output{
-						Error: nil,
-					},
-				},
 				{
 					Name: mock.FuncGetStation,
 					Input: mock.Input{
@@ -1305,6 +2037,83 @@ func TestProduce_FeedCollect(t *testing.T) {
 						},
 					},
 				},
+				{
+					Name: mock.FuncListSiteMaterials,
+					Input: mock.Input{
+						Request: mcom.ListSiteMaterialsRequest{
+							Station: testStationA,
+							Site: mcomModels.SiteID{
+								Name:  testSiteName1,
+								Index: 0,
+							},
+						},
+					},
+					Output: mock.Output{
+						Response: mcom.ListSiteMaterialsReply{
+							{ResourceID: testPreviousResourceID},
+						},
+					},
+				},
+				{
+					Name: mock.FuncGetMaterialResource,
+					Input: mock.Input{
+						Request: mcom.GetMaterialResourceRequest{
+							ResourceID: testPreviousResourceID,
+						},
+					},
+					Output: mock.Output{
+						Response: mcom.GetMaterialResourceReply{
+							{
+								Material: mcom.Material{
+									ResourceID: testPreviousResourceID,
+									Type:       testWorkOrder1ProductType,
+									Quantity:   testQuantity,
+								},
+							},
+						},
+					},
+				},
+				{
+					Name: mock.FuncFeed,
+					Input: mock.Input{
+						Request: mcom.FeedRequest{
+							Batch: mcom.BatchID{
+								WorkOrder: testWorkOrder1,
+								Number:    int16(testBatch),
+							},
+							FeedContent: []mcom.FeedPerSite{
+								mcom.FeedPerSiteType1{
+									Site: mcomModels.UniqueSite{
+										SiteID: mcomModels.SiteID{
+											Name:  testSiteName1,
+											Index: 0,
+										},
+										Station: testStationA,
+									},
+									Quantity: testQuantity,
+								},
+							},
+						},
+					},
+					Output: mock.Output{
+						Response: mcom.FeedReply{
+							FeedRecordID: "my-feed-id",
+						},
+					},
+				},
+				{
+					Name: mock.FuncUpdateBatch,
+					Input: mock.Input{
+						Request: mcom.UpdateBatchRequest{
+							WorkOrder: testWorkOrder1,
+							Number:    int16(testBatch),
+							Status:    workorder.BatchStatus_BATCH_CLOSING,
+						},
+					},
+					Output: mock.Output{
+						Error: nil,
+					},
+				},
 				{
 					Name: mock.FuncCreateMaterialResources,
 					Input: mock.Input{
@@ -1316,23 +2125,60 @@ func TestProduce_FeedCollect(t *testing.T) {
 								Quantity:       testQuantity,
 								Unit:           testUnit,
 								LotNumber:      testLotNumber,
-								ResourceID:     testResourceID,
+								ResourceID:     "",
 								CarrierID:      testCarrierResourceID,
 								ProductionTime: timeNow,
 								ExpiryTime:     expiryTime,
 							}},
 						},
 					},
-					Output: mock.Output{
-						Error: mcomErrors.Error{
-							Code: mcomErrors.Code_RESOURCE_EXISTED,
+					Output: mock.Output{
+						Response: mcom.CreateMaterialResourcesReply{
+							{
+								ID:  testResourceID,
+								OID: testResourceOID,
+							},
+						},
+					},
+				},
+				{
+					Name: mock.FuncUpdateCarrier,
+					Input: mock.Input{
+						Request: mcom.UpdateCarrierRequest{
+							ID:     testCarrierResourceID,
+							Action: mcom.ClearResources{},
+						},
+					},
+				},
+				{
+					Name: mock.FuncUpdateCarrier,
+					Input: mock.Input{
+						Request: mcom.UpdateCarrierRequest{
+							ID: testCarrierResourceID,
+							Action: mcom.BindResources{
+								ResourcesID: []string{testResourceID},
+							},
+						},
+					},
+				},
+				{
+					Name: mock.FuncCreateCollectRecord,
+					Input: mock.Input{
+						Request: mcom.CreateCollectRecordRequest{
+							Sequence:    int16(testSequence),
+							LotNumber:   testLotNumber,
+							WorkOrder:   testWorkOrder1,
+							Station:     testStationA,
+							Quantity:    testQuantity,
+							ResourceOID: testResourceOID,
 						},
 					},
+					Output: mock.Output{},
 				},
 			},
 		},
 		{
-			name: "not assign resource id",
+			name: "record already exists",
 			args: args{
 				params: produce.FeedCollectParams{
 					HTTPRequest: httpRequest,
@@ -1355,7 +2201,7 @@ func TestProduce_FeedCollect(t *testing.T) {
 						Collect: &produce.FeedCollectParamsBodyCollect{
 							Group:           1,
 							WorkDate:        strfmt.Date(testSchedulingDate),
-							ResourceID:      "",
+							ResourceID:      testResourceID,
 							CarrierResource: testCarrierResourceID,
 							Sequence:        int64(testSequence),
 							Quantity:        testQuantity.InexactFloat64(),
@@ -1365,7 +2211,12 @@ func TestProduce_FeedCollect(t *testing.T) {
 				},
 				principal: principal,
 			},
-			want: produce.NewFeedCollectOK(),
+			want: produce.NewFeedCollectDefault(http.StatusBadRequest).WithPayload(&models.Error{
+				Code: int64(mcomErrors.Code_RECORD_ALREADY_EXISTS),
+				Details: fmt.Sprintf("step COLLECT failed: %v; compensated: BIND_CARRIER, CLEAR_CARRIER, CREATE_RESOURCE, CLOSE_BATCH, FEED", mcomErrors.Error{
+					Code: mcomErrors.Code_RECORD_ALREADY_EXISTS,
+				}),
+			}),
 			script: []mock.Script{
 				{
 					Name: mock.FuncGetWorkOrder,
@@ -1404,47 +2255,6 @@ func TestProduce_FeedCollect(t *testing.T) {
 						},
 					},
 				},
-				{
-					Name: mock.FuncFeed,
-					Input: mock.Input{
-						Request: mcom.FeedRequest{
-							Batch: mcom.BatchID{
-								WorkOrder: testWorkOrder1,
-								Number:    int16(testBatch),
-							},
-							FeedContent: []mcom.FeedPerSite{
-								mcom.FeedPerSiteType1{
-									Site: mcomModels.UniqueSite{
-										SiteID: mcomModels.SiteID{
-											Name:  testSiteName1,
-											Index: 0,
-										},
-										Station: testStationA,
-									},
-									Quantity: testQuantity,
-								},
-							},
-						},
-					},
-					Output: mock.Output{
-						Response: mcom.FeedReply{
-							FeedRecordID: "my-feed-id",
-						},
-					},
-				},
-				{
-					Name: mock.FuncUpdateBatch,
-					Input: mock.Input{
-						Request: mcom.UpdateBatchRequest{
-							WorkOrder: testWorkOrder1,
-							Number:    int16(testBatch),
-							Status:    workorder.BatchStatus_BATCH_CLOSING,
-						},
-					},
-					Output: mock.Output{
-						Error: nil,
-					},
-				},
 				{
 					Name: mock.FuncGetStation,
 					Input: mock.Input{
@@ -1469,7 +2279,8 @@ func TestProduce_FeedCollect(t *testing.T) {
 					},
 					Output: mock.Output{
 						Response: mcom.GetCarrierReply{
-							ID: testCarrierID,
+							ID:       testCarrierID,
+							Contents: []string{testPreviousResourceID},
 						},
 					},
 				},
@@ -1489,6 +2300,83 @@ func TestProduce_FeedCollect(t *testing.T) {
 						},
 					},
 				},
+				{
+					Name: mock.FuncListSiteMaterials,
+					Input: mock.Input{
+						Request: mcom.ListSiteMaterialsRequest{
+							Station: testStationA,
+							Site: mcomModels.SiteID{
+								Name:  testSiteName1,
+								Index: 0,
+							},
+						},
+					},
+					Output: mock.Output{
+						Response: mcom.ListSiteMaterialsReply{
+							{ResourceID: testPreviousResourceID},
+						},
+					},
+				},
+				{
+					Name: mock.FuncGetMaterialResource,
+					Input: mock.Input{
+						Request: mcom.GetMaterialResourceRequest{
+							ResourceID: testPreviousResourceID,
+						},
+					},
+					Output: mock.Output{
+						Response: mcom.GetMaterialResourceReply{
+							{
+								Material: mcom.Material{
+									ResourceID: testPreviousResourceID,
+									Type:       testWorkOrder1ProductType,
+									Quantity:   testQuantity,
+								},
+							},
+						},
+					},
+				},
+				{
+					Name: mock.FuncFeed,
+					Input: mock.Input{
+						Request: mcom.FeedRequest{
+							Batch: mcom.BatchID{
+								WorkOrder: testWorkOrder1,
+								Number:    int16(testBatch),
+							},
+							FeedContent: []mcom.FeedPerSite{
+								mcom.FeedPerSiteType1{
+									Site: mcomModels.UniqueSite{
+										SiteID: mcomModels.SiteID{
+											Name:  testSiteName1,
+											Index: 0,
+										},
+										Station: testStationA,
+									},
+									Quantity: testQuantity,
+								},
+							},
+						},
+					},
+					Output: mock.Output{
+						Response: mcom.FeedReply{
+							FeedRecordID: "my-feed-id",
+						},
+					},
+				},
+				{
+					Name: mock.FuncUpdateBatch,
+					Input: mock.Input{
+						Request: mcom.UpdateBatchRequest{
+							WorkOrder: testWorkOrder1,
+							Number:    int16(testBatch),
+							Status:    workorder.BatchStatus_BATCH_CLOSING,
+						},
+					},
+					Output: mock.Output{
+						Error: nil,
+					},
+				},
 				{
 					Name: mock.FuncCreateMaterialResources,
 					Input: mock.Input{
@@ -1500,7 +2388,7 @@ func TestProduce_FeedCollect(t *testing.T) {
 								Quantity:       testQuantity,
 								Unit:           testUnit,
 								LotNumber:      testLotNumber,
-								ResourceID:     "",
+								ResourceID:     testResourceID,
 								CarrierID:      testCarrierResourceID,
 								ProductionTime: timeNow,
 								ExpiryTime:     expiryTime,
@@ -1548,12 +2436,78 @@ func TestProduce_FeedCollect(t *testing.T) {
 							ResourceOID: testResourceOID,
 						},
 					},
-					Output: mock.Output{},
+					Output: mock.Output{
+						Error: mcomErrors.Error{
+							Code: mcomErrors.Code_RECORD_ALREADY_EXISTS,
+						},
+					},
+				},
+				{ // compensations.
+					Name: mock.FuncUpdateCarrier,
+					Input: mock.Input{
+						Request: mcom.UpdateCarrierRequest{
+							ID:     testCarrierResourceID,
+							Action: mcom.ClearResources{},
+						},
+					},
+				},
+				{
+					Name: mock.FuncUpdateCarrier,
+					Input: mock.Input{
+						Request: mcom.UpdateCarrierRequest{
+							ID: testCarrierResourceID,
+							Action: mcom.BindResources{
+								ResourcesID: []string{testPreviousResourceID},
+							},
+						},
+					},
+				},
+				{
+					Name: mock.FuncUpdateMaterialResource,
+					Input: mock.Input{
+						Request: mcom.UpdateMaterialResourceRequest{
+							ResourceID:  testResourceID,
+							ProductType: testWorkOrder1ProductType,
+							Status:      resources.MaterialStatus_UNAVAILABLE,
+							Quantity:    decimal.Zero,
+							Remark:      feedCompensationReason,
+						},
+					},
+				},
+				{
+					Name: mock.FuncUpdateBatch,
+					Input: mock.Input{
+						Request: mcom.UpdateBatchRequest{
+							WorkOrder: testWorkOrder1,
+							Number:    int16(testBatch),
+							Status:    workOrderBatchStarted,
+						},
+					},
+				},
+				// the fed resource was not consumed.
+				{
+					Name: mock.FuncGetMaterialResource,
+					Input: mock.Input{
+						Request: mcom.GetMaterialResourceRequest{
+							ResourceID: testPreviousResourceID,
+						},
+					},
+					Output: mock.Output{
+						Response: mcom.GetMaterialResourceReply{
+							{
+								Material: mcom.Material{
+									ResourceID: testPreviousResourceID,
+									Type:       testWorkOrder1ProductType,
+									Quantity:   testQuantity,
+								},
+							},
+						},
+					},
 				},
 			},
 		},
 		{
-			name: "record already exists",
+			name: "limitary hour not found, success",
 			args: args{
 				params: produce.FeedCollectParams{
 					HTTPRequest: httpRequest,
@@ -1586,9 +2540,7 @@ func TestProduce_FeedCollect(t *testing.T) {
 				},
 				principal: principal,
 			},
-			want: produce.NewFeedCollectDefault(http.StatusBadRequest).WithPayload(&models.Error{
-				Code: int64(mcomErrors.Code_RECORD_ALREADY_EXISTS),
-			}),
+			want: produce.NewFeedCollectOK(),
 			script: []mock.Script{
 				{
 					Name: mock.FuncGetWorkOrder,
@@ -1618,11 +2570,87 @@ func TestProduce_FeedCollect(t *testing.T) {
 						},
 					},
 					Output: mock.Output{
-						Response: mcom.GetBatchReply{
-							Info: mcom.BatchInfo{
-								WorkOrder: testWorkOrder1,
-								Number:    int16(testBatch),
-								Status:    int32(workOrderBatchStarted),
+						Response: mcom.GetBatchReply{
+							Info: mcom.BatchInfo{
+								WorkOrder: testWorkOrder1,
+								Number:    int16(testBatch),
+								Status:    int32(workOrderBatchStarted),
+							},
+						},
+					},
+				},
+				{
+					Name: mock.FuncGetStation,
+					Input: mock.Input{
+						Request: mcom.GetStationRequest{
+							ID: testStationA,
+						},
+					},
+					Output: mock.Output{
+						Response: mcom.GetStationReply{
+							Information: mcom.StationInformation{
+								Code: "99",
+							},
+						},
+					},
+				},
+				{
+					Name: mock.FuncGetCarrier,
+					Input: mock.Input{
+						Request: mcom.GetCarrierRequest{
+							ID: testCarrierResourceID,
+						},
+					},
+					Output: mock.Output{
+						Response: mcom.GetCarrierReply{
+							ID: testCarrierID,
+						},
+					},
+				},
+				{
+					Name: mock.FuncGetLimitaryHour,
+					Input: mock.Input{
+						Request: mcom.GetLimitaryHourRequest{
+							ProductType: testWorkOrder1ProductType,
+						},
+					},
+					Output: mock.Output{
+						Response: mcom.GetLimitaryHourReply{},
+						Error:    mcomErrors.Error{Code: mcomErrors.Code_LIMITARY_HOUR_NOT_FOUND},
+					},
+				},
+				{
+					Name: mock.FuncListSiteMaterials,
+					Input: mock.Input{
+						Request: mcom.ListSiteMaterialsRequest{
+							Station: testStationA,
+							Site: mcomModels.SiteID{
+								Name:  testSiteName1,
+								Index: 0,
+							},
+						},
+					},
+					Output: mock.Output{
+						Response: mcom.ListSiteMaterialsReply{
+							{ResourceID: testPreviousResourceID},
+						},
+					},
+				},
+				{
+					Name: mock.FuncGetMaterialResource,
+					Input: mock.Input{
+						Request: mcom.GetMaterialResourceRequest{
+							ResourceID: testPreviousResourceID,
+						},
+					},
+					Output: mock.Output{
+						Response: mcom.GetMaterialResourceReply{
+							{
+								Material: mcom.Material{
+									ResourceID: testPreviousResourceID,
+									Type:       testWorkOrder1ProductType,
+									Quantity:   testQuantity,
+								},
 							},
 						},
 					},
@@ -1668,50 +2696,6 @@ func TestProduce_FeedCollect(t *testing.T) {
 						Error: nil,
 					},
 				},
-				{
-					Name: mock.FuncGetStation,
-					Input: mock.Input{
-						Request: mcom.GetStationRequest{
-							ID: testStationA,
-						},
-					},
-					Output: mock.Output{
-						Response: mcom.GetStationReply{
-							Information: mcom.StationInformation{
-								Code: "99",
-							},
-						},
-					},
-				},
-				{
-					Name: mock.FuncGetCarrier,
-					Input: mock.Input{
-						Request: mcom.GetCarrierRequest{
-							ID: testCarrierResourceID,
-						},
-					},
-					Output: mock.Output{
-						Response: mcom.GetCarrierReply{
-							ID: testCarrierID,
-						},
-					},
-				},
-				{
-					Name: mock.FuncGetLimitaryHour,
-					Input: mock.Input{
-						Request: mcom.GetLimitaryHourRequest{
-							ProductType: testWorkOrder1ProductType,
-						},
-					},
-					Output: mock.Output{
-						Response: mcom.GetLimitaryHourReply{
-							LimitaryHour: mcom.LimitaryHourParameter{
-								Min: int32(testLimitaryHourMin),
-								Max: int32(testLimitaryHourMax),
-							},
-						},
-					},
-				},
 				{
 					Name: mock.FuncCreateMaterialResources,
 					Input: mock.Input{
@@ -1726,7 +2710,7 @@ func TestProduce_FeedCollect(t *testing.T) {
 								ResourceID:     testResourceID,
 								CarrierID:      testCarrierResourceID,
 								ProductionTime: timeNow,
-								ExpiryTime:     expiryTime,
+								ExpiryTime:     timeNow,
 							}},
 						},
 					},
@@ -1771,16 +2755,12 @@ func TestProduce_FeedCollect(t *testing.T) {
 							ResourceOID: testResourceOID,
 						},
 					},
-					Output: mock.Output{
-						Error: mcomErrors.Error{
-							Code: mcomErrors.Code_RECORD_ALREADY_EXISTS,
-						},
-					},
+					Output: mock.Output{},
 				},
 			},
 		},
 		{
-			name: "limitary hour not found, success",
+			name: "printer not defined, nothing changed",
 			args: args{
 				params: produce.FeedCollectParams{
 					HTTPRequest: httpRequest,
@@ -1801,19 +2781,21 @@ func TestProduce_FeedCollect(t *testing.T) {
 							},
 						},
 						Collect: &produce.FeedCollectParamsBodyCollect{
-							Group:           1,
-							WorkDate:        strfmt.Date(testSchedulingDate),
-							ResourceID:      testResourceID,
-							CarrierResource: testCarrierResourceID,
-							Sequence:        int64(testSequence),
-							Quantity:        testQuantity.InexactFloat64(),
-							Print:           false,
+							Group:      1,
+							WorkDate:   strfmt.Date(testSchedulingDate),
+							ResourceID: testResourceID,
+							Sequence:   int64(testSequence),
+							Quantity:   testQuantity.InexactFloat64(),
+							Print:      true,
 						},
 					},
 				},
 				principal: principal,
 			},
-			want: produce.NewFeedCollectOK(),
+			want: produce.NewFeedCollectDefault(http.StatusBadRequest).WithPayload(&models.Error{
+				Code:    int64(mcomErrors.Code_STATION_PRINTER_NOT_DEFINED),
+				Details: fmt.Sprintf("station %s no defined printer", testStationA),
+			}),
 			script: []mock.Script{
 				{
 					Name: mock.FuncGetWorkOrder,
@@ -1824,7 +2806,8 @@ func TestProduce_FeedCollect(t *testing.T) {
 					},
 					Output: mock.Output{
 						Response: mcom.GetWorkOrderReply{
-							ID: testWorkOrder1,
+							ID:      testWorkOrder1,
+							Station: testStationA,
 							Product: mcom.Product{
 								ID:   testWorkOrder1ProductA,
 								Type: testWorkOrder1ProductType,
@@ -1852,47 +2835,6 @@ func TestProduce_FeedCollect(t *testing.T) {
 						},
 					},
 				},
-				{
-					Name: mock.FuncFeed,
-					Input: mock.Input{
-						Request: mcom.FeedRequest{
-							Batch: mcom.BatchID{
-								WorkOrder: testWorkOrder1,
-								Number:    int16(testBatch),
-							},
-							FeedContent: []mcom.FeedPerSite{
-								mcom.FeedPerSiteType1{
-									Site: mcomModels.UniqueSite{
-										SiteID: mcomModels.SiteID{
-											Name:  testSiteName1,
-											Index: 0,
-										},
-										Station: testStationA,
-									},
-									Quantity: testQuantity,
-								},
-							},
-						},
-					},
-					Output: mock.Output{
-						Response: mcom.FeedReply{
-							FeedRecordID: "my-feed-id",
-						},
-					},
-				},
-				{
-					Name: mock.FuncUpdateBatch,
-					Input: mock.Input{
-						Request: mcom.UpdateBatchRequest{
-							WorkOrder: testWorkOrder1,
-							Number:    int16(testBatch),
-							Status:    workorder.BatchStatus_BATCH_CLOSING,
-						},
-					},
-					Output: mock.Output{
-						Error: nil,
-					},
-				},
 				{
 					Name: mock.FuncGetStation,
 					Input: mock.Input{
@@ -1909,90 +2851,134 @@ func TestProduce_FeedCollect(t *testing.T) {
 					},
 				},
 				{
-					Name: mock.FuncGetCarrier,
+					Name: mock.FuncGetLimitaryHour,
 					Input: mock.Input{
-						Request: mcom.GetCarrierRequest{
-							ID: testCarrierResourceID,
+						Request: mcom.GetLimitaryHourRequest{
+							ProductType: testWorkOrder1ProductType,
 						},
 					},
 					Output: mock.Output{
-						Response: mcom.GetCarrierReply{
-							ID: testCarrierID,
+						Response: mcom.GetLimitaryHourReply{
+							LimitaryHour: mcom.LimitaryHourParameter{
+								Min: int32(testLimitaryHourMin),
+								Max: int32(testLimitaryHourMax),
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "unknown defect reason, nothing changed",
+			args: args{
+				params: produce.FeedCollectParams{
+					HTTPRequest: httpRequest,
+					WorkOrderID: testWorkOrder1,
+					Body: produce.FeedCollectBody{
+						StationID: testStationA,
+						Feed: &produce.FeedCollectParamsBodyFeed{
+							Batch: int64(testBatch),
+							Source: []*produce.FeedCollectParamsBodyFeedSourceItems0{
+								{
+									SiteInfo: &models.SiteInfo{
+										StationID: testStationA,
+										SiteName:  testSiteName1,
+										SiteIndex: 0,
+									},
+									Quantity: testQuantity.InexactFloat64(),
+								},
+							},
+						},
+						Collect: &produce.FeedCollectParamsBodyCollect{
+							Group:      1,
+							WorkDate:   strfmt.Date(testSchedulingDate),
+							ResourceID: testResourceID,
+							Sequence:   int64(testSequence),
+							Quantity:   testQuantity.InexactFloat64(),
+							Defects: models.CollectDefects{
+								{
+									ReasonCode: &testDefectReason,
+									Quantity:   &testDefectQuantity,
+								},
+							},
 						},
 					},
 				},
+				principal: principal,
+			},
+			want: produce.NewFeedCollectDefault(http.StatusBadRequest).WithPayload(&models.Error{
+				Code:    int64(mcomErrors.Code_BAD_REQUEST),
+				Details: fmt.Sprintf("unknown or disabled defect reason: %s", testDefectReason),
+			}),
+			script: []mock.Script{
 				{
-					Name: mock.FuncGetLimitaryHour,
+					Name: mock.FuncGetWorkOrder,
 					Input: mock.Input{
-						Request: mcom.GetLimitaryHourRequest{
-							ProductType: testWorkOrder1ProductType,
+						Request: mcom.GetWorkOrderRequest{
+							ID: testWorkOrder1,
 						},
 					},
 					Output: mock.Output{
-						Response: mcom.GetLimitaryHourReply{},
-						Error:    mcomErrors.Error{Code: mcomErrors.Code_LIMITARY_HOUR_NOT_FOUND},
+						Response: mcom.GetWorkOrderReply{
+							ID:      testWorkOrder1,
+							Station: testStationA,
+							Product: mcom.Product{
+								ID:   testWorkOrder1ProductA,
+								Type: testWorkOrder1ProductType,
+							},
+							Unit:   testUnit,
+							Status: workorder.Status_ACTIVE,
+						},
 					},
 				},
 				{
-					Name: mock.FuncCreateMaterialResources,
+					Name: mock.FuncGetBatch,
 					Input: mock.Input{
-						Request: mcom.CreateMaterialResourcesRequest{
-							Materials: []mcom.CreateMaterialResourcesRequestDetail{{
-								Type:           testWorkOrder1ProductType,
-								ID:             testWorkOrder1ProductA,
-								Status:         resources.MaterialStatus_AVAILABLE,
-								Quantity:       testQuantity,
-								Unit:           testUnit,
-								LotNumber:      testLotNumber,
-								ResourceID:     testResourceID,
-								CarrierID:      testCarrierResourceID,
-								ProductionTime: timeNow,
-								ExpiryTime:     timeNow,
-							}},
+						Request: mcom.GetBatchRequest{
+							WorkOrder: testWorkOrder1,
+							Number:    int16(testBatch),
 						},
 					},
 					Output: mock.Output{
-						Response: mcom.CreateMaterialResourcesReply{
-							{
-								ID:  testResourceID,
-								OID: testResourceOID,
+						Response: mcom.GetBatchReply{
+							Info: mcom.BatchInfo{
+								WorkOrder: testWorkOrder1,
+								Number:    int16(testBatch),
+								Status:    int32(workOrderBatchStarted),
 							},
 						},
 					},
 				},
 				{
-					Name: mock.FuncUpdateCarrier,
+					Name: mock.FuncGetStation,
 					Input: mock.Input{
-						Request: mcom.UpdateCarrierRequest{
-							ID:     testCarrierResourceID,
-							Action: mcom.ClearResources{},
+						Request: mcom.GetStationRequest{
+							ID: testStationA,
 						},
 					},
-				},
-				{
-					Name: mock.FuncUpdateCarrier,
-					Input: mock.Input{
-						Request: mcom.UpdateCarrierRequest{
-							ID: testCarrierResourceID,
-							Action: mcom.BindResources{
-								ResourcesID: []string{testResourceID},
+					Output: mock.Output{
+						Response: mcom.GetStationReply{
+							Information: mcom.StationInformation{
+								Code: "99",
 							},
 						},
 					},
 				},
 				{
-					Name: mock.FuncCreateCollectRecord,
+					Name: mock.FuncGetLimitaryHour,
 					Input: mock.Input{
-						Request: mcom.CreateCollectRecordRequest{
-							Sequence:    int16(testSequence),
-							LotNumber:   testLotNumber,
-							WorkOrder:   testWorkOrder1,
-							Station:     testStationA,
-							Quantity:    testQuantity,
-							ResourceOID: testResourceOID,
+						Request: mcom.GetLimitaryHourRequest{
+							ProductType: testWorkOrder1ProductType,
+						},
+					},
+					Output: mock.Output{
+						Response: mcom.GetLimitaryHourReply{
+							LimitaryHour: mcom.LimitaryHourParameter{
+								Min: int32(testLimitaryHourMin),
+								Max: int32(testLimitaryHourMax),
+							},
 						},
 					},
-					Output: mock.Output{},
 				},
 			},
 		},
@@ -2053,7 +3039,7 @@ func TestProduce_FeedCollect(t *testing.T) {
 			dm, err := mock.New(tt.script)
 			assert.NoErrorf(err, tt.name)
 
-			s := mustNewProduce(dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
+			s := mustNewProduce(t, dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
 				return true
 			})
 			if got := s.FeedCollect(tt.args.params, tt.args.principal); !assert.Equal(got, tt.want) {
@@ -2067,7 +3053,7 @@ func TestProduce_FeedCollect(t *testing.T) {
 	{ // forbidden access
 		dm, err := mock.New(nil)
 		assert.NoError(err)
-		r := mustNewProduce(dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
+		r := mustNewProduce(t, dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
 			return false
 		})
 		rep, ok := r.FeedCollect(produce.FeedCollectParams{
@@ -2104,9 +3090,19 @@ func TestProduce_FeedCollect(t *testing.T) {
 }
 
 func mustNewProduce(
+	t *testing.T,
 	dm mcom.DataManager,
 	hasPermission func(id kenda.FunctionOperationID, roles []models.Role) bool,
 ) service.Produce {
-	s := NewProduce(dm, hasPermission, Config{FontPath: "fake-path"})
+	stores := storetest.New(t)
+	s := NewProduce(dm, hasPermission, Config{FontPath: "fake-path", Collects: stores.Collects, Defects: stores.Defects, Feeds: stores.Feeds, Holds: stores.Holds, IDRules: newIDRules(), Records: stores.Records})
 	return s
 }
+
+func newIDRules() *idrule.Generator {
+	g, err := idrule.NewGenerator(idrule.Config{}, nil)
+	if err != nil {
+		panic(err)
+	}
+	return g
+}
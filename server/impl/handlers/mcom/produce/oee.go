@@ -0,0 +1,352 @@
+package produce
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/go-openapi/runtime/middleware"
+	"github.com/go-openapi/strfmt"
+	"github.com/shopspring/decimal"
+
+	commonsCtx "gitlab.kenda.com.tw/kenda/commons/v2/utils/context"
+	"gitlab.kenda.com.tw/kenda/mcom"
+	mcomErrors "gitlab.kenda.com.tw/kenda/mcom/errors"
+
+	"gitlab.kenda.com.tw/kenda/mui/server/database"
+	"gitlab.kenda.com.tw/kenda/mui/server/impl/utils"
+	"gitlab.kenda.com.tw/kenda/mui/server/impl/utils/oee"
+	"gitlab.kenda.com.tw/kenda/mui/server/protobuf/kenda"
+	"gitlab.kenda.com.tw/kenda/mui/server/swagger/models"
+	"gitlab.kenda.com.tw/kenda/mui/server/swagger/restapi/operations/produce"
+)
+
+// DefaultCycleTimeControl is the common control of the recipe whose value is
+// the standard cycle time in seconds, if none is configured.
+const DefaultCycleTimeControl = "CYCLE_TIME"
+
+// maxOEERange is the longest time range of an OEE query.
+const maxOEERange = 92 * 24 * time.Hour
+
+// GetStationOEE implements.
+func (p Produce) GetStationOEE(params produce.GetStationOEEParams, principal *models.Principal) middleware.Responder {
+	if !p.hasPermission(kenda.FunctionOperationID_GET_STATION_OEE, principal.Roles) {
+		return produce.NewGetStationOEEDefault(http.StatusForbidden)
+	}
+	ctx := commonsCtx.WithUserID(params.HTTPRequest.Context(), principal.ID)
+
+	since, until := time.Time(params.Since), time.Time(params.Until)
+	if !until.After(since) || until.Sub(since) > maxOEERange {
+		return utils.ParseError(ctx, produce.NewGetStationOEEDefault(0), mcomErrors.Error{
+			Code:    mcomErrors.Code_BAD_REQUEST,
+			Details: "until must be after since and within 92 days",
+		})
+	}
+	var station string
+	if params.StationID != nil {
+		station = *params.StationID
+	}
+	byDay := params.Granularity != nil && *params.Granularity == "day"
+
+	report, err := p.calculateOEE(ctx, station, since, until)
+	if err != nil {
+		return utils.ParseError(ctx, produce.NewGetStationOEEDefault(0), err)
+	}
+
+	data := &produce.GetStationOEEOKBodyData{
+		Items:             []*models.StationOEE{},
+		Summary:           make([]*models.StationOEE, len(report.stations)),
+		UnknownCycleTimes: report.unknownCycleTimes,
+	}
+	for i, s := range report.stations {
+		var total oee.Metrics
+		for j, m := range s.metrics {
+			total = total.Add(m)
+			period := report.periods[j]
+			if byDay {
+				// merged with the following shifts of the same day.
+				if j+1 < len(s.metrics) && report.periods[j+1].Day.Equal(period.Day) {
+					continue
+				}
+				period.Shift = ""
+				m = sumDay(report.periods, s.metrics, j)
+			}
+			item := toStationOEE(s.station, m)
+			day := strfmt.Date(period.Day)
+			item.Date = &day
+			item.Shift = period.Shift
+			data.Items = append(data.Items, item)
+		}
+		data.Summary[i] = toStationOEE(s.station, total)
+	}
+	return produce.NewGetStationOEEOK().WithPayload(&produce.GetStationOEEOKBody{Data: data})
+}
+
+// sumDay returns the sum of the metrics of the day of the periods[last], which
+// is the last period of the day.
+func sumDay(periods []oee.Period, metrics []oee.Metrics, last int) oee.Metrics {
+	var m oee.Metrics
+	for i := last; i >= 0 && periods[i].Day.Equal(periods[last].Day); i-- {
+		m = m.Add(metrics[i])
+	}
+	return m
+}
+
+func toStationOEE(station string, m oee.Metrics) *models.StationOEE {
+	return &models.StationOEE{
+		StationID:        station,
+		PlannedSeconds:   int64(m.Planned / time.Second),
+		DowntimeSeconds:  int64(m.Downtime / time.Second),
+		RunSeconds:       int64(m.Run() / time.Second),
+		StandardSeconds:  int64(m.Standard / time.Second),
+		GoodQuantity:     m.Good.String(),
+		RejectedQuantity: m.Rejected.String(),
+		Availability:     m.Availability(),
+		Performance:      m.Performance(),
+		Quality:          m.Quality(),
+		Oee:              m.OEE(),
+	}
+}
+
+type stationMetrics struct {
+	station string
+	// metrics of each of the periods.
+	metrics []oee.Metrics
+}
+
+type oeeReport struct {
+	periods  []oee.Period
+	stations []stationMetrics
+	// unknownCycleTimes are the work orders without a standard cycle time.
+	unknownCycleTimes []string
+}
+
+// calculateOEE returns the metrics of the station, or of all the stations
+// signed in during the time range if station is empty.
+func (p Produce) calculateOEE(ctx context.Context, station string, since, until time.Time) (oeeReport, error) {
+	signIns, err := p.config.StationLogs.ListStationSignIns(ctx, station, since, until)
+	if err != nil {
+		return oeeReport{}, err
+	}
+	downtimes, err := p.config.StationLogs.ListDowntimes(ctx, station, since, until)
+	if err != nil {
+		return oeeReport{}, err
+	}
+	filter := database.RecordFilter{Station: station, Since: since, Until: until}
+	collects, _, err := p.config.Records.ListCollectRecords(ctx, filter, database.Pagination{})
+	if err != nil {
+		return oeeReport{}, err
+	}
+	defects, err := p.config.Defects.ListCollectDefects(ctx, filter)
+	if err != nil {
+		return oeeReport{}, err
+	}
+
+	records := make(map[string]*oee.Records)
+	stationRecords := func(station string) *oee.Records {
+		r, ok := records[station]
+		if !ok {
+			r = &oee.Records{}
+			records[station] = r
+		}
+		return r
+	}
+	if station != "" {
+		stationRecords(station)
+	}
+
+	end := time.Now()
+	if until.Before(end) {
+		end = until
+	}
+	for _, signIn := range signIns {
+		signedOutAt := end
+		if signIn.SignedOutAt != nil {
+			signedOutAt = *signIn.SignedOutAt
+		}
+		r := stationRecords(signIn.Station)
+		r.SignIns = append(r.SignIns, oee.Interval{Start: signIn.SignedInAt, End: signedOutAt})
+	}
+	for _, downtime := range downtimes {
+		r := stationRecords(downtime.Station)
+		r.Downtimes = append(r.Downtimes, oee.Interval{Start: downtime.StartedAt, End: downtime.EndedAt})
+	}
+
+	cycleTimes := newCycleTimes(p)
+	type collectKey struct {
+		workOrder string
+		sequence  int16
+	}
+	voided := make(map[collectKey]bool)
+	// a batch is a cycle, which is produced at the time of its first collect.
+	// The outputs without the batch, e.g. collected through MES, are a cycle
+	// if they were collected by the same request.
+	batches := make(map[database.BatchKey]int)
+	requests := make(map[collectKey]int)
+	// the collects are listed in reverse order.
+	for i := len(collects) - 1; i >= 0; i-- {
+		collect := collects[i]
+		good := collect.Quantity
+		if collect.Reversed {
+			// an adjusted collect counts the adjusted quantity.
+			if !collect.AdjustedQuantity.Valid {
+				voided[collectKey{workOrder: collect.WorkOrder, sequence: collect.Sequence}] = true
+				continue
+			}
+			good = collect.AdjustedQuantity.Decimal
+		}
+		r := stationRecords(collect.Station)
+		r.Outputs = append(r.Outputs, oee.Output{
+			Time:     collect.CreatedAt,
+			Good:     good,
+			Rejected: decimal.Zero,
+		})
+
+		if collect.Batch != nil {
+			key := database.BatchKey{WorkOrder: collect.WorkOrder, Batch: *collect.Batch}
+			if batches[key]++; batches[key] > 1 {
+				continue
+			}
+		} else {
+			key := collectKey{workOrder: collect.WorkOrder, sequence: collect.FirstSequence}
+			if collect.FirstSequence == 0 {
+				key.sequence = collect.Sequence
+			}
+			if requests[key]++; requests[key] > 1 {
+				continue
+			}
+		}
+		standard, err := cycleTimes.get(ctx, collect.WorkOrder, collect.Station)
+		if err != nil {
+			return oeeReport{}, err
+		}
+		r.Cycles = append(r.Cycles, oee.Cycle{Time: collect.CreatedAt, Standard: standard})
+	}
+	for _, defect := range defects {
+		if voided[collectKey{workOrder: defect.WorkOrder, sequence: defect.Sequence}] {
+			continue
+		}
+		r := stationRecords(defect.Station)
+		r.Outputs = append(r.Outputs, oee.Output{
+			Time:     defect.CreatedAt,
+			Good:     decimal.Zero,
+			Rejected: defect.Quantity,
+		})
+	}
+
+	report := oeeReport{
+		periods:           oee.Periods(p.config.Shifts, since, until),
+		stations:          make([]stationMetrics, 0, len(records)),
+		unknownCycleTimes: cycleTimes.unknown(),
+	}
+	for station, r := range records {
+		report.stations = append(report.stations, stationMetrics{
+			station: station,
+			metrics: oee.Calculate(report.periods, *r),
+		})
+	}
+	sort.Slice(report.stations, func(i, j int) bool {
+		return report.stations[i].station < report.stations[j].station
+	})
+	return report, nil
+}
+
+// cycleTimes looks up the standard cycle times of the work orders from their
+// recipes.
+type cycleTimes struct {
+	p       Produce
+	control string
+	// times are 0 if unknown.
+	times map[cycleKey]time.Duration
+}
+
+type cycleKey struct {
+	workOrder string
+	station   string
+}
+
+func newCycleTimes(p Produce) *cycleTimes {
+	control := p.config.CycleTimeControl
+	if control == "" {
+		control = DefaultCycleTimeControl
+	}
+	return &cycleTimes{
+		p:       p,
+		control: control,
+		times:   make(map[cycleKey]time.Duration),
+	}
+}
+
+// get returns the standard cycle time of the work order at the station, or 0
+// if the work order or its cycle time is not found.
+func (c *cycleTimes) get(ctx context.Context, workOrder, station string) (time.Duration, error) {
+	key := cycleKey{workOrder: workOrder, station: station}
+	if d, ok := c.times[key]; ok {
+		return d, nil
+	}
+
+	d, err := c.lookup(ctx, workOrder, station)
+	if err != nil {
+		if _, ok := mcomErrors.As(err); !ok {
+			return 0, err
+		}
+	}
+	c.times[key] = d
+	return d, nil
+}
+
+func (c *cycleTimes) lookup(ctx context.Context, workOrder, station string) (time.Duration, error) {
+	getWorkOrder, err := c.p.dm.GetWorkOrder(ctx, mcom.GetWorkOrderRequest{ID: workOrder})
+	if err != nil {
+		return 0, err
+	}
+	process, err := c.p.dm.GetProcessDefinition(ctx, mcom.GetProcessDefinitionRequest{
+		RecipeID:    getWorkOrder.RecipeID,
+		ProcessName: getWorkOrder.Process.Name,
+		ProcessType: getWorkOrder.Process.Type,
+	})
+	if err != nil {
+		return 0, err
+	}
+	for _, config := range process.Configs {
+		if !containsString(config.Stations, station) {
+			continue
+		}
+		for _, control := range config.CommonControls {
+			if control.Name != c.control || control.Param == nil || control.Param.Mid == nil {
+				continue
+			}
+			seconds := *control.Param.Mid
+			if seconds.IsPositive() {
+				return time.Duration(seconds.Mul(decimal.NewFromInt(int64(time.Second))).IntPart()), nil
+			}
+		}
+	}
+	return 0, nil
+}
+
+// unknown returns the work orders without a standard cycle time.
+func (c *cycleTimes) unknown() []string {
+	set := make(map[string]bool)
+	for key, d := range c.times {
+		if d == 0 {
+			set[key.workOrder] = true
+		}
+	}
+	workOrders := make([]string, 0, len(set))
+	for workOrder := range set {
+		workOrders = append(workOrders, workOrder)
+	}
+	sort.Strings(workOrders)
+	return workOrders
+}
+
+func containsString(s []string, v string) bool {
+	for _, e := range s {
+		if e == v {
+			return true
+		}
+	}
+	return false
+}
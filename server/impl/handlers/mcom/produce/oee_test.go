@@ -0,0 +1,288 @@
+package produce
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-openapi/strfmt"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+
+	"gitlab.kenda.com.tw/kenda/mcom"
+	mcomErrors "gitlab.kenda.com.tw/kenda/mcom/errors"
+	"gitlab.kenda.com.tw/kenda/mcom/mock"
+
+	"gitlab.kenda.com.tw/kenda/mui/server/database"
+	"gitlab.kenda.com.tw/kenda/mui/server/database/storetest"
+	"gitlab.kenda.com.tw/kenda/mui/server/impl/service"
+	"gitlab.kenda.com.tw/kenda/mui/server/impl/utils/oee"
+	"gitlab.kenda.com.tw/kenda/mui/server/protobuf/kenda"
+	"gitlab.kenda.com.tw/kenda/mui/server/swagger/models"
+	"gitlab.kenda.com.tw/kenda/mui/server/swagger/restapi/operations/produce"
+)
+
+func TestProduce_GetStationOEE(t *testing.T) {
+	assert := assert.New(t)
+
+	const testWorkOrderMES = "WORKORDERID002"
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2024, 3, day, hour, minute, 0, 0, time.Local)
+	}
+	batch := func(n int16) *int16 { return &n }
+	signedOutAt := at(7, 19, 0)
+
+	stores := storetest.New(t)
+	ctx := context.Background()
+	for _, signIn := range []database.StationSignIn{
+		{Station: testStationA, SignedInAt: at(7, 9, 0), SignedOutAt: &signedOutAt},
+		// not signed out.
+		{Station: testStationA, SignedInAt: at(7, 21, 0)},
+	} {
+		assert.NoError(stores.StationLogs.SignInStation(ctx, signIn))
+	}
+	assert.NoError(stores.StationLogs.CreateDowntime(ctx, database.Downtime{
+		Station: testStationA, Reason: "changeover", StartedAt: at(7, 10, 0), EndedAt: at(7, 11, 0),
+	}))
+	assert.NoError(stores.Records.CreateRecords(ctx, nil, []database.CollectRecord{
+		{WorkOrder: testWorkOrder1, Sequence: 1, Batch: batch(1), Station: testStationA, Quantity: decimal.NewFromInt(40), CreatedAt: at(7, 10, 30)},
+		{WorkOrder: testWorkOrder1, Sequence: 2, Batch: batch(1), Station: testStationA, Quantity: decimal.NewFromInt(20), CreatedAt: at(7, 11, 30)},
+		{WorkOrder: testWorkOrderMES, Sequence: 1, Station: testStationA, Quantity: decimal.NewFromInt(30), CreatedAt: at(7, 12, 0)},
+		{WorkOrder: testWorkOrder1, Sequence: 3, Batch: batch(2), Station: testStationA, Quantity: decimal.NewFromInt(50), CreatedAt: at(7, 22, 0)},
+		{WorkOrder: testWorkOrder1, Sequence: 4, Batch: batch(3), Station: testStationA, Quantity: decimal.NewFromInt(10), CreatedAt: at(7, 23, 0)},
+	}))
+	// the third collect is adjusted to 45 and the fourth is voided.
+	assert.NoError(stores.Collects.CreateCollectReversal(ctx, database.CollectReversal{
+		WorkOrder:        testWorkOrder1,
+		Sequence:         3,
+		Quantity:         decimal.NewFromInt(50),
+		AdjustedQuantity: decimal.NewNullDecimal(decimal.NewFromInt(45)),
+		Reason:           "wrong quantity",
+	}))
+	assert.NoError(stores.Collects.CreateCollectReversal(ctx, database.CollectReversal{
+		WorkOrder: testWorkOrder1,
+		Sequence:  4,
+		Quantity:  decimal.NewFromInt(10),
+		Reason:    "wrong output",
+	}))
+	assert.NoError(stores.Defects.CreateCollectDefects(ctx, []database.CollectDefect{
+		{WorkOrder: testWorkOrder1, Sequence: 1, Batch: 1, Station: testStationA, Kind: database.DefectKindDefect, Quantity: decimal.NewFromInt(10), CreatedAt: at(7, 10, 30)},
+	}))
+	// of the voided collect.
+	assert.NoError(stores.Defects.CreateCollectDefects(ctx, []database.CollectDefect{
+		{WorkOrder: testWorkOrder1, Sequence: 4, Batch: 3, Station: testStationA, Kind: database.DefectKindScrap, Quantity: decimal.NewFromInt(5), CreatedAt: at(7, 23, 0)},
+	}))
+
+	cycleTime := decimal.NewFromInt(3 * 60 * 60)
+	scripts := []mock.Script{
+		{
+			Name:  mock.FuncGetWorkOrder,
+			Input: mock.Input{Request: mcom.GetWorkOrderRequest{ID: testWorkOrder1}},
+			Output: mock.Output{Response: mcom.GetWorkOrderReply{
+				ID:       testWorkOrder1,
+				RecipeID: "RECIPE",
+				Process:  mcom.WorkOrderProcess{Name: "PROCESS", Type: "TYPE"},
+			}},
+		},
+		{
+			Name: mock.FuncGetProcessDefinition,
+			Input: mock.Input{Request: mcom.GetProcessDefinitionRequest{
+				RecipeID:    "RECIPE",
+				ProcessName: "PROCESS",
+				ProcessType: "TYPE",
+			}},
+			Output: mock.Output{Response: mcom.GetProcessDefinitionReply{
+				ProcessDefinition: mcom.ProcessDefinition{
+					Configs: []*mcom.RecipeProcessConfig{
+						{
+							Stations: []string{"OTHER"},
+							CommonControls: []*mcom.RecipeProperty{
+								{Name: "CT", Param: &mcom.RecipePropertyParameter{Mid: &cycleTime}},
+							},
+						},
+						{
+							Stations: []string{testStationA},
+							CommonControls: []*mcom.RecipeProperty{
+								{Name: "TEMPERATURE", Param: &mcom.RecipePropertyParameter{}},
+								{Name: "CT", Param: &mcom.RecipePropertyParameter{Mid: &cycleTime}},
+							},
+						},
+					},
+				},
+			}},
+		},
+		{
+			Name:   mock.FuncGetWorkOrder,
+			Input:  mock.Input{Request: mcom.GetWorkOrderRequest{ID: testWorkOrderMES}},
+			Output: mock.Output{Error: mcomErrors.Error{Code: mcomErrors.Code_WORKORDER_NOT_FOUND}},
+		},
+	}
+	newProduce := func(dm mcom.DataManager, allowed bool) service.Produce {
+		return NewProduce(dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
+			return allowed
+		}, Config{
+			Records:          stores.Records,
+			Defects:          stores.Defects,
+			StationLogs:      stores.StationLogs,
+			Shifts:           []oee.Shift{{Name: "B", Start: 20 * time.Hour}, {Name: "A", Start: 8 * time.Hour}},
+			CycleTimeControl: "CT",
+		})
+	}
+	httpRequest := httptest.NewRequest("GET", "/production-flow/oee", nil)
+	station := testStationA
+	params := func(granularity string) produce.GetStationOEEParams {
+		return produce.GetStationOEEParams{
+			HTTPRequest: httpRequest,
+			StationID:   &station,
+			Since:       strfmt.DateTime(at(7, 8, 0)),
+			Until:       strfmt.DateTime(at(8, 8, 0)),
+			Granularity: &granularity,
+		}
+	}
+	day := strfmt.Date(at(7, 0, 0))
+
+	{ // by shift
+		dm, err := mock.New(scripts)
+		assert.NoError(err)
+		rep, ok := newProduce(dm, true).GetStationOEE(params("shift"), principal).(*produce.GetStationOEEOK)
+		if assert.True(ok) {
+			data := rep.Payload.Data
+			assert.Equal([]string{testWorkOrderMES}, data.UnknownCycleTimes)
+			if assert.Len(data.Items, 2) {
+				a := data.Items[0]
+				assert.Equal(&day, a.Date)
+				assert.Equal("A", a.Shift)
+				assert.Equal(int64(10*60*60), a.PlannedSeconds)
+				assert.Equal(int64(60*60), a.DowntimeSeconds)
+				assert.Equal(int64(9*60*60), a.RunSeconds)
+				assert.Equal(int64(3*60*60), a.StandardSeconds)
+				assert.Equal("90", a.GoodQuantity)
+				assert.Equal("10", a.RejectedQuantity)
+				assert.InDelta(0.9, a.Availability, 1e-9)
+				assert.InDelta(1.0/3, a.Performance, 1e-9)
+				assert.InDelta(0.9, a.Quality, 1e-9)
+				assert.InDelta(0.9/3*0.9, a.Oee, 1e-9)
+
+				b := data.Items[1]
+				assert.Equal(&day, b.Date)
+				assert.Equal("B", b.Shift)
+				assert.Equal(int64(11*60*60), b.PlannedSeconds)
+				assert.Equal(int64(3*60*60), b.StandardSeconds)
+				assert.Equal("45", b.GoodQuantity)
+				assert.Equal("0", b.RejectedQuantity)
+			}
+			if assert.Len(data.Summary, 1) {
+				total := data.Summary[0]
+				assert.Equal(testStationA, total.StationID)
+				assert.Nil(total.Date)
+				assert.Equal(int64(21*60*60), total.PlannedSeconds)
+				assert.Equal(int64(6*60*60), total.StandardSeconds)
+				assert.Equal("135", total.GoodQuantity)
+			}
+		}
+		assert.NoError(dm.Close())
+	}
+	{ // by day
+		dm, err := mock.New(scripts)
+		assert.NoError(err)
+		rep, ok := newProduce(dm, true).GetStationOEE(params("day"), principal).(*produce.GetStationOEEOK)
+		if assert.True(ok) && assert.Len(rep.Payload.Data.Items, 1) {
+			item := rep.Payload.Data.Items[0]
+			assert.Equal(&day, item.Date)
+			assert.Empty(item.Shift)
+			assert.Equal(rep.Payload.Data.Summary[0].PlannedSeconds, item.PlannedSeconds)
+			assert.Equal("135", item.GoodQuantity)
+		}
+		assert.NoError(dm.Close())
+	}
+	{ // bad range
+		dm, err := mock.New(nil)
+		assert.NoError(err)
+		p := params("shift")
+		p.Until = strfmt.DateTime(at(7, 8, 0))
+		assert.Equal(produce.NewGetStationOEEDefault(http.StatusBadRequest).WithPayload(&models.Error{
+			Code:    int64(mcomErrors.Code_BAD_REQUEST),
+			Details: "until must be after since and within 92 days",
+		}), newProduce(dm, true).GetStationOEE(p, principal))
+		assert.NoError(dm.Close())
+	}
+	{ // forbidden access
+		dm, err := mock.New(nil)
+		assert.NoError(err)
+		assert.Equal(produce.NewGetStationOEEDefault(http.StatusForbidden),
+			newProduce(dm, false).GetStationOEE(params("shift"), principal))
+		assert.NoError(dm.Close())
+	}
+}
+
+func TestProduce_calculateOEE(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	at := func(hour, minute int) time.Time {
+		return time.Date(2024, 3, 7, hour, minute, 0, 0, time.Local)
+	}
+
+	stores := storetest.New(t)
+	// a collect of three outputs through MES, a collect of one output and a
+	// collect kept before the first sequences were recorded.
+	assert.NoError(stores.Records.CreateRecords(ctx, nil, []database.CollectRecord{
+		{WorkOrder: testWorkOrder1, Sequence: 5, FirstSequence: 5, Station: testStationA, Quantity: decimal.NewFromInt(10), CreatedAt: at(10, 0)},
+		{WorkOrder: testWorkOrder1, Sequence: 6, FirstSequence: 5, Station: testStationA, Quantity: decimal.NewFromInt(10), CreatedAt: at(10, 0)},
+		{WorkOrder: testWorkOrder1, Sequence: 7, FirstSequence: 5, Station: testStationA, Quantity: decimal.NewFromInt(10), CreatedAt: at(10, 0)},
+		{WorkOrder: testWorkOrder1, Sequence: 8, FirstSequence: 8, Station: testStationA, Quantity: decimal.NewFromInt(10), CreatedAt: at(11, 0)},
+		{WorkOrder: testWorkOrder1, Sequence: 9, Station: testStationA, Quantity: decimal.NewFromInt(5), CreatedAt: at(12, 0)},
+	}))
+	assert.NoError(stores.StationLogs.SignInStation(ctx, database.StationSignIn{Station: testStationA, SignedInAt: at(9, 0)}))
+
+	cycleTime := decimal.NewFromInt(30 * 60)
+	dm, err := mock.New([]mock.Script{
+		{
+			Name:  mock.FuncGetWorkOrder,
+			Input: mock.Input{Request: mcom.GetWorkOrderRequest{ID: testWorkOrder1}},
+			Output: mock.Output{Response: mcom.GetWorkOrderReply{
+				ID:       testWorkOrder1,
+				RecipeID: "RECIPE",
+				Process:  mcom.WorkOrderProcess{Name: "PROCESS", Type: "TYPE"},
+			}},
+		},
+		{
+			Name: mock.FuncGetProcessDefinition,
+			Input: mock.Input{Request: mcom.GetProcessDefinitionRequest{
+				RecipeID:    "RECIPE",
+				ProcessName: "PROCESS",
+				ProcessType: "TYPE",
+			}},
+			Output: mock.Output{Response: mcom.GetProcessDefinitionReply{
+				ProcessDefinition: mcom.ProcessDefinition{
+					Configs: []*mcom.RecipeProcessConfig{{
+						Stations: []string{testStationA},
+						CommonControls: []*mcom.RecipeProperty{
+							{Name: "CT", Param: &mcom.RecipePropertyParameter{Mid: &cycleTime}},
+						},
+					}},
+				},
+			}},
+		},
+	})
+	assert.NoError(err)
+	defer dm.Close()
+	p := Produce{dm: dm, config: Config{
+		Records:          stores.Records,
+		Defects:          stores.Defects,
+		StationLogs:      stores.StationLogs,
+		CycleTimeControl: "CT",
+	}}
+
+	report, err := p.calculateOEE(ctx, testStationA, at(8, 0), at(13, 0))
+	assert.NoError(err)
+	if assert.Len(report.stations, 1) {
+		var standard time.Duration
+		for _, m := range report.stations[0].metrics {
+			standard += m.Standard
+		}
+		// the outputs of the MES collect are one cycle.
+		assert.Equal(3*30*time.Minute, standard)
+	}
+}
@@ -0,0 +1,163 @@
+package produce
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-openapi/runtime/middleware"
+	"github.com/go-openapi/strfmt"
+
+	commonsCtx "gitlab.kenda.com.tw/kenda/commons/v2/utils/context"
+
+	"gitlab.kenda.com.tw/kenda/mui/server/database"
+	"gitlab.kenda.com.tw/kenda/mui/server/impl/utils"
+	"gitlab.kenda.com.tw/kenda/mui/server/protobuf/kenda"
+	"gitlab.kenda.com.tw/kenda/mui/server/swagger/models"
+	"gitlab.kenda.com.tw/kenda/mui/server/swagger/restapi/operations/produce"
+)
+
+// ListFeedRecords implements.
+func (p Produce) ListFeedRecords(params produce.ListFeedRecordsParams, principal *models.Principal) middleware.Responder {
+	if !p.hasPermission(kenda.FunctionOperationID_LIST_FEED_RECORDS, principal.Roles) {
+		return produce.NewListFeedRecordsDefault(http.StatusForbidden)
+	}
+	ctx := commonsCtx.WithUserID(params.HTTPRequest.Context(), principal.ID)
+
+	records, totals, err := p.config.Records.ListFeedRecords(ctx,
+		parseRecordFilter(params.WorkOrderID, params.Batch, params.StationID, params.Operator, params.ProductID, params.Since, params.Until),
+		parsePagination(params.Page, params.Limit))
+	if err != nil {
+		return utils.ParseError(ctx, produce.NewListFeedRecordsDefault(0), err)
+	}
+
+	items := make([]*models.FeedRecord, len(records))
+	for i, record := range records {
+		items[i] = &models.FeedRecord{
+			WorkOrderID: record.WorkOrder,
+			Batch:       int64(record.Batch),
+			StationID:   record.Station,
+			ProductID:   record.ProductID,
+			SiteName:    record.SiteName,
+			SiteIndex:   int64(record.SiteIndex),
+			ResourceID:  record.ResourceID,
+			Operator:    record.CreatedBy,
+			CreatedAt:   strfmt.DateTime(record.CreatedAt),
+		}
+		if record.Quantity.Valid {
+			items[i].Quantity = record.Quantity.Decimal.String()
+			items[i].Returned = record.Returned.String()
+		}
+	}
+	return produce.NewListFeedRecordsOK().WithPayload(&produce.ListFeedRecordsOKBody{
+		Data: &produce.ListFeedRecordsOKBodyData{
+			Items:         items,
+			Total:         totals.Count,
+			TotalQuantity: totals.Quantity.String(),
+		},
+	})
+}
+
+// ListCollectRecords implements.
+func (p Produce) ListCollectRecords(params produce.ListCollectRecordsParams, principal *models.Principal) middleware.Responder {
+	if !p.hasPermission(kenda.FunctionOperationID_LIST_COLLECT_RECORDS, principal.Roles) {
+		return produce.NewListCollectRecordsDefault(http.StatusForbidden)
+	}
+	ctx := commonsCtx.WithUserID(params.HTTPRequest.Context(), principal.ID)
+
+	records, totals, err := p.config.Records.ListCollectRecords(ctx,
+		parseRecordFilter(params.WorkOrderID, params.Batch, params.StationID, params.Operator, params.ProductID, params.Since, params.Until),
+		parsePagination(params.Page, params.Limit))
+	if err != nil {
+		return utils.ParseError(ctx, produce.NewListCollectRecordsDefault(0), err)
+	}
+
+	items := make([]*models.CollectRecord, len(records))
+	for i, record := range records {
+		items[i] = &models.CollectRecord{
+			WorkOrderID: record.WorkOrder,
+			Sequence:    int64(record.Sequence),
+			StationID:   record.Station,
+			ProductID:   record.ProductID,
+			LotNumber:   record.LotNumber,
+			ResourceID:  record.ResourceID,
+			Quantity:    record.Quantity.String(),
+			Reversed:    record.Reversed,
+			Operator:    record.CreatedBy,
+			CreatedAt:   strfmt.DateTime(record.CreatedAt),
+		}
+		if record.Batch != nil {
+			batch := int64(*record.Batch)
+			items[i].Batch = &batch
+		}
+	}
+	return produce.NewListCollectRecordsOK().WithPayload(&produce.ListCollectRecordsOKBody{
+		Data: &produce.ListCollectRecordsOKBodyData{
+			Items:         items,
+			Total:         totals.Count,
+			TotalQuantity: totals.Quantity.String(),
+		},
+	})
+}
+
+func parseRecordFilter(workOrder *string, batch *int64, station, operator, product *string, since, until *strfmt.DateTime) database.RecordFilter {
+	var filter database.RecordFilter
+	if workOrder != nil {
+		filter.WorkOrder = *workOrder
+	}
+	if batch != nil {
+		b := int16(*batch)
+		filter.Batch = &b
+	}
+	if station != nil {
+		filter.Station = *station
+	}
+	if operator != nil {
+		filter.Operator = *operator
+	}
+	if product != nil {
+		filter.ProductID = *product
+	}
+	if since != nil {
+		filter.Since = time.Time(*since)
+	}
+	if until != nil {
+		filter.Until = time.Time(*until)
+	}
+	return filter
+}
+
+func parsePagination(page, limit *int64) database.Pagination {
+	var pagination database.Pagination
+	if page != nil {
+		pagination.Page = int(*page)
+	}
+	if limit != nil {
+		pagination.Limit = int(*limit)
+	}
+	return pagination
+}
+
+// recordProduction keeps the feed and the collect records for the queries,
+// and also the collects created by MES if any.
+func (p Produce) recordProduction(ctx context.Context, feeds []database.FeedRecord, collects []database.CollectRecord, mesCollects ...database.MesCollect) error {
+	// the collects of MES are kept first, by which they are not reversed.
+	for _, collect := range mesCollects {
+		if err := p.config.Collects.CreateMesCollect(ctx, collect); err != nil {
+			return fmt.Errorf("failed to keep the collect %s-%d of MES: %v", collect.WorkOrder, collect.Sequence, err)
+		}
+	}
+	if err := p.config.Records.CreateRecords(ctx, feeds, collects); err != nil {
+		return fmt.Errorf("failed to record the production: %v", err)
+	}
+	return nil
+}
+
+// recordingError reports the failure of recordProduction in the response of
+// an operation done by MES, which can not be undone.
+func recordingError(err error) *models.MesResponseErrorItems0 {
+	return &models.MesResponseErrorItems0{
+		Details: err.Error(),
+	}
+}
@@ -0,0 +1,262 @@
+package produce
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-openapi/strfmt"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+
+	"gitlab.kenda.com.tw/kenda/mcom/mock"
+
+	"gitlab.kenda.com.tw/kenda/mui/server/database"
+	"gitlab.kenda.com.tw/kenda/mui/server/database/storetest"
+	"gitlab.kenda.com.tw/kenda/mui/server/protobuf/kenda"
+	"gitlab.kenda.com.tw/kenda/mui/server/swagger/models"
+	"gitlab.kenda.com.tw/kenda/mui/server/swagger/restapi/operations/produce"
+)
+
+func TestProduce_ListFeedRecords(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	createdAt := time.Date(2024, 3, 7, 8, 0, 0, 0, time.UTC)
+	since := strfmt.DateTime(createdAt.Add(-time.Hour))
+	batch, page, limit := int64(2), int64(1), int64(2)
+	operator := userID
+
+	stores := storetest.New(t)
+	newFeed := func(batch int16, operator string, createdAt time.Time, quantity string) database.FeedRecord {
+		feed := database.FeedRecord{
+			WorkOrder: testWorkOrder1,
+			Batch:     batch,
+			Station:   testStationA,
+			ProductID: testWorkOrder1ProductA,
+			CreatedBy: operator,
+			CreatedAt: createdAt,
+		}
+		if quantity != "" {
+			feed.Quantity = decimal.NewNullDecimal(decimal.RequireFromString(quantity))
+		}
+		return feed
+	}
+	byResource := newFeed(2, userID, createdAt, "")
+	byResource.ResourceID = testResourceID
+	bySite := newFeed(2, userID, createdAt, "12.5")
+	bySite.FeedRecordID, bySite.SiteName, bySite.SiteIndex = "FEEDRECORDID", testSiteName1, 1
+	bySite.SiteResources = []string{"SITERESOURCEID"}
+	assert.NoError(stores.Records.CreateRecords(ctx, []database.FeedRecord{
+		// on the next page.
+		newFeed(2, userID, createdAt.Add(-30*time.Minute), "10"),
+		byResource,
+		bySite,
+		// filtered out.
+		newFeed(1, userID, createdAt, "7"),
+		newFeed(2, "other", createdAt, "7"),
+		newFeed(2, userID, createdAt.Add(-2*time.Hour), "7"),
+	}, nil))
+	assert.NoError(stores.Feeds.CreateUnfeedRecord(ctx, database.UnfeedRecord{
+		WorkOrder:    testWorkOrder1,
+		Batch:        2,
+		FeedRecordID: "FEEDRECORDID",
+		ResourceID:   "SITERESOURCEID",
+		Quantity:     decimal.RequireFromString("2"),
+		CreatedBy:    userID,
+	}))
+
+	dm, err := mock.New(nil)
+	assert.NoError(err)
+	defer dm.Close()
+	allow := func(id kenda.FunctionOperationID, roles []models.Role) bool {
+		return true
+	}
+	s := NewProduce(dm, allow, Config{Records: stores.Records})
+	params := produce.ListFeedRecordsParams{
+		HTTPRequest: httptest.NewRequest("GET", "/production-flow/records/feed", nil),
+		Batch:       &batch,
+		Operator:    &operator,
+		Since:       &since,
+		Page:        &page,
+		Limit:       &limit,
+	}
+
+	// the latest first.
+	assert.Equal(produce.NewListFeedRecordsOK().WithPayload(&produce.ListFeedRecordsOKBody{
+		Data: &produce.ListFeedRecordsOKBodyData{
+			Items: []*models.FeedRecord{
+				{
+					WorkOrderID: testWorkOrder1,
+					Batch:       2,
+					StationID:   testStationA,
+					ProductID:   testWorkOrder1ProductA,
+					SiteName:    testSiteName1,
+					SiteIndex:   1,
+					Quantity:    "12.5",
+					Returned:    "2",
+					Operator:    userID,
+					CreatedAt:   strfmt.DateTime(createdAt),
+				},
+				{
+					WorkOrderID: testWorkOrder1,
+					Batch:       2,
+					StationID:   testStationA,
+					ProductID:   testWorkOrder1ProductA,
+					ResourceID:  testResourceID,
+					Operator:    userID,
+					CreatedAt:   strfmt.DateTime(createdAt),
+				},
+			},
+			Total:         3,
+			TotalQuantity: "20.5",
+		},
+	}), s.ListFeedRecords(params, principal))
+
+	{ // forbidden access
+		s := NewProduce(dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
+			return false
+		}, Config{Records: stores.Records})
+		assert.Equal(produce.NewListFeedRecordsDefault(http.StatusForbidden), s.ListFeedRecords(params, principal))
+	}
+
+	stores.Close(t)
+	assert.Equal(produce.NewListFeedRecordsDefault(http.StatusInternalServerError).WithPayload(&models.Error{
+		Details: "sql: database is closed",
+	}), s.ListFeedRecords(params, principal))
+}
+
+func TestProduce_ListCollectRecords(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	createdAt := time.Date(2024, 3, 7, 8, 0, 0, 0, time.UTC)
+	workOrder, product := testWorkOrder1, testWorkOrder1ProductA
+	batch := int16(2)
+
+	stores := storetest.New(t)
+	assert.NoError(stores.Records.CreateRecords(ctx, nil, []database.CollectRecord{
+		{
+			WorkOrder:  testWorkOrder1,
+			Sequence:   int16(testSequence),
+			Batch:      &batch,
+			Station:    testStationA,
+			ProductID:  testWorkOrder1ProductA,
+			LotNumber:  "A1-0307",
+			ResourceID: testResourceID,
+			Quantity:   decimal.RequireFromString("30"),
+			CreatedBy:  userID,
+			CreatedAt:  createdAt,
+		},
+		{
+			WorkOrder:  testWorkOrder1,
+			Sequence:   int16(testSequence + 1),
+			Station:    testStationA,
+			ProductID:  testWorkOrder1ProductA,
+			ResourceID: "TESTRESOURCEID2",
+			Quantity:   decimal.RequireFromString("40.5"),
+			CreatedBy:  userID,
+			CreatedAt:  createdAt.Add(-time.Minute),
+		},
+		// filtered out.
+		{
+			WorkOrder:  testWorkOrder1,
+			Sequence:   int16(testSequence + 2),
+			Station:    testStationA,
+			ProductID:  "OTHERPRODUCT",
+			ResourceID: "TESTRESOURCEID3",
+			Quantity:   decimal.RequireFromString("10"),
+			CreatedBy:  userID,
+			CreatedAt:  createdAt,
+		},
+	}))
+	assert.NoError(stores.Collects.CreateCollectReversal(ctx, database.CollectReversal{
+		WorkOrder: testWorkOrder1,
+		Sequence:  int16(testSequence + 1),
+		Quantity:  decimal.RequireFromString("40.5"),
+		Reason:    "wrong output",
+		CreatedBy: userID,
+	}))
+
+	dm, err := mock.New(nil)
+	assert.NoError(err)
+	defer dm.Close()
+	s := NewProduce(dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
+		return true
+	}, Config{Records: stores.Records})
+	params := produce.ListCollectRecordsParams{
+		HTTPRequest: httptest.NewRequest("GET", "/production-flow/records/collect", nil),
+		WorkOrderID: &workOrder,
+		ProductID:   &product,
+	}
+
+	wantBatch := int64(2)
+	// the voided collect is not counted.
+	assert.Equal(produce.NewListCollectRecordsOK().WithPayload(&produce.ListCollectRecordsOKBody{
+		Data: &produce.ListCollectRecordsOKBodyData{
+			Items: []*models.CollectRecord{
+				{
+					WorkOrderID: testWorkOrder1,
+					Sequence:    int64(testSequence),
+					Batch:       &wantBatch,
+					StationID:   testStationA,
+					ProductID:   testWorkOrder1ProductA,
+					LotNumber:   "A1-0307",
+					ResourceID:  testResourceID,
+					Quantity:    "30",
+					Operator:    userID,
+					CreatedAt:   strfmt.DateTime(createdAt),
+				},
+				{
+					WorkOrderID: testWorkOrder1,
+					Sequence:    int64(testSequence + 1),
+					StationID:   testStationA,
+					ProductID:   testWorkOrder1ProductA,
+					ResourceID:  "TESTRESOURCEID2",
+					Quantity:    "40.5",
+					Reversed:    true,
+					Operator:    userID,
+					CreatedAt:   strfmt.DateTime(createdAt.Add(-time.Minute)),
+				},
+			},
+			Total:         2,
+			TotalQuantity: "30",
+		},
+	}), s.ListCollectRecords(params, principal))
+
+	{ // forbidden access
+		s := NewProduce(dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
+			return false
+		}, Config{Records: stores.Records})
+		assert.Equal(produce.NewListCollectRecordsDefault(http.StatusForbidden), s.ListCollectRecords(params, principal))
+	}
+}
+
+func TestProduce_recordProduction(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	collects := []database.CollectRecord{{WorkOrder: testWorkOrder1, Sequence: 1, Quantity: decimal.RequireFromString("3")}}
+	mesCollect := database.MesCollect{WorkOrder: testWorkOrder1, Sequence: 1, Station: testStationA}
+
+	{ // recorded.
+		stores := storetest.New(t)
+		p := Produce{config: Config{Records: stores.Records, Collects: stores.Collects}}
+		assert.NoError(p.recordProduction(ctx, nil, collects, mesCollect))
+		records, _, err := stores.Records.ListCollectRecords(ctx, database.RecordFilter{}, database.Pagination{})
+		assert.NoError(err)
+		if assert.Len(records, 1) {
+			assert.Equal("3", records[0].Quantity.String())
+		}
+		kept, err := stores.Collects.GetMesCollect(ctx, testWorkOrder1, 1)
+		assert.NoError(err)
+		assert.Equal(testStationA, kept.Station)
+	}
+	{ // failed, the collects of MES are kept anyway.
+		records, mesCollects := storetest.New(t), storetest.New(t)
+		records.Close(t)
+		p := Produce{config: Config{Records: records.Records, Collects: mesCollects.Collects}}
+		assert.EqualError(p.recordProduction(ctx, nil, collects, mesCollect), "failed to record the production: sql: database is closed")
+		_, err := mesCollects.Collects.GetMesCollect(ctx, testWorkOrder1, 1)
+		assert.NoError(err)
+	}
+}
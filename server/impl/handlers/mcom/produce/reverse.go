@@ -0,0 +1,243 @@
+package produce
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/go-openapi/runtime/middleware"
+	"github.com/shopspring/decimal"
+
+	commonsCtx "gitlab.kenda.com.tw/kenda/commons/v2/utils/context"
+	"gitlab.kenda.com.tw/kenda/mcom"
+	mcomErrors "gitlab.kenda.com.tw/kenda/mcom/errors"
+	utilsResources "gitlab.kenda.com.tw/kenda/mcom/utils/resources"
+
+	"gitlab.kenda.com.tw/kenda/mui/server/database"
+	handlerUtils "gitlab.kenda.com.tw/kenda/mui/server/impl/handlers/mcom/utils"
+	"gitlab.kenda.com.tw/kenda/mui/server/impl/utils"
+	"gitlab.kenda.com.tw/kenda/mui/server/impl/utils/saga"
+	"gitlab.kenda.com.tw/kenda/mui/server/protobuf/kenda"
+	"gitlab.kenda.com.tw/kenda/mui/server/swagger/models"
+	"gitlab.kenda.com.tw/kenda/mui/server/swagger/restapi/operations/produce"
+)
+
+// mesReverseCollectRequest is the request to reverse a collect in MES.
+type mesReverseCollectRequest struct {
+	WorkOrder  string `json:"workOrder"`
+	Sequence   int32  `json:"sequence"`
+	ResourceID string `json:"resourceID"`
+	// Quantity is the corrected quantity, empty if the collect is voided.
+	Quantity string `json:"quantity,omitempty"`
+	Reason   string `json:"reason"`
+}
+
+// ReverseCollect implements. The data manager keeps the collect records, so
+// a collect record is voided by its reversal record, and the resource it
+// created is deactivated and unbound from the carrier, or reduced to the
+// corrected quantity. MES is notified of the reversals of the collects
+// through MES at last, since MES can not be asked to undo a reversal.
+func (p Produce) ReverseCollect(params produce.ReverseCollectParams, principal *models.Principal) middleware.Responder {
+	if !p.hasPermission(kenda.FunctionOperationID_REVERSE_COLLECT, principal.Roles) {
+		return produce.NewReverseCollectDefault(http.StatusForbidden)
+	}
+	ctx := commonsCtx.WithUserID(params.HTTPRequest.Context(), principal.ID)
+	sequence := int16(params.Sequence)
+
+	reason := strings.TrimSpace(*params.Body.Reason)
+	if reason == "" {
+		return utils.ParseError(ctx, produce.NewReverseCollectDefault(0), mcomErrors.Error{
+			Code:    mcomErrors.Code_BAD_REQUEST,
+			Details: "missing reason",
+		})
+	}
+
+	if _, err := p.config.Collects.GetCollectReversal(ctx, params.WorkOrderID, sequence); err == nil {
+		return utils.ParseError(ctx, produce.NewReverseCollectDefault(0),
+			fmt.Errorf("collect record %s-%d has been reversed: %w", params.WorkOrderID, sequence, database.ErrRecordExisted))
+	} else if !errors.Is(err, database.ErrRecordNotFound) {
+		return utils.ParseError(ctx, produce.NewReverseCollectDefault(0), err)
+	}
+
+	mesCollect, err := p.config.Collects.GetMesCollect(ctx, params.WorkOrderID, sequence)
+	throughMES := err == nil
+	if err != nil && !errors.Is(err, database.ErrRecordNotFound) {
+		return utils.ParseError(ctx, produce.NewReverseCollectDefault(0), err)
+	}
+	if throughMES && p.config.MesPath == "" {
+		return produce.NewReverseCollectDefault(http.StatusInternalServerError).WithPayload(&models.Error{
+			Details: "no mes path",
+		})
+	}
+
+	workOrder, err := p.dm.GetWorkOrder(ctx, mcom.GetWorkOrderRequest{
+		ID: params.WorkOrderID,
+	})
+	if err != nil {
+		return utils.ParseError(ctx, produce.NewReverseCollectDefault(0), err)
+	}
+
+	record, err := p.dm.GetCollectRecord(ctx, mcom.GetCollectRecordRequest{
+		WorkOrder: params.WorkOrderID,
+		Sequence:  sequence,
+	})
+	if err != nil {
+		return utils.ParseError(ctx, produce.NewReverseCollectDefault(0), err)
+	}
+
+	resource, err := p.dm.GetMaterialResourceIdentity(ctx, mcom.GetMaterialResourceIdentityRequest{
+		ResourceID:  record.ResourceID,
+		ProductType: workOrder.Product.Type,
+	})
+	if err != nil {
+		return utils.ParseError(ctx, produce.NewReverseCollectDefault(0), err)
+	}
+	material := resource.Material
+
+	// the corrected quantity, or void the collect if it is not specified.
+	voided := true
+	status, quantity := material.Status, material.Quantity
+	adjusted := decimal.NullDecimal{}
+	if params.Body.Quantity != "" {
+		corrected, err := decimal.NewFromString(params.Body.Quantity)
+		if err != nil || corrected.IsNegative() || !corrected.LessThan(record.Quantity) {
+			return utils.ParseError(ctx, produce.NewReverseCollectDefault(0), mcomErrors.Error{
+				Code:    mcomErrors.Code_INVALID_NUMBER,
+				Details: fmt.Sprintf("invalid quantity: %s, must be less than the collected quantity %s", params.Body.Quantity, record.Quantity),
+			})
+		}
+		if !corrected.IsZero() {
+			// the resource may have been partially consumed since collected.
+			quantity = material.Quantity.Sub(record.Quantity.Sub(corrected))
+			if quantity.IsNegative() {
+				return utils.ParseError(ctx, produce.NewReverseCollectDefault(0), mcomErrors.Error{
+					Code:    mcomErrors.Code_RESOURCE_MATERIAL_SHORTAGE,
+					Details: fmt.Sprintf("resource %s has only %s left", record.ResourceID, material.Quantity),
+				})
+			}
+			voided = false
+			adjusted = decimal.NullDecimal{Decimal: corrected, Valid: true}
+		}
+	}
+	if voided {
+		status = utilsResources.MaterialStatus_UNAVAILABLE
+	}
+
+	// unbind the voided resource from its carrier and keep the others.
+	carrier := ""
+	var carrierContents, remainingContents []string
+	if voided && material.CarrierID != "" {
+		getCarrier, err := p.dm.GetCarrier(ctx, mcom.GetCarrierRequest{
+			ID: material.CarrierID,
+		})
+		if err != nil {
+			return utils.ParseError(ctx, produce.NewReverseCollectDefault(0), err)
+		}
+		for _, id := range getCarrier.Contents {
+			if id == record.ResourceID {
+				carrier = material.CarrierID
+				continue
+			}
+			remainingContents = append(remainingContents, id)
+		}
+		carrierContents = getCarrier.Contents
+	}
+
+	steps := []saga.Step{{
+		// recorded first so that only one of the concurrent reversals of the
+		// collect proceeds.
+		Name: "RECORD_REVERSAL",
+		Do: func(ctx context.Context) error {
+			return p.config.Collects.CreateCollectReversal(ctx, database.CollectReversal{
+				WorkOrder:        params.WorkOrderID,
+				Sequence:         sequence,
+				ResourceID:       record.ResourceID,
+				Carrier:          carrier,
+				Quantity:         record.Quantity,
+				AdjustedQuantity: adjusted,
+				Reason:           reason,
+				CreatedBy:        principal.ID,
+			})
+		},
+		Compensate: func(ctx context.Context) error {
+			return p.config.Collects.DeleteCollectReversal(ctx, params.WorkOrderID, sequence)
+		},
+	}}
+	if carrier != "" {
+		bindCarrier := func(contents []string) func(ctx context.Context) error {
+			return func(ctx context.Context) error {
+				if err := p.dm.UpdateCarrier(ctx, mcom.UpdateCarrierRequest{
+					ID:     carrier,
+					Action: mcom.ClearResources{},
+				}); err != nil {
+					return err
+				}
+				if len(contents) == 0 {
+					return nil
+				}
+				return p.dm.UpdateCarrier(ctx, mcom.UpdateCarrierRequest{
+					ID:     carrier,
+					Action: mcom.BindResources{ResourcesID: contents},
+				})
+			}
+		}
+		steps = append(steps, saga.Step{
+			Name:       "UNBIND_CARRIER",
+			Do:         bindCarrier(remainingContents),
+			Compensate: bindCarrier(carrierContents),
+		})
+	}
+	updateResource := func(status utilsResources.MaterialStatus, quantity decimal.Decimal, remark string) func(ctx context.Context) error {
+		return func(ctx context.Context) error {
+			return p.dm.UpdateMaterialResource(ctx, mcom.UpdateMaterialResourceRequest{
+				ResourceID:  record.ResourceID,
+				ProductType: workOrder.Product.Type,
+				Status:      status,
+				Quantity:    quantity,
+				Remark:      remark,
+			})
+		}
+	}
+	steps = append(steps, saga.Step{
+		Name:       "UPDATE_RESOURCE",
+		Do:         updateResource(status, quantity, reason),
+		Compensate: updateResource(material.Status, material.Quantity, material.Remark),
+	})
+	if throughMES {
+		// the last step since MES can not be asked to undo the reversal.
+		steps = append(steps, saga.Step{
+			Name: "NOTIFY_MES",
+			Do: func(ctx context.Context) error {
+				request := mesReverseCollectRequest{
+					WorkOrder:  params.WorkOrderID,
+					Sequence:   int32(sequence),
+					ResourceID: record.ResourceID,
+					Reason:     reason,
+				}
+				if adjusted.Valid {
+					request.Quantity = adjusted.Decimal.String()
+				}
+				return handlerUtils.SendMesNotification(request, handlerUtils.MesHeader{
+					UserID:  principal.ID,
+					Station: mesCollect.Station,
+					TrackID: handlerUtils.GetContextValue(params.HTTPRequest, "rid"),
+				}, fmt.Sprintf("%s/mes/api/v2/resource/collect/reverse", p.config.MesPath))
+			},
+		})
+	}
+	if err := saga.Run(ctx, steps...); err != nil {
+		return utils.ParseError(ctx, produce.NewReverseCollectDefault(0), handlerUtils.ParseSagaError(err))
+	}
+
+	return produce.NewReverseCollectOK().WithPayload(&produce.ReverseCollectOKBody{
+		Data: &produce.ReverseCollectOKBodyData{
+			ResourceID:      record.ResourceID,
+			Voided:          voided,
+			Quantity:        quantity.String(),
+			CarrierResource: carrier,
+			MesNotified:     throughMES,
+		},
+	})
+}
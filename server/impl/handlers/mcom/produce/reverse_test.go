@@ -0,0 +1,383 @@
+package produce
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-openapi/runtime/middleware"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+
+	"gitlab.kenda.com.tw/kenda/mcom"
+	mcomErrors "gitlab.kenda.com.tw/kenda/mcom/errors"
+	"gitlab.kenda.com.tw/kenda/mcom/mock"
+	"gitlab.kenda.com.tw/kenda/mcom/utils/resources"
+
+	"gitlab.kenda.com.tw/kenda/mui/server/database"
+	"gitlab.kenda.com.tw/kenda/mui/server/database/storetest"
+	"gitlab.kenda.com.tw/kenda/mui/server/protobuf/kenda"
+	"gitlab.kenda.com.tw/kenda/mui/server/swagger/models"
+	"gitlab.kenda.com.tw/kenda/mui/server/swagger/restapi/operations/produce"
+)
+
+func TestProduce_ReverseCollect(t *testing.T) {
+	var (
+		testCarrierID      = "CARRIERID"
+		testOtherResource  = "OTHERRESOURCEID"
+		testReason         = "wrong quantity"
+		testCollected      = decimal.RequireFromString("100")
+		testResourceRemark = "REMARK"
+	)
+	assert := assert.New(t)
+
+	var mesRequests []mesReverseCollectRequest
+	mesStatus := http.StatusOK
+	mes := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal("/mes/api/v2/resource/collect/reverse", r.URL.Path)
+		assert.Equal(testStationA, r.Header.Get("station"))
+		var request mesReverseCollectRequest
+		assert.NoError(json.NewDecoder(r.Body).Decode(&request))
+		mesRequests = append(mesRequests, request)
+		w.WriteHeader(mesStatus)
+	}))
+	defer mes.Close()
+
+	httpRequest := httptest.NewRequest("POST", "/production-flow/collect/work-order/{workOrderID}/sequence/{sequence}/reverse", nil)
+	newParams := func(quantity string) produce.ReverseCollectParams {
+		reason := testReason
+		return produce.ReverseCollectParams{
+			HTTPRequest: httpRequest,
+			WorkOrderID: testWorkOrder1,
+			Sequence:    int64(testSequence),
+			Body: produce.ReverseCollectBody{
+				Reason:   &reason,
+				Quantity: quantity,
+			},
+		}
+	}
+	lookupScripts := func(carrier string) []mock.Script {
+		return []mock.Script{
+			{
+				Name: mock.FuncGetWorkOrder,
+				Input: mock.Input{
+					Request: mcom.GetWorkOrderRequest{
+						ID: testWorkOrder1,
+					},
+				},
+				Output: mock.Output{
+					Response: mcom.GetWorkOrderReply{
+						ID: testWorkOrder1,
+						Product: mcom.Product{
+							ID:   testWorkOrder1ProductA,
+							Type: testWorkOrder1ProductType,
+						},
+					},
+				},
+			},
+			{
+				Name: mock.FuncGetCollectRecord,
+				Input: mock.Input{
+					Request: mcom.GetCollectRecordRequest{
+						WorkOrder: testWorkOrder1,
+						Sequence:  int16(testSequence),
+					},
+				},
+				Output: mock.Output{
+					Response: mcom.GetCollectRecordReply{
+						ResourceID: testResourceID,
+						ProductID:  testWorkOrder1ProductA,
+						Quantity:   testCollected,
+					},
+				},
+			},
+			{
+				Name: mock.FuncGetMaterialResourceIdentity,
+				Input: mock.Input{
+					Request: mcom.GetMaterialResourceIdentityRequest{
+						ResourceID:  testResourceID,
+						ProductType: testWorkOrder1ProductType,
+					},
+				},
+				Output: mock.Output{
+					Response: mcom.GetMaterialResourceIdentityReply{
+						Material: mcom.Material{
+							Type:       testWorkOrder1ProductType,
+							ID:         testWorkOrder1ProductA,
+							Status:     resources.MaterialStatus_AVAILABLE,
+							Quantity:   decimal.RequireFromString("80"),
+							ResourceID: testResourceID,
+							CarrierID:  carrier,
+							Remark:     testResourceRemark,
+						},
+					},
+				},
+			},
+		}
+	}
+	updateResourceScript := func(status resources.MaterialStatus, quantity string, remark string) mock.Script {
+		return mock.Script{
+			Name: mock.FuncUpdateMaterialResource,
+			Input: mock.Input{
+				Request: mcom.UpdateMaterialResourceRequest{
+					ResourceID:  testResourceID,
+					ProductType: testWorkOrder1ProductType,
+					Status:      status,
+					Quantity:    decimal.RequireFromString(quantity),
+					Remark:      remark,
+				},
+			},
+		}
+	}
+
+	tests := []struct {
+		name         string
+		params       produce.ReverseCollectParams
+		mesCollect   bool
+		reversed     bool
+		mesStatus    int
+		script       []mock.Script
+		want         middleware.Responder
+		wantReversal *database.CollectReversal
+		wantMES      []mesReverseCollectRequest
+	}{
+		{
+			name:   "void and unbind from carrier",
+			params: newParams(""),
+			script: append(lookupScripts(testCarrierID),
+				mock.Script{
+					Name: mock.FuncGetCarrier,
+					Input: mock.Input{
+						Request: mcom.GetCarrierRequest{
+							ID: testCarrierID,
+						},
+					},
+					Output: mock.Output{
+						Response: mcom.GetCarrierReply{
+							ID:       testCarrierID,
+							Contents: []string{testOtherResource, testResourceID},
+						},
+					},
+				},
+				mock.Script{
+					Name: mock.FuncUpdateCarrier,
+					Input: mock.Input{
+						Request: mcom.UpdateCarrierRequest{
+							ID:     testCarrierID,
+							Action: mcom.ClearResources{},
+						},
+					},
+				},
+				mock.Script{
+					Name: mock.FuncUpdateCarrier,
+					Input: mock.Input{
+						Request: mcom.UpdateCarrierRequest{
+							ID: testCarrierID,
+							Action: mcom.BindResources{
+								ResourcesID: []string{testOtherResource},
+							},
+						},
+					},
+				},
+				updateResourceScript(resources.MaterialStatus_UNAVAILABLE, "80", testReason),
+			),
+			want: produce.NewReverseCollectOK().WithPayload(&produce.ReverseCollectOKBody{
+				Data: &produce.ReverseCollectOKBodyData{
+					ResourceID:      testResourceID,
+					Voided:          true,
+					Quantity:        "80",
+					CarrierResource: testCarrierID,
+				},
+			}),
+			wantReversal: &database.CollectReversal{
+				WorkOrder:  testWorkOrder1,
+				Sequence:   int16(testSequence),
+				ResourceID: testResourceID,
+				Carrier:    testCarrierID,
+				Quantity:   testCollected,
+				Reason:     testReason,
+				CreatedBy:  userID,
+			},
+		},
+		{
+			name:   "adjust the quantity",
+			params: newParams("90"),
+			script: append(lookupScripts(testCarrierID),
+				updateResourceScript(resources.MaterialStatus_AVAILABLE, "70", testReason),
+			),
+			want: produce.NewReverseCollectOK().WithPayload(&produce.ReverseCollectOKBody{
+				Data: &produce.ReverseCollectOKBodyData{
+					ResourceID: testResourceID,
+					Quantity:   "70",
+				},
+			}),
+			wantReversal: &database.CollectReversal{
+				WorkOrder:        testWorkOrder1,
+				Sequence:         int16(testSequence),
+				ResourceID:       testResourceID,
+				Quantity:         testCollected,
+				AdjustedQuantity: decimal.NewNullDecimal(decimal.RequireFromString("90")),
+				Reason:           testReason,
+				CreatedBy:        userID,
+			},
+		},
+		{
+			name:   "resource not updated, reversal deleted",
+			params: newParams(""),
+			script: append(lookupScripts(""),
+				mock.Script{
+					Name: mock.FuncUpdateMaterialResource,
+					Input: mock.Input{
+						Request: mcom.UpdateMaterialResourceRequest{
+							ResourceID:  testResourceID,
+							ProductType: testWorkOrder1ProductType,
+							Status:      resources.MaterialStatus_UNAVAILABLE,
+							Quantity:    decimal.RequireFromString("80"),
+							Remark:      testReason,
+						},
+					},
+					Output: mock.Output{
+						Error: mcomErrors.Error{Code: mcomErrors.Code_RESOURCE_NOT_FOUND},
+					},
+				},
+			),
+			want: produce.NewReverseCollectDefault(http.StatusBadRequest).WithPayload(&models.Error{
+				Code: int64(mcomErrors.Code_RESOURCE_NOT_FOUND),
+				Details: fmt.Sprintf("step UPDATE_RESOURCE failed: %v; compensated: RECORD_REVERSAL", mcomErrors.Error{
+					Code: mcomErrors.Code_RESOURCE_NOT_FOUND,
+				}),
+			}),
+			wantReversal: &database.CollectReversal{},
+		},
+		{
+			name:       "adjust the collect of MES",
+			params:     newParams("90"),
+			mesCollect: true,
+			script: append(lookupScripts(testCarrierID),
+				updateResourceScript(resources.MaterialStatus_AVAILABLE, "70", testReason),
+			),
+			want: produce.NewReverseCollectOK().WithPayload(&produce.ReverseCollectOKBody{
+				Data: &produce.ReverseCollectOKBodyData{
+					ResourceID:  testResourceID,
+					Quantity:    "70",
+					MesNotified: true,
+				},
+			}),
+			wantReversal: &database.CollectReversal{
+				WorkOrder:        testWorkOrder1,
+				Sequence:         int16(testSequence),
+				ResourceID:       testResourceID,
+				Quantity:         testCollected,
+				AdjustedQuantity: decimal.NewNullDecimal(decimal.RequireFromString("90")),
+				Reason:           testReason,
+				CreatedBy:        userID,
+			},
+			wantMES: []mesReverseCollectRequest{{
+				WorkOrder:  testWorkOrder1,
+				Sequence:   int32(testSequence),
+				ResourceID: testResourceID,
+				Quantity:   "90",
+				Reason:     testReason,
+			}},
+		},
+		{
+			name:       "MES failed, resource restored and reversal deleted",
+			params:     newParams(""),
+			mesCollect: true,
+			mesStatus:  http.StatusBadRequest,
+			script: append(lookupScripts(""),
+				updateResourceScript(resources.MaterialStatus_UNAVAILABLE, "80", testReason),
+				updateResourceScript(resources.MaterialStatus_AVAILABLE, "80", testResourceRemark),
+			),
+			want: produce.NewReverseCollectDefault(http.StatusInternalServerError).WithPayload(&models.Error{
+				Details: "step NOTIFY_MES failed: mes error: status=400; compensated: UPDATE_RESOURCE, RECORD_REVERSAL",
+			}),
+			wantReversal: &database.CollectReversal{},
+			wantMES: []mesReverseCollectRequest{{
+				WorkOrder:  testWorkOrder1,
+				Sequence:   int32(testSequence),
+				ResourceID: testResourceID,
+				Reason:     testReason,
+			}},
+		},
+		{
+			name:   "quantity not less than collected",
+			params: newParams("100"),
+			script: lookupScripts(""),
+			want: produce.NewReverseCollectDefault(http.StatusBadRequest).WithPayload(&models.Error{
+				Code:    int64(mcomErrors.Code_INVALID_NUMBER),
+				Details: "invalid quantity: 100, must be less than the collected quantity 100",
+			}),
+		},
+		{
+			name:     "reversed already",
+			params:   newParams(""),
+			reversed: true,
+			want: produce.NewReverseCollectDefault(http.StatusConflict).WithPayload(&models.Error{
+				Code:    int64(mcomErrors.Code_RECORD_ALREADY_EXISTS),
+				Details: fmt.Sprintf("collect record %s-%d has been reversed: record existed", testWorkOrder1, testSequence),
+			}),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mesRequests = nil
+			mesStatus = http.StatusOK
+			if tt.mesStatus != 0 {
+				mesStatus = tt.mesStatus
+			}
+
+			store := storetest.New(t).Collects
+			if tt.mesCollect {
+				assert.NoError(store.CreateMesCollect(context.Background(), database.MesCollect{
+					WorkOrder: testWorkOrder1,
+					Sequence:  int16(testSequence),
+					Station:   testStationA,
+				}))
+			}
+			if tt.reversed {
+				assert.NoError(store.CreateCollectReversal(context.Background(), database.CollectReversal{
+					WorkOrder: testWorkOrder1,
+					Sequence:  int16(testSequence),
+				}))
+			}
+
+			dm, err := mock.New(tt.script)
+			assert.NoError(err)
+			s := NewProduce(dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
+				return true
+			}, Config{FontPath: "fake-path", MesPath: mes.URL, Collects: store})
+
+			assert.Equal(tt.want, s.ReverseCollect(tt.params, principal))
+			assert.Equal(tt.wantMES, mesRequests)
+			if tt.wantReversal != nil {
+				got, err := store.GetCollectReversal(context.Background(), testWorkOrder1, int16(testSequence))
+				if tt.wantReversal.WorkOrder == "" {
+					assert.ErrorIs(err, database.ErrRecordNotFound)
+				} else if assert.NoError(err) {
+					assert.True(tt.wantReversal.Quantity.Equal(got.Quantity), got.Quantity.String())
+					assert.Equal(tt.wantReversal.AdjustedQuantity.Valid, got.AdjustedQuantity.Valid)
+					assert.True(tt.wantReversal.AdjustedQuantity.Decimal.Equal(got.AdjustedQuantity.Decimal), got.AdjustedQuantity.Decimal.String())
+					got.ID, got.CreatedAt = 0, time.Time{}
+					got.Quantity, got.AdjustedQuantity = tt.wantReversal.Quantity, tt.wantReversal.AdjustedQuantity
+					assert.Equal(*tt.wantReversal, got)
+				}
+			}
+			assert.NoError(dm.Close())
+		})
+	}
+
+	{ // forbidden access
+		dm, err := mock.New(nil)
+		assert.NoError(err)
+		s := NewProduce(dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
+			return false
+		}, Config{Collects: storetest.New(t).Collects})
+		assert.Equal(produce.NewReverseCollectDefault(http.StatusForbidden), s.ReverseCollect(newParams(""), principal))
+		assert.NoError(dm.Close())
+	}
+}
@@ -0,0 +1,100 @@
+package produce
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/go-openapi/runtime/middleware"
+	"github.com/shopspring/decimal"
+
+	commonsCtx "gitlab.kenda.com.tw/kenda/commons/v2/utils/context"
+	mcomErrors "gitlab.kenda.com.tw/kenda/mcom/errors"
+
+	"gitlab.kenda.com.tw/kenda/mui/server/impl/utils"
+	"gitlab.kenda.com.tw/kenda/mui/server/impl/utils/scale"
+	"gitlab.kenda.com.tw/kenda/mui/server/protobuf/kenda"
+	"gitlab.kenda.com.tw/kenda/mui/server/swagger/models"
+	"gitlab.kenda.com.tw/kenda/mui/server/swagger/restapi/operations/produce"
+)
+
+// ScaleReader reads the weights from the scales of the stations.
+type ScaleReader interface {
+	// Read returns the stable weight read from the scale of the station.
+	Read(ctx context.Context, station string) (scale.Reading, error)
+}
+
+// GetScaleWeight implements.
+func (p Produce) GetScaleWeight(params produce.GetScaleWeightParams, principal *models.Principal) middleware.Responder {
+	if !p.hasPermission(kenda.FunctionOperationID_GET_SCALE_WEIGHT, principal.Roles) {
+		return produce.NewGetScaleWeightDefault(http.StatusForbidden)
+	}
+	ctx := commonsCtx.WithUserID(params.HTTPRequest.Context(), principal.ID)
+
+	reading, err := p.readWeight(ctx, params.StationID)
+	if err != nil {
+		return utils.ParseError(ctx, produce.NewGetScaleWeightDefault(0), err)
+	}
+	return produce.NewGetScaleWeightOK().WithPayload(&produce.GetScaleWeightOKBody{
+		Data: &models.ScaleWeight{
+			ScaleID: reading.Scale,
+			Weight:  reading.Weight.String(),
+			Unit:    reading.Unit,
+		},
+	})
+}
+
+// readWeight reads the stable weight from the scale of the station, the
+// problems the operators can resolve at the scale are reported as bad
+// requests.
+func (p Produce) readWeight(ctx context.Context, station string) (scale.Reading, error) {
+	if p.config.Scales == nil {
+		return scale.Reading{}, mcomErrors.Error{
+			Code:    mcomErrors.Code_BAD_REQUEST,
+			Details: fmt.Sprintf("station %s: %v", station, scale.ErrNoScale),
+		}
+	}
+	reading, err := p.config.Scales.Read(ctx, station)
+	if err != nil {
+		if errors.Is(err, scale.ErrNoScale) || errors.Is(err, scale.ErrNotStable) || errors.Is(err, scale.ErrOverload) ||
+			errors.Is(err, scale.ErrGrossWeight) {
+			return scale.Reading{}, mcomErrors.Error{
+				Code:    mcomErrors.Code_BAD_REQUEST,
+				Details: err.Error(),
+			}
+		}
+		return scale.Reading{}, err
+	}
+	return reading, nil
+}
+
+// weighCollect returns the quantity of a weighed collect read from the scale
+// of the station, in the unit of the work order.
+func (p Produce) weighCollect(ctx context.Context, station, unit string, outputs models.CollectOutputs) (decimal.Decimal, error) {
+	if len(outputs) != 0 {
+		return decimal.Decimal{}, mcomErrors.Error{
+			Code:    mcomErrors.Code_BAD_REQUEST,
+			Details: "a weighed collect can not have multiple outputs",
+		}
+	}
+	reading, err := p.readWeight(ctx, station)
+	if err != nil {
+		return decimal.Decimal{}, err
+	}
+	weight, err := scale.Convert(reading.Weight, reading.Unit, unit)
+	if err != nil {
+		return decimal.Decimal{}, mcomErrors.Error{
+			Code: mcomErrors.Code_BAD_REQUEST,
+			Details: fmt.Sprintf("scale %s weighs in %s, which can not be converted to the unit %s of the work order",
+				reading.Scale, reading.Unit, unit),
+		}
+	}
+	if !weight.IsPositive() {
+		return decimal.Decimal{}, mcomErrors.Error{
+			Code:    mcomErrors.Code_INVALID_NUMBER,
+			Details: fmt.Sprintf("invalid_number=%s", reading.Weight),
+		}
+	}
+	return weight, nil
+}
@@ -0,0 +1,168 @@
+package produce
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-openapi/runtime/middleware"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+
+	mcomErrors "gitlab.kenda.com.tw/kenda/mcom/errors"
+	"gitlab.kenda.com.tw/kenda/mcom/mock"
+
+	"gitlab.kenda.com.tw/kenda/mui/server/impl/utils/scale"
+	"gitlab.kenda.com.tw/kenda/mui/server/protobuf/kenda"
+	"gitlab.kenda.com.tw/kenda/mui/server/swagger/models"
+	"gitlab.kenda.com.tw/kenda/mui/server/swagger/restapi/operations/produce"
+)
+
+type scaleReader map[string]scale.Reading
+
+func (r scaleReader) Read(_ context.Context, station string) (scale.Reading, error) {
+	reading, ok := r[station]
+	if !ok {
+		return scale.Reading{}, fmt.Errorf("station %s: %w", station, scale.ErrNoScale)
+	}
+	if reading.Scale == "BROKEN" {
+		return scale.Reading{}, errors.New("scale BROKEN: connection refused")
+	}
+	if !reading.Stable {
+		return scale.Reading{}, fmt.Errorf("scale %s: %w", reading.Scale, scale.ErrNotStable)
+	}
+	return reading, nil
+}
+
+func TestProduce_GetScaleWeight(t *testing.T) {
+	const (
+		testStationB = "STATION-B"
+		testStationC = "STATION-C"
+	)
+	assert := assert.New(t)
+
+	scales := scaleReader{
+		testStationA: {Scale: "SCALE-1", Weight: decimal.RequireFromString("12.50"), Unit: "kg", Stable: true},
+		testStationB: {Scale: "SCALE-2", Weight: decimal.RequireFromString("3"), Unit: "kg"},
+		testStationC: {Scale: "BROKEN", Stable: true},
+	}
+	httpRequest := httptest.NewRequest("GET", "/production-flow/scale/station/{stationID}", nil)
+	newParams := func(station string) produce.GetScaleWeightParams {
+		return produce.GetScaleWeightParams{
+			HTTPRequest: httpRequest,
+			StationID:   station,
+		}
+	}
+
+	tests := []struct {
+		name    string
+		station string
+		scales  ScaleReader
+		want    middleware.Responder
+	}{
+		{
+			name:    "stable weight",
+			station: testStationA,
+			scales:  scales,
+			want: produce.NewGetScaleWeightOK().WithPayload(&produce.GetScaleWeightOKBody{
+				Data: &models.ScaleWeight{
+					ScaleID: "SCALE-1",
+					Weight:  "12.5",
+					Unit:    "kg",
+				},
+			}),
+		},
+		{
+			name:    "not stable",
+			station: testStationB,
+			scales:  scales,
+			want: produce.NewGetScaleWeightDefault(http.StatusBadRequest).WithPayload(&models.Error{
+				Code:    int64(mcomErrors.Code_BAD_REQUEST),
+				Details: "scale SCALE-2: weight not stable",
+			}),
+		},
+		{
+			name:    "no scale",
+			station: "STATION-D",
+			scales:  scales,
+			want: produce.NewGetScaleWeightDefault(http.StatusBadRequest).WithPayload(&models.Error{
+				Code:    int64(mcomErrors.Code_BAD_REQUEST),
+				Details: "station STATION-D: no scale",
+			}),
+		},
+		{
+			name:    "no scale configured",
+			station: testStationA,
+			want: produce.NewGetScaleWeightDefault(http.StatusBadRequest).WithPayload(&models.Error{
+				Code:    int64(mcomErrors.Code_BAD_REQUEST),
+				Details: "station STATION-A: no scale",
+			}),
+		},
+		{
+			name:    "connection failed",
+			station: testStationC,
+			scales:  scales,
+			want: produce.NewGetScaleWeightDefault(http.StatusInternalServerError).WithPayload(&models.Error{
+				Details: "scale BROKEN: connection refused",
+			}),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dm, err := mock.New(nil)
+			assert.NoError(err)
+			s := NewProduce(dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
+				return true
+			}, Config{Scales: tt.scales})
+			assert.Equal(tt.want, s.GetScaleWeight(newParams(tt.station), principal))
+			assert.NoError(dm.Close())
+		})
+	}
+
+	{ // forbidden access
+		dm, err := mock.New(nil)
+		assert.NoError(err)
+		s := NewProduce(dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
+			return false
+		}, Config{Scales: scales})
+		assert.Equal(produce.NewGetScaleWeightDefault(http.StatusForbidden), s.GetScaleWeight(newParams(testStationA), principal))
+		assert.NoError(dm.Close())
+	}
+}
+
+func TestProduce_weighCollect(t *testing.T) {
+	assert := assert.New(t)
+	quantity := "1"
+	p := Produce{config: Config{Scales: scaleReader{
+		testStationA: {Scale: "SCALE-1", Weight: decimal.RequireFromString("8.2"), Stable: true},
+		"GRAM":       {Scale: "SCALE-3", Weight: decimal.RequireFromString("1250"), Unit: "g", Stable: true},
+		"EMPTY":      {Scale: "SCALE-2", Weight: decimal.Zero, Stable: true},
+	}}}
+
+	got, err := p.weighCollect(context.Background(), testStationA, "KG", nil)
+	assert.NoError(err)
+	assert.Equal("8.2", got.String())
+
+	// converted to the unit of the work order
+	got, err = p.weighCollect(context.Background(), "GRAM", "KG", nil)
+	assert.NoError(err)
+	assert.Equal("1.25", got.String())
+
+	_, err = p.weighCollect(context.Background(), "GRAM", "PCS", nil)
+	assert.Equal(mcomErrors.Error{
+		Code:    mcomErrors.Code_BAD_REQUEST,
+		Details: "scale SCALE-3 weighs in g, which can not be converted to the unit PCS of the work order",
+	}, err)
+
+	_, err = p.weighCollect(context.Background(), "EMPTY", "KG", nil)
+	assert.Equal(mcomErrors.Error{Code: mcomErrors.Code_INVALID_NUMBER, Details: "invalid_number=0"}, err)
+
+	_, err = p.weighCollect(context.Background(), testStationA, "KG", models.CollectOutputs{{Quantity: &quantity}})
+	assert.Equal(mcomErrors.Error{
+		Code:    mcomErrors.Code_BAD_REQUEST,
+		Details: "a weighed collect can not have multiple outputs",
+	}, err)
+}
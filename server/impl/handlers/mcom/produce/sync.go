@@ -0,0 +1,432 @@
+package produce
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-openapi/runtime"
+	"github.com/go-openapi/runtime/middleware"
+	"github.com/go-openapi/strfmt"
+	"go.uber.org/zap"
+
+	"gitlab.kenda.com.tw/kenda/commons/v2/proto/golang/mes/v2/workorder"
+	commonsCtx "gitlab.kenda.com.tw/kenda/commons/v2/utils/context"
+	"gitlab.kenda.com.tw/kenda/mcom"
+	mcomErrors "gitlab.kenda.com.tw/kenda/mcom/errors"
+
+	"gitlab.kenda.com.tw/kenda/mui/server/database"
+	"gitlab.kenda.com.tw/kenda/mui/server/impl/utils"
+	"gitlab.kenda.com.tw/kenda/mui/server/protobuf/kenda"
+	"gitlab.kenda.com.tw/kenda/mui/server/swagger/models"
+	"gitlab.kenda.com.tw/kenda/mui/server/swagger/restapi/operations/produce"
+	"gitlab.kenda.com.tw/kenda/mui/server/swagger/restapi/operations/site"
+	"gitlab.kenda.com.tw/kenda/mui/server/swagger/restapi/operations/station"
+)
+
+// conflictCodes are the errors of the replayed operations caused by the
+// changes made since the operations were queued.
+var conflictCodes = map[int64]struct{}{
+	int64(mcomErrors.Code_RESOURCE_MATERIAL_SHORTAGE): {},
+	int64(mcomErrors.Code_RESOURCE_UNAVAILABLE):       {},
+	int64(mcomErrors.Code_BATCH_NOT_READY):            {},
+	int64(mcomErrors.Code_WORKORDER_BAD_STATUS):       {},
+	int64(mcomErrors.Code_WORKORDER_BAD_BATCH):        {},
+}
+
+// syncLease is how long an operation is claimed while it is replayed, after
+// which the operation can be replayed again if it is still pending, e.g. the
+// server stopped while replaying it. It is much longer than any replay.
+const syncLease = 10 * time.Minute
+
+// SyncOperations implements. The operations queued by an offline PDA are
+// replayed in the order of their client time through the handlers of the
+// operations. The succeeded operations are kept by their IDs, so they are not
+// replayed again if resent. The IDs of the operations are scoped by the users.
+func (p Produce) SyncOperations(params produce.SyncOperationsParams, principal *models.Principal) middleware.Responder {
+	if !p.hasPermission(kenda.FunctionOperationID_SYNC_OPERATIONS, principal.Roles) {
+		return produce.NewSyncOperationsDefault(http.StatusForbidden)
+	}
+	ctx := commonsCtx.WithUserID(params.HTTPRequest.Context(), principal.ID)
+
+	ops := make([]*models.SyncOperation, len(params.Body.Operations))
+	copy(ops, params.Body.Operations)
+	ids := make(map[string]struct{}, len(ops))
+	for _, op := range ops {
+		if _, ok := ids[*op.ID]; ok {
+			return utils.ParseError(ctx, produce.NewSyncOperationsDefault(0), mcomErrors.Error{
+				Code:    mcomErrors.Code_BAD_REQUEST,
+				Details: fmt.Sprintf("duplicated operation: %s", *op.ID),
+			})
+		}
+		ids[*op.ID] = struct{}{}
+	}
+	sort.SliceStable(ops, func(i, j int) bool {
+		return time.Time(*ops[i].ClientTime).Before(time.Time(*ops[j].ClientTime))
+	})
+
+	results := make([]*models.SyncOperationResult, len(ops))
+	stopped := false
+	for i, op := range ops {
+		if stopped {
+			results[i] = &models.SyncOperationResult{
+				ID:     *op.ID,
+				Status: models.SyncOperationStatusSKIPPED,
+			}
+			continue
+		}
+		results[i] = p.syncOperation(ctx, params.HTTPRequest, op, principal)
+		if results[i].Status != models.SyncOperationStatusSUCCEEDED && params.Body.StopOnError {
+			stopped = true
+		}
+	}
+
+	return produce.NewSyncOperationsOK().WithPayload(&produce.SyncOperationsOKBody{
+		Data: results,
+	})
+}
+
+// syncOperation replays an operation unless it has been claimed.
+func (p Produce) syncOperation(ctx context.Context, req *http.Request, op *models.SyncOperation, principal *models.Principal) *models.SyncOperationResult {
+	result := &models.SyncOperationResult{ID: *op.ID}
+
+	kept, err := p.config.Syncs.CreateSyncOperation(ctx, database.SyncOperation{
+		ID:         *op.ID,
+		Kind:       string(*op.Kind),
+		Station:    op.StationID,
+		ClientTime: time.Time(*op.ClientTime),
+		CreatedBy:  principal.ID,
+	}, syncLease)
+	if err != nil {
+		if !errors.Is(err, database.ErrRecordExisted) {
+			result.Status = models.SyncOperationStatusFAILED
+			result.Details = err.Error()
+			return result
+		}
+		result.Duplicated = true
+		if kept.Status != database.SyncStatusSucceeded {
+			result.Status = models.SyncOperationStatusPENDING
+			return result
+		}
+		result.Status = models.SyncOperationStatusSUCCEEDED
+		if kept.Data != "" {
+			if err := json.Unmarshal([]byte(kept.Data), &result.Data); err != nil {
+				zap.L().Warn("failed to decode the data of a synchronized operation",
+					zap.String("id", kept.ID), zap.Error(err))
+			}
+		}
+		return result
+	}
+
+	data := p.replaySyncOperation(ctx, req, op, principal, result)
+	if result.Status == models.SyncOperationStatusSUCCEEDED {
+		result.Data = data
+		b, err := json.Marshal(data)
+		if err == nil {
+			err = p.config.Syncs.CompleteSyncOperation(ctx, principal.ID, *op.ID, string(b))
+		}
+		if err != nil {
+			zap.L().Error("failed to complete a synchronized operation", zap.String("id", *op.ID), zap.Error(err))
+		}
+		return result
+	}
+	if err := p.config.Syncs.DeleteSyncOperation(ctx, principal.ID, *op.ID); err != nil {
+		zap.L().Error("failed to release a synchronized operation", zap.String("id", *op.ID), zap.Error(err))
+	}
+	return result
+}
+
+// validatable is a request body generated by swagger.
+type validatable interface {
+	Validate(formats strfmt.Registry) error
+}
+
+// decodeSyncPayload decodes the payload of an operation into the body of its
+// handler.
+func decodeSyncPayload(payload interface{}, body validatable) error {
+	b, err := json.Marshal(payload)
+	if err == nil {
+		err = json.Unmarshal(b, body)
+	}
+	if err == nil {
+		err = body.Validate(strfmt.Default)
+	}
+	if err != nil {
+		return mcomErrors.Error{
+			Code:    mcomErrors.Code_BAD_REQUEST,
+			Details: fmt.Sprintf("invalid payload: %v", err),
+		}
+	}
+	return nil
+}
+
+// replaySyncOperation replays the operation by its handler, sets the status
+// of the result and returns the replied data.
+func (p Produce) replaySyncOperation(
+	ctx context.Context,
+	req *http.Request,
+	op *models.SyncOperation,
+	principal *models.Principal,
+	result *models.SyncOperationResult,
+) interface{} {
+	fail := func(err error) interface{} {
+		result.Status = models.SyncOperationStatusFAILED
+		if e, ok := mcomErrors.As(err); ok {
+			result.Code = int64(e.Code)
+			result.Details = e.Details
+		} else {
+			result.Details = err.Error()
+		}
+		return nil
+	}
+	if *op.Kind != models.SyncOperationKindBIND && op.StationID == "" {
+		return fail(mcomErrors.Error{
+			Code:    mcomErrors.Code_INSUFFICIENT_REQUEST,
+			Details: "missing station",
+		})
+	}
+
+	var responder middleware.Responder
+	switch *op.Kind {
+	case models.SyncOperationKindFEED:
+		var body produce.MesFeedBody
+		if err := decodeSyncPayload(op.Payload, &body); err != nil {
+			return fail(err)
+		}
+		if body.ForceFeed == nil {
+			body.ForceFeed = &produce.MesFeedParamsBodyForceFeed{}
+		}
+		conflict, err := p.checkFeedConflict(ctx, body)
+		if err != nil {
+			return fail(err)
+		}
+		if conflict != "" {
+			result.Status = models.SyncOperationStatusCONFLICT
+			result.Details = conflict
+			return nil
+		}
+		responder = p.MesFeed(produce.MesFeedParams{
+			HTTPRequest: req,
+			StationID:   op.StationID,
+			Body:        body,
+		}, principal)
+	case models.SyncOperationKindCOLLECT:
+		var body produce.MesCollectBody
+		if err := decodeSyncPayload(op.Payload, &body); err != nil {
+			return fail(err)
+		}
+		responder = p.MesCollect(produce.MesCollectParams{
+			HTTPRequest: req,
+			StationID:   op.StationID,
+			Body:        body,
+		}, principal)
+	case models.SyncOperationKindBIND:
+		var body site.AutoBindSiteResourcesBody
+		if err := decodeSyncPayload(op.Payload, &body); err != nil {
+			return fail(err)
+		}
+		responder = p.config.BindSiteResources(site.AutoBindSiteResourcesParams{
+			HTTPRequest: req,
+			Body:        body,
+		}, principal)
+	case models.SyncOperationKindSIGNIN:
+		var body station.StationForceSignInBody
+		if err := decodeSyncPayload(op.Payload, &body); err != nil {
+			return fail(err)
+		}
+		// the forced sign-in would sign out the user who signed in since.
+		conflict, err := p.checkSignInConflict(ctx, op.StationID, body.SiteName, principal.ID)
+		if err != nil {
+			return fail(err)
+		}
+		if conflict != "" {
+			result.Status = models.SyncOperationStatusCONFLICT
+			result.Details = conflict
+			return nil
+		}
+		responder = p.config.SignInStation(station.StationForceSignInParams{
+			HTTPRequest: req,
+			StationID:   op.StationID,
+			Body:        body,
+		}, principal)
+	default:
+		return fail(mcomErrors.Error{
+			Code:    mcomErrors.Code_BAD_REQUEST,
+			Details: fmt.Sprintf("unknown operation kind: %s", *op.Kind),
+		})
+	}
+	return parseSyncResponse(*op.Kind, responder, result)
+}
+
+// checkFeedConflict returns why the feed can not be done anymore, e.g. the
+// batch has been closed or a resource has been used up, or empty if none.
+func (p Produce) checkFeedConflict(ctx context.Context, body produce.MesFeedBody) (string, error) {
+	batch, err := p.dm.GetBatch(ctx, mcom.GetBatchRequest{
+		WorkOrder: *body.WorkOrderID,
+		Number:    int16(*body.Batch),
+	})
+	if err != nil {
+		if e, ok := mcomErrors.As(err); !ok || e.Code != mcomErrors.Code_BATCH_NOT_FOUND {
+			return "", err
+		}
+	} else if batch.Info.Status != int32(workorder.BatchStatus_BATCH_PREPARING) &&
+		batch.Info.Status != int32(workorder.BatchStatus_BATCH_STARTED) {
+		return fmt.Sprintf("batch closed: status=%s", workorder.BatchStatus(batch.Info.Status)), nil
+	}
+
+	for _, resource := range body.Resource {
+		if resource == nil || resource.ID == "" {
+			continue
+		}
+		materials, err := p.dm.GetMaterialResource(ctx, mcom.GetMaterialResourceRequest{
+			ResourceID: resource.ID,
+		})
+		if err != nil {
+			return "", err
+		}
+		consumed := len(materials) > 0
+		for _, material := range materials {
+			if material.Material.Quantity.IsPositive() {
+				consumed = false
+			}
+		}
+		if consumed {
+			return fmt.Sprintf("resource consumed: %s", resource.ID), nil
+		}
+	}
+	return "", nil
+}
+
+// checkSignInConflict returns who else is signed in the site, all the sites
+// if siteName is empty, or empty if none.
+func (p Produce) checkSignInConflict(ctx context.Context, stationID, siteName, user string) (string, error) {
+	now := time.Now()
+	signIns, err := p.config.StationLogs.ListStationSignIns(ctx, stationID, now, now)
+	if err != nil {
+		return "", err
+	}
+	for _, signIn := range signIns {
+		if signIn.SignedOutAt != nil || signIn.CreatedBy == user {
+			continue
+		}
+		if siteName == "" || signIn.SiteName == "" || signIn.SiteName == siteName {
+			return fmt.Sprintf("station signed in by another user: %s", signIn.CreatedBy), nil
+		}
+	}
+	return "", nil
+}
+
+// responseRecorder keeps the response written by a responder.
+type responseRecorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (r *responseRecorder) Header() http.Header {
+	return r.header
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	return r.body.Write(b)
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	r.status = status
+}
+
+// parseSyncResponse sets the status of the result by the response of the
+// replayed handler and returns the replied data.
+func parseSyncResponse(kind models.SyncOperationKind, responder middleware.Responder, result *models.SyncOperationResult) interface{} {
+	rec := &responseRecorder{header: http.Header{}, status: http.StatusOK}
+	responder.WriteResponse(rec, runtime.JSONProducer())
+
+	if rec.status != http.StatusOK {
+		var payload models.Error
+		if rec.body.Len() > 0 {
+			_ = json.Unmarshal(rec.body.Bytes(), &payload)
+		}
+		result.Code = payload.Code
+		result.Details = payload.Details
+		if result.Details == "" {
+			result.Details = http.StatusText(rec.status)
+		}
+		result.Status = models.SyncOperationStatusFAILED
+		if _, ok := conflictCodes[payload.Code]; ok || rec.status == http.StatusConflict {
+			result.Status = models.SyncOperationStatusCONFLICT
+		}
+		return nil
+	}
+
+	var reply struct {
+		Data json.RawMessage `json:"data"`
+	}
+	if rec.body.Len() > 0 {
+		if err := json.Unmarshal(rec.body.Bytes(), &reply); err != nil {
+			result.Status = models.SyncOperationStatusFAILED
+			result.Details = err.Error()
+			return nil
+		}
+	}
+	if len(reply.Data) == 0 {
+		result.Status = models.SyncOperationStatusSUCCEEDED
+		return nil
+	}
+
+	// the rejections of MES are replied with OK.
+	var mes *models.MesResponse
+	switch kind {
+	case models.SyncOperationKindFEED:
+		mes = &models.MesResponse{}
+		if err := json.Unmarshal(reply.Data, mes); err != nil {
+			mes = nil
+		}
+	case models.SyncOperationKindCOLLECT:
+		var collect struct {
+			MesResponse *models.MesResponse `json:"mesResponse"`
+		}
+		if err := json.Unmarshal(reply.Data, &collect); err == nil {
+			mes = collect.MesResponse
+		}
+	}
+	if mes != nil && !mes.Success {
+		parseMesRejection(mes, result)
+		return nil
+	}
+
+	var data interface{}
+	if err := json.Unmarshal(reply.Data, &data); err != nil {
+		result.Status = models.SyncOperationStatusFAILED
+		result.Details = err.Error()
+		return nil
+	}
+	result.Status = models.SyncOperationStatusSUCCEEDED
+	return data
+}
+
+func parseMesRejection(response *models.MesResponse, result *models.SyncOperationResult) {
+	result.Status = models.SyncOperationStatusFAILED
+	details := make([]string, 0, len(response.Error))
+	for _, e := range response.Error {
+		if e == nil {
+			continue
+		}
+		if result.Code == 0 {
+			result.Code = e.Code
+		}
+		if _, ok := conflictCodes[e.Code]; ok {
+			result.Status = models.SyncOperationStatusCONFLICT
+		}
+		details = append(details, e.Details)
+	}
+	result.Details = "rejected by MES"
+	if len(details) > 0 {
+		result.Details += ": " + strings.Join(details, "; ")
+	}
+}
@@ -0,0 +1,365 @@
+package produce
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-openapi/runtime/middleware"
+	"github.com/go-openapi/strfmt"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+
+	"gitlab.kenda.com.tw/kenda/commons/v2/proto/golang/mes/v2/workorder"
+	"gitlab.kenda.com.tw/kenda/mcom"
+	mcomErrors "gitlab.kenda.com.tw/kenda/mcom/errors"
+	"gitlab.kenda.com.tw/kenda/mcom/mock"
+
+	"gitlab.kenda.com.tw/kenda/mui/server/database"
+	"gitlab.kenda.com.tw/kenda/mui/server/database/storetest"
+	"gitlab.kenda.com.tw/kenda/mui/server/protobuf/kenda"
+	"gitlab.kenda.com.tw/kenda/mui/server/swagger/models"
+	"gitlab.kenda.com.tw/kenda/mui/server/swagger/restapi/operations/produce"
+	"gitlab.kenda.com.tw/kenda/mui/server/swagger/restapi/operations/site"
+	"gitlab.kenda.com.tw/kenda/mui/server/swagger/restapi/operations/station"
+)
+
+// keepSyncOperations claims the operations until they expire, and completes
+// the succeeded ones.
+func keepSyncOperations(t *testing.T, store database.SyncStore, ops ...database.SyncOperation) {
+	ctx := context.Background()
+	for _, op := range ops {
+		if _, err := store.CreateSyncOperation(ctx, op, time.Until(op.ExpiresAt)); err != nil {
+			t.Fatal(err)
+		}
+		if op.Status == database.SyncStatusSucceeded {
+			if err := store.CompleteSyncOperation(ctx, op.CreatedBy, op.ID, op.Data); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+}
+
+func TestProduce_SyncOperations(t *testing.T) {
+	var (
+		testClientTime = time.Date(2024, 3, 7, 8, 0, 0, 0, time.Local)
+		testBatch      = 1
+	)
+	assert := assert.New(t)
+
+	httpRequest := httptest.NewRequest("POST", "/production-flow/sync", nil)
+	newOperation := func(id string, kind models.SyncOperationKind, stationID string, minutes int, payload interface{}) *models.SyncOperation {
+		clientTime := strfmt.DateTime(testClientTime.Add(time.Duration(minutes) * time.Minute))
+		return &models.SyncOperation{
+			ID:         &id,
+			Kind:       &kind,
+			StationID:  stationID,
+			ClientTime: &clientTime,
+			Payload:    payload,
+		}
+	}
+	newParams := func(stopOnError bool, ops ...*models.SyncOperation) produce.SyncOperationsParams {
+		return produce.SyncOperationsParams{
+			HTTPRequest: httpRequest,
+			Body: produce.SyncOperationsBody{
+				Operations:  ops,
+				StopOnError: stopOnError,
+			},
+		}
+	}
+	feedPayload := map[string]interface{}{
+		"workOrderID": testWorkOrder1,
+		"batch":       testBatch,
+		"resource": []map[string]interface{}{
+			{"ID": testResourceID},
+		},
+	}
+	signInPayload := map[string]interface{}{
+		"siteName": testSiteName1,
+		"group":    1,
+		"workDate": "2024-03-07",
+	}
+	bindPayload := map[string]interface{}{
+		"workOrderID": testWorkOrder1,
+		"station":     testStationA,
+		"siteName":    testSiteName1,
+	}
+	getBatchScript := func(status workorder.BatchStatus) mock.Script {
+		return mock.Script{
+			Name: mock.FuncGetBatch,
+			Input: mock.Input{
+				Request: mcom.GetBatchRequest{
+					WorkOrder: testWorkOrder1,
+					Number:    int16(testBatch),
+				},
+			},
+			Output: mock.Output{
+				Response: mcom.GetBatchReply{
+					Info: mcom.BatchInfo{
+						WorkOrder: testWorkOrder1,
+						Number:    int16(testBatch),
+						Status:    int32(status),
+					},
+				},
+			},
+		}
+	}
+
+	tests := []struct {
+		name    string
+		params  produce.SyncOperationsParams
+		kept    []database.SyncOperation
+		signIns []database.StationSignIn
+		script  []mock.Script
+		bind    middleware.Responder
+		signIn  middleware.Responder
+		want    middleware.Responder
+		wantOps map[string]database.SyncStatus
+	}{
+		{
+			name: "replay in the order of client time",
+			params: newParams(false,
+				newOperation("OP-2", models.SyncOperationKindBIND, "", 2, bindPayload),
+				newOperation("OP-1", models.SyncOperationKindSIGNIN, testStationA, 1, signInPayload),
+			),
+			bind:   site.NewAutoBindSiteResourcesOK(),
+			signIn: station.NewStationForceSignInOK(),
+			want: produce.NewSyncOperationsOK().WithPayload(&produce.SyncOperationsOKBody{
+				Data: []*models.SyncOperationResult{
+					{ID: "OP-1", Status: models.SyncOperationStatusSUCCEEDED},
+					{ID: "OP-2", Status: models.SyncOperationStatusSUCCEEDED},
+				},
+			}),
+			wantOps: map[string]database.SyncStatus{
+				"tester/OP-1": database.SyncStatusSucceeded,
+				"tester/OP-2": database.SyncStatusSucceeded,
+			},
+		},
+		{
+			name: "resent operation",
+			params: newParams(false,
+				newOperation("OP-1", models.SyncOperationKindSIGNIN, testStationA, 1, signInPayload),
+				newOperation("OP-2", models.SyncOperationKindBIND, "", 2, bindPayload),
+				newOperation("OP-3", models.SyncOperationKindBIND, "", 3, bindPayload),
+			),
+			bind: site.NewAutoBindSiteResourcesOK(),
+			kept: []database.SyncOperation{
+				{ID: "OP-1", CreatedBy: userID, Status: database.SyncStatusSucceeded, Data: `{"station":"STATION-A"}`},
+				{ID: "OP-2", CreatedBy: userID, Status: database.SyncStatusPending, ExpiresAt: time.Now().Add(time.Hour)},
+				// the operations of the other users are not the same ones.
+				{ID: "OP-3", CreatedBy: "other", Status: database.SyncStatusSucceeded},
+			},
+			want: produce.NewSyncOperationsOK().WithPayload(&produce.SyncOperationsOKBody{
+				Data: []*models.SyncOperationResult{
+					{
+						ID:         "OP-1",
+						Status:     models.SyncOperationStatusSUCCEEDED,
+						Duplicated: true,
+						Data:       map[string]interface{}{"station": "STATION-A"},
+					},
+					{ID: "OP-2", Status: models.SyncOperationStatusPENDING, Duplicated: true},
+					{ID: "OP-3", Status: models.SyncOperationStatusSUCCEEDED},
+				},
+			}),
+			wantOps: map[string]database.SyncStatus{
+				"tester/OP-1": database.SyncStatusSucceeded,
+				"tester/OP-2": database.SyncStatusPending,
+				"tester/OP-3": database.SyncStatusSucceeded,
+				"other/OP-3":  database.SyncStatusSucceeded,
+			},
+		},
+		{
+			name: "expired claim replayed again",
+			params: newParams(false,
+				newOperation("OP-1", models.SyncOperationKindBIND, "", 1, bindPayload),
+			),
+			kept: []database.SyncOperation{
+				{ID: "OP-1", CreatedBy: userID, Status: database.SyncStatusPending, ExpiresAt: time.Now().Add(-time.Second)},
+			},
+			bind: site.NewAutoBindSiteResourcesOK(),
+			want: produce.NewSyncOperationsOK().WithPayload(&produce.SyncOperationsOKBody{
+				Data: []*models.SyncOperationResult{
+					{ID: "OP-1", Status: models.SyncOperationStatusSUCCEEDED},
+				},
+			}),
+			wantOps: map[string]database.SyncStatus{
+				"tester/OP-1": database.SyncStatusSucceeded,
+			},
+		},
+		{
+			name: "station signed in by another user",
+			params: newParams(false,
+				newOperation("OP-1", models.SyncOperationKindSIGNIN, testStationA, 1, signInPayload),
+			),
+			signIns: []database.StationSignIn{
+				{Station: testStationA, SiteName: testSiteName1, CreatedBy: "other", SignedInAt: time.Now().Add(-time.Minute)},
+			},
+			want: produce.NewSyncOperationsOK().WithPayload(&produce.SyncOperationsOKBody{
+				Data: []*models.SyncOperationResult{
+					{
+						ID:      "OP-1",
+						Status:  models.SyncOperationStatusCONFLICT,
+						Details: "station signed in by another user: other",
+					},
+				},
+			}),
+			wantOps: map[string]database.SyncStatus{},
+		},
+		{
+			name: "batch closed",
+			params: newParams(false,
+				newOperation("OP-1", models.SyncOperationKindFEED, testStationA, 1, feedPayload),
+			),
+			script: []mock.Script{getBatchScript(workorder.BatchStatus_BATCH_CLOSED)},
+			want: produce.NewSyncOperationsOK().WithPayload(&produce.SyncOperationsOKBody{
+				Data: []*models.SyncOperationResult{
+					{
+						ID:      "OP-1",
+						Status:  models.SyncOperationStatusCONFLICT,
+						Details: "batch closed: status=BATCH_CLOSED",
+					},
+				},
+			}),
+			wantOps: map[string]database.SyncStatus{},
+		},
+		{
+			name: "resource consumed and stop on error",
+			params: newParams(true,
+				newOperation("OP-1", models.SyncOperationKindFEED, testStationA, 1, feedPayload),
+				newOperation("OP-2", models.SyncOperationKindSIGNIN, testStationA, 2, signInPayload),
+			),
+			script: []mock.Script{
+				getBatchScript(workorder.BatchStatus_BATCH_STARTED),
+				{
+					Name: mock.FuncGetMaterialResource,
+					Input: mock.Input{
+						Request: mcom.GetMaterialResourceRequest{
+							ResourceID: testResourceID,
+						},
+					},
+					Output: mock.Output{
+						Response: mcom.GetMaterialResourceReply{
+							{
+								Material: mcom.Material{
+									ResourceID: testResourceID,
+									Quantity:   decimal.Zero,
+								},
+							},
+						},
+					},
+				},
+			},
+			want: produce.NewSyncOperationsOK().WithPayload(&produce.SyncOperationsOKBody{
+				Data: []*models.SyncOperationResult{
+					{
+						ID:      "OP-1",
+						Status:  models.SyncOperationStatusCONFLICT,
+						Details: "resource consumed: " + testResourceID,
+					},
+					{ID: "OP-2", Status: models.SyncOperationStatusSKIPPED},
+				},
+			}),
+			wantOps: map[string]database.SyncStatus{},
+		},
+		{
+			name: "failed and conflicted operations",
+			params: newParams(false,
+				newOperation("OP-1", models.SyncOperationKindCOLLECT, testStationA, 1, map[string]interface{}{
+					"workOrderID": testWorkOrder1,
+					"sequence":    testSequence,
+				}),
+				newOperation("OP-2", models.SyncOperationKindBIND, "", 2, bindPayload),
+				newOperation("OP-3", models.SyncOperationKindSIGNIN, "", 3, signInPayload),
+			),
+			bind: site.NewAutoBindSiteResourcesDefault(http.StatusConflict).WithPayload(&models.Error{
+				Code:    int64(mcomErrors.Code_RECORD_ALREADY_EXISTS),
+				Details: "record existed",
+			}),
+			want: produce.NewSyncOperationsOK().WithPayload(&produce.SyncOperationsOKBody{
+				Data: []*models.SyncOperationResult{
+					{
+						ID:      "OP-1",
+						Status:  models.SyncOperationStatusFAILED,
+						Details: "no mes path",
+					},
+					{
+						ID:      "OP-2",
+						Status:  models.SyncOperationStatusCONFLICT,
+						Code:    int64(mcomErrors.Code_RECORD_ALREADY_EXISTS),
+						Details: "record existed",
+					},
+					{
+						ID:      "OP-3",
+						Status:  models.SyncOperationStatusFAILED,
+						Code:    int64(mcomErrors.Code_INSUFFICIENT_REQUEST),
+						Details: "missing station",
+					},
+				},
+			}),
+			wantOps: map[string]database.SyncStatus{},
+		},
+		{
+			name: "duplicated operations",
+			params: newParams(false,
+				newOperation("OP-1", models.SyncOperationKindSIGNIN, testStationA, 1, signInPayload),
+				newOperation("OP-1", models.SyncOperationKindSIGNIN, testStationA, 2, signInPayload),
+			),
+			want: produce.NewSyncOperationsDefault(http.StatusBadRequest).WithPayload(&models.Error{
+				Code:    int64(mcomErrors.Code_BAD_REQUEST),
+				Details: "duplicated operation: OP-1",
+			}),
+			wantOps: map[string]database.SyncStatus{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stores := storetest.New(t)
+			keepSyncOperations(t, stores.Syncs, tt.kept...)
+			for _, signIn := range tt.signIns {
+				assert.NoError(stores.StationLogs.SignInStation(context.Background(), signIn))
+			}
+			dm, err := mock.New(tt.script)
+			assert.NoError(err)
+			s := NewProduce(dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
+				return true
+			}, Config{
+				FontPath:    "fake-path",
+				Syncs:       stores.Syncs,
+				Holds:       stores.Holds,
+				StationLogs: stores.StationLogs,
+				BindSiteResources: func(site.AutoBindSiteResourcesParams, *models.Principal) middleware.Responder {
+					return tt.bind
+				},
+				SignInStation: func(params station.StationForceSignInParams, _ *models.Principal) middleware.Responder {
+					assert.Equal(testStationA, params.StationID)
+					assert.Equal(testSiteName1, params.Body.SiteName)
+					return tt.signIn
+				},
+			})
+
+			assert.Equal(tt.want, s.SyncOperations(tt.params, principal))
+			var kept []database.SyncOperation
+			assert.NoError(stores.DB.Find(&kept).Error)
+			ops := make(map[string]database.SyncStatus, len(kept))
+			for _, op := range kept {
+				ops[op.CreatedBy+"/"+op.ID] = op.Status
+			}
+			assert.Equal(tt.wantOps, ops)
+			assert.NoError(dm.Close())
+		})
+	}
+
+	{ // forbidden access
+		dm, err := mock.New(nil)
+		assert.NoError(err)
+		s := NewProduce(dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
+			return false
+		}, Config{Syncs: storetest.New(t).Syncs})
+		assert.Equal(produce.NewSyncOperationsDefault(http.StatusForbidden), s.SyncOperations(newParams(false,
+			newOperation("OP-1", models.SyncOperationKindSIGNIN, testStationA, 1, signInPayload),
+		), principal))
+		assert.NoError(dm.Close())
+	}
+}
@@ -0,0 +1,176 @@
+package produce
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/go-openapi/runtime/middleware"
+	"github.com/go-openapi/strfmt"
+
+	commonsCtx "gitlab.kenda.com.tw/kenda/commons/v2/utils/context"
+	"gitlab.kenda.com.tw/kenda/mcom"
+	mcomErrors "gitlab.kenda.com.tw/kenda/mcom/errors"
+
+	"gitlab.kenda.com.tw/kenda/mui/server/impl/utils"
+	"gitlab.kenda.com.tw/kenda/mui/server/impl/utils/genealogy"
+	"gitlab.kenda.com.tw/kenda/mui/server/protobuf/kenda"
+	"gitlab.kenda.com.tw/kenda/mui/server/swagger/models"
+	"gitlab.kenda.com.tw/kenda/mui/server/swagger/restapi/operations/produce"
+)
+
+// TraceResources implements.
+func (p Produce) TraceResources(params produce.TraceResourcesParams, principal *models.Principal) middleware.Responder {
+	if !p.hasPermission(kenda.FunctionOperationID_TRACE_RESOURCES, principal.Roles) {
+		return produce.NewTraceResourcesDefault(http.StatusForbidden)
+	}
+	ctx := commonsCtx.WithUserID(params.HTTPRequest.Context(), principal.ID)
+
+	roots, _, err := p.trace(ctx, params.ResourceID, params.LotNumber, params.Direction, params.Depth)
+	if err != nil {
+		return utils.ParseError(ctx, produce.NewTraceResourcesDefault(0), err)
+	}
+	return produce.NewTraceResourcesOK().WithPayload(&produce.TraceResourcesOKBody{
+		Data: toGenealogyNodes(roots),
+	})
+}
+
+// ExportTrace implements.
+func (p Produce) ExportTrace(params produce.ExportTraceParams, principal *models.Principal) middleware.Responder {
+	if !p.hasPermission(kenda.FunctionOperationID_TRACE_RESOURCES, principal.Roles) {
+		return produce.NewExportTraceDefault(http.StatusForbidden)
+	}
+	ctx := commonsCtx.WithUserID(params.HTTPRequest.Context(), principal.ID)
+
+	roots, direction, err := p.trace(ctx, params.ResourceID, params.LotNumber, params.Direction, params.Depth)
+	if err != nil {
+		return utils.ParseError(ctx, produce.NewExportTraceDefault(0), err)
+	}
+
+	format := "xlsx"
+	if params.Format != nil {
+		format = *params.Format
+	}
+	var buf bytes.Buffer
+	switch format {
+	case "json":
+		err = json.NewEncoder(&buf).Encode(toGenealogyNodes(roots))
+	default:
+		err = genealogy.WriteExcel(&buf, direction, roots)
+	}
+	if err != nil {
+		return utils.ParseError(ctx, produce.NewExportTraceDefault(0), err)
+	}
+
+	return produce.NewExportTraceOK().
+		WithContentDisposition(fmt.Sprintf(`attachment; filename="genealogy-%s.%s"`, direction, format)).
+		WithPayload(io.NopCloser(&buf))
+}
+
+// trace returns the genealogy trees of the requested resource or lot.
+func (p Produce) trace(ctx context.Context, resourceID, lotNumber, direction *string, depth *int64) ([]*genealogy.Node, genealogy.Direction, error) {
+	var req genealogy.Request
+	if resourceID != nil {
+		req.ResourceID = *resourceID
+	}
+	if lotNumber != nil {
+		req.LotNumber = *lotNumber
+	}
+	if direction != nil {
+		d, err := genealogy.ParseDirection(*direction)
+		if err != nil {
+			return nil, 0, mcomErrors.Error{
+				Code:    mcomErrors.Code_BAD_REQUEST,
+				Details: err.Error(),
+			}
+		}
+		req.Direction = d
+	}
+	if depth != nil {
+		req.Depth = int(*depth)
+	}
+
+	roots, err := genealogy.Trace(ctx, p.config.Records, materialResolver{dm: p.dm}, req)
+	if err != nil {
+		if errors.Is(err, genealogy.ErrInvalidRequest) {
+			return nil, 0, mcomErrors.Error{
+				Code:    mcomErrors.Code_BAD_REQUEST,
+				Details: err.Error(),
+			}
+		}
+		return nil, 0, err
+	}
+	return roots, req.Direction, nil
+}
+
+// materialResolver resolves the resources not collected by MUI by the
+// material resources of the data manager, in a single lookup.
+type materialResolver struct {
+	dm mcom.DataManager
+}
+
+// ResolveResources implements genealogy.Resolver interface.
+func (r materialResolver) ResolveResources(ctx context.Context, resourceIDs []string) (map[string]genealogy.Node, error) {
+	details := make([]mcom.GetMaterialResourceIdentityRequest, len(resourceIDs))
+	for i, id := range resourceIDs {
+		details[i] = mcom.GetMaterialResourceIdentityRequest{ResourceID: id}
+	}
+	reply, err := r.dm.ListMaterialResourceIdentities(ctx, mcom.ListMaterialResourceIdentitiesRequest{
+		Details: details,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := make(map[string]genealogy.Node, len(reply.Replies))
+	for i, resource := range reply.Replies {
+		// the replies are nil for the resources not found.
+		if resource == nil || i >= len(resourceIDs) {
+			continue
+		}
+		nodes[resourceIDs[i]] = genealogy.Node{
+			ResourceID: resource.Material.ResourceID,
+			ProductID:  resource.Material.ID,
+			Station:    resource.Material.Station,
+			Quantity:   resource.Material.Quantity,
+			CreatedAt:  resource.Material.ProductionTime,
+		}
+	}
+	return nodes, nil
+}
+
+func toGenealogyNodes(nodes []*genealogy.Node) []*models.GenealogyNode {
+	if len(nodes) == 0 {
+		return nil
+	}
+	s := make([]*models.GenealogyNode, len(nodes))
+	for i, n := range nodes {
+		s[i] = &models.GenealogyNode{
+			ResourceID:  n.ResourceID,
+			ProductID:   n.ProductID,
+			LotNumber:   n.LotNumber,
+			WorkOrderID: n.WorkOrder,
+			StationID:   n.Station,
+			Children:    toGenealogyNodes(n.Children),
+			Truncated:   n.Truncated,
+			Repeated:    n.Repeated,
+			Unknown:     n.Unknown,
+		}
+		if n.Batch != nil {
+			batch := int64(*n.Batch)
+			s[i].Batch = &batch
+		}
+		if !n.Unknown {
+			s[i].Quantity = n.Quantity.String()
+		}
+		if !n.CreatedAt.IsZero() {
+			createdAt := strfmt.DateTime(n.CreatedAt)
+			s[i].CreatedAt = &createdAt
+		}
+	}
+	return s
+}
@@ -0,0 +1,289 @@
+package produce
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-openapi/strfmt"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+
+	"gitlab.kenda.com.tw/kenda/mcom"
+	mcomErrors "gitlab.kenda.com.tw/kenda/mcom/errors"
+	"gitlab.kenda.com.tw/kenda/mcom/mock"
+
+	"gitlab.kenda.com.tw/kenda/mui/server/database"
+	"gitlab.kenda.com.tw/kenda/mui/server/database/storetest"
+	"gitlab.kenda.com.tw/kenda/mui/server/protobuf/kenda"
+	"gitlab.kenda.com.tw/kenda/mui/server/swagger/models"
+	"gitlab.kenda.com.tw/kenda/mui/server/swagger/restapi/operations/produce"
+)
+
+// newTraceStores returns the stores of a batch of testWorkOrder1, which
+// consumed RAW1 and produced testResourceID.
+func newTraceStores(t *testing.T, createdAt time.Time) storetest.Stores {
+	batch := int16(2)
+	stores := storetest.New(t)
+	if err := stores.Records.CreateRecords(context.Background(), []database.FeedRecord{
+		{
+			WorkOrder:  testWorkOrder1,
+			Batch:      batch,
+			Station:    testStationA,
+			ResourceID: "RAW1",
+			CreatedBy:  userID,
+			CreatedAt:  createdAt,
+		},
+	}, []database.CollectRecord{
+		{
+			WorkOrder:  testWorkOrder1,
+			Sequence:   1,
+			Batch:      &batch,
+			Station:    testStationA,
+			ProductID:  testWorkOrder1ProductA,
+			LotNumber:  "A1-0307",
+			ResourceID: testResourceID,
+			Quantity:   decimal.RequireFromString("30"),
+			CreatedBy:  userID,
+			CreatedAt:  createdAt,
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return stores
+}
+
+// lookupRawScript looks up RAW1 in the material resources.
+func lookupRawScript(reply *mcom.MaterialReply, err error) mock.Script {
+	return mock.Script{
+		Name: mock.FuncListMaterialResourceIdentities,
+		Input: mock.Input{
+			Request: mcom.ListMaterialResourceIdentitiesRequest{
+				Details: []mcom.GetMaterialResourceIdentityRequest{{ResourceID: "RAW1"}},
+			},
+		},
+		Output: mock.Output{
+			Response: mcom.ListMaterialResourceIdentitiesReply{
+				Replies: []*mcom.MaterialReply{reply},
+			},
+			Error: err,
+		},
+	}
+}
+
+func TestProduce_TraceResources(t *testing.T) {
+	assert := assert.New(t)
+	createdAt := time.Date(2024, 3, 7, 8, 0, 0, 0, time.UTC)
+	producedAt := createdAt.Add(-24 * time.Hour)
+	store := newTraceStores(t, createdAt).Records
+	rawMaterial := &mcom.MaterialReply{
+		Material: mcom.Material{
+			Type:           "RAW",
+			ID:             "RAWPRODUCT",
+			ResourceID:     "RAW1",
+			Station:        testStationA,
+			Quantity:       decimal.RequireFromString("50"),
+			ProductionTime: producedAt,
+		},
+	}
+
+	dm, err := mock.New([]mock.Script{
+		lookupRawScript(rawMaterial, nil),
+		lookupRawScript(rawMaterial, nil),
+		lookupRawScript(nil, nil),
+		lookupRawScript(nil, errors.New("broken")),
+	})
+	assert.NoError(err)
+	defer func() {
+		assert.NoError(dm.Close())
+	}()
+	s := NewProduce(dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
+		return true
+	}, Config{Records: store})
+	httpRequest := httptest.NewRequest("GET", "/production-flow/trace", nil)
+
+	resourceID, raw, lot := testResourceID, "RAW1", "A1-0307"
+	backward, forward, unknown := "backward", "forward", "sideways"
+	wantBatch := int64(2)
+	wantCreatedAt := strfmt.DateTime(createdAt)
+	wantProducedAt := strfmt.DateTime(producedAt)
+	consumed := &models.GenealogyNode{
+		ResourceID: "RAW1",
+		ProductID:  "RAWPRODUCT",
+		StationID:  testStationA,
+		Quantity:   "50",
+		CreatedAt:  &wantProducedAt,
+	}
+	produced := &models.GenealogyNode{
+		ResourceID:  testResourceID,
+		ProductID:   testWorkOrder1ProductA,
+		LotNumber:   "A1-0307",
+		WorkOrderID: testWorkOrder1,
+		Batch:       &wantBatch,
+		StationID:   testStationA,
+		Quantity:    "30",
+		CreatedAt:   &wantCreatedAt,
+	}
+
+	{ // backward
+		want := *produced
+		want.Children = []*models.GenealogyNode{consumed}
+		assert.Equal(produce.NewTraceResourcesOK().WithPayload(&produce.TraceResourcesOKBody{
+			Data: []*models.GenealogyNode{&want},
+		}), s.TraceResources(produce.TraceResourcesParams{
+			HTTPRequest: httpRequest,
+			ResourceID:  &resourceID,
+			Direction:   &backward,
+		}, principal))
+	}
+	{ // forward
+		assert.Equal(produce.NewTraceResourcesOK().WithPayload(&produce.TraceResourcesOKBody{
+			Data: []*models.GenealogyNode{{
+				ResourceID: "RAW1",
+				ProductID:  "RAWPRODUCT",
+				StationID:  testStationA,
+				Quantity:   "50",
+				CreatedAt:  &wantProducedAt,
+				Children:   []*models.GenealogyNode{produced},
+			}},
+		}), s.TraceResources(produce.TraceResourcesParams{
+			HTTPRequest: httpRequest,
+			ResourceID:  &raw,
+			Direction:   &forward,
+		}, principal))
+	}
+	{ // by lot number, the consumed resource is not found
+		depth := int64(1)
+		want := *produced
+		want.Children = []*models.GenealogyNode{{ResourceID: "RAW1", Unknown: true}}
+		assert.Equal(produce.NewTraceResourcesOK().WithPayload(&produce.TraceResourcesOKBody{
+			Data: []*models.GenealogyNode{&want},
+		}), s.TraceResources(produce.TraceResourcesParams{
+			HTTPRequest: httpRequest,
+			LotNumber:   &lot,
+			Depth:       &depth,
+		}, principal))
+	}
+	{ // lot not found
+		lot := "A1-0308"
+		assert.Equal(produce.NewTraceResourcesDefault(http.StatusNotFound).WithPayload(&models.Error{
+			Code:    int64(mcomErrors.Code_RECORD_NOT_FOUND),
+			Details: "record not found",
+		}), s.TraceResources(produce.TraceResourcesParams{
+			HTTPRequest: httpRequest,
+			LotNumber:   &lot,
+		}, principal))
+	}
+	{ // neither resource id nor lot number
+		assert.Equal(produce.NewTraceResourcesDefault(http.StatusBadRequest).WithPayload(&models.Error{
+			Code:    int64(mcomErrors.Code_BAD_REQUEST),
+			Details: "either resource id or lot number is required",
+		}), s.TraceResources(produce.TraceResourcesParams{
+			HTTPRequest: httpRequest,
+		}, principal))
+	}
+	{ // unknown direction
+		assert.Equal(produce.NewTraceResourcesDefault(http.StatusBadRequest).WithPayload(&models.Error{
+			Code:    int64(mcomErrors.Code_BAD_REQUEST),
+			Details: `unknown trace direction: "sideways"`,
+		}), s.TraceResources(produce.TraceResourcesParams{
+			HTTPRequest: httpRequest,
+			ResourceID:  &resourceID,
+			Direction:   &unknown,
+		}, principal))
+	}
+	{ // lookup error
+		assert.Equal(produce.NewTraceResourcesDefault(http.StatusInternalServerError).WithPayload(&models.Error{
+			Details: "broken",
+		}), s.TraceResources(produce.TraceResourcesParams{
+			HTTPRequest: httpRequest,
+			ResourceID:  &resourceID,
+		}, principal))
+	}
+	{ // store error
+		stores := storetest.New(t)
+		stores.Close(t)
+		s := NewProduce(dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
+			return true
+		}, Config{Records: stores.Records})
+		assert.Equal(produce.NewTraceResourcesDefault(http.StatusInternalServerError).WithPayload(&models.Error{
+			Details: "sql: database is closed",
+		}), s.TraceResources(produce.TraceResourcesParams{
+			HTTPRequest: httpRequest,
+			ResourceID:  &resourceID,
+		}, principal))
+	}
+	{ // forbidden access
+		s := NewProduce(dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
+			return false
+		}, Config{Records: store})
+		assert.Equal(produce.NewTraceResourcesDefault(http.StatusForbidden), s.TraceResources(produce.TraceResourcesParams{
+			HTTPRequest: httpRequest,
+			ResourceID:  &resourceID,
+		}, principal))
+	}
+}
+
+func TestProduce_ExportTrace(t *testing.T) {
+	assert := assert.New(t)
+	store := newTraceStores(t, time.Date(2024, 3, 7, 8, 0, 0, 0, time.UTC)).Records
+
+	dm, err := mock.New([]mock.Script{
+		lookupRawScript(nil, nil),
+		lookupRawScript(nil, nil),
+	})
+	assert.NoError(err)
+	defer func() {
+		assert.NoError(dm.Close())
+	}()
+	s := NewProduce(dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
+		return true
+	}, Config{Records: store})
+	httpRequest := httptest.NewRequest("GET", "/production-flow/trace/export", nil)
+	resourceID := testResourceID
+
+	{ // xlsx
+		rep, ok := s.ExportTrace(produce.ExportTraceParams{
+			HTTPRequest: httpRequest,
+			ResourceID:  &resourceID,
+		}, principal).(*produce.ExportTraceOK)
+		if assert.True(ok) {
+			assert.Equal(`attachment; filename="genealogy-backward.xlsx"`, rep.ContentDisposition)
+			b, err := io.ReadAll(rep.Payload)
+			assert.NoError(err)
+			// an xlsx file is a zip archive.
+			assert.Equal("PK", string(b[:2]))
+		}
+	}
+	{ // json
+		format := "json"
+		rep, ok := s.ExportTrace(produce.ExportTraceParams{
+			HTTPRequest: httpRequest,
+			ResourceID:  &resourceID,
+			Format:      &format,
+		}, principal).(*produce.ExportTraceOK)
+		if assert.True(ok) {
+			assert.Equal(`attachment; filename="genealogy-backward.json"`, rep.ContentDisposition)
+			var nodes []*models.GenealogyNode
+			assert.NoError(json.NewDecoder(rep.Payload).Decode(&nodes))
+			if assert.Len(nodes, 1) && assert.Len(nodes[0].Children, 1) {
+				assert.Equal(testResourceID, nodes[0].ResourceID)
+				assert.Equal("RAW1", nodes[0].Children[0].ResourceID)
+			}
+		}
+	}
+	{ // forbidden access
+		s := NewProduce(dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
+			return false
+		}, Config{Records: store})
+		assert.Equal(produce.NewExportTraceDefault(http.StatusForbidden), s.ExportTrace(produce.ExportTraceParams{
+			HTTPRequest: httpRequest,
+			ResourceID:  &resourceID,
+		}, principal))
+	}
+}
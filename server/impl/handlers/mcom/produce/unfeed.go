@@ -0,0 +1,373 @@
+package produce
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/go-openapi/runtime/middleware"
+	"github.com/shopspring/decimal"
+
+	commonsCtx "gitlab.kenda.com.tw/kenda/commons/v2/utils/context"
+	"gitlab.kenda.com.tw/kenda/mcom"
+	mcomErrors "gitlab.kenda.com.tw/kenda/mcom/errors"
+	mcomModels "gitlab.kenda.com.tw/kenda/mcom/impl/orm/models"
+	"gitlab.kenda.com.tw/kenda/mcom/utils/bindtype"
+	utilsResources "gitlab.kenda.com.tw/kenda/mcom/utils/resources"
+	"gitlab.kenda.com.tw/kenda/mcom/utils/types"
+
+	"gitlab.kenda.com.tw/kenda/mui/server/database"
+	"gitlab.kenda.com.tw/kenda/mui/server/impl/handlers/mcom/internal/printer"
+	handlerUtils "gitlab.kenda.com.tw/kenda/mui/server/impl/handlers/mcom/utils"
+	"gitlab.kenda.com.tw/kenda/mui/server/impl/handlers/mcom/utils/barcodes"
+	"gitlab.kenda.com.tw/kenda/mui/server/impl/utils"
+	"gitlab.kenda.com.tw/kenda/mui/server/impl/utils/idrule"
+	"gitlab.kenda.com.tw/kenda/mui/server/impl/utils/saga"
+	"gitlab.kenda.com.tw/kenda/mui/server/protobuf/kenda"
+	"gitlab.kenda.com.tw/kenda/mui/server/swagger/models"
+	"gitlab.kenda.com.tw/kenda/mui/server/swagger/restapi/operations/produce"
+)
+
+// unfeedCompensationReason is the remark of the remainder resources left
+// unavailable by a failed unfeed.
+const unfeedCompensationReason = "unfeed failed"
+
+// Unfeed implements. The quantity is returned to the fed resource, or to a
+// remainder resource with a new label, and then optionally bound to a site or
+// moved to a warehouse. The feed records are kept, and the return is recorded
+// by an unfeed record.
+func (p Produce) Unfeed(params produce.UnfeedParams, principal *models.Principal) middleware.Responder {
+	if !p.hasPermission(kenda.FunctionOperationID_UNFEED, principal.Roles) {
+		return produce.NewUnfeedDefault(http.StatusForbidden)
+	}
+	ctx := commonsCtx.WithUserID(params.HTTPRequest.Context(), principal.ID)
+	body := params.Body
+
+	quantity, err := decimal.NewFromString(*body.Quantity)
+	if err != nil || !quantity.IsPositive() {
+		return utils.ParseError(ctx, produce.NewUnfeedDefault(0), mcomErrors.Error{
+			Code:    mcomErrors.Code_INVALID_NUMBER,
+			Details: fmt.Sprintf("invalid_number=%s", *body.Quantity),
+		})
+	}
+	toSite := body.Site != nil && body.Site.StationID != ""
+	toWarehouse := body.Warehouse != nil && body.Warehouse.ID != ""
+	if toSite && toWarehouse {
+		return utils.ParseError(ctx, produce.NewUnfeedDefault(0), mcomErrors.Error{
+			Code:    mcomErrors.Code_BAD_REQUEST,
+			Details: "either site or warehouse can be specified",
+		})
+	}
+
+	workOrder, err := p.dm.GetWorkOrder(ctx, mcom.GetWorkOrderRequest{
+		ID: params.WorkOrderID,
+	})
+	if err != nil {
+		return utils.ParseError(ctx, produce.NewUnfeedDefault(0), err)
+	}
+	if _, err := p.dm.GetBatch(ctx, mcom.GetBatchRequest{
+		WorkOrder: params.WorkOrderID,
+		Number:    int16(params.Batch),
+	}); err != nil {
+		return utils.ParseError(ctx, produce.NewUnfeedDefault(0), err)
+	}
+
+	resource, err := p.dm.GetMaterialResourceIdentity(ctx, mcom.GetMaterialResourceIdentityRequest{
+		ResourceID:  *body.ResourceID,
+		ProductType: *body.ProductType,
+	})
+	if err != nil {
+		return utils.ParseError(ctx, produce.NewUnfeedDefault(0), err)
+	}
+	material := resource.Material
+
+	limit, err := p.unfeedLimit(ctx, params.WorkOrderID, int16(params.Batch), body.FeedRecordID, material.ResourceID)
+	if err != nil {
+		return utils.ParseError(ctx, produce.NewUnfeedDefault(0), err)
+	}
+	if toSite {
+		// the remainder of a resource in aging is not bound, even with a new label.
+		if _, err := handlerUtils.CheckAgingHolds(ctx, p.config.Holds, []mcom.BindMaterialResource{{
+			ResourceID:  material.ResourceID,
+			ProductType: material.Type,
+		}}, false, ""); err != nil {
+			return utils.ParseError(ctx, produce.NewUnfeedDefault(0), err)
+		}
+	}
+
+	stationPrinter := p.config.Printers[workOrder.Station]
+	if body.NewLabel && body.Print && stationPrinter == "" {
+		return utils.ParseError(ctx, produce.NewUnfeedDefault(0), mcomErrors.Error{
+			Code:    mcomErrors.Code_STATION_PRINTER_NOT_DEFINED,
+			Details: fmt.Sprintf("station %s no defined printer", workOrder.Station),
+		})
+	}
+
+	// the resource holding the returned quantity.
+	resourceID := material.ResourceID
+	resourceQuantity := material.Quantity.Add(quantity)
+	warehouse := resource.Warehouse
+
+	record := database.UnfeedRecord{
+		WorkOrder:    params.WorkOrderID,
+		Batch:        int16(params.Batch),
+		FeedRecordID: body.FeedRecordID,
+		ResourceID:   material.ResourceID,
+		ProductType:  material.Type,
+		Quantity:     quantity,
+		Reason:       body.Reason,
+		CreatedBy:    principal.ID,
+	}
+	if toSite {
+		record.Station = body.Site.StationID
+		record.SiteName = body.Site.SiteName
+		record.SiteIndex = int16(body.Site.SiteIndex)
+	}
+	if toWarehouse {
+		record.Warehouse = body.Warehouse.ID
+		record.Location = body.Warehouse.Location
+	}
+
+	// the return is recorded first, so that the concurrent returns of the
+	// resource can not exceed the fed quantity together.
+	var recordID int64
+	steps := []saga.Step{{
+		Name: "RECORD_UNFEED",
+		Do: func(ctx context.Context) error {
+			var err error
+			recordID, err = p.config.Feeds.ReserveUnfeed(ctx, record, limit)
+			var exceeded *database.UnfeedExceededError
+			if errors.As(err, &exceeded) {
+				return mcomErrors.Error{
+					Code: mcomErrors.Code_INVALID_NUMBER,
+					Details: fmt.Sprintf("invalid quantity: %s, resource %s has %s fed to the batch and %s returned",
+						quantity, material.ResourceID, exceeded.Fed, exceeded.Returned),
+				}
+			}
+			return err
+		},
+		Compensate: func(ctx context.Context) error {
+			return p.config.Feeds.DeleteUnfeedRecord(ctx, recordID)
+		},
+	}}
+
+	if body.NewLabel {
+		resourceQuantity = quantity
+		newResourceID, err := p.config.IDRules.ResourceID(ctx, idrule.Values{
+			Time:        time.Now(),
+			Station:     workOrder.Station,
+			ProductID:   material.ID,
+			ProductType: material.Type,
+		})
+		if err != nil {
+			return utils.ParseError(ctx, produce.NewUnfeedDefault(0), err)
+		}
+		steps = append(steps, saga.Step{
+			Name: "CREATE_RESOURCE",
+			Do: func(ctx context.Context) error {
+				reply, err := p.dm.CreateMaterialResources(ctx, mcom.CreateMaterialResourcesRequest{
+					Materials: []mcom.CreateMaterialResourcesRequestDetail{
+						{
+							ID:             material.ID,
+							Type:           material.Type,
+							Status:         utilsResources.MaterialStatus_AVAILABLE,
+							Quantity:       quantity,
+							Unit:           material.Unit,
+							LotNumber:      material.LotNumber,
+							ResourceID:     newResourceID,
+							ProductionTime: material.ProductionTime,
+							ExpiryTime:     material.ExpiryTime,
+						},
+					},
+				})
+				if err != nil {
+					return err
+				}
+				resourceID = reply[0].ID
+				return nil
+			},
+			// the created resource can not be removed, it is left unavailable.
+			Compensate: func(ctx context.Context) error {
+				return p.dm.UpdateMaterialResource(ctx, mcom.UpdateMaterialResourceRequest{
+					ResourceID:  resourceID,
+					ProductType: material.Type,
+					Status:      utilsResources.MaterialStatus_UNAVAILABLE,
+					Quantity:    decimal.Zero,
+					Remark:      unfeedCompensationReason,
+				})
+			},
+		}, saga.Step{
+			Name: "RECORD_NEW_RESOURCE",
+			Do: func(ctx context.Context) error {
+				return p.config.Feeds.SetUnfeedNewResource(ctx, recordID, resourceID)
+			},
+			Compensate: func(ctx context.Context) error {
+				return p.config.Feeds.SetUnfeedNewResource(ctx, recordID, "")
+			},
+		})
+	} else {
+		// the used up resources are available again.
+		status := material.Status
+		if status == utilsResources.MaterialStatus_UNAVAILABLE {
+			status = utilsResources.MaterialStatus_AVAILABLE
+		}
+		updateResource := func(status utilsResources.MaterialStatus, quantity decimal.Decimal, remark string) func(ctx context.Context) error {
+			return func(ctx context.Context) error {
+				return p.dm.UpdateMaterialResource(ctx, mcom.UpdateMaterialResourceRequest{
+					ResourceID:  material.ResourceID,
+					ProductType: material.Type,
+					Status:      status,
+					Quantity:    quantity,
+					Remark:      remark,
+				})
+			}
+		}
+		remark := material.Remark
+		if body.Reason != "" {
+			remark = body.Reason
+		}
+		steps = append(steps, saga.Step{
+			Name:       "RESTORE_RESOURCE",
+			Do:         updateResource(status, resourceQuantity, remark),
+			Compensate: updateResource(material.Status, material.Quantity, material.Remark),
+		})
+	}
+
+	switch {
+	case toSite:
+		// the binding of the other resources at the site can not be restored.
+		steps = append(steps, saga.Step{
+			Name: "BIND_SITE",
+			Do: func(ctx context.Context) error {
+				return p.dm.MaterialResourceBindV2(ctx, mcom.MaterialResourceBindRequestV2{
+					Details: []mcom.MaterialBindRequestDetailV2{
+						{
+							Type: bindtype.BindType(body.BindType),
+							Site: mcomModels.UniqueSite{
+								Station: body.Site.StationID,
+								SiteID: mcomModels.SiteID{
+									Name:  body.Site.SiteName,
+									Index: int16(body.Site.SiteIndex),
+								},
+							},
+							Resources: []mcom.BindMaterialResource{
+								{
+									Material: mcomModels.Material{
+										ID:    material.ID,
+										Grade: material.Grade,
+									},
+									ResourceID:  resourceID,
+									ProductType: material.Type,
+									Quantity:    &quantity,
+									Warehouse:   warehouse,
+									Status:      utilsResources.MaterialStatus_AVAILABLE,
+									ExpiryTime:  types.ToTimeNano(material.ExpiryTime),
+								},
+							},
+						},
+					},
+				})
+			},
+		})
+	case toWarehouse:
+		moveResource := func(warehouse mcom.Warehouse) func(ctx context.Context) error {
+			return func(ctx context.Context) error {
+				return p.dm.WarehousingStock(ctx, mcom.WarehousingStockRequest{
+					Warehouse:   warehouse,
+					ResourceIDs: []string{resourceID},
+				})
+			}
+		}
+		step := saga.Step{
+			Name: "MOVE_TO_WAREHOUSE",
+			Do: moveResource(mcom.Warehouse{
+				ID:       body.Warehouse.ID,
+				Location: body.Warehouse.Location,
+			}),
+		}
+		if !body.NewLabel {
+			step.Compensate = moveResource(warehouse)
+		}
+		steps = append(steps, step)
+	}
+
+	if err := saga.Run(ctx, steps...); err != nil {
+		return utils.ParseError(ctx, produce.NewUnfeedDefault(0), handlerUtils.ParseSagaError(err))
+	}
+
+	if body.NewLabel && body.Print {
+		pdf, err := printer.CreateResourcesPDF(ctx, models.MaterialResourceLabelFieldName{}, printer.PrintData{
+			StationID:      workOrder.Station,
+			ProductID:      material.ID,
+			ProductionDate: material.ProductionTime,
+			ExpiryDate:     material.ExpiryTime,
+			Quantity:       quantity,
+			ResourceID:     resourceID,
+		}, barcodes.Code39{}, p.config.FontPath)
+		if err != nil {
+			return utils.ParseError(ctx, produce.NewUnfeedDefault(0), err)
+		}
+		if err := mcom.Print(ctx, stationPrinter, pdf); err != nil {
+			return utils.ParseError(ctx, produce.NewUnfeedDefault(0), err)
+		}
+	}
+
+	return produce.NewUnfeedOK().WithPayload(&produce.UnfeedOKBody{
+		Data: &produce.UnfeedOKBodyData{
+			ResourceID: resourceID,
+			Quantity:   resourceQuantity.String(),
+		},
+	})
+}
+
+// unfeedLimit checks that the resource was fed to the batch, by the feed
+// record if specified, and returns the limit of its returns. The quantities
+// fed according to the recipe are not known, and then the returns are not
+// limited.
+func (p Produce) unfeedLimit(ctx context.Context, workOrder string, batch int16, feedRecordID, resourceID string) (*database.UnfeedLimit, error) {
+	feeds, err := p.config.Records.ListResourceFeeds(ctx, workOrder, batch, resourceID)
+	if err != nil {
+		return nil, err
+	}
+	if len(feeds) == 0 {
+		return nil, mcomErrors.Error{
+			Code:    mcomErrors.Code_BAD_REQUEST,
+			Details: fmt.Sprintf("resource %s was not fed to batch %d of work order %s", resourceID, batch, workOrder),
+		}
+	}
+
+	var (
+		fed     decimal.Decimal
+		limited = true
+		// the feed records of the batch, the returns of the failed feeds are
+		// not counted.
+		feedRecords = map[string]struct{}{"": {}}
+	)
+	for _, feed := range feeds {
+		feedRecords[feed.FeedRecordID] = struct{}{}
+		if feed.Quantity.Valid {
+			fed = fed.Add(feed.Quantity.Decimal)
+		} else {
+			limited = false
+		}
+	}
+	if _, ok := feedRecords[feedRecordID]; !ok {
+		return nil, mcomErrors.Error{
+			Code:    mcomErrors.Code_BAD_REQUEST,
+			Details: fmt.Sprintf("resource %s was not fed to batch %d of work order %s by feed record %s", resourceID, batch, workOrder, feedRecordID),
+		}
+	}
+	if !limited {
+		return nil, nil
+	}
+
+	ids := make([]string, 0, len(feedRecords))
+	for id := range feedRecords {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return &database.UnfeedLimit{Fed: fed, FeedRecordIDs: ids}, nil
+}
@@ -0,0 +1,527 @@
+package produce
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-openapi/runtime/middleware"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+
+	"gitlab.kenda.com.tw/kenda/mcom"
+	mcomErrors "gitlab.kenda.com.tw/kenda/mcom/errors"
+	mcomModels "gitlab.kenda.com.tw/kenda/mcom/impl/orm/models"
+	"gitlab.kenda.com.tw/kenda/mcom/mock"
+	"gitlab.kenda.com.tw/kenda/mcom/utils/bindtype"
+	"gitlab.kenda.com.tw/kenda/mcom/utils/resources"
+	"gitlab.kenda.com.tw/kenda/mcom/utils/types"
+
+	"gitlab.kenda.com.tw/kenda/mui/server/database"
+	"gitlab.kenda.com.tw/kenda/mui/server/database/storetest"
+	"gitlab.kenda.com.tw/kenda/mui/server/protobuf/kenda"
+	"gitlab.kenda.com.tw/kenda/mui/server/swagger/models"
+	"gitlab.kenda.com.tw/kenda/mui/server/swagger/restapi/operations/produce"
+)
+
+// listUnfeedRecords lists the unfeed records kept, without their IDs and
+// creation times.
+func listUnfeedRecords(t *testing.T, db *gorm.DB) []database.UnfeedRecord {
+	var records []database.UnfeedRecord
+	if err := db.Order("id").Find(&records).Error; err != nil {
+		t.Fatal(err)
+	}
+	for i := range records {
+		records[i].ID = 0
+		records[i].CreatedAt = time.Time{}
+		records[i].Quantity = decimal.RequireFromString(records[i].Quantity.String())
+	}
+	return records
+}
+
+func TestProduce_Unfeed(t *testing.T) {
+	var (
+		testBatch          = 3
+		testNewResourceID  = "NEWRESOURCEID"
+		testFeedRecordID   = "FEEDRECORDID"
+		testReason         = "remainder"
+		testResourceRemark = "REMARK"
+		testWarehouse      = mcom.Warehouse{ID: "WAREHOUSE", Location: "A1"}
+		testOtherWarehouse = mcom.Warehouse{ID: "OTHERWAREHOUSE", Location: "B2"}
+		testSiteIndex      = 1
+		testAgingUntil     = time.Now().Add(time.Hour)
+	)
+	assert := assert.New(t)
+
+	httpRequest := httptest.NewRequest("POST", "/production-flow/unfeed/work-order/{workOrderID}/batch/{batch}", nil)
+	newParams := func(quantity string, body produce.UnfeedBody) produce.UnfeedParams {
+		resourceID, productType := testResourceID, testWorkOrder1ProductType
+		body.ResourceID = &resourceID
+		body.ProductType = &productType
+		body.Quantity = &quantity
+		body.FeedRecordID = testFeedRecordID
+		body.Reason = testReason
+		return produce.UnfeedParams{
+			HTTPRequest: httpRequest,
+			WorkOrderID: testWorkOrder1,
+			Batch:       int64(testBatch),
+			Body:        body,
+		}
+	}
+	lookupScripts := []mock.Script{
+		{
+			Name: mock.FuncGetWorkOrder,
+			Input: mock.Input{
+				Request: mcom.GetWorkOrderRequest{
+					ID: testWorkOrder1,
+				},
+			},
+			Output: mock.Output{
+				Response: mcom.GetWorkOrderReply{
+					ID:      testWorkOrder1,
+					Station: testStationA,
+				},
+			},
+		},
+		{
+			Name: mock.FuncGetBatch,
+			Input: mock.Input{
+				Request: mcom.GetBatchRequest{
+					WorkOrder: testWorkOrder1,
+					Number:    int16(testBatch),
+				},
+			},
+			Output: mock.Output{
+				Response: mcom.GetBatchReply{},
+			},
+		},
+		{
+			Name: mock.FuncGetMaterialResourceIdentity,
+			Input: mock.Input{
+				Request: mcom.GetMaterialResourceIdentityRequest{
+					ResourceID:  testResourceID,
+					ProductType: testWorkOrder1ProductType,
+				},
+			},
+			Output: mock.Output{
+				Response: mcom.GetMaterialResourceIdentityReply{
+					Material: mcom.Material{
+						Type:       testWorkOrder1ProductType,
+						ID:         testWorkOrder1ProductA,
+						Status:     resources.MaterialStatus_UNAVAILABLE,
+						Quantity:   decimal.Zero,
+						ResourceID: testResourceID,
+						Remark:     testResourceRemark,
+					},
+					Warehouse: testWarehouse,
+				},
+			},
+		},
+	}
+	updateResourceScript := func(status resources.MaterialStatus, quantity string, remark string) mock.Script {
+		return mock.Script{
+			Name: mock.FuncUpdateMaterialResource,
+			Input: mock.Input{
+				Request: mcom.UpdateMaterialResourceRequest{
+					ResourceID:  testResourceID,
+					ProductType: testWorkOrder1ProductType,
+					Status:      status,
+					Quantity:    decimal.RequireFromString(quantity),
+					Remark:      remark,
+				},
+			},
+		}
+	}
+	warehousingScript := func(warehouse mcom.Warehouse, err error) mock.Script {
+		return mock.Script{
+			Name: mock.FuncWarehousingStock,
+			Input: mock.Input{
+				Request: mcom.WarehousingStockRequest{
+					Warehouse:   warehouse,
+					ResourceIDs: []string{testResourceID},
+				},
+			},
+			Output: mock.Output{
+				Error: err,
+			},
+		}
+	}
+	testRemainder := decimal.RequireFromString("5")
+	testFeeds := []database.FeedRecord{
+		{
+			WorkOrder:     testWorkOrder1,
+			Batch:         int16(testBatch),
+			Station:       testStationA,
+			FeedRecordID:  testFeedRecordID,
+			Quantity:      decimal.NewNullDecimal(decimal.RequireFromString("8")),
+			SiteResources: []string{testResourceID},
+			CreatedBy:     userID,
+		},
+		{
+			WorkOrder:  testWorkOrder1,
+			Batch:      int16(testBatch),
+			Station:    testStationA,
+			ResourceID: testResourceID,
+			Quantity:   decimal.NewNullDecimal(decimal.RequireFromString("4")),
+			CreatedBy:  userID,
+		},
+	}
+	// the returns of the other feeds and of the failed feeds.
+	testUnfeeds := []database.UnfeedRecord{
+		{
+			WorkOrder:    testWorkOrder1,
+			Batch:        int16(testBatch),
+			FeedRecordID: testFeedRecordID,
+			ResourceID:   testResourceID,
+			Quantity:     decimal.RequireFromString("6"),
+		},
+		{
+			WorkOrder:    testWorkOrder1,
+			Batch:        int16(testBatch),
+			FeedRecordID: "FAILEDFEEDRECORDID",
+			ResourceID:   testResourceID,
+			Quantity:     decimal.RequireFromString("6"),
+		},
+		{
+			WorkOrder:    testWorkOrder1,
+			Batch:        int16(testBatch + 1),
+			FeedRecordID: testFeedRecordID,
+			ResourceID:   testResourceID,
+			Quantity:     decimal.RequireFromString("6"),
+		},
+	}
+
+	tests := []struct {
+		name       string
+		params     produce.UnfeedParams
+		feeds      []database.FeedRecord
+		unfeeds    []database.UnfeedRecord
+		holds      []database.AgingHold
+		script     []mock.Script
+		want       middleware.Responder
+		wantRecord *database.UnfeedRecord
+	}{
+		{
+			name:  "restore to the fed resource and move to warehouse",
+			feeds: testFeeds,
+			params: newParams("5", produce.UnfeedBody{
+				Warehouse: &produce.UnfeedParamsBodyWarehouse{
+					ID:       testOtherWarehouse.ID,
+					Location: testOtherWarehouse.Location,
+				},
+			}),
+			script: append(lookupScripts,
+				updateResourceScript(resources.MaterialStatus_AVAILABLE, "5", testReason),
+				warehousingScript(testOtherWarehouse, nil),
+			),
+			want: produce.NewUnfeedOK().WithPayload(&produce.UnfeedOKBody{
+				Data: &produce.UnfeedOKBodyData{
+					ResourceID: testResourceID,
+					Quantity:   "5",
+				},
+			}),
+			wantRecord: &database.UnfeedRecord{
+				WorkOrder:    testWorkOrder1,
+				Batch:        int16(testBatch),
+				FeedRecordID: testFeedRecordID,
+				ResourceID:   testResourceID,
+				ProductType:  testWorkOrder1ProductType,
+				Quantity:     testRemainder,
+				Warehouse:    testOtherWarehouse.ID,
+				Location:     testOtherWarehouse.Location,
+				Reason:       testReason,
+				CreatedBy:    userID,
+			},
+		},
+		{
+			name:  "remainder with a new label bound to site",
+			feeds: testFeeds,
+			params: newParams("5", produce.UnfeedBody{
+				NewLabel: true,
+				Site: &models.SiteInfo{
+					StationID: testStationA,
+					SiteName:  testSiteName1,
+					SiteIndex: int64(testSiteIndex),
+				},
+				BindType: models.BindType(bindtype.BindType_RESOURCE_BINDING_COLQUEUE_ADD),
+			}),
+			script: append(lookupScripts,
+				mock.Script{
+					Name: mock.FuncCreateMaterialResources,
+					Input: mock.Input{
+						Request: mcom.CreateMaterialResourcesRequest{
+							Materials: []mcom.CreateMaterialResourcesRequestDetail{{
+								Type:     testWorkOrder1ProductType,
+								ID:       testWorkOrder1ProductA,
+								Status:   resources.MaterialStatus_AVAILABLE,
+								Quantity: testRemainder,
+							}},
+						},
+					},
+					Output: mock.Output{
+						Response: mcom.CreateMaterialResourcesReply{{ID: testNewResourceID}},
+					},
+				},
+				mock.Script{
+					Name: mock.FuncMaterialResourceBindV2,
+					Input: mock.Input{
+						Request: mcom.MaterialResourceBindRequestV2{
+							Details: []mcom.MaterialBindRequestDetailV2{{
+								Type: bindtype.BindType_RESOURCE_BINDING_COLQUEUE_ADD,
+								Site: mcomModels.UniqueSite{
+									Station: testStationA,
+									SiteID: mcomModels.SiteID{
+										Name:  testSiteName1,
+										Index: int16(testSiteIndex),
+									},
+								},
+								Resources: []mcom.BindMaterialResource{{
+									Material: mcomModels.Material{
+										ID: testWorkOrder1ProductA,
+									},
+									ResourceID:  testNewResourceID,
+									ProductType: testWorkOrder1ProductType,
+									Quantity:    &testRemainder,
+									Warehouse:   testWarehouse,
+									Status:      resources.MaterialStatus_AVAILABLE,
+									ExpiryTime:  types.ToTimeNano(time.Time{}),
+								}},
+							}},
+						},
+					},
+				},
+			),
+			want: produce.NewUnfeedOK().WithPayload(&produce.UnfeedOKBody{
+				Data: &produce.UnfeedOKBodyData{
+					ResourceID: testNewResourceID,
+					Quantity:   "5",
+				},
+			}),
+			wantRecord: &database.UnfeedRecord{
+				WorkOrder:     testWorkOrder1,
+				Batch:         int16(testBatch),
+				FeedRecordID:  testFeedRecordID,
+				ResourceID:    testResourceID,
+				ProductType:   testWorkOrder1ProductType,
+				Quantity:      testRemainder,
+				NewResourceID: testNewResourceID,
+				Station:       testStationA,
+				SiteName:      testSiteName1,
+				SiteIndex:     int16(testSiteIndex),
+				Reason:        testReason,
+				CreatedBy:     userID,
+			},
+		},
+		{
+			name:  "move failed, resource restored",
+			feeds: testFeeds,
+			params: newParams("5", produce.UnfeedBody{
+				Warehouse: &produce.UnfeedParamsBodyWarehouse{
+					ID:       testOtherWarehouse.ID,
+					Location: testOtherWarehouse.Location,
+				},
+			}),
+			script: append(lookupScripts,
+				updateResourceScript(resources.MaterialStatus_AVAILABLE, "5", testReason),
+				warehousingScript(testOtherWarehouse, mcomErrors.Error{Code: mcomErrors.Code_WAREHOUSE_NOT_FOUND}),
+				updateResourceScript(resources.MaterialStatus_UNAVAILABLE, "0", testResourceRemark),
+			),
+			want: produce.NewUnfeedDefault(http.StatusBadRequest).WithPayload(&models.Error{
+				Code: int64(mcomErrors.Code_WAREHOUSE_NOT_FOUND),
+				Details: "step MOVE_TO_WAREHOUSE failed: " +
+					mcomErrors.Error{Code: mcomErrors.Code_WAREHOUSE_NOT_FOUND}.Error() +
+					"; compensated: RESTORE_RESOURCE, RECORD_UNFEED",
+			}),
+		},
+		{
+			name:  "move failed, remainder left unavailable",
+			feeds: testFeeds,
+			params: newParams("5", produce.UnfeedBody{
+				NewLabel: true,
+				Warehouse: &produce.UnfeedParamsBodyWarehouse{
+					ID:       testOtherWarehouse.ID,
+					Location: testOtherWarehouse.Location,
+				},
+			}),
+			script: append(lookupScripts,
+				mock.Script{
+					Name: mock.FuncCreateMaterialResources,
+					Input: mock.Input{
+						Request: mcom.CreateMaterialResourcesRequest{
+							Materials: []mcom.CreateMaterialResourcesRequestDetail{{
+								Type:     testWorkOrder1ProductType,
+								ID:       testWorkOrder1ProductA,
+								Status:   resources.MaterialStatus_AVAILABLE,
+								Quantity: testRemainder,
+							}},
+						},
+					},
+					Output: mock.Output{
+						Response: mcom.CreateMaterialResourcesReply{{ID: testNewResourceID}},
+					},
+				},
+				mock.Script{
+					Name: mock.FuncWarehousingStock,
+					Input: mock.Input{
+						Request: mcom.WarehousingStockRequest{
+							Warehouse:   testOtherWarehouse,
+							ResourceIDs: []string{testNewResourceID},
+						},
+					},
+					Output: mock.Output{
+						Error: mcomErrors.Error{Code: mcomErrors.Code_WAREHOUSE_NOT_FOUND},
+					},
+				},
+				mock.Script{
+					Name: mock.FuncUpdateMaterialResource,
+					Input: mock.Input{
+						Request: mcom.UpdateMaterialResourceRequest{
+							ResourceID:  testNewResourceID,
+							ProductType: testWorkOrder1ProductType,
+							Status:      resources.MaterialStatus_UNAVAILABLE,
+							Quantity:    decimal.Zero,
+							Remark:      unfeedCompensationReason,
+						},
+					},
+				},
+			),
+			want: produce.NewUnfeedDefault(http.StatusBadRequest).WithPayload(&models.Error{
+				Code: int64(mcomErrors.Code_WAREHOUSE_NOT_FOUND),
+				Details: "step MOVE_TO_WAREHOUSE failed: " +
+					mcomErrors.Error{Code: mcomErrors.Code_WAREHOUSE_NOT_FOUND}.Error() +
+					"; compensated: RECORD_NEW_RESOURCE, CREATE_RESOURCE, RECORD_UNFEED",
+			}),
+		},
+		{
+			name:   "not fed to the batch",
+			params: newParams("5", produce.UnfeedBody{}),
+			feeds:  testFeeds[:0],
+			script: lookupScripts,
+			want: produce.NewUnfeedDefault(http.StatusBadRequest).WithPayload(&models.Error{
+				Code:    int64(mcomErrors.Code_BAD_REQUEST),
+				Details: fmt.Sprintf("resource %s was not fed to batch %d of work order %s", testResourceID, testBatch, testWorkOrder1),
+			}),
+		},
+		{
+			name:   "not fed by the feed record",
+			params: newParams("5", produce.UnfeedBody{}),
+			feeds:  testFeeds[1:],
+			script: lookupScripts,
+			want: produce.NewUnfeedDefault(http.StatusBadRequest).WithPayload(&models.Error{
+				Code: int64(mcomErrors.Code_BAD_REQUEST),
+				Details: fmt.Sprintf("resource %s was not fed to batch %d of work order %s by feed record %s",
+					testResourceID, testBatch, testWorkOrder1, testFeedRecordID),
+			}),
+		},
+		{
+			name:    "more than the fed quantity",
+			params:  newParams("6.5", produce.UnfeedBody{}),
+			feeds:   testFeeds,
+			unfeeds: testUnfeeds,
+			script:  lookupScripts,
+			want: produce.NewUnfeedDefault(http.StatusBadRequest).WithPayload(&models.Error{
+				Code: int64(mcomErrors.Code_INVALID_NUMBER),
+				Details: "step RECORD_UNFEED failed: " + mcomErrors.Error{
+					Code:    mcomErrors.Code_INVALID_NUMBER,
+					Details: fmt.Sprintf("invalid quantity: 6.5, resource %s has 12 fed to the batch and 6 returned", testResourceID),
+				}.Error(),
+			}),
+		},
+		{
+			name:   "invalid quantity",
+			params: newParams("0", produce.UnfeedBody{}),
+			want: produce.NewUnfeedDefault(http.StatusBadRequest).WithPayload(&models.Error{
+				Code:    int64(mcomErrors.Code_INVALID_NUMBER),
+				Details: "invalid_number=0",
+			}),
+		},
+		{
+			name: "both site and warehouse",
+			params: newParams("5", produce.UnfeedBody{
+				Site: &models.SiteInfo{
+					StationID: testStationA,
+					SiteName:  testSiteName1,
+				},
+				Warehouse: &produce.UnfeedParamsBodyWarehouse{
+					ID: testOtherWarehouse.ID,
+				},
+			}),
+			want: produce.NewUnfeedDefault(http.StatusBadRequest).WithPayload(&models.Error{
+				Code:    int64(mcomErrors.Code_BAD_REQUEST),
+				Details: "either site or warehouse can be specified",
+			}),
+		},
+		{
+			name:  "resource in aging bound to site",
+			feeds: testFeeds,
+			holds: []database.AgingHold{{ResourceID: testResourceID, ProductType: testWorkOrder1ProductType, Until: testAgingUntil}},
+			params: newParams("5", produce.UnfeedBody{
+				NewLabel: true,
+				Site: &models.SiteInfo{
+					StationID: testStationA,
+					SiteName:  testSiteName1,
+					SiteIndex: int64(testSiteIndex),
+				},
+				BindType: models.BindType(bindtype.BindType_RESOURCE_BINDING_COLQUEUE_ADD),
+			}),
+			script: lookupScripts,
+			want: produce.NewUnfeedDefault(http.StatusBadRequest).WithPayload(&models.Error{
+				Code:    int64(mcomErrors.Code_RESOURCE_UNAVAILABLE),
+				Details: "resource " + testResourceID + " in aging until " + testAgingUntil.Format(time.RFC3339),
+			}),
+		},
+		{
+			name:  "printer not defined, nothing changed",
+			feeds: testFeeds,
+			params: newParams("5", produce.UnfeedBody{
+				NewLabel: true,
+				Print:    true,
+			}),
+			script: lookupScripts,
+			want: produce.NewUnfeedDefault(http.StatusBadRequest).WithPayload(&models.Error{
+				Code:    int64(mcomErrors.Code_STATION_PRINTER_NOT_DEFINED),
+				Details: "station " + testStationA + " no defined printer",
+			}),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stores := storetest.New(t)
+			for _, record := range tt.unfeeds {
+				assert.NoError(stores.Feeds.CreateUnfeedRecord(context.Background(), record))
+			}
+			assert.NoError(stores.Records.CreateRecords(context.Background(), append([]database.FeedRecord(nil), tt.feeds...), nil))
+			if len(tt.holds) != 0 {
+				assert.NoError(stores.Holds.CreateAgingHolds(context.Background(), tt.holds))
+			}
+			dm, err := mock.New(tt.script)
+			assert.NoError(err)
+			s := NewProduce(dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
+				return true
+			}, Config{FontPath: "fake-path", Feeds: stores.Feeds, Holds: stores.Holds, Records: stores.Records, IDRules: newIDRules()})
+
+			assert.Equal(tt.want, s.Unfeed(tt.params, principal))
+			wantRecords := append([]database.UnfeedRecord{}, tt.unfeeds...)
+			if tt.wantRecord != nil {
+				wantRecords = append(wantRecords, *tt.wantRecord)
+			}
+			assert.Equal(wantRecords, listUnfeedRecords(t, stores.DB))
+			assert.NoError(dm.Close())
+		})
+	}
+
+	{ // forbidden access
+		stores := storetest.New(t)
+		dm, err := mock.New(nil)
+		assert.NoError(err)
+		s := NewProduce(dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
+			return false
+		}, Config{Feeds: stores.Feeds, Records: stores.Records})
+		assert.Equal(produce.NewUnfeedDefault(http.StatusForbidden), s.Unfeed(newParams("5", produce.UnfeedBody{}), principal))
+		assert.NoError(dm.Close())
+	}
+}
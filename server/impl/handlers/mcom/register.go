@@ -6,9 +6,11 @@ import (
 
 	"gitlab.kenda.com.tw/kenda/mcom"
 	"gitlab.kenda.com.tw/kenda/mui/server/configs"
+	"gitlab.kenda.com.tw/kenda/mui/server/database"
 	accountImpl "gitlab.kenda.com.tw/kenda/mui/server/impl/handlers/mcom/account"
 	carrierImpl "gitlab.kenda.com.tw/kenda/mui/server/impl/handlers/mcom/carrier"
 	legacyImpl "gitlab.kenda.com.tw/kenda/mui/server/impl/handlers/mcom/legacy"
+	permissionImpl "gitlab.kenda.com.tw/kenda/mui/server/impl/handlers/mcom/permission"
 	planImpl "gitlab.kenda.com.tw/kenda/mui/server/impl/handlers/mcom/plan"
 	produceImpl "gitlab.kenda.com.tw/kenda/mui/server/impl/handlers/mcom/produce"
 	productImpl "gitlab.kenda.com.tw/kenda/mui/server/impl/handlers/mcom/product"
@@ -23,12 +25,18 @@ import (
 	workOrderImpl "gitlab.kenda.com.tw/kenda/mui/server/impl/handlers/mcom/workorder"
 
 	"gitlab.kenda.com.tw/kenda/mui/server/impl/service"
+	"gitlab.kenda.com.tw/kenda/mui/server/impl/utils/idrule"
+	"gitlab.kenda.com.tw/kenda/mui/server/impl/utils/lockout"
+	"gitlab.kenda.com.tw/kenda/mui/server/impl/utils/oee"
+	"gitlab.kenda.com.tw/kenda/mui/server/impl/utils/password"
 	"gitlab.kenda.com.tw/kenda/mui/server/impl/utils/role"
+	"gitlab.kenda.com.tw/kenda/mui/server/impl/utils/scale"
 
 	"gitlab.kenda.com.tw/kenda/mui/server/swagger/restapi/operations"
 	"gitlab.kenda.com.tw/kenda/mui/server/swagger/restapi/operations/account"
 	"gitlab.kenda.com.tw/kenda/mui/server/swagger/restapi/operations/carrier"
 	"gitlab.kenda.com.tw/kenda/mui/server/swagger/restapi/operations/legacy"
+	"gitlab.kenda.com.tw/kenda/mui/server/swagger/restapi/operations/permission"
 	"gitlab.kenda.com.tw/kenda/mui/server/swagger/restapi/operations/plan"
 	"gitlab.kenda.com.tw/kenda/mui/server/swagger/restapi/operations/produce"
 	"gitlab.kenda.com.tw/kenda/mui/server/swagger/restapi/operations/product"
@@ -48,6 +56,26 @@ type ServiceConfig struct {
 	FontPath              string
 	StationFunctionConfig map[string]configs.FunctionAPIPath
 	MesPath               string
+	PermissionManager     *role.Manager
+	SessionStore          database.SessionStore
+	LoginLockouts         *lockout.Tracker
+	TrustedProxies        utils.TrustedProxies
+	LockoutEventStore     database.LockoutEventStore
+	PasswordPolicy        password.Policy
+	PasswordStore         database.PasswordStore
+	CollectStore          database.CollectStore
+	FeedStore             database.FeedStore
+	DefectStore           database.DefectStore
+	IDRules               *idrule.Generator
+	Scales                *scale.Registry
+	SyncStore             database.SyncStore
+	HoldStore             database.HoldStore
+	RecordStore           database.RecordStore
+	StationLogStore       database.StationLogStore
+	WorkOrderImportStore  database.WorkOrderImportStore
+	WorkOrderStore        database.WorkOrderStore
+	Shifts                []oee.Shift
+	CycleTimeControl      string
 }
 
 // RegisterServices register rest api service.
@@ -55,41 +83,122 @@ func RegisterServices(dm mcom.DataManager, config ServiceConfig) (*service.Servi
 	if config.FontPath == "" {
 		return nil, fmt.Errorf("missing font path")
 	}
+	if config.PermissionManager == nil {
+		return nil, fmt.Errorf("missing permission manager")
+	}
+	if config.SessionStore == nil {
+		return nil, fmt.Errorf("missing session store")
+	}
+	if config.LoginLockouts == nil {
+		return nil, fmt.Errorf("missing login lockout tracker")
+	}
+	if config.LockoutEventStore == nil {
+		return nil, fmt.Errorf("missing lockout event store")
+	}
+	if config.PasswordStore == nil {
+		return nil, fmt.Errorf("missing password store")
+	}
+	if config.CollectStore == nil {
+		return nil, fmt.Errorf("missing collect store")
+	}
+	if config.FeedStore == nil {
+		return nil, fmt.Errorf("missing feed store")
+	}
+	if config.DefectStore == nil {
+		return nil, fmt.Errorf("missing defect store")
+	}
+	if config.IDRules == nil {
+		return nil, fmt.Errorf("missing id rules")
+	}
+	if config.Scales == nil {
+		return nil, fmt.Errorf("missing scales")
+	}
+	if config.SyncStore == nil {
+		return nil, fmt.Errorf("missing sync store")
+	}
+	if config.HoldStore == nil {
+		return nil, fmt.Errorf("missing hold store")
+	}
+	if config.RecordStore == nil {
+		return nil, fmt.Errorf("missing record store")
+	}
+	if config.StationLogStore == nil {
+		return nil, fmt.Errorf("missing station log store")
+	}
+	if config.WorkOrderImportStore == nil {
+		return nil, fmt.Errorf("missing work order import store")
+	}
+	if config.WorkOrderStore == nil {
+		return nil, fmt.Errorf("missing work order store")
+	}
 
-	workOrderService := workOrderImpl.NewWorkOrder(dm, role.HasPermission, workOrderImpl.Config{
+	workOrderService := workOrderImpl.NewWorkOrder(dm, config.PermissionManager.HasPermission, workOrderImpl.Config{
 		StationFunctionConfig: config.StationFunctionConfig,
+		Defects:               config.DefectStore,
+		Collects:              config.CollectStore,
+		Imports:               config.WorkOrderImportStore,
+		WorkOrders:            config.WorkOrderStore,
 	})
 
-	resourceService := resourceImpl.NewResource(dm, role.HasPermission, resourceImpl.Config{
+	resourceService := resourceImpl.NewResource(dm, config.PermissionManager.HasPermission, resourceImpl.Config{
 		Printers: config.Printers,
 		FontPath: config.FontPath,
+		IDRules:  config.IDRules,
+		Holds:    config.HoldStore,
 	})
 
-	produceService := produceImpl.NewProduce(dm, role.HasPermission, produceImpl.Config{
-		Printers: config.Printers,
-		FontPath: config.FontPath,
-		MesPath:  config.MesPath,
+	siteService := siteImpl.NewSite(dm, config.PermissionManager.HasPermission, siteImpl.Config{
+		StationFunctionConfig: config.StationFunctionConfig,
+		Holds:                 config.HoldStore,
 	})
 
-	siteService := siteImpl.NewSite(dm, role.HasPermission, siteImpl.Config{
-		StationFunctionConfig: config.StationFunctionConfig,
+	stationService := stationImpl.NewStation(dm, config.PermissionManager.HasPermission, stationImpl.Config{
+		Logs: config.StationLogStore,
+	})
+
+	produceService := produceImpl.NewProduce(dm, config.PermissionManager.HasPermission, produceImpl.Config{
+		Printers:          config.Printers,
+		FontPath:          config.FontPath,
+		MesPath:           config.MesPath,
+		Collects:          config.CollectStore,
+		Feeds:             config.FeedStore,
+		Defects:           config.DefectStore,
+		IDRules:           config.IDRules,
+		Scales:            config.Scales,
+		Syncs:             config.SyncStore,
+		Holds:             config.HoldStore,
+		Records:           config.RecordStore,
+		StationLogs:       config.StationLogStore,
+		Shifts:            config.Shifts,
+		CycleTimeControl:  config.CycleTimeControl,
+		BindSiteResources: siteService.AutoBindResource,
+		SignInStation:     stationService.StationForceSignIn,
 	})
 
 	return service.NewService(
-		accountImpl.NewAuthorization(dm, role.HasPermission, config.TokenLifeTime),
-		legacyImpl.NewLegacy(dm, role.HasPermission),
-		productImpl.NewProduct(dm, role.HasPermission),
-		planImpl.NewPlan(dm, role.HasPermission),
+		accountImpl.NewAuthorization(dm, config.PermissionManager.HasPermission, accountImpl.Config{
+			TokenLifeTime:  config.TokenLifeTime,
+			Sessions:       config.SessionStore,
+			Lockouts:       config.LoginLockouts,
+			TrustedProxies: config.TrustedProxies,
+			LockoutEvents:  config.LockoutEventStore,
+			PasswordPolicy: config.PasswordPolicy,
+			Passwords:      config.PasswordStore,
+		}),
+		legacyImpl.NewLegacy(dm, config.PermissionManager.HasPermission),
+		productImpl.NewProduct(dm, config.PermissionManager.HasPermission),
+		planImpl.NewPlan(dm, config.PermissionManager.HasPermission),
 		workOrderService,
-		stationImpl.NewStation(dm, role.HasPermission),
-		recipeImpl.NewRecipe(dm, role.HasPermission),
+		stationService,
+		recipeImpl.NewRecipe(dm, config.PermissionManager.HasPermission),
 		resourceService,
-		warehouseImpl.NewWarehouse(dm, role.HasPermission),
+		warehouseImpl.NewWarehouse(dm, config.PermissionManager.HasPermission),
 		siteService,
-		carrierImpl.NewCarrier(dm, role.HasPermission),
+		carrierImpl.NewCarrier(dm, config.PermissionManager.HasPermission),
 		produceService,
-		uiImpl.NewUI(dm, role.HasPermission),
-		unspecifiedImpl.NewUnspecified(dm, role.HasPermission),
+		uiImpl.NewUI(dm, config.PermissionManager.HasPermission),
+		unspecifiedImpl.NewUnspecified(dm, config.PermissionManager.HasPermission),
+		permissionImpl.NewPermission(config.PermissionManager, config.PermissionManager.HasPermission),
 	), nil
 }
 
@@ -112,6 +221,14 @@ func RegisterHandlers(dm mcom.DataManager, api *operations.MuiAPI, config Servic
 	api.AccountCreateAccountAuthorizationHandler = account.CreateAccountAuthorizationHandlerFunc(s.AccountAuthorization().CreateAccountAuthorization)
 	api.AccountUpdateAccountAuthorizationHandler = account.UpdateAccountAuthorizationHandlerFunc(s.AccountAuthorization().UpdateAccountAuthorization)
 	api.AccountDeleteAccountHandler = account.DeleteAccountHandlerFunc(s.AccountAuthorization().DeleteAccount)
+	api.AccountListPermissionsHandler = account.ListPermissionsHandlerFunc(s.AccountAuthorization().ListPermissions)
+	api.AccountListUserSessionsHandler = account.ListUserSessionsHandlerFunc(s.AccountAuthorization().ListUserSessions)
+	api.AccountRevokeUserSessionHandler = account.RevokeUserSessionHandlerFunc(s.AccountAuthorization().RevokeUserSession)
+	api.AccountRevokeUserSessionsHandler = account.RevokeUserSessionsHandlerFunc(s.AccountAuthorization().RevokeUserSessions)
+	api.AccountListLoginLockoutsHandler = account.ListLoginLockoutsHandlerFunc(s.AccountAuthorization().ListLoginLockouts)
+	api.AccountUnlockLoginLockoutHandler = account.UnlockLoginLockoutHandlerFunc(s.AccountAuthorization().UnlockLoginLockout)
+	api.AccountListLockoutEventsHandler = account.ListLockoutEventsHandlerFunc(s.AccountAuthorization().ListLockoutEvents)
+	api.AccountImportAccountsHandler = account.ImportAccountsHandlerFunc(s.AccountAuthorization().ImportAccounts)
 
 	// operations handler.
 	api.CheckServerStatusHandler = operations.CheckServerStatusHandlerFunc(utils.GetServerStatus)
@@ -143,7 +260,14 @@ func RegisterHandlers(dm mcom.DataManager, api *operations.MuiAPI, config Servic
 	api.WorkOrderUpdateStationSchedulingHandler = work_order.UpdateStationSchedulingHandlerFunc(s.WorkOrder().UpdateStationScheduling)
 	api.WorkOrderUpdateWorkOrderHandler = work_order.UpdateWorkOrderHandlerFunc(s.WorkOrder().UpdateWorkOrder)
 	api.WorkOrderCreateWorkOrdersFromFileHandler = work_order.CreateWorkOrdersFromFileHandlerFunc(s.WorkOrder().CreateWorkOrdersFromFile)
+	api.WorkOrderCommitWorkOrderImportHandler = work_order.CommitWorkOrderImportHandlerFunc(s.WorkOrder().CommitWorkOrderImport)
+	api.WorkOrderDownloadWorkOrderTemplateHandler = work_order.DownloadWorkOrderTemplateHandlerFunc(s.WorkOrder().DownloadWorkOrderTemplate)
 	api.WorkOrderListWorkOrdersRateHandler = work_order.ListWorkOrdersRateHandlerFunc(s.WorkOrder().ListWorkOrdersRate)
+	api.WorkOrderExportWorkOrdersHandler = work_order.ExportWorkOrdersHandlerFunc(s.WorkOrder().ExportWorkOrders)
+	api.WorkOrderExportStationSchedulingHandler = work_order.ExportStationSchedulingHandlerFunc(s.WorkOrder().ExportStationScheduling)
+	api.WorkOrderExportWorkOrdersRateHandler = work_order.ExportWorkOrdersRateHandlerFunc(s.WorkOrder().ExportWorkOrdersRate)
+	api.WorkOrderSplitWorkOrderHandler = work_order.SplitWorkOrderHandlerFunc(s.WorkOrder().SplitWorkOrder)
+	api.WorkOrderMergeWorkOrdersHandler = work_order.MergeWorkOrdersHandlerFunc(s.WorkOrder().MergeWorkOrders)
 
 	// station handlers.
 	api.StationGetStationListHandler = station.GetStationListHandlerFunc(s.Station().GetStationList)
@@ -156,6 +280,7 @@ func RegisterHandlers(dm mcom.DataManager, api *operations.MuiAPI, config Servic
 	api.StationListStationsHandler = station.ListStationsHandlerFunc(s.Station().ListStations)
 	api.StationStationForceSignInHandler = station.StationForceSignInHandlerFunc(s.Station().StationForceSignIn)
 	api.StationStationSignOutHandler = station.StationSignOutHandlerFunc(s.Station().StationSignOut)
+	api.StationCreateStationDowntimeHandler = station.CreateStationDowntimeHandlerFunc(s.Station().CreateStationDowntime)
 
 	// recipe handlers.
 	api.RecipeGetRecipeListHandler = recipe.GetRecipeListHandlerFunc(s.Recipe().GetRecipeList)
@@ -196,6 +321,18 @@ func RegisterHandlers(dm mcom.DataManager, api *operations.MuiAPI, config Servic
 	api.ProduceFeedCollectHandler = produce.FeedCollectHandlerFunc(s.Produce().FeedCollect)
 	api.ProduceMesFeedHandler = produce.MesFeedHandlerFunc(s.Produce().MesFeed)
 	api.ProduceMesCollectHandler = produce.MesCollectHandlerFunc(s.Produce().MesCollect)
+	api.ProduceReverseCollectHandler = produce.ReverseCollectHandlerFunc(s.Produce().ReverseCollect)
+	api.ProduceUnfeedHandler = produce.UnfeedHandlerFunc(s.Produce().Unfeed)
+	api.ProduceListDefectReasonsHandler = produce.ListDefectReasonsHandlerFunc(s.Produce().ListDefectReasons)
+	api.ProduceCreateDefectReasonHandler = produce.CreateDefectReasonHandlerFunc(s.Produce().CreateDefectReason)
+	api.ProduceUpdateDefectReasonHandler = produce.UpdateDefectReasonHandlerFunc(s.Produce().UpdateDefectReason)
+	api.ProduceSyncOperationsHandler = produce.SyncOperationsHandlerFunc(s.Produce().SyncOperations)
+	api.ProduceGetScaleWeightHandler = produce.GetScaleWeightHandlerFunc(s.Produce().GetScaleWeight)
+	api.ProduceListFeedRecordsHandler = produce.ListFeedRecordsHandlerFunc(s.Produce().ListFeedRecords)
+	api.ProduceListCollectRecordsHandler = produce.ListCollectRecordsHandlerFunc(s.Produce().ListCollectRecords)
+	api.ProduceTraceResourcesHandler = produce.TraceResourcesHandlerFunc(s.Produce().TraceResources)
+	api.ProduceExportTraceHandler = produce.ExportTraceHandlerFunc(s.Produce().ExportTrace)
+	api.ProduceGetStationOEEHandler = produce.GetStationOEEHandlerFunc(s.Produce().GetStationOEE)
 
 	// ui handlers.
 	api.UISetStationConfigHandler = ui.SetStationConfigHandlerFunc(s.UI().SetStationConfig)
@@ -205,6 +342,13 @@ func RegisterHandlers(dm mcom.DataManager, api *operations.MuiAPI, config Servic
 	// unspecified handlers
 	api.UnspecifiedListDepartmentIDsHandler = unspecified.ListDepartmentIDsHandlerFunc(s.Unspecified().ListDepartmentIDs)
 
+	// permission handlers.
+	api.PermissionListRolePermissionsHandler = permission.ListRolePermissionsHandlerFunc(s.Permission().ListRolePermissions)
+	api.PermissionCreateRolePermissionHandler = permission.CreateRolePermissionHandlerFunc(s.Permission().CreateRolePermission)
+	api.PermissionUpdateRolePermissionHandler = permission.UpdateRolePermissionHandlerFunc(s.Permission().UpdateRolePermission)
+	api.PermissionDeleteRolePermissionHandler = permission.DeleteRolePermissionHandlerFunc(s.Permission().DeleteRolePermission)
+	api.PermissionListRolePermissionChangesHandler = permission.ListRolePermissionChangesHandlerFunc(s.Permission().ListRolePermissionChanges)
+
 	// operations handler.
 	api.CheckServerStatusHandler = operations.CheckServerStatusHandlerFunc(utils.GetServerStatus)
 
@@ -1,6 +1,7 @@
 package resource
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"time"
@@ -15,19 +16,31 @@ import (
 	mcomModels "gitlab.kenda.com.tw/kenda/mcom/impl/orm/models"
 	resources "gitlab.kenda.com.tw/kenda/mcom/utils/resources"
 
+	"gitlab.kenda.com.tw/kenda/mui/server/database"
 	"gitlab.kenda.com.tw/kenda/mui/server/impl/handlers/mcom/internal/printer"
 	handlerUtils "gitlab.kenda.com.tw/kenda/mui/server/impl/handlers/mcom/utils"
 	"gitlab.kenda.com.tw/kenda/mui/server/impl/handlers/mcom/utils/barcodes"
 	"gitlab.kenda.com.tw/kenda/mui/server/impl/service"
 	"gitlab.kenda.com.tw/kenda/mui/server/impl/utils"
+	"gitlab.kenda.com.tw/kenda/mui/server/impl/utils/idrule"
+	"gitlab.kenda.com.tw/kenda/mui/server/impl/utils/saga"
 	"gitlab.kenda.com.tw/kenda/mui/server/protobuf/kenda"
 	"gitlab.kenda.com.tw/kenda/mui/server/swagger/models"
 	"gitlab.kenda.com.tw/kenda/mui/server/swagger/restapi/operations/resource"
 )
 
+// holdCompensationReason is the remark of the resources deactivated since
+// they could not be held.
+const holdCompensationReason = "aging hold failed"
+
 type Config struct {
 	Printers map[string]string
 	FontPath string
+	// IDRules generates the lot numbers and the resource IDs.
+	IDRules *idrule.Generator
+	// Holds keeps the created resources until their minimum aging times
+	// elapse.
+	Holds database.HoldStore
 }
 
 // Resource definitions
@@ -72,6 +85,16 @@ func (r Resource) AddMaterial(params resource.AddMaterialParams, principal *mode
 		})
 	}
 
+	ctx := commonsCtx.WithUserID(params.HTTPRequest.Context(), principal.ID)
+	resourceID, err := r.config.IDRules.ResourceID(ctx, idrule.Values{
+		Time:        time.Now(),
+		ProductID:   *params.Body.Resource.ProductID,
+		ProductType: *params.Body.Resource.ProductType,
+	})
+	if err != nil {
+		return utils.ParseError(ctx, resource.NewAddMaterialDefault(0), err)
+	}
+
 	req := mcom.CreateMaterialResourcesRequest{
 		Materials: []mcom.CreateMaterialResourcesRequestDetail{
 			{
@@ -82,13 +105,13 @@ func (r Resource) AddMaterial(params resource.AddMaterialParams, principal *mode
 				Quantity:       quantity,
 				Unit:           *params.Body.Resource.Unit,
 				LotNumber:      *params.Body.Resource.LotNumber,
+				ResourceID:     resourceID,
 				ProductionTime: time.Time(*params.Body.Resource.ProductionTime),
 				ExpiryTime:     time.Time(*params.Body.Resource.ExpiryTime),
 			},
 		},
 	}
 
-	ctx := commonsCtx.WithUserID(params.HTTPRequest.Context(), principal.ID)
 	resourceIDs, err := r.dm.CreateMaterialResources(ctx, req,
 		mcom.WithStockIn(mcom.Warehouse{
 			ID:       *params.Body.Warehouse.ID,
@@ -324,32 +347,69 @@ func (r Resource) DownloadPreMaterialResource(params resource.DownloadPreMateria
 			},
 		)
 	}
-	resources, err := r.dm.CreateMaterialResources(ctx, mcom.CreateMaterialResourcesRequest{
-		Materials: []mcom.CreateMaterialResourcesRequestDetail{
-			{
-				Type:            getWorkOrder.Product.Type,
-				ID:              getWorkOrder.Product.ID,
-				Grade:           "",
-				Status:          resources.MaterialStatus_AVAILABLE,
-				Quantity:        decimal.Zero,
-				PlannedQuantity: batchQuantityDetails.PlanQuantity,
-				Station:         getWorkOrder.Station,
-				Unit:            getWorkOrder.Unit,
-				LotNumber:       "",
-				ProductionTime:  now,
-				ExpiryTime:      expiryTime,
-				ResourceID:      "",
-				MinDosage:       decimal.Decimal{},
-				Inspections:     []mcomModels.Inspection{},
-				Remark:          "",
-				CarrierID:       "",
-			},
-		},
+	lotNumber, resourceID, err := r.generateIDs(ctx, idrule.Values{
+		Time:        now,
+		Station:     getWorkOrder.Station,
+		ProductID:   getWorkOrder.Product.ID,
+		ProductType: getWorkOrder.Product.Type,
 	})
 	if err != nil {
 		return utils.ParseError(ctx, resource.NewDownloadPreMaterialResourceDefault(0), err)
 	}
 
+	var created mcom.CreateMaterialResourcesReply
+	steps := []saga.Step{{
+		Name: "CREATE_RESOURCE",
+		Do: func(ctx context.Context) error {
+			var err error
+			created, err = r.dm.CreateMaterialResources(ctx, mcom.CreateMaterialResourcesRequest{
+				Materials: []mcom.CreateMaterialResourcesRequestDetail{
+					{
+						Type:            getWorkOrder.Product.Type,
+						ID:              getWorkOrder.Product.ID,
+						Grade:           "",
+						Status:          resources.MaterialStatus_AVAILABLE,
+						Quantity:        decimal.Zero,
+						PlannedQuantity: batchQuantityDetails.PlanQuantity,
+						Station:         getWorkOrder.Station,
+						Unit:            getWorkOrder.Unit,
+						LotNumber:       lotNumber,
+						ProductionTime:  now,
+						ExpiryTime:      expiryTime,
+						ResourceID:      resourceID,
+						MinDosage:       decimal.Decimal{},
+						Inspections:     []mcomModels.Inspection{},
+						Remark:          "",
+						CarrierID:       "",
+					},
+				},
+			})
+			return err
+		},
+		// the created resource can not be removed, it is left unavailable so
+		// that it is never bound before it has aged.
+		Compensate: func(ctx context.Context) error {
+			return r.dm.UpdateMaterialResource(ctx, mcom.UpdateMaterialResourceRequest{
+				ResourceID:  created[0].ID,
+				ProductType: getWorkOrder.Product.Type,
+				Status:      resources.MaterialStatus_UNAVAILABLE,
+				Quantity:    decimal.Zero,
+				Remark:      holdCompensationReason,
+			})
+		},
+	}}
+	if getLimitaryHour.LimitaryHour.Min > 0 {
+		steps = append(steps, saga.Step{
+			Name: "HOLD_RESOURCE",
+			Do: func(ctx context.Context) error {
+				return r.config.Holds.CreateAgingHolds(ctx, handlerUtils.AgingHolds(now, getLimitaryHour.LimitaryHour, getWorkOrder.Product.Type, created[0].ID))
+			},
+		})
+	}
+	if err := saga.Run(ctx, steps...); err != nil {
+		return utils.ParseError(ctx, resource.NewDownloadPreMaterialResourceDefault(0), handlerUtils.ParseSagaError(err))
+	}
+
 	//Print
 	printData := printer.PrintData{
 		StationID:      getWorkOrder.Station,
@@ -358,7 +418,7 @@ func (r Resource) DownloadPreMaterialResource(params resource.DownloadPreMateria
 		ProductionDate: now,
 		ExpiryDate:     expiryTime,
 		Quantity:       batchQuantityDetails.PlanQuantity,
-		ResourceID:     resources[0].ID,
+		ResourceID:     created[0].ID,
 	}
 
 	f, err := printer.CreateResourcesPDF(ctx, *params.Body.FieldName, printData, barcodes.Code39{}, r.config.FontPath)
@@ -370,6 +430,32 @@ func (r Resource) DownloadPreMaterialResource(params resource.DownloadPreMateria
 	return resource.NewDownloadPreMaterialResourceOK().WithPayload(f)
 }
 
+// generateIDs generates the lot number and the resource ID by the rules
+// configured for the values, or empty if not configured. The station code is
+// looked up only if any rule is configured.
+func (r Resource) generateIDs(ctx context.Context, v idrule.Values) (lotNumber, resourceID string, err error) {
+	hasLotNumber, hasResourceID := r.config.IDRules.Has(v)
+	if !hasLotNumber && !hasResourceID {
+		return "", "", nil
+	}
+
+	station, err := r.dm.GetStation(ctx, mcom.GetStationRequest{ID: v.Station})
+	if err != nil {
+		return "", "", err
+	}
+	v.StationCode = station.Information.Code
+
+	if hasLotNumber {
+		if lotNumber, err = r.config.IDRules.LotNumber(ctx, v); err != nil {
+			return "", "", err
+		}
+	}
+	if resourceID, err = r.config.IDRules.ResourceID(ctx, v); err != nil {
+		return "", "", err
+	}
+	return lotNumber, resourceID, nil
+}
+
 func parseResourceMaterials(replies []mcom.MaterialReply) models.ResourceMaterials {
 	resources := make(models.ResourceMaterials, len(replies))
 	for i, resourceReply := range replies {
@@ -1,6 +1,7 @@
 package resource
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net/http"
@@ -24,6 +25,7 @@ import (
 
 	"gitlab.kenda.com.tw/kenda/mui/server/impl/handlers/mcom/account"
 	"gitlab.kenda.com.tw/kenda/mui/server/impl/service"
+	"gitlab.kenda.com.tw/kenda/mui/server/impl/utils/idrule"
 	"gitlab.kenda.com.tw/kenda/mui/server/protobuf/kenda"
 	"gitlab.kenda.com.tw/kenda/mui/server/swagger/models"
 	"gitlab.kenda.com.tw/kenda/mui/server/swagger/restapi/operations/resource"
@@ -161,6 +163,80 @@ func TestResource_AddMaterial(t *testing.T) {
 		}
 		assert.NoError(dm.Close())
 	}
+	{ // resource ID by the rule of the product type
+		scripts := []mock.Script{
+			{
+				Name: mock.FuncCreateMaterialResources,
+				Input: mock.Input{
+					Request: mcom.CreateMaterialResourcesRequest{
+						Materials: []mcom.CreateMaterialResourcesRequestDetail{
+							{
+								Type:           testProductType,
+								ID:             testProductID,
+								Grade:          testProductGrade,
+								Status:         resources.MaterialStatus_INSPECTION,
+								Quantity:       testQuantityDecimal,
+								Unit:           testUnit,
+								LotNumber:      testLotNumber,
+								ResourceID:     "BAN-0001",
+								ProductionTime: testProductionDate,
+								ExpiryTime:     testExpirationDate,
+							},
+						},
+					},
+					Options: []interface{}{
+						mcom.WithStockIn(mcom.Warehouse{ID: testWarehouse, Location: testLocation}),
+					},
+				},
+				Output: mock.Output{
+					Response: mcom.CreateMaterialResourcesReply{
+						{
+							ID: "BAN-0001",
+						},
+					},
+				},
+			},
+		}
+		dm, err := mock.New(scripts)
+		assert.NoError(err)
+
+		rules, err := idrule.NewGenerator(idrule.Config{
+			ProductTypes: map[string]idrule.Patterns{
+				testProductType: {ResourceID: "{product}-{seq:4}"},
+			},
+		}, counter{})
+		assert.NoError(err)
+		r := NewResource(dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
+			return true
+		}, Config{FontPath: "fake-path", IDRules: rules})
+		rep, ok := r.AddMaterial(resource.AddMaterialParams{
+			HTTPRequest: httpRequestWithHeader,
+			Body: resource.AddMaterialBody{
+				Resource: &models.ProductInfo{
+					ExpiryTime:     &expiredDate,
+					Grade:          &testProductGrade,
+					LotNumber:      &testLotNumber,
+					ProductID:      &testProductID,
+					ProductType:    &testProductType,
+					ProductionTime: &productDate,
+					Quantity:       &testQuantity,
+					Unit:           &testUnit,
+				},
+				Warehouse: &models.Warehouse{
+					ID:       &testWarehouse,
+					Location: &testLocation,
+				},
+			},
+		}, principal).(*resource.AddMaterialOK)
+		if assert.True(ok) {
+			assert.Equal(resource.NewAddMaterialOK().WithPayload(&resource.AddMaterialOKBody{
+				Data: &resource.AddMaterialOKBodyData{
+					ResourceID: "BAN-0001",
+				},
+			}), rep)
+		}
+		assert.NoError(dm.Close())
+	}
 	{ // invalid number
 		dm, err := mock.New([]mock.Script{})
 		assert.NoError(err)
@@ -1141,6 +1217,17 @@ func mustNewResource(
 	dm mcom.DataManager,
 	hasPermission func(id kenda.FunctionOperationID, roles []models.Role) bool,
 ) service.Resource {
-	s := NewResource(dm, hasPermission, Config{FontPath: "fake-path"})
+	rules, err := idrule.NewGenerator(idrule.Config{}, nil)
+	if err != nil {
+		panic(err)
+	}
+	s := NewResource(dm, hasPermission, Config{FontPath: "fake-path", IDRules: rules})
 	return s
 }
+
+type counter map[string]int64
+
+func (c counter) Next(_ context.Context, key string) (int64, error) {
+	c[key]++
+	return c[key], nil
+}
@@ -20,9 +20,11 @@ import (
 	"gitlab.kenda.com.tw/kenda/mcom/utils/types"
 
 	"gitlab.kenda.com.tw/kenda/mui/server/configs"
+	"gitlab.kenda.com.tw/kenda/mui/server/database"
 	handlerUtils "gitlab.kenda.com.tw/kenda/mui/server/impl/handlers/mcom/utils"
 	"gitlab.kenda.com.tw/kenda/mui/server/impl/service"
 	"gitlab.kenda.com.tw/kenda/mui/server/impl/utils"
+	"gitlab.kenda.com.tw/kenda/mui/server/impl/utils/saga"
 	mesageModels "gitlab.kenda.com.tw/kenda/mui/server/models"
 	"gitlab.kenda.com.tw/kenda/mui/server/protobuf/kenda"
 	"gitlab.kenda.com.tw/kenda/mui/server/swagger/models"
@@ -38,6 +40,8 @@ type Site struct {
 
 type Config struct {
 	StationFunctionConfig map[string]configs.FunctionAPIPath
+	// Holds keeps the resources until their minimum aging times elapse.
+	Holds database.HoldStore
 }
 
 // NewSite initialize Site.
@@ -112,12 +116,14 @@ func (s Site) AutoBindResource(params site.AutoBindSiteResourcesParams, principa
 		Material  = int64(0)
 		Tool      = int64(1)
 		forceBind = false
+		reason    = ""
 
 		recipeConfig = mcom.RecipeProcessConfig{}
 	)
 
 	if params.Body.ForceBind != nil {
 		forceBind = params.Body.ForceBind.Force
+		reason = params.Body.ForceBind.Reason
 	}
 
 	// if work order not empty & bind type not clear
@@ -176,6 +182,7 @@ func (s Site) AutoBindResource(params site.AutoBindSiteResourcesParams, principa
 		}
 
 		materialList := []*mesageModels.SiteBindingStateResourcesItems0{}
+		var holds []database.AgingHold
 
 		// if bind is clear, not to find material data
 		if bindClearCheck(bindtype.BindType(*params.Body.BindType)) {
@@ -191,6 +198,11 @@ func (s Site) AutoBindResource(params site.AutoBindSiteResourcesParams, principa
 			}
 			detail.Resources = bindMaterials
 
+			holds, err = handlerUtils.CheckAgingHolds(ctx, s.config.Holds, bindMaterials, forceBind, reason)
+			if err != nil {
+				return utils.ParseError(ctx, site.NewAutoBindSiteResourcesDefault(0), err)
+			}
+
 			if params.Body.WorkOrderID != "" && !forceBind {
 
 				// if material not in recipe,return error
@@ -207,9 +219,21 @@ func (s Site) AutoBindResource(params site.AutoBindSiteResourcesParams, principa
 			detail.Resources = []mcom.BindMaterialResource{}
 		}
 
+		// the holds are released before the bind, and restored if the bind
+		// fails, so that no resource in aging is bound unreleased.
+		if len(holds) != 0 {
+			if err := s.config.Holds.ReleaseAgingHolds(ctx, holds, principal.ID, reason); err != nil {
+				return utils.ParseError(ctx, site.NewAutoBindSiteResourcesDefault(0), err)
+			}
+		}
 		if err := s.dm.MaterialResourceBindV2(ctx, mcom.MaterialResourceBindRequestV2{
 			Details: []mcom.MaterialBindRequestDetailV2{detail},
 		}); err != nil {
+			if len(holds) != 0 {
+				if err := s.config.Holds.RestoreAgingHolds(saga.Detach(ctx), holds); err != nil {
+					commonsCtx.Logger(ctx).Error("failed to restore the aging holds", zap.Error(err))
+				}
+			}
 			return utils.ParseError(ctx, site.NewAutoBindSiteResourcesDefault(0), err)
 		}
 
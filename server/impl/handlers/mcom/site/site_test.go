@@ -1,6 +1,7 @@
 package site
 
 import (
+	"context"
 	"errors"
 	"net/http"
 	"net/http/httptest"
@@ -22,6 +23,8 @@ import (
 	mcomSites "gitlab.kenda.com.tw/kenda/mcom/utils/sites"
 	"gitlab.kenda.com.tw/kenda/mcom/utils/types"
 
+	"gitlab.kenda.com.tw/kenda/mui/server/database"
+	"gitlab.kenda.com.tw/kenda/mui/server/database/storetest"
 	"gitlab.kenda.com.tw/kenda/mui/server/impl/handlers/mcom/account"
 	"gitlab.kenda.com.tw/kenda/mui/server/impl/service"
 	"gitlab.kenda.com.tw/kenda/mui/server/protobuf/kenda"
@@ -81,10 +84,11 @@ var (
 )
 
 func mustNewSite(
+	t *testing.T,
 	dm mcom.DataManager,
 	hasPermission func(id kenda.FunctionOperationID, roles []models.Role) bool,
 ) service.Site {
-	s := NewSite(dm, hasPermission, Config{})
+	s := NewSite(dm, hasPermission, Config{Holds: storetest.New(t).Holds})
 	return s
 }
 
@@ -217,7 +221,7 @@ func TestSite_GetSiteMaterialList(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			s := mustNewSite(dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
+			s := mustNewSite(t, dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
 				return true
 			})
 			if got := s.GetSiteMaterialList(tt.args.params, tt.args.principal); !reflect.DeepEqual(got, tt.want) {
@@ -229,7 +233,7 @@ func TestSite_GetSiteMaterialList(t *testing.T) {
 	{ // forbidden access
 		dm, err := mock.New(nil)
 		assert.NoError(err)
-		s := mustNewSite(dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
+		s := mustNewSite(t, dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
 			return false
 		})
 		rep, ok := s.GetSiteMaterialList(site.GetSiteMaterialListParams{
@@ -2896,7 +2900,7 @@ func TestSite_AutoBindResource(t *testing.T) {
 			dm, err := mock.New(tt.script)
 			assert.NoErrorf(err, tt.name)
 
-			s := mustNewSite(dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
+			s := mustNewSite(t, dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
 				return true
 			})
 			if got := s.AutoBindResource(tt.args.params, tt.args.principal); !assert.Equal(got, tt.want) {
@@ -2907,7 +2911,7 @@ func TestSite_AutoBindResource(t *testing.T) {
 	}
 	{ // forbidden access
 		dm, _ := mock.New(nil)
-		s := mustNewSite(dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
+		s := mustNewSite(t, dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
 			return false
 		})
 		rep, ok := s.AutoBindResource(site.AutoBindSiteResourcesParams{
@@ -2931,6 +2935,164 @@ func TestSite_AutoBindResource(t *testing.T) {
 	}
 }
 
+func TestSite_AutoBindResource_agingHolds(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	httpRequest := httptest.NewRequest("POST", "/site/resources/bind/auto", nil)
+	params := site.AutoBindSiteResourcesParams{
+		HTTPRequest: httpRequest,
+		Body: site.AutoBindSiteResourcesBody{
+			Station:   &station,
+			BindType:  &bindTypeColQueueAdd,
+			SiteIndex: &siteIndex64,
+			SiteName:  &siteName,
+			Resources: []*models.BindResource{
+				{
+					ProductType: testProductType1,
+					ResourceID:  testResource1ID,
+				},
+			},
+			ForceBind: &site.AutoBindSiteResourcesParamsBodyForceBind{
+				Force:  true,
+				Reason: "urgent",
+			},
+		},
+	}
+	newScript := func(bindErr error) []mock.Script {
+		return []mock.Script{
+			{
+				Name: mock.FuncGetSite,
+				Input: mock.Input{
+					Request: mcom.GetSiteRequest{
+						StationID: station,
+						SiteName:  siteName,
+						SiteIndex: siteIndex,
+					},
+				},
+				Output: mock.Output{
+					Response: mcom.GetSiteReply{
+						Name:  siteName,
+						Index: siteIndex,
+						Attributes: mcom.SiteAttributes{
+							Type:    mcomSites.Type_COLQUEUE,
+							SubType: mcomSites.SubType_MATERIAL,
+							LimitHandler: func(string) error {
+								return nil
+							},
+						},
+						Content: mcomModels.SiteContent{
+							Colqueue: &mcomModels.Colqueue{},
+						},
+					},
+				},
+			},
+			{
+				Name: mock.FuncListMaterialResourceIdentities,
+				Input: mock.Input{
+					Request: mcom.ListMaterialResourceIdentitiesRequest{
+						Details: []mcom.GetMaterialResourceIdentityRequest{{
+							ResourceID:  testResource1ID,
+							ProductType: testProductType1,
+						}},
+					},
+				},
+				Output: mock.Output{
+					Response: mcom.ListMaterialResourceIdentitiesReply{
+						Replies: []*mcom.MaterialReply{{
+							Material: mcom.Material{
+								Type:       testProductType1,
+								ID:         testProductID,
+								Grade:      testProductGrade,
+								Status:     resources.MaterialStatus_AVAILABLE,
+								Quantity:   decimal.RequireFromString("200"),
+								ExpiryTime: testExpiryTime,
+								ResourceID: testResource1ID,
+							},
+							Warehouse: mcom.Warehouse{
+								ID:       testWarehouseID,
+								Location: testWarehouseLocation,
+							},
+						}},
+					},
+				},
+			},
+			{
+				Name: mock.FuncMaterialResourceBindV2,
+				Input: mock.Input{
+					Request: mcom.MaterialResourceBindRequestV2{
+						Details: []mcom.MaterialBindRequestDetailV2{{
+							Type: bindtype.BindType_RESOURCE_BINDING_COLQUEUE_ADD,
+							Site: mcomModels.UniqueSite{
+								Station: station,
+								SiteID: mcomModels.SiteID{
+									Name:  siteName,
+									Index: siteIndex,
+								},
+							},
+							Resources: []mcom.BindMaterialResource{{
+								Material: mcomModels.Material{
+									ID:    testProductID,
+									Grade: testProductGrade,
+								},
+								ResourceID:  testResource1ID,
+								ProductType: testProductType1,
+								Warehouse: mcom.Warehouse{
+									ID:       testWarehouseID,
+									Location: testWarehouseLocation,
+								},
+								ExpiryTime: types.ToTimeNano(testExpiryTime),
+								Status:     resources.MaterialStatus_AVAILABLE,
+							}},
+						}},
+					},
+				},
+				Output: mock.Output{
+					Error: bindErr,
+				},
+			},
+		}
+	}
+	allow := func(id kenda.FunctionOperationID, roles []models.Role) bool {
+		return true
+	}
+
+	{ // bind failed, the holds are restored.
+		stores := storetest.New(t)
+		assert.NoError(stores.Holds.CreateAgingHolds(ctx, []database.AgingHold{{
+			ResourceID:  testResource1ID,
+			ProductType: testProductType1,
+			Until:       time.Now().Add(time.Hour),
+		}}))
+		dm, err := mock.New(newScript(errors.New(testInternalServerError)))
+		assert.NoError(err)
+		s := NewSite(dm, allow, Config{Holds: stores.Holds})
+		assert.Equal(site.NewAutoBindSiteResourcesDefault(http.StatusInternalServerError).WithPayload(&models.Error{
+			Details: testInternalServerError,
+		}), s.AutoBindResource(params, principal))
+		holds, err := stores.Holds.ListActiveAgingHolds(ctx, time.Now(), []string{testResource1ID})
+		assert.NoError(err)
+		assert.Len(holds, 1)
+		assert.NoError(dm.Close())
+	}
+	{ // bound, the holds are released.
+		stores := storetest.New(t)
+		assert.NoError(stores.Holds.CreateAgingHolds(ctx, []database.AgingHold{{
+			ResourceID:  testResource1ID,
+			ProductType: testProductType1,
+			Until:       time.Now().Add(time.Hour),
+		}}))
+		dm, err := mock.New(newScript(nil))
+		assert.NoError(err)
+		s := NewSite(dm, allow, Config{Holds: stores.Holds})
+		assert.Equal(site.NewAutoBindSiteResourcesOK(), s.AutoBindResource(params, principal))
+		holds, err := stores.Holds.ListActiveAgingHolds(ctx, time.Now(), []string{testResource1ID})
+		assert.NoError(err)
+		assert.Empty(holds)
+		assert.NoError(dm.Close())
+	}
+}
+
 func TestSite_ListSubType(t *testing.T) {
 	assert := assert.New(t)
 	dm, err := mock.New([]mock.Script{
@@ -3039,7 +3201,7 @@ func TestSite_ListSubType(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			s := mustNewSite(dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
+			s := mustNewSite(t, dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
 				return true
 			})
 			if got := s.ListSubType(tt.args.params, tt.args.principal); !reflect.DeepEqual(got, tt.want) {
@@ -3049,7 +3211,7 @@ func TestSite_ListSubType(t *testing.T) {
 	}
 	assert.NoError(dm.Close())
 	{ // forbidden access
-		s := mustNewSite(dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
+		s := mustNewSite(t, dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
 			return false
 		})
 		rep, ok := s.ListSubType(site.GetSiteSubTypeListParams{
@@ -3184,7 +3346,7 @@ func TestSite_ListType(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			s := mustNewSite(dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
+			s := mustNewSite(t, dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
 				return true
 			})
 			if got := s.ListType(tt.args.params, tt.args.principal); !reflect.DeepEqual(got, tt.want) {
@@ -3194,7 +3356,7 @@ func TestSite_ListType(t *testing.T) {
 	}
 	assert.NoError(dm.Close())
 	{ // forbidden access
-		s := mustNewSite(dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
+		s := mustNewSite(t, dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
 			return false
 		})
 		rep, ok := s.ListType(site.GetSiteTypeListParams{
@@ -3487,7 +3649,7 @@ func TestStation_GetStationOperator(t *testing.T) {
 			dm, err := mock.New(tt.script)
 			assert.NoErrorf(err, tt.name)
 
-			s := mustNewSite(dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
+			s := mustNewSite(t, dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
 				return true
 			})
 			if got := s.GetStationOperator(tt.args.params, tt.args.principal); !assert.Equal(got, tt.want) {
@@ -3500,7 +3662,7 @@ func TestStation_GetStationOperator(t *testing.T) {
 
 	{ // forbidden access
 		dm, _ := mock.New([]mock.Script{})
-		s := mustNewSite(dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
+		s := mustNewSite(t, dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
 			return false
 		})
 		rep, ok := s.GetStationOperator(site.GetStationOperatorParams{
@@ -6,13 +6,16 @@ import (
 
 	"github.com/go-openapi/runtime/middleware"
 	"github.com/go-openapi/strfmt"
+	"go.uber.org/zap"
 
 	commonsCtx "gitlab.kenda.com.tw/kenda/commons/v2/utils/context"
 	"gitlab.kenda.com.tw/kenda/mcom"
+	mcomErrors "gitlab.kenda.com.tw/kenda/mcom/errors"
 	mcomModels "gitlab.kenda.com.tw/kenda/mcom/impl/orm/models"
 	mcomSites "gitlab.kenda.com.tw/kenda/mcom/utils/sites"
 	"gitlab.kenda.com.tw/kenda/mcom/utils/stations"
 
+	"gitlab.kenda.com.tw/kenda/mui/server/database"
 	"gitlab.kenda.com.tw/kenda/mui/server/impl/service"
 	"gitlab.kenda.com.tw/kenda/mui/server/impl/utils"
 	"gitlab.kenda.com.tw/kenda/mui/server/protobuf/kenda"
@@ -25,19 +28,29 @@ var toActionType = map[models.SiteActionMode]mcomSites.ActionType{
 	models.SiteActionMode(2): mcomSites.ActionType_REMOVE,
 }
 
+// Config definitions.
+type Config struct {
+	// Logs keeps the sign-ins and the downtimes of the stations for the OEE.
+	Logs database.StationLogStore
+}
+
 // Station definitions.
 type Station struct {
 	dm mcom.DataManager
 
+	config Config
+
 	hasPermission func(id kenda.FunctionOperationID, roles []models.Role) bool
 }
 
 // NewStation returns Station service.
 func NewStation(
 	dm mcom.DataManager,
-	hasPermission func(id kenda.FunctionOperationID, roles []models.Role) bool) service.Station {
+	hasPermission func(id kenda.FunctionOperationID, roles []models.Role) bool,
+	config Config) service.Station {
 	return Station{
 		dm:            dm,
+		config:        config,
 		hasPermission: hasPermission,
 	}
 }
@@ -333,6 +346,21 @@ func (s Station) StationForceSignIn(params station.StationForceSignInParams, pri
 	if err != nil {
 		return utils.ParseError(ctx, station.NewStationForceSignInDefault(0), err)
 	}
+
+	// the sign-in has been done, a failure of the log only affects the OEE.
+	if err := s.config.Logs.SignInStation(ctx, database.StationSignIn{
+		Station:    params.StationID,
+		SiteName:   params.Body.SiteName,
+		Group:      int16(params.Body.Group),
+		WorkDate:   time.Time(params.Body.WorkDate),
+		CreatedBy:  principal.ID,
+		SignedInAt: time.Now(),
+	}); err != nil {
+		zap.L().Error("failed to log the station sign-in",
+			zap.String("station", params.StationID),
+			zap.String("site", params.Body.SiteName),
+			zap.Error(err))
+	}
 	return station.NewStationForceSignInOK()
 }
 
@@ -344,6 +372,7 @@ func (s Station) StationSignOut(params station.StationSignOutParams, principal *
 
 	ctx := commonsCtx.WithUserID(params.HTTPRequest.Context(), principal.ID)
 	sites := make([]mcomModels.UniqueSite, len(params.Body.StationSites))
+	logSites := make([]database.StationSite, len(params.Body.StationSites))
 	for i, stationSite := range params.Body.StationSites {
 		sites[i] = mcomModels.UniqueSite{
 			Station: stationSite.StationID,
@@ -352,6 +381,10 @@ func (s Station) StationSignOut(params station.StationSignOutParams, principal *
 				Index: 0,
 			},
 		}
+		logSites[i] = database.StationSite{
+			Station:  stationSite.StationID,
+			SiteName: stationSite.SiteName,
+		}
 	}
 	err := s.dm.SignOutStations(ctx, mcom.SignOutStationsRequest{
 		Sites: sites,
@@ -360,9 +393,52 @@ func (s Station) StationSignOut(params station.StationSignOutParams, principal *
 		return utils.ParseError(ctx, station.NewStationSignOutDefault(0), err)
 	}
 
+	if err := s.config.Logs.SignOutStations(ctx, logSites, time.Now()); err != nil {
+		zap.L().Error("failed to log the station sign-out", zap.Error(err))
+	}
+
 	return station.NewStationSignOutOK()
 }
 
+// CreateStationDowntime implements.
+func (s Station) CreateStationDowntime(params station.CreateStationDowntimeParams, principal *models.Principal) middleware.Responder {
+	if !s.hasPermission(kenda.FunctionOperationID_CREATE_STATION_DOWNTIME, principal.Roles) {
+		return station.NewCreateStationDowntimeDefault(http.StatusForbidden)
+	}
+
+	ctx := commonsCtx.WithUserID(params.HTTPRequest.Context(), principal.ID)
+
+	startedAt, endedAt := time.Time(*params.Body.StartedAt), time.Time(*params.Body.EndedAt)
+	if !endedAt.After(startedAt) {
+		return utils.ParseError(ctx, station.NewCreateStationDowntimeDefault(0), mcomErrors.Error{
+			Code:    mcomErrors.Code_BAD_REQUEST,
+			Details: "endedAt must be after startedAt",
+		})
+	}
+	if endedAt.After(time.Now()) {
+		return utils.ParseError(ctx, station.NewCreateStationDowntimeDefault(0), mcomErrors.Error{
+			Code:    mcomErrors.Code_BAD_REQUEST,
+			Details: "endedAt must not be in the future",
+		})
+	}
+
+	// make sure the station exists.
+	if _, err := s.dm.GetStation(ctx, mcom.GetStationRequest{ID: params.StationID}); err != nil {
+		return utils.ParseError(ctx, station.NewCreateStationDowntimeDefault(0), err)
+	}
+
+	if err := s.config.Logs.CreateDowntime(ctx, database.Downtime{
+		Station:   params.StationID,
+		Reason:    *params.Body.Reason,
+		StartedAt: startedAt,
+		EndedAt:   endedAt,
+		CreatedBy: principal.ID,
+	}); err != nil {
+		return utils.ParseError(ctx, station.NewCreateStationDowntimeDefault(0), err)
+	}
+	return station.NewCreateStationDowntimeOK()
+}
+
 func parseStationList(dataIn mcom.ListStationIDsReply) []*station.ListStationsOKBodyDataItems0 {
 	dataOut := make([]*station.ListStationsOKBodyDataItems0, len(dataIn.Stations))
 	for i, data := range dataIn.Stations {
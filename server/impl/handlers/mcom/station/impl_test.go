@@ -214,7 +214,7 @@ func TestStation_GetStationList(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			s := NewStation(dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
 				return true
-			})
+			}, Config{Logs: newStationLogStore(t)})
 			if got := s.GetStationList(tt.args.params, tt.args.principal); !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("GetStationList() = %v, want %v", got, tt.want)
 			}
@@ -224,7 +224,7 @@ func TestStation_GetStationList(t *testing.T) {
 	{ // forbidden access
 		s := NewStation(dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
 			return false
-		})
+		}, Config{Logs: newStationLogStore(t)})
 		rep, ok := s.GetStationList(station.GetStationListParams{
 			HTTPRequest:   httpRequestWithHeader,
 			DepartmentOID: testDepartmentOID,
@@ -1464,7 +1464,7 @@ func TestStation_ListStationInfo(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			m := NewStation(dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
 				return true
-			})
+			}, Config{Logs: newStationLogStore(t)})
 			if got := m.ListStationInfo(tt.args.params, tt.args.principal); !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("List() = %v, want %v", got, tt.want)
 			}
@@ -1475,7 +1475,7 @@ func TestStation_ListStationInfo(t *testing.T) {
 		dm, _ := mock.New([]mock.Script{})
 		m := NewStation(dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
 			return false
-		})
+		}, Config{Logs: newStationLogStore(t)})
 		rep, ok := m.ListStationInfo(station.ListStationInfoParams{
 			HTTPRequest:   httpRequestWithHeader,
 			DepartmentOID: testDepartmentOID,
@@ -1733,7 +1733,7 @@ func TestStation_CreateStation(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			m := NewStation(dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
 				return true
-			})
+			}, Config{Logs: newStationLogStore(t)})
 			if got := m.CreateStation(tt.args.params, tt.args.principal); !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("Create() = %v, want %v", got, tt.want)
 			}
@@ -1743,7 +1743,7 @@ func TestStation_CreateStation(t *testing.T) {
 	{ // forbidden access
 		m := NewStation(dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
 			return false
-		})
+		}, Config{Logs: newStationLogStore(t)})
 		rep, ok := m.CreateStation(station.CreateStationParams{
 			HTTPRequest: httpRequestWithHeader,
 			Body:        station.CreateStationBody{},
@@ -1931,7 +1931,7 @@ func TestStation_UpdateStationInfo(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			m := NewStation(dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
 				return true
-			})
+			}, Config{Logs: newStationLogStore(t)})
 			if got := m.UpdateStationInfo(tt.args.params, tt.args.principal); !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("Update() = %v, want %v", got, tt.want)
 			}
@@ -1941,7 +1941,7 @@ func TestStation_UpdateStationInfo(t *testing.T) {
 	{ // forbidden access
 		m := NewStation(dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
 			return false
-		})
+		}, Config{Logs: newStationLogStore(t)})
 		rep, ok := m.UpdateStationInfo(station.UpdateStationInfoParams{
 			HTTPRequest: httpRequestWithHeader,
 			ID:          testStationA,
@@ -2048,7 +2048,7 @@ func TestStation_DeleteStation(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			m := NewStation(dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
 				return true
-			})
+			}, Config{Logs: newStationLogStore(t)})
 			if got := m.DeleteStation(tt.args.params, tt.args.principal); !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("Delete() = %v, want %v", got, tt.want)
 			}
@@ -2058,7 +2058,7 @@ func TestStation_DeleteStation(t *testing.T) {
 	{ // forbidden access
 		m := NewStation(dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
 			return false
-		})
+		}, Config{Logs: newStationLogStore(t)})
 		rep, ok := m.DeleteStation(station.DeleteStationParams{
 			HTTPRequest: httpRequestWithHeader,
 			ID:          testStationA,
@@ -2208,7 +2208,7 @@ func TestStation_GetStationStateList(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			s := NewStation(dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
 				return true
-			})
+			}, Config{Logs: newStationLogStore(t)})
 			if got := s.GetStationStateList(tt.args.params, tt.args.principal); !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("GetStationStateList() = %v, want %v", got, tt.want)
 			}
@@ -2218,7 +2218,7 @@ func TestStation_GetStationStateList(t *testing.T) {
 	{ // forbidden access
 		s := NewStation(dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
 			return false
-		})
+		}, Config{Logs: newStationLogStore(t)})
 		rep, ok := s.GetStationStateList(station.GetStationStateListParams{
 			HTTPRequest: httpRequestWithHeader,
 		}, principal).(*station.GetStationStateListDefault)
@@ -2374,7 +2374,7 @@ func TestStation_ListStations(t *testing.T) {
 
 			s := NewStation(dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
 				return true
-			})
+			}, Config{Logs: newStationLogStore(t)})
 			if got := s.ListStations(tt.args.params, tt.args.principal); !assert.Equal(got, tt.want) {
 				t.Errorf("ListStations() = %v, want %v", got, tt.want)
 			}
@@ -2386,7 +2386,7 @@ func TestStation_ListStations(t *testing.T) {
 		dm, _ := mock.New(nil)
 		s := NewStation(dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
 			return false
-		})
+		}, Config{Logs: newStationLogStore(t)})
 		rep, ok := s.ListStations(station.ListStationsParams{
 			HTTPRequest: httpRequestWithHeader,
 		}, principal).(*station.ListStationsDefault)
@@ -2530,7 +2530,7 @@ func TestStation_ListStationSites(t *testing.T) {
 
 			s := NewStation(dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
 				return true
-			})
+			}, Config{Logs: newStationLogStore(t)})
 			if got := s.ListStationSites(tt.args.params, tt.args.principal); !assert.Equal(got, tt.want) {
 				t.Errorf("ListStationSites() = %v, want %v", got, tt.want)
 			}
@@ -2543,7 +2543,7 @@ func TestStation_ListStationSites(t *testing.T) {
 		assert.NoError(err)
 		r := NewStation(dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
 			return false
-		})
+		}, Config{Logs: newStationLogStore(t)})
 		rep, ok := r.ListStationSites(station.ListStationSitesParams{
 			HTTPRequest: httpRequest,
 			StationID:   testStationA,
@@ -2762,7 +2762,7 @@ func TestStation_StationForceSignIn(t *testing.T) {
 
 			s := NewStation(dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
 				return true
-			})
+			}, Config{Logs: newStationLogStore(t)})
 			if got := s.StationForceSignIn(tt.args.params, tt.args.principal); !assert.Equal(got, tt.want) {
 				t.Errorf("StationForceSignIn() = %v, want %v", got, tt.want)
 			}
@@ -2775,7 +2775,7 @@ func TestStation_StationForceSignIn(t *testing.T) {
 		dm, _ := mock.New([]mock.Script{})
 		s := NewStation(dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
 			return false
-		})
+		}, Config{Logs: newStationLogStore(t)})
 		rep, ok := s.StationForceSignIn(station.StationForceSignInParams{
 			HTTPRequest: httpRequestWithHeader,
 			StationID:   testStationID,
@@ -2932,7 +2932,7 @@ func TestStation_StationSignOut(t *testing.T) {
 
 			s := NewStation(dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
 				return true
-			})
+			}, Config{Logs: newStationLogStore(t)})
 			if got := s.StationSignOut(tt.args.params, tt.args.principal); !assert.Equal(got, tt.want) {
 				t.Errorf("StationSignOut() = %v, want %v", got, tt.want)
 			}
@@ -2945,7 +2945,7 @@ func TestStation_StationSignOut(t *testing.T) {
 		dm, _ := mock.New([]mock.Script{})
 		s := NewStation(dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
 			return false
-		})
+		}, Config{Logs: newStationLogStore(t)})
 		rep, ok := s.StationSignOut(station.StationSignOutParams{
 			HTTPRequest: httpRequestWithHeader,
 			Body: station.StationSignOutBody{
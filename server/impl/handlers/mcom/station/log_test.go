@@ -0,0 +1,219 @@
+package station
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-openapi/strfmt"
+	"github.com/stretchr/testify/assert"
+
+	"gitlab.kenda.com.tw/kenda/mcom"
+	mcomErrors "gitlab.kenda.com.tw/kenda/mcom/errors"
+	mcomModels "gitlab.kenda.com.tw/kenda/mcom/impl/orm/models"
+	"gitlab.kenda.com.tw/kenda/mcom/mock"
+
+	"gitlab.kenda.com.tw/kenda/mui/server/database"
+	"gitlab.kenda.com.tw/kenda/mui/server/database/storetest"
+	"gitlab.kenda.com.tw/kenda/mui/server/impl/handlers/mcom/account"
+	"gitlab.kenda.com.tw/kenda/mui/server/protobuf/kenda"
+	"gitlab.kenda.com.tw/kenda/mui/server/swagger/models"
+	"gitlab.kenda.com.tw/kenda/mui/server/swagger/restapi/operations/station"
+)
+
+func newStationLogStore(t *testing.T) database.StationLogStore {
+	return storetest.New(t).StationLogs
+}
+
+func allowAll(kenda.FunctionOperationID, []models.Role) bool {
+	return true
+}
+
+func TestStation_signInLogs(t *testing.T) {
+	assert := assert.New(t)
+
+	httpRequestWithHeader := httptest.NewRequest("POST", "/station/{stationID}/sign-in", nil)
+	httpRequestWithHeader.Header.Set(account.AuthorizationKey, "token-for-tester")
+
+	dm, err := mock.New([]mock.Script{
+		{
+			Name: mock.FuncSignInStation,
+			Input: mock.Input{
+				Request: mcom.SignInStationRequest{
+					Station:  testStationID,
+					Site:     mcomModels.SiteID{Name: testSiteName1},
+					Group:    2,
+					WorkDate: time.Time(testSchedulingDate),
+				},
+				Options: []interface{}{mcom.ForceSignIn(), mcom.CreateSiteIfNotExists()},
+			},
+		},
+		{
+			Name: mock.FuncSignOutStations,
+			Input: mock.Input{
+				Request: mcom.SignOutStationsRequest{
+					Sites: []mcomModels.UniqueSite{{
+						Station: testStationID,
+						SiteID:  mcomModels.SiteID{Name: testSiteName1},
+					}},
+				},
+			},
+		},
+	})
+	assert.NoError(err)
+
+	stores := storetest.New(t)
+	s := NewStation(dm, allowAll, Config{Logs: stores.StationLogs})
+
+	assert.Equal(station.NewStationForceSignInOK(), s.StationForceSignIn(station.StationForceSignInParams{
+		HTTPRequest: httpRequestWithHeader,
+		StationID:   testStationID,
+		Body: station.StationForceSignInBody{
+			SiteName: testSiteName1,
+			Group:    2,
+			WorkDate: strfmt.Date(testSchedulingDate),
+		},
+	}, principal))
+	var signIns []database.StationSignIn
+	assert.NoError(stores.DB.Find(&signIns).Error)
+	if assert.Len(signIns, 1) {
+		signIn := signIns[0]
+		assert.Equal(testStationID, signIn.Station)
+		assert.Equal(testSiteName1, signIn.SiteName)
+		assert.Equal(int16(2), signIn.Group)
+		assert.Equal(principal.ID, signIn.CreatedBy)
+		assert.False(signIn.SignedInAt.IsZero())
+		assert.Nil(signIn.SignedOutAt)
+	}
+
+	assert.Equal(station.NewStationSignOutOK(), s.StationSignOut(station.StationSignOutParams{
+		HTTPRequest: httpRequestWithHeader,
+		Body: station.StationSignOutBody{
+			StationSites: []*models.SiteInfo{{StationID: testStationID, SiteName: testSiteName1}},
+		},
+	}, principal))
+	signIns = nil
+	assert.NoError(stores.DB.Find(&signIns).Error)
+	if assert.Len(signIns, 1) {
+		assert.NotNil(signIns[0].SignedOutAt)
+	}
+
+	assert.NoError(dm.Close())
+}
+
+func TestStation_CreateStationDowntime(t *testing.T) {
+	assert := assert.New(t)
+
+	httpRequestWithHeader := httptest.NewRequest("POST", "/station/{stationID}/downtime", nil)
+	httpRequestWithHeader.Header.Set(account.AuthorizationKey, "token-for-tester")
+
+	reason := "changeover"
+	startedAt := time.Now().UTC().Add(-time.Hour).Truncate(time.Second)
+	endedAt := startedAt.Add(30 * time.Minute)
+	dateTime := func(t time.Time) *strfmt.DateTime {
+		d := strfmt.DateTime(t)
+		return &d
+	}
+	params := func(startedAt, endedAt time.Time) station.CreateStationDowntimeParams {
+		return station.CreateStationDowntimeParams{
+			HTTPRequest: httpRequestWithHeader,
+			StationID:   testStationID,
+			Body: station.CreateStationDowntimeBody{
+				Reason:    &reason,
+				StartedAt: dateTime(startedAt),
+				EndedAt:   dateTime(endedAt),
+			},
+		}
+	}
+
+	tests := []struct {
+		name   string
+		params station.CreateStationDowntimeParams
+		script []mock.Script
+		want   interface{}
+		logged bool
+	}{
+		{
+			name:   "success",
+			params: params(startedAt, endedAt),
+			script: []mock.Script{
+				{
+					Name:   mock.FuncGetStation,
+					Input:  mock.Input{Request: mcom.GetStationRequest{ID: testStationID}},
+					Output: mock.Output{Response: mcom.GetStationReply(mcom.Station{ID: testStationID})},
+				},
+			},
+			want:   station.NewCreateStationDowntimeOK(),
+			logged: true,
+		},
+		{
+			name:   "ended before started",
+			params: params(endedAt, startedAt),
+			want: station.NewCreateStationDowntimeDefault(http.StatusBadRequest).WithPayload(&models.Error{
+				Code:    int64(mcomErrors.Code_BAD_REQUEST),
+				Details: "endedAt must be after startedAt",
+			}),
+		},
+		{
+			name:   "ended in the future",
+			params: params(startedAt, time.Now().Add(time.Hour)),
+			want: station.NewCreateStationDowntimeDefault(http.StatusBadRequest).WithPayload(&models.Error{
+				Code:    int64(mcomErrors.Code_BAD_REQUEST),
+				Details: "endedAt must not be in the future",
+			}),
+		},
+		{
+			name:   "station not found",
+			params: params(startedAt, endedAt),
+			script: []mock.Script{
+				{
+					Name:   mock.FuncGetStation,
+					Input:  mock.Input{Request: mcom.GetStationRequest{ID: testStationID}},
+					Output: mock.Output{Error: mcomErrors.Error{Code: mcomErrors.Code_STATION_NOT_FOUND}},
+				},
+			},
+			want: station.NewCreateStationDowntimeDefault(http.StatusBadRequest).WithPayload(&models.Error{
+				Code: int64(mcomErrors.Code_STATION_NOT_FOUND),
+			}),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dm, err := mock.New(tt.script)
+			assert.NoError(err)
+
+			stores := storetest.New(t)
+			s := NewStation(dm, allowAll, Config{Logs: stores.StationLogs})
+			assert.Equal(tt.want, s.CreateStationDowntime(tt.params, principal))
+			var downtimes []database.Downtime
+			assert.NoError(stores.DB.Find(&downtimes).Error)
+			for i := range downtimes {
+				downtimes[i].ID = 0
+				downtimes[i].CreatedAt = time.Time{}
+			}
+			if tt.logged {
+				assert.Equal([]database.Downtime{{
+					Station:   testStationID,
+					Reason:    reason,
+					StartedAt: startedAt,
+					EndedAt:   endedAt,
+					CreatedBy: principal.ID,
+				}}, downtimes)
+			} else {
+				assert.Empty(downtimes)
+			}
+
+			assert.NoError(dm.Close())
+		})
+	}
+
+	{ // forbidden access
+		dm, _ := mock.New([]mock.Script{})
+		s := NewStation(dm, func(kenda.FunctionOperationID, []models.Role) bool {
+			return false
+		}, Config{Logs: newStationLogStore(t)})
+		assert.Equal(station.NewCreateStationDowntimeDefault(http.StatusForbidden),
+			s.CreateStationDowntime(params(startedAt, endedAt), principal))
+	}
+}
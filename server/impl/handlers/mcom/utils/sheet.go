@@ -0,0 +1,152 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"mime"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-openapi/runtime"
+	"github.com/xuri/excelize/v2"
+
+	mcomErrors "gitlab.kenda.com.tw/kenda/mcom/errors"
+)
+
+// utf8BOM is written by Excel at the beginning of the exported CSV files.
+var utf8BOM = []byte("\xef\xbb\xbf")
+
+// Row is a row of an uploaded sheet.
+type Row []string
+
+// Column returns the value of the i-th column, empty if the row is short.
+func (r Row) Column(i int) string {
+	if len(r) <= i {
+		return ""
+	}
+	return r[i]
+}
+
+// get excel column index
+func excelColIndex(i int) string {
+	return string(rune('A' + i))
+}
+
+// BadColumns returns the names of the bad columns like "A(productID)"
+// according to the header row.
+func BadColumns(header Row, colIndex []int) []string {
+	dataOut := make([]string, len(colIndex))
+	for i, index := range colIndex {
+		dataOut[i] = fmt.Sprintf("%s(%s)", excelColIndex(index), header.Column(index))
+	}
+	return dataOut
+}
+
+// SheetFormat is the format of an uploaded sheet.
+type SheetFormat string
+
+// SheetFormat definitions.
+const (
+	SheetXLSX SheetFormat = "xlsx"
+	SheetCSV  SheetFormat = "csv"
+)
+
+// sheetExtensions are the file extensions of the sheet formats.
+var sheetExtensions = map[string]SheetFormat{
+	".xlsx": SheetXLSX,
+	".xlsm": SheetXLSX,
+	".csv":  SheetCSV,
+}
+
+// sheetContentTypes are the content types of the sheet formats, used if the
+// file name has no known extension.
+var sheetContentTypes = map[string]SheetFormat{
+	"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet": SheetXLSX,
+	"text/csv": SheetCSV,
+}
+
+// UploadedSheetFormat returns the format of an uploaded file by the extension
+// of its name, or else by its content type, empty if neither is known.
+func UploadedSheetFormat(file io.Reader) SheetFormat {
+	f, ok := file.(*runtime.File)
+	if !ok || f.Header == nil {
+		return ""
+	}
+	if format, ok := sheetExtensions[strings.ToLower(filepath.Ext(f.Header.Filename))]; ok {
+		return format
+	}
+	contentType, _, _ := mime.ParseMediaType(f.Header.Header.Get("Content-Type"))
+	return sheetContentTypes[contentType]
+}
+
+// ReadRows returns the rows of the first sheet of an uploaded xlsx file, or
+// the rows of an uploaded CSV file. The files of the other formats than the
+// specified ones are rejected.
+func ReadRows(file io.Reader, formats ...SheetFormat) ([][]string, error) {
+	format := UploadedSheetFormat(file)
+	for _, f := range formats {
+		if f != format {
+			continue
+		}
+		if format == SheetCSV {
+			return readCSVRows(bufio.NewReader(file))
+		}
+		return readExcelRows(file)
+	}
+
+	names := make([]string, len(formats))
+	for i, f := range formats {
+		names[i] = string(f)
+	}
+	return nil, mcomErrors.Error{
+		Code:    mcomErrors.Code_BAD_REQUEST,
+		Details: "unsupported file format, expected " + strings.Join(names, " or "),
+	}
+}
+
+func readExcelRows(file io.Reader) ([][]string, error) {
+	f, err := excelize.OpenReader(file)
+	if err != nil {
+		return nil, mcomErrors.Error{
+			Code:    mcomErrors.Code_BAD_REQUEST,
+			Details: "bad xlsx file: " + err.Error(),
+		}
+	}
+	defer f.Close()
+
+	// get sheet name list
+	sheetList := f.GetSheetList()
+
+	// if empty sheet
+	if len(sheetList) == 0 {
+		return nil, mcomErrors.Error{
+			Code:    mcomErrors.Code_INSUFFICIENT_REQUEST,
+			Details: "no sheet",
+		}
+	}
+
+	return f.GetRows(sheetList[0])
+}
+
+func readCSVRows(r *bufio.Reader) ([][]string, error) {
+	if bom, _ := r.Peek(len(utf8BOM)); bytes.Equal(bom, utf8BOM) {
+		if _, err := r.Discard(len(utf8BOM)); err != nil {
+			return nil, err
+		}
+	}
+
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, mcomErrors.Error{
+			Code:    mcomErrors.Code_BAD_REQUEST,
+			Details: "bad CSV file: " + err.Error(),
+		}
+	}
+	return rows, nil
+}
@@ -0,0 +1,103 @@
+package utils
+
+import (
+	"bytes"
+	"io"
+	"mime/multipart"
+	"net/textproto"
+	"strings"
+	"testing"
+
+	"github.com/go-openapi/runtime"
+	"github.com/stretchr/testify/assert"
+	"github.com/xuri/excelize/v2"
+
+	mcomErrors "gitlab.kenda.com.tw/kenda/mcom/errors"
+)
+
+type memFile struct {
+	*bytes.Reader
+}
+
+func (memFile) Close() error {
+	return nil
+}
+
+func uploadFile(name, contentType string, data []byte) *runtime.File {
+	return &runtime.File{
+		Data: memFile{bytes.NewReader(data)},
+		Header: &multipart.FileHeader{
+			Filename: name,
+			Header:   textproto.MIMEHeader{"Content-Type": {contentType}},
+		},
+	}
+}
+
+func TestUploadedSheetFormat(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal(SheetXLSX, UploadedSheetFormat(uploadFile("accounts.XLSX", "", nil)))
+	assert.Equal(SheetCSV, UploadedSheetFormat(uploadFile("accounts.csv", "application/octet-stream", nil)))
+	assert.Equal(SheetCSV, UploadedSheetFormat(uploadFile("accounts", "text/csv; charset=utf-8", nil)))
+	assert.Equal(SheetFormat(""), UploadedSheetFormat(uploadFile("accounts.xls", "application/vnd.ms-excel", nil)))
+	assert.Equal(SheetFormat(""), UploadedSheetFormat(io.NopCloser(strings.NewReader(""))))
+}
+
+func TestReadRows(t *testing.T) {
+	assert := assert.New(t)
+
+	{ // excel.
+		f := excelize.NewFile()
+		assert.NoError(f.SetSheetRow("Sheet1", "A1", &[]string{"employeeID", "roles"}))
+		assert.NoError(f.SetSheetRow("Sheet1", "A2", &[]string{"dan", "OPERATOR"}))
+		var buf bytes.Buffer
+		assert.NoError(f.Write(&buf))
+
+		rows, err := ReadRows(uploadFile("accounts.xlsx", "", buf.Bytes()), SheetXLSX, SheetCSV)
+		assert.NoError(err)
+		assert.Equal([][]string{{"employeeID", "roles"}, {"dan", "OPERATOR"}}, rows)
+	}
+	{ // CSV with BOM.
+		rows, err := ReadRows(uploadFile("accounts.csv", "", []byte("\xef\xbb\xbfemployeeID,roles\ndan,\"OPERATOR, LEADER\"\nspencer\n")), SheetXLSX, SheetCSV)
+		assert.NoError(err)
+		assert.Equal([][]string{{"employeeID", "roles"}, {"dan", "OPERATOR, LEADER"}, {"spencer"}}, rows)
+	}
+	{ // bad CSV.
+		_, err := ReadRows(uploadFile("accounts.csv", "", []byte("employeeID,\"roles\n")), SheetCSV)
+		e, ok := mcomErrors.As(err)
+		if assert.True(ok) {
+			assert.Equal(mcomErrors.Code_BAD_REQUEST, e.Code)
+		}
+	}
+	{ // corrupt xlsx.
+		_, err := ReadRows(uploadFile("accounts.xlsx", "", []byte("employeeID,roles\n")), SheetXLSX)
+		e, ok := mcomErrors.As(err)
+		if assert.True(ok) {
+			assert.Equal(mcomErrors.Code_BAD_REQUEST, e.Code)
+			assert.Contains(e.Details, "bad xlsx file")
+		}
+	}
+	{ // legacy xls.
+		_, err := ReadRows(uploadFile("accounts.xls", "application/vnd.ms-excel", []byte{0xd0, 0xcf, 0x11, 0xe0}), SheetXLSX, SheetCSV)
+		assert.Equal(mcomErrors.Error{
+			Code:    mcomErrors.Code_BAD_REQUEST,
+			Details: "unsupported file format, expected xlsx or csv",
+		}, err)
+	}
+	{ // format not accepted.
+		_, err := ReadRows(uploadFile("accounts.csv", "", []byte("employeeID,roles\n")), SheetXLSX)
+		assert.Equal(mcomErrors.Error{
+			Code:    mcomErrors.Code_BAD_REQUEST,
+			Details: "unsupported file format, expected xlsx",
+		}, err)
+	}
+}
+
+func TestBadColumns(t *testing.T) {
+	assert := assert.New(t)
+
+	header := Row{"employeeID", "roles"}
+	assert.Equal([]string{"A(employeeID)", "C()"}, BadColumns(header, []int{0, 2}))
+	assert.Equal("roles", header.Column(1))
+	assert.Equal("", header.Column(2))
+}
@@ -6,19 +6,24 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/go-openapi/runtime/middleware"
 	"github.com/shopspring/decimal"
 
 	"gitlab.kenda.com.tw/kenda/mcom"
+	mcomErrors "gitlab.kenda.com.tw/kenda/mcom/errors"
 	mcomModels "gitlab.kenda.com.tw/kenda/mcom/impl/orm/models"
 	"gitlab.kenda.com.tw/kenda/mcom/utils/resources"
 	mcomRoles "gitlab.kenda.com.tw/kenda/mcom/utils/roles"
 	mcomWorkOrder "gitlab.kenda.com.tw/kenda/mcom/utils/workorder"
 	mesModels "gitlab.kenda.com.tw/kenda/mui/server/mes"
 
+	"gitlab.kenda.com.tw/kenda/mui/server/database"
+	"gitlab.kenda.com.tw/kenda/mui/server/impl/utils/saga"
 	"gitlab.kenda.com.tw/kenda/mui/server/swagger/models"
 	"gitlab.kenda.com.tw/kenda/mui/server/swagger/restapi/operations"
 )
@@ -129,6 +134,35 @@ func SendMesAgePOSTRequest(requestBody interface{}, url string) error {
 	return nil
 }
 
+// SendMesNotification posts the request to MES and checks only the status of
+// the response.
+func SendMesNotification(requestBody interface{}, mesHeader MesHeader, url string) error {
+	requestJson, err := json.Marshal(requestBody)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", url, bytes.NewBuffer(requestJson))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("user-id", mesHeader.UserID)
+	req.Header.Set("station", mesHeader.Station)
+	req.Header.Set("site", mesHeader.Site)
+	req.Header.Set("pid", mesHeader.TrackID)
+
+	httpResponse, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer httpResponse.Body.Close()
+	if httpResponse.StatusCode/100 != 2 {
+		return fmt.Errorf("mes error: status=%d", httpResponse.StatusCode)
+	}
+	return nil
+}
+
 func SendMesPOSTRequest[T *mesModels.APIResourceFeedReply | *mesModels.APICollectReply](requestBody interface{}, mesHeader MesHeader, url string) (T, error) {
 	requestJson, err := json.Marshal(requestBody)
 	if err != nil {
@@ -173,6 +207,130 @@ func GetContextValue(dataIn *http.Request, key string) string {
 	return fmt.Sprint(dataIn.Context().Value(UtilsString(key)))
 }
 
+// TrustedProxies are the networks of the proxies whose X-Forwarded-For
+// headers are trusted.
+type TrustedProxies []*net.IPNet
+
+// ParseTrustedProxies parses the IP addresses or CIDR ranges of the proxies.
+func ParseTrustedProxies(proxies []string) (TrustedProxies, error) {
+	nets := make(TrustedProxies, len(proxies))
+	for i, proxy := range proxies {
+		if _, n, err := net.ParseCIDR(proxy); err == nil {
+			nets[i] = n
+			continue
+		}
+		ip := net.ParseIP(proxy)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid IP address or CIDR range %q", proxy)
+		}
+		bits := 8 * net.IPv4len
+		if ip.To4() == nil {
+			bits = 8 * net.IPv6len
+		}
+		nets[i] = &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}
+	}
+	return nets, nil
+}
+
+func (p TrustedProxies) contains(addr string) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	for _, n := range p {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP returns the IP address of the client sending the request. The
+// X-Forwarded-For header is honored only if the request comes from a trusted
+// proxy, where the client is the last address not of a trusted proxy since
+// the addresses before it may be forged by the client.
+func (p TrustedProxies) ClientIP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	if !p.contains(ip) {
+		return ip
+	}
+
+	forwarded := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		addr := strings.TrimSpace(forwarded[i])
+		if addr == "" {
+			continue
+		}
+		ip = addr
+		if !p.contains(addr) {
+			break
+		}
+	}
+	return ip
+}
+
+// AgingHolds returns the holds of the resources produced at the time until the
+// minimum aging time of the limitary hour elapses, or nil if there is no
+// minimum aging time.
+func AgingHolds(produced time.Time, hour mcom.LimitaryHourParameter, productType string, resourceIDs ...string) []database.AgingHold {
+	if hour.Min <= 0 {
+		return nil
+	}
+	until := produced.Add(time.Duration(hour.Min) * time.Hour)
+	holds := make([]database.AgingHold, len(resourceIDs))
+	for i, id := range resourceIDs {
+		holds[i] = database.AgingHold{
+			ResourceID:  id,
+			ProductType: productType,
+			Until:       until,
+		}
+	}
+	return holds
+}
+
+// CheckAgingHolds returns the active aging holds of the resources to bind or
+// feed, which can be used only in force with a reason. A resource without the
+// product type matches the holds of any product type.
+func CheckAgingHolds(ctx context.Context, store database.HoldStore, resources []mcom.BindMaterialResource, force bool, reason string) ([]database.AgingHold, error) {
+	ids := make([]string, 0, len(resources))
+	for _, resource := range resources {
+		ids = append(ids, resource.ResourceID)
+	}
+	active, err := store.ListActiveAgingHolds(ctx, time.Now(), ids)
+	if err != nil {
+		return nil, err
+	}
+
+	var holds []database.AgingHold
+	for _, hold := range active {
+		for _, resource := range resources {
+			if resource.ResourceID == hold.ResourceID && (resource.ProductType == "" || resource.ProductType == hold.ProductType) {
+				holds = append(holds, hold)
+				break
+			}
+		}
+	}
+	if len(holds) == 0 {
+		return nil, nil
+	}
+	if !force {
+		return nil, mcomErrors.Error{
+			Code:    mcomErrors.Code_RESOURCE_UNAVAILABLE,
+			Details: fmt.Sprintf("resource %s in aging until %s", holds[0].ResourceID, holds[0].Until.Format(time.RFC3339)),
+		}
+	}
+	if reason == "" {
+		return nil, mcomErrors.Error{
+			Code:    mcomErrors.Code_BAD_REQUEST,
+			Details: "missing reason to use the resources in aging",
+		}
+	}
+	return holds, nil
+}
+
 func ParseBatchQuantityDetails(dataIn mcomModels.BatchQuantityDetails) (batchDetails, error) {
 	var dataOut batchDetails
 
@@ -204,3 +362,19 @@ func sum(dataIn []decimal.Decimal) decimal.Decimal {
 	}
 	return dataOut
 }
+
+// ParseSagaError keeps the code of the failed step and reports the failed step
+// and the compensations in the details.
+func ParseSagaError(err error) error {
+	e, ok := err.(*saga.Error)
+	if !ok {
+		return err
+	}
+	if mcomErr, ok := mcomErrors.As(e.Err); ok {
+		return mcomErrors.Error{
+			Code:    mcomErr.Code,
+			Details: e.Error(),
+		}
+	}
+	return e
+}
@@ -1,16 +1,22 @@
 package utils
 
 import (
+	"context"
 	"net/http/httptest"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/go-openapi/runtime/middleware"
 	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
 
 	"gitlab.kenda.com.tw/kenda/mcom"
+	mcomErrors "gitlab.kenda.com.tw/kenda/mcom/errors"
 	mcomRoles "gitlab.kenda.com.tw/kenda/mcom/utils/roles"
 
+	"gitlab.kenda.com.tw/kenda/mui/server/database"
+	"gitlab.kenda.com.tw/kenda/mui/server/database/dbtest"
 	"gitlab.kenda.com.tw/kenda/mui/server/swagger/models"
 	"gitlab.kenda.com.tw/kenda/mui/server/swagger/restapi/operations"
 )
@@ -249,3 +255,120 @@ func TestFromModelsRoles(t *testing.T) {
 		})
 	}
 }
+
+func TestParseTrustedProxies(t *testing.T) {
+	assert := assert.New(t)
+
+	proxies, err := ParseTrustedProxies([]string{"10.1.1.0/24", "10.2.2.2", "fd00::1"})
+	assert.NoError(err)
+	assert.Len(proxies, 3)
+	assert.True(proxies.contains("10.1.1.253"))
+	assert.True(proxies.contains("10.2.2.2"))
+	assert.False(proxies.contains("10.2.2.3"))
+	assert.True(proxies.contains("fd00::1"))
+
+	_, err = ParseTrustedProxies([]string{"proxy"})
+	assert.EqualError(err, `invalid IP address or CIDR range "proxy"`)
+}
+
+func TestTrustedProxies_ClientIP(t *testing.T) {
+	assert := assert.New(t)
+
+	proxies, err := ParseTrustedProxies([]string{"10.1.1.252/30"})
+	assert.NoError(err)
+
+	{ // remote address.
+		r := httptest.NewRequest("GET", "/user/login", nil)
+		r.RemoteAddr = "10.1.1.1:51234"
+		assert.Equal("10.1.1.1", proxies.ClientIP(r))
+	}
+	{ // behind proxies.
+		r := httptest.NewRequest("GET", "/user/login", nil)
+		r.RemoteAddr = "10.1.1.254:51234"
+		r.Header.Set("X-Forwarded-For", "10.1.1.1, 10.1.1.253")
+		assert.Equal("10.1.1.1", proxies.ClientIP(r))
+	}
+	{ // forged by the client behind proxies.
+		r := httptest.NewRequest("GET", "/user/login", nil)
+		r.RemoteAddr = "10.1.1.254:51234"
+		r.Header.Add("X-Forwarded-For", "10.9.9.9, 10.1.1.1")
+		r.Header.Add("X-Forwarded-For", "10.1.1.253")
+		assert.Equal("10.1.1.1", proxies.ClientIP(r))
+	}
+	{ // forged by the client without proxies.
+		r := httptest.NewRequest("GET", "/user/login", nil)
+		r.RemoteAddr = "10.1.1.1:51234"
+		r.Header.Set("X-Forwarded-For", "10.9.9.9")
+		assert.Equal("10.1.1.1", proxies.ClientIP(r))
+		assert.Equal("10.1.1.1", TrustedProxies(nil).ClientIP(r))
+	}
+	{ // remote address without port.
+		r := httptest.NewRequest("GET", "/user/login", nil)
+		r.RemoteAddr = "10.1.1.1"
+		assert.Equal("10.1.1.1", proxies.ClientIP(r))
+	}
+}
+
+func TestAgingHolds(t *testing.T) {
+	assert := assert.New(t)
+	produced := time.Date(2022, 12, 1, 8, 0, 0, 0, time.Local)
+
+	assert.Nil(AgingHolds(produced, mcom.LimitaryHourParameter{Min: 0, Max: 72}, "RUBBER", "R1"))
+	assert.Equal([]database.AgingHold{
+		{ResourceID: "R1", ProductType: "RUBBER", Until: time.Date(2022, 12, 1, 12, 0, 0, 0, time.Local)},
+		{ResourceID: "R2", ProductType: "RUBBER", Until: time.Date(2022, 12, 1, 12, 0, 0, 0, time.Local)},
+	}, AgingHolds(produced, mcom.LimitaryHourParameter{Min: 4, Max: 72}, "RUBBER", "R1", "R2"))
+}
+
+func TestCheckAgingHolds(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	store, err := database.NewHoldStore(dbtest.Open(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	until := time.Now().Add(time.Hour).Truncate(time.Second)
+	assert.NoError(store.CreateAgingHolds(ctx, []database.AgingHold{
+		{ResourceID: "R1", ProductType: "RUBBER", Until: until},
+		{ResourceID: "R2", ProductType: "RUBBER", Until: time.Now().Add(-time.Hour)},
+		{ResourceID: "R3", ProductType: "OTHER", Until: until},
+	}))
+	resource := func(id, productType string) mcom.BindMaterialResource {
+		return mcom.BindMaterialResource{ResourceID: id, ProductType: productType}
+	}
+
+	{ // aged or not held.
+		holds, err := CheckAgingHolds(ctx, store, []mcom.BindMaterialResource{resource("R2", "RUBBER"), resource("R3", "RUBBER")}, false, "")
+		assert.NoError(err)
+		assert.Empty(holds)
+	}
+	{ // in aging.
+		_, err := CheckAgingHolds(ctx, store, []mcom.BindMaterialResource{resource("R2", "RUBBER"), resource("R1", "RUBBER")}, false, "")
+		assert.Equal(mcomErrors.Error{
+			Code:    mcomErrors.Code_RESOURCE_UNAVAILABLE,
+			Details: "resource R1 in aging until " + until.Format(time.RFC3339),
+		}, err)
+	}
+	{ // in aging without the product type, e.g. fed through MES.
+		_, err := CheckAgingHolds(ctx, store, []mcom.BindMaterialResource{resource("R3", "")}, false, "")
+		assert.Equal(mcomErrors.Error{
+			Code:    mcomErrors.Code_RESOURCE_UNAVAILABLE,
+			Details: "resource R3 in aging until " + until.Format(time.RFC3339),
+		}, err)
+	}
+	{ // in force without reason.
+		_, err := CheckAgingHolds(ctx, store, []mcom.BindMaterialResource{resource("R1", "RUBBER")}, true, "")
+		assert.Equal(mcomErrors.Error{
+			Code:    mcomErrors.Code_BAD_REQUEST,
+			Details: "missing reason to use the resources in aging",
+		}, err)
+	}
+	{ // in force.
+		holds, err := CheckAgingHolds(ctx, store, []mcom.BindMaterialResource{resource("R1", "RUBBER")}, true, "urgent order")
+		assert.NoError(err)
+		if assert.Len(holds, 1) {
+			assert.Equal("R1", holds[0].ResourceID)
+			assert.Equal("RUBBER", holds[0].ProductType)
+		}
+	}
+}
@@ -0,0 +1,298 @@
+package workorder
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/go-openapi/runtime/middleware"
+	"github.com/shopspring/decimal"
+
+	"gitlab.kenda.com.tw/kenda/commons/v2/proto/golang/mes/v2/workorder"
+	commonsCtx "gitlab.kenda.com.tw/kenda/commons/v2/utils/context"
+	"gitlab.kenda.com.tw/kenda/mcom"
+	mcomErrors "gitlab.kenda.com.tw/kenda/mcom/errors"
+
+	"gitlab.kenda.com.tw/kenda/mui/server/impl/utils"
+	"gitlab.kenda.com.tw/kenda/mui/server/impl/utils/export"
+	"gitlab.kenda.com.tw/kenda/mui/server/protobuf/kenda"
+	"gitlab.kenda.com.tw/kenda/mui/server/swagger/models"
+	"gitlab.kenda.com.tw/kenda/mui/server/swagger/restapi/operations/work_order"
+)
+
+// the headers of the exported reports, same as the labels of the UI.
+var (
+	textWorkOrderID       = export.Text{export.TW: "工單號碼", export.CN: "工单号码", export.EN: "Work order ID", export.VI: "Mã đơn điều động"}
+	textDepartmentID      = export.Text{export.TW: "部門代號", export.CN: "部门代号", export.EN: "Department ID", export.VI: "Mã số bộ phận"}
+	textProductID         = export.Text{export.TW: "產品代號", export.CN: "产品代号", export.EN: "Product ID", export.VI: "Mã số sản phẩm"}
+	textProductType       = export.Text{export.TW: "產品類別", export.CN: "产品类别", export.EN: "Product type", export.VI: "Loại sản phẩm"}
+	textRecipeID          = export.Text{export.TW: "配合表編號", export.CN: "配合表编号", export.EN: "Match table ID", export.VI: "Mã số biểu phối hợp"}
+	textProcessName       = export.Text{export.TW: "工序名稱", export.CN: "工序名称", export.EN: "Process name", export.VI: "Tên quy trình"}
+	textProcessType       = export.Text{export.TW: "工序類別", export.CN: "工序类别", export.EN: "Process type", export.VI: "Loại quy trình"}
+	textStationID         = export.Text{export.TW: "機台號", export.CN: "机台号", export.EN: "Machine number", export.VI: "Số máy"}
+	textSequence          = export.Text{export.TW: "順序", export.CN: "顺序", export.EN: "Sequence", export.VI: "Thứ tự"}
+	textDate              = export.Text{export.TW: "日期", export.CN: "日期", export.EN: "Date", export.VI: "Ngày tháng"}
+	textPlanDate          = export.Text{export.TW: "預計生產日", export.CN: "预计生产日", export.EN: "Estimated production date", export.VI: "Ngày dự định sản xuất"}
+	textBatches           = export.Text{export.TW: "首數", export.CN: "首数", export.EN: "First number", export.VI: "Số mẻ"}
+	textPlanQuantity      = export.Text{export.TW: "預計數量", export.CN: "预计数量", export.EN: "Estimated quantity", export.VI: "Số lượng ước tính"}
+	textQuantity          = export.Text{export.TW: "數量", export.CN: "数量", export.EN: "Quantity", export.VI: "Số lượng"}
+	textCurrentQuantity   = export.Text{export.TW: "現有數量", export.CN: "现有数量", export.EN: "Current quantity", export.VI: "Số lượng hiện có"}
+	textRatio             = export.Text{export.TW: "達成率(倒扣)", export.CN: "达成率(倒扣)", export.EN: "Achievement rate", export.VI: "Tỷ lệ thành tích"}
+	textProductionTime    = export.Text{export.TW: "生產時間", export.CN: "生产时间", export.EN: "Production time", export.VI: "Thời gian sản xuất"}
+	textProductionEndTime = export.Text{export.TW: "生產結束時間", export.CN: "生产结束时间", export.EN: "Production end time", export.VI: "Thời gian kết thúc sản xuất"}
+	textDefectQuantity    = export.Text{export.TW: "不良數量", export.CN: "不良数量", export.EN: "Defect quantity", export.VI: "Số lượng lỗi"}
+	textScrapQuantity     = export.Text{export.TW: "報廢數量", export.CN: "报废数量", export.EN: "Scrap quantity", export.VI: "Số lượng phế phẩm"}
+	textYield             = export.Text{export.TW: "良率", export.CN: "良率", export.EN: "Yield", export.VI: "Tỷ lệ đạt"}
+	textStatus            = export.Text{export.TW: "狀態", export.CN: "状态", export.EN: "Status", export.VI: "Trạng thái"}
+	textUpdateBy          = export.Text{export.TW: "維護人員", export.CN: "维护人员", export.EN: "Maintainer", export.VI: "Nhân viên bảo trì"}
+	textUpdateAt          = export.Text{export.TW: "維護日期", export.CN: "维护日期", export.EN: "Maintenance date", export.VI: "Ngày tháng bảo trì"}
+	textCreatedBy         = export.Text{export.TW: "建立人員", export.CN: "建立人员", export.EN: "Build staff", export.VI: "Nhân viên"}
+
+	statusTexts = map[workorder.Status]export.Text{
+		workorder.Status_PENDING: {export.TW: "已排定", export.CN: "已排定", export.EN: "Pending", export.VI: "Đã điều động"},
+		workorder.Status_ACTIVE:  {export.TW: "生產中", export.CN: "生产中", export.EN: "Active", export.VI: "Đang sản xuất"},
+		workorder.Status_CLOSING: {export.TW: "待收料", export.CN: "待收料", export.EN: "Closing", export.VI: "Chờ thu liệu"},
+		workorder.Status_CLOSED:  {export.TW: "已完成", export.CN: "已完成", export.EN: "Closed", export.VI: "Đã hoàn thành"},
+		workorder.Status_SKIPPED: {export.TW: "已跳過", export.CN: "已跳过", export.EN: "Skipped", export.VI: "Bỏ qua"},
+	}
+)
+
+// exportOptions are the format and the language of an exported file.
+type exportOptions struct {
+	format export.Format
+	lang   export.Language
+}
+
+// parseExportOptions returns the options of the query parameters. The
+// language is of the Accept-Language header if not specified.
+func parseExportOptions(r *http.Request, format, lang *string) (exportOptions, error) {
+	var opts exportOptions
+	var err error
+	if format != nil {
+		opts.format, err = export.ParseFormat(*format)
+	} else {
+		opts.format, err = export.ParseFormat("")
+	}
+	if err != nil {
+		return exportOptions{}, mcomErrors.Error{
+			Code:    mcomErrors.Code_BAD_REQUEST,
+			Details: err.Error(),
+		}
+	}
+	if lang != nil {
+		opts.lang = export.ParseLanguage(*lang)
+	} else {
+		opts.lang = export.ParseLanguage(r.Header.Get("Accept-Language"))
+	}
+	return opts, nil
+}
+
+// write writes the table and returns the file with the Content-Disposition
+// of the name.
+func (opts exportOptions) write(name string, t export.Table) (io.ReadCloser, string, error) {
+	var buf bytes.Buffer
+	if err := export.Write(&buf, opts.format, opts.lang, t); err != nil {
+		return nil, "", err
+	}
+	return io.NopCloser(&buf), fmt.Sprintf(`attachment; filename="%s.%s"`, name, opts.format), nil
+}
+
+func (opts exportOptions) status(s models.WorkOrderStatus) string {
+	if text, ok := statusTexts[workorder.Status(s)]; ok {
+		return text.In(opts.lang)
+	}
+	return workorder.Status(s).String()
+}
+
+// quantity returns the decimal of s, so it is a number in the xlsx files.
+func quantity(s string) interface{} {
+	if d, err := decimal.NewFromString(s); err == nil {
+		return d
+	}
+	return s
+}
+
+func formatDate(t time.Time) string {
+	return t.Format("2006-01-02")
+}
+
+// ExportWorkOrders implements.
+func (w WorkOrder) ExportWorkOrders(params work_order.ExportWorkOrdersParams, principal *models.Principal) middleware.Responder {
+	if !w.hasPermission(kenda.FunctionOperationID_LIST_WORK_ORDERS, principal.Roles) {
+		return work_order.NewExportWorkOrdersDefault(http.StatusForbidden)
+	}
+	ctx := commonsCtx.WithUserID(params.HTTPRequest.Context(), principal.ID)
+
+	opts, err := parseExportOptions(params.HTTPRequest, params.Format, params.Lang)
+	if err != nil {
+		return utils.ParseError(ctx, work_order.NewExportWorkOrdersDefault(0), err)
+	}
+	workDate := time.Time(params.WorkDate)
+	list, err := w.listWorkOrders(ctx, params.StationID, workDate)
+	if err != nil {
+		return utils.ParseError(ctx, work_order.NewExportWorkOrdersDefault(0), err)
+	}
+
+	table := export.Table{
+		Sheet:  "WorkOrders",
+		Header: []export.Text{textWorkOrderID, textProductID, textProductType, textRecipeID, textDate, textPlanQuantity, textStatus},
+		Rows:   make([][]interface{}, len(list)),
+	}
+	for i, wo := range list {
+		table.Rows[i] = []interface{}{
+			wo.WorkOrderID,
+			wo.ProductID,
+			wo.ProductType,
+			wo.RecipeID,
+			formatDate(time.Time(wo.Date)),
+			quantity(wo.PlanQuantity),
+			opts.status(wo.WorkOrderStatus),
+		}
+	}
+	file, disposition, err := opts.write(fmt.Sprintf("work-orders-%s-%s", params.StationID, formatDate(workDate)), table)
+	if err != nil {
+		return utils.ParseError(ctx, work_order.NewExportWorkOrdersDefault(0), err)
+	}
+	return work_order.NewExportWorkOrdersOK().WithContentDisposition(disposition).WithPayload(file)
+}
+
+// ExportStationScheduling implements.
+func (w WorkOrder) ExportStationScheduling(params work_order.ExportStationSchedulingParams, principal *models.Principal) middleware.Responder {
+	if !w.hasPermission(kenda.FunctionOperationID_GET_STATION_SCHEDULING, principal.Roles) {
+		return work_order.NewExportStationSchedulingDefault(http.StatusForbidden)
+	}
+	ctx := commonsCtx.WithUserID(params.HTTPRequest.Context(), principal.ID)
+
+	opts, err := parseExportOptions(params.HTTPRequest, params.Format, params.Lang)
+	if err != nil {
+		return utils.ParseError(ctx, work_order.NewExportStationSchedulingDefault(0), err)
+	}
+	date := time.Time(params.Date)
+	list, err := w.stationScheduling(ctx, params.Station, date)
+	if err != nil {
+		return utils.ParseError(ctx, work_order.NewExportStationSchedulingDefault(0), err)
+	}
+
+	table := export.Table{
+		Sheet: "Scheduling",
+		Header: []export.Text{
+			textSequence, textWorkOrderID, textDepartmentID, textProductID, textRecipeID, textProcessName,
+			textProcessType, textStationID, textPlanDate, textBatches, textPlanQuantity, textStatus,
+			textUpdateBy, textUpdateAt,
+		},
+		Rows: make([][]interface{}, len(list)),
+	}
+	for i, wo := range list {
+		batches, planQuantity := wo.BatchCount, quantity(wo.PlanQuantity)
+		// the work orders of the quantities per batch.
+		if len(wo.BatchesQuantity) > 0 {
+			sum := decimal.Zero
+			for _, q := range wo.BatchesQuantity {
+				d, err := decimal.NewFromString(q)
+				if err != nil {
+					return utils.ParseError(ctx, work_order.NewExportStationSchedulingDefault(0), err)
+				}
+				sum = sum.Add(d)
+			}
+			batches, planQuantity = int64(len(wo.BatchesQuantity)), sum
+		}
+		var recipe models.Recipe
+		if wo.Recipe != nil {
+			recipe = *wo.Recipe
+		}
+		table.Rows[i] = []interface{}{
+			wo.Sequence,
+			wo.ID,
+			wo.DepartmentOID,
+			wo.ProductID,
+			recipe.ID,
+			recipe.ProcessName,
+			recipe.ProcessType,
+			wo.Station,
+			formatDate(time.Time(wo.PlanDate)),
+			batches,
+			planQuantity,
+			opts.status(wo.Status),
+			wo.UpdateBy,
+			time.Time(wo.UpdateAt).Local().Format("2006-01-02 15:04:05"),
+		}
+	}
+	file, disposition, err := opts.write(fmt.Sprintf("scheduling-%s-%s", params.Station, formatDate(date)), table)
+	if err != nil {
+		return utils.ParseError(ctx, work_order.NewExportStationSchedulingDefault(0), err)
+	}
+	return work_order.NewExportStationSchedulingOK().WithContentDisposition(disposition).WithPayload(file)
+}
+
+// ExportWorkOrdersRate implements.
+func (w WorkOrder) ExportWorkOrdersRate(params work_order.ExportWorkOrdersRateParams, principal *models.Principal) middleware.Responder {
+	if !w.hasPermission(kenda.FunctionOperationID_LIST_WORK_ORDERS_RATE, principal.Roles) {
+		return work_order.NewExportWorkOrdersRateDefault(http.StatusForbidden)
+	}
+	ctx := commonsCtx.WithUserID(params.HTTPRequest.Context(), principal.ID)
+
+	opts, err := parseExportOptions(params.HTTPRequest, params.Format, params.Lang)
+	if err != nil {
+		return utils.ParseError(ctx, work_order.NewExportWorkOrdersRateDefault(0), err)
+	}
+	orders := getWorkOrderListInfoByTypeDefaultOrderFunc()
+	if params.OrderName != nil {
+		orders = []mcom.Order{{
+			Name:       *params.OrderName,
+			Descending: params.Descending != nil && *params.Descending,
+		}}
+	}
+	since, until := time.Time(params.WorkStartDate), time.Time(params.WorkEndDate)
+	list, _, err := w.workOrdersRate(ctx, rateQuery{
+		department: params.DepartmentID,
+		since:      since,
+		until:      until,
+		orders:     orders,
+	})
+	if err != nil {
+		return utils.ParseError(ctx, work_order.NewExportWorkOrdersRateDefault(0), err)
+	}
+
+	table := export.Table{
+		Sheet: "ProductionRate",
+		Header: []export.Text{
+			textDepartmentID, textWorkOrderID, textProductID, textStationID, textQuantity, textCurrentQuantity,
+			textRatio, textProductionTime, textProductionEndTime, textUpdateBy, textCreatedBy, textRecipeID,
+			textDefectQuantity, textScrapQuantity, textYield,
+		},
+		Rows: make([][]interface{}, len(list)),
+	}
+	for i, rate := range list {
+		var productionTime, productionEndTime string
+		if rate.ProductionTime != nil {
+			productionTime = *rate.ProductionTime
+		}
+		if rate.ProductionEndTime != nil {
+			productionEndTime = *rate.ProductionEndTime
+		}
+		table.Rows[i] = []interface{}{
+			rate.DepartmentID,
+			rate.WorkOrderID,
+			rate.ProductID,
+			rate.Station,
+			quantity(rate.PlanQuantity),
+			quantity(rate.CollectedQuantity),
+			rate.Ratio,
+			productionTime,
+			productionEndTime,
+			rate.UpdateBy,
+			rate.CreatedBy,
+			rate.RecipeID,
+			quantity(rate.DefectQuantity),
+			quantity(rate.ScrapQuantity),
+			rate.Yield,
+		}
+	}
+	file, disposition, err := opts.write(fmt.Sprintf("production-rate-%s-%s-%s", params.DepartmentID, formatDate(since), formatDate(until)), table)
+	if err != nil {
+		return utils.ParseError(ctx, work_order.NewExportWorkOrdersRateDefault(0), err)
+	}
+	return work_order.NewExportWorkOrdersRateOK().WithContentDisposition(disposition).WithPayload(file)
+}
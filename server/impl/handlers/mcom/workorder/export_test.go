@@ -0,0 +1,125 @@
+package workorder
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-openapi/strfmt"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+
+	"gitlab.kenda.com.tw/kenda/commons/v2/proto/golang/mes/v2/workorder"
+	"gitlab.kenda.com.tw/kenda/mcom"
+	mcomErrors "gitlab.kenda.com.tw/kenda/mcom/errors"
+	"gitlab.kenda.com.tw/kenda/mcom/mock"
+
+	"gitlab.kenda.com.tw/kenda/mui/server/impl/handlers/mcom/account"
+	"gitlab.kenda.com.tw/kenda/mui/server/protobuf/kenda"
+	"gitlab.kenda.com.tw/kenda/mui/server/swagger/models"
+	"gitlab.kenda.com.tw/kenda/mui/server/swagger/restapi/operations/work_order"
+)
+
+func TestWorkOrder_ExportWorkOrders(t *testing.T) {
+	assert := assert.New(t)
+
+	httpRequestWithHeader := httptest.NewRequest("GET", "/production-flow/work-orders/station/{stationID}/export", nil)
+	httpRequestWithHeader.Header.Set(account.AuthorizationKey, "token-for-tester")
+	httpRequestWithHeader.Header.Set("Accept-Language", "en-US,en;q=0.9")
+
+	csv := "csv"
+	{ // success
+		dm, err := mock.New([]mock.Script{
+			{
+				Name: mock.FuncListWorkOrdersByDuration,
+				Input: mock.Input{
+					Request: mcom.ListWorkOrdersByDurationRequest{
+						Since:   testSchedulingDate.AddDate(0, 0, -9),
+						Station: testStationA,
+					}.WithOrder(
+						mcom.Order{
+							Name:       "reserved_date",
+							Descending: false,
+						},
+						mcom.Order{
+							Name:       "reserved_sequence",
+							Descending: false,
+						},
+					),
+				},
+				Output: mock.Output{
+					Response: mcom.ListWorkOrdersByDurationReply{
+						Contents: []mcom.GetWorkOrderReply{
+							{
+								ID: testWorkOrder1,
+								Product: mcom.Product{
+									ID:   testWorkOrder1ProductA,
+									Type: testWorkOrder1ProductType,
+								},
+								RecipeID:     testWorkOrder1RecipeID,
+								Status:       workorder.Status_ACTIVE,
+								DepartmentID: testDepartmentOID,
+								Station:      testStationA,
+								Sequence:     1,
+								Date:         testSchedulingDate,
+								BatchQuantityDetails: mcom.NewFixedQuantity(
+									2, decimal.NewFromFloat(testPlanQuantity)).Detail(),
+							},
+						},
+					},
+				},
+			},
+		})
+		assert.NoError(err)
+
+		s := mustNewWorkorder(t, dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
+			return true
+		})
+		rep, ok := s.ExportWorkOrders(work_order.ExportWorkOrdersParams{
+			HTTPRequest: httpRequestWithHeader,
+			WorkDate:    strfmt.Date(testSchedulingDate),
+			StationID:   testStationA,
+			Format:      &csv,
+		}, principal).(*work_order.ExportWorkOrdersOK)
+		if assert.True(ok) {
+			assert.Equal(`attachment; filename="work-orders-STATION-A-2021-08-09.csv"`, rep.ContentDisposition)
+			b, err := io.ReadAll(rep.Payload)
+			assert.NoError(err)
+			assert.Equal("\xef\xbb\xbf"+
+				"Work order ID,Product ID,Product type,Match table ID,Date,Estimated quantity,Status\n"+
+				"WORKORDERID001,PRODUCT-A,RUBBER,RECIPE001,2021-08-09,35,Active\n", string(b))
+		}
+		assert.NoError(dm.Close())
+	}
+	{ // unknown format
+		dm, _ := mock.New([]mock.Script{})
+		s := mustNewWorkorder(t, dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
+			return true
+		})
+		pdf := "pdf"
+		rep := s.ExportWorkOrders(work_order.ExportWorkOrdersParams{
+			HTTPRequest: httpRequestWithHeader,
+			WorkDate:    strfmt.Date(testSchedulingDate),
+			StationID:   testStationA,
+			Format:      &pdf,
+		}, principal)
+		assert.Equal(work_order.NewExportWorkOrdersDefault(http.StatusBadRequest).WithPayload(&models.Error{
+			Code:    int64(mcomErrors.Code_BAD_REQUEST),
+			Details: "unknown format: pdf",
+		}), rep)
+	}
+	{ // forbidden access
+		dm, _ := mock.New([]mock.Script{})
+		s := mustNewWorkorder(t, dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
+			return false
+		})
+		rep, ok := s.ExportWorkOrders(work_order.ExportWorkOrdersParams{
+			HTTPRequest: httpRequestWithHeader,
+			WorkDate:    strfmt.Date(testSchedulingDate),
+			StationID:   testStationA,
+		}, principal).(*work_order.ExportWorkOrdersDefault)
+		assert.True(ok)
+		assert.Equal(work_order.NewExportWorkOrdersDefault(http.StatusForbidden), rep)
+	}
+}
@@ -2,8 +2,8 @@ package workorder
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"io"
 	"net/http"
 	"sort"
 	"strconv"
@@ -11,8 +11,8 @@ import (
 
 	"github.com/go-openapi/runtime/middleware"
 	"github.com/go-openapi/strfmt"
+	"github.com/rs/xid"
 	"github.com/shopspring/decimal"
-	excelize "github.com/xuri/excelize/v2"
 	"go.uber.org/zap"
 
 	"gitlab.kenda.com.tw/kenda/commons/v2/proto/golang/mes/v2/workorder"
@@ -24,9 +24,11 @@ import (
 	mcomWorkOrder "gitlab.kenda.com.tw/kenda/mcom/utils/workorder"
 
 	"gitlab.kenda.com.tw/kenda/mui/server/configs"
+	"gitlab.kenda.com.tw/kenda/mui/server/database"
 	handlerUtils "gitlab.kenda.com.tw/kenda/mui/server/impl/handlers/mcom/utils"
 	"gitlab.kenda.com.tw/kenda/mui/server/impl/service"
 	"gitlab.kenda.com.tw/kenda/mui/server/impl/utils"
+	"gitlab.kenda.com.tw/kenda/mui/server/impl/utils/saga"
 	mesageModels "gitlab.kenda.com.tw/kenda/mui/server/models"
 	"gitlab.kenda.com.tw/kenda/mui/server/protobuf/kenda"
 	"gitlab.kenda.com.tw/kenda/mui/server/swagger/models"
@@ -51,6 +53,14 @@ const (
 
 type Config struct {
 	StationFunctionConfig map[string]configs.FunctionAPIPath
+	// Defects keeps the defects of the collects.
+	Defects database.DefectStore
+	// Collects keeps the reversals of the collects.
+	Collects database.CollectStore
+	// Imports keeps the previews of the uploaded work order files.
+	Imports database.WorkOrderImportStore
+	// WorkOrders keeps the merges and the locks of the work orders.
+	WorkOrders database.WorkOrderStore
 }
 
 // workorder definitions.
@@ -60,28 +70,8 @@ type WorkOrder struct {
 	hasPermission func(id kenda.FunctionOperationID, roles []models.Role) bool
 }
 
-type Row []string
-
-func (r Row) Column(i int) string {
-	if len(r) <= i {
-		return ""
-	}
-	return r[i]
-}
-
-// get excel column index
-func excelColIndex(i int) string {
-	return string(rune('A' + i))
-}
-
-// parse excel bad column
-func excelBadColumns(header Row, colIndex []int) []string {
-	dataOut := make([]string, len(colIndex))
-	for i, index := range colIndex {
-		dataOut[i] = fmt.Sprintf("%s(%s)", excelColIndex(index), header.Column(index))
-	}
-	return dataOut
-}
+// Row is a row of the uploaded work order file.
+type Row = handlerUtils.Row
 
 // NewWorkOrder returns WorkOrder service.
 func NewWorkOrder(
@@ -180,6 +170,46 @@ func (w WorkOrder) UpdateStationScheduling(params work_order.UpdateStationSchedu
 
 	ctx := commonsCtx.WithUserID(params.HTTPRequest.Context(), principal.ID)
 
+	ids := make([]string, len(params.Body))
+	for i, body := range params.Body {
+		if time.Time(body.UpdateAt).IsZero() {
+			return work_order.NewUpdateStationSchedulingPreconditionRequired().WithPayload(missingUpdateAt(*body.ID))
+		}
+		ids[i] = *body.ID
+	}
+	unlock, err := w.lockWorkOrders(ctx, ids...)
+	if errors.Is(err, database.ErrRecordLocked) {
+		conflict, err := w.lockConflict(ctx, ids...)
+		if err != nil {
+			return utils.ParseError(ctx, work_order.NewUpdateStationSchedulingDefault(0), err)
+		}
+		return work_order.NewUpdateStationSchedulingConflict().WithPayload(conflict)
+	}
+	if err != nil {
+		return utils.ParseError(ctx, work_order.NewUpdateStationSchedulingDefault(0), err)
+	}
+	defer unlock()
+
+	var updated []mcom.GetWorkOrderReply
+	for _, body := range params.Body {
+		wo, err := w.dm.GetWorkOrder(ctx, mcom.GetWorkOrderRequest{
+			ID: *body.ID,
+		})
+		if err != nil {
+			return utils.ParseError(ctx, work_order.NewUpdateStationSchedulingDefault(0), err)
+		}
+		if updatedSince(wo, body.UpdateAt) {
+			updated = append(updated, wo)
+		}
+	}
+	if len(updated) > 0 {
+		conflict, err := workOrderConflict(updated...)
+		if err != nil {
+			return utils.ParseError(ctx, work_order.NewUpdateStationSchedulingDefault(0), err)
+		}
+		return work_order.NewUpdateStationSchedulingConflict().WithPayload(conflict)
+	}
+
 	updateList := make([]mcom.UpdateWorkOrder, len(params.Body))
 	for i, body := range params.Body {
 		if *body.ForceToAbort {
@@ -209,11 +239,20 @@ func (w WorkOrder) GetStationScheduling(params work_order.GetStationSchedulingPa
 
 	ctx := commonsCtx.WithUserID(params.HTTPRequest.Context(), principal.ID)
 
+	data, err := w.stationScheduling(ctx, params.Station, time.Time(params.Date))
+	if err != nil {
+		return utils.ParseError(ctx, work_order.NewGetStationSchedulingDefault(0), err)
+	}
+	return work_order.NewGetStationSchedulingOK().WithPayload(&work_order.GetStationSchedulingOKBody{Data: data})
+}
+
+// stationScheduling returns the work orders of the station on the date.
+func (w WorkOrder) stationScheduling(ctx context.Context, station string, date time.Time) (models.WorkOrders, error) {
 	list, err := w.dm.ListWorkOrdersByDuration(ctx, mcom.ListWorkOrdersByDurationRequest{
-		Since: time.Time(params.Date),
-		Until: time.Time(params.Date),
+		Since: date,
+		Until: date,
 		// The function is to find the work order of the day, so it needs "Until" to limit the search range.
-		Station: params.Station,
+		Station: station,
 	}.WithOrder(
 		mcom.Order{
 			Name:       "reserved_date",
@@ -225,47 +264,123 @@ func (w WorkOrder) GetStationScheduling(params work_order.GetStationSchedulingPa
 		},
 	))
 	if err != nil {
-		return utils.ParseError(ctx, work_order.NewGetStationSchedulingDefault(0), err)
+		return nil, err
 	}
 	data := make(models.WorkOrders, len(list.Contents))
 	for i, wo := range list.Contents {
-		data[i] = &models.WorkOrder{
-			ID:            wo.ID,
-			BatchSize:     int64(wo.BatchQuantityType),
-			DepartmentOID: wo.DepartmentID,
-			PlanDate:      strfmt.Date(wo.Date),
-			ProductID:     wo.Product.ID,
-			Recipe: &models.Recipe{
-				ProcessName: wo.Process.Name,
-				ProcessOID:  wo.Process.OID,
-				ProcessType: wo.Process.Type,
-				ID:          wo.RecipeID,
-			},
-			Sequence: int64(wo.Sequence),
-			Station:  wo.Station,
-			Status:   models.WorkOrderStatus(wo.Status),
-			UpdateAt: strfmt.DateTime(wo.UpdatedAt),
-			UpdateBy: wo.UpdatedBy,
-			ParentID: wo.Parent,
+		if data[i], err = toWorkOrder(wo); err != nil {
+			return nil, err
 		}
+	}
+	return data, nil
+}
 
-		batchQuantityDetails, err := handlerUtils.ParseBatchQuantityDetails(wo.BatchQuantityDetails)
-		if err != nil {
-			return work_order.NewGetStationSchedulingDefault(http.StatusInternalServerError).WithPayload(
-				&models.Error{
-					Details: err.Error(),
-				},
-			)
+func toWorkOrder(wo mcom.GetWorkOrderReply) (*models.WorkOrder, error) {
+	data := &models.WorkOrder{
+		ID:            wo.ID,
+		BatchSize:     int64(wo.BatchQuantityType),
+		DepartmentOID: wo.DepartmentID,
+		PlanDate:      strfmt.Date(wo.Date),
+		ProductID:     wo.Product.ID,
+		Recipe: &models.Recipe{
+			ProcessName: wo.Process.Name,
+			ProcessOID:  wo.Process.OID,
+			ProcessType: wo.Process.Type,
+			ID:          wo.RecipeID,
+		},
+		Sequence: int64(wo.Sequence),
+		Station:  wo.Station,
+		Status:   models.WorkOrderStatus(wo.Status),
+		UpdateAt: strfmt.DateTime(wo.UpdatedAt),
+		UpdateBy: wo.UpdatedBy,
+		ParentID: wo.Parent,
+	}
+
+	batchQuantityDetails, err := handlerUtils.ParseBatchQuantityDetails(wo.BatchQuantityDetails)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(batchQuantityDetails.PerBatchQuantity) != 0 {
+		data.BatchesQuantity = handlerUtils.ToSlices(batchQuantityDetails.PerBatchQuantity)
+	} else {
+		data.BatchCount = int64(batchQuantityDetails.BatchCount)
+		data.PlanQuantity = batchQuantityDetails.PlanQuantity.String()
+	}
+	return data, nil
+}
+
+// workOrderLockLease is how long a work order is locked by an update if the
+// update does not unlock it, e.g. the server stopped while updating it.
+const workOrderLockLease = time.Minute
+
+// workOrderUnlockTimeout limits the time to unlock the work orders after an
+// update, which is done even if the request is canceled.
+const workOrderUnlockTimeout = 10 * time.Second
+
+// lockWorkOrders locks the work orders against the other updates checked by
+// updatedSince, and returns the function to unlock them.
+func (w WorkOrder) lockWorkOrders(ctx context.Context, workOrders ...string) (func(), error) {
+	owner := xid.New().String()
+	if err := w.config.WorkOrders.LockWorkOrders(ctx, owner, workOrders, workOrderLockLease); err != nil {
+		return nil, err
+	}
+	return func() {
+		ctx, cancel := context.WithTimeout(saga.Detach(ctx), workOrderUnlockTimeout)
+		defer cancel()
+		if err := w.config.WorkOrders.UnlockWorkOrders(ctx, owner, workOrders); err != nil {
+			commonsCtx.Logger(ctx).Error("failed to unlock the work orders", zap.Strings("workOrders", workOrders), zap.Error(err))
 		}
+	}, nil
+}
 
-		if len(batchQuantityDetails.PerBatchQuantity) != 0 {
-			data[i].BatchesQuantity = handlerUtils.ToSlices(batchQuantityDetails.PerBatchQuantity)
-		} else {
-			data[i].BatchCount = int64(batchQuantityDetails.BatchCount)
-			data[i].PlanQuantity = batchQuantityDetails.PlanQuantity.String()
+// lockConflict returns the conflict of the work orders locked by another
+// update with their current states.
+func (w WorkOrder) lockConflict(ctx context.Context, ids ...string) (*models.WorkOrderConflict, error) {
+	workOrders := make([]mcom.GetWorkOrderReply, len(ids))
+	for i, id := range ids {
+		var err error
+		if workOrders[i], err = w.dm.GetWorkOrder(ctx, mcom.GetWorkOrderRequest{ID: id}); err != nil {
+			return nil, err
 		}
 	}
-	return work_order.NewGetStationSchedulingOK().WithPayload(&work_order.GetStationSchedulingOKBody{Data: data})
+	conflict, err := workOrderConflict(workOrders...)
+	if err != nil {
+		return nil, err
+	}
+	conflict.Details = database.ErrRecordLocked.Error()
+	return conflict, nil
+}
+
+// missingUpdateAt is the error of an update without the updateAt of the work
+// order.
+func missingUpdateAt(id string) *models.Error {
+	return &models.Error{
+		Code:    int64(mcomErrors.Code_INSUFFICIENT_REQUEST),
+		Details: fmt.Sprintf("missing updateAt of work order %s", id),
+	}
+}
+
+// updatedSince reports whether the work order has been updated since the
+// updateAt returned by the APIs, which is in milliseconds.
+func updatedSince(wo mcom.GetWorkOrderReply, updateAt strfmt.DateTime) bool {
+	return !wo.UpdatedAt.Truncate(time.Millisecond).Equal(time.Time(updateAt).Truncate(time.Millisecond))
+}
+
+// workOrderConflict returns the conflict of the work orders with their current
+// states.
+func workOrderConflict(workOrders ...mcom.GetWorkOrderReply) (*models.WorkOrderConflict, error) {
+	data := make(models.WorkOrders, len(workOrders))
+	for i, wo := range workOrders {
+		var err error
+		if data[i], err = toWorkOrder(wo); err != nil {
+			return nil, err
+		}
+	}
+	return &models.WorkOrderConflict{
+		Details: database.ErrVersionConflict.Error(),
+		Data:    data,
+	}, nil
 }
 
 // ListWorkOrders implements.
@@ -276,9 +391,19 @@ func (w WorkOrder) ListWorkOrders(params work_order.ListWorkOrdersParams, princi
 
 	ctx := commonsCtx.WithUserID(params.HTTPRequest.Context(), principal.ID)
 
+	data, err := w.listWorkOrders(ctx, params.StationID, time.Time(params.WorkDate))
+	if err != nil {
+		return utils.ParseError(ctx, work_order.NewListWorkOrdersDefault(0), err)
+	}
+	return work_order.NewListWorkOrdersOK().WithPayload(&work_order.ListWorkOrdersOKBody{Data: data})
+}
+
+// listWorkOrders returns the pending, active and closing work orders of the
+// station since 9 days before the work date.
+func (w WorkOrder) listWorkOrders(ctx context.Context, station string, workDate time.Time) ([]*work_order.ListWorkOrdersOKBodyDataItems0, error) {
 	list, err := w.dm.ListWorkOrdersByDuration(ctx, mcom.ListWorkOrdersByDurationRequest{
-		Since:   time.Time(params.WorkDate).AddDate(0, 0, -9),
-		Station: params.StationID,
+		Since:   workDate.AddDate(0, 0, -9),
+		Station: station,
 	}.WithOrder(
 		mcom.Order{
 			Name:       "reserved_date",
@@ -290,7 +415,7 @@ func (w WorkOrder) ListWorkOrders(params work_order.ListWorkOrdersParams, princi
 		},
 	))
 	if err != nil {
-		return utils.ParseError(ctx, work_order.NewListWorkOrdersDefault(0), err)
+		return nil, err
 	}
 
 	data := []*work_order.ListWorkOrdersOKBodyDataItems0{}
@@ -299,11 +424,7 @@ func (w WorkOrder) ListWorkOrders(params work_order.ListWorkOrdersParams, princi
 		if wo.Status == workorder.Status_PENDING || wo.Status == workorder.Status_ACTIVE || wo.Status == workorder.Status_CLOSING {
 			batchQuantityDetails, err := handlerUtils.ParseBatchQuantityDetails(wo.BatchQuantityDetails)
 			if err != nil {
-				return work_order.NewListWorkOrdersDefault(http.StatusInternalServerError).WithPayload(
-					&models.Error{
-						Details: err.Error(),
-					},
-				)
+				return nil, err
 			}
 
 			data = append(data, &work_order.ListWorkOrdersOKBodyDataItems0{
@@ -317,7 +438,7 @@ func (w WorkOrder) ListWorkOrders(params work_order.ListWorkOrdersParams, princi
 			})
 		}
 	}
-	return work_order.NewListWorkOrdersOK().WithPayload(&work_order.ListWorkOrdersOKBody{Data: data})
+	return data, nil
 }
 
 // ListWorkOrdersRate implements.
@@ -338,31 +459,71 @@ func (w WorkOrder) ListWorkOrdersRate(params work_order.ListWorkOrdersRateParams
 
 	orderRequest := parseOrderRequest(params.Body.OrderRequest, getWorkOrderListInfoByTypeDefaultOrderFunc)
 
-	list, err := w.dm.ListWorkOrdersByDuration(ctx, mcom.ListWorkOrdersByDurationRequest{
-		Since:        time.Time(params.WorkStartDate),
-		Until:        time.Time(params.WorkEndDate),
-		DepartmentID: params.DepartmentID,
-	}.WithPagination(pageRequest).
-		WithOrder(orderRequest...))
+	data, total, err := w.workOrdersRate(ctx, rateQuery{
+		department: params.DepartmentID,
+		since:      time.Time(params.WorkStartDate),
+		until:      time.Time(params.WorkEndDate),
+		page:       pageRequest,
+		orders:     orderRequest,
+	})
 	if err != nil {
 		return utils.ParseError(ctx, work_order.NewListWorkOrdersRateDefault(0), err)
 	}
+	return work_order.NewListWorkOrdersRateOK().WithPayload(&work_order.ListWorkOrdersRateOKBody{
+		Data: &work_order.ListWorkOrdersRateOKBodyData{
+			Items: data,
+			Total: total},
+	})
+}
+
+// rateQuery is the conditions of the production rates.
+type rateQuery struct {
+	department   string
+	since, until time.Time
+	// page is empty for all the work orders.
+	page   mcom.PaginationRequest
+	orders []mcom.Order
+}
+
+// workOrdersRate returns the production rates of the work orders and the
+// total number of the work orders.
+func (w WorkOrder) workOrdersRate(ctx context.Context, query rateQuery) ([]*models.WorkOrderRateData, int64, error) {
+	list, err := w.dm.ListWorkOrdersByDuration(ctx, mcom.ListWorkOrdersByDurationRequest{
+		Since:        query.since,
+		Until:        query.until,
+		DepartmentID: query.department,
+	}.WithPagination(query.page).
+		WithOrder(query.orders...))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	ids := make([]string, len(list.Contents))
+	for i, wo := range list.Contents {
+		ids[i] = wo.ID
+	}
+	defects, err := w.sumDefects(ctx, ids)
+	if err != nil {
+		return nil, 0, err
+	}
+	reversed, err := w.config.Collects.SumReversedQuantities(ctx, ids)
+	if err != nil {
+		return nil, 0, err
+	}
 
 	data := make([]*models.WorkOrderRateData, len(list.Contents))
 	for j, wo := range list.Contents {
 		batchQuantityDetails, err := handlerUtils.ParseBatchQuantityDetails(wo.BatchQuantityDetails)
 		if err != nil {
-			return work_order.NewListWorkOrdersRateDefault(http.StatusInternalServerError).WithPayload(
-				&models.Error{
-					Details: err.Error(),
-				},
-			)
+			return nil, 0, err
 		}
+		// the data manager keeps the quantities of the reversed collects.
+		collected := wo.CollectedQuantity.Sub(reversed[wo.ID])
 		var ratio float64 = 0
-		if wo.CollectedQuantity.LessThanOrEqual(batchQuantityDetails.PlanQuantity) {
-			ratio = (wo.CollectedQuantity.InexactFloat64() / batchQuantityDetails.PlanQuantity.InexactFloat64()) * 100
+		if collected.LessThanOrEqual(batchQuantityDetails.PlanQuantity) {
+			ratio = (collected.InexactFloat64() / batchQuantityDetails.PlanQuantity.InexactFloat64()) * 100
 		} else {
-			ratio = 100 - (((wo.CollectedQuantity.InexactFloat64() - batchQuantityDetails.PlanQuantity.InexactFloat64()) / batchQuantityDetails.PlanQuantity.InexactFloat64()) * 100)
+			ratio = 100 - (((collected.InexactFloat64() - batchQuantityDetails.PlanQuantity.InexactFloat64()) / batchQuantityDetails.PlanQuantity.InexactFloat64()) * 100)
 		}
 
 		var productionTime string = ""
@@ -374,7 +535,7 @@ func (w WorkOrder) ListWorkOrdersRate(params work_order.ListWorkOrdersRateParams
 					Number:    int16(1),
 				})
 				if err != nil {
-					return utils.ParseError(ctx, work_order.NewListWorkOrdersRateDefault(0), err)
+					return nil, 0, err
 				}
 				if batch.Info.Status == int32(workorder.BatchStatus_BATCH_STARTED) || batch.Info.Status == int32(workorder.BatchStatus_BATCH_CLOSING) || batch.Info.Status == int32(workorder.BatchStatus_BATCH_CLOSED) {
 					if len(batch.Info.Records) != 0 {
@@ -392,20 +553,62 @@ func (w WorkOrder) ListWorkOrdersRate(params work_order.ListWorkOrdersRateParams
 			ProductID:         wo.Product.ID,
 			Station:           wo.Station,
 			PlanQuantity:      batchQuantityDetails.PlanQuantity.String(),
-			CollectedQuantity: wo.CollectedQuantity.String(),
+			CollectedQuantity: collected.String(),
 			Ratio:             fmt.Sprintf("%.2f%%", ratio),
 			ProductionTime:    &productionTime,
 			ProductionEndTime: &productionEndTime,
 			UpdateBy:          wo.UpdatedBy,
 			CreatedBy:         wo.InsertedBy,
 			RecipeID:          wo.RecipeID,
+			DefectQuantity:    defects[wo.ID].defect.String(),
+			ScrapQuantity:     defects[wo.ID].scrap.String(),
+			Yield:             defects[wo.ID].yield(collected),
 		}
 	}
-	return work_order.NewListWorkOrdersRateOK().WithPayload(&work_order.ListWorkOrdersRateOKBody{
-		Data: &work_order.ListWorkOrdersRateOKBodyData{
-			Items: data,
-			Total: list.AmountOfData},
-	})
+	return data, list.AmountOfData, nil
+}
+
+// defectSummary is the defects of a work order.
+type defectSummary struct {
+	defect decimal.Decimal
+	scrap  decimal.Decimal
+	totals []*models.DefectTotal
+}
+
+// yield returns the ratio of the collected quantity to all the produced
+// quantity.
+func (d defectSummary) yield(collected decimal.Decimal) string {
+	produced := collected.Add(d.defect).Add(d.scrap)
+	if produced.IsZero() {
+		return fmt.Sprintf("%.2f%%", float64(0))
+	}
+	return fmt.Sprintf("%.2f%%", collected.Div(produced).InexactFloat64()*100)
+}
+
+// sumDefects returns the defects of the work orders by work order, excluding
+// the defects of the voided collects.
+func (w WorkOrder) sumDefects(ctx context.Context, workOrders []string) (map[string]defectSummary, error) {
+	sums, err := w.config.Defects.SumCollectDefects(ctx, workOrders)
+	if err != nil {
+		return nil, err
+	}
+	summaries := make(map[string]defectSummary)
+	for _, sum := range sums {
+		summary := summaries[sum.WorkOrder]
+		switch sum.Kind {
+		case database.DefectKindDefect:
+			summary.defect = summary.defect.Add(sum.Quantity)
+		case database.DefectKindScrap:
+			summary.scrap = summary.scrap.Add(sum.Quantity)
+		}
+		summary.totals = append(summary.totals, &models.DefectTotal{
+			ReasonCode: sum.ReasonCode,
+			Kind:       models.DefectKind(sum.Kind),
+			Quantity:   sum.Quantity.String(),
+		})
+		summaries[sum.WorkOrder] = summary
+	}
+	return summaries, nil
 }
 
 func parseOrderRequest(dataIn []*work_order.ListWorkOrdersRateParamsBodyOrderRequestItems0, defaultOrderFunc func() []mcom.Order) []mcom.Order {
@@ -534,6 +737,21 @@ func (w WorkOrder) GetWorkOrderInformation(params work_order.GetWorkOrderInforma
 		)
 	}
 
+	defects, err := w.sumDefects(ctx, []string{getWorkOrder.ID})
+	if err != nil {
+		return utils.ParseError(ctx, work_order.NewGetWorkOrderInformationDefault(0), err)
+	}
+	defect := defects[getWorkOrder.ID]
+	if defect.totals == nil {
+		defect.totals = []*models.DefectTotal{}
+	}
+	reversed, err := w.config.Collects.SumReversedQuantities(ctx, []string{getWorkOrder.ID})
+	if err != nil {
+		return utils.ParseError(ctx, work_order.NewGetWorkOrderInformationDefault(0), err)
+	}
+	// the data manager keeps the quantities of the reversed collects.
+	collected := getWorkOrder.CollectedQuantity.Sub(reversed[getWorkOrder.ID])
+
 	// materials & tools & useValue(max min mid)
 	getRecipe, err := w.dm.GetProcessDefinition(ctx, mcom.GetProcessDefinitionRequest{
 		RecipeID:    getWorkOrder.RecipeID,
@@ -718,7 +936,11 @@ func (w WorkOrder) GetWorkOrderInformation(params work_order.GetWorkOrderInforma
 			CollectSequence: int64(getWorkOrder.CollectedSequence),
 			PlanQuantity:    batchQuantityDetails.PlanQuantity.String(),
 			CurrentBatch:    int64(getWorkOrder.CurrentBatch),
-			CurrentQuantity: getWorkOrder.CollectedQuantity.InexactFloat64(),
+			CurrentQuantity: collected.InexactFloat64(),
+			DefectQuantity:  defect.defect.String(),
+			ScrapQuantity:   defect.scrap.String(),
+			Yield:           defect.yield(collected),
+			Defects:         defect.totals,
 			Recipe: &work_order.GetWorkOrderInformationOKBodyDataRecipe{
 				Materials: materials,
 				Tools:     tools,
@@ -727,203 +949,6 @@ func (w WorkOrder) GetWorkOrderInformation(params work_order.GetWorkOrderInforma
 	})
 }
 
-func (w WorkOrder) CreateWorkOrdersFromFile(params work_order.CreateWorkOrdersFromFileParams, principal *models.Principal) middleware.Responder {
-	if !w.hasPermission(kenda.FunctionOperationID_CREATE_WORK_ORDERS_FROM_FILE, principal.Roles) {
-		return work_order.NewCreateWorkOrdersFromFileDefault(http.StatusForbidden)
-	}
-	ctx := commonsCtx.WithUserID(params.HTTPRequest.Context(), principal.ID)
-
-	rows, err := getExcelRows(params.UploadFile)
-	if err != nil {
-		return utils.ParseError(ctx, work_order.NewCreateWorkOrdersFromFileDefault(0), err)
-	}
-	params.UploadFile.Close()
-
-	createRequest, failData, err := parseCreateWorkOrdersRequest(ctx, w.dm, params.Department, rows)
-	if err != nil {
-		return utils.ParseError(ctx, work_order.NewCreateWorkOrdersFromFileDefault(0), err)
-	}
-	if len(failData) > 0 {
-		return work_order.NewCreateWorkOrdersFromFileOK().WithPayload(&work_order.CreateWorkOrdersFromFileOKBody{
-			Data: &work_order.CreateWorkOrdersFromFileOKBodyData{
-				FailData: failData,
-			},
-		})
-	}
-
-	_, err = w.dm.CreateWorkOrders(ctx, createRequest)
-	if err != nil {
-		return utils.ParseError(ctx, work_order.NewCreateWorkOrdersFromFileDefault(0), err)
-	}
-
-	return work_order.NewCreateWorkOrdersFromFileOK().WithPayload(&work_order.CreateWorkOrdersFromFileOKBody{
-		Data: &work_order.CreateWorkOrdersFromFileOKBodyData{
-			FailData: []*work_order.CreateWorkOrdersFromFileOKBodyDataFailDataItems0{},
-		},
-	})
-}
-
-func getExcelRows(file io.Reader) ([][]string, error) {
-	f, err := excelize.OpenReader(file)
-	if err != nil {
-		return nil, err
-	}
-	defer f.Close()
-
-	// get sheet name list
-	sheetList := f.GetSheetList()
-
-	// if empty sheet
-	if len(sheetList) == 0 {
-		return nil, mcomErrors.Error{
-			Code:    mcomErrors.Code_INSUFFICIENT_REQUEST,
-			Details: "no sheet",
-		}
-	}
-
-	return f.GetRows(sheetList[0])
-}
-
-func parseCreateWorkOrdersRequest(ctx context.Context, dm mcom.DataManager, department string, rows [][]string) (mcom.CreateWorkOrdersRequest, []*work_order.CreateWorkOrdersFromFileOKBodyDataFailDataItems0, error) {
-	/*
-		excel column name
-		0 row[colProductID]				productID
-		1 row[colStation]				stationID
-		2 row[colVersionStage]			versionStage
-		3 row[colRecipeID]				recipeID
-		4 row[colProcessName]			processName
-		5 row[colProcessType]			processType
-		6 row[colExcelBatchSize]		batchSize 0:FixedQuantity;1:PlanQuantity
-		7 row[colExcelBatchSizeMode]	batch/planQuantity
-		8 row[colExcelRecipeBatchSize]	recipe batchSize
-		9 row[colDate]					date
-	*/
-
-	// if file empty
-	if len(rows) <= 1 {
-		return mcom.CreateWorkOrdersRequest{}, nil, mcomErrors.Error{
-			Code:    mcomErrors.Code_INSUFFICIENT_REQUEST,
-			Details: "file empty",
-		}
-	}
-
-	header := Row(rows[0])
-	rows = rows[1:]
-
-	var failData []*work_order.CreateWorkOrdersFromFileOKBodyDataFailDataItems0
-
-	createRequest := []mcom.CreateWorkOrder{}
-
-	for i, r := range rows {
-		var failColumns []int
-		var (
-			batchSize *decimal.Decimal
-			row       Row = r
-		)
-
-		tempCreateRequest := mcom.CreateWorkOrder{
-			DepartmentID: department,
-			Station:      row.Column(colStation),
-			RecipeID:     row.Column(colRecipeID),
-			ProcessName:  row.Column(colProcessName),
-			ProcessType:  row.Column(colProcessType),
-		}
-
-		// check recipeID
-		if tempCreateRequest.RecipeID == "" {
-			// check productID
-			if row.Column(colProductID) != "" {
-				latestRecipe, err := getLatestRecipe(ctx, dm, Row(r))
-
-				// if err length not 0
-				if len(err) != 0 {
-					failColumns = append(failColumns, err...)
-				} else {
-					tempCreateRequest.RecipeID = latestRecipe.ID
-
-					// find the process with station
-					for _, i := range latestRecipe.Processes {
-						var find bool
-						// get batchSize
-						batchSize, find = findBatchSize(i.Info, row)
-						if find {
-							tempCreateRequest.ProcessOID = i.Info.OID
-							break
-						}
-					}
-				}
-			} else {
-				failColumns = append(failColumns, colProductID)
-			}
-		} else {
-			// get processID & recipe batchSize
-			getProcessDefinition, err := dm.GetProcessDefinition(ctx, mcom.GetProcessDefinitionRequest{
-				RecipeID:    tempCreateRequest.RecipeID,
-				ProcessName: tempCreateRequest.ProcessName,
-				ProcessType: tempCreateRequest.ProcessType,
-			})
-
-			// if err equal Code_PROCESS_NOT_FOUND
-			if err != nil {
-				if e, ok := mcomErrors.As(err); ok {
-					if e.Code == mcomErrors.Code_PROCESS_NOT_FOUND || e.Code == mcomErrors.Code_INSUFFICIENT_REQUEST {
-						failColumns = append(failColumns, colRecipeID, colProcessName, colProcessType)
-					} else {
-						return mcom.CreateWorkOrdersRequest{}, nil, err
-					}
-				}
-			} else {
-				// check output ID
-				if getProcessDefinition.Output.ID != row.Column(colProductID) {
-					failColumns = append(failColumns, colProductID)
-				}
-				//check station
-				if !recipeStationCheck(getProcessDefinition.ProcessDefinition, tempCreateRequest.Station) {
-					failColumns = append(failColumns, colStation)
-				}
-
-				tempCreateRequest.ProcessOID = getProcessDefinition.OID
-				// get batchSize
-				batchSize, _ = findBatchSize(getProcessDefinition.ProcessDefinition, row)
-			}
-		}
-
-		// batchQuantity
-		batchQuantity, badColumnsIndex := parseBatchQuantity(batchSize, row)
-		// check error index is nil
-		if len(badColumnsIndex) != 0 {
-			failColumns = append(failColumns, badColumnsIndex...)
-		} else {
-			tempCreateRequest.BatchesQuantity = batchQuantity
-		}
-
-		// parse date
-		date, err := time.Parse("2006-01-02", row.Column(colDate))
-		if err != nil {
-			failColumns = append(failColumns, colDate)
-		} else {
-			tempCreateRequest.Date = date
-		}
-
-		createRequest = append(createRequest, tempCreateRequest)
-
-		if len(failColumns) != 0 {
-			failData = append(failData, &work_order.CreateWorkOrdersFromFileOKBodyDataFailDataItems0{
-				Index:   int64(i + 2),
-				Columns: excelBadColumns(header, failColumns),
-			})
-		}
-	}
-
-	if len(failData) > 0 {
-		return mcom.CreateWorkOrdersRequest{}, failData, nil
-	}
-
-	return mcom.CreateWorkOrdersRequest{
-		WorkOrders: createRequest,
-	}, nil, nil
-}
-
 func getLatestRecipe(ctx context.Context, dm mcom.DataManager, dataIn Row) (mcom.GetRecipeReply, []int) {
 	var (
 		dataOut     []mcom.GetRecipeReply
@@ -1004,15 +1029,33 @@ func processCheck(processInfo mcom.ProcessDefinition, dataIn Row) bool {
 	return false
 }
 
+// batchPlan is the batches and the plan quantity of a work order.
+type batchPlan struct {
+	// byPlanQuantity is false for the fixed batches.
+	byPlanQuantity bool
+	batches        uint
+	planQuantity   decimal.Decimal
+}
+
+func (b batchPlan) batchQuantity() mcom.BatchQuantity {
+	if b.byPlanQuantity {
+		return mcom.NewPlanQuantity(b.batches, b.planQuantity)
+	}
+	return mcom.NewFixedQuantity(b.batches, b.planQuantity)
+}
+
 // parseBatchQuantity if the length of `badColumnsIndex` is 0, it means there is no
 // bad column, otherwise it does and `batchQuantity` is nil.
 func parseBatchQuantity(batchSize *decimal.Decimal, row Row) (batchQuantity mcom.BatchQuantity, badColumnsIndex []int) {
-	var (
-		batchesQuantity mcom.BatchQuantity
-		batch           int
-		planQuantity    decimal.Decimal
-	)
+	plan, badColumnsIndex := parseBatchPlan(batchSize, row)
+	if len(badColumnsIndex) > 0 {
+		return nil, badColumnsIndex
+	}
+	return plan.batchQuantity(), nil
+}
 
+// parseBatchPlan is like parseBatchQuantity but returns the plan.
+func parseBatchPlan(batchSize *decimal.Decimal, row Row) (plan batchPlan, badColumnsIndex []int) {
 	if batchSize == nil || batchSize.Equals(decimal.Zero) {
 		if row.Column(colExcelRecipeBatchSize) != "" {
 			size, err := decimal.NewFromString(row.Column(colExcelRecipeBatchSize))
@@ -1037,8 +1080,10 @@ func parseBatchQuantity(batchSize *decimal.Decimal, row Row) (batchQuantity mcom
 			break
 		}
 
-		planQuantity = decimal.NewFromInt(int64(batch)).Mul(*batchSize)
-		batchesQuantity = mcom.NewFixedQuantity(uint(batch), planQuantity)
+		plan = batchPlan{
+			batches:      uint(batch),
+			planQuantity: decimal.NewFromInt(int64(batch)).Mul(*batchSize),
+		}
 	// 1:PlanQuantity
 	case "1":
 		planQuantity, err := decimal.NewFromString(row.Column(colExcelBatchSizeData))
@@ -1051,16 +1096,19 @@ func parseBatchQuantity(batchSize *decimal.Decimal, row Row) (batchQuantity mcom
 			break
 		}
 
-		batch = int(planQuantity.Div(*batchSize).Ceil().IntPart())
-		batchesQuantity = mcom.NewPlanQuantity(uint(batch), planQuantity)
+		plan = batchPlan{
+			byPlanQuantity: true,
+			batches:        uint(planQuantity.Div(*batchSize).Ceil().IntPart()),
+			planQuantity:   planQuantity,
+		}
 	default:
 		badColumnsIndex = append(badColumnsIndex, colExcelBatchSize, colExcelBatchSizeData)
 	}
 
 	if len(badColumnsIndex) > 0 {
-		return nil, badColumnsIndex
+		return batchPlan{}, badColumnsIndex
 	}
-	return batchesQuantity, nil
+	return plan, nil
 }
 
 func recipeStationCheck(process mcom.ProcessDefinition, station string) bool {
@@ -1099,12 +1147,35 @@ func (w WorkOrder) UpdateWorkOrder(params work_order.UpdateWorkOrderParams, prin
 		return work_order.NewUpdateWorkOrderDefault(http.StatusBadRequest).WithPayload(err)
 	}
 
+	if time.Time(params.Body.UpdateAt).IsZero() {
+		return work_order.NewUpdateWorkOrderPreconditionRequired().WithPayload(missingUpdateAt(params.ID))
+	}
+	unlock, e := w.lockWorkOrders(ctx, params.ID)
+	if errors.Is(e, database.ErrRecordLocked) {
+		conflict, e := w.lockConflict(ctx, params.ID)
+		if e != nil {
+			return utils.ParseError(ctx, work_order.NewUpdateWorkOrderDefault(0), e)
+		}
+		return work_order.NewUpdateWorkOrderConflict().WithPayload(conflict)
+	}
+	if e != nil {
+		return utils.ParseError(ctx, work_order.NewUpdateWorkOrderDefault(0), e)
+	}
+	defer unlock()
+
 	getWorkOrderRep, e := w.dm.GetWorkOrder(ctx, mcom.GetWorkOrderRequest{
 		ID: params.ID,
 	})
 	if e != nil {
 		return utils.ParseError(ctx, work_order.NewUpdateWorkOrderDefault(0), e)
 	}
+	if updatedSince(getWorkOrderRep, params.Body.UpdateAt) {
+		conflict, e := workOrderConflict(getWorkOrderRep)
+		if e != nil {
+			return utils.ParseError(ctx, work_order.NewUpdateWorkOrderDefault(0), e)
+		}
+		return work_order.NewUpdateWorkOrderConflict().WithPayload(conflict)
+	}
 	if getWorkOrderRep.Status != workorder.Status_PENDING {
 		return utils.ParseError(ctx, work_order.NewUpdateWorkOrderDefault(0), mcomErrors.Error{
 			Code:    mcomErrors.Code_BAD_REQUEST,
@@ -24,6 +24,8 @@ import (
 	"gitlab.kenda.com.tw/kenda/mcom/utils/types"
 	mcomWorkOrder "gitlab.kenda.com.tw/kenda/mcom/utils/workorder"
 
+	"gitlab.kenda.com.tw/kenda/mui/server/database"
+	"gitlab.kenda.com.tw/kenda/mui/server/database/storetest"
 	"gitlab.kenda.com.tw/kenda/mui/server/impl/handlers/mcom/account"
 	"gitlab.kenda.com.tw/kenda/mui/server/impl/service"
 	"gitlab.kenda.com.tw/kenda/mui/server/protobuf/kenda"
@@ -428,7 +430,7 @@ func TestWorkOrder_GetStationScheduling(t *testing.T) {
 			dm, err := mock.New(tt.script)
 			assert.NoErrorf(err, tt.name)
 
-			s := mustNewWorkorder(dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
+			s := mustNewWorkorder(t, dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
 				return true
 			})
 			if got := s.GetStationScheduling(tt.args.params, tt.args.principal); !assert.Equal(got, tt.want) {
@@ -440,7 +442,7 @@ func TestWorkOrder_GetStationScheduling(t *testing.T) {
 	}
 	{ // forbidden access
 		dm, _ := mock.New([]mock.Script{})
-		s := mustNewWorkorder(dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
+		s := mustNewWorkorder(t, dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
 			return false
 		})
 		rep, ok := s.GetStationScheduling(work_order.GetStationSchedulingParams{
@@ -748,7 +750,7 @@ func TestWorkOrder_CreateStationScheduling(t *testing.T) {
 			dm, err := mock.New(tt.script)
 			assert.NoErrorf(err, tt.name)
 
-			s := mustNewWorkorder(dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
+			s := mustNewWorkorder(t, dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
 				return true
 			})
 			if got := s.CreateStationScheduling(tt.args.params, tt.args.principal); !assert.Equal(got, tt.want) {
@@ -760,7 +762,7 @@ func TestWorkOrder_CreateStationScheduling(t *testing.T) {
 	}
 	{ // forbidden access
 		dm, _ := mock.New([]mock.Script{})
-		s := mustNewWorkorder(dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
+		s := mustNewWorkorder(t, dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
 			return false
 		})
 		rep, ok := s.CreateStationScheduling(work_order.CreateStationSchedulingParams{
@@ -787,7 +789,31 @@ func TestWorkOrder_CreateStationScheduling(t *testing.T) {
 
 func TestWorkOrder_UpdateStationScheduling(t *testing.T) {
 	assert := assert.New(t)
+	scheduledWorkOrder := mcom.GetWorkOrderReply{
+		ID:                   testWorkOrder1,
+		Status:               workorder.Status_PENDING,
+		DepartmentID:         testDepartmentOID,
+		Station:              testStationA,
+		Sequence:             1,
+		Date:                 testSchedulingDate,
+		BatchQuantityDetails: mcom.NewFixedQuantity(2, decimal.NewFromFloat(testPlanQuantity)).Detail(),
+		UpdatedBy:            userID,
+		UpdatedAt:            testUpdateDate,
+	}
+	getWorkOrder := mock.Script{
+		Name: mock.FuncGetWorkOrder,
+		Input: mock.Input{
+			Request: mcom.GetWorkOrderRequest{
+				ID: testWorkOrder1,
+			},
+		},
+		Output: mock.Output{
+			Response: scheduledWorkOrder,
+		},
+	}
+	updateAt := strfmt.DateTime(testUpdateDate.Truncate(time.Millisecond))
 	dm, err := mock.New([]mock.Script{
+		getWorkOrder,
 		{
 			Name: mock.FuncUpdateWorkOrders,
 			Input: mock.Input{
@@ -802,6 +828,7 @@ func TestWorkOrder_UpdateStationScheduling(t *testing.T) {
 			},
 			Output: mock.Output{},
 		},
+		getWorkOrder,
 		{
 			Name: mock.FuncUpdateWorkOrders,
 			Input: mock.Input{
@@ -816,6 +843,7 @@ func TestWorkOrder_UpdateStationScheduling(t *testing.T) {
 			},
 			Output: mock.Output{},
 		},
+		getWorkOrder,
 		{
 			Name: mock.FuncUpdateWorkOrders,
 			Input: mock.Input{
@@ -834,6 +862,7 @@ func TestWorkOrder_UpdateStationScheduling(t *testing.T) {
 				},
 			},
 		},
+		getWorkOrder,
 		{
 			Name: mock.FuncUpdateWorkOrders,
 			Input: mock.Input{
@@ -850,6 +879,7 @@ func TestWorkOrder_UpdateStationScheduling(t *testing.T) {
 				Error: errors.New(testInternalServerError),
 			},
 		},
+		getWorkOrder,
 	})
 	assert.NoError(err)
 
@@ -875,6 +905,7 @@ func TestWorkOrder_UpdateStationScheduling(t *testing.T) {
 							ID:           &testWorkOrder1,
 							ForceToAbort: &falseToAbort,
 							Sequence:     &updateSequence,
+							UpdateAt:     updateAt,
 						},
 					},
 				},
@@ -891,6 +922,7 @@ func TestWorkOrder_UpdateStationScheduling(t *testing.T) {
 						{
 							ID:           &testWorkOrder1,
 							ForceToAbort: &trueToAbort,
+							UpdateAt:     updateAt,
 						},
 					},
 				},
@@ -907,6 +939,7 @@ func TestWorkOrder_UpdateStationScheduling(t *testing.T) {
 						{
 							ID:           &testWorkOrder1,
 							ForceToAbort: &trueToAbort,
+							UpdateAt:     updateAt,
 						},
 					},
 				},
@@ -925,6 +958,7 @@ func TestWorkOrder_UpdateStationScheduling(t *testing.T) {
 						{
 							ID:           &testWorkOrder1,
 							ForceToAbort: &trueToAbort,
+							UpdateAt:     updateAt,
 						},
 					},
 				},
@@ -934,20 +968,102 @@ func TestWorkOrder_UpdateStationScheduling(t *testing.T) {
 				Details: testInternalServerError,
 			}),
 		},
+		{
+			name: "version conflict",
+			args: args{
+				params: work_order.UpdateStationSchedulingParams{
+					HTTPRequest: httpRequestWithHeader,
+					Body: []*work_order.UpdateStationSchedulingParamsBodyItems0{
+						{
+							ID:           &testWorkOrder1,
+							ForceToAbort: &falseToAbort,
+							Sequence:     &updateSequence,
+							UpdateAt:     strfmt.DateTime(testUpdateDate.Add(-time.Minute)),
+						},
+					},
+				},
+				principal: principal,
+			},
+			want: work_order.NewUpdateStationSchedulingConflict().WithPayload(&models.WorkOrderConflict{
+				Details: database.ErrVersionConflict.Error(),
+				Data: models.WorkOrders{
+					{
+						ID:            testWorkOrder1,
+						BatchSize:     int64(mcomWorkOrder.BatchSize_FIXED_QUANTITY),
+						BatchCount:    2,
+						PlanQuantity:  fmt.Sprint(testPlanQuantity),
+						DepartmentOID: testDepartmentOID,
+						PlanDate:      strfmt.Date(testSchedulingDate),
+						Recipe:        &models.Recipe{},
+						Sequence:      1,
+						Station:       testStationA,
+						Status:        models.WorkOrderStatus(workorder.Status_PENDING),
+						UpdateAt:      strfmt.DateTime(testUpdateDate),
+						UpdateBy:      userID,
+					},
+				},
+			}),
+		},
+		{
+			name: "missing updateAt",
+			args: args{
+				params: work_order.UpdateStationSchedulingParams{
+					HTTPRequest: httpRequestWithHeader,
+					Body: []*work_order.UpdateStationSchedulingParamsBodyItems0{
+						{
+							ID:           &testWorkOrder1,
+							ForceToAbort: &trueToAbort,
+						},
+					},
+				},
+				principal: principal,
+			},
+			want: work_order.NewUpdateStationSchedulingPreconditionRequired().WithPayload(&models.Error{
+				Code:    int64(mcomErrors.Code_INSUFFICIENT_REQUEST),
+				Details: "missing updateAt of work order " + testWorkOrder1,
+			}),
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			s := mustNewWorkorder(dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
-				return true
-			})
+			store := newWorkOrderStore()
+			stores := newWorkOrderStores(t)
+			s := NewWorkOrder(dm, allowAll, Config{Defects: stores.Defects, Collects: stores.Collects, WorkOrders: store})
 			if got := s.UpdateStationScheduling(tt.args.params, tt.args.principal); !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("Update() = %v, want %v", got, tt.want)
 			}
+			assert.Empty(store.locks, tt.name)
 		})
 	}
 	assert.NoError(dm.Close())
+	{ // locked by another update
+		dm, err := mock.New([]mock.Script{getWorkOrder})
+		assert.NoError(err)
+		store := newWorkOrderStore()
+		store.locks[testWorkOrder1] = "another"
+		stores := newWorkOrderStores(t)
+		s := NewWorkOrder(dm, allowAll, Config{Defects: stores.Defects, Collects: stores.Collects, WorkOrders: store})
+		rep, ok := s.UpdateStationScheduling(work_order.UpdateStationSchedulingParams{
+			HTTPRequest: httpRequestWithHeader,
+			Body: []*work_order.UpdateStationSchedulingParamsBodyItems0{
+				{
+					ID:           &testWorkOrder1,
+					ForceToAbort: &trueToAbort,
+					UpdateAt:     updateAt,
+				},
+			},
+		}, principal).(*work_order.UpdateStationSchedulingConflict)
+		if assert.True(ok) {
+			assert.Equal(database.ErrRecordLocked.Error(), rep.Payload.Details)
+			if assert.Len(rep.Payload.Data, 1) {
+				assert.Equal(testWorkOrder1, rep.Payload.Data[0].ID)
+			}
+		}
+		assert.Equal(map[string]string{testWorkOrder1: "another"}, store.locks)
+		assert.NoError(dm.Close())
+	}
 	{ // forbidden access
-		s := mustNewWorkorder(dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
+		s := mustNewWorkorder(t, dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
 			return false
 		})
 		rep, ok := s.UpdateStationScheduling(work_order.UpdateStationSchedulingParams{
@@ -1332,7 +1448,7 @@ func TestWorkOrder_ListWorkOrders(t *testing.T) {
 			dm, err := mock.New(tt.script)
 			assert.NoErrorf(err, tt.name)
 
-			s := mustNewWorkorder(dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
+			s := mustNewWorkorder(t, dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
 				return true
 			})
 			if got := s.ListWorkOrders(tt.args.params, tt.args.principal); !assert.Equal(got, tt.want) {
@@ -1345,7 +1461,7 @@ func TestWorkOrder_ListWorkOrders(t *testing.T) {
 
 	{ // forbidden access
 		dm, _ := mock.New([]mock.Script{})
-		s := mustNewWorkorder(dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
+		s := mustNewWorkorder(t, dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
 			return false
 		})
 		rep, ok := s.ListWorkOrders(work_order.ListWorkOrdersParams{
@@ -1406,13 +1522,16 @@ func TestWorkOrder_ListWorkOrdersRate(t *testing.T) {
 			ProductID:         testWorkOrder1ProductA,
 			Station:           testStationA,
 			PlanQuantity:      "10",
-			CollectedQuantity: "15",
-			Ratio:             "50.00%",
+			CollectedQuantity: "10",
+			Ratio:             "100.00%",
 			ProductionTime:    &dateTest,
 			ProductionEndTime: &dateTest,
 			UpdateBy:          userID,
 			CreatedBy:         userID,
 			RecipeID:          testWorkOrder1RecipeID,
+			DefectQuantity:    "3",
+			ScrapQuantity:     "2",
+			Yield:             "66.67%",
 		},
 		{
 			DepartmentID:      "B2200",
@@ -1427,6 +1546,9 @@ func TestWorkOrder_ListWorkOrdersRate(t *testing.T) {
 			UpdateBy:          userID,
 			CreatedBy:         userID,
 			RecipeID:          testWorkOrder1RecipeID,
+			DefectQuantity:    "0",
+			ScrapQuantity:     "0",
+			Yield:             "0.00%",
 		},
 	}
 
@@ -1649,7 +1771,7 @@ func TestWorkOrder_ListWorkOrdersRate(t *testing.T) {
 			dm, err := mock.New(tt.script)
 			assert.NoErrorf(err, tt.name)
 
-			s := mustNewWorkorder(dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
+			s := mustNewWorkorder(t, dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
 				return true
 			})
 			if got := s.ListWorkOrdersRate(tt.args.params, tt.args.principal); !assert.Equal(got, tt.want) {
@@ -1661,7 +1783,7 @@ func TestWorkOrder_ListWorkOrdersRate(t *testing.T) {
 	}
 	{ // forbidden access
 		dm, _ := mock.New([]mock.Script{})
-		s := mustNewWorkorder(dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
+		s := mustNewWorkorder(t, dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
 			return false
 		})
 		rep, ok := s.ListWorkOrdersRate(work_order.ListWorkOrdersRateParams{
@@ -1854,7 +1976,7 @@ func TestWorkOrder_ChangeWorkOrderStatus(t *testing.T) {
 			dm, err := mock.New(tt.script)
 			assert.NoErrorf(err, tt.name)
 
-			s := mustNewWorkorder(dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
+			s := mustNewWorkorder(t, dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
 				return true
 			})
 			if got := s.ChangeWorkOrderStatus(tt.args.params, tt.args.principal); !assert.Equal(got, tt.want) {
@@ -1866,7 +1988,7 @@ func TestWorkOrder_ChangeWorkOrderStatus(t *testing.T) {
 	}
 	{ // forbidden access
 		dm, _ := mock.New([]mock.Script{})
-		s := mustNewWorkorder(dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
+		s := mustNewWorkorder(t, dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
 			return false
 		})
 		rep, ok := s.ChangeWorkOrderStatus(work_order.ChangeWorkOrderStatusParams{
@@ -1935,9 +2057,13 @@ func TestWorkOrder_GetWorkOrderInformation(t *testing.T) {
 					Date:            strfmt.Date(testSchedulingDate),
 					WorkOrderStatus: int64(workorder.Status_PENDING),
 					CollectSequence: int64(testSequence),
-					CurrentQuantity: testCurrentQuantity.InexactFloat64(),
+					CurrentQuantity: testCurrentQuantity.Sub(testReversedQuantity).InexactFloat64(),
 					CurrentBatch:    int64(testCurrentBatch),
 					PlanQuantity:    fmt.Sprint(testPlanQuantity),
+					DefectQuantity:  "3",
+					ScrapQuantity:   "2",
+					Yield:           "99.94%",
+					Defects:         testDefectTotals,
 					Recipe: &work_order.GetWorkOrderInformationOKBodyDataRecipe{
 						Tools: []*work_order.GetWorkOrderInformationOKBodyDataRecipeToolsItems0{
 							{
@@ -2126,9 +2252,13 @@ func TestWorkOrder_GetWorkOrderInformation(t *testing.T) {
 					Date:            strfmt.Date(testSchedulingDate),
 					WorkOrderStatus: int64(workorder.Status_PENDING),
 					CollectSequence: int64(testSequence),
-					CurrentQuantity: testCurrentQuantity.InexactFloat64(),
+					CurrentQuantity: testCurrentQuantity.Sub(testReversedQuantity).InexactFloat64(),
 					CurrentBatch:    int64(testCurrentBatch),
 					PlanQuantity:    fmt.Sprint(testPlanQuantity),
+					DefectQuantity:  "3",
+					ScrapQuantity:   "2",
+					Yield:           "99.94%",
+					Defects:         testDefectTotals,
 					Recipe: &work_order.GetWorkOrderInformationOKBodyDataRecipe{
 						Tools: []*work_order.GetWorkOrderInformationOKBodyDataRecipeToolsItems0{
 							{
@@ -2652,7 +2782,7 @@ func TestWorkOrder_GetWorkOrderInformation(t *testing.T) {
 			dm, err := mock.New(tt.script)
 			assert.NoErrorf(err, tt.name)
 
-			s := mustNewWorkorder(dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
+			s := mustNewWorkorder(t, dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
 				return true
 			})
 			if got := s.GetWorkOrderInformation(tt.args.params, tt.args.principal); !assert.Equal(got, tt.want) {
@@ -2666,7 +2796,7 @@ func TestWorkOrder_GetWorkOrderInformation(t *testing.T) {
 		dm, err := mock.New([]mock.Script{})
 		assert.NoError(err)
 		defer dm.Close()
-		p := mustNewWorkorder(dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
+		p := mustNewWorkorder(t, dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
 			return false
 		})
 		rep, ok := p.GetWorkOrderInformation(work_order.GetWorkOrderInformationParams{
@@ -2678,7 +2808,7 @@ func TestWorkOrder_GetWorkOrderInformation(t *testing.T) {
 	}
 }
 
-func Test_parseCreateWorkOrdersRequest(t *testing.T) {
+func Test_parseWorkOrderRows(t *testing.T) {
 	assert := assert.New(t)
 	var (
 		recipeID     = "U-Z-223G2056-N-2"
@@ -3370,7 +3500,7 @@ func Test_parseCreateWorkOrdersRequest(t *testing.T) {
 			/* 24 */ {"223G2056", "", "", "", "", "", "", "", "", ""},
 		}
 
-		req, failData, err := parseCreateWorkOrdersRequest(context.Background(), dm, "", rows)
+		file, err := parseWorkOrderRows(context.Background(), dm, rows)
 		assert.NoError(err)
 		assert.Equal([]*work_order.CreateWorkOrdersFromFileOKBodyDataFailDataItems0{
 			{
@@ -3514,8 +3644,12 @@ func Test_parseCreateWorkOrdersRequest(t *testing.T) {
 				},
 				Index: 24,
 			},
-		}, failData)
-		assert.Empty(req)
+		}, file.failData)
+		indexes := make([]int64, len(file.workOrders))
+		for i, w := range file.workOrders {
+			indexes[i] = w.Index
+		}
+		assert.Equal([]int64{2, 3, 4, 6, 9}, indexes)
 		assert.NoError(dm.Close())
 	}
 	{ // 未指定配合表編號, 但系統有兩筆配合表, 且各自配合表各有兩個 processes, 每個 process 的機台皆不同.
@@ -3632,9 +3766,9 @@ func Test_parseCreateWorkOrdersRequest(t *testing.T) {
 			/*  2 */ {"223G2056", "KU-P2510-BOM-402-1", "NORMAL_PRODUCTION", "", "curing", "PRODUCE", "1", "5", "", "2022-10-20"},
 		}
 		date, _ := time.Parse("2006-01-02", "2022-10-20")
-		req, failData, err := parseCreateWorkOrdersRequest(context.Background(), dm, "", rows)
+		file, err := parseWorkOrderRows(context.Background(), dm, rows)
 		assert.NoError(err)
-		assert.Len(failData, 0)
+		assert.Empty(file.failData)
 		assert.Equal(mcom.CreateWorkOrdersRequest{
 			WorkOrders: []mcom.CreateWorkOrder{
 				{
@@ -3647,7 +3781,7 @@ func Test_parseCreateWorkOrdersRequest(t *testing.T) {
 					Date:            date,
 				},
 			},
-		}, req)
+		}, createWorkOrdersRequest("", file.workOrders))
 		assert.NoError(dm.Close())
 	}
 	{ // 配合表未定義batch-size, 使用者有填寫batch-size.
@@ -3705,9 +3839,9 @@ func Test_parseCreateWorkOrdersRequest(t *testing.T) {
 			/*  2 */ {"223G2056", "KU-P2510-BOM-402-1", "NORMAL_PRODUCTION", "", "curing", "PRODUCE", "1", "5", "4", "2022-10-20"},
 		}
 		date, _ := time.Parse("2006-01-02", "2022-10-20")
-		req, failData, err := parseCreateWorkOrdersRequest(context.Background(), dm, "", rows)
+		file, err := parseWorkOrderRows(context.Background(), dm, rows)
 		assert.NoError(err)
-		assert.Len(failData, 0)
+		assert.Empty(file.failData)
 		assert.Equal(mcom.CreateWorkOrdersRequest{
 			WorkOrders: []mcom.CreateWorkOrder{
 				{
@@ -3720,7 +3854,7 @@ func Test_parseCreateWorkOrdersRequest(t *testing.T) {
 					Date:            date,
 				},
 			},
-		}, req)
+		}, createWorkOrdersRequest("", file.workOrders))
 		assert.NoError(dm.Close())
 	}
 	{ // 配合表未定義batch-size, 使用者未填寫batch-size.
@@ -3776,7 +3910,7 @@ func Test_parseCreateWorkOrdersRequest(t *testing.T) {
 			/*  1 */ {"產品代號", "機台號", "生產version_stage", "配合表編號", "工序名稱", "工序類別", "計算方式(0.首數/1.預計產量)", "首數/預計產量", "生產批量", "預計生產日"},
 			/*  2 */ {"223G2056", "KU-P2510-BOM-402-1", "NORMAL_PRODUCTION", "", "curing", "PRODUCE", "1", "5", "", "2022-10-20"},
 		}
-		req, failData, err := parseCreateWorkOrdersRequest(context.Background(), dm, "", rows)
+		file, err := parseWorkOrderRows(context.Background(), dm, rows)
 		assert.NoError(err)
 		assert.Equal([]*work_order.CreateWorkOrdersFromFileOKBodyDataFailDataItems0{
 			{
@@ -3785,8 +3919,40 @@ func Test_parseCreateWorkOrdersRequest(t *testing.T) {
 					"I(生產批量)",
 				},
 			},
-		}, failData)
-		assert.Equal(mcom.CreateWorkOrdersRequest{}, req)
+		}, file.failData)
+		assert.Equal([]*models.ImportCellError{
+			{
+				Index:   2,
+				Column:  "I(生產批量)",
+				Value:   "",
+				Details: importColumns[colExcelRecipeBatchSize].details,
+			},
+		}, file.cellErrors)
+		assert.Empty(file.workOrders)
+		assert.NoError(dm.Close())
+	}
+	{ // failed to get the process definition.
+		dm, _ := mock.New([]mock.Script{
+			{
+				Name: mock.FuncGetProcessDefinition,
+				Input: mock.Input{
+					Request: mcom.GetProcessDefinitionRequest{
+						RecipeID:    recipeID,
+						ProcessName: processName,
+						ProcessType: processType,
+					},
+				},
+				Output: mock.Output{
+					Error: errors.New(testInternalServerError),
+				},
+			},
+		})
+		rows := [][]string{
+			/*  1 */ {"產品代號", "機台號", "生產version_stage", "配合表編號", "工序名稱", "工序類別", "計算方式(0.首數/1.預計產量)", "首數/預計產量", "生產批量", "預計生產日"},
+			/*  2 */ {"223G2056", "KU-P2510-BOM-402-1", "", "U-Z-223G2056-N-2", "curing", "PRODUCE", "1", "5", "", "2022-10-20"},
+		}
+		_, err := parseWorkOrderRows(context.Background(), dm, rows)
+		assert.EqualError(err, testInternalServerError)
 		assert.NoError(dm.Close())
 	}
 }
@@ -4119,7 +4285,8 @@ func TestWorkOrder_UpdateWorkOrder(t *testing.T) {
 							ProcessType: testProcessType,
 							ID:          testWorkOrder1RecipeID,
 						},
-						Station: &testStationID,
+						Station:  &testStationID,
+						UpdateAt: strfmt.DateTime(testUpdateDate),
 					},
 					ID: testWorkOrder1,
 				},
@@ -4136,7 +4303,8 @@ func TestWorkOrder_UpdateWorkOrder(t *testing.T) {
 					},
 					Output: mock.Output{
 						Response: mcom.GetWorkOrderReply{
-							Status: workorder.Status_PENDING,
+							Status:    workorder.Status_PENDING,
+							UpdatedAt: testUpdateDate,
 						},
 					},
 				},
@@ -4178,7 +4346,8 @@ func TestWorkOrder_UpdateWorkOrder(t *testing.T) {
 							ProcessType: testProcessType,
 							ID:          testWorkOrder1RecipeID,
 						},
-						Station: &testStationID,
+						Station:  &testStationID,
+						UpdateAt: strfmt.DateTime(testUpdateDate),
 					},
 					ID: testWorkOrder1,
 				},
@@ -4195,7 +4364,8 @@ func TestWorkOrder_UpdateWorkOrder(t *testing.T) {
 					},
 					Output: mock.Output{
 						Response: mcom.GetWorkOrderReply{
-							Status: workorder.Status_PENDING,
+							Status:    workorder.Status_PENDING,
+							UpdatedAt: testUpdateDate,
 						},
 					},
 				},
@@ -4237,7 +4407,8 @@ func TestWorkOrder_UpdateWorkOrder(t *testing.T) {
 							ProcessType: testProcessType,
 							ID:          testWorkOrder1RecipeID,
 						},
-						Station: &testStationID,
+						Station:  &testStationID,
+						UpdateAt: strfmt.DateTime(testUpdateDate),
 					},
 					ID: testWorkOrder1,
 				},
@@ -4254,18 +4425,113 @@ func TestWorkOrder_UpdateWorkOrder(t *testing.T) {
 					},
 					Output: mock.Output{
 						Response: mcom.GetWorkOrderReply{
-							Status: workorder.Status_ACTIVE,
+							Status:    workorder.Status_ACTIVE,
+							UpdatedAt: testUpdateDate,
+						},
+					},
+				},
+			},
+		},
+		{ // case with an outdated version
+			name: "fail to update with version conflict",
+			args: args{
+				params: work_order.UpdateWorkOrderParams{
+					HTTPRequest: httpRequestWithHeader,
+					Body: &models.UpdateWorkOrder{
+						BatchSize:    int64(mcomWorkOrder.BatchSize_PLAN_QUANTITY),
+						BatchCount:   5,
+						PlanQuantity: "500",
+						PlanDate:     &date,
+						Recipe: &models.Recipe{
+							ProcessOID:  testProcessOID,
+							ProcessName: testProcessName,
+							ProcessType: testProcessType,
+							ID:          testWorkOrder1RecipeID,
+						},
+						Station:  &testStationID,
+						UpdateAt: strfmt.DateTime(testUpdateDate.Add(-time.Minute)),
+					},
+					ID: testWorkOrder1,
+				},
+				principal: principal,
+			},
+			want: work_order.NewUpdateWorkOrderConflict().WithPayload(&models.WorkOrderConflict{
+				Details: database.ErrVersionConflict.Error(),
+				Data: models.WorkOrders{
+					{
+						ID:            testWorkOrder1,
+						BatchSize:     int64(mcomWorkOrder.BatchSize_PLAN_QUANTITY),
+						BatchCount:    4,
+						PlanQuantity:  "400",
+						DepartmentOID: testDepartmentOID,
+						PlanDate:      strfmt.Date(testSchedulingDate),
+						Recipe: &models.Recipe{
+							ID: testWorkOrder1RecipeID,
+						},
+						Station:  testStationID,
+						Status:   models.WorkOrderStatus(workorder.Status_PENDING),
+						UpdateAt: strfmt.DateTime(testUpdateDate),
+						UpdateBy: userID,
+					},
+				},
+			}),
+			scripts: []mock.Script{
+				{
+					Name: mock.FuncGetWorkOrder,
+					Input: mock.Input{
+						Request: mcom.GetWorkOrderRequest{
+							ID: testWorkOrder1,
+						},
+					},
+					Output: mock.Output{
+						Response: mcom.GetWorkOrderReply{
+							ID:                   testWorkOrder1,
+							RecipeID:             testWorkOrder1RecipeID,
+							Status:               workorder.Status_PENDING,
+							DepartmentID:         testDepartmentOID,
+							Station:              testStationID,
+							Date:                 testSchedulingDate,
+							BatchQuantityDetails: mcom.NewPlanQuantity(4, decimal.NewFromInt(400)).Detail(),
+							UpdatedBy:            userID,
+							UpdatedAt:            testUpdateDate,
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "fail to update without updateAt",
+			args: args{
+				params: work_order.UpdateWorkOrderParams{
+					HTTPRequest: httpRequestWithHeader,
+					Body: &models.UpdateWorkOrder{
+						BatchSize:    int64(mcomWorkOrder.BatchSize_PLAN_QUANTITY),
+						BatchCount:   5,
+						PlanQuantity: "500",
+						PlanDate:     &date,
+						Recipe: &models.Recipe{
+							ProcessOID:  testProcessOID,
+							ProcessName: testProcessName,
+							ProcessType: testProcessType,
+							ID:          testWorkOrder1RecipeID,
 						},
+						Station: &testStationID,
 					},
+					ID: testWorkOrder1,
 				},
+				principal: principal,
 			},
+			want: work_order.NewUpdateWorkOrderPreconditionRequired().WithPayload(&models.Error{
+				Code:    int64(mcomErrors.Code_INSUFFICIENT_REQUEST),
+				Details: "missing updateAt of work order " + testWorkOrder1,
+			}),
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			dm, err := mock.New(tt.scripts)
 			assert.NoError(err)
-			s := mustNewWorkorder(dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
+			s := mustNewWorkorder(t, dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
 				return true
 			})
 			if got := s.UpdateWorkOrder(tt.args.params, tt.args.principal); !reflect.DeepEqual(got, tt.want) {
@@ -4278,7 +4544,7 @@ func TestWorkOrder_UpdateWorkOrder(t *testing.T) {
 		dm, err := mock.New([]mock.Script{})
 		assert.NoError(err)
 		defer dm.Close()
-		s := mustNewWorkorder(dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
+		s := mustNewWorkorder(t, dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
 			return true
 		})
 		rep := s.UpdateWorkOrder(work_order.UpdateWorkOrderParams{
@@ -4306,12 +4572,129 @@ func TestWorkOrder_UpdateWorkOrder(t *testing.T) {
 		}
 		assert.Equal(expected, rep)
 	}
+	{ // locked by another update
+		dm, err := mock.New([]mock.Script{
+			{
+				Name: mock.FuncGetWorkOrder,
+				Input: mock.Input{
+					Request: mcom.GetWorkOrderRequest{
+						ID: testWorkOrder1,
+					},
+				},
+				Output: mock.Output{
+					Response: mcom.GetWorkOrderReply{
+						ID:                   testWorkOrder1,
+						Status:               workorder.Status_PENDING,
+						BatchQuantityDetails: mcom.NewPlanQuantity(4, decimal.NewFromInt(400)).Detail(),
+						UpdatedAt:            testUpdateDate,
+					},
+				},
+			},
+		})
+		assert.NoError(err)
+		store := newWorkOrderStore()
+		store.locks[testWorkOrder1] = "another"
+		stores := newWorkOrderStores(t)
+		s := NewWorkOrder(dm, allowAll, Config{Defects: stores.Defects, Collects: stores.Collects, WorkOrders: store})
+		rep, ok := s.UpdateWorkOrder(work_order.UpdateWorkOrderParams{
+			HTTPRequest: httpRequestWithHeader,
+			Body: &models.UpdateWorkOrder{
+				BatchSize:    int64(mcomWorkOrder.BatchSize_PLAN_QUANTITY),
+				BatchCount:   5,
+				PlanQuantity: "500",
+				PlanDate:     &date,
+				Recipe: &models.Recipe{
+					ProcessOID:  testProcessOID,
+					ProcessName: testProcessName,
+					ProcessType: testProcessType,
+					ID:          testWorkOrder1RecipeID,
+				},
+				Station:  &testStationID,
+				UpdateAt: strfmt.DateTime(testUpdateDate),
+			},
+			ID: testWorkOrder1,
+		}, principal).(*work_order.UpdateWorkOrderConflict)
+		if assert.True(ok) {
+			assert.Equal(database.ErrRecordLocked.Error(), rep.Payload.Details)
+			if assert.Len(rep.Payload.Data, 1) {
+				assert.Equal(testWorkOrder1, rep.Payload.Data[0].ID)
+			}
+		}
+		assert.Equal(map[string]string{testWorkOrder1: "another"}, store.locks)
+		assert.NoError(dm.Close())
+	}
+}
+
+var (
+	testDefectSums = []database.DefectSum{
+		{
+			WorkOrder:  testWorkOrder1,
+			ReasonCode: "BUBBLE",
+			Kind:       database.DefectKindDefect,
+			Quantity:   decimal.NewFromInt(3),
+		},
+		{
+			WorkOrder:  testWorkOrder1,
+			ReasonCode: "BURNT",
+			Kind:       database.DefectKindScrap,
+			Quantity:   decimal.NewFromInt(2),
+		},
+	}
+	testDefectTotals = []*models.DefectTotal{
+		{
+			ReasonCode: "BUBBLE",
+			Kind:       models.DefectKindDEFECT,
+			Quantity:   "3",
+		},
+		{
+			ReasonCode: "BURNT",
+			Kind:       models.DefectKindSCRAP,
+			Quantity:   "2",
+		},
+	}
+)
+
+var testReversedQuantity = decimal.NewFromInt(5)
+
+// newWorkOrderStores returns the stores with the defects of testDefectSums
+// recorded and 5 of the collected quantity of testWorkOrder1 voided.
+func newWorkOrderStores(t *testing.T) storetest.Stores {
+	ctx := context.Background()
+	stores := storetest.New(t)
+	defects := make([]database.CollectDefect, len(testDefectSums))
+	for i, sum := range testDefectSums {
+		defects[i] = database.CollectDefect{
+			WorkOrder:  sum.WorkOrder,
+			Sequence:   1,
+			Batch:      1,
+			Station:    testStationA,
+			ReasonCode: sum.ReasonCode,
+			Kind:       sum.Kind,
+			Quantity:   sum.Quantity,
+			CreatedBy:  userID,
+		}
+	}
+	if err := stores.Defects.CreateCollectDefects(ctx, defects); err != nil {
+		t.Fatal(err)
+	}
+	if err := stores.Collects.CreateCollectReversal(ctx, database.CollectReversal{
+		WorkOrder: testWorkOrder1,
+		Sequence:  2,
+		Quantity:  testReversedQuantity,
+		Reason:    "voided",
+		CreatedBy: userID,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return stores
 }
 
 func mustNewWorkorder(
+	t *testing.T,
 	dm mcom.DataManager,
 	hasPermission func(id kenda.FunctionOperationID, roles []models.Role) bool,
 ) service.WorkOrder {
-	s := NewWorkOrder(dm, hasPermission, Config{})
+	stores := newWorkOrderStores(t)
+	s := NewWorkOrder(dm, hasPermission, Config{Defects: stores.Defects, Collects: stores.Collects, WorkOrders: newWorkOrderStore()})
 	return s
 }
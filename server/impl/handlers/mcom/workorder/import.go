@@ -0,0 +1,666 @@
+package workorder
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-openapi/runtime/middleware"
+	"github.com/go-openapi/strfmt"
+	"github.com/rs/xid"
+	"github.com/shopspring/decimal"
+	"github.com/xuri/excelize/v2"
+	"go.uber.org/zap"
+
+	commonsCtx "gitlab.kenda.com.tw/kenda/commons/v2/utils/context"
+	"gitlab.kenda.com.tw/kenda/mcom"
+	mcomErrors "gitlab.kenda.com.tw/kenda/mcom/errors"
+
+	"gitlab.kenda.com.tw/kenda/mui/server/database"
+	handlerUtils "gitlab.kenda.com.tw/kenda/mui/server/impl/handlers/mcom/utils"
+	"gitlab.kenda.com.tw/kenda/mui/server/impl/utils"
+	"gitlab.kenda.com.tw/kenda/mui/server/protobuf/kenda"
+	"gitlab.kenda.com.tw/kenda/mui/server/swagger/models"
+	"gitlab.kenda.com.tw/kenda/mui/server/swagger/restapi/operations/work_order"
+)
+
+// importPreviewTTL is how long a previewed work order file can be committed.
+const importPreviewTTL = 30 * time.Minute
+
+// importColumn is a column of the uploaded work order file.
+type importColumn struct {
+	// title is the header of the template.
+	title   string
+	aliases []string
+	// required columns must be in the files with headers.
+	required bool
+	// note describes the column in the template.
+	note    string
+	example string
+	// details describes a bad value of the column.
+	details string
+}
+
+// importColumns are the columns of the work order file, indexed by the col*
+// constants, which are the positions of the columns in the legacy files
+// without recognized headers.
+var importColumns = [...]importColumn{
+	colProductID: {
+		title:    "產品代號",
+		aliases:  []string{"productID", "product"},
+		required: true,
+		note:     "配合表工序的產出品號",
+		example:  "223G2056",
+		details:  "product not found or not the output of the recipe process",
+	},
+	colStation: {
+		title:    "機台號",
+		aliases:  []string{"stationID", "station"},
+		required: true,
+		note:     "須為配合表工序的機台",
+		example:  "KU-P2510-BOM-402-1",
+		details:  "station not found in the recipe process",
+	},
+	colVersionStage: {
+		title:   "生產version_stage",
+		aliases: []string{"versionStage", "version stage"},
+		note:    "未填配合表編號時必填, 使用此階段最新發行的配合表",
+		example: "NORMAL_PRODUCTION",
+		details: "no recipe of the version stage",
+	},
+	colRecipeID: {
+		title:   "配合表編號",
+		aliases: []string{"recipeID", "recipe"},
+		note:    "未填時依產品代號與生產version_stage帶入",
+		details: "recipe process not found",
+	},
+	colProcessName: {
+		title:    "工序名稱",
+		aliases:  []string{"processName"},
+		required: true,
+		example:  "curing",
+		details:  "recipe process not found",
+	},
+	colProcessType: {
+		title:    "工序類別",
+		aliases:  []string{"processType"},
+		required: true,
+		example:  "PRODUCE",
+		details:  "recipe process not found",
+	},
+	colExcelBatchSize: {
+		title:    "計算方式(0.首數/1.預計產量)",
+		aliases:  []string{"計算方式", "batchType"},
+		required: true,
+		note:     "0: 首數, 1: 預計產量",
+		example:  "0",
+		details:  "must be 0 for batches or 1 for plan quantity",
+	},
+	colExcelBatchSizeData: {
+		title:    "首數/預計產量",
+		aliases:  []string{"quantity", "batches"},
+		required: true,
+		note:     "依計算方式填寫首數或預計產量",
+		example:  "5",
+		details:  "must be a positive number",
+	},
+	colExcelRecipeBatchSize: {
+		title:   "生產批量",
+		aliases: []string{"batchSize"},
+		note:    "配合表未設定批量時必填",
+		details: "batch size is neither defined by the recipe nor given",
+	},
+	colDate: {
+		title:    "預計生產日",
+		aliases:  []string{"date", "planDate"},
+		required: true,
+		note:     "格式為 YYYY-MM-DD",
+		example:  "2022-10-20",
+		details:  "must be a date like 2006-01-02",
+	},
+}
+
+// columnMapping is the column index of the file for each of the col*
+// constants, -1 if the file does not have the column.
+type columnMapping [len(importColumns)]int
+
+func normalizeHeader(s string) string {
+	return strings.ToLower(strings.Join(strings.FieldsFunc(s, func(r rune) bool {
+		return r == ' ' || r == '_' || r == '\t'
+	}), ""))
+}
+
+// mapColumns maps the columns by the header names, which are the titles of
+// the template or their aliases regardless of cases and spaces. The columns
+// are positional if none of the headers is recognized.
+func mapColumns(header Row) (columnMapping, error) {
+	names := make(map[string]int)
+	for i, c := range importColumns {
+		names[normalizeHeader(c.title)] = i
+		for _, alias := range c.aliases {
+			names[normalizeHeader(alias)] = i
+		}
+	}
+
+	var m columnMapping
+	for i := range m {
+		m[i] = -1
+	}
+	var found bool
+	for j, h := range header {
+		i, ok := names[normalizeHeader(h)]
+		if !ok {
+			continue
+		}
+		if m[i] >= 0 {
+			return m, mcomErrors.Error{
+				Code:    mcomErrors.Code_BAD_REQUEST,
+				Details: fmt.Sprintf("duplicated column: %s", h),
+			}
+		}
+		m[i] = j
+		found = true
+	}
+	if !found {
+		for i := range m {
+			m[i] = i
+		}
+		return m, nil
+	}
+
+	var missing []string
+	for i, c := range importColumns {
+		if c.required && m[i] < 0 {
+			missing = append(missing, c.title)
+		}
+	}
+	if len(missing) > 0 {
+		return m, mcomErrors.Error{
+			Code:    mcomErrors.Code_BAD_REQUEST,
+			Details: "missing columns: " + strings.Join(missing, ", "),
+		}
+	}
+	return m, nil
+}
+
+// row returns the row in the positions of the col* constants.
+func (m columnMapping) row(r Row) Row {
+	row := make(Row, len(m))
+	for i, j := range m {
+		if j >= 0 {
+			row[i] = strings.TrimSpace(r.Column(j))
+		}
+	}
+	return row
+}
+
+// badColumns is like handlerUtils.BadColumns for the columns in the positions
+// of the col* constants.
+func (m columnMapping) badColumns(header Row, columns []int) []string {
+	names := make([]string, len(columns))
+	for i, c := range columns {
+		if j := m[c]; j >= 0 {
+			names[i] = handlerUtils.BadColumns(header, []int{j})[0]
+		} else {
+			names[i] = fmt.Sprintf("(%s)", importColumns[c].title)
+		}
+	}
+	return names
+}
+
+// importWorkOrder is a validated row of the work order file with the resolved
+// recipe, which is kept as JSON in the preview.
+type importWorkOrder struct {
+	Index       int64  `json:"index"`
+	ProductID   string `json:"productID"`
+	Station     string `json:"station"`
+	RecipeID    string `json:"recipeID"`
+	ProcessOID  string `json:"processOID"`
+	ProcessName string `json:"processName"`
+	ProcessType string `json:"processType"`
+	// ByPlanQuantity is false for the fixed batches.
+	ByPlanQuantity bool            `json:"byPlanQuantity"`
+	Batches        uint            `json:"batches"`
+	PlanQuantity   decimal.Decimal `json:"planQuantity"`
+	Date           time.Time       `json:"date"`
+}
+
+func (w importWorkOrder) batchPlan() batchPlan {
+	return batchPlan{
+		byPlanQuantity: w.ByPlanQuantity,
+		batches:        w.Batches,
+		planQuantity:   w.PlanQuantity,
+	}
+}
+
+// workOrderFile is the parsed work order file.
+type workOrderFile struct {
+	workOrders []importWorkOrder
+	failData   []*work_order.CreateWorkOrdersFromFileOKBodyDataFailDataItems0
+	cellErrors []*models.ImportCellError
+}
+
+func createWorkOrdersRequest(department string, workOrders []importWorkOrder) mcom.CreateWorkOrdersRequest {
+	req := make([]mcom.CreateWorkOrder, len(workOrders))
+	for i, w := range workOrders {
+		req[i] = mcom.CreateWorkOrder{
+			DepartmentID:    department,
+			Station:         w.Station,
+			RecipeID:        w.RecipeID,
+			ProcessOID:      w.ProcessOID,
+			ProcessName:     w.ProcessName,
+			ProcessType:     w.ProcessType,
+			BatchesQuantity: w.batchPlan().batchQuantity(),
+			Date:            w.Date,
+		}
+	}
+	return mcom.CreateWorkOrdersRequest{WorkOrders: req}
+}
+
+// CreateWorkOrdersFromFile implements.
+func (w WorkOrder) CreateWorkOrdersFromFile(params work_order.CreateWorkOrdersFromFileParams, principal *models.Principal) middleware.Responder {
+	if !w.hasPermission(kenda.FunctionOperationID_CREATE_WORK_ORDERS_FROM_FILE, principal.Roles) {
+		return work_order.NewCreateWorkOrdersFromFileDefault(http.StatusForbidden)
+	}
+	ctx := commonsCtx.WithUserID(params.HTTPRequest.Context(), principal.ID)
+
+	defer params.UploadFile.Close()
+	rows, err := handlerUtils.ReadRows(params.UploadFile, handlerUtils.SheetXLSX, handlerUtils.SheetCSV)
+	if err != nil {
+		return utils.ParseError(ctx, work_order.NewCreateWorkOrdersFromFileDefault(0), err)
+	}
+
+	file, err := parseWorkOrderRows(ctx, w.dm, rows)
+	if err != nil {
+		return utils.ParseError(ctx, work_order.NewCreateWorkOrdersFromFileDefault(0), err)
+	}
+
+	data := &work_order.CreateWorkOrdersFromFileOKBodyData{
+		FailData:     file.failData,
+		CellErrors:   file.cellErrors,
+		WorkOrders:   toWorkOrderImportRows(file.workOrders),
+		WorkOrderIDs: []string{},
+	}
+	// nothing is created if any row is invalid.
+	if len(file.failData) > 0 {
+		return work_order.NewCreateWorkOrdersFromFileOK().WithPayload(&work_order.CreateWorkOrdersFromFileOKBody{Data: data})
+	}
+
+	if params.DryRun != nil && *params.DryRun {
+		preview, err := w.keepImport(ctx, principal.ID, params.Department, file.workOrders)
+		if err != nil {
+			return utils.ParseError(ctx, work_order.NewCreateWorkOrdersFromFileDefault(0), err)
+		}
+		expiresAt := strfmt.DateTime(preview.ExpiresAt)
+		data.PreviewID = preview.ID
+		data.ExpiresAt = &expiresAt
+		return work_order.NewCreateWorkOrdersFromFileOK().WithPayload(&work_order.CreateWorkOrdersFromFileOKBody{Data: data})
+	}
+
+	reply, err := w.dm.CreateWorkOrders(ctx, createWorkOrdersRequest(params.Department, file.workOrders))
+	if err != nil {
+		return utils.ParseError(ctx, work_order.NewCreateWorkOrdersFromFileDefault(0), err)
+	}
+	data.WorkOrderIDs = reply.IDs
+	return work_order.NewCreateWorkOrdersFromFileOK().WithPayload(&work_order.CreateWorkOrdersFromFileOKBody{Data: data})
+}
+
+// keepImport keeps the validated work orders as a preview to be committed.
+func (w WorkOrder) keepImport(ctx context.Context, user, department string, workOrders []importWorkOrder) (database.WorkOrderImport, error) {
+	b, err := json.Marshal(workOrders)
+	if err != nil {
+		return database.WorkOrderImport{}, err
+	}
+	now := time.Now()
+	preview := database.WorkOrderImport{
+		ID:         xid.New().String(),
+		Department: department,
+		Data:       string(b),
+		CreatedBy:  user,
+		CreatedAt:  now,
+		ExpiresAt:  now.Add(importPreviewTTL),
+	}
+	if err := w.config.Imports.CreateWorkOrderImport(ctx, preview); err != nil {
+		return database.WorkOrderImport{}, err
+	}
+	return preview, nil
+}
+
+// CommitWorkOrderImport implements.
+func (w WorkOrder) CommitWorkOrderImport(params work_order.CommitWorkOrderImportParams, principal *models.Principal) middleware.Responder {
+	if !w.hasPermission(kenda.FunctionOperationID_CREATE_WORK_ORDERS_FROM_FILE, principal.Roles) {
+		return work_order.NewCommitWorkOrderImportDefault(http.StatusForbidden)
+	}
+	ctx := commonsCtx.WithUserID(params.HTTPRequest.Context(), principal.ID)
+
+	preview, err := w.config.Imports.ClaimWorkOrderImport(ctx, params.PreviewID, principal.ID, time.Now())
+	if err != nil {
+		return utils.ParseError(ctx, work_order.NewCommitWorkOrderImportDefault(0),
+			fmt.Errorf("work order import %s: %w", params.PreviewID, err))
+	}
+
+	var workOrders []importWorkOrder
+	if err := json.Unmarshal([]byte(preview.Data), &workOrders); err != nil {
+		return utils.ParseError(ctx, work_order.NewCommitWorkOrderImportDefault(0), err)
+	}
+	reply, err := w.dm.CreateWorkOrders(ctx, createWorkOrdersRequest(preview.Department, workOrders))
+	if err != nil {
+		// the preview can be committed again.
+		if e := w.config.Imports.ReleaseWorkOrderImport(ctx, preview.ID); e != nil {
+			zap.L().Error("failed to release the work order import", zap.String("id", preview.ID), zap.Error(e))
+		}
+		return utils.ParseError(ctx, work_order.NewCommitWorkOrderImportDefault(0), err)
+	}
+
+	return work_order.NewCommitWorkOrderImportOK().WithPayload(&work_order.CommitWorkOrderImportOKBody{
+		Data: &work_order.CommitWorkOrderImportOKBodyData{
+			WorkOrderIDs: reply.IDs,
+		},
+	})
+}
+
+// DownloadWorkOrderTemplate implements.
+func (w WorkOrder) DownloadWorkOrderTemplate(params work_order.DownloadWorkOrderTemplateParams, principal *models.Principal) middleware.Responder {
+	if !w.hasPermission(kenda.FunctionOperationID_CREATE_WORK_ORDERS_FROM_FILE, principal.Roles) {
+		return work_order.NewDownloadWorkOrderTemplateDefault(http.StatusForbidden)
+	}
+	ctx := commonsCtx.WithUserID(params.HTTPRequest.Context(), principal.ID)
+
+	format := "xlsx"
+	if params.Format != nil {
+		format = *params.Format
+	}
+	var buf bytes.Buffer
+	var err error
+	switch format {
+	case "csv":
+		err = writeCSVTemplate(&buf)
+	default:
+		err = writeExcelTemplate(&buf)
+	}
+	if err != nil {
+		return utils.ParseError(ctx, work_order.NewDownloadWorkOrderTemplateDefault(0), err)
+	}
+
+	return work_order.NewDownloadWorkOrderTemplateOK().
+		WithContentDisposition(fmt.Sprintf(`attachment; filename="work-orders.%s"`, format)).
+		WithPayload(io.NopCloser(&buf))
+}
+
+const (
+	templateSheet     = "工單"
+	templateNoteSheet = "說明"
+)
+
+func templateHeader() []interface{} {
+	header := make([]interface{}, len(importColumns))
+	for i, c := range importColumns {
+		header[i] = c.title
+	}
+	return header
+}
+
+// writeExcelTemplate writes a workbook with the header of the work orders and
+// a sheet of the notes of the columns.
+func writeExcelTemplate(w io.Writer) error {
+	f := excelize.NewFile()
+	defer f.Close()
+	f.SetSheetName(f.GetSheetName(0), templateSheet)
+
+	header := templateHeader()
+	if err := f.SetSheetRow(templateSheet, "A1", &header); err != nil {
+		return err
+	}
+	lastColumn, err := excelize.ColumnNumberToName(len(header))
+	if err != nil {
+		return err
+	}
+	if err := f.SetColWidth(templateSheet, "A", lastColumn, 20); err != nil {
+		return err
+	}
+
+	f.NewSheet(templateNoteSheet)
+	noteHeader := []interface{}{"欄位", "必填", "說明", "範例"}
+	if err := f.SetSheetRow(templateNoteSheet, "A1", &noteHeader); err != nil {
+		return err
+	}
+	for i, c := range importColumns {
+		cell, err := excelize.CoordinatesToCellName(1, i+2)
+		if err != nil {
+			return err
+		}
+		var required string
+		if c.required {
+			required = "Y"
+		}
+		values := []interface{}{c.title, required, c.note, c.example}
+		if err := f.SetSheetRow(templateNoteSheet, cell, &values); err != nil {
+			return err
+		}
+	}
+	if err := f.SetColWidth(templateNoteSheet, "A", "D", 30); err != nil {
+		return err
+	}
+	return f.Write(w)
+}
+
+// writeCSVTemplate writes the header of the work orders with a BOM, so the
+// file is opened as UTF-8 by Excel.
+func writeCSVTemplate(w io.Writer) error {
+	if _, err := w.Write([]byte("\xef\xbb\xbf")); err != nil {
+		return err
+	}
+	header := make([]string, len(importColumns))
+	for i, c := range importColumns {
+		header[i] = c.title
+	}
+	writer := csv.NewWriter(w)
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// parseWorkOrderRows validates the rows of the uploaded file and resolves the
+// recipes of the work orders.
+func parseWorkOrderRows(ctx context.Context, dm mcom.DataManager, rows [][]string) (workOrderFile, error) {
+	/*
+		excel column name, see importColumns for the header names
+		0 row[colProductID]				productID
+		1 row[colStation]				stationID
+		2 row[colVersionStage]			versionStage
+		3 row[colRecipeID]				recipeID
+		4 row[colProcessName]			processName
+		5 row[colProcessType]			processType
+		6 row[colExcelBatchSize]		batchSize 0:FixedQuantity;1:PlanQuantity
+		7 row[colExcelBatchSizeMode]	batch/planQuantity
+		8 row[colExcelRecipeBatchSize]	recipe batchSize
+		9 row[colDate]					date
+	*/
+
+	// if file empty
+	if len(rows) <= 1 {
+		return workOrderFile{}, mcomErrors.Error{
+			Code:    mcomErrors.Code_INSUFFICIENT_REQUEST,
+			Details: "file empty",
+		}
+	}
+
+	header := Row(rows[0])
+	mapping, err := mapColumns(header)
+	if err != nil {
+		return workOrderFile{}, err
+	}
+
+	file := workOrderFile{
+		workOrders: []importWorkOrder{},
+		failData:   []*work_order.CreateWorkOrdersFromFileOKBodyDataFailDataItems0{},
+		cellErrors: []*models.ImportCellError{},
+	}
+	for i, r := range rows[1:] {
+		row := mapping.row(r)
+		if strings.Join(row, "") == "" {
+			continue // skip blank rows.
+		}
+		index := int64(i + 2)
+
+		workOrder, failColumns, err := parseWorkOrderRow(ctx, dm, row)
+		if err != nil {
+			return workOrderFile{}, err
+		}
+		if len(failColumns) == 0 {
+			workOrder.Index = index
+			file.workOrders = append(file.workOrders, workOrder)
+			continue
+		}
+
+		file.failData = append(file.failData, &work_order.CreateWorkOrdersFromFileOKBodyDataFailDataItems0{
+			Index:   index,
+			Columns: mapping.badColumns(header, failColumns),
+		})
+		reported := make(map[int]bool)
+		for _, c := range failColumns {
+			if reported[c] {
+				continue
+			}
+			reported[c] = true
+			file.cellErrors = append(file.cellErrors, &models.ImportCellError{
+				Index:   index,
+				Column:  mapping.badColumns(header, []int{c})[0],
+				Value:   row.Column(c),
+				Details: importColumns[c].details,
+			})
+		}
+	}
+	return file, nil
+}
+
+// parseWorkOrderRow parses a row in the positions of the col* constants, the
+// bad columns are returned if any.
+func parseWorkOrderRow(ctx context.Context, dm mcom.DataManager, row Row) (importWorkOrder, []int, error) {
+	var (
+		failColumns []int
+		batchSize   *decimal.Decimal
+	)
+
+	workOrder := importWorkOrder{
+		ProductID:   row.Column(colProductID),
+		Station:     row.Column(colStation),
+		RecipeID:    row.Column(colRecipeID),
+		ProcessName: row.Column(colProcessName),
+		ProcessType: row.Column(colProcessType),
+	}
+
+	// check recipeID
+	if workOrder.RecipeID == "" {
+		// check productID
+		if row.Column(colProductID) != "" {
+			latestRecipe, err := getLatestRecipe(ctx, dm, row)
+
+			// if err length not 0
+			if len(err) != 0 {
+				failColumns = append(failColumns, err...)
+			} else {
+				workOrder.RecipeID = latestRecipe.ID
+
+				// find the process with station
+				var find bool
+				for _, i := range latestRecipe.Processes {
+					if !processCheck(i.Info, row) {
+						continue
+					}
+					// get batchSize
+					if batchSize, find = findBatchSize(i.Info, row); find {
+						workOrder.ProcessOID = i.Info.OID
+						break
+					}
+				}
+				if !find {
+					failColumns = append(failColumns, colStation)
+				}
+			}
+		} else {
+			failColumns = append(failColumns, colProductID)
+		}
+	} else {
+		// get processID & recipe batchSize
+		getProcessDefinition, err := dm.GetProcessDefinition(ctx, mcom.GetProcessDefinitionRequest{
+			RecipeID:    workOrder.RecipeID,
+			ProcessName: workOrder.ProcessName,
+			ProcessType: workOrder.ProcessType,
+		})
+
+		// if err equal Code_PROCESS_NOT_FOUND
+		if err != nil {
+			e, ok := mcomErrors.As(err)
+			if !ok || (e.Code != mcomErrors.Code_PROCESS_NOT_FOUND && e.Code != mcomErrors.Code_INSUFFICIENT_REQUEST) {
+				return importWorkOrder{}, nil, err
+			}
+			failColumns = append(failColumns, colRecipeID, colProcessName, colProcessType)
+		} else {
+			// check output ID
+			if getProcessDefinition.Output.ID != row.Column(colProductID) {
+				failColumns = append(failColumns, colProductID)
+			}
+			//check station
+			if !recipeStationCheck(getProcessDefinition.ProcessDefinition, workOrder.Station) {
+				failColumns = append(failColumns, colStation)
+			}
+
+			workOrder.ProcessOID = getProcessDefinition.OID
+			// get batchSize
+			batchSize, _ = findBatchSize(getProcessDefinition.ProcessDefinition, row)
+		}
+	}
+
+	// batchQuantity
+	plan, badColumnsIndex := parseBatchPlan(batchSize, row)
+	// check error index is nil
+	if len(badColumnsIndex) != 0 {
+		failColumns = append(failColumns, badColumnsIndex...)
+	} else {
+		workOrder.ByPlanQuantity = plan.byPlanQuantity
+		workOrder.Batches = plan.batches
+		workOrder.PlanQuantity = plan.planQuantity
+	}
+
+	// parse date
+	date, err := time.Parse("2006-01-02", row.Column(colDate))
+	if err != nil {
+		failColumns = append(failColumns, colDate)
+	} else {
+		workOrder.Date = date
+	}
+	return workOrder, failColumns, nil
+}
+
+func toWorkOrderImportRows(workOrders []importWorkOrder) []*models.WorkOrderImportRow {
+	rows := make([]*models.WorkOrderImportRow, len(workOrders))
+	for i, w := range workOrders {
+		var batchType int64
+		if w.ByPlanQuantity {
+			batchType = 1
+		}
+		rows[i] = &models.WorkOrderImportRow{
+			Index:        w.Index,
+			ProductID:    w.ProductID,
+			StationID:    w.Station,
+			RecipeID:     w.RecipeID,
+			ProcessOID:   w.ProcessOID,
+			ProcessName:  w.ProcessName,
+			ProcessType:  w.ProcessType,
+			BatchType:    batchType,
+			Batches:      int64(w.Batches),
+			PlanQuantity: w.PlanQuantity.String(),
+			Date:         strfmt.Date(w.Date),
+		}
+	}
+	return rows
+}
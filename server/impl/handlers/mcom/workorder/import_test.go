@@ -0,0 +1,358 @@
+package workorder
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-openapi/runtime"
+	"github.com/go-openapi/strfmt"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+
+	"gitlab.kenda.com.tw/kenda/mcom"
+	mcomErrors "gitlab.kenda.com.tw/kenda/mcom/errors"
+	"gitlab.kenda.com.tw/kenda/mcom/mock"
+
+	"gitlab.kenda.com.tw/kenda/mui/server/database"
+	handlerUtils "gitlab.kenda.com.tw/kenda/mui/server/impl/handlers/mcom/utils"
+	"gitlab.kenda.com.tw/kenda/mui/server/protobuf/kenda"
+	"gitlab.kenda.com.tw/kenda/mui/server/swagger/models"
+	"gitlab.kenda.com.tw/kenda/mui/server/swagger/restapi/operations/work_order"
+)
+
+type importStore struct {
+	imports  map[string]database.WorkOrderImport
+	released []string
+}
+
+func newImportStore() *importStore {
+	return &importStore{imports: make(map[string]database.WorkOrderImport)}
+}
+
+func (s *importStore) CreateWorkOrderImport(_ context.Context, imp database.WorkOrderImport) error {
+	s.imports[imp.ID] = imp
+	return nil
+}
+
+func (s *importStore) ClaimWorkOrderImport(_ context.Context, id, user string, t time.Time) (database.WorkOrderImport, error) {
+	imp, ok := s.imports[id]
+	if !ok || imp.CreatedBy != user || imp.ExpiresAt.Before(t) {
+		return database.WorkOrderImport{}, database.ErrRecordNotFound
+	}
+	if imp.CommittedAt != nil {
+		return database.WorkOrderImport{}, database.ErrRecordExisted
+	}
+	imp.CommittedAt = &t
+	s.imports[id] = imp
+	return imp, nil
+}
+
+func (s *importStore) ReleaseWorkOrderImport(_ context.Context, id string) error {
+	imp := s.imports[id]
+	imp.CommittedAt = nil
+	s.imports[id] = imp
+	s.released = append(s.released, id)
+	return nil
+}
+
+func allowAll(kenda.FunctionOperationID, []models.Role) bool {
+	return true
+}
+
+func Test_mapColumns(t *testing.T) {
+	tests := []struct {
+		name    string
+		header  Row
+		want    columnMapping
+		wantErr error
+	}{
+		{
+			name:   "template",
+			header: Row{"產品代號", "機台號", "生產version_stage", "配合表編號", "工序名稱", "工序類別", "計算方式(0.首數/1.預計產量)", "首數/預計產量", "生產批量", "預計生產日"},
+			want:   columnMapping{0, 1, 2, 3, 4, 5, 6, 7, 8, 9},
+		},
+		{
+			name:   "aliases in any order",
+			header: Row{"Date", "station_id", "remark", "ProductID", "process name", "PROCESSTYPE", "batchType", "quantity"},
+			want:   columnMapping{3, 1, -1, -1, 4, 5, 6, 7, -1, 0},
+		},
+		{
+			name:   "no recognized header",
+			header: Row{"a", "b", "c"},
+			want:   columnMapping{0, 1, 2, 3, 4, 5, 6, 7, 8, 9},
+		},
+		{
+			name:   "missing columns",
+			header: Row{"productID", "stationID", "processName", "processType", "batchType"},
+			wantErr: mcomErrors.Error{
+				Code:    mcomErrors.Code_BAD_REQUEST,
+				Details: "missing columns: 首數/預計產量, 預計生產日",
+			},
+		},
+		{
+			name:   "duplicated columns",
+			header: Row{"機台號", "station"},
+			wantErr: mcomErrors.Error{
+				Code:    mcomErrors.Code_BAD_REQUEST,
+				Details: "duplicated column: station",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := mapColumns(tt.header)
+			if tt.wantErr != nil {
+				assert.Equal(t, tt.wantErr, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+type memFile struct {
+	*bytes.Reader
+}
+
+func (memFile) Close() error {
+	return nil
+}
+
+func uploadFile(name string, data []byte) *runtime.File {
+	return &runtime.File{
+		Data:   memFile{bytes.NewReader(data)},
+		Header: &multipart.FileHeader{Filename: name},
+	}
+}
+
+func Test_writeTemplate(t *testing.T) {
+	assert := assert.New(t)
+
+	var header []string
+	for _, c := range importColumns {
+		header = append(header, c.title)
+	}
+	for name, write := range map[string]func(io.Writer) error{
+		"template.xlsx": writeExcelTemplate,
+		"template.csv":  writeCSVTemplate,
+	} {
+		var buf bytes.Buffer
+		assert.NoError(write(&buf))
+		rows, err := handlerUtils.ReadRows(uploadFile(name, buf.Bytes()), handlerUtils.SheetXLSX, handlerUtils.SheetCSV)
+		assert.NoError(err)
+		if assert.Len(rows, 1) {
+			assert.Equal(header, rows[0])
+			m, err := mapColumns(rows[0])
+			assert.NoError(err)
+			assert.Equal(columnMapping{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}, m)
+		}
+	}
+}
+
+func TestWorkOrder_importWorkOrders(t *testing.T) {
+	assert := assert.New(t)
+
+	const (
+		recipeID   = "RECIPE"
+		productID  = "PRODUCT"
+		department = "DEPARTMENT"
+		previewID  = "PREVIEW"
+	)
+	batchSize := decimal.NewFromInt(20)
+	file := "date,productID,stationID,recipeID,processName,processType,batchType,quantity\n" +
+		"2022-10-20," + productID + "," + testStationID + "," + recipeID + "," + testProcessName + "," + testProcessType + ",0,3\n" +
+		",,,,,,,\n" +
+		"2022-10-21," + productID + "," + testStationID + "," + recipeID + "," + testProcessName + "," + testProcessType + ",1,50\n"
+	getProcessDefinition := mock.Script{
+		Name: mock.FuncGetProcessDefinition,
+		Input: mock.Input{Request: mcom.GetProcessDefinitionRequest{
+			RecipeID:    recipeID,
+			ProcessName: testProcessName,
+			ProcessType: testProcessType,
+		}},
+		Output: mock.Output{Response: mcom.GetProcessDefinitionReply{
+			ProcessDefinition: mcom.ProcessDefinition{
+				OID:    testProcessOID,
+				Output: mcom.OutputProduct{ID: productID},
+				Configs: []*mcom.RecipeProcessConfig{
+					{Stations: []string{testStationID}, BatchSize: &batchSize},
+				},
+			},
+		}},
+	}
+	createRequest := mcom.CreateWorkOrdersRequest{
+		WorkOrders: []mcom.CreateWorkOrder{
+			{
+				DepartmentID:    department,
+				Station:         testStationID,
+				RecipeID:        recipeID,
+				ProcessOID:      testProcessOID,
+				ProcessName:     testProcessName,
+				ProcessType:     testProcessType,
+				BatchesQuantity: mcom.NewFixedQuantity(3, decimal.NewFromInt(60)),
+				Date:            time.Date(2022, 10, 20, 0, 0, 0, 0, time.UTC),
+			},
+			{
+				DepartmentID:    department,
+				Station:         testStationID,
+				RecipeID:        recipeID,
+				ProcessOID:      testProcessOID,
+				ProcessName:     testProcessName,
+				ProcessType:     testProcessType,
+				BatchesQuantity: mcom.NewPlanQuantity(3, decimal.NewFromInt(50)),
+				Date:            time.Date(2022, 10, 21, 0, 0, 0, 0, time.UTC),
+			},
+		},
+	}
+	uploadParams := func(file string, dryRun bool) work_order.CreateWorkOrdersFromFileParams {
+		return work_order.CreateWorkOrdersFromFileParams{
+			HTTPRequest: httptest.NewRequest(http.MethodPost, "/work-orders/upload/department/{department}", nil),
+			Department:  department,
+			UploadFile:  uploadFile("work-orders.csv", []byte(file)),
+			DryRun:      &dryRun,
+		}
+	}
+	commitParams := work_order.CommitWorkOrderImportParams{
+		HTTPRequest: httptest.NewRequest(http.MethodPost, "/work-orders/upload/preview/{previewID}", nil),
+	}
+
+	{ // dry run and commit
+		dm, err := mock.New([]mock.Script{
+			getProcessDefinition,
+			getProcessDefinition,
+			{
+				Name:   mock.FuncCreateWorkOrders,
+				Input:  mock.Input{Request: createRequest},
+				Output: mock.Output{Error: mcomErrors.Error{Code: mcomErrors.Code_BAD_REQUEST}},
+			},
+			{
+				Name:   mock.FuncCreateWorkOrders,
+				Input:  mock.Input{Request: createRequest},
+				Output: mock.Output{Response: mcom.CreateWorkOrdersReply{IDs: []string{"A", "B"}}},
+			},
+		})
+		assert.NoError(err)
+		imports := newImportStore()
+		w := NewWorkOrder(dm, allowAll, Config{Imports: imports})
+
+		rep, ok := w.CreateWorkOrdersFromFile(uploadParams(file, true), principal).(*work_order.CreateWorkOrdersFromFileOK)
+		if !assert.True(ok) {
+			return
+		}
+		data := rep.Payload.Data
+		assert.Empty(data.FailData)
+		assert.Empty(data.CellErrors)
+		assert.Empty(data.WorkOrderIDs)
+		assert.Equal([]*models.WorkOrderImportRow{
+			{
+				Index:        2,
+				ProductID:    productID,
+				StationID:    testStationID,
+				RecipeID:     recipeID,
+				ProcessOID:   testProcessOID,
+				ProcessName:  testProcessName,
+				ProcessType:  testProcessType,
+				BatchType:    0,
+				Batches:      3,
+				PlanQuantity: "60",
+				Date:         strfmt.Date(time.Date(2022, 10, 20, 0, 0, 0, 0, time.UTC)),
+			},
+			{
+				Index:        4,
+				ProductID:    productID,
+				StationID:    testStationID,
+				RecipeID:     recipeID,
+				ProcessOID:   testProcessOID,
+				ProcessName:  testProcessName,
+				ProcessType:  testProcessType,
+				BatchType:    1,
+				Batches:      3,
+				PlanQuantity: "50",
+				Date:         strfmt.Date(time.Date(2022, 10, 21, 0, 0, 0, 0, time.UTC)),
+			},
+		}, data.WorkOrders)
+		if !assert.Len(imports.imports, 1) || !assert.NotNil(data.ExpiresAt) {
+			return
+		}
+		preview := imports.imports[data.PreviewID]
+		assert.Equal(department, preview.Department)
+		assert.Equal(principal.ID, preview.CreatedBy)
+		assert.Equal(preview.ExpiresAt, time.Time(*data.ExpiresAt))
+
+		commitParams.PreviewID = data.PreviewID
+		// failed to create, the preview is released.
+		assert.Equal(work_order.NewCommitWorkOrderImportDefault(http.StatusBadRequest).WithPayload(&models.Error{
+			Code: int64(mcomErrors.Code_BAD_REQUEST),
+		}), w.CommitWorkOrderImport(commitParams, principal))
+		assert.Equal([]string{data.PreviewID}, imports.released)
+
+		assert.Equal(work_order.NewCommitWorkOrderImportOK().WithPayload(&work_order.CommitWorkOrderImportOKBody{
+			Data: &work_order.CommitWorkOrderImportOKBodyData{
+				WorkOrderIDs: []string{"A", "B"},
+			},
+		}), w.CommitWorkOrderImport(commitParams, principal))
+
+		// committed twice.
+		assert.Equal(work_order.NewCommitWorkOrderImportDefault(http.StatusConflict).WithPayload(&models.Error{
+			Code:    int64(mcomErrors.Code_RECORD_ALREADY_EXISTS),
+			Details: "work order import " + data.PreviewID + ": record existed",
+		}), w.CommitWorkOrderImport(commitParams, principal))
+		assert.NoError(dm.Close())
+	}
+	{ // bad cells
+		dm, err := mock.New([]mock.Script{getProcessDefinition})
+		assert.NoError(err)
+		imports := newImportStore()
+		w := NewWorkOrder(dm, allowAll, Config{Imports: imports})
+
+		badFile := "productID,stationID,recipeID,processName,processType,batchType,quantity,date\n" +
+			productID + "," + testStationID + "," + recipeID + "," + testProcessName + "," + testProcessType + ",2,3,2022/10/20\n"
+		rep, ok := w.CreateWorkOrdersFromFile(uploadParams(badFile, true), principal).(*work_order.CreateWorkOrdersFromFileOK)
+		if assert.True(ok) {
+			data := rep.Payload.Data
+			assert.Equal([]*work_order.CreateWorkOrdersFromFileOKBodyDataFailDataItems0{
+				{Index: 2, Columns: []string{"F(batchType)", "G(quantity)", "H(date)"}},
+			}, data.FailData)
+			assert.Equal([]*models.ImportCellError{
+				{Index: 2, Column: "F(batchType)", Value: "2", Details: "must be 0 for batches or 1 for plan quantity"},
+				{Index: 2, Column: "G(quantity)", Value: "3", Details: "must be a positive number"},
+				{Index: 2, Column: "H(date)", Value: "2022/10/20", Details: "must be a date like 2006-01-02"},
+			}, data.CellErrors)
+			assert.Empty(data.WorkOrders)
+			assert.Empty(data.PreviewID)
+		}
+		assert.Empty(imports.imports)
+		assert.NoError(dm.Close())
+	}
+	{ // preview not found
+		dm, err := mock.New(nil)
+		assert.NoError(err)
+		w := NewWorkOrder(dm, allowAll, Config{Imports: newImportStore()})
+
+		commitParams.PreviewID = previewID
+		assert.Equal(work_order.NewCommitWorkOrderImportDefault(http.StatusNotFound).WithPayload(&models.Error{
+			Code:    int64(mcomErrors.Code_RECORD_NOT_FOUND),
+			Details: "work order import " + previewID + ": record not found",
+		}), w.CommitWorkOrderImport(commitParams, principal))
+		assert.NoError(dm.Close())
+	}
+	{ // forbidden access
+		dm, err := mock.New(nil)
+		assert.NoError(err)
+		w := NewWorkOrder(dm, func(kenda.FunctionOperationID, []models.Role) bool {
+			return false
+		}, Config{Imports: newImportStore()})
+		assert.Equal(work_order.NewCreateWorkOrdersFromFileDefault(http.StatusForbidden),
+			w.CreateWorkOrdersFromFile(uploadParams(file, true), principal))
+		assert.Equal(work_order.NewCommitWorkOrderImportDefault(http.StatusForbidden),
+			w.CommitWorkOrderImport(commitParams, principal))
+		assert.NoError(dm.Close())
+	}
+}
@@ -0,0 +1,543 @@
+package workorder
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-openapi/runtime/middleware"
+	"github.com/shopspring/decimal"
+
+	"gitlab.kenda.com.tw/kenda/commons/v2/proto/golang/mes/v2/workorder"
+	commonsCtx "gitlab.kenda.com.tw/kenda/commons/v2/utils/context"
+	"gitlab.kenda.com.tw/kenda/mcom"
+	mcomErrors "gitlab.kenda.com.tw/kenda/mcom/errors"
+	mcomModels "gitlab.kenda.com.tw/kenda/mcom/impl/orm/models"
+	mcomWorkOrder "gitlab.kenda.com.tw/kenda/mcom/utils/workorder"
+
+	"gitlab.kenda.com.tw/kenda/mui/server/database"
+	handlerUtils "gitlab.kenda.com.tw/kenda/mui/server/impl/handlers/mcom/utils"
+	"gitlab.kenda.com.tw/kenda/mui/server/impl/utils"
+	"gitlab.kenda.com.tw/kenda/mui/server/impl/utils/saga"
+	"gitlab.kenda.com.tw/kenda/mui/server/protobuf/kenda"
+	"gitlab.kenda.com.tw/kenda/mui/server/swagger/models"
+	"gitlab.kenda.com.tw/kenda/mui/server/swagger/restapi/operations/work_order"
+)
+
+// workOrderBatches is the batches of a work order to be split or merged.
+type workOrderBatches struct {
+	size  mcomWorkOrder.BatchSize
+	count int64
+	plan  decimal.Decimal
+	// quantities are the quantities of the batches of PER_BATCH_QUANTITIES.
+	quantities []decimal.Decimal
+}
+
+func newWorkOrderBatches(details mcomModels.BatchQuantityDetails) (workOrderBatches, error) {
+	switch details.BatchQuantityType {
+	case mcomWorkOrder.BatchSize_PER_BATCH_QUANTITIES:
+		return newQuantityPerBatch(details.QuantityForBatches), nil
+	case mcomWorkOrder.BatchSize_FIXED_QUANTITY:
+		return workOrderBatches{
+			size:  mcomWorkOrder.BatchSize_FIXED_QUANTITY,
+			count: int64(details.FixedQuantity.BatchCount),
+			plan:  details.FixedQuantity.PlanQuantity,
+		}, nil
+	case mcomWorkOrder.BatchSize_PLAN_QUANTITY:
+		return workOrderBatches{
+			size:  mcomWorkOrder.BatchSize_PLAN_QUANTITY,
+			count: int64(details.PlanQuantity.BatchCount),
+			plan:  details.PlanQuantity.PlanQuantity,
+		}, nil
+	default:
+		return workOrderBatches{}, fmt.Errorf("no implementation with %d of BatchSize", details.BatchQuantityType)
+	}
+}
+
+func newQuantityPerBatch(quantities []decimal.Decimal) workOrderBatches {
+	plan := decimal.Zero
+	for _, q := range quantities {
+		plan = plan.Add(q)
+	}
+	return workOrderBatches{
+		size:       mcomWorkOrder.BatchSize_PER_BATCH_QUANTITIES,
+		count:      int64(len(quantities)),
+		plan:       plan,
+		quantities: quantities,
+	}
+}
+
+func (b workOrderBatches) batchQuantity() mcom.BatchQuantity {
+	switch b.size {
+	case mcomWorkOrder.BatchSize_FIXED_QUANTITY:
+		return mcom.NewFixedQuantity(uint(b.count), b.plan)
+	case mcomWorkOrder.BatchSize_PLAN_QUANTITY:
+		return mcom.NewPlanQuantity(uint(b.count), b.plan)
+	default:
+		return mcom.NewQuantityPerBatch(b.quantities)
+	}
+}
+
+// perBatch returns the quantities of the batches, the last batch of the fixed
+// quantity takes the remainder if the plan quantity is not divisible.
+func (b workOrderBatches) perBatch() []decimal.Decimal {
+	if b.size == mcomWorkOrder.BatchSize_PER_BATCH_QUANTITIES {
+		return b.quantities
+	}
+	if b.count == 0 {
+		return nil
+	}
+	quantities := make([]decimal.Decimal, b.count)
+	size := div(b.plan, decimal.NewFromInt(b.count))
+	for i := range quantities {
+		quantities[i] = size
+	}
+	quantities[b.count-1] = b.plan.Sub(size.Mul(decimal.NewFromInt(b.count - 1)))
+	return quantities
+}
+
+// div divides the quantity without the trailing zeros, so a divisible
+// quantity is kept as an integer.
+func div(d, d2 decimal.Decimal) decimal.Decimal {
+	return decimal.RequireFromString(d.Div(d2).String())
+}
+
+// splitBatches moves the last n batches to a new work order, where the
+// started batches are kept.
+func (b workOrderBatches) splitBatches(n, started int64) (keep, split workOrderBatches, err error) {
+	if n <= 0 || n >= b.count {
+		return workOrderBatches{}, workOrderBatches{}, mcomErrors.Error{
+			Code:    mcomErrors.Code_BAD_REQUEST,
+			Details: fmt.Sprintf("batches must be between 1 and %d", b.count-1),
+		}
+	}
+	if n > b.count-started {
+		return workOrderBatches{}, workOrderBatches{}, mcomErrors.Error{
+			Code:    mcomErrors.Code_BAD_REQUEST,
+			Details: fmt.Sprintf("batches must not exceed the %d unstarted batches", b.count-started),
+		}
+	}
+
+	if b.size == mcomWorkOrder.BatchSize_PER_BATCH_QUANTITIES {
+		return newQuantityPerBatch(b.quantities[:b.count-n]), newQuantityPerBatch(b.quantities[b.count-n:]), nil
+	}
+	quantity := div(b.plan.Mul(decimal.NewFromInt(n)), decimal.NewFromInt(b.count))
+	keep = workOrderBatches{
+		size:  b.size,
+		count: b.count - n,
+		plan:  b.plan.Sub(quantity),
+	}
+	split = workOrderBatches{
+		size:  b.size,
+		count: n,
+		plan:  quantity,
+	}
+	return keep, split, nil
+}
+
+// splitQuantity moves the quantity from the last batches to a new work order,
+// where the started batches are kept. A batch across the quantity is split
+// into two batches.
+func (b workOrderBatches) splitQuantity(quantity decimal.Decimal, started int64) (keep, split workOrderBatches, err error) {
+	if quantity.LessThanOrEqual(decimal.Zero) || quantity.GreaterThanOrEqual(b.plan) {
+		return workOrderBatches{}, workOrderBatches{}, mcomErrors.Error{
+			Code:    mcomErrors.Code_BAD_REQUEST,
+			Details: fmt.Sprintf("quantity must be greater than 0 and less than %s", b.plan),
+		}
+	}
+	errStarted := mcomErrors.Error{
+		Code:    mcomErrors.Code_BAD_REQUEST,
+		Details: "the quantity includes started batches",
+	}
+
+	if b.size == mcomWorkOrder.BatchSize_PER_BATCH_QUANTITIES {
+		// the batches after i are moved, and the rest of the quantity is moved
+		// from the batch i.
+		i, rest := len(b.quantities)-1, quantity
+		for ; i >= 0 && rest.GreaterThanOrEqual(b.quantities[i]); i-- {
+			rest = rest.Sub(b.quantities[i])
+		}
+		if rest.IsZero() {
+			if int64(i+1) < started {
+				return workOrderBatches{}, workOrderBatches{}, errStarted
+			}
+			return newQuantityPerBatch(b.quantities[:i+1]), newQuantityPerBatch(b.quantities[i+1:]), nil
+		}
+		if int64(i) < started {
+			return workOrderBatches{}, workOrderBatches{}, errStarted
+		}
+		kept := append(append([]decimal.Decimal{}, b.quantities[:i]...), b.quantities[i].Sub(rest))
+		moved := append([]decimal.Decimal{rest}, b.quantities[i+1:]...)
+		return newQuantityPerBatch(kept), newQuantityPerBatch(moved), nil
+	}
+
+	count := decimal.NewFromInt(b.count)
+	left := b.plan.Sub(quantity)
+	if left.Mul(count).LessThan(b.plan.Mul(decimal.NewFromInt(started))) {
+		return workOrderBatches{}, workOrderBatches{}, errStarted
+	}
+	// the fixed quantity is kept only if the quantity is of whole batches.
+	size := b.size
+	batches := quantity.Mul(count).Div(b.plan)
+	if !batches.Equal(batches.Truncate(0)) {
+		size = mcomWorkOrder.BatchSize_PLAN_QUANTITY
+	}
+	keep = workOrderBatches{
+		size:  size,
+		count: left.Mul(count).Div(b.plan).Ceil().IntPart(),
+		plan:  left,
+	}
+	split = workOrderBatches{
+		size:  size,
+		count: batches.Ceil().IntPart(),
+		plan:  quantity,
+	}
+	return keep, split, nil
+}
+
+// mergeBatches appends the batches of the sources to the target. The fixed
+// quantities of the same batch size are merged into a fixed quantity, and the
+// other fixed quantities into quantities per batch, while the plan quantities
+// can only be merged with each other.
+func mergeBatches(target workOrderBatches, sources ...workOrderBatches) (workOrderBatches, error) {
+	merged := target
+	for _, source := range sources {
+		switch {
+		case merged.size == mcomWorkOrder.BatchSize_PLAN_QUANTITY || source.size == mcomWorkOrder.BatchSize_PLAN_QUANTITY:
+			if merged.size != source.size {
+				return workOrderBatches{}, mcomErrors.Error{
+					Code:    mcomErrors.Code_BAD_REQUEST,
+					Details: "plan quantities can not be merged with other batch sizes",
+				}
+			}
+			merged.count += source.count
+			merged.plan = merged.plan.Add(source.plan)
+		case merged.size == mcomWorkOrder.BatchSize_FIXED_QUANTITY && source.size == mcomWorkOrder.BatchSize_FIXED_QUANTITY &&
+			merged.plan.Mul(decimal.NewFromInt(source.count)).Equal(source.plan.Mul(decimal.NewFromInt(merged.count))):
+			merged.count += source.count
+			merged.plan = merged.plan.Add(source.plan)
+		default:
+			quantities := append(append([]decimal.Decimal{}, merged.perBatch()...), source.perBatch()...)
+			merged = newQuantityPerBatch(quantities)
+		}
+	}
+	return merged, nil
+}
+
+// splittable reports whether the batches of the work order can be split or
+// merged into.
+func splittable(status workorder.Status) bool {
+	return status == workorder.Status_PENDING || status == workorder.Status_ACTIVE
+}
+
+// SplitWorkOrder implements.
+func (w WorkOrder) SplitWorkOrder(params work_order.SplitWorkOrderParams, principal *models.Principal) middleware.Responder {
+	if !w.hasPermission(kenda.FunctionOperationID_SPLIT_WORK_ORDER, principal.Roles) {
+		return work_order.NewSplitWorkOrderDefault(http.StatusForbidden)
+	}
+
+	ctx := commonsCtx.WithUserID(params.HTTPRequest.Context(), principal.ID)
+
+	body := params.Body
+	if (body.Batches == 0) == (body.Quantity == "") {
+		return utils.ParseError(ctx, work_order.NewSplitWorkOrderDefault(0), mcomErrors.Error{
+			Code:    mcomErrors.Code_BAD_REQUEST,
+			Details: "either batches or quantity is required",
+		})
+	}
+	if time.Time(body.UpdateAt).IsZero() {
+		return work_order.NewSplitWorkOrderPreconditionRequired().WithPayload(missingUpdateAt(params.ID))
+	}
+	unlock, err := w.lockWorkOrders(ctx, params.ID)
+	if errors.Is(err, database.ErrRecordLocked) {
+		conflict, err := w.lockConflict(ctx, params.ID)
+		if err != nil {
+			return utils.ParseError(ctx, work_order.NewSplitWorkOrderDefault(0), err)
+		}
+		return work_order.NewSplitWorkOrderConflict().WithPayload(conflict)
+	}
+	if err != nil {
+		return utils.ParseError(ctx, work_order.NewSplitWorkOrderDefault(0), err)
+	}
+	defer unlock()
+
+	workOrder, err := w.dm.GetWorkOrder(ctx, mcom.GetWorkOrderRequest{
+		ID: params.ID,
+	})
+	if err != nil {
+		return utils.ParseError(ctx, work_order.NewSplitWorkOrderDefault(0), err)
+	}
+	if updatedSince(workOrder, body.UpdateAt) {
+		conflict, err := workOrderConflict(workOrder)
+		if err != nil {
+			return utils.ParseError(ctx, work_order.NewSplitWorkOrderDefault(0), err)
+		}
+		return work_order.NewSplitWorkOrderConflict().WithPayload(conflict)
+	}
+	if !splittable(workOrder.Status) {
+		return utils.ParseError(ctx, work_order.NewSplitWorkOrderDefault(0), mcomErrors.Error{
+			Code:    mcomErrors.Code_BAD_REQUEST,
+			Details: "work order status not pending or active",
+		})
+	}
+
+	batches, err := newWorkOrderBatches(workOrder.BatchQuantityDetails)
+	if err != nil {
+		return utils.ParseError(ctx, work_order.NewSplitWorkOrderDefault(0), err)
+	}
+	var keep, split workOrderBatches
+	if body.Batches != 0 {
+		keep, split, err = batches.splitBatches(body.Batches, int64(workOrder.CurrentBatch))
+	} else {
+		quantity, e := decimal.NewFromString(body.Quantity)
+		if e != nil {
+			return work_order.NewSplitWorkOrderDefault(http.StatusBadRequest).WithPayload(&models.Error{
+				Code:    int64(mcomErrors.Code_INVALID_NUMBER),
+				Details: "invalid_number=" + body.Quantity,
+			})
+		}
+		keep, split, err = batches.splitQuantity(quantity, int64(workOrder.CurrentBatch))
+	}
+	if err != nil {
+		return utils.ParseError(ctx, work_order.NewSplitWorkOrderDefault(0), err)
+	}
+
+	station := workOrder.Station
+	if body.Station != "" && body.Station != workOrder.Station {
+		process, err := w.dm.GetProcessDefinition(ctx, mcom.GetProcessDefinitionRequest{
+			RecipeID:    workOrder.RecipeID,
+			ProcessName: workOrder.Process.Name,
+			ProcessType: workOrder.Process.Type,
+		})
+		if err != nil {
+			return utils.ParseError(ctx, work_order.NewSplitWorkOrderDefault(0), err)
+		}
+		if !recipeStationCheck(process.ProcessDefinition, body.Station) {
+			return utils.ParseError(ctx, work_order.NewSplitWorkOrderDefault(0), mcomErrors.Error{
+				Code:    mcomErrors.Code_BAD_REQUEST,
+				Details: fmt.Sprintf("station %s is not in the recipe %s", body.Station, workOrder.RecipeID),
+			})
+		}
+		station = body.Station
+	}
+	date := workOrder.Date
+	if planDate := time.Time(body.PlanDate); !planDate.IsZero() {
+		date = planDate
+	}
+
+	updateBatches := func(batches workOrderBatches) func(ctx context.Context) error {
+		return func(ctx context.Context) error {
+			return w.dm.UpdateWorkOrders(ctx, mcom.UpdateWorkOrdersRequest{
+				Orders: []mcom.UpdateWorkOrder{
+					{
+						ID:              params.ID,
+						BatchesQuantity: batches.batchQuantity(),
+					},
+				},
+			})
+		}
+	}
+	var workOrderID string
+	if err := saga.Run(ctx,
+		saga.Step{
+			Name:       "UPDATE_WORK_ORDER",
+			Do:         updateBatches(keep),
+			Compensate: updateBatches(batches),
+		},
+		saga.Step{
+			Name: "CREATE_WORK_ORDER",
+			Do: func(ctx context.Context) error {
+				reply, err := w.dm.CreateWorkOrders(ctx, mcom.CreateWorkOrdersRequest{
+					WorkOrders: []mcom.CreateWorkOrder{
+						{
+							ProcessOID:      workOrder.Process.OID,
+							RecipeID:        workOrder.RecipeID,
+							ProcessName:     workOrder.Process.Name,
+							ProcessType:     workOrder.Process.Type,
+							DepartmentID:    workOrder.DepartmentID,
+							Station:         station,
+							Date:            date,
+							Parent:          workOrder.ID,
+							BatchesQuantity: split.batchQuantity(),
+						},
+					},
+				})
+				if err != nil {
+					return err
+				}
+				workOrderID = reply.IDs[0]
+				return nil
+			},
+		},
+	); err != nil {
+		return utils.ParseError(ctx, work_order.NewSplitWorkOrderDefault(0), handlerUtils.ParseSagaError(err))
+	}
+
+	return work_order.NewSplitWorkOrderOK().WithPayload(&work_order.SplitWorkOrderOKBody{
+		Data: &work_order.SplitWorkOrderOKBodyData{
+			WorkOrderID: workOrderID,
+		},
+	})
+}
+
+// MergeWorkOrders implements.
+func (w WorkOrder) MergeWorkOrders(params work_order.MergeWorkOrdersParams, principal *models.Principal) middleware.Responder {
+	if !w.hasPermission(kenda.FunctionOperationID_MERGE_WORK_ORDERS, principal.Roles) {
+		return work_order.NewMergeWorkOrdersDefault(http.StatusForbidden)
+	}
+
+	ctx := commonsCtx.WithUserID(params.HTTPRequest.Context(), principal.ID)
+
+	if len(params.Body.WorkOrders) == 0 {
+		return utils.ParseError(ctx, work_order.NewMergeWorkOrdersDefault(0), mcomErrors.Error{
+			Code:    mcomErrors.Code_INSUFFICIENT_REQUEST,
+			Details: "missing work orders",
+		})
+	}
+	if time.Time(params.Body.UpdateAt).IsZero() {
+		return work_order.NewMergeWorkOrdersPreconditionRequired().WithPayload(missingUpdateAt(params.ID))
+	}
+	ids := make([]string, len(params.Body.WorkOrders))
+	for i, source := range params.Body.WorkOrders {
+		if source == nil {
+			return utils.ParseError(ctx, work_order.NewMergeWorkOrdersDefault(0), mcomErrors.Error{
+				Code:    mcomErrors.Code_INSUFFICIENT_REQUEST,
+				Details: "missing work orders",
+			})
+		}
+		if time.Time(source.UpdateAt).IsZero() {
+			return work_order.NewMergeWorkOrdersPreconditionRequired().WithPayload(missingUpdateAt(source.ID))
+		}
+		ids[i] = source.ID
+	}
+	locked := append([]string{params.ID}, ids...)
+	unlock, err := w.lockWorkOrders(ctx, locked...)
+	if errors.Is(err, database.ErrRecordLocked) {
+		conflict, err := w.lockConflict(ctx, locked...)
+		if err != nil {
+			return utils.ParseError(ctx, work_order.NewMergeWorkOrdersDefault(0), err)
+		}
+		return work_order.NewMergeWorkOrdersConflict().WithPayload(conflict)
+	}
+	if err != nil {
+		return utils.ParseError(ctx, work_order.NewMergeWorkOrdersDefault(0), err)
+	}
+	defer unlock()
+
+	target, err := w.dm.GetWorkOrder(ctx, mcom.GetWorkOrderRequest{
+		ID: params.ID,
+	})
+	if err != nil {
+		return utils.ParseError(ctx, work_order.NewMergeWorkOrdersDefault(0), err)
+	}
+	if updatedSince(target, params.Body.UpdateAt) {
+		conflict, err := workOrderConflict(target)
+		if err != nil {
+			return utils.ParseError(ctx, work_order.NewMergeWorkOrdersDefault(0), err)
+		}
+		return work_order.NewMergeWorkOrdersConflict().WithPayload(conflict)
+	}
+	if !splittable(target.Status) {
+		return utils.ParseError(ctx, work_order.NewMergeWorkOrdersDefault(0), mcomErrors.Error{
+			Code:    mcomErrors.Code_BAD_REQUEST,
+			Details: "work order status not pending or active",
+		})
+	}
+	targetBatches, err := newWorkOrderBatches(target.BatchQuantityDetails)
+	if err != nil {
+		return utils.ParseError(ctx, work_order.NewMergeWorkOrdersDefault(0), err)
+	}
+
+	merged := map[string]bool{target.ID: true}
+	sources := make([]workOrderBatches, len(ids))
+	orders := make([]mcom.UpdateWorkOrder, len(ids)+1)
+	merges := make([]database.WorkOrderMerge, len(ids))
+	var updated []mcom.GetWorkOrderReply
+	for i, id := range ids {
+		if merged[id] {
+			return utils.ParseError(ctx, work_order.NewMergeWorkOrdersDefault(0), mcomErrors.Error{
+				Code:    mcomErrors.Code_BAD_REQUEST,
+				Details: fmt.Sprintf("work order %s is merged twice", id),
+			})
+		}
+		merged[id] = true
+
+		source, err := w.dm.GetWorkOrder(ctx, mcom.GetWorkOrderRequest{
+			ID: id,
+		})
+		if err != nil {
+			return utils.ParseError(ctx, work_order.NewMergeWorkOrdersDefault(0), err)
+		}
+		// the updated work orders are reported together.
+		if updatedSince(source, params.Body.WorkOrders[i].UpdateAt) {
+			updated = append(updated, source)
+			continue
+		}
+		if source.Status != workorder.Status_PENDING || source.CurrentBatch > 0 {
+			return utils.ParseError(ctx, work_order.NewMergeWorkOrdersDefault(0), mcomErrors.Error{
+				Code:    mcomErrors.Code_BAD_REQUEST,
+				Details: fmt.Sprintf("work order %s not pending or has started batches", id),
+			})
+		}
+		if source.DepartmentID != target.DepartmentID || source.Product.ID != target.Product.ID ||
+			source.RecipeID != target.RecipeID || source.Process.OID != target.Process.OID {
+			return utils.ParseError(ctx, work_order.NewMergeWorkOrdersDefault(0), mcomErrors.Error{
+				Code:    mcomErrors.Code_BAD_REQUEST,
+				Details: fmt.Sprintf("work order %s has a different department, product or recipe", id),
+			})
+		}
+		if sources[i], err = newWorkOrderBatches(source.BatchQuantityDetails); err != nil {
+			return utils.ParseError(ctx, work_order.NewMergeWorkOrdersDefault(0), err)
+		}
+		orders[i+1] = mcom.UpdateWorkOrder{
+			ID:     id,
+			Status: workorder.Status_SKIPPED,
+		}
+		merges[i] = database.WorkOrderMerge{
+			Source:    id,
+			Target:    target.ID,
+			CreatedBy: principal.ID,
+			CreatedAt: time.Now(),
+		}
+	}
+	if len(updated) > 0 {
+		conflict, err := workOrderConflict(updated...)
+		if err != nil {
+			return utils.ParseError(ctx, work_order.NewMergeWorkOrdersDefault(0), err)
+		}
+		return work_order.NewMergeWorkOrdersConflict().WithPayload(conflict)
+	}
+
+	batches, err := mergeBatches(targetBatches, sources...)
+	if err != nil {
+		return utils.ParseError(ctx, work_order.NewMergeWorkOrdersDefault(0), err)
+	}
+	orders[0] = mcom.UpdateWorkOrder{
+		ID:              target.ID,
+		BatchesQuantity: batches.batchQuantity(),
+	}
+	// the merges are recorded first, so they are removed if the work orders
+	// are not updated.
+	if err := saga.Run(ctx,
+		saga.Step{
+			Name: "RECORD_MERGES",
+			Do: func(ctx context.Context) error {
+				return w.config.WorkOrders.CreateWorkOrderMerges(ctx, merges)
+			},
+			Compensate: func(ctx context.Context) error {
+				return w.config.WorkOrders.DeleteWorkOrderMerges(ctx, ids)
+			},
+		},
+		saga.Step{
+			Name: "UPDATE_WORK_ORDERS",
+			Do: func(ctx context.Context) error {
+				return w.dm.UpdateWorkOrders(ctx, mcom.UpdateWorkOrdersRequest{Orders: orders})
+			},
+		},
+	); err != nil {
+		return utils.ParseError(ctx, work_order.NewMergeWorkOrdersDefault(0), handlerUtils.ParseSagaError(err))
+	}
+	return work_order.NewMergeWorkOrdersOK()
+}
@@ -0,0 +1,842 @@
+package workorder
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-openapi/strfmt"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+
+	"gitlab.kenda.com.tw/kenda/commons/v2/proto/golang/mes/v2/workorder"
+	"gitlab.kenda.com.tw/kenda/mcom"
+	mcomErrors "gitlab.kenda.com.tw/kenda/mcom/errors"
+	mcomModels "gitlab.kenda.com.tw/kenda/mcom/impl/orm/models"
+	"gitlab.kenda.com.tw/kenda/mcom/mock"
+	mcomWorkOrder "gitlab.kenda.com.tw/kenda/mcom/utils/workorder"
+
+	"gitlab.kenda.com.tw/kenda/mui/server/database"
+	"gitlab.kenda.com.tw/kenda/mui/server/impl/handlers/mcom/account"
+	"gitlab.kenda.com.tw/kenda/mui/server/protobuf/kenda"
+	"gitlab.kenda.com.tw/kenda/mui/server/swagger/models"
+	"gitlab.kenda.com.tw/kenda/mui/server/swagger/restapi/operations/work_order"
+)
+
+type workOrderStore struct {
+	// merges are the targets of the merged work orders.
+	merges map[string]string
+	// locks are the owners of the locked work orders.
+	locks map[string]string
+}
+
+func newWorkOrderStore() *workOrderStore {
+	return &workOrderStore{
+		merges: make(map[string]string),
+		locks:  make(map[string]string),
+	}
+}
+
+func (s *workOrderStore) CreateWorkOrderMerges(_ context.Context, merges []database.WorkOrderMerge) error {
+	for _, m := range merges {
+		if _, ok := s.merges[m.Source]; ok {
+			return database.ErrRecordExisted
+		}
+	}
+	for _, m := range merges {
+		s.merges[m.Source] = m.Target
+	}
+	return nil
+}
+
+func (s *workOrderStore) DeleteWorkOrderMerges(_ context.Context, sources []string) error {
+	for _, source := range sources {
+		delete(s.merges, source)
+	}
+	return nil
+}
+
+func (s *workOrderStore) LockWorkOrders(_ context.Context, owner string, workOrders []string, _ time.Duration) error {
+	for _, id := range workOrders {
+		if o, ok := s.locks[id]; ok && o != owner {
+			return database.ErrRecordLocked
+		}
+	}
+	for _, id := range workOrders {
+		s.locks[id] = owner
+	}
+	return nil
+}
+
+func (s *workOrderStore) UnlockWorkOrders(_ context.Context, owner string, workOrders []string) error {
+	for _, id := range workOrders {
+		if s.locks[id] == owner {
+			delete(s.locks, id)
+		}
+	}
+	return nil
+}
+
+func decimals(values ...string) []decimal.Decimal {
+	ds := make([]decimal.Decimal, len(values))
+	for i, v := range values {
+		ds[i] = decimal.RequireFromString(v)
+	}
+	return ds
+}
+
+func fixedBatches(count int64, plan string) workOrderBatches {
+	return workOrderBatches{
+		size:  mcomWorkOrder.BatchSize_FIXED_QUANTITY,
+		count: count,
+		plan:  decimal.RequireFromString(plan),
+	}
+}
+
+func planBatches(count int64, plan string) workOrderBatches {
+	return workOrderBatches{
+		size:  mcomWorkOrder.BatchSize_PLAN_QUANTITY,
+		count: count,
+		plan:  decimal.RequireFromString(plan),
+	}
+}
+
+func Test_workOrderBatches_splitBatches(t *testing.T) {
+	tests := []struct {
+		name      string
+		batches   workOrderBatches
+		n         int64
+		started   int64
+		wantKeep  workOrderBatches
+		wantSplit workOrderBatches
+		wantErr   string
+	}{
+		{
+			name:      "per batch",
+			batches:   newQuantityPerBatch(decimals("100", "100", "50")),
+			n:         2,
+			started:   1,
+			wantKeep:  newQuantityPerBatch(decimals("100")),
+			wantSplit: newQuantityPerBatch(decimals("100", "50")),
+		},
+		{
+			name:      "fixed quantity",
+			batches:   fixedBatches(4, "1200"),
+			n:         1,
+			started:   3,
+			wantKeep:  fixedBatches(3, "900"),
+			wantSplit: fixedBatches(1, "300"),
+		},
+		{
+			name:      "plan quantity",
+			batches:   planBatches(4, "1000"),
+			n:         2,
+			wantKeep:  planBatches(2, "500"),
+			wantSplit: planBatches(2, "500"),
+		},
+		{
+			name:    "all batches",
+			batches: newQuantityPerBatch(decimals("100", "100", "50")),
+			n:       3,
+			wantErr: "batches must be between 1 and 2",
+		},
+		{
+			name:    "started batches",
+			batches: newQuantityPerBatch(decimals("100", "100", "50")),
+			n:       2,
+			started: 2,
+			wantErr: "batches must not exceed the 1 unstarted batches",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keep, split, err := tt.batches.splitBatches(tt.n, tt.started)
+			if tt.wantErr != "" {
+				assert.Equal(t, mcomErrors.Error{Code: mcomErrors.Code_BAD_REQUEST, Details: tt.wantErr}, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantKeep, keep)
+			assert.Equal(t, tt.wantSplit, split)
+		})
+	}
+}
+
+func Test_workOrderBatches_splitQuantity(t *testing.T) {
+	tests := []struct {
+		name      string
+		batches   workOrderBatches
+		quantity  string
+		started   int64
+		wantKeep  workOrderBatches
+		wantSplit workOrderBatches
+		wantErr   string
+	}{
+		{
+			name:      "per batch across a batch",
+			batches:   newQuantityPerBatch(decimals("100", "100", "50")),
+			quantity:  "70",
+			wantKeep:  newQuantityPerBatch(decimals("100", "80")),
+			wantSplit: newQuantityPerBatch(decimals("20", "50")),
+		},
+		{
+			name:      "per batch of whole batches",
+			batches:   newQuantityPerBatch(decimals("100", "100", "50")),
+			quantity:  "150",
+			started:   1,
+			wantKeep:  newQuantityPerBatch(decimals("100")),
+			wantSplit: newQuantityPerBatch(decimals("100", "50")),
+		},
+		{
+			name:      "fixed quantity of whole batches",
+			batches:   fixedBatches(4, "1200"),
+			quantity:  "600",
+			started:   2,
+			wantKeep:  fixedBatches(2, "600"),
+			wantSplit: fixedBatches(2, "600"),
+		},
+		{
+			name:      "fixed quantity across a batch",
+			batches:   fixedBatches(4, "1200"),
+			quantity:  "500",
+			started:   2,
+			wantKeep:  planBatches(3, "700"),
+			wantSplit: planBatches(2, "500"),
+		},
+		{
+			name:     "started batches",
+			batches:  newQuantityPerBatch(decimals("100", "100", "50")),
+			quantity: "160",
+			started:  1,
+			wantErr:  "the quantity includes started batches",
+		},
+		{
+			name:     "started batches of fixed quantity",
+			batches:  fixedBatches(4, "1200"),
+			quantity: "1000",
+			started:  1,
+			wantErr:  "the quantity includes started batches",
+		},
+		{
+			name:     "whole quantity",
+			batches:  newQuantityPerBatch(decimals("100", "100", "50")),
+			quantity: "250",
+			wantErr:  "quantity must be greater than 0 and less than 250",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keep, split, err := tt.batches.splitQuantity(decimal.RequireFromString(tt.quantity), tt.started)
+			if tt.wantErr != "" {
+				assert.Equal(t, mcomErrors.Error{Code: mcomErrors.Code_BAD_REQUEST, Details: tt.wantErr}, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantKeep.size, keep.size)
+			assert.Equal(t, tt.wantKeep.count, keep.count)
+			assert.True(t, tt.wantKeep.plan.Equal(keep.plan), keep.plan.String())
+			assert.Equal(t, tt.wantSplit.size, split.size)
+			assert.Equal(t, tt.wantSplit.count, split.count)
+			assert.True(t, tt.wantSplit.plan.Equal(split.plan), split.plan.String())
+			assert.Equal(t, tt.wantKeep.quantities, keep.quantities)
+			assert.Equal(t, tt.wantSplit.quantities, split.quantities)
+		})
+	}
+}
+
+func Test_mergeBatches(t *testing.T) {
+	assert := assert.New(t)
+
+	{ // fixed quantities of the same batch size
+		merged, err := mergeBatches(fixedBatches(4, "1200"), fixedBatches(2, "600"))
+		assert.NoError(err)
+		assert.Equal(fixedBatches(6, "1800"), merged)
+	}
+	{ // plan quantities
+		merged, err := mergeBatches(planBatches(4, "1000"), planBatches(1, "100"))
+		assert.NoError(err)
+		assert.Equal(planBatches(5, "1100"), merged)
+	}
+	{ // different batch sizes
+		merged, err := mergeBatches(fixedBatches(2, "600"), fixedBatches(1, "100"), newQuantityPerBatch(decimals("100", "50")))
+		assert.NoError(err)
+		assert.Equal(mcomWorkOrder.BatchSize_PER_BATCH_QUANTITIES, merged.size)
+		assert.Equal(int64(5), merged.count)
+		assert.True(decimal.NewFromInt(850).Equal(merged.plan))
+		assert.Equal([]string{"300", "300", "100", "100", "50"}, toStrings(merged.quantities))
+	}
+	{ // plan quantities with others
+		_, err := mergeBatches(planBatches(4, "1000"), newQuantityPerBatch(decimals("100")))
+		assert.Equal(mcomErrors.Error{
+			Code:    mcomErrors.Code_BAD_REQUEST,
+			Details: "plan quantities can not be merged with other batch sizes",
+		}, err)
+	}
+}
+
+func toStrings(ds []decimal.Decimal) []string {
+	ss := make([]string, len(ds))
+	for i, d := range ds {
+		ss[i] = d.String()
+	}
+	return ss
+}
+
+func TestWorkOrder_SplitWorkOrder(t *testing.T) {
+	assert := assert.New(t)
+
+	httpRequestWithHeader := httptest.NewRequest("POST", "/work-orders/{id}/split", nil)
+	httpRequestWithHeader.Header.Set(account.AuthorizationKey, "token-for-tester")
+
+	const testStationB = "STATION-B"
+	getWorkOrder := mock.Script{
+		Name: mock.FuncGetWorkOrder,
+		Input: mock.Input{
+			Request: mcom.GetWorkOrderRequest{
+				ID: testWorkOrder1,
+			},
+		},
+		Output: mock.Output{
+			Response: mcom.GetWorkOrderReply{
+				ID: testWorkOrder1,
+				Process: mcom.WorkOrderProcess{
+					OID:  testWorkOrderProcessOID,
+					Name: testWorkOrderProcessName,
+					Type: testWorkOrderProcessType,
+				},
+				RecipeID:             testWorkOrder1RecipeID,
+				Status:               workorder.Status_ACTIVE,
+				DepartmentID:         testDepartmentOID,
+				Station:              testStationA,
+				Date:                 testSchedulingDate,
+				CurrentBatch:         1,
+				BatchQuantityDetails: mcom.NewFixedQuantity(4, decimal.NewFromInt(1200)).Detail(),
+				UpdatedAt:            testUpdateDate,
+			},
+		},
+	}
+	getProcessDefinition := mock.Script{
+		Name: mock.FuncGetProcessDefinition,
+		Input: mock.Input{
+			Request: mcom.GetProcessDefinitionRequest{
+				RecipeID:    testWorkOrder1RecipeID,
+				ProcessName: testWorkOrderProcessName,
+				ProcessType: testWorkOrderProcessType,
+			},
+		},
+		Output: mock.Output{
+			Response: mcom.GetProcessDefinitionReply{
+				ProcessDefinition: mcom.ProcessDefinition{
+					OID: testWorkOrderProcessOID,
+					Configs: []*mcom.RecipeProcessConfig{
+						{Stations: []string{testStationA, testStationB}},
+					},
+				},
+			},
+		},
+	}
+	updateWorkOrder := func(batches mcom.BatchQuantity) mock.Script {
+		return mock.Script{
+			Name: mock.FuncUpdateWorkOrders,
+			Input: mock.Input{
+				Request: mcom.UpdateWorkOrdersRequest{
+					Orders: []mcom.UpdateWorkOrder{
+						{
+							ID:              testWorkOrder1,
+							BatchesQuantity: batches,
+						},
+					},
+				},
+			},
+		}
+	}
+	planDate := time.Date(2021, 8, 10, 0, 0, 0, 0, time.Local)
+	updateAt := strfmt.DateTime(testUpdateDate)
+	createRequest := mcom.CreateWorkOrdersRequest{
+		WorkOrders: []mcom.CreateWorkOrder{
+			{
+				ProcessOID:      testWorkOrderProcessOID,
+				RecipeID:        testWorkOrder1RecipeID,
+				ProcessName:     testWorkOrderProcessName,
+				ProcessType:     testWorkOrderProcessType,
+				DepartmentID:    testDepartmentOID,
+				Station:         testStationB,
+				Date:            planDate,
+				Parent:          testWorkOrder1,
+				BatchesQuantity: mcom.NewFixedQuantity(2, decimal.NewFromInt(600)),
+			},
+		},
+	}
+
+	tests := []struct {
+		name   string
+		body   models.SplitWorkOrder
+		want   interface{}
+		script []mock.Script
+	}{
+		{
+			name: "success",
+			body: models.SplitWorkOrder{
+				Station:  testStationB,
+				PlanDate: strfmt.Date(planDate),
+				Batches:  2,
+				UpdateAt: updateAt,
+			},
+			want: work_order.NewSplitWorkOrderOK().WithPayload(&work_order.SplitWorkOrderOKBody{
+				Data: &work_order.SplitWorkOrderOKBodyData{
+					WorkOrderID: "WORKORDERID006",
+				},
+			}),
+			script: []mock.Script{
+				getWorkOrder,
+				getProcessDefinition,
+				updateWorkOrder(mcom.NewFixedQuantity(2, decimal.NewFromInt(600))),
+				{
+					Name:   mock.FuncCreateWorkOrders,
+					Input:  mock.Input{Request: createRequest},
+					Output: mock.Output{Response: mcom.CreateWorkOrdersReply{IDs: []string{"WORKORDERID006"}}},
+				},
+			},
+		},
+		{
+			name: "compensated",
+			body: models.SplitWorkOrder{
+				Station:  testStationB,
+				PlanDate: strfmt.Date(planDate),
+				Quantity: "600",
+				UpdateAt: updateAt,
+			},
+			want: work_order.NewSplitWorkOrderDefault(http.StatusInternalServerError).WithPayload(&models.Error{
+				Details: "step CREATE_WORK_ORDER failed: " + testInternalServerError + "; compensated: UPDATE_WORK_ORDER",
+			}),
+			script: []mock.Script{
+				getWorkOrder,
+				getProcessDefinition,
+				updateWorkOrder(mcom.NewFixedQuantity(2, decimal.NewFromInt(600))),
+				{
+					Name:   mock.FuncCreateWorkOrders,
+					Input:  mock.Input{Request: createRequest},
+					Output: mock.Output{Error: errors.New(testInternalServerError)},
+				},
+				updateWorkOrder(mcom.NewFixedQuantity(4, decimal.NewFromInt(1200))),
+			},
+		},
+		{
+			name: "compensated with the code of the failed step",
+			body: models.SplitWorkOrder{
+				Station:  testStationB,
+				PlanDate: strfmt.Date(planDate),
+				Quantity: "600",
+				UpdateAt: updateAt,
+			},
+			want: work_order.NewSplitWorkOrderDefault(http.StatusBadRequest).WithPayload(&models.Error{
+				Code: int64(mcomErrors.Code_BAD_REQUEST),
+				Details: fmt.Sprintf("step CREATE_WORK_ORDER failed: %v; compensated: UPDATE_WORK_ORDER", mcomErrors.Error{
+					Code: mcomErrors.Code_BAD_REQUEST,
+				}),
+			}),
+			script: []mock.Script{
+				getWorkOrder,
+				getProcessDefinition,
+				updateWorkOrder(mcom.NewFixedQuantity(2, decimal.NewFromInt(600))),
+				{
+					Name:   mock.FuncCreateWorkOrders,
+					Input:  mock.Input{Request: createRequest},
+					Output: mock.Output{Error: mcomErrors.Error{Code: mcomErrors.Code_BAD_REQUEST}},
+				},
+				updateWorkOrder(mcom.NewFixedQuantity(4, decimal.NewFromInt(1200))),
+			},
+		},
+		{
+			name: "all batches",
+			body: models.SplitWorkOrder{
+				Batches:  4,
+				UpdateAt: updateAt,
+			},
+			want: work_order.NewSplitWorkOrderDefault(http.StatusBadRequest).WithPayload(&models.Error{
+				Code:    int64(mcomErrors.Code_BAD_REQUEST),
+				Details: "batches must be between 1 and 3",
+			}),
+			script: []mock.Script{getWorkOrder},
+		},
+		{
+			name: "station not in the recipe",
+			body: models.SplitWorkOrder{
+				Station:  "STATION-C",
+				Batches:  1,
+				UpdateAt: updateAt,
+			},
+			want: work_order.NewSplitWorkOrderDefault(http.StatusBadRequest).WithPayload(&models.Error{
+				Code:    int64(mcomErrors.Code_BAD_REQUEST),
+				Details: "station STATION-C is not in the recipe " + testWorkOrder1RecipeID,
+			}),
+			script: []mock.Script{getWorkOrder, getProcessDefinition},
+		},
+		{
+			name: "both batches and quantity",
+			body: models.SplitWorkOrder{
+				Batches:  1,
+				Quantity: "300",
+			},
+			want: work_order.NewSplitWorkOrderDefault(http.StatusBadRequest).WithPayload(&models.Error{
+				Code:    int64(mcomErrors.Code_BAD_REQUEST),
+				Details: "either batches or quantity is required",
+			}),
+		},
+		{
+			name: "missing updateAt",
+			body: models.SplitWorkOrder{
+				Batches: 1,
+			},
+			want: work_order.NewSplitWorkOrderPreconditionRequired().WithPayload(&models.Error{
+				Code:    int64(mcomErrors.Code_INSUFFICIENT_REQUEST),
+				Details: "missing updateAt of work order " + testWorkOrder1,
+			}),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dm, err := mock.New(tt.script)
+			assert.NoErrorf(err, tt.name)
+
+			store := newWorkOrderStore()
+			s := NewWorkOrder(dm, allowAll, Config{WorkOrders: store})
+			body := tt.body
+			got := s.SplitWorkOrder(work_order.SplitWorkOrderParams{
+				HTTPRequest: httpRequestWithHeader,
+				ID:          testWorkOrder1,
+				Body:        &body,
+			}, principal)
+			assert.Equal(tt.want, got)
+			assert.Empty(store.locks)
+
+			assert.NoErrorf(dm.Close(), tt.name)
+		})
+	}
+
+	{ // updated since the updateAt
+		dm, err := mock.New([]mock.Script{getWorkOrder})
+		assert.NoError(err)
+
+		s := NewWorkOrder(dm, allowAll, Config{WorkOrders: newWorkOrderStore()})
+		rep, ok := s.SplitWorkOrder(work_order.SplitWorkOrderParams{
+			HTTPRequest: httpRequestWithHeader,
+			ID:          testWorkOrder1,
+			Body: &models.SplitWorkOrder{
+				Batches:  1,
+				UpdateAt: strfmt.DateTime(testUpdateDate.Add(-time.Minute)),
+			},
+		}, principal).(*work_order.SplitWorkOrderConflict)
+		if assert.True(ok) {
+			assert.Equal(database.ErrVersionConflict.Error(), rep.Payload.Details)
+			if assert.Len(rep.Payload.Data, 1) {
+				assert.Equal(testWorkOrder1, rep.Payload.Data[0].ID)
+				assert.Equal(updateAt, rep.Payload.Data[0].UpdateAt)
+			}
+		}
+		assert.NoError(dm.Close())
+	}
+	{ // locked by another update
+		dm, err := mock.New([]mock.Script{getWorkOrder})
+		assert.NoError(err)
+		store := newWorkOrderStore()
+		store.locks[testWorkOrder1] = "another"
+		s := NewWorkOrder(dm, allowAll, Config{WorkOrders: store})
+		rep, ok := s.SplitWorkOrder(work_order.SplitWorkOrderParams{
+			HTTPRequest: httpRequestWithHeader,
+			ID:          testWorkOrder1,
+			Body: &models.SplitWorkOrder{
+				Batches:  1,
+				UpdateAt: updateAt,
+			},
+		}, principal).(*work_order.SplitWorkOrderConflict)
+		if assert.True(ok) {
+			assert.Equal(database.ErrRecordLocked.Error(), rep.Payload.Details)
+			if assert.Len(rep.Payload.Data, 1) {
+				assert.Equal(testWorkOrder1, rep.Payload.Data[0].ID)
+			}
+		}
+		assert.Equal(map[string]string{testWorkOrder1: "another"}, store.locks)
+		assert.NoError(dm.Close())
+	}
+
+	{ // forbidden access
+		dm, _ := mock.New([]mock.Script{})
+		s := mustNewWorkorder(t, dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
+			return false
+		})
+		rep, ok := s.SplitWorkOrder(work_order.SplitWorkOrderParams{
+			HTTPRequest: httpRequestWithHeader,
+			ID:          testWorkOrder1,
+			Body:        &models.SplitWorkOrder{Batches: 1},
+		}, principal).(*work_order.SplitWorkOrderDefault)
+		assert.True(ok)
+		assert.Equal(work_order.NewSplitWorkOrderDefault(http.StatusForbidden), rep)
+	}
+}
+
+func TestWorkOrder_MergeWorkOrders(t *testing.T) {
+	assert := assert.New(t)
+
+	httpRequestWithHeader := httptest.NewRequest("POST", "/work-orders/{id}/merge", nil)
+	httpRequestWithHeader.Header.Set(account.AuthorizationKey, "token-for-tester")
+
+	const testWorkOrder2 = "WORKORDERID002"
+	getWorkOrder := func(id string, status workorder.Status, recipeID string, batches mcomModels.BatchQuantityDetails) mock.Script {
+		return mock.Script{
+			Name: mock.FuncGetWorkOrder,
+			Input: mock.Input{
+				Request: mcom.GetWorkOrderRequest{
+					ID: id,
+				},
+			},
+			Output: mock.Output{
+				Response: mcom.GetWorkOrderReply{
+					ID: id,
+					Product: mcom.Product{
+						ID:   testWorkOrder1ProductA,
+						Type: testWorkOrder1ProductType,
+					},
+					Process: mcom.WorkOrderProcess{
+						OID:  testWorkOrderProcessOID,
+						Name: testWorkOrderProcessName,
+						Type: testWorkOrderProcessType,
+					},
+					RecipeID:             recipeID,
+					Status:               status,
+					DepartmentID:         testDepartmentOID,
+					Station:              testStationA,
+					BatchQuantityDetails: batches,
+					UpdatedAt:            testUpdateDate,
+				},
+			},
+		}
+	}
+
+	updateAt := strfmt.DateTime(testUpdateDate)
+	versions := func(ids ...string) []*models.WorkOrderVersion {
+		workOrders := make([]*models.WorkOrderVersion, len(ids))
+		for i, id := range ids {
+			workOrders[i] = &models.WorkOrderVersion{ID: id, UpdateAt: updateAt}
+		}
+		return workOrders
+	}
+
+	updateWorkOrders := mcom.UpdateWorkOrdersRequest{
+		Orders: []mcom.UpdateWorkOrder{
+			{
+				ID:              testWorkOrder1,
+				BatchesQuantity: mcom.NewFixedQuantity(3, decimal.NewFromInt(900)),
+			},
+			{
+				ID:     testWorkOrder2,
+				Status: workorder.Status_SKIPPED,
+			},
+		},
+	}
+
+	tests := []struct {
+		name       string
+		workOrders []string
+		want       interface{}
+		script     []mock.Script
+		// merged are the targets of the merged work orders.
+		merged map[string]string
+	}{
+		{
+			name:       "success",
+			workOrders: []string{testWorkOrder2},
+			want:       work_order.NewMergeWorkOrdersOK(),
+			merged:     map[string]string{testWorkOrder2: testWorkOrder1},
+			script: []mock.Script{
+				getWorkOrder(testWorkOrder1, workorder.Status_ACTIVE, testWorkOrder1RecipeID, mcom.NewFixedQuantity(2, decimal.NewFromInt(600)).Detail()),
+				getWorkOrder(testWorkOrder2, workorder.Status_PENDING, testWorkOrder1RecipeID, mcom.NewFixedQuantity(1, decimal.NewFromInt(300)).Detail()),
+				{
+					Name:  mock.FuncUpdateWorkOrders,
+					Input: mock.Input{Request: updateWorkOrders},
+				},
+			},
+		},
+		{
+			name:       "compensated",
+			workOrders: []string{testWorkOrder2},
+			want: work_order.NewMergeWorkOrdersDefault(http.StatusBadRequest).WithPayload(&models.Error{
+				Code: int64(mcomErrors.Code_BAD_REQUEST),
+				Details: fmt.Sprintf("step UPDATE_WORK_ORDERS failed: %v; compensated: RECORD_MERGES", mcomErrors.Error{
+					Code: mcomErrors.Code_BAD_REQUEST,
+				}),
+			}),
+			merged: map[string]string{},
+			script: []mock.Script{
+				getWorkOrder(testWorkOrder1, workorder.Status_ACTIVE, testWorkOrder1RecipeID, mcom.NewFixedQuantity(2, decimal.NewFromInt(600)).Detail()),
+				getWorkOrder(testWorkOrder2, workorder.Status_PENDING, testWorkOrder1RecipeID, mcom.NewFixedQuantity(1, decimal.NewFromInt(300)).Detail()),
+				{
+					Name:   mock.FuncUpdateWorkOrders,
+					Input:  mock.Input{Request: updateWorkOrders},
+					Output: mock.Output{Error: mcomErrors.Error{Code: mcomErrors.Code_BAD_REQUEST}},
+				},
+			},
+		},
+		{
+			name:       "different recipe",
+			workOrders: []string{testWorkOrder2},
+			want: work_order.NewMergeWorkOrdersDefault(http.StatusBadRequest).WithPayload(&models.Error{
+				Code:    int64(mcomErrors.Code_BAD_REQUEST),
+				Details: "work order " + testWorkOrder2 + " has a different department, product or recipe",
+			}),
+			script: []mock.Script{
+				getWorkOrder(testWorkOrder1, workorder.Status_PENDING, testWorkOrder1RecipeID, mcom.NewFixedQuantity(2, decimal.NewFromInt(600)).Detail()),
+				getWorkOrder(testWorkOrder2, workorder.Status_PENDING, "RECIPE002", mcom.NewFixedQuantity(1, decimal.NewFromInt(300)).Detail()),
+			},
+		},
+		{
+			name:       "active source",
+			workOrders: []string{testWorkOrder2},
+			want: work_order.NewMergeWorkOrdersDefault(http.StatusBadRequest).WithPayload(&models.Error{
+				Code:    int64(mcomErrors.Code_BAD_REQUEST),
+				Details: "work order " + testWorkOrder2 + " not pending or has started batches",
+			}),
+			script: []mock.Script{
+				getWorkOrder(testWorkOrder1, workorder.Status_PENDING, testWorkOrder1RecipeID, mcom.NewFixedQuantity(2, decimal.NewFromInt(600)).Detail()),
+				getWorkOrder(testWorkOrder2, workorder.Status_ACTIVE, testWorkOrder1RecipeID, mcom.NewFixedQuantity(1, decimal.NewFromInt(300)).Detail()),
+			},
+		},
+		{
+			name:       "closed target",
+			workOrders: []string{testWorkOrder2},
+			want: work_order.NewMergeWorkOrdersDefault(http.StatusBadRequest).WithPayload(&models.Error{
+				Code:    int64(mcomErrors.Code_BAD_REQUEST),
+				Details: "work order status not pending or active",
+			}),
+			script: []mock.Script{
+				getWorkOrder(testWorkOrder1, workorder.Status_CLOSED, testWorkOrder1RecipeID, mcom.NewFixedQuantity(2, decimal.NewFromInt(600)).Detail()),
+			},
+		},
+		{
+			name:       "merged into itself",
+			workOrders: []string{testWorkOrder1},
+			want: work_order.NewMergeWorkOrdersDefault(http.StatusBadRequest).WithPayload(&models.Error{
+				Code:    int64(mcomErrors.Code_BAD_REQUEST),
+				Details: "work order " + testWorkOrder1 + " is merged twice",
+			}),
+			script: []mock.Script{
+				getWorkOrder(testWorkOrder1, workorder.Status_PENDING, testWorkOrder1RecipeID, mcom.NewFixedQuantity(2, decimal.NewFromInt(600)).Detail()),
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dm, err := mock.New(tt.script)
+			assert.NoErrorf(err, tt.name)
+
+			store := newWorkOrderStore()
+			s := NewWorkOrder(dm, allowAll, Config{WorkOrders: store})
+			got := s.MergeWorkOrders(work_order.MergeWorkOrdersParams{
+				HTTPRequest: httpRequestWithHeader,
+				ID:          testWorkOrder1,
+				Body: &models.MergeWorkOrders{
+					UpdateAt:   updateAt,
+					WorkOrders: versions(tt.workOrders...),
+				},
+			}, principal)
+			assert.Equal(tt.want, got)
+			if tt.merged != nil {
+				assert.Equal(tt.merged, store.merges)
+			}
+			assert.Empty(store.locks)
+
+			assert.NoErrorf(dm.Close(), tt.name)
+		})
+	}
+
+	{ // missing updateAt
+		dm, _ := mock.New([]mock.Script{})
+		s := NewWorkOrder(dm, allowAll, Config{WorkOrders: newWorkOrderStore()})
+		rep := s.MergeWorkOrders(work_order.MergeWorkOrdersParams{
+			HTTPRequest: httpRequestWithHeader,
+			ID:          testWorkOrder1,
+			Body: &models.MergeWorkOrders{
+				UpdateAt:   updateAt,
+				WorkOrders: []*models.WorkOrderVersion{{ID: testWorkOrder2}},
+			},
+		}, principal)
+		assert.Equal(work_order.NewMergeWorkOrdersPreconditionRequired().WithPayload(&models.Error{
+			Code:    int64(mcomErrors.Code_INSUFFICIENT_REQUEST),
+			Details: "missing updateAt of work order " + testWorkOrder2,
+		}), rep)
+	}
+	{ // source updated since the updateAt
+		dm, err := mock.New([]mock.Script{
+			getWorkOrder(testWorkOrder1, workorder.Status_ACTIVE, testWorkOrder1RecipeID, mcom.NewFixedQuantity(2, decimal.NewFromInt(600)).Detail()),
+			getWorkOrder(testWorkOrder2, workorder.Status_PENDING, testWorkOrder1RecipeID, mcom.NewFixedQuantity(1, decimal.NewFromInt(300)).Detail()),
+		})
+		assert.NoError(err)
+
+		store := newWorkOrderStore()
+		s := NewWorkOrder(dm, allowAll, Config{WorkOrders: store})
+		rep, ok := s.MergeWorkOrders(work_order.MergeWorkOrdersParams{
+			HTTPRequest: httpRequestWithHeader,
+			ID:          testWorkOrder1,
+			Body: &models.MergeWorkOrders{
+				UpdateAt: updateAt,
+				WorkOrders: []*models.WorkOrderVersion{
+					{ID: testWorkOrder2, UpdateAt: strfmt.DateTime(testUpdateDate.Add(-time.Minute))},
+				},
+			},
+		}, principal).(*work_order.MergeWorkOrdersConflict)
+		if assert.True(ok) {
+			assert.Equal(database.ErrVersionConflict.Error(), rep.Payload.Details)
+			if assert.Len(rep.Payload.Data, 1) {
+				assert.Equal(testWorkOrder2, rep.Payload.Data[0].ID)
+			}
+		}
+		assert.Empty(store.merges)
+		assert.Empty(store.locks)
+		assert.NoError(dm.Close())
+	}
+	{ // locked by another update
+		dm, err := mock.New([]mock.Script{
+			getWorkOrder(testWorkOrder1, workorder.Status_ACTIVE, testWorkOrder1RecipeID, mcom.NewFixedQuantity(2, decimal.NewFromInt(600)).Detail()),
+			getWorkOrder(testWorkOrder2, workorder.Status_PENDING, testWorkOrder1RecipeID, mcom.NewFixedQuantity(1, decimal.NewFromInt(300)).Detail()),
+		})
+		assert.NoError(err)
+		store := newWorkOrderStore()
+		store.locks[testWorkOrder2] = "another"
+		s := NewWorkOrder(dm, allowAll, Config{WorkOrders: store})
+		rep, ok := s.MergeWorkOrders(work_order.MergeWorkOrdersParams{
+			HTTPRequest: httpRequestWithHeader,
+			ID:          testWorkOrder1,
+			Body: &models.MergeWorkOrders{
+				UpdateAt:   updateAt,
+				WorkOrders: versions(testWorkOrder2),
+			},
+		}, principal).(*work_order.MergeWorkOrdersConflict)
+		if assert.True(ok) {
+			assert.Equal(database.ErrRecordLocked.Error(), rep.Payload.Details)
+			if assert.Len(rep.Payload.Data, 2) {
+				assert.Equal(testWorkOrder1, rep.Payload.Data[0].ID)
+				assert.Equal(testWorkOrder2, rep.Payload.Data[1].ID)
+			}
+		}
+		assert.Equal(map[string]string{testWorkOrder2: "another"}, store.locks)
+		assert.NoError(dm.Close())
+	}
+
+	{ // forbidden access
+		dm, _ := mock.New([]mock.Script{})
+		s := mustNewWorkorder(t, dm, func(id kenda.FunctionOperationID, roles []models.Role) bool {
+			return false
+		})
+		rep, ok := s.MergeWorkOrders(work_order.MergeWorkOrdersParams{
+			HTTPRequest: httpRequestWithHeader,
+			ID:          testWorkOrder1,
+			Body:        &models.MergeWorkOrders{WorkOrders: versions(testWorkOrder2)},
+		}, principal).(*work_order.MergeWorkOrdersDefault)
+		assert.True(ok)
+		assert.Equal(work_order.NewMergeWorkOrdersDefault(http.StatusForbidden), rep)
+	}
+}
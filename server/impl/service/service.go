@@ -7,6 +7,7 @@ import (
 	"gitlab.kenda.com.tw/kenda/mui/server/swagger/restapi/operations/account"
 	"gitlab.kenda.com.tw/kenda/mui/server/swagger/restapi/operations/carrier"
 	"gitlab.kenda.com.tw/kenda/mui/server/swagger/restapi/operations/legacy"
+	"gitlab.kenda.com.tw/kenda/mui/server/swagger/restapi/operations/permission"
 	"gitlab.kenda.com.tw/kenda/mui/server/swagger/restapi/operations/plan"
 	"gitlab.kenda.com.tw/kenda/mui/server/swagger/restapi/operations/produce"
 	"gitlab.kenda.com.tw/kenda/mui/server/swagger/restapi/operations/product"
@@ -36,6 +37,7 @@ type Service struct {
 	produce              Produce
 	ui                   UI
 	unspecified          Unspecified
+	permission           Permission
 	// add more service
 }
 
@@ -55,6 +57,7 @@ func NewService(
 	produce Produce,
 	ui UI,
 	unspecified Unspecified,
+	permission Permission,
 
 ) *Service {
 	return &Service{
@@ -72,6 +75,7 @@ func NewService(
 		produce:              produce,
 		ui:                   ui,
 		unspecified:          unspecified,
+		permission:           permission,
 	}
 }
 
@@ -145,6 +149,11 @@ func (s *Service) Unspecified() Unspecified {
 	return s.unspecified
 }
 
+// Permission return role permission services.
+func (s *Service) Permission() Permission {
+	return s.permission
+}
+
 // AccountAuthorization service available function methods.
 type AccountAuthorization interface {
 	Auth(token string) (*models.Principal, error)
@@ -157,6 +166,14 @@ type AccountAuthorization interface {
 	CreateAccountAuthorization(params account.CreateAccountAuthorizationParams, principal *models.Principal) middleware.Responder
 	UpdateAccountAuthorization(params account.UpdateAccountAuthorizationParams, principal *models.Principal) middleware.Responder
 	DeleteAccount(params account.DeleteAccountParams, principal *models.Principal) middleware.Responder
+	ListPermissions(params account.ListPermissionsParams, principal *models.Principal) middleware.Responder
+	ListUserSessions(params account.ListUserSessionsParams, principal *models.Principal) middleware.Responder
+	RevokeUserSession(params account.RevokeUserSessionParams, principal *models.Principal) middleware.Responder
+	RevokeUserSessions(params account.RevokeUserSessionsParams, principal *models.Principal) middleware.Responder
+	ListLoginLockouts(params account.ListLoginLockoutsParams, principal *models.Principal) middleware.Responder
+	UnlockLoginLockout(params account.UnlockLoginLockoutParams, principal *models.Principal) middleware.Responder
+	ListLockoutEvents(params account.ListLockoutEventsParams, principal *models.Principal) middleware.Responder
+	ImportAccounts(params account.ImportAccountsParams, principal *models.Principal) middleware.Responder
 }
 
 // Legacy service available function methods.
@@ -193,7 +210,14 @@ type WorkOrder interface {
 	GetWorkOrderInformation(params work_order.GetWorkOrderInformationParams, principal *models.Principal) middleware.Responder
 	UpdateWorkOrder(params work_order.UpdateWorkOrderParams, principal *models.Principal) middleware.Responder
 	CreateWorkOrdersFromFile(params work_order.CreateWorkOrdersFromFileParams, principal *models.Principal) middleware.Responder
+	CommitWorkOrderImport(params work_order.CommitWorkOrderImportParams, principal *models.Principal) middleware.Responder
+	DownloadWorkOrderTemplate(params work_order.DownloadWorkOrderTemplateParams, principal *models.Principal) middleware.Responder
 	ListWorkOrdersRate(params work_order.ListWorkOrdersRateParams, rincipal *models.Principal) middleware.Responder
+	ExportWorkOrders(params work_order.ExportWorkOrdersParams, principal *models.Principal) middleware.Responder
+	ExportStationScheduling(params work_order.ExportStationSchedulingParams, principal *models.Principal) middleware.Responder
+	ExportWorkOrdersRate(params work_order.ExportWorkOrdersRateParams, principal *models.Principal) middleware.Responder
+	SplitWorkOrder(params work_order.SplitWorkOrderParams, principal *models.Principal) middleware.Responder
+	MergeWorkOrders(params work_order.MergeWorkOrdersParams, principal *models.Principal) middleware.Responder
 }
 
 // Station service available function methods.
@@ -208,6 +232,7 @@ type Station interface {
 	ListStationSites(params station.ListStationSitesParams, principal *models.Principal) middleware.Responder
 	StationForceSignIn(params station.StationForceSignInParams, principal *models.Principal) middleware.Responder
 	StationSignOut(params station.StationSignOutParams, principal *models.Principal) middleware.Responder
+	CreateStationDowntime(params station.CreateStationDowntimeParams, principal *models.Principal) middleware.Responder
 }
 
 // Recipe service available function methods.
@@ -260,6 +285,18 @@ type Produce interface {
 	FeedCollect(params produce.FeedCollectParams, principal *models.Principal) middleware.Responder
 	MesFeed(params produce.MesFeedParams, principal *models.Principal) middleware.Responder
 	MesCollect(params produce.MesCollectParams, principal *models.Principal) middleware.Responder
+	ReverseCollect(params produce.ReverseCollectParams, principal *models.Principal) middleware.Responder
+	Unfeed(params produce.UnfeedParams, principal *models.Principal) middleware.Responder
+	ListDefectReasons(params produce.ListDefectReasonsParams, principal *models.Principal) middleware.Responder
+	CreateDefectReason(params produce.CreateDefectReasonParams, principal *models.Principal) middleware.Responder
+	UpdateDefectReason(params produce.UpdateDefectReasonParams, principal *models.Principal) middleware.Responder
+	SyncOperations(params produce.SyncOperationsParams, principal *models.Principal) middleware.Responder
+	GetScaleWeight(params produce.GetScaleWeightParams, principal *models.Principal) middleware.Responder
+	ListFeedRecords(params produce.ListFeedRecordsParams, principal *models.Principal) middleware.Responder
+	ListCollectRecords(params produce.ListCollectRecordsParams, principal *models.Principal) middleware.Responder
+	TraceResources(params produce.TraceResourcesParams, principal *models.Principal) middleware.Responder
+	ExportTrace(params produce.ExportTraceParams, principal *models.Principal) middleware.Responder
+	GetStationOEE(params produce.GetStationOEEParams, principal *models.Principal) middleware.Responder
 }
 
 // UI service available function methods.
@@ -273,3 +310,12 @@ type UI interface {
 type Unspecified interface {
 	ListDepartmentIDs(params unspecified.ListDepartmentIDsParams, principal *models.Principal) middleware.Responder
 }
+
+// Permission service available function methods.
+type Permission interface {
+	ListRolePermissions(params permission.ListRolePermissionsParams, principal *models.Principal) middleware.Responder
+	CreateRolePermission(params permission.CreateRolePermissionParams, principal *models.Principal) middleware.Responder
+	UpdateRolePermission(params permission.UpdateRolePermissionParams, principal *models.Principal) middleware.Responder
+	DeleteRolePermission(params permission.DeleteRolePermissionParams, principal *models.Principal) middleware.Responder
+	ListRolePermissionChanges(params permission.ListRolePermissionChangesParams, principal *models.Principal) middleware.Responder
+}
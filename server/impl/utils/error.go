@@ -9,6 +9,7 @@ import (
 
 	mcomErrors "gitlab.kenda.com.tw/kenda/mcom/errors"
 
+	"gitlab.kenda.com.tw/kenda/mui/server/database"
 	"gitlab.kenda.com.tw/kenda/mui/server/swagger/models"
 )
 
@@ -49,6 +50,14 @@ func ParseError(ctx context.Context, d defaultError, err error) middleware.Respo
 		})
 		return d
 	}
+	if code, status, ok := parseDatabaseError(err); ok {
+		d.SetStatusCode(status)
+		d.SetPayload(&models.Error{
+			Code:    int64(code),
+			Details: err.Error(),
+		})
+		return d
+	}
 	if e, ok := mcomErrors.As(err); ok {
 		d.SetStatusCode(http.StatusBadRequest)
 		d.SetPayload(&models.Error{
@@ -65,6 +74,21 @@ func ParseError(ctx context.Context, d defaultError, err error) middleware.Respo
 	return d
 }
 
+// parseDatabaseError returns the error code and the HTTP status of the errors
+// of the data stored by MUI itself.
+func parseDatabaseError(err error) (mcomErrors.Code, int, bool) {
+	switch {
+	case errors.Is(err, database.ErrRecordNotFound):
+		return mcomErrors.Code_RECORD_NOT_FOUND, http.StatusNotFound, true
+	case errors.Is(err, database.ErrRecordExisted):
+		return mcomErrors.Code_RECORD_ALREADY_EXISTS, http.StatusConflict, true
+	case errors.Is(err, database.ErrVersionConflict), errors.Is(err, database.ErrRecordLocked):
+		return mcomErrors.Code_NONE, http.StatusConflict, true
+	default:
+		return mcomErrors.Code_NONE, 0, false
+	}
+}
+
 type defaultError interface {
 	middleware.Responder
 
@@ -0,0 +1,181 @@
+// Package export writes the reports into xlsx or CSV files with the headers
+// in the languages of the UI.
+package export
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/shopspring/decimal"
+	"github.com/xuri/excelize/v2"
+)
+
+// Format of the exported files.
+type Format string
+
+// Format definitions.
+const (
+	XLSX Format = "xlsx"
+	CSV  Format = "csv"
+)
+
+// ParseFormat returns the format, XLSX if s is empty.
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(strings.ToLower(s)); f {
+	case "":
+		return XLSX, nil
+	case XLSX, CSV:
+		return f, nil
+	default:
+		return "", fmt.Errorf("unknown format: %s", s)
+	}
+}
+
+// Language of the headers, same as the languages of the UI.
+type Language string
+
+// Language definitions.
+const (
+	TW Language = "tw"
+	CN Language = "cn"
+	EN Language = "en"
+	VI Language = "vi"
+)
+
+// ParseLanguage returns the language of a UI language or an Accept-Language
+// header like "en-US,en;q=0.9", TW if none is supported.
+func ParseLanguage(s string) Language {
+	for _, tag := range strings.Split(s, ",") {
+		tag = strings.ToLower(strings.TrimSpace(strings.SplitN(tag, ";", 2)[0]))
+		switch {
+		case tag == string(TW), tag == "zh-tw", tag == "zh-hant", strings.HasPrefix(tag, "zh-hant-"):
+			return TW
+		case tag == string(CN), tag == "zh", strings.HasPrefix(tag, "zh-"):
+			return CN
+		case tag == string(EN), strings.HasPrefix(tag, "en-"):
+			return EN
+		case tag == string(VI), strings.HasPrefix(tag, "vi-"):
+			return VI
+		}
+	}
+	return TW
+}
+
+// Text is a text in the languages. The TW text is used for the missing
+// languages.
+type Text map[Language]string
+
+// In returns the text in the language.
+func (t Text) In(lang Language) string {
+	if s, ok := t[lang]; ok {
+		return s
+	}
+	return t[TW]
+}
+
+// Table is the rows of a report. The values are strings, integers, floats or
+// decimals.
+type Table struct {
+	// Sheet is the name of the sheet of the xlsx file.
+	Sheet  string
+	Header []Text
+	Rows   [][]interface{}
+}
+
+// Write writes the table in the format with the header in the language.
+func Write(w io.Writer, format Format, lang Language, t Table) error {
+	header := make([]interface{}, len(t.Header))
+	for i, h := range t.Header {
+		header[i] = h.In(lang)
+	}
+	if format == CSV {
+		return writeCSV(w, header, t.Rows)
+	}
+	return writeExcel(w, t.Sheet, header, t.Rows)
+}
+
+// writeExcel writes the rows by a stream writer, which keeps the sheet out of
+// the memory of the workbook. The rows and the written file are still held in
+// memory.
+func writeExcel(w io.Writer, sheet string, header []interface{}, rows [][]interface{}) error {
+	f := excelize.NewFile()
+	defer f.Close()
+	f.SetSheetName(f.GetSheetName(0), sheet)
+
+	sw, err := f.NewStreamWriter(sheet)
+	if err != nil {
+		return err
+	}
+	if len(header) > 0 {
+		if err := sw.SetColWidth(1, len(header), 18); err != nil {
+			return err
+		}
+	}
+	bold, err := f.NewStyle(&excelize.Style{Font: &excelize.Font{Bold: true}})
+	if err != nil {
+		return err
+	}
+	cells := make([]interface{}, len(header))
+	for i, h := range header {
+		cells[i] = excelize.Cell{StyleID: bold, Value: h}
+	}
+	if err := sw.SetRow("A1", cells); err != nil {
+		return err
+	}
+	for i, row := range rows {
+		cell, err := excelize.CoordinatesToCellName(1, i+2)
+		if err != nil {
+			return err
+		}
+		values := make([]interface{}, len(row))
+		for j, v := range row {
+			if d, ok := v.(decimal.Decimal); ok {
+				v = d.InexactFloat64()
+			}
+			values[j] = v
+		}
+		if err := sw.SetRow(cell, values); err != nil {
+			return err
+		}
+	}
+	if err := sw.Flush(); err != nil {
+		return err
+	}
+	return f.Write(w)
+}
+
+// writeCSV writes the rows with a BOM, so the file is opened as UTF-8 by
+// Excel.
+func writeCSV(w io.Writer, header []interface{}, rows [][]interface{}) error {
+	if _, err := w.Write([]byte("\xef\xbb\xbf")); err != nil {
+		return err
+	}
+	writer := csv.NewWriter(w)
+	for _, row := range append([][]interface{}{header}, rows...) {
+		record := make([]string, len(row))
+		for i, v := range row {
+			if s, ok := v.(string); ok {
+				record[i] = escapeFormula(s)
+			} else {
+				record[i] = fmt.Sprint(v)
+			}
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// escapeFormula prefixes the text which starts like a formula with a quote,
+// so it is not run by the spreadsheets opening the CSV file. Only the texts
+// are escaped, the negative numbers are kept.
+func escapeFormula(s string) string {
+	if s != "" && strings.ContainsRune("=+-@", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
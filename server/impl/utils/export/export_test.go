@@ -0,0 +1,100 @@
+package export
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/xuri/excelize/v2"
+)
+
+func TestParseFormat(t *testing.T) {
+	assert := assert.New(t)
+
+	for s, want := range map[string]Format{"": XLSX, "xlsx": XLSX, "CSV": CSV} {
+		f, err := ParseFormat(s)
+		assert.NoError(err)
+		assert.Equal(want, f)
+	}
+	_, err := ParseFormat("pdf")
+	assert.EqualError(err, "unknown format: pdf")
+}
+
+func TestParseLanguage(t *testing.T) {
+	tests := []struct {
+		s    string
+		want Language
+	}{
+		{s: "", want: TW},
+		{s: "en", want: EN},
+		{s: "vi", want: VI},
+		{s: "zh-TW,zh;q=0.9", want: TW},
+		{s: "zh-Hant-HK", want: TW},
+		{s: "zh-CN", want: CN},
+		{s: "fr-FR, en-US;q=0.8", want: EN},
+		{s: "fr", want: TW},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, ParseLanguage(tt.s), tt.s)
+	}
+}
+
+var testTable = Table{
+	Sheet: "Report",
+	Header: []Text{
+		{TW: "工單號碼", EN: "Work order ID"},
+		{TW: "數量"},
+		{TW: "首數", EN: "Batches"},
+	},
+	Rows: [][]interface{}{
+		{"WO1", decimal.RequireFromString("12.5"), int64(3)},
+		{"WO2, \"B\"", decimal.Zero, int64(0)},
+	},
+}
+
+func TestWrite_excel(t *testing.T) {
+	assert := assert.New(t)
+
+	var buf bytes.Buffer
+	assert.NoError(Write(&buf, XLSX, EN, testTable))
+
+	f, err := excelize.OpenReader(&buf)
+	if !assert.NoError(err) {
+		return
+	}
+	defer f.Close()
+	assert.Equal([]string{"Report"}, f.GetSheetList())
+	rows, err := f.GetRows("Report")
+	assert.NoError(err)
+	assert.Equal([][]string{
+		{"Work order ID", "數量", "Batches"},
+		{"WO1", "12.5", "3"},
+		{"WO2, \"B\"", "0", "0"},
+	}, rows)
+}
+
+func TestWrite_csv(t *testing.T) {
+	assert := assert.New(t)
+
+	var buf bytes.Buffer
+	assert.NoError(Write(&buf, CSV, TW, testTable))
+	assert.Equal("\xef\xbb\xbf工單號碼,數量,首數\nWO1,12.5,3\n\"WO2, \"\"B\"\"\",0,0\n", buf.String())
+}
+
+func TestWrite_csvFormula(t *testing.T) {
+	assert := assert.New(t)
+
+	var buf bytes.Buffer
+	assert.NoError(Write(&buf, CSV, TW, Table{
+		Header: []Text{{TW: "備註"}, {TW: "數量"}},
+		Rows: [][]interface{}{
+			{"=1+2", decimal.RequireFromString("-1.5")},
+			{"+1", int64(-2)},
+			{"-1", int64(0)},
+			{"@SUM(A1)", int64(0)},
+			{"a=b", int64(0)},
+		},
+	}))
+	assert.Equal("\xef\xbb\xbf備註,數量\n'=1+2,-1.5\n'+1,-2\n'-1,0\n'@SUM(A1),0\na=b,0\n", buf.String())
+}
@@ -0,0 +1,95 @@
+package genealogy
+
+import (
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// Row is a node flattened in the depth-first order of the trees.
+type Row struct {
+	// Level is 0 for the roots.
+	Level int
+	// Parent is the resource ID of the parent node, empty for the roots.
+	Parent string
+	Node   *Node
+}
+
+// Flatten flattens the trees in the depth-first order.
+func Flatten(roots []*Node) []Row {
+	var rows []Row
+	var walk func(n *Node, level int, parent string)
+	walk = func(n *Node, level int, parent string) {
+		rows = append(rows, Row{Level: level, Parent: parent, Node: n})
+		for _, child := range n.Children {
+			walk(child, level+1, n.ResourceID)
+		}
+	}
+	for _, root := range roots {
+		walk(root, 0, "")
+	}
+	return rows
+}
+
+const exportSheet = "Genealogy"
+
+var exportHeader = []interface{}{
+	"Level", "Parent", "Resource ID", "Product ID", "Lot Number", "Work Order",
+	"Batch", "Station", "Quantity", "Created At", "Note",
+}
+
+// WriteExcel writes the trees into a workbook, a row per node.
+func WriteExcel(w io.Writer, direction Direction, roots []*Node) error {
+	f := excelize.NewFile()
+	defer f.Close()
+	f.SetSheetName(f.GetSheetName(0), exportSheet)
+
+	if err := f.SetSheetRow(exportSheet, "A1", &exportHeader); err != nil {
+		return err
+	}
+	for i, row := range Flatten(roots) {
+		cell, err := excelize.CoordinatesToCellName(1, i+2)
+		if err != nil {
+			return err
+		}
+		values := exportValues(row)
+		if err := f.SetSheetRow(exportSheet, cell, &values); err != nil {
+			return err
+		}
+	}
+	if err := f.SetDocProps(&excelize.DocProperties{
+		Title: direction.String() + " genealogy",
+	}); err != nil {
+		return err
+	}
+	return f.Write(w)
+}
+
+func exportValues(row Row) []interface{} {
+	n := row.Node
+	var batch, quantity, createdAt string
+	if n.Batch != nil {
+		batch = strconv.Itoa(int(*n.Batch))
+	}
+	if !n.Unknown {
+		quantity = n.Quantity.String()
+	}
+	if !n.CreatedAt.IsZero() {
+		createdAt = n.CreatedAt.Format(time.RFC3339)
+	}
+	var note string
+	switch {
+	case n.Repeated:
+		note = "repeated"
+	case n.Truncated:
+		note = "truncated"
+	case n.Unknown:
+		note = "unknown"
+	}
+	return []interface{}{
+		row.Level, row.Parent, n.ResourceID, n.ProductID, n.LotNumber, n.WorkOrder,
+		batch, n.Station, quantity, createdAt, note,
+	}
+}
@@ -0,0 +1,346 @@
+// Package genealogy traces the material resources through the production
+// records, backward to the resources consumed to produce them and forward to
+// the resources produced from them.
+package genealogy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"gitlab.kenda.com.tw/kenda/mui/server/database"
+)
+
+// Depth limits of a trace.
+const (
+	// DefaultDepth is used if the depth of the request is not positive.
+	DefaultDepth = 5
+	// MaxDepth is the deepest depth of a trace, the deeper requests are
+	// limited to it.
+	MaxDepth = 20
+)
+
+// ErrInvalidRequest is returned if neither or both of the resource ID and the
+// lot number are specified.
+var ErrInvalidRequest = errors.New("either resource id or lot number is required")
+
+// Direction of a trace.
+type Direction int
+
+// Directions of a trace.
+const (
+	// Backward traces the resources consumed to produce the resource.
+	Backward Direction = iota
+	// Forward traces the resources produced from the resource.
+	Forward
+)
+
+// ParseDirection returns the direction by its name, "backward" or "forward".
+func ParseDirection(name string) (Direction, error) {
+	switch name {
+	case "backward":
+		return Backward, nil
+	case "forward":
+		return Forward, nil
+	}
+	return 0, fmt.Errorf("unknown trace direction: %q", name)
+}
+
+// String implements fmt.Stringer interface.
+func (d Direction) String() string {
+	if d == Forward {
+		return "forward"
+	}
+	return "backward"
+}
+
+// Source is where the production records are traced, which is implemented by
+// database.RecordStore.
+type Source interface {
+	ListCollectRecords(ctx context.Context, filter database.RecordFilter, page database.Pagination) ([]database.CollectRecord, database.RecordTotals, error)
+	ListConsumedResources(ctx context.Context, workOrder string, batch *int16) ([]string, error)
+	ListConsumingBatches(ctx context.Context, resourceID string) ([]database.BatchKey, error)
+}
+
+// Resolver looks up the resources which were not collected by MUI, e.g. the
+// raw materials, which is implemented by the material resources of the data
+// manager.
+type Resolver interface {
+	// ResolveResources returns the nodes of the found resources by their IDs,
+	// the resources not found are omitted.
+	ResolveResources(ctx context.Context, resourceIDs []string) (map[string]Node, error)
+}
+
+// Request of a trace.
+type Request struct {
+	// Either ResourceID or LotNumber is traced, all the resources collected in
+	// the lot are traced by the lot number.
+	ResourceID string
+	LotNumber  string
+	Direction  Direction
+	// Depth is the levels traced below the requested resources.
+	Depth int
+}
+
+// Node is a traced resource. The resources not collected by MUI, e.g. the raw
+// materials, are resolved by the data manager, which have no work order, batch
+// and lot number, and whose CreatedAt is the production time.
+type Node struct {
+	ResourceID string
+	ProductID  string
+	LotNumber  string
+	WorkOrder  string
+	Batch      *int16
+	Station    string
+	Quantity   decimal.Decimal
+	CreatedAt  time.Time
+	// Children are the consumed resources if traced backward, or the produced
+	// resources if traced forward.
+	Children []*Node
+	// Truncated is true if the resource has children which are not traced
+	// because of the depth limit.
+	Truncated bool
+	// Repeated is true if the resource is traced elsewhere in the tree, and
+	// its children are not traced again.
+	Repeated bool
+	// Unknown is true if the resource was found neither in the collect
+	// records nor by the data manager, and then only ResourceID is set.
+	Unknown bool
+}
+
+// Trace returns the genealogy trees of the requested resources.
+func Trace(ctx context.Context, source Source, resolver Resolver, req Request) ([]*Node, error) {
+	if (req.ResourceID == "") == (req.LotNumber == "") {
+		return nil, ErrInvalidRequest
+	}
+	depth := req.Depth
+	if depth <= 0 {
+		depth = DefaultDepth
+	}
+	if depth > MaxDepth {
+		depth = MaxDepth
+	}
+
+	t := &tracer{
+		source:    source,
+		resolver:  resolver,
+		direction: req.Direction,
+		depth:     depth,
+		visited:   make(map[string]bool),
+		collects:  make(map[string][]database.CollectRecord),
+	}
+
+	var roots []*Node
+	if req.LotNumber != "" {
+		records, err := t.listCollects(ctx, database.RecordFilter{LotNumber: req.LotNumber})
+		if err != nil {
+			return nil, err
+		}
+		if len(records) == 0 {
+			return nil, database.ErrRecordNotFound
+		}
+		roots = make([]*Node, len(records))
+		for i, record := range records {
+			roots[i] = newNode(record)
+		}
+	} else {
+		var err error
+		if roots, err = t.nodes(ctx, []string{req.ResourceID}); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, root := range roots {
+		t.visited[root.ResourceID] = true
+	}
+	for _, root := range roots {
+		if err := t.expand(ctx, root, 0); err != nil {
+			return nil, err
+		}
+	}
+	return roots, nil
+}
+
+type tracer struct {
+	source    Source
+	resolver  Resolver
+	direction Direction
+	depth     int
+
+	// visited are the resource IDs in the tree.
+	visited map[string]bool
+	// collects are the collect records of the work orders traced forward.
+	collects map[string][]database.CollectRecord
+}
+
+func newNode(record database.CollectRecord) *Node {
+	return &Node{
+		ResourceID: record.ResourceID,
+		ProductID:  record.ProductID,
+		LotNumber:  record.LotNumber,
+		WorkOrder:  record.WorkOrder,
+		Batch:      record.Batch,
+		Station:    record.Station,
+		Quantity:   record.Quantity,
+		CreatedAt:  record.CreatedAt,
+	}
+}
+
+// listCollects lists the filtered collect records which are not reversed.
+func (t *tracer) listCollects(ctx context.Context, filter database.RecordFilter) ([]database.CollectRecord, error) {
+	records, _, err := t.source.ListCollectRecords(ctx, filter, database.Pagination{})
+	if err != nil {
+		return nil, err
+	}
+	collects := make([]database.CollectRecord, 0, len(records))
+	for _, record := range records {
+		if !record.Reversed {
+			collects = append(collects, record)
+		}
+	}
+	return collects, nil
+}
+
+// nodes returns the nodes of the resources by their latest collect records.
+// The resources not collected are resolved together by the resolver.
+func (t *tracer) nodes(ctx context.Context, resourceIDs []string) ([]*Node, error) {
+	nodes := make([]*Node, len(resourceIDs))
+	var unresolved []string
+	for i, id := range resourceIDs {
+		records, err := t.listCollects(ctx, database.RecordFilter{ResourceID: id})
+		if err != nil {
+			return nil, err
+		}
+		if len(records) == 0 {
+			unresolved = append(unresolved, id)
+			continue
+		}
+		nodes[i] = newNode(records[0])
+	}
+	if len(unresolved) == 0 {
+		return nodes, nil
+	}
+
+	resolved, err := t.resolver.ResolveResources(ctx, unresolved)
+	if err != nil {
+		return nil, err
+	}
+	for i, id := range resourceIDs {
+		if nodes[i] != nil {
+			continue
+		}
+		if n, ok := resolved[id]; ok {
+			n.ResourceID = id
+			nodes[i] = &n
+		} else {
+			nodes[i] = &Node{ResourceID: id, Unknown: true}
+		}
+	}
+	return nodes, nil
+}
+
+// expand traces the children of the node at the depth.
+func (t *tracer) expand(ctx context.Context, n *Node, depth int) error {
+	var (
+		children []*Node
+		err      error
+	)
+	if t.direction == Forward {
+		children, err = t.produced(ctx, n)
+	} else {
+		children, err = t.consumed(ctx, n, depth >= t.depth)
+	}
+	if err != nil {
+		return err
+	}
+	if len(children) == 0 {
+		return nil
+	}
+	if depth >= t.depth {
+		n.Truncated = true
+		return nil
+	}
+
+	// the children are marked visited before being expanded so that a
+	// resource appearing at several levels is expanded at the nearest one.
+	var expanding []*Node
+	for _, child := range children {
+		if t.visited[child.ResourceID] {
+			child.Repeated = true
+			continue
+		}
+		t.visited[child.ResourceID] = true
+		expanding = append(expanding, child)
+	}
+	n.Children = children
+	for _, child := range expanding {
+		if err := t.expand(ctx, child, depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// consumed returns the resources consumed by the batch producing the node.
+// Only their IDs are returned if limited, where the children are not traced.
+func (t *tracer) consumed(ctx context.Context, n *Node, limited bool) ([]*Node, error) {
+	if n.WorkOrder == "" {
+		return nil, nil
+	}
+	ids, err := t.source.ListConsumedResources(ctx, n.WorkOrder, n.Batch)
+	if err != nil {
+		return nil, err
+	}
+	consumed := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if id != n.ResourceID {
+			consumed = append(consumed, id)
+		}
+	}
+	if len(consumed) == 0 {
+		return nil, nil
+	}
+	if limited {
+		children := make([]*Node, len(consumed))
+		for i, id := range consumed {
+			children[i] = &Node{ResourceID: id}
+		}
+		return children, nil
+	}
+	return t.nodes(ctx, consumed)
+}
+
+// produced returns the resources collected from the batches consuming the
+// node. The collects not bound to a batch are produced by all the batches of
+// the work order.
+func (t *tracer) produced(ctx context.Context, n *Node) ([]*Node, error) {
+	batches, err := t.source.ListConsumingBatches(ctx, n.ResourceID)
+	if err != nil {
+		return nil, err
+	}
+	var children []*Node
+	added := make(map[string]bool)
+	for _, batch := range batches {
+		records, ok := t.collects[batch.WorkOrder]
+		if !ok {
+			if records, err = t.listCollects(ctx, database.RecordFilter{WorkOrder: batch.WorkOrder}); err != nil {
+				return nil, err
+			}
+			t.collects[batch.WorkOrder] = records
+		}
+		for _, record := range records {
+			if record.Batch != nil && *record.Batch != batch.Batch {
+				continue
+			}
+			if record.ResourceID == "" || record.ResourceID == n.ResourceID || added[record.ResourceID] {
+				continue
+			}
+			added[record.ResourceID] = true
+			children = append(children, newNode(record))
+		}
+	}
+	return children, nil
+}
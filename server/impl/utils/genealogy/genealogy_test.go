@@ -0,0 +1,293 @@
+package genealogy
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sort"
+	"testing"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/xuri/excelize/v2"
+
+	"gitlab.kenda.com.tw/kenda/mui/server/database"
+)
+
+type fakeSource struct {
+	collects []database.CollectRecord
+	feeds    map[database.BatchKey][]string
+	err      error
+}
+
+func (s fakeSource) ListCollectRecords(_ context.Context, filter database.RecordFilter, _ database.Pagination) ([]database.CollectRecord, database.RecordTotals, error) {
+	if s.err != nil {
+		return nil, database.RecordTotals{}, s.err
+	}
+	var records []database.CollectRecord
+	for _, record := range s.collects {
+		if (filter.WorkOrder == "" || filter.WorkOrder == record.WorkOrder) &&
+			(filter.ResourceID == "" || filter.ResourceID == record.ResourceID) &&
+			(filter.LotNumber == "" || filter.LotNumber == record.LotNumber) {
+			records = append(records, record)
+		}
+	}
+	return records, database.RecordTotals{Count: int64(len(records))}, nil
+}
+
+func (s fakeSource) ListConsumedResources(_ context.Context, workOrder string, batch *int16) ([]string, error) {
+	set := make(map[string]bool)
+	for key, ids := range s.feeds {
+		if key.WorkOrder == workOrder && (batch == nil || *batch == key.Batch) {
+			for _, id := range ids {
+				set[id] = true
+			}
+		}
+	}
+	var ids []string
+	for id := range set {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+func (s fakeSource) ListConsumingBatches(_ context.Context, resourceID string) ([]database.BatchKey, error) {
+	var batches []database.BatchKey
+	for key, ids := range s.feeds {
+		for _, id := range ids {
+			if id == resourceID {
+				batches = append(batches, key)
+			}
+		}
+	}
+	sort.Slice(batches, func(i, j int) bool {
+		if batches[i].WorkOrder != batches[j].WorkOrder {
+			return batches[i].WorkOrder < batches[j].WorkOrder
+		}
+		return batches[i].Batch < batches[j].Batch
+	})
+	return batches, nil
+}
+
+// fakeResolver resolves RAW1 only, and records the lookups.
+type fakeResolver struct {
+	lookups [][]string
+	err     error
+}
+
+func (r *fakeResolver) ResolveResources(_ context.Context, resourceIDs []string) (map[string]Node, error) {
+	r.lookups = append(r.lookups, resourceIDs)
+	if r.err != nil {
+		return nil, r.err
+	}
+	nodes := make(map[string]Node)
+	for _, id := range resourceIDs {
+		if id == "RAW1" {
+			nodes[id] = Node{ProductID: "R", Station: "S1", Quantity: decimal.NewFromInt(20)}
+		}
+	}
+	return nodes, nil
+}
+
+func batchOf(n int16) *int16 {
+	return &n
+}
+
+// newFakeSource returns the records of:
+//
+//	RAW1, RAW2 --WO1#1--> MID1 (L1)
+//	MID1 --WO2#3--> FIN1 (L2), and FIN2 (L2) collected without a batch
+//	FIN1, MID1 --WO3#1--> FIN3 (L3)
+func newFakeSource() fakeSource {
+	return fakeSource{
+		collects: []database.CollectRecord{
+			{WorkOrder: "WO1", Sequence: 2, Batch: batchOf(1), ResourceID: "MIDX", LotNumber: "L1", Reversed: true},
+			{WorkOrder: "WO1", Sequence: 1, Batch: batchOf(1), ResourceID: "MID1", LotNumber: "L1", ProductID: "M", Quantity: decimal.NewFromInt(10)},
+			{WorkOrder: "WO2", Sequence: 2, ResourceID: "FIN2", LotNumber: "L2", ProductID: "F"},
+			{WorkOrder: "WO2", Sequence: 1, Batch: batchOf(3), ResourceID: "FIN1", LotNumber: "L2", ProductID: "F"},
+			{WorkOrder: "WO3", Sequence: 1, Batch: batchOf(1), ResourceID: "FIN3", LotNumber: "L3", ProductID: "G"},
+		},
+		feeds: map[database.BatchKey][]string{
+			{WorkOrder: "WO1", Batch: 1}: {"RAW1", "RAW2"},
+			{WorkOrder: "WO2", Batch: 3}: {"MID1"},
+			{WorkOrder: "WO3", Batch: 1}: {"FIN1", "MID1"},
+		},
+	}
+}
+
+// shape returns the resource IDs of the tree, with "+" for the truncated, "*"
+// for the repeated and "?" for the unknown nodes.
+func shape(nodes []*Node) []interface{} {
+	s := make([]interface{}, 0, len(nodes))
+	for _, n := range nodes {
+		id := n.ResourceID
+		if n.Truncated {
+			id += "+"
+		}
+		if n.Repeated {
+			id += "*"
+		}
+		if n.Unknown {
+			id += "?"
+		}
+		if len(n.Children) == 0 {
+			s = append(s, id)
+			continue
+		}
+		s = append(s, map[string][]interface{}{id: shape(n.Children)})
+	}
+	return s
+}
+
+func TestTrace(t *testing.T) {
+	tests := []struct {
+		name    string
+		req     Request
+		want    []interface{}
+		wantErr error
+	}{
+		{
+			name: "backward",
+			req:  Request{ResourceID: "FIN3"},
+			want: []interface{}{
+				map[string][]interface{}{"FIN3": {
+					map[string][]interface{}{"FIN1": {"MID1*"}},
+					map[string][]interface{}{"MID1": {"RAW1", "RAW2?"}},
+				}},
+			},
+		},
+		{
+			name: "backward collected without batch",
+			req:  Request{ResourceID: "FIN2", Depth: 1},
+			want: []interface{}{
+				map[string][]interface{}{"FIN2": {"MID1+"}},
+			},
+		},
+		{
+			name: "forward",
+			req:  Request{ResourceID: "RAW1", Direction: Forward},
+			want: []interface{}{
+				map[string][]interface{}{"RAW1": {
+					map[string][]interface{}{"MID1": {
+						"FIN2",
+						map[string][]interface{}{"FIN1": {"FIN3*"}},
+						"FIN3",
+					}},
+				}},
+			},
+		},
+		{
+			name: "forward with depth limit",
+			req:  Request{ResourceID: "RAW1", Direction: Forward, Depth: 1},
+			want: []interface{}{
+				map[string][]interface{}{"RAW1": {"MID1+"}},
+			},
+		},
+		{
+			name: "by lot number",
+			req:  Request{LotNumber: "L2", Depth: 1},
+			want: []interface{}{
+				map[string][]interface{}{"FIN2": {"MID1+"}},
+				map[string][]interface{}{"FIN1": {"MID1*"}},
+			},
+		},
+		{
+			name: "by lot number, reversed excluded",
+			req:  Request{LotNumber: "L1", Direction: Forward, Depth: 1},
+			want: []interface{}{
+				map[string][]interface{}{"MID1": {"FIN2", "FIN1+", "FIN3"}},
+			},
+		},
+		{
+			name: "not collected resource",
+			req:  Request{ResourceID: "UNKNOWN"},
+			want: []interface{}{"UNKNOWN?"},
+		},
+		{
+			name:    "lot not found",
+			req:     Request{LotNumber: "L9"},
+			wantErr: database.ErrRecordNotFound,
+		},
+		{
+			name:    "neither resource id nor lot number",
+			req:     Request{},
+			wantErr: ErrInvalidRequest,
+		},
+		{
+			name:    "both resource id and lot number",
+			req:     Request{ResourceID: "FIN1", LotNumber: "L2"},
+			wantErr: ErrInvalidRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Trace(context.Background(), newFakeSource(), &fakeResolver{}, tt.req)
+			assert.ErrorIs(t, err, tt.wantErr)
+			if tt.wantErr == nil {
+				assert.Equal(t, tt.want, shape(got))
+			}
+		})
+	}
+}
+
+func TestTrace_sourceError(t *testing.T) {
+	source := newFakeSource()
+	source.err = errors.New("broken")
+	_, err := Trace(context.Background(), source, &fakeResolver{}, Request{ResourceID: "FIN1"})
+	assert.EqualError(t, err, "broken")
+
+	_, err = Trace(context.Background(), newFakeSource(), &fakeResolver{err: errors.New("broken")}, Request{ResourceID: "MID1"})
+	assert.EqualError(t, err, "broken")
+}
+
+func TestTrace_resolved(t *testing.T) {
+	assert := assert.New(t)
+	resolver := &fakeResolver{}
+	roots, err := Trace(context.Background(), newFakeSource(), resolver, Request{ResourceID: "MID1"})
+	assert.NoError(err)
+	// the consumed resources not collected are resolved together.
+	assert.Equal([][]string{{"RAW1", "RAW2"}}, resolver.lookups)
+	if assert.Len(roots, 1) && assert.Len(roots[0].Children, 2) {
+		assert.Equal(&Node{ResourceID: "RAW1", ProductID: "R", Station: "S1", Quantity: decimal.NewFromInt(20)}, roots[0].Children[0])
+		assert.Equal(&Node{ResourceID: "RAW2", Unknown: true}, roots[0].Children[1])
+	}
+
+	// a collected resource is not resolved.
+	resolver = &fakeResolver{}
+	_, err = Trace(context.Background(), newFakeSource(), resolver, Request{ResourceID: "FIN2", Depth: 1})
+	assert.NoError(err)
+	assert.Empty(resolver.lookups)
+}
+
+func TestParseDirection(t *testing.T) {
+	assert := assert.New(t)
+	d, err := ParseDirection("forward")
+	assert.NoError(err)
+	assert.Equal(Forward, d)
+	d, err = ParseDirection("backward")
+	assert.NoError(err)
+	assert.Equal(Backward, d)
+	_, err = ParseDirection("sideways")
+	assert.Error(err)
+}
+
+func TestWriteExcel(t *testing.T) {
+	assert := assert.New(t)
+	roots, err := Trace(context.Background(), newFakeSource(), &fakeResolver{}, Request{ResourceID: "MID1"})
+	assert.NoError(err)
+
+	var buf bytes.Buffer
+	assert.NoError(WriteExcel(&buf, Backward, roots))
+
+	f, err := excelize.OpenReader(&buf)
+	assert.NoError(err)
+	rows, err := f.GetRows(exportSheet)
+	assert.NoError(err)
+	if assert.Len(rows, 4) {
+		assert.Equal("Resource ID", rows[0][2])
+		assert.Equal([]string{"0", "", "MID1", "M", "L1", "WO1", "1"}, rows[1][:7])
+		assert.Equal([]string{"1", "MID1", "RAW1", "R", "", "", "", "S1", "20"}, rows[2][:9])
+		assert.Equal([]string{"1", "MID1", "RAW2", "", "", "", "", "", "", "", "unknown"}, rows[3])
+	}
+}
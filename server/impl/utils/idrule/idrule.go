@@ -0,0 +1,428 @@
+// Package idrule generates the lot numbers and the resource IDs by the rules
+// configured per station or product type.
+//
+// A rule is a pattern of literal text and tokens in braces:
+//
+//	{YYYY} {YY} {MM} {DD} {HH}  parts of the time
+//	{JJJ}                       day of the year
+//	{WW}                        ISO week of the year
+//	{group}                     group number of the collect
+//	{shift}                     group as a letter, 1 is A
+//	{station} {station:N}       station code, left padded with 0 and cut to N characters
+//	{product} {productType}     product ID and type
+//	{seq:N} {seq:N:PERIOD}      counter of N digits, reset daily, monthly, yearly or never (default)
+//	{check} {check:luhn}        Code 39 (modulo 43) or Luhn check character of the preceding text
+//
+// "{{" and "}}" are the literal braces. The counters are kept per rule and per
+// the text generated by the other tokens, e.g. "{station:2}{seq:4:daily}"
+// counts every station from 1 every day.
+package idrule
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultLotNumber is the lot number rule used if none is configured.
+const DefaultLotNumber = "{group}{station:2}-{MM}{DD}"
+
+// Period is the reset period of a counter.
+type Period string
+
+// Period definitions.
+const (
+	PeriodNever   Period = "never"
+	PeriodDaily   Period = "daily"
+	PeriodMonthly Period = "monthly"
+	PeriodYearly  Period = "yearly"
+)
+
+// key returns the key of the period containing t.
+func (p Period) key(t time.Time) string {
+	switch p {
+	case PeriodDaily:
+		return t.Format("20060102")
+	case PeriodMonthly:
+		return t.Format("200601")
+	case PeriodYearly:
+		return t.Format("2006")
+	default:
+		return ""
+	}
+}
+
+// Counter returns the next value of the counters, starting from 1.
+type Counter interface {
+	Next(ctx context.Context, key string) (int64, error)
+}
+
+// Values are what the tokens are replaced with.
+type Values struct {
+	Time        time.Time
+	Group       int
+	Station     string
+	StationCode string
+	ProductID   string
+	ProductType string
+}
+
+const code39Chars = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ-. $/+%"
+
+type part struct {
+	// literal is the text of a literal part, name is empty.
+	literal string
+	name    string
+	width   int
+	arg     string
+}
+
+// Rule is a parsed pattern.
+type Rule struct {
+	pattern string
+	parts   []part
+	reset   Period
+	hasSeq  bool
+}
+
+// Parse parses the pattern of a rule.
+func Parse(pattern string) (Rule, error) {
+	r := Rule{pattern: pattern, reset: PeriodNever}
+	var literal strings.Builder
+	flush := func() {
+		if literal.Len() > 0 {
+			r.parts = append(r.parts, part{literal: literal.String()})
+			literal.Reset()
+		}
+	}
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; {
+		case c == '{' && strings.HasPrefix(pattern[i:], "{{"):
+			literal.WriteByte('{')
+			i++
+		case c == '}' && strings.HasPrefix(pattern[i:], "}}"):
+			literal.WriteByte('}')
+			i++
+		case c == '}':
+			return Rule{}, fmt.Errorf("unexpected } at %d of %q", i, pattern)
+		case c == '{':
+			end := strings.IndexByte(pattern[i:], '}')
+			if end < 0 {
+				return Rule{}, fmt.Errorf("unclosed { at %d of %q", i, pattern)
+			}
+			p, err := parseToken(pattern[i+1 : i+end])
+			if err != nil {
+				return Rule{}, fmt.Errorf("%v in %q", err, pattern)
+			}
+			if p.name == "seq" {
+				if r.hasSeq {
+					return Rule{}, fmt.Errorf("more than one seq in %q", pattern)
+				}
+				r.hasSeq = true
+				r.reset = Period(p.arg)
+			}
+			flush()
+			r.parts = append(r.parts, p)
+			i += end
+		default:
+			literal.WriteByte(c)
+		}
+	}
+	flush()
+	if len(r.parts) == 0 {
+		return Rule{}, fmt.Errorf("empty pattern")
+	}
+	return r, nil
+}
+
+func parseToken(token string) (part, error) {
+	fields := strings.Split(token, ":")
+	p := part{name: fields[0]}
+	args := fields[1:]
+	switch p.name {
+	case "YYYY", "YY", "MM", "DD", "HH", "JJJ", "WW", "group", "shift", "product", "productType":
+		if len(args) != 0 {
+			return part{}, fmt.Errorf("unexpected arguments of {%s}", token)
+		}
+	case "station":
+		if len(args) > 1 {
+			return part{}, fmt.Errorf("unexpected arguments of {%s}", token)
+		}
+		if len(args) == 1 {
+			width, err := strconv.Atoi(args[0])
+			if err != nil || width <= 0 {
+				return part{}, fmt.Errorf("invalid width of {%s}", token)
+			}
+			p.width = width
+		}
+	case "seq":
+		if len(args) < 1 || len(args) > 2 {
+			return part{}, fmt.Errorf("missing width of {%s}", token)
+		}
+		width, err := strconv.Atoi(args[0])
+		if err != nil || width <= 0 || width > 18 {
+			return part{}, fmt.Errorf("invalid width of {%s}", token)
+		}
+		p.width = width
+		p.arg = string(PeriodNever)
+		if len(args) == 2 {
+			switch period := Period(args[1]); period {
+			case PeriodNever, PeriodDaily, PeriodMonthly, PeriodYearly:
+				p.arg = string(period)
+			default:
+				return part{}, fmt.Errorf("invalid period of {%s}", token)
+			}
+		}
+	case "check":
+		if len(args) > 1 || (len(args) == 1 && args[0] != "luhn") {
+			return part{}, fmt.Errorf("invalid check of {%s}", token)
+		}
+		if len(args) == 1 {
+			p.arg = args[0]
+		}
+	default:
+		return part{}, fmt.Errorf("unknown token {%s}", token)
+	}
+	return p, nil
+}
+
+// String returns the pattern of the rule.
+func (r Rule) String() string {
+	return r.pattern
+}
+
+// Generate generates an ID by the rule. The counter is used only if the rule
+// has a seq token.
+func (r Rule) Generate(ctx context.Context, v Values, counter Counter) (string, error) {
+	rendered := make([]string, len(r.parts))
+	var key strings.Builder
+	for i, p := range r.parts {
+		if p.name == "seq" || p.name == "check" {
+			continue
+		}
+		rendered[i] = p.render(v)
+		key.WriteString(rendered[i])
+	}
+
+	var id strings.Builder
+	for i, p := range r.parts {
+		switch p.name {
+		case "seq":
+			if counter == nil {
+				return "", fmt.Errorf("no counter for %q", r.pattern)
+			}
+			n, err := counter.Next(ctx, fmt.Sprintf("%s|%s|%s", r.pattern, key.String(), r.reset.key(v.Time)))
+			if err != nil {
+				return "", err
+			}
+			s := fmt.Sprintf("%0*d", p.width, n)
+			if len(s) > p.width {
+				return "", fmt.Errorf("sequence %d exceeds %d digits of %q", n, p.width, r.pattern)
+			}
+			id.WriteString(s)
+		case "check":
+			c, err := checkCharacter(id.String(), p.arg)
+			if err != nil {
+				return "", fmt.Errorf("%v of %q", err, r.pattern)
+			}
+			id.WriteString(c)
+		default:
+			id.WriteString(rendered[i])
+		}
+	}
+	return id.String(), nil
+}
+
+func (p part) render(v Values) string {
+	switch p.name {
+	case "":
+		return p.literal
+	case "YYYY":
+		return v.Time.Format("2006")
+	case "YY":
+		return v.Time.Format("06")
+	case "MM":
+		return v.Time.Format("01")
+	case "DD":
+		return v.Time.Format("02")
+	case "HH":
+		return v.Time.Format("15")
+	case "JJJ":
+		return fmt.Sprintf("%03d", v.Time.YearDay())
+	case "WW":
+		_, week := v.Time.ISOWeek()
+		return fmt.Sprintf("%02d", week)
+	case "group":
+		return strconv.Itoa(v.Group)
+	case "shift":
+		if v.Group <= 0 || v.Group > 26 {
+			return strconv.Itoa(v.Group)
+		}
+		return string(rune('A' + v.Group - 1))
+	case "station":
+		code := v.StationCode
+		if p.width > 0 {
+			if len(code) < p.width {
+				code = strings.Repeat("0", p.width-len(code)) + code
+			}
+			code = code[:p.width]
+		}
+		return code
+	case "product":
+		return v.ProductID
+	case "productType":
+		return v.ProductType
+	default:
+		return ""
+	}
+}
+
+// checkCharacter returns the check character of s.
+func checkCharacter(s string, kind string) (string, error) {
+	if kind == "luhn" {
+		sum, double := 0, true
+		for i := len(s) - 1; i >= 0; i-- {
+			if s[i] < '0' || s[i] > '9' {
+				continue
+			}
+			d := int(s[i] - '0')
+			if double {
+				if d *= 2; d > 9 {
+					d -= 9
+				}
+			}
+			sum += d
+			double = !double
+		}
+		return strconv.Itoa((10 - sum%10) % 10), nil
+	}
+
+	sum := 0
+	for _, c := range strings.ToUpper(s) {
+		i := strings.IndexRune(code39Chars, c)
+		if i < 0 {
+			return "", fmt.Errorf("character %q not in Code 39", c)
+		}
+		sum += i
+	}
+	return string(code39Chars[sum%43]), nil
+}
+
+// Patterns are the patterns of the rules, the empty ones are not defined.
+type Patterns struct {
+	LotNumber  string
+	ResourceID string
+}
+
+// Config of the Generator. The rule of a station takes precedence over the
+// one of a product type, which takes precedence over the default one.
+type Config struct {
+	Default      Patterns
+	Stations     map[string]Patterns
+	ProductTypes map[string]Patterns
+}
+
+type rules struct {
+	lotNumber  *Rule
+	resourceID *Rule
+}
+
+func parseRules(p Patterns) (rules, error) {
+	var rs rules
+	if p.LotNumber != "" {
+		r, err := Parse(p.LotNumber)
+		if err != nil {
+			return rules{}, fmt.Errorf("lot number: %v", err)
+		}
+		rs.lotNumber = &r
+	}
+	if p.ResourceID != "" {
+		r, err := Parse(p.ResourceID)
+		if err != nil {
+			return rules{}, fmt.Errorf("resource ID: %v", err)
+		}
+		rs.resourceID = &r
+	}
+	return rs, nil
+}
+
+// Generator generates the IDs by the configured rules.
+type Generator struct {
+	counter Counter
+	def     rules
+	// defaultLotNumber is set if the default lot number rule is not configured.
+	defaultLotNumber bool
+	stations         map[string]rules
+	productTypes     map[string]rules
+}
+
+// NewGenerator returns a Generator of the configured rules, the counter may be
+// nil if no rule has a seq token.
+func NewGenerator(config Config, counter Counter) (*Generator, error) {
+	g := &Generator{
+		counter:      counter,
+		stations:     make(map[string]rules, len(config.Stations)),
+		productTypes: make(map[string]rules, len(config.ProductTypes)),
+	}
+
+	var err error
+	if g.def, err = parseRules(config.Default); err != nil {
+		return nil, fmt.Errorf("default %v", err)
+	}
+	if g.def.lotNumber == nil {
+		g.defaultLotNumber = true
+		r, err := Parse(DefaultLotNumber)
+		if err != nil {
+			return nil, err
+		}
+		g.def.lotNumber = &r
+	}
+	for station, p := range config.Stations {
+		if g.stations[station], err = parseRules(p); err != nil {
+			return nil, fmt.Errorf("station %s %v", station, err)
+		}
+	}
+	for productType, p := range config.ProductTypes {
+		if g.productTypes[productType], err = parseRules(p); err != nil {
+			return nil, fmt.Errorf("product type %s %v", productType, err)
+		}
+	}
+	return g, nil
+}
+
+// rule returns the first defined rule of the station, the product type and
+// the default ones.
+func (g *Generator) rule(v Values, get func(rules) *Rule) *Rule {
+	if r := get(g.stations[v.Station]); r != nil {
+		return r
+	}
+	if r := get(g.productTypes[v.ProductType]); r != nil {
+		return r
+	}
+	return get(g.def)
+}
+
+// Has reports whether the lot number rule and the resource ID rule are
+// configured for the values, other than DefaultLotNumber.
+func (g *Generator) Has(v Values) (lotNumber, resourceID bool) {
+	lot := g.rule(v, func(rs rules) *Rule { return rs.lotNumber })
+	return lot != g.def.lotNumber || !g.defaultLotNumber,
+		g.rule(v, func(rs rules) *Rule { return rs.resourceID }) != nil
+}
+
+// LotNumber generates a lot number, by DefaultLotNumber if no rule is configured.
+func (g *Generator) LotNumber(ctx context.Context, v Values) (string, error) {
+	return g.rule(v, func(rs rules) *Rule { return rs.lotNumber }).Generate(ctx, v, g.counter)
+}
+
+// ResourceID generates a resource ID, or returns empty if no rule is
+// configured, by which the data manager generates the ID itself.
+func (g *Generator) ResourceID(ctx context.Context, v Values) (string, error) {
+	r := g.rule(v, func(rs rules) *Rule { return rs.resourceID })
+	if r == nil {
+		return "", nil
+	}
+	return r.Generate(ctx, v, g.counter)
+}
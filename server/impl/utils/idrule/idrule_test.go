@@ -0,0 +1,223 @@
+package idrule
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type counter map[string]int64
+
+func (c counter) Next(_ context.Context, key string) (int64, error) {
+	c[key]++
+	return c[key], nil
+}
+
+type brokenCounter struct{}
+
+func (brokenCounter) Next(context.Context, string) (int64, error) {
+	return 0, errors.New("broken")
+}
+
+func TestParse(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, pattern := range []string{
+		"{YYYY}{YY}{MM}{DD}{HH}{JJJ}{WW}",
+		"{group}{shift}{station}{station:3}{product}{productType}",
+		"{seq:4}",
+		"{seq:4:daily}{check}",
+		"{{literal}}{check:luhn}",
+	} {
+		_, err := Parse(pattern)
+		assert.NoError(err, pattern)
+	}
+
+	for pattern, msg := range map[string]string{
+		"":               "empty pattern",
+		"{unknown}":      `unknown token {unknown} in "{unknown}"`,
+		"{MM":            `unclosed { at 0 of "{MM"`,
+		"MM}":            `unexpected } at 2 of "MM}"`,
+		"{MM:2}":         `unexpected arguments of {MM:2} in "{MM:2}"`,
+		"{station:0}":    `invalid width of {station:0} in "{station:0}"`,
+		"{seq}":          `missing width of {seq} in "{seq}"`,
+		"{seq:x}":        `invalid width of {seq:x} in "{seq:x}"`,
+		"{seq:4:weekly}": `invalid period of {seq:4:weekly} in "{seq:4:weekly}"`,
+		"{seq:4}{seq:2}": `more than one seq in "{seq:4}{seq:2}"`,
+		"{check:crc}":    `invalid check of {check:crc} in "{check:crc}"`,
+	} {
+		_, err := Parse(pattern)
+		assert.EqualError(err, msg, pattern)
+	}
+}
+
+func TestRule_Generate(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	v := Values{
+		Time:        time.Date(2024, 3, 7, 15, 4, 5, 0, time.Local),
+		Group:       2,
+		Station:     "ST-A",
+		StationCode: "5",
+		ProductID:   "P1",
+		ProductType: "TIRE",
+	}
+	generate := func(pattern string, v Values, c Counter) (string, error) {
+		r, err := Parse(pattern)
+		if err != nil {
+			return "", err
+		}
+		return r.Generate(ctx, v, c)
+	}
+
+	{ // date and values.
+		id, err := generate("{YYYY}{YY}{MM}{DD}{HH}-{JJJ}-{WW}-{group}{shift}-{station}{station:3}-{product}-{productType}-{{x}}", v, nil)
+		assert.NoError(err)
+		assert.Equal("202424030715-067-10-2B-5005-P1-TIRE-{x}", id)
+	}
+	{ // the default lot number, same as ever.
+		id, err := generate(DefaultLotNumber, v, nil)
+		assert.NoError(err)
+		assert.Equal("205-0307", id)
+
+		v := v
+		v.StationCode = "123"
+		id, err = generate(DefaultLotNumber, v, nil)
+		assert.NoError(err)
+		assert.Equal("212-0307", id)
+	}
+	{ // sequences are counted by the fixed text and reset by the period.
+		c := counter{}
+		for _, expected := range []string{"5-001", "5-002"} {
+			id, err := generate("{station}-{seq:3:daily}", v, c)
+			assert.NoError(err)
+			assert.Equal(expected, id)
+		}
+
+		other := v
+		other.StationCode = "6"
+		id, err := generate("{station}-{seq:3:daily}", other, c)
+		assert.NoError(err)
+		assert.Equal("6-001", id)
+
+		tomorrow := v
+		tomorrow.Time = v.Time.AddDate(0, 0, 1)
+		id, err = generate("{station}-{seq:3:daily}", tomorrow, c)
+		assert.NoError(err)
+		assert.Equal("5-001", id)
+
+		id, err = generate("{station}-{seq:3:monthly}", tomorrow, c)
+		assert.NoError(err)
+		assert.Equal("5-001", id)
+		id, err = generate("{station}-{seq:3:monthly}", v, c)
+		assert.NoError(err)
+		assert.Equal("5-002", id)
+	}
+	{ // sequence overflow.
+		c := counter{"{seq:1}||": 9}
+		_, err := generate("{seq:1}", v, c)
+		assert.EqualError(err, `sequence 10 exceeds 1 digits of "{seq:1}"`)
+	}
+	{ // no or broken counter.
+		_, err := generate("{seq:1}", v, nil)
+		assert.EqualError(err, `no counter for "{seq:1}"`)
+		_, err = generate("{seq:1}", v, brokenCounter{})
+		assert.EqualError(err, "broken")
+	}
+	{ // check characters.
+		id, err := generate("AB12{check}", v, nil)
+		assert.NoError(err)
+		assert.Equal("AB12O", id)
+
+		id, err = generate("799273987{seq:1}{check:luhn}", v, counter{})
+		assert.NoError(err)
+		assert.Equal("79927398713", id)
+
+		_, err = generate("a_{check}", v, nil)
+		assert.EqualError(err, `character '_' not in Code 39 of "a_{check}"`)
+	}
+}
+
+func TestGenerator(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	v := Values{
+		Time:        time.Date(2024, 3, 7, 0, 0, 0, 0, time.Local),
+		Group:       1,
+		Station:     "ST-A",
+		StationCode: "12",
+		ProductType: "TIRE",
+	}
+
+	{ // nothing configured.
+		g, err := NewGenerator(Config{}, nil)
+		assert.NoError(err)
+
+		id, err := g.LotNumber(ctx, v)
+		assert.NoError(err)
+		assert.Equal("112-0307", id)
+
+		id, err = g.ResourceID(ctx, v)
+		assert.NoError(err)
+		assert.Empty(id)
+
+		lotNumber, resourceID := g.Has(v)
+		assert.False(lotNumber)
+		assert.False(resourceID)
+	}
+	{ // precedence.
+		g, err := NewGenerator(Config{
+			Default: Patterns{LotNumber: "D{MM}", ResourceID: "R{seq:2}"},
+			Stations: map[string]Patterns{
+				"ST-A": {LotNumber: "S{MM}"},
+			},
+			ProductTypes: map[string]Patterns{
+				"TIRE": {LotNumber: "T{MM}", ResourceID: "T{seq:2}"},
+			},
+		}, counter{})
+		assert.NoError(err)
+
+		id, err := g.LotNumber(ctx, v)
+		assert.NoError(err)
+		assert.Equal("S03", id)
+		id, err = g.ResourceID(ctx, v)
+		assert.NoError(err)
+		assert.Equal("T01", id)
+
+		other := Values{Time: v.Time, Station: "ST-B"}
+		id, err = g.LotNumber(ctx, other)
+		assert.NoError(err)
+		assert.Equal("D03", id)
+		id, err = g.ResourceID(ctx, other)
+		assert.NoError(err)
+		assert.Equal("R01", id)
+
+		lotNumber, resourceID := g.Has(other)
+		assert.True(lotNumber)
+		assert.True(resourceID)
+	}
+	{ // only a station rule.
+		g, err := NewGenerator(Config{
+			Stations: map[string]Patterns{"ST-A": {ResourceID: "{seq:2}"}},
+		}, counter{})
+		assert.NoError(err)
+
+		lotNumber, resourceID := g.Has(v)
+		assert.False(lotNumber)
+		assert.True(resourceID)
+		lotNumber, resourceID = g.Has(Values{Station: "ST-B"})
+		assert.False(lotNumber)
+		assert.False(resourceID)
+	}
+	{ // bad rules.
+		_, err := NewGenerator(Config{
+			Stations: map[string]Patterns{
+				"ST-A": {ResourceID: "{seq}"},
+			},
+		}, nil)
+		assert.EqualError(err, `station ST-A resource ID: missing width of {seq} in "{seq}"`)
+	}
+}
@@ -0,0 +1,296 @@
+// Package lockout tracks the failed logins per account and per IP to slow down
+// and block the password guessing. The failed logins are kept in the database
+// so that they survive restarts and are shared by the replicas.
+package lockout
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"gitlab.kenda.com.tw/kenda/mui/server/database"
+)
+
+// Kind is the kind of a tracked target.
+type Kind string
+
+// Kind definitions.
+const (
+	KindAccount Kind = "ACCOUNT"
+	KindIP      Kind = "IP"
+)
+
+// Default settings used if the fields of Config are not set.
+const (
+	DefaultMaxAccountFailures = 5
+	DefaultMaxIPFailures      = 50
+	DefaultLockoutDuration    = 15 * time.Minute
+	DefaultFailureWindow      = 15 * time.Minute
+	DefaultDelay              = time.Second
+	DefaultMaxDelay           = 30 * time.Second
+)
+
+// Config of the Tracker.
+type Config struct {
+	// MaxAccountFailures is the number of consecutive failed logins before an
+	// account is locked.
+	MaxAccountFailures int
+	// MaxIPFailures is the number of failed logins before an IP is locked.
+	MaxIPFailures   int
+	LockoutDuration time.Duration
+	// FailureWindow is the time after the last failure when the failures of
+	// the target are forgotten.
+	FailureWindow time.Duration
+	// Delay is the time an account has to wait after its first failed login,
+	// which is doubled for every further failure up to MaxDelay.
+	Delay    time.Duration
+	MaxDelay time.Duration
+}
+
+func (c Config) withDefaults() Config {
+	if c.MaxAccountFailures <= 0 {
+		c.MaxAccountFailures = DefaultMaxAccountFailures
+	}
+	if c.MaxIPFailures <= 0 {
+		c.MaxIPFailures = DefaultMaxIPFailures
+	}
+	if c.LockoutDuration <= 0 {
+		c.LockoutDuration = DefaultLockoutDuration
+	}
+	if c.FailureWindow <= 0 {
+		c.FailureWindow = DefaultFailureWindow
+	}
+	if c.Delay <= 0 {
+		c.Delay = DefaultDelay
+	}
+	if c.MaxDelay <= 0 {
+		c.MaxDelay = DefaultMaxDelay
+	}
+	return c
+}
+
+// Key identifies a tracked target.
+type Key struct {
+	Kind   Kind
+	Target string
+}
+
+// Lockout is a locked target.
+type Lockout struct {
+	Key
+	Failures    int
+	LockedUntil time.Time
+}
+
+// BlockedError is returned if a login is not allowed.
+type BlockedError struct {
+	Key
+	// Locked is false if the login is only delayed.
+	Locked     bool
+	RetryAfter time.Duration
+}
+
+// Error implements error interface.
+func (e BlockedError) Error() string {
+	if e.Locked {
+		return fmt.Sprintf("too many failed logins, %s %s is locked for %v", e.Kind, e.Target, e.RetryAfter)
+	}
+	return fmt.Sprintf("too many failed logins, retry after %v", e.RetryAfter)
+}
+
+// Tracker tracks the failed logins. The progressive delay applies to the
+// accounts only since many devices may share an IP.
+//
+// A nil *Tracker allows every login.
+type Tracker struct {
+	config Config
+	store  database.LoginFailureStore
+	now    func() time.Time
+
+	mu        sync.Mutex
+	lastPrune time.Time
+}
+
+// NewTracker returns a Tracker keeping the failed logins in the store, which
+// are shared by the servers using the same store.
+func NewTracker(config Config, store database.LoginFailureStore) *Tracker {
+	return &Tracker{
+		config: config.withDefaults(),
+		store:  store,
+		now:    time.Now,
+	}
+}
+
+func targets(keys ...Key) []database.LoginTarget {
+	targets := make([]database.LoginTarget, len(keys))
+	for i, key := range keys {
+		targets[i] = database.LoginTarget{Kind: string(key.Kind), Target: key.Target}
+	}
+	return targets
+}
+
+func toLockout(f database.LoginFailure) Lockout {
+	return Lockout{
+		Key:         Key{Kind: Kind(f.Kind), Target: f.Target},
+		Failures:    f.Failures,
+		LockedUntil: f.LockedUntil,
+	}
+}
+
+func isLocked(f database.LoginFailure, now time.Time) bool {
+	return now.Before(f.LockedUntil)
+}
+
+// Check returns a BlockedError if the login of the account from the IP is not
+// allowed for now, or the error of the store.
+func (t *Tracker) Check(ctx context.Context, account, ip string) error {
+	if t == nil {
+		return nil
+	}
+
+	failures, err := t.store.ListLoginFailures(ctx, targets(Key{Kind: KindIP, Target: ip}, Key{Kind: KindAccount, Target: account}))
+	if err != nil {
+		return err
+	}
+	// the IP lockout is reported first.
+	sort.Slice(failures, func(i, j int) bool {
+		return failures[i].Kind == string(KindIP) && failures[j].Kind != string(KindIP)
+	})
+
+	now := t.now()
+	for _, f := range failures {
+		key := Key{Kind: Kind(f.Kind), Target: f.Target}
+		if isLocked(f, now) {
+			return BlockedError{Key: key, Locked: true, RetryAfter: f.LockedUntil.Sub(now)}
+		}
+		if key.Kind == KindAccount && f.Failures > 0 && now.Sub(f.LastFailure) <= t.config.FailureWindow {
+			if next := f.LastFailure.Add(t.delay(f.Failures)); now.Before(next) {
+				return BlockedError{Key: key, RetryAfter: next.Sub(now)}
+			}
+		}
+	}
+	return nil
+}
+
+// delay returns the time to wait after the specified number of failures.
+func (t *Tracker) delay(failures int) time.Duration {
+	d := t.config.Delay
+	for i := 1; i < failures && d < t.config.MaxDelay; i++ {
+		d *= 2
+	}
+	if d > t.config.MaxDelay {
+		d = t.config.MaxDelay
+	}
+	return d
+}
+
+// Fail records a failed login of the account from the IP and returns the
+// targets locked by this failure.
+func (t *Tracker) Fail(ctx context.Context, account, ip string) ([]Lockout, error) {
+	if t == nil {
+		return nil, nil
+	}
+
+	now := t.now()
+	if err := t.prune(ctx, now); err != nil {
+		return nil, err
+	}
+
+	var lockouts []Lockout
+	err := t.store.UpdateLoginFailures(ctx, targets(Key{Kind: KindAccount, Target: account}, Key{Kind: KindIP, Target: ip}), func(failures []database.LoginFailure) []database.LoginFailure {
+		lockouts = nil
+		for i, f := range failures {
+			if isLocked(f, now) {
+				continue
+			}
+			if !f.LockedUntil.IsZero() || now.Sub(f.LastFailure) > t.config.FailureWindow {
+				f = database.LoginFailure{LoginTarget: f.LoginTarget}
+			}
+
+			f.Failures++
+			f.LastFailure = now
+
+			max := t.config.MaxAccountFailures
+			if Kind(f.Kind) == KindIP {
+				max = t.config.MaxIPFailures
+			}
+			if f.Failures >= max {
+				f.LockedUntil = now.Add(t.config.LockoutDuration)
+				lockouts = append(lockouts, toLockout(f))
+			}
+			failures[i] = f
+		}
+		return failures
+	})
+	if err != nil {
+		return nil, err
+	}
+	return lockouts, nil
+}
+
+// Succeed forgets the failed logins of the account.
+func (t *Tracker) Succeed(ctx context.Context, account string) error {
+	if t == nil {
+		return nil
+	}
+
+	_, err := t.store.DeleteLoginFailure(ctx, targets(Key{Kind: KindAccount, Target: account})[0])
+	if errors.Is(err, database.ErrRecordNotFound) {
+		return nil
+	}
+	return err
+}
+
+// Unlock forgets the failed logins of the target and returns the lockout if
+// the target was locked.
+func (t *Tracker) Unlock(ctx context.Context, key Key) (Lockout, bool, error) {
+	if t == nil {
+		return Lockout{}, false, nil
+	}
+
+	f, err := t.store.DeleteLoginFailure(ctx, targets(key)[0])
+	if err != nil {
+		if errors.Is(err, database.ErrRecordNotFound) {
+			return Lockout{}, false, nil
+		}
+		return Lockout{}, false, err
+	}
+	if !isLocked(f, t.now()) {
+		return Lockout{}, false, nil
+	}
+	return toLockout(f), true, nil
+}
+
+// Lockouts lists the locked targets in order of their unlock time.
+func (t *Tracker) Lockouts(ctx context.Context) ([]Lockout, error) {
+	if t == nil {
+		return nil, nil
+	}
+
+	failures, err := t.store.ListLockedLoginFailures(ctx, t.now())
+	if err != nil {
+		return nil, err
+	}
+	lockouts := make([]Lockout, len(failures))
+	for i, f := range failures {
+		lockouts[i] = toLockout(f)
+	}
+	return lockouts, nil
+}
+
+// prune removes the failed logins which neither are locked nor are recent,
+// at most once per failure window.
+func (t *Tracker) prune(ctx context.Context, now time.Time) error {
+	t.mu.Lock()
+	if now.Sub(t.lastPrune) < t.config.FailureWindow {
+		t.mu.Unlock()
+		return nil
+	}
+	t.lastPrune = now
+	t.mu.Unlock()
+
+	return t.store.DeleteStaleLoginFailures(ctx, now, now.Add(-t.config.FailureWindow))
+}
@@ -0,0 +1,244 @@
+package lockout
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"gitlab.kenda.com.tw/kenda/mui/server/database"
+	"gitlab.kenda.com.tw/kenda/mui/server/database/dbtest"
+)
+
+const (
+	testAccount = "tester"
+	testIP      = "10.1.1.1"
+)
+
+type clock struct {
+	t time.Time
+}
+
+func (c *clock) now() time.Time {
+	return c.t
+}
+
+func (c *clock) add(d time.Duration) {
+	c.t = c.t.Add(d)
+}
+
+func newTestStore(t *testing.T) database.LoginFailureStore {
+	store, err := database.NewLoginFailureStore(dbtest.Open(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func newTestTracker(t *testing.T, config Config) (*Tracker, *clock) {
+	c := &clock{t: time.Date(2022, 5, 1, 8, 0, 0, 0, time.UTC)}
+	tracker := NewTracker(config, newTestStore(t))
+	tracker.now = c.now
+	return tracker, c
+}
+
+func (t *Tracker) mustFail(account, ip string) []Lockout {
+	lockouts, err := t.Fail(context.Background(), account, ip)
+	if err != nil {
+		panic(err)
+	}
+	return lockouts
+}
+
+func (t *Tracker) mustLockouts() []Lockout {
+	lockouts, err := t.Lockouts(context.Background())
+	if err != nil {
+		panic(err)
+	}
+	return lockouts
+}
+
+func TestConfig_withDefaults(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal(Config{
+		MaxAccountFailures: DefaultMaxAccountFailures,
+		MaxIPFailures:      DefaultMaxIPFailures,
+		LockoutDuration:    DefaultLockoutDuration,
+		FailureWindow:      DefaultFailureWindow,
+		Delay:              DefaultDelay,
+		MaxDelay:           DefaultMaxDelay,
+	}, Config{}.withDefaults())
+
+	config := Config{
+		MaxAccountFailures: 3,
+		MaxIPFailures:      10,
+		LockoutDuration:    time.Hour,
+		FailureWindow:      time.Minute,
+		Delay:              2 * time.Second,
+		MaxDelay:           5 * time.Second,
+	}
+	assert.Equal(config, config.withDefaults())
+}
+
+func TestTracker_Account(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	tracker, clock := newTestTracker(t, Config{
+		MaxAccountFailures: 4,
+		LockoutDuration:    10 * time.Minute,
+		Delay:              time.Second,
+		MaxDelay:           3 * time.Second,
+	})
+	account := Key{Kind: KindAccount, Target: testAccount}
+
+	assert.NoError(tracker.Check(ctx, testAccount, testIP))
+
+	// progressive delays: 1s, 2s, 3s (capped).
+	for i, delay := range []time.Duration{time.Second, 2 * time.Second, 3 * time.Second} {
+		assert.Empty(tracker.mustFail(testAccount, testIP), i)
+		assert.Equal(BlockedError{Key: account, RetryAfter: delay}, tracker.Check(ctx, testAccount, testIP), i)
+		clock.add(delay - time.Millisecond)
+		assert.Equal(BlockedError{Key: account, RetryAfter: time.Millisecond}, tracker.Check(ctx, testAccount, testIP), i)
+		clock.add(time.Millisecond)
+		assert.NoError(tracker.Check(ctx, testAccount, testIP), i)
+	}
+	// the other accounts are not affected.
+	assert.NoError(tracker.Check(ctx, "others", testIP))
+
+	// locked.
+	lockedUntil := clock.t.Add(10 * time.Minute)
+	assert.Equal([]Lockout{{Key: account, Failures: 4, LockedUntil: lockedUntil}}, tracker.mustFail(testAccount, testIP))
+	assert.Equal(BlockedError{Key: account, Locked: true, RetryAfter: 10 * time.Minute}, tracker.Check(ctx, testAccount, testIP))
+	assert.Equal([]Lockout{{Key: account, Failures: 4, LockedUntil: lockedUntil}}, tracker.mustLockouts())
+	assert.EqualError(tracker.Check(ctx, testAccount, testIP), "too many failed logins, ACCOUNT tester is locked for 10m0s")
+
+	// failures during the lockout are not counted.
+	assert.Empty(tracker.mustFail(testAccount, testIP))
+
+	// the failures are forgotten after the lockout.
+	clock.add(10 * time.Minute)
+	assert.NoError(tracker.Check(ctx, testAccount, testIP))
+	assert.Empty(tracker.mustLockouts())
+	assert.Empty(tracker.mustFail(testAccount, testIP))
+	assert.Equal(BlockedError{Key: account, RetryAfter: time.Second}, tracker.Check(ctx, testAccount, testIP))
+	assert.EqualError(tracker.Check(ctx, testAccount, testIP), "too many failed logins, retry after 1s")
+
+	// succeed.
+	assert.NoError(tracker.Succeed(ctx, testAccount))
+	assert.NoError(tracker.Check(ctx, testAccount, testIP))
+}
+
+func TestTracker_FailureWindow(t *testing.T) {
+	assert := assert.New(t)
+
+	tracker, clock := newTestTracker(t, Config{
+		MaxAccountFailures: 2,
+		FailureWindow:      time.Minute,
+	})
+
+	assert.Empty(tracker.mustFail(testAccount, testIP))
+	clock.add(time.Minute + time.Second)
+	assert.Empty(tracker.mustFail(testAccount, testIP))
+	clock.add(time.Minute + time.Second)
+
+	// pruned.
+	assert.Empty(tracker.mustFail("others", "10.1.1.2"))
+	failures, err := tracker.store.ListLoginFailures(context.Background(), targets(
+		Key{Kind: KindAccount, Target: testAccount},
+		Key{Kind: KindIP, Target: testIP},
+	))
+	assert.NoError(err)
+	assert.Empty(failures)
+}
+
+func TestTracker_SharedStore(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	store := newTestStore(t)
+	c := &clock{t: time.Date(2022, 5, 1, 8, 0, 0, 0, time.UTC)}
+	a := NewTracker(Config{MaxAccountFailures: 2}, store)
+	a.now = c.now
+	// e.g. another replica or the restarted server.
+	b := NewTracker(Config{MaxAccountFailures: 2}, store)
+	b.now = c.now
+
+	assert.Empty(a.mustFail(testAccount, testIP))
+	c.add(time.Minute)
+	assert.Len(b.mustFail(testAccount, testIP), 1)
+	assert.Equal(BlockedError{
+		Key:        Key{Kind: KindAccount, Target: testAccount},
+		Locked:     true,
+		RetryAfter: DefaultLockoutDuration,
+	}, a.Check(ctx, testAccount, testIP))
+	assert.Len(a.mustLockouts(), 1)
+}
+
+func TestTracker_IP(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	tracker, clock := newTestTracker(t, Config{
+		MaxIPFailures:   3,
+		LockoutDuration: time.Minute,
+	})
+	ip := Key{Kind: KindIP, Target: testIP}
+
+	assert.Empty(tracker.mustFail("a", testIP))
+	assert.Empty(tracker.mustFail("b", testIP))
+	// IP failures are not forgotten by a successful login.
+	assert.NoError(tracker.Succeed(ctx, "c"))
+
+	lockedUntil := clock.t.Add(time.Minute)
+	assert.Equal([]Lockout{{Key: ip, Failures: 3, LockedUntil: lockedUntil}}, tracker.mustFail("c", testIP))
+	assert.Equal(BlockedError{Key: ip, Locked: true, RetryAfter: time.Minute}, tracker.Check(ctx, "d", testIP))
+	assert.NoError(tracker.Check(ctx, "d", "10.1.1.2"))
+
+	// unlock.
+	lockout, ok, err := tracker.Unlock(ctx, ip)
+	assert.NoError(err)
+	assert.True(ok)
+	assert.Equal(Lockout{Key: ip, Failures: 3, LockedUntil: lockedUntil}, lockout)
+	assert.NoError(tracker.Check(ctx, "d", testIP))
+
+	_, ok, err = tracker.Unlock(ctx, ip)
+	assert.NoError(err)
+	assert.False(ok)
+}
+
+func TestTracker_Unlock(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	tracker, _ := newTestTracker(t, Config{MaxAccountFailures: 1})
+	account := Key{Kind: KindAccount, Target: testAccount}
+
+	assert.Len(tracker.mustFail(testAccount, testIP), 1)
+	_, ok, err := tracker.Unlock(ctx, account)
+	assert.NoError(err)
+	assert.True(ok)
+	assert.NoError(tracker.Check(ctx, testAccount, testIP))
+
+	// not locked.
+	_, ok, err = tracker.Unlock(ctx, Key{Kind: KindAccount, Target: "others"})
+	assert.NoError(err)
+	assert.False(ok)
+}
+
+func TestTracker_Nil(t *testing.T) {
+	assert := assert.New(t)
+
+	ctx := context.Background()
+
+	var tracker *Tracker
+	assert.NoError(tracker.Check(ctx, testAccount, testIP))
+	assert.Nil(tracker.mustFail(testAccount, testIP))
+	assert.NoError(tracker.Succeed(ctx, testAccount))
+	_, ok, err := tracker.Unlock(ctx, Key{Kind: KindAccount, Target: testAccount})
+	assert.NoError(err)
+	assert.False(ok)
+	assert.Nil(tracker.mustLockouts())
+}
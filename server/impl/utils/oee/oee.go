@@ -0,0 +1,252 @@
+// Package oee calculates the overall equipment effectiveness of the stations
+// by the periods of the shifts.
+//
+// The availability is the running time, i.e. the signed-in time without the
+// downtimes, divided by the signed-in time. The performance is the standard
+// time of the produced cycles divided by the running time. The quality is the
+// good quantity divided by all the produced quantity.
+package oee
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// Shift of a day, which lasts until the start of the next shift.
+type Shift struct {
+	Name string
+	// Start is the time of the day when the shift starts.
+	Start time.Duration
+}
+
+// DefaultShifts are used if no shift is defined, the whole day is a shift.
+var DefaultShifts = []Shift{{Name: "A"}}
+
+// ParseClock parses the time of a day in the format of "15:04".
+func ParseClock(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day: %q", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// Period is a shift of a day.
+type Period struct {
+	// Day is the date when the shift starts, at midnight.
+	Day   time.Time
+	Shift string
+	Start time.Time
+	End   time.Time
+}
+
+// Periods returns the periods of the shifts between since and until, the first
+// and the last periods are cut by since and until. The days are in the
+// location of since.
+func Periods(shifts []Shift, since, until time.Time) []Period {
+	if len(shifts) == 0 {
+		shifts = DefaultShifts
+	}
+	shifts = append([]Shift(nil), shifts...)
+	sort.SliceStable(shifts, func(i, j int) bool {
+		return shifts[i].Start < shifts[j].Start
+	})
+
+	var periods []Period
+	y, m, d := since.Date()
+	// the last shift of the previous day may last into the first day.
+	for day := time.Date(y, m, d-1, 0, 0, 0, 0, since.Location()); day.Before(until); day = day.AddDate(0, 0, 1) {
+		for i, shift := range shifts {
+			start := day.Add(shift.Start)
+			end := day.AddDate(0, 0, 1).Add(shifts[0].Start)
+			if i+1 < len(shifts) {
+				end = day.Add(shifts[i+1].Start)
+			}
+			if start.Before(since) {
+				start = since
+			}
+			if end.After(until) {
+				end = until
+			}
+			if !start.Before(end) {
+				continue
+			}
+			periods = append(periods, Period{
+				Day:   day,
+				Shift: shift.Name,
+				Start: start,
+				End:   end,
+			})
+		}
+	}
+	return periods
+}
+
+// Interval is a time range, End is exclusive.
+type Interval struct {
+	Start time.Time
+	End   time.Time
+}
+
+// Cycle is a production cycle, e.g. a batch.
+type Cycle struct {
+	Time time.Time
+	// Standard is the standard cycle time, which is 0 if unknown.
+	Standard time.Duration
+}
+
+// Output is a produced quantity.
+type Output struct {
+	Time time.Time
+	Good decimal.Decimal
+	// Rejected is the defective and the scrap quantity.
+	Rejected decimal.Decimal
+}
+
+// Records of a station in the calculated time range.
+type Records struct {
+	// SignIns are the times when the station is signed in.
+	SignIns   []Interval
+	Downtimes []Interval
+	Cycles    []Cycle
+	Outputs   []Output
+}
+
+// Metrics of a station in a period.
+type Metrics struct {
+	// Planned is the signed-in time.
+	Planned time.Duration
+	// Downtime is the downtime during the signed-in time.
+	Downtime time.Duration
+	// Standard is the standard time of the produced cycles.
+	Standard time.Duration
+	Good     decimal.Decimal
+	Rejected decimal.Decimal
+}
+
+// Run returns the running time.
+func (m Metrics) Run() time.Duration {
+	return m.Planned - m.Downtime
+}
+
+// Availability returns the running time divided by the signed-in time.
+func (m Metrics) Availability() float64 {
+	if m.Planned <= 0 {
+		return 0
+	}
+	return float64(m.Run()) / float64(m.Planned)
+}
+
+// Performance returns the standard time divided by the running time.
+func (m Metrics) Performance() float64 {
+	if m.Run() <= 0 {
+		return 0
+	}
+	return float64(m.Standard) / float64(m.Run())
+}
+
+// Quality returns the good quantity divided by all the produced quantity.
+func (m Metrics) Quality() float64 {
+	total := m.Good.Add(m.Rejected)
+	if !total.IsPositive() {
+		return 0
+	}
+	return m.Good.Div(total).InexactFloat64()
+}
+
+// OEE returns the product of the availability, the performance and the
+// quality.
+func (m Metrics) OEE() float64 {
+	return m.Availability() * m.Performance() * m.Quality()
+}
+
+// Add returns the sum of the metrics.
+func (m Metrics) Add(o Metrics) Metrics {
+	return Metrics{
+		Planned:  m.Planned + o.Planned,
+		Downtime: m.Downtime + o.Downtime,
+		Standard: m.Standard + o.Standard,
+		Good:     m.Good.Add(o.Good),
+		Rejected: m.Rejected.Add(o.Rejected),
+	}
+}
+
+// Calculate returns the metrics of the records in each period.
+func Calculate(periods []Period, records Records) []Metrics {
+	signIns := union(records.SignIns)
+	downtimes := union(records.Downtimes)
+
+	metrics := make([]Metrics, len(periods))
+	for i, p := range periods {
+		period := Interval{Start: p.Start, End: p.End}
+		m := Metrics{Good: decimal.Zero, Rejected: decimal.Zero}
+		for _, signIn := range signIns {
+			in, ok := intersect(signIn, period)
+			if !ok {
+				continue
+			}
+			m.Planned += in.End.Sub(in.Start)
+			for _, downtime := range downtimes {
+				if down, ok := intersect(downtime, in); ok {
+					m.Downtime += down.End.Sub(down.Start)
+				}
+			}
+		}
+		for _, cycle := range records.Cycles {
+			if contains(period, cycle.Time) {
+				m.Standard += cycle.Standard
+			}
+		}
+		for _, output := range records.Outputs {
+			if contains(period, output.Time) {
+				m.Good = m.Good.Add(output.Good)
+				m.Rejected = m.Rejected.Add(output.Rejected)
+			}
+		}
+		metrics[i] = m
+	}
+	return metrics
+}
+
+func contains(i Interval, t time.Time) bool {
+	return !t.Before(i.Start) && t.Before(i.End)
+}
+
+func intersect(a, b Interval) (Interval, bool) {
+	i := a
+	if b.Start.After(i.Start) {
+		i.Start = b.Start
+	}
+	if b.End.Before(i.End) {
+		i.End = b.End
+	}
+	return i, i.Start.Before(i.End)
+}
+
+// union merges the overlapping intervals, the result is in time order.
+func union(intervals []Interval) []Interval {
+	sorted := make([]Interval, 0, len(intervals))
+	for _, i := range intervals {
+		if i.Start.Before(i.End) {
+			sorted = append(sorted, i)
+		}
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Start.Before(sorted[j].Start)
+	})
+
+	var merged []Interval
+	for _, i := range sorted {
+		if n := len(merged); n > 0 && !i.Start.After(merged[n-1].End) {
+			if i.End.After(merged[n-1].End) {
+				merged[n-1].End = i.End
+			}
+			continue
+		}
+		merged = append(merged, i)
+	}
+	return merged
+}
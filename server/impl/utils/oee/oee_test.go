@@ -0,0 +1,145 @@
+package oee
+
+import (
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+)
+
+func at(day, hour, minute int) time.Time {
+	return time.Date(2024, 3, day, hour, minute, 0, 0, time.UTC)
+}
+
+func TestParseClock(t *testing.T) {
+	assert := assert.New(t)
+	d, err := ParseClock("07:30")
+	assert.NoError(err)
+	assert.Equal(7*time.Hour+30*time.Minute, d)
+	_, err = ParseClock("7.30")
+	assert.EqualError(err, `invalid time of day: "7.30"`)
+	_, err = ParseClock("24:00")
+	assert.Error(err)
+}
+
+func TestPeriods(t *testing.T) {
+	shifts := []Shift{
+		{Name: "C", Start: 23 * time.Hour},
+		{Name: "A", Start: 7 * time.Hour},
+		{Name: "B", Start: 15 * time.Hour},
+	}
+	day := func(d int) time.Time { return at(d, 0, 0) }
+	tests := []struct {
+		name   string
+		shifts []Shift
+		since  time.Time
+		until  time.Time
+		want   []Period
+	}{
+		{
+			name:   "a day",
+			shifts: shifts,
+			since:  at(7, 0, 0),
+			until:  at(8, 0, 0),
+			want: []Period{
+				{Day: day(6), Shift: "C", Start: at(7, 0, 0), End: at(7, 7, 0)},
+				{Day: day(7), Shift: "A", Start: at(7, 7, 0), End: at(7, 15, 0)},
+				{Day: day(7), Shift: "B", Start: at(7, 15, 0), End: at(7, 23, 0)},
+				{Day: day(7), Shift: "C", Start: at(7, 23, 0), End: at(8, 0, 0)},
+			},
+		},
+		{
+			name:   "cut by since and until",
+			shifts: shifts,
+			since:  at(7, 10, 0),
+			until:  at(7, 16, 0),
+			want: []Period{
+				{Day: day(7), Shift: "A", Start: at(7, 10, 0), End: at(7, 15, 0)},
+				{Day: day(7), Shift: "B", Start: at(7, 15, 0), End: at(7, 16, 0)},
+			},
+		},
+		{
+			name:  "default shifts",
+			since: at(7, 0, 0),
+			until: at(9, 0, 0),
+			want: []Period{
+				{Day: day(7), Shift: "A", Start: at(7, 0, 0), End: at(8, 0, 0)},
+				{Day: day(8), Shift: "A", Start: at(8, 0, 0), End: at(9, 0, 0)},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, Periods(tt.shifts, tt.since, tt.until))
+		})
+	}
+}
+
+func TestCalculate(t *testing.T) {
+	assert := assert.New(t)
+	periods := []Period{
+		{Shift: "A", Start: at(7, 8, 0), End: at(7, 16, 0)},
+		{Shift: "B", Start: at(7, 16, 0), End: at(8, 0, 0)},
+	}
+	records := Records{
+		SignIns: []Interval{
+			{Start: at(7, 8, 0), End: at(7, 12, 0)},
+			// overlapped by the sign-in of another site.
+			{Start: at(7, 10, 0), End: at(7, 18, 0)},
+		},
+		Downtimes: []Interval{
+			{Start: at(7, 9, 0), End: at(7, 10, 0)},
+			{Start: at(7, 9, 30), End: at(7, 11, 0)},
+			// not signed in.
+			{Start: at(7, 20, 0), End: at(7, 21, 0)},
+		},
+		Cycles: []Cycle{
+			{Time: at(7, 12, 0), Standard: 3 * time.Hour},
+			{Time: at(7, 15, 0), Standard: 2 * time.Hour},
+			{Time: at(7, 17, 0), Standard: time.Hour},
+			// the standard is unknown.
+			{Time: at(7, 17, 30)},
+		},
+		Outputs: []Output{
+			{Time: at(7, 12, 0), Good: decimal.NewFromInt(90), Rejected: decimal.NewFromInt(10)},
+			{Time: at(7, 17, 0), Good: decimal.NewFromInt(50), Rejected: decimal.Zero},
+		},
+	}
+
+	got := Calculate(periods, records)
+	if assert.Len(got, 2) {
+		a := got[0]
+		assert.Equal(8*time.Hour, a.Planned)
+		assert.Equal(2*time.Hour, a.Downtime)
+		assert.Equal(6*time.Hour, a.Run())
+		assert.Equal(5*time.Hour, a.Standard)
+		assert.InDelta(0.75, a.Availability(), 1e-9)
+		assert.InDelta(5.0/6, a.Performance(), 1e-9)
+		assert.InDelta(0.9, a.Quality(), 1e-9)
+		assert.InDelta(0.75*5/6*0.9, a.OEE(), 1e-9)
+
+		b := got[1]
+		assert.Equal(2*time.Hour, b.Planned)
+		assert.Equal(time.Duration(0), b.Downtime)
+		assert.Equal(time.Hour, b.Standard)
+		assert.InDelta(1, b.Availability(), 1e-9)
+		assert.InDelta(0.5, b.Performance(), 1e-9)
+		assert.InDelta(1, b.Quality(), 1e-9)
+
+		total := a.Add(b)
+		assert.Equal(10*time.Hour, total.Planned)
+		assert.Equal(6*time.Hour, total.Standard)
+		assert.True(decimal.NewFromInt(140).Equal(total.Good))
+		assert.InDelta(0.8, total.Availability(), 1e-9)
+	}
+}
+
+func TestMetrics_zero(t *testing.T) {
+	assert := assert.New(t)
+	var m Metrics
+	assert.Zero(m.Availability())
+	assert.Zero(m.Performance())
+	assert.Zero(m.Quality())
+	assert.Zero(m.OEE())
+}
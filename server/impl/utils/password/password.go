@@ -0,0 +1,89 @@
+// Package password defines the password policy of the MES accounts.
+package password
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/crypto/bcrypt"
+
+	mcomErrors "gitlab.kenda.com.tw/kenda/mcom/errors"
+)
+
+// Policy of the passwords, the zero value accepts every password which never expires.
+type Policy struct {
+	MinLength        int
+	RequireUppercase bool
+	RequireLowercase bool
+	RequireDigit     bool
+	// RequireSymbol requires a character which is neither a letter nor a digit.
+	RequireSymbol bool
+	// History is the number of the latest passwords which cannot be reused.
+	History int
+	// MaxAge is the time after which a password expires, never if it is 0.
+	MaxAge time.Duration
+}
+
+// Validate returns a BAD_REQUEST error describing the violated rules if the
+// password does not comply with the policy.
+func (p Policy) Validate(password string) error {
+	var upper, lower, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		case !unicode.IsLetter(r):
+			symbol = true
+		}
+	}
+
+	var violations []string
+	if utf8.RuneCountInString(password) < p.MinLength {
+		violations = append(violations, fmt.Sprintf("at least %d characters", p.MinLength))
+	}
+	if p.RequireUppercase && !upper {
+		violations = append(violations, "an uppercase letter")
+	}
+	if p.RequireLowercase && !lower {
+		violations = append(violations, "a lowercase letter")
+	}
+	if p.RequireDigit && !digit {
+		violations = append(violations, "a digit")
+	}
+	if p.RequireSymbol && !symbol {
+		violations = append(violations, "a symbol")
+	}
+	if len(violations) > 0 {
+		return mcomErrors.Error{
+			Code:    mcomErrors.Code_BAD_REQUEST,
+			Details: "the password must contain " + strings.Join(violations, ", "),
+		}
+	}
+	return nil
+}
+
+// IsExpired reports whether the password set at the specified time has expired.
+func (p Policy) IsExpired(setAt, now time.Time) bool {
+	return p.MaxAge > 0 && now.Sub(setAt) > p.MaxAge
+}
+
+// Hash returns the bcrypt hash of the password.
+func Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// Matches reports whether the hash is the hash of the password.
+func Matches(hash, password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
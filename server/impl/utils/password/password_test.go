@@ -0,0 +1,60 @@
+package password
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	mcomErrors "gitlab.kenda.com.tw/kenda/mcom/errors"
+)
+
+func TestPolicy_Validate(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.NoError(Policy{}.Validate(""))
+
+	policy := Policy{
+		MinLength:        8,
+		RequireUppercase: true,
+		RequireLowercase: true,
+		RequireDigit:     true,
+		RequireSymbol:    true,
+	}
+	assert.NoError(policy.Validate("P4s5w0r!"))
+	assert.Equal(mcomErrors.Error{
+		Code:    mcomErrors.Code_BAD_REQUEST,
+		Details: "the password must contain at least 8 characters, an uppercase letter, a digit, a symbol",
+	}, policy.Validate("pass"))
+	assert.Equal(mcomErrors.Error{
+		Code:    mcomErrors.Code_BAD_REQUEST,
+		Details: "the password must contain a lowercase letter",
+	}, policy.Validate("P4S5W0R!"))
+	// multi-byte characters are counted as one character.
+	assert.Equal(mcomErrors.Error{
+		Code:    mcomErrors.Code_BAD_REQUEST,
+		Details: "the password must contain at least 8 characters",
+	}, policy.Validate("P4s5w密!"))
+}
+
+func TestPolicy_IsExpired(t *testing.T) {
+	assert := assert.New(t)
+
+	now := time.Now()
+	assert.False(Policy{}.IsExpired(now.Add(-10000*time.Hour), now))
+
+	policy := Policy{MaxAge: 90 * 24 * time.Hour}
+	assert.False(policy.IsExpired(now.Add(-90*24*time.Hour), now))
+	assert.True(policy.IsExpired(now.Add(-90*24*time.Hour-time.Second), now))
+}
+
+func TestHash(t *testing.T) {
+	assert := assert.New(t)
+
+	hash, err := Hash("p4s5w0rd")
+	assert.NoError(err)
+	assert.NotEqual("p4s5w0rd", hash)
+	assert.True(Matches(hash, "p4s5w0rd"))
+	assert.False(Matches(hash, "p4s5w0rD"))
+	assert.False(Matches("", "p4s5w0rd"))
+}
@@ -0,0 +1,215 @@
+// Package plant routes the requests to the APIs of the plants in the
+// multi-plant mode.
+package plant
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Header is the request header to specify the plant explicitly.
+const Header = "X-Plant"
+
+// TokenHeader is the request header of the login token.
+const TokenHeader = "x-mui-auth-key"
+
+// LoginPath is the path of the sign-in, under the base path of the API.
+const LoginPath = "/user/login"
+
+// unknownTokenTTL is how long a token unknown to every plant is cached, so
+// that the requests with an invalid token do not query the databases of all
+// the plants every time.
+const unknownTokenTTL = 10 * time.Second
+
+// departmentSegments are the path segments followed by a department ID.
+var departmentSegments = map[string]struct{}{
+	"department":     {},
+	"department-oid": {},
+}
+
+// TokenLookup returns the expiry time of the token if it was signed in at
+// the plant and is still active.
+type TokenLookup func(ctx context.Context, token string) (expiresAt time.Time, ok bool, err error)
+
+// Plant is a plant served by its own API.
+type Plant struct {
+	Name string
+	// Departments are the departments of the plant, which route the requests
+	// with a department in the path.
+	Departments []string
+	Handler     http.Handler
+	// LookupToken finds the tokens signed in at the plant.
+	LookupToken TokenLookup
+}
+
+// Router routes the requests with a token to the plant where the token was
+// signed in, since the tokens are unknown to the other plants. Such requests
+// are rejected if Header or the department in the path refers to another
+// plant, so that a token of a plant never reaches the data of another one.
+//
+// The other requests are routed by the following order:
+//  1. the plant specified by Header.
+//  2. the plant of the department in the path.
+//  3. the first plant.
+//
+// A sign-in has to specify the plant by Header if there are several plants,
+// since the token is bound to the plant where it was signed in.
+type Router struct {
+	plants       []Plant
+	byName       map[string]*Plant
+	byDepartment map[string]*Plant
+
+	now func() time.Time
+
+	mu     sync.Mutex
+	tokens map[string]token
+}
+
+// token is a cached token lookup, the plant is nil if the token is unknown to
+// every plant.
+type token struct {
+	plant     *Plant
+	expiresAt time.Time
+}
+
+// NewRouter returns a Router of the plants, the first of which is the default.
+func NewRouter(plants []Plant) (*Router, error) {
+	if len(plants) == 0 {
+		return nil, fmt.Errorf("no plant")
+	}
+
+	r := &Router{
+		plants:       plants,
+		byName:       make(map[string]*Plant, len(plants)),
+		byDepartment: make(map[string]*Plant),
+		now:          time.Now,
+		tokens:       make(map[string]token),
+	}
+	for i := range r.plants {
+		p := &r.plants[i]
+		if p.Name == "" {
+			return nil, fmt.Errorf("missing name of plant %d", i)
+		}
+		if _, ok := r.byName[p.Name]; ok {
+			return nil, fmt.Errorf("duplicated plant %s", p.Name)
+		}
+		r.byName[p.Name] = p
+		for _, department := range p.Departments {
+			if other, ok := r.byDepartment[department]; ok {
+				return nil, fmt.Errorf("department %s is in both plant %s and %s", department, other.Name, p.Name)
+			}
+			r.byDepartment[department] = p
+		}
+	}
+	return r, nil
+}
+
+// ServeHTTP implements http.Handler interface.
+func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	var named *Plant
+	if name := req.Header.Get(Header); name != "" {
+		p, ok := r.byName[name]
+		if !ok {
+			http.Error(w, fmt.Sprintf("unknown plant %s", name), http.StatusBadRequest)
+			return
+		}
+		named = p
+	}
+	department, _ := r.departmentPlant(req.URL.Path)
+
+	if t := req.Header.Get(TokenHeader); t != "" {
+		if p, ok := r.tokenPlant(req.Context(), t); ok {
+			if named != nil && named != p {
+				http.Error(w, fmt.Sprintf("the token was not signed in at plant %s", named.Name), http.StatusForbidden)
+				return
+			}
+			if department != nil && department != p {
+				http.Error(w, fmt.Sprintf("the department is not in plant %s", p.Name), http.StatusForbidden)
+				return
+			}
+			p.Handler.ServeHTTP(w, req)
+			return
+		}
+	}
+
+	if named == nil && len(r.plants) > 1 && strings.HasSuffix(req.URL.Path, LoginPath) {
+		http.Error(w, fmt.Sprintf("missing header %s to sign in", Header), http.StatusBadRequest)
+		return
+	}
+
+	switch {
+	case named != nil:
+		named.Handler.ServeHTTP(w, req)
+	case department != nil:
+		department.Handler.ServeHTTP(w, req)
+	default:
+		r.plants[0].Handler.ServeHTTP(w, req)
+	}
+}
+
+func (r *Router) departmentPlant(path string) (*Plant, bool) {
+	segments := strings.Split(path, "/")
+	for i := 0; i < len(segments)-1; i++ {
+		if _, ok := departmentSegments[segments[i]]; ok {
+			if p, ok := r.byDepartment[segments[i+1]]; ok {
+				return p, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// tokenPlant finds the plant where the token was signed in. The plants are
+// cached until the tokens expire, and the unknown tokens are cached for
+// unknownTokenTTL unless the lookup of some plant failed.
+func (r *Router) tokenPlant(ctx context.Context, t string) (*Plant, bool) {
+	now := r.now()
+
+	r.mu.Lock()
+	cached, ok := r.tokens[t]
+	r.mu.Unlock()
+	if ok && now.Before(cached.expiresAt) {
+		return cached.plant, cached.plant != nil
+	}
+
+	failed := false
+	for i := range r.plants {
+		p := &r.plants[i]
+		if p.LookupToken == nil {
+			continue
+		}
+		expiresAt, ok, err := p.LookupToken(ctx, t)
+		if err != nil {
+			zap.L().Error("failed to look up token", zap.String("plant", p.Name), zap.Error(err))
+			failed = true
+			continue
+		}
+		if ok {
+			r.cache(t, token{plant: p, expiresAt: expiresAt})
+			return p, true
+		}
+	}
+	if !failed {
+		r.cache(t, token{expiresAt: now.Add(unknownTokenTTL)})
+	}
+	return nil, false
+}
+
+func (r *Router) cache(t string, entry token) {
+	now := r.now()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for key, cached := range r.tokens {
+		if !now.Before(cached.expiresAt) {
+			delete(r.tokens, key)
+		}
+	}
+	r.tokens[t] = entry
+}
@@ -0,0 +1,151 @@
+package plant
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func plantHandler(name string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(name))
+	})
+}
+
+func TestNewRouter(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := NewRouter(nil)
+	assert.EqualError(err, "no plant")
+
+	_, err = NewRouter([]Plant{{Name: "P1"}, {Name: ""}})
+	assert.EqualError(err, "missing name of plant 1")
+
+	_, err = NewRouter([]Plant{{Name: "P1"}, {Name: "P1"}})
+	assert.EqualError(err, "duplicated plant P1")
+
+	_, err = NewRouter([]Plant{
+		{Name: "P1", Departments: []string{"M2110"}},
+		{Name: "P2", Departments: []string{"M2110"}},
+	})
+	assert.EqualError(err, "department M2110 is in both plant P1 and P2")
+}
+
+func TestRouter(t *testing.T) {
+	assert := assert.New(t)
+
+	now := time.Date(2022, 12, 1, 8, 0, 0, 0, time.Local)
+	lookups := 0
+	r, err := NewRouter([]Plant{
+		{
+			Name:        "P1",
+			Departments: []string{"M2110"},
+			Handler:     plantHandler("P1"),
+			LookupToken: func(context.Context, string) (time.Time, bool, error) {
+				return time.Time{}, false, errors.New("connection refused")
+			},
+		},
+		{
+			Name:        "P2",
+			Departments: []string{"K1100"},
+			Handler:     plantHandler("P2"),
+			LookupToken: func(_ context.Context, token string) (time.Time, bool, error) {
+				lookups++
+				return now.Add(time.Hour), token == "token-of-p2", nil
+			},
+		},
+	})
+	assert.NoError(err)
+	r.now = func() time.Time { return now }
+
+	serve := func(path string, headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		for key, value := range headers {
+			req.Header.Set(key, value)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	// plant header.
+	assert.Equal("P2", serve("/api/departments", map[string]string{Header: "P2"}).Body.String())
+	assert.Equal("P2", serve("/api/station-list/department-oid/M2110", map[string]string{Header: "P2"}).Body.String())
+	w := serve("/api/departments", map[string]string{Header: "P3"})
+	assert.Equal(http.StatusBadRequest, w.Code)
+
+	// department.
+	assert.Equal("P2", serve("/api/station-list/department-oid/K1100", nil).Body.String())
+
+	// token.
+	assert.Equal("P2", serve("/api/departments", map[string]string{TokenHeader: "token-of-p2"}).Body.String())
+	assert.Equal("P2", serve("/api/departments", map[string]string{TokenHeader: "token-of-p2"}).Body.String())
+	assert.Equal(1, lookups) // cached.
+	now = now.Add(2 * time.Hour)
+	assert.Equal("P2", serve("/api/departments", map[string]string{TokenHeader: "token-of-p2"}).Body.String())
+	assert.Equal(2, lookups) // expired.
+	assert.Equal("P2", serve("/api/station-list/department-oid/K1100", map[string]string{Header: "P2", TokenHeader: "token-of-p2"}).Body.String())
+
+	// the token of another plant.
+	w = serve("/api/departments", map[string]string{Header: "P1", TokenHeader: "token-of-p2"})
+	assert.Equal(http.StatusForbidden, w.Code)
+	assert.Equal("the token was not signed in at plant P1\n", w.Body.String())
+	w = serve("/api/work-orders/upload/department/M2110", map[string]string{TokenHeader: "token-of-p2"})
+	assert.Equal(http.StatusForbidden, w.Code)
+	assert.Equal("the department is not in plant P2\n", w.Body.String())
+
+	// default.
+	assert.Equal("P1", serve("/api/departments", map[string]string{TokenHeader: "unknown"}).Body.String())
+	assert.Equal("P1", serve("/api/station-list/department-oid/X9999", nil).Body.String())
+
+	// sign-in.
+	assert.Equal("P2", serve("/api/user/login", map[string]string{Header: "P2"}).Body.String())
+	w = serve("/api/user/login", nil)
+	assert.Equal(http.StatusBadRequest, w.Code)
+	assert.Equal("missing header X-Plant to sign in\n", w.Body.String())
+}
+
+func TestRouter_unknownToken(t *testing.T) {
+	assert := assert.New(t)
+
+	now := time.Date(2022, 12, 1, 8, 0, 0, 0, time.Local)
+	lookups := 0
+	var lookupErr error
+	lookup := func(context.Context, string) (time.Time, bool, error) {
+		lookups++
+		return time.Time{}, false, lookupErr
+	}
+	r, err := NewRouter([]Plant{
+		{Name: "P1", Handler: plantHandler("P1"), LookupToken: lookup},
+		{Name: "P2", Handler: plantHandler("P2"), LookupToken: lookup},
+	})
+	assert.NoError(err)
+	r.now = func() time.Time { return now }
+
+	serve := func(token string) string {
+		req := httptest.NewRequest(http.MethodGet, "/api/departments", nil)
+		req.Header.Set(TokenHeader, token)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Body.String()
+	}
+
+	assert.Equal("P1", serve("unknown"))
+	assert.Equal(2, lookups)
+	assert.Equal("P1", serve("unknown"))
+	assert.Equal(2, lookups) // cached.
+	now = now.Add(unknownTokenTTL)
+	assert.Equal("P1", serve("unknown"))
+	assert.Equal(4, lookups) // expired.
+
+	// the failed lookups are not cached.
+	lookupErr = errors.New("connection refused")
+	assert.Equal("P1", serve("failed"))
+	assert.Equal("P1", serve("failed"))
+	assert.Equal(8, lookups)
+}
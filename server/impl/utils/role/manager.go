@@ -0,0 +1,254 @@
+package role
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	mcomErrors "gitlab.kenda.com.tw/kenda/mcom/errors"
+	mcomRoles "gitlab.kenda.com.tw/kenda/mcom/utils/roles"
+
+	"gitlab.kenda.com.tw/kenda/mui/server/database"
+	"gitlab.kenda.com.tw/kenda/mui/server/protobuf/kenda"
+	"gitlab.kenda.com.tw/kenda/mui/server/swagger/models"
+)
+
+// SeedUser is the user recorded in the permission changes seeded from the configurations.
+const SeedUser = "SYSTEM"
+
+// ErrAdministratorRequired is returned when a change would take the permission
+// management away from the administrator.
+var ErrAdministratorRequired = mcomErrors.Error{
+	Code:    mcomErrors.Code_BAD_REQUEST,
+	Details: "administrator must keep the permission of " + kenda.FunctionOperationID_MANAGE_ROLE_PERMISSIONS.String(),
+}
+
+// WatchInterval is the interval of checking the permission changes made by the
+// other servers sharing the store.
+const WatchInterval = 10 * time.Second
+
+// Manager manages the function permissions kept in the store and applies
+// every change to its permission list. Every plant has its own Manager in the
+// multi-plant mode.
+type Manager struct {
+	store database.PermissionStore
+
+	mu sync.Mutex
+	// revision of the store when the permission list was loaded.
+	revision int64
+
+	listMu sync.RWMutex
+	list   funcRoleList
+}
+
+// NewManager returns a Manager which loads the permission list from the store.
+// The store is seeded with the specified permissions if it has never stored
+// any permission, otherwise the seed permissions are ignored.
+func NewManager(ctx context.Context, store database.PermissionStore, seed map[string][]string) (*Manager, error) {
+	m := &Manager{store: store}
+
+	perms, err := seedPermissions(seed)
+	if err != nil {
+		return nil, err
+	}
+	seeded, err := store.SeedPermissions(ctx, perms, SeedUser)
+	if err != nil {
+		return nil, err
+	}
+	if !seeded && len(seed) > 0 {
+		zap.L().Info("role permissions have been stored, the permissions of configurations are ignored")
+	}
+
+	if err := m.Reload(ctx); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func seedPermissions(seed map[string][]string) (map[kenda.FunctionOperationID][]string, error) {
+	perms := make(map[kenda.FunctionOperationID][]string, len(seed))
+	for name, roles := range seed {
+		funcID, ok := kenda.FunctionOperationID_value[name]
+		if !ok {
+			return nil, fmt.Errorf("function %s was not in the list", name)
+		}
+		if _, err := rolesToMap(roles); err != nil {
+			return nil, err
+		}
+		perms[kenda.FunctionOperationID(funcID)] = roles
+	}
+
+	// keep the permission management reachable for configurations written
+	// before the permissions were stored.
+	if _, ok := perms[kenda.FunctionOperationID_MANAGE_ROLE_PERMISSIONS]; !ok {
+		perms[kenda.FunctionOperationID_MANAGE_ROLE_PERMISSIONS] = []string{mcomRoles.Role_ADMINISTRATOR.String()}
+	}
+	return perms, nil
+}
+
+// Reload loads the permission list from the store.
+func (m *Manager) Reload(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// the revision is read first so that a change made during the loading
+	// is loaded again by the next Refresh.
+	revision, err := m.store.Revision(ctx)
+	if err != nil {
+		return err
+	}
+	perms, err := m.store.ListPermissions(ctx)
+	if err != nil {
+		return err
+	}
+
+	list := make(funcRoleList, len(perms))
+	for _, perm := range perms {
+		roles, err := rolesToMap(perm.Roles)
+		if err != nil {
+			// the role may be removed from the library, ignore it rather than
+			// blocking the others.
+			zap.L().Warn("invalid stored role permission",
+				zap.String("function", perm.FunctionID.String()),
+				zap.Error(err))
+			continue
+		}
+		list[perm.FunctionID] = roles
+	}
+	m.setList(list)
+	m.revision = revision
+	return nil
+}
+
+func (m *Manager) setList(list funcRoleList) {
+	m.listMu.Lock()
+	defer m.listMu.Unlock()
+	m.list = list
+}
+
+// HasPermission checks if any of the user's roles has the permission of the
+// function.
+func (m *Manager) HasPermission(id kenda.FunctionOperationID, roles []models.Role) bool {
+	m.listMu.RLock()
+	defer m.listMu.RUnlock()
+	return m.list.has(id, roles)
+}
+
+// Refresh reloads the permission list if the permissions have been changed
+// since the last loading, e.g. by another server sharing the store.
+func (m *Manager) Refresh(ctx context.Context) error {
+	revision, err := m.store.Revision(ctx)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	changed := revision != m.revision
+	m.mu.Unlock()
+	if !changed {
+		return nil
+	}
+	return m.Reload(ctx)
+}
+
+// Watch refreshes the permission list at every interval until the context is done.
+func (m *Manager) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := m.Refresh(ctx); err != nil {
+				zap.L().Warn("failed to refresh role permissions", zap.Error(err))
+			}
+		}
+	}
+}
+
+// ListPermissions lists all the stored function permissions.
+func (m *Manager) ListPermissions(ctx context.Context) ([]database.FunctionPermission, error) {
+	return m.store.ListPermissions(ctx)
+}
+
+// CreatePermission creates the permission of a function.
+func (m *Manager) CreatePermission(ctx context.Context, id kenda.FunctionOperationID, roles []mcomRoles.Role, user string) (database.FunctionPermission, error) {
+	if err := checkPermissionChange(id, roles); err != nil {
+		return database.FunctionPermission{}, err
+	}
+
+	perm, err := m.store.CreatePermission(ctx, id, roleNames(roles), user)
+	if err != nil {
+		return database.FunctionPermission{}, err
+	}
+	return perm, m.Reload(ctx)
+}
+
+// UpdatePermission replaces the roles of a function permission with the specified version.
+func (m *Manager) UpdatePermission(ctx context.Context, id kenda.FunctionOperationID, roles []mcomRoles.Role, version int, user string) (database.FunctionPermission, error) {
+	if err := checkPermissionChange(id, roles); err != nil {
+		return database.FunctionPermission{}, err
+	}
+
+	perm, err := m.store.UpdatePermission(ctx, id, roleNames(roles), version, user)
+	if err != nil {
+		return database.FunctionPermission{}, err
+	}
+	return perm, m.Reload(ctx)
+}
+
+// DeletePermission deletes a function permission with the specified version.
+func (m *Manager) DeletePermission(ctx context.Context, id kenda.FunctionOperationID, version int, user string) error {
+	if err := checkPermissionChange(id, nil); err != nil {
+		return err
+	}
+
+	if err := m.store.DeletePermission(ctx, id, version, user); err != nil {
+		return err
+	}
+	return m.Reload(ctx)
+}
+
+// ListPermissionChanges lists the change history of a function permission.
+func (m *Manager) ListPermissionChanges(ctx context.Context, id kenda.FunctionOperationID) ([]database.FunctionPermissionChange, error) {
+	return m.store.ListPermissionChanges(ctx, id)
+}
+
+func checkPermissionChange(id kenda.FunctionOperationID, roles []mcomRoles.Role) error {
+	if _, ok := kenda.FunctionOperationID_name[int32(id)]; !ok {
+		return mcomErrors.Error{
+			Code:    mcomErrors.Code_BAD_REQUEST,
+			Details: fmt.Sprintf("function %d was not in the list", id),
+		}
+	}
+	for _, role := range roles {
+		if _, ok := mcomRoles.Role_name[int32(role)]; !ok {
+			return mcomErrors.Error{
+				Code:    mcomErrors.Code_BAD_REQUEST,
+				Details: fmt.Sprintf("not existed role: %d", role),
+			}
+		}
+	}
+
+	if id == kenda.FunctionOperationID_MANAGE_ROLE_PERMISSIONS {
+		for _, role := range roles {
+			if role == mcomRoles.Role_ADMINISTRATOR {
+				return nil
+			}
+		}
+		return ErrAdministratorRequired
+	}
+	return nil
+}
+
+func roleNames(roles []mcomRoles.Role) []string {
+	names := make([]string, len(roles))
+	for i, role := range roles {
+		names[i] = role.String()
+	}
+	return names
+}
@@ -0,0 +1,325 @@
+package role
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	mcomErrors "gitlab.kenda.com.tw/kenda/mcom/errors"
+	mcomRoles "gitlab.kenda.com.tw/kenda/mcom/utils/roles"
+
+	"gitlab.kenda.com.tw/kenda/mui/server/database"
+	"gitlab.kenda.com.tw/kenda/mui/server/protobuf/kenda"
+	"gitlab.kenda.com.tw/kenda/mui/server/swagger/models"
+)
+
+// memoryStore is an in-memory database.PermissionStore for testing.
+type memoryStore struct {
+	perms   map[kenda.FunctionOperationID]database.FunctionPermission
+	changes []database.FunctionPermissionChange
+	err     error
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{perms: map[kenda.FunctionOperationID]database.FunctionPermission{}}
+}
+
+func (s *memoryStore) SeedPermissions(_ context.Context, perms map[kenda.FunctionOperationID][]string, user string) (bool, error) {
+	if s.err != nil || len(s.changes) > 0 {
+		return false, s.err
+	}
+	for id, roles := range perms {
+		perm := database.FunctionPermission{
+			FunctionID: id,
+			Roles:      roles,
+			Version:    1,
+			UpdatedBy:  user,
+		}
+		s.perms[id] = perm
+		s.record(perm, database.PermissionCreated)
+	}
+	return true, nil
+}
+
+func (s *memoryStore) Revision(context.Context) (int64, error) {
+	return int64(len(s.changes)), s.err
+}
+
+func (s *memoryStore) ListPermissions(context.Context) ([]database.FunctionPermission, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	list := []database.FunctionPermission{}
+	for _, perm := range s.perms {
+		list = append(list, perm)
+	}
+	return list, nil
+}
+
+func (s *memoryStore) lastVersion(id kenda.FunctionOperationID) int {
+	version := 0
+	for _, change := range s.changes {
+		if change.FunctionID == id {
+			version = change.Version
+		}
+	}
+	return version
+}
+
+func (s *memoryStore) record(perm database.FunctionPermission, action database.PermissionAction) {
+	s.changes = append(s.changes, database.FunctionPermissionChange{
+		FunctionID: perm.FunctionID,
+		Version:    perm.Version,
+		Action:     action,
+		Roles:      perm.Roles,
+		CreatedBy:  perm.UpdatedBy,
+	})
+}
+
+func (s *memoryStore) CreatePermission(_ context.Context, id kenda.FunctionOperationID, roles []string, user string) (database.FunctionPermission, error) {
+	if s.err != nil {
+		return database.FunctionPermission{}, s.err
+	}
+	if _, ok := s.perms[id]; ok {
+		return database.FunctionPermission{}, database.ErrRecordExisted
+	}
+	perm := database.FunctionPermission{
+		FunctionID: id,
+		Roles:      roles,
+		Version:    s.lastVersion(id) + 1,
+		UpdatedBy:  user,
+	}
+	s.perms[id] = perm
+	s.record(perm, database.PermissionCreated)
+	return perm, nil
+}
+
+func (s *memoryStore) UpdatePermission(_ context.Context, id kenda.FunctionOperationID, roles []string, version int, user string) (database.FunctionPermission, error) {
+	if s.err != nil {
+		return database.FunctionPermission{}, s.err
+	}
+	perm, ok := s.perms[id]
+	if !ok {
+		return database.FunctionPermission{}, database.ErrRecordNotFound
+	}
+	if perm.Version != version {
+		return database.FunctionPermission{}, database.ErrVersionConflict
+	}
+	perm = database.FunctionPermission{
+		FunctionID: id,
+		Roles:      roles,
+		Version:    version + 1,
+		UpdatedBy:  user,
+	}
+	s.perms[id] = perm
+	s.record(perm, database.PermissionUpdated)
+	return perm, nil
+}
+
+func (s *memoryStore) DeletePermission(_ context.Context, id kenda.FunctionOperationID, version int, user string) error {
+	if s.err != nil {
+		return s.err
+	}
+	perm, ok := s.perms[id]
+	if !ok {
+		return database.ErrRecordNotFound
+	}
+	if perm.Version != version {
+		return database.ErrVersionConflict
+	}
+	delete(s.perms, id)
+	s.record(database.FunctionPermission{
+		FunctionID: id,
+		Roles:      database.Strings{},
+		Version:    version + 1,
+		UpdatedBy:  user,
+	}, database.PermissionDeleted)
+	return nil
+}
+
+func (s *memoryStore) ListPermissionChanges(_ context.Context, id kenda.FunctionOperationID) ([]database.FunctionPermissionChange, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	list := []database.FunctionPermissionChange{}
+	for _, change := range s.changes {
+		if change.FunctionID == id {
+			list = append(list, change)
+		}
+	}
+	return list, nil
+}
+
+func TestNewManager(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	{ // seed an empty store.
+		store := newMemoryStore()
+		m, err := NewManager(ctx, store, map[string][]string{
+			"STATION_FORCE_SIGN_IN": {"ADMINISTRATOR", "LEADER"},
+		})
+		assert.NoError(err)
+		assert.Len(store.perms, 2)
+		assert.Equal(database.Strings{"ADMINISTRATOR", "LEADER"}, store.perms[kenda.FunctionOperationID_STATION_FORCE_SIGN_IN].Roles)
+		assert.Equal(SeedUser, store.perms[kenda.FunctionOperationID_STATION_FORCE_SIGN_IN].UpdatedBy)
+		// the permission management is granted to the administrator by default.
+		assert.Equal(database.Strings{"ADMINISTRATOR"}, store.perms[kenda.FunctionOperationID_MANAGE_ROLE_PERMISSIONS].Roles)
+
+		assert.True(m.HasPermission(kenda.FunctionOperationID_STATION_FORCE_SIGN_IN, []models.Role{models.Role(mcomRoles.Role_LEADER)}))
+		assert.False(m.HasPermission(kenda.FunctionOperationID_STATION_FORCE_SIGN_IN, []models.Role{models.Role(mcomRoles.Role_OPERATOR)}))
+	}
+	{ // the seed is ignored if the store has been used.
+		store := newMemoryStore()
+		_, err := store.CreatePermission(ctx, kenda.FunctionOperationID_GET_ROLE_LIST, []string{"OPERATOR"}, "tester")
+		assert.NoError(err)
+
+		m, err := NewManager(ctx, store, map[string][]string{
+			"STATION_FORCE_SIGN_IN": {"ADMINISTRATOR", "LEADER"},
+		})
+		assert.NoError(err)
+		assert.Len(store.perms, 1)
+		assert.True(m.HasPermission(kenda.FunctionOperationID_GET_ROLE_LIST, []models.Role{models.Role(mcomRoles.Role_OPERATOR)}))
+		assert.False(m.HasPermission(kenda.FunctionOperationID_STATION_FORCE_SIGN_IN, []models.Role{models.Role(mcomRoles.Role_LEADER)}))
+	}
+	{ // function not found.
+		_, err := NewManager(ctx, newMemoryStore(), map[string][]string{
+			"NOT_EXISTED": {"ADMINISTRATOR"},
+		})
+		assert.EqualError(err, "function NOT_EXISTED was not in the list")
+	}
+	{ // role not found.
+		_, err := NewManager(ctx, newMemoryStore(), map[string][]string{
+			"STATION_FORCE_SIGN_IN": {"ACTOR"},
+		})
+		assert.EqualError(err, "not existed role: ACTOR")
+	}
+	{ // store error.
+		store := newMemoryStore()
+		store.err = errors.New("internal error")
+		_, err := NewManager(ctx, store, nil)
+		assert.EqualError(err, "internal error")
+	}
+}
+
+func TestManager(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	store := newMemoryStore()
+	m, err := NewManager(ctx, store, nil)
+	assert.NoError(err)
+
+	leader := []models.Role{models.Role(mcomRoles.Role_LEADER)}
+	operator := []models.Role{models.Role(mcomRoles.Role_OPERATOR)}
+
+	// create applies immediately.
+	perm, err := m.CreatePermission(ctx, kenda.FunctionOperationID_STATION_FORCE_SIGN_IN, []mcomRoles.Role{mcomRoles.Role_LEADER}, "tester")
+	assert.NoError(err)
+	assert.Equal(1, perm.Version)
+	assert.True(m.HasPermission(kenda.FunctionOperationID_STATION_FORCE_SIGN_IN, leader))
+
+	_, err = m.CreatePermission(ctx, kenda.FunctionOperationID_STATION_FORCE_SIGN_IN, []mcomRoles.Role{mcomRoles.Role_LEADER}, "tester")
+	assert.ErrorIs(err, database.ErrRecordExisted)
+
+	// update applies immediately.
+	perm, err = m.UpdatePermission(ctx, kenda.FunctionOperationID_STATION_FORCE_SIGN_IN, []mcomRoles.Role{mcomRoles.Role_OPERATOR}, 1, "tester")
+	assert.NoError(err)
+	assert.Equal(2, perm.Version)
+	assert.False(m.HasPermission(kenda.FunctionOperationID_STATION_FORCE_SIGN_IN, leader))
+	assert.True(m.HasPermission(kenda.FunctionOperationID_STATION_FORCE_SIGN_IN, operator))
+
+	// stale version.
+	_, err = m.UpdatePermission(ctx, kenda.FunctionOperationID_STATION_FORCE_SIGN_IN, []mcomRoles.Role{mcomRoles.Role_LEADER}, 1, "tester")
+	assert.ErrorIs(err, database.ErrVersionConflict)
+	assert.ErrorIs(m.DeletePermission(ctx, kenda.FunctionOperationID_STATION_FORCE_SIGN_IN, 1, "tester"), database.ErrVersionConflict)
+
+	// delete applies immediately.
+	assert.NoError(m.DeletePermission(ctx, kenda.FunctionOperationID_STATION_FORCE_SIGN_IN, 2, "tester"))
+	assert.False(m.HasPermission(kenda.FunctionOperationID_STATION_FORCE_SIGN_IN, operator))
+	assert.ErrorIs(m.DeletePermission(ctx, kenda.FunctionOperationID_STATION_FORCE_SIGN_IN, 3, "tester"), database.ErrRecordNotFound)
+
+	// history.
+	changes, err := m.ListPermissionChanges(ctx, kenda.FunctionOperationID_STATION_FORCE_SIGN_IN)
+	assert.NoError(err)
+	assert.Len(changes, 3)
+	assert.Equal([]database.PermissionAction{
+		database.PermissionCreated,
+		database.PermissionUpdated,
+		database.PermissionDeleted,
+	}, []database.PermissionAction{changes[0].Action, changes[1].Action, changes[2].Action})
+
+	// bad requests.
+	_, err = m.CreatePermission(ctx, kenda.FunctionOperationID(-1), []mcomRoles.Role{mcomRoles.Role_LEADER}, "tester")
+	assert.Equal(mcomErrors.Error{Code: mcomErrors.Code_BAD_REQUEST, Details: "function -1 was not in the list"}, err)
+	_, err = m.CreatePermission(ctx, kenda.FunctionOperationID_GET_ROLE_LIST, []mcomRoles.Role{mcomRoles.Role(-1)}, "tester")
+	assert.Equal(mcomErrors.Error{Code: mcomErrors.Code_BAD_REQUEST, Details: "not existed role: -1"}, err)
+	_, err = m.UpdatePermission(ctx, kenda.FunctionOperationID_MANAGE_ROLE_PERMISSIONS, []mcomRoles.Role{mcomRoles.Role_LEADER}, 1, "tester")
+	assert.Equal(ErrAdministratorRequired, err)
+	assert.Equal(ErrAdministratorRequired, m.DeletePermission(ctx, kenda.FunctionOperationID_MANAGE_ROLE_PERMISSIONS, 1, "tester"))
+}
+
+func TestManager_Reload(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	store := newMemoryStore()
+	store.perms[kenda.FunctionOperationID_GET_ROLE_LIST] = database.FunctionPermission{
+		FunctionID: kenda.FunctionOperationID_GET_ROLE_LIST,
+		Roles:      database.Strings{"LEADER"},
+		Version:    1,
+		UpdatedAt:  time.Now(),
+	}
+	// the invalid stored permission is ignored.
+	store.perms[kenda.FunctionOperationID_GET_PLAN_LIST] = database.FunctionPermission{
+		FunctionID: kenda.FunctionOperationID_GET_PLAN_LIST,
+		Roles:      database.Strings{"ACTOR"},
+		Version:    1,
+		UpdatedAt:  time.Now(),
+	}
+	m := &Manager{store: store}
+	assert.NoError(m.Reload(ctx))
+	assert.Equal(funcRoleList{
+		kenda.FunctionOperationID_GET_ROLE_LIST: {
+			mcomRoles.Role_LEADER: struct{}{},
+		},
+	}, m.list)
+
+	// the managers of the plants are independent.
+	leader := []models.Role{models.Role(mcomRoles.Role_LEADER)}
+	other := &Manager{store: newMemoryStore()}
+	assert.NoError(other.Reload(ctx))
+	assert.False(other.HasPermission(kenda.FunctionOperationID_GET_ROLE_LIST, leader))
+	assert.True(m.HasPermission(kenda.FunctionOperationID_GET_ROLE_LIST, leader))
+}
+
+func TestManager_Refresh(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	store := newMemoryStore()
+	m, err := NewManager(ctx, store, nil)
+	assert.NoError(err)
+
+	leader := []models.Role{models.Role(mcomRoles.Role_LEADER)}
+
+	// changed by another server sharing the store.
+	_, err = store.CreatePermission(ctx, kenda.FunctionOperationID_STATION_FORCE_SIGN_IN, []string{"LEADER"}, "tester")
+	assert.NoError(err)
+	assert.False(m.HasPermission(kenda.FunctionOperationID_STATION_FORCE_SIGN_IN, leader))
+
+	assert.NoError(m.Refresh(ctx))
+	assert.True(m.HasPermission(kenda.FunctionOperationID_STATION_FORCE_SIGN_IN, leader))
+
+	// not reloaded without any change.
+	m.setList(nil)
+	assert.NoError(m.Refresh(ctx))
+	assert.False(m.HasPermission(kenda.FunctionOperationID_STATION_FORCE_SIGN_IN, leader))
+
+	// store error.
+	store.err = errors.New("internal error")
+	assert.EqualError(m.Refresh(ctx), "internal error")
+}
@@ -0,0 +1,324 @@
+package role
+
+import (
+	"net/http"
+
+	"gitlab.kenda.com.tw/kenda/mui/server/protobuf/kenda"
+)
+
+// Route defines an API route which is guarded by a function operation ID.
+type Route struct {
+	Method string
+	Path   string
+}
+
+// functionRoutes lists the API routes guarded by each function operation ID.
+// it must be kept in line with the permission checks of the handlers and the
+// paths defined in swagger.yml.
+var functionRoutes = map[kenda.FunctionOperationID][]Route{
+	kenda.FunctionOperationID_GET_SERVER_STATUS: {
+		{Method: http.MethodGet, Path: "/server/status"},
+	},
+
+	kenda.FunctionOperationID_GET_BARCODE_INFO: {
+		{Method: http.MethodGet, Path: "/pda/barcode/{ID}"},
+	},
+	kenda.FunctionOperationID_UPDATE_BARCODE: {
+		{Method: http.MethodPut, Path: "/pda/barcode/{ID}"},
+	},
+	kenda.FunctionOperationID_GET_UPDATE_BARCODE_STATUS_LIST: {
+		{Method: http.MethodGet, Path: "/pda/barcode/update-status-list/ID/{ID}"},
+	},
+	kenda.FunctionOperationID_GET_EXTEND_DAYS: {
+		{Method: http.MethodGet, Path: "/pda/barcode/extend-expired-date/ID/{ID}"},
+	},
+	kenda.FunctionOperationID_GET_CONTROL_AREA_LIST: {
+		{Method: http.MethodGet, Path: "/pda/barcode/control-area"},
+	},
+	kenda.FunctionOperationID_GET_HOLD_REASON_LIST: {
+		{Method: http.MethodGet, Path: "/pda/barcode/reason-list"},
+	},
+
+	kenda.FunctionOperationID_GET_PRODUCT_TYPE_LIST: {
+		{Method: http.MethodGet, Path: "/product/active-product-types/department-oid/{departmentOID}"},
+		{Method: http.MethodGet, Path: "/product/active-product-types"},
+	},
+	kenda.FunctionOperationID_GET_PRODUCT_GROUP_LIST: {
+		{Method: http.MethodGet, Path: "/product/groups/department-oid/{departmentOID}/product-type/{productType}"},
+	},
+	kenda.FunctionOperationID_GET_PRODUCT_LIST: {
+		{Method: http.MethodGet, Path: "/product/active-products/product-type/{productType}"},
+	},
+	kenda.FunctionOperationID_GET_RECIPE_LIST: {
+		{Method: http.MethodGet, Path: "/product/active-recipes/product-id/{productID}"},
+	},
+
+	kenda.FunctionOperationID_GET_PLAN_LIST: {
+		{Method: http.MethodGet, Path: "/plans/department-oid/{departmentOID}/product-type/{productType}/date/{date}"},
+	},
+	kenda.FunctionOperationID_ADD_PLAN: {
+		{Method: http.MethodPost, Path: "/plan"},
+	},
+
+	kenda.FunctionOperationID_CREATE_STATION_SCHEDULING: {
+		{Method: http.MethodPost, Path: "/work-orders"},
+	},
+	kenda.FunctionOperationID_GET_STATION_SCHEDULING: {
+		{Method: http.MethodGet, Path: "/schedulings/station/{station}/date/{date}"},
+		{Method: http.MethodGet, Path: "/schedulings/station/{station}/date/{date}/export"},
+	},
+	kenda.FunctionOperationID_UPDATE_STATION_SCHEDULING: {
+		{Method: http.MethodPut, Path: "/work-orders"},
+	},
+
+	kenda.FunctionOperationID_GET_STATION_LIST: {
+		{Method: http.MethodGet, Path: "/station-list/department-oid/{departmentOID}"},
+	},
+
+	kenda.FunctionOperationID_ADD_MATERIAL: {
+		{Method: http.MethodPost, Path: "/resource/material/stock"},
+	},
+
+	kenda.FunctionOperationID_GET_WAREHOUSE_INFO: {
+		{Method: http.MethodGet, Path: "/warehouse/resource/{ID}"},
+	},
+	kenda.FunctionOperationID_WAREHOUSE_TRANSACTION: {
+		{Method: http.MethodPut, Path: "/warehouse/resource/{ID}"},
+	},
+
+	kenda.FunctionOperationID_GET_RECIPE_IDS: {
+		{Method: http.MethodGet, Path: "/product/recipe-id/product-id/{productID}"},
+	},
+	kenda.FunctionOperationID_GET_RECIPE_PROCESS_LIST: {
+		{Method: http.MethodGet, Path: "/product/recipe-process/recipe-id/{recipeID}"},
+	},
+
+	kenda.FunctionOperationID_GET_MATERIAL_RESOURCE_INFO: {
+		{Method: http.MethodGet, Path: "/resource/material/info/resource-id/{ID}"},
+	},
+	kenda.FunctionOperationID_GET_SITE_MATERIAL_LIST: {
+		{Method: http.MethodGet, Path: "/site/material/station/{station}/site-name/{siteName}/site-index/{siteIndex}"},
+	},
+	kenda.FunctionOperationID_BIND_RESOURCE: {
+		{Method: http.MethodPost, Path: "/site/resources/bind/auto"},
+	},
+
+	kenda.FunctionOperationID_CHANGE_USER_PASSWORD: {
+		{Method: http.MethodPut, Path: "/user/change-password"},
+	},
+
+	kenda.FunctionOperationID_LIST_CARRIER: {
+		{Method: http.MethodGet, Path: "/carrier/department-oid/{departmentOID}"},
+	},
+	kenda.FunctionOperationID_CREATE_CARRIER: {
+		{Method: http.MethodPost, Path: "/carrier"},
+	},
+	kenda.FunctionOperationID_UPDATE_CARRIER: {
+		{Method: http.MethodPut, Path: "/carrier/{ID}"},
+	},
+	kenda.FunctionOperationID_DELETE_CARRIER: {
+		{Method: http.MethodDelete, Path: "/carrier/{ID}"},
+	},
+
+	kenda.FunctionOperationID_GET_ROLE_LIST: {
+		{Method: http.MethodGet, Path: "/account/role-list"},
+	},
+	kenda.FunctionOperationID_LIST_AUTHORIZED_ACCOUNT: {
+		{Method: http.MethodGet, Path: "/account/authorized/department-oid/{departmentOID}"},
+	},
+	kenda.FunctionOperationID_LIST_UNAUTHORIZED_ACCOUNT: {
+		{Method: http.MethodGet, Path: "/account/unauthorized/department-oid/{departmentOID}"},
+	},
+	kenda.FunctionOperationID_CREATE_ACCOUNT: {
+		{Method: http.MethodPost, Path: "/account/authorization"},
+	},
+	kenda.FunctionOperationID_UPDATE_ACCOUNT: {
+		{Method: http.MethodPut, Path: "/account/authorization/{employeeID}"},
+	},
+	kenda.FunctionOperationID_DELETE_ACCOUNT: {
+		{Method: http.MethodDelete, Path: "/account/authorization/{employeeID}"},
+	},
+
+	kenda.FunctionOperationID_SITE_TYPE_LIST: {
+		{Method: http.MethodGet, Path: "/site/type-list"},
+	},
+	kenda.FunctionOperationID_SITE_SUBTYPE_LIST: {
+		{Method: http.MethodGet, Path: "/site/sub-type-list"},
+	},
+
+	kenda.FunctionOperationID_LIST_STATION_INFO: {
+		{Method: http.MethodGet, Path: "/station/maintenance/department-oid/{departmentOID}"},
+	},
+	kenda.FunctionOperationID_CREATE_STATION: {
+		{Method: http.MethodPost, Path: "/station/maintenance"},
+	},
+	kenda.FunctionOperationID_UPDATE_STATION_INFO: {
+		{Method: http.MethodPatch, Path: "/station/maintenance/{ID}"},
+	},
+	kenda.FunctionOperationID_DELETE_STATION: {
+		{Method: http.MethodDelete, Path: "/station/maintenance/{ID}"},
+	},
+
+	kenda.FunctionOperationID_LIST_STATION_STATE: {
+		{Method: http.MethodGet, Path: "/station/state"},
+	},
+
+	kenda.FunctionOperationID_GET_MATERIAL_RESOURCE_INFO_BY_TYPE: {
+		{Method: http.MethodGet, Path: "/resource/material/info/product-type/{productType}"},
+	},
+	kenda.FunctionOperationID_LIST_MATERIAL_STATUS: {
+		{Method: http.MethodGet, Path: "/resource/material/status"},
+	},
+	kenda.FunctionOperationID_SPLIT_MATERIAL: {
+		{Method: http.MethodPost, Path: "/resource/material/split"},
+	},
+	kenda.FunctionOperationID_DOWNLOAD_MATERIAL_RESOURCE: {
+		{Method: http.MethodPost, Path: "/print/resource/material"},
+	},
+
+	kenda.FunctionOperationID_CHANGE_WORK_ORDER_STATUS: {
+		{Method: http.MethodPut, Path: "/production-flow/status/work-order/{workOrderID}"},
+	},
+	kenda.FunctionOperationID_LIST_WORK_ORDERS: {
+		{Method: http.MethodGet, Path: "/production-flow/work-orders/station/{stationID}"},
+		{Method: http.MethodGet, Path: "/production-flow/work-orders/station/{stationID}/export"},
+	},
+	kenda.FunctionOperationID_GET_WORK_ORDER_INFORMATION: {
+		{Method: http.MethodGet, Path: "/production-flow/work-order/{workOrderID}/information"},
+	},
+	kenda.FunctionOperationID_GET_SITE_INFORMATION: {
+		{Method: http.MethodPost, Path: "/production-flow/site/information"},
+	},
+	kenda.FunctionOperationID_GET_TOOL_ID: {
+		{Method: http.MethodGet, Path: "/production-flow/tool-resource/{toolResourceID}"},
+	},
+	kenda.FunctionOperationID_FEED_COLLECT: {
+		{Method: http.MethodPost, Path: "/production-flow/feed-collect/work-order/{workOrderID}"},
+	},
+	kenda.FunctionOperationID_LIST_STATIONS: {
+		{Method: http.MethodGet, Path: "/production-flow/station"},
+	},
+	kenda.FunctionOperationID_SET_STATION_CONFIG: {
+		{Method: http.MethodPost, Path: "/production-flow/config/station/{stationID}"},
+	},
+	kenda.FunctionOperationID_GET_STATION_CONFIG: {
+		{Method: http.MethodGet, Path: "/production-flow/config/station/{stationID}"},
+	},
+	kenda.FunctionOperationID_LIST_STATION_SITES: {
+		{Method: http.MethodGet, Path: "/production-flow/site/station/{stationID}"},
+	},
+	kenda.FunctionOperationID_PRINT_MATERIAL_RESOURCE: {
+		{Method: http.MethodPost, Path: "/production-flow/print/material-resource"},
+	},
+
+	kenda.FunctionOperationID_LIST_DEPARTMENT_IDS: {
+		{Method: http.MethodGet, Path: "/departments"},
+	},
+	kenda.FunctionOperationID_STATION_FORCE_SIGN_IN: {
+		{Method: http.MethodPost, Path: "/station/{stationID}/sign-in"},
+	},
+	kenda.FunctionOperationID_STATION_SIGN_OUT: {
+		{Method: http.MethodPost, Path: "/stations/sign-out"},
+	},
+	kenda.FunctionOperationID_GET_STATION_OPERATOR: {
+		{Method: http.MethodPost, Path: "/station/{stationID}/operator"},
+	},
+	kenda.FunctionOperationID_UPDATE_WORK_ORDER: {
+		{Method: http.MethodPut, Path: "/work-orders/{id}"},
+	},
+
+	kenda.FunctionOperationID_CREATE_WORK_ORDERS_FROM_FILE: {
+		{Method: http.MethodPost, Path: "/work-orders/upload/department/{department}"},
+		{Method: http.MethodPost, Path: "/work-orders/upload/preview/{previewID}"},
+		{Method: http.MethodGet, Path: "/work-orders/upload/template"},
+	},
+	kenda.FunctionOperationID_DOWNLOAD_PRE_MATERIAL_RESOURCE: {
+		{Method: http.MethodPost, Path: "/print/work-orders/{workOrderID}/pre-material-resource"},
+	},
+
+	kenda.FunctionOperationID_MES_FEED: {
+		{Method: http.MethodPost, Path: "/mes/feed/station/{stationID}"},
+	},
+	kenda.FunctionOperationID_MES_COLLECT: {
+		{Method: http.MethodPost, Path: "/mes/collect/station/{stationID}"},
+	},
+
+	kenda.FunctionOperationID_LIST_WORK_ORDERS_RATE: {
+		{Method: http.MethodGet, Path: "/work-orders-rate/department/{departmentID}"},
+		{Method: http.MethodGet, Path: "/work-orders-rate/department/{departmentID}/export"},
+	},
+
+	kenda.FunctionOperationID_MANAGE_ROLE_PERMISSIONS: {
+		{Method: http.MethodGet, Path: "/role-permissions"},
+		{Method: http.MethodPost, Path: "/role-permissions"},
+		{Method: http.MethodPut, Path: "/role-permissions/{functionOperationID}"},
+		{Method: http.MethodDelete, Path: "/role-permissions/{functionOperationID}"},
+		{Method: http.MethodGet, Path: "/role-permissions/{functionOperationID}/history"},
+	},
+
+	kenda.FunctionOperationID_LIST_USER_SESSIONS: {
+		{Method: http.MethodGet, Path: "/account/sessions/{employeeID}"},
+	},
+	kenda.FunctionOperationID_REVOKE_USER_SESSIONS: {
+		{Method: http.MethodDelete, Path: "/account/sessions/{employeeID}"},
+		{Method: http.MethodDelete, Path: "/account/sessions/{employeeID}/{sessionID}"},
+	},
+	kenda.FunctionOperationID_LIST_LOGIN_LOCKOUTS: {
+		{Method: http.MethodGet, Path: "/account/lockouts"},
+		{Method: http.MethodGet, Path: "/account/lockout-events"},
+	},
+	kenda.FunctionOperationID_UNLOCK_LOGIN_LOCKOUT: {
+		{Method: http.MethodDelete, Path: "/account/lockouts/{type}/{target}"},
+	},
+	kenda.FunctionOperationID_IMPORT_ACCOUNTS: {
+		{Method: http.MethodPost, Path: "/account/authorization/upload"},
+	},
+	kenda.FunctionOperationID_REVERSE_COLLECT: {
+		{Method: http.MethodPost, Path: "/production-flow/collect/work-order/{workOrderID}/sequence/{sequence}/reverse"},
+	},
+	kenda.FunctionOperationID_UNFEED: {
+		{Method: http.MethodPost, Path: "/production-flow/unfeed/work-order/{workOrderID}/batch/{batch}"},
+	},
+	kenda.FunctionOperationID_LIST_DEFECT_REASONS: {
+		{Method: http.MethodGet, Path: "/production-flow/defect-reasons"},
+	},
+	kenda.FunctionOperationID_CREATE_DEFECT_REASON: {
+		{Method: http.MethodPost, Path: "/production-flow/defect-reasons"},
+	},
+	kenda.FunctionOperationID_UPDATE_DEFECT_REASON: {
+		{Method: http.MethodPut, Path: "/production-flow/defect-reasons/{code}"},
+	},
+	kenda.FunctionOperationID_SYNC_OPERATIONS: {
+		{Method: http.MethodPost, Path: "/production-flow/sync"},
+	},
+	kenda.FunctionOperationID_GET_SCALE_WEIGHT: {
+		{Method: http.MethodGet, Path: "/production-flow/scale/station/{stationID}"},
+	},
+	kenda.FunctionOperationID_LIST_FEED_RECORDS: {
+		{Method: http.MethodGet, Path: "/production-flow/records/feed"},
+	},
+	kenda.FunctionOperationID_LIST_COLLECT_RECORDS: {
+		{Method: http.MethodGet, Path: "/production-flow/records/collect"},
+	},
+	kenda.FunctionOperationID_TRACE_RESOURCES: {
+		{Method: http.MethodGet, Path: "/production-flow/trace"},
+		{Method: http.MethodGet, Path: "/production-flow/trace/export"},
+	},
+	kenda.FunctionOperationID_CREATE_STATION_DOWNTIME: {
+		{Method: http.MethodPost, Path: "/station/{stationID}/downtime"},
+	},
+	kenda.FunctionOperationID_GET_STATION_OEE: {
+		{Method: http.MethodGet, Path: "/production-flow/oee"},
+	},
+	kenda.FunctionOperationID_SPLIT_WORK_ORDER: {
+		{Method: http.MethodPost, Path: "/work-orders/{id}/split"},
+	},
+	kenda.FunctionOperationID_MERGE_WORK_ORDERS: {
+		{Method: http.MethodPost, Path: "/work-orders/{id}/merge"},
+	},
+}
+
+// Routes returns the API routes guarded by the specified function operation ID.
+func Routes(id kenda.FunctionOperationID) []Route {
+	return functionRoutes[id]
+}
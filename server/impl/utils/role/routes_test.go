@@ -0,0 +1,21 @@
+package role
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"gitlab.kenda.com.tw/kenda/mui/server/protobuf/kenda"
+)
+
+func TestRoutes(t *testing.T) {
+	assert := assert.New(t)
+
+	// every function operation should guard at least one route.
+	for id, name := range kenda.FunctionOperationID_name {
+		assert.NotEmptyf(Routes(kenda.FunctionOperationID(id)), "missing routes of %s", name)
+	}
+
+	// unknown function operation.
+	assert.Empty(Routes(kenda.FunctionOperationID(-1)))
+}
@@ -0,0 +1,122 @@
+// Package saga runs a sequence of steps which can not be done in a single
+// transaction, and compensates the completed steps if any step fails.
+package saga
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Step is a step of a saga.
+type Step struct {
+	Name string
+	Do   func(ctx context.Context) error
+	// Compensate undoes the step after it was done, or nil if the step can not
+	// be undone.
+	Compensate func(ctx context.Context) error
+}
+
+// Error is returned by Run if a step fails.
+type Error struct {
+	// Step is the name of the failed step.
+	Step string
+	Err  error
+	// Compensated are the names of the completed steps which were undone.
+	Compensated []string
+	// Uncompensated are the names of the completed steps which could not be
+	// undone, including the ones whose compensation failed.
+	Uncompensated []string
+	// CompensationErrors are the errors of the failed compensations by the
+	// names of the steps.
+	CompensationErrors map[string]error
+}
+
+// Error implements error interface.
+func (e *Error) Error() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "step %s failed: %v", e.Step, e.Err)
+	if len(e.Compensated) > 0 {
+		fmt.Fprintf(&sb, "; compensated: %s", strings.Join(e.Compensated, ", "))
+	}
+	if len(e.Uncompensated) > 0 {
+		uncompensated := make([]string, len(e.Uncompensated))
+		for i, name := range e.Uncompensated {
+			uncompensated[i] = name
+			if err, ok := e.CompensationErrors[name]; ok {
+				uncompensated[i] = fmt.Sprintf("%s (%v)", name, err)
+			}
+		}
+		fmt.Fprintf(&sb, "; not compensated: %s", strings.Join(uncompensated, ", "))
+	}
+	return sb.String()
+}
+
+// Unwrap returns the error of the failed step.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// CompensationTimeout limits the time of all the compensations of a failed
+// saga.
+var CompensationTimeout = time.Minute
+
+// Run does the steps in order. If a step fails, the completed steps are
+// compensated in reverse order and an *Error is returned.
+//
+// The compensations are not canceled along with ctx, since a canceled request
+// is a common reason for the failure, but they are canceled after
+// CompensationTimeout.
+func Run(ctx context.Context, steps ...Step) error {
+	for i, step := range steps {
+		if err := step.Do(ctx); err != nil {
+			compensationCtx, cancel := context.WithTimeout(Detach(ctx), CompensationTimeout)
+			defer cancel()
+			return compensate(compensationCtx, steps[:i], &Error{
+				Step: step.Name,
+				Err:  err,
+			})
+		}
+	}
+	return nil
+}
+
+func compensate(ctx context.Context, done []Step, e *Error) *Error {
+	for i := len(done) - 1; i >= 0; i-- {
+		step := done[i]
+		if step.Compensate == nil {
+			e.Uncompensated = append(e.Uncompensated, step.Name)
+			continue
+		}
+		if err := step.Compensate(ctx); err != nil {
+			if e.CompensationErrors == nil {
+				e.CompensationErrors = make(map[string]error)
+			}
+			e.CompensationErrors[step.Name] = err
+			e.Uncompensated = append(e.Uncompensated, step.Name)
+			continue
+		}
+		e.Compensated = append(e.Compensated, step.Name)
+	}
+	return e
+}
+
+// detachedContext keeps the values of the parent but is never canceled.
+type detachedContext struct {
+	parent context.Context
+}
+
+// Detach returns a context which keeps the values of ctx but is never
+// canceled, by which the undoing of a canceled request still completes.
+func Detach(ctx context.Context) context.Context {
+	return detachedContext{parent: ctx}
+}
+
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+
+func (detachedContext) Done() <-chan struct{} { return nil }
+
+func (detachedContext) Err() error { return nil }
+
+func (c detachedContext) Value(key interface{}) interface{} { return c.parent.Value(key) }
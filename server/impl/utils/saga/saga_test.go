@@ -0,0 +1,94 @@
+package saga
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type ctxKey struct{}
+
+func TestRun(t *testing.T) {
+	assert := assert.New(t)
+
+	var done []string
+	step := func(name string, fail bool, compensate func(ctx context.Context) error) Step {
+		return Step{
+			Name: name,
+			Do: func(context.Context) error {
+				if fail {
+					return errors.New("failed")
+				}
+				done = append(done, name)
+				return nil
+			},
+			Compensate: compensate,
+		}
+	}
+	undo := func(name string) func(ctx context.Context) error {
+		return func(ctx context.Context) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if ctx.Value(ctxKey{}) == nil {
+				return errors.New("missing value")
+			}
+			done = append(done, "undo "+name)
+			return nil
+		}
+	}
+
+	{ // all done.
+		done = nil
+		assert.NoError(Run(context.Background(), step("A", false, undo("A")), step("B", false, undo("B"))))
+		assert.Equal([]string{"A", "B"}, done)
+	}
+	{ // compensated with a canceled context.
+		done = nil
+		ctx, cancel := context.WithCancel(context.WithValue(context.Background(), ctxKey{}, "v"))
+		cancel()
+
+		err := Run(ctx,
+			step("A", false, undo("A")),
+			step("B", false, nil),
+			step("C", false, func(context.Context) error { return errors.New("broken") }),
+			step("D", false, undo("D")),
+			step("E", true, undo("E")),
+			step("F", false, undo("F")),
+		)
+		assert.Equal([]string{"A", "B", "C", "D", "undo D", "undo A"}, done)
+
+		var e *Error
+		if assert.ErrorAs(err, &e) {
+			assert.Equal("E", e.Step)
+			assert.Equal([]string{"D", "A"}, e.Compensated)
+			assert.Equal([]string{"C", "B"}, e.Uncompensated)
+			assert.EqualError(err, "step E failed: failed; compensated: D, A; not compensated: C (broken), B")
+		}
+	}
+	{ // compensations timed out.
+		done = nil
+		timeout := CompensationTimeout
+		CompensationTimeout = time.Millisecond
+		defer func() { CompensationTimeout = timeout }()
+
+		err := Run(context.WithValue(context.Background(), ctxKey{}, "v"),
+			step("A", false, undo("A")),
+			step("B", false, func(ctx context.Context) error {
+				<-ctx.Done()
+				return ctx.Err()
+			}),
+			step("C", true, nil),
+		)
+		assert.EqualError(err, "step C failed: failed; not compensated: B (context deadline exceeded), A (context deadline exceeded)")
+	}
+	{ // first step failed.
+		done = nil
+		err := Run(context.Background(), step("A", true, undo("A")))
+		assert.EqualError(err, "step A failed: failed")
+		assert.Empty(done)
+	}
+}
@@ -0,0 +1,185 @@
+package scale
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/shopspring/decimal"
+)
+
+// Protocol parses the lines sent by the indicator of a scale.
+type Protocol interface {
+	// Request is the command asking the indicator for a weight, or nil if the
+	// indicator sends the weights continuously.
+	Request() []byte
+	// Parse parses a line without the line terminator. ok is false if the
+	// line is not a weight, e.g. an acknowledgement of a command.
+	Parse(line string) (r Reading, ok bool, err error)
+	// ReportsStability reports whether the indicator flags the stable weights,
+	// otherwise the weight is stable after the same consecutive readings.
+	ReportsStability() bool
+}
+
+// regexpPrefix is the prefix of the protocols defined by a regular expression.
+const regexpPrefix = "regexp:"
+
+// ParseProtocol returns the protocol by its name:
+//
+//   - and: the A&D format, e.g. "ST,GS,+00012.34  kg", sent continuously.
+//   - sics: the MT-SICS of Mettler Toledo, polled by "SI", e.g. "S S     12.34 kg".
+//   - plain: a number with an optional unit, e.g. "+12.34kg", sent continuously.
+//   - regexp:<expression>: a line matching the expression, sent continuously,
+//     with the named groups "weight", and optional "unit" and "stable". The
+//     weight is stable if the stable group matches a non-empty text.
+func ParseProtocol(name string) (Protocol, error) {
+	switch name {
+	case "and":
+		return andProtocol{}, nil
+	case "sics":
+		return sicsProtocol{}, nil
+	case "plain":
+		return newRegexpProtocol(`^\s*(?P<weight>[+-]?\s*[0-9]+(?:\.[0-9]+)?)\s*(?P<unit>[A-Za-z]*)\s*$`)
+	}
+	if strings.HasPrefix(name, regexpPrefix) {
+		return newRegexpProtocol(strings.TrimPrefix(name, regexpPrefix))
+	}
+	return nil, fmt.Errorf("unknown scale protocol: %q", name)
+}
+
+func parseWeight(s string) (decimal.Decimal, error) {
+	s = strings.ReplaceAll(s, " ", "")
+	weight, err := decimal.NewFromString(s)
+	if err != nil {
+		return decimal.Decimal{}, fmt.Errorf("invalid weight: %q", s)
+	}
+	return weight, nil
+}
+
+// andProtocol is the format of A&D indicators, "<header>,<type>,<weight><unit>"
+// where the header is ST (stable), US (unstable) or OL (overload), and the
+// type is GS (gross), NT (net) or TR (tare). The tares are not weights to be
+// read.
+type andProtocol struct{}
+
+func (andProtocol) Request() []byte { return nil }
+
+func (andProtocol) ReportsStability() bool { return true }
+
+func (andProtocol) Parse(line string) (Reading, bool, error) {
+	fields := strings.SplitN(strings.TrimSpace(line), ",", 3)
+	if len(fields) != 3 {
+		return Reading{}, false, nil
+	}
+	switch fields[0] {
+	case "ST", "US":
+	case "OL":
+		return Reading{}, false, ErrOverload
+	default:
+		return Reading{}, false, nil
+	}
+	if fields[1] == "TR" {
+		return Reading{}, false, nil
+	}
+
+	value := strings.TrimSpace(fields[2])
+	i := strings.LastIndexAny(value, "0123456789.")
+	if i < 0 {
+		return Reading{}, false, fmt.Errorf("invalid weight: %q", value)
+	}
+	weight, err := parseWeight(value[:i+1])
+	if err != nil {
+		return Reading{}, false, err
+	}
+	return Reading{
+		Weight: weight,
+		Unit:   strings.TrimSpace(value[i+1:]),
+		Stable: fields[0] == "ST",
+		Gross:  fields[1] == "GS",
+	}, true, nil
+}
+
+// sicsProtocol is the MT-SICS of Mettler Toledo, whose weight response is
+// "S <status> <weight> <unit>" where the status is S (stable) or D (dynamic).
+type sicsProtocol struct{}
+
+func (sicsProtocol) Request() []byte { return []byte("SI\r\n") }
+
+func (sicsProtocol) ReportsStability() bool { return true }
+
+func (sicsProtocol) Parse(line string) (Reading, bool, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 2 || fields[0] != "S" {
+		return Reading{}, false, nil
+	}
+	switch fields[1] {
+	case "S", "D":
+	case "+", "-":
+		return Reading{}, false, ErrOverload
+	default:
+		// "S I" is replied if the scale is busy.
+		return Reading{}, false, nil
+	}
+	if len(fields) < 3 {
+		return Reading{}, false, fmt.Errorf("invalid weight response: %q", line)
+	}
+	weight, err := parseWeight(fields[2])
+	if err != nil {
+		return Reading{}, false, err
+	}
+	r := Reading{
+		Weight: weight,
+		Stable: fields[1] == "S",
+	}
+	if len(fields) > 3 {
+		r.Unit = fields[3]
+	}
+	return r, true, nil
+}
+
+type regexpProtocol struct {
+	expr   *regexp.Regexp
+	weight int
+	unit   int
+	stable int
+}
+
+func newRegexpProtocol(expr string) (Protocol, error) {
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid scale protocol: %v", err)
+	}
+	p := regexpProtocol{
+		expr:   re,
+		weight: re.SubexpIndex("weight"),
+		unit:   re.SubexpIndex("unit"),
+		stable: re.SubexpIndex("stable"),
+	}
+	if p.weight < 0 {
+		return nil, fmt.Errorf("invalid scale protocol: missing the weight group in %q", expr)
+	}
+	return p, nil
+}
+
+func (regexpProtocol) Request() []byte { return nil }
+
+func (p regexpProtocol) ReportsStability() bool { return p.stable >= 0 }
+
+func (p regexpProtocol) Parse(line string) (Reading, bool, error) {
+	m := p.expr.FindStringSubmatch(line)
+	if m == nil {
+		return Reading{}, false, nil
+	}
+	weight, err := parseWeight(m[p.weight])
+	if err != nil {
+		return Reading{}, false, err
+	}
+	r := Reading{Weight: weight}
+	if p.unit >= 0 {
+		r.Unit = m[p.unit]
+	}
+	if p.stable >= 0 {
+		r.Stable = m[p.stable] != ""
+	}
+	return r, true, nil
+}
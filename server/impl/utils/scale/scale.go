@@ -0,0 +1,257 @@
+// Package scale reads the stable weights from the weighing scales connected
+// over TCP, including the indicators behind the serial-over-IP converters.
+package scale
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// Default settings used if the fields of Config are not set.
+const (
+	DefaultTimeout        = 5 * time.Second
+	DefaultStableReadings = 3
+)
+
+// Errors of reading a scale.
+var (
+	// ErrNoScale is returned if no scale is mapped to the station.
+	ErrNoScale = errors.New("no scale")
+	// ErrNotStable is returned if the weight is not stable before the timeout.
+	ErrNotStable = errors.New("weight not stable")
+	// ErrOverload is returned if the weight is out of the range of the scale.
+	ErrOverload = errors.New("scale overload")
+	// ErrGrossWeight is returned if the scale sends only the gross weights
+	// while the net weights are required.
+	ErrGrossWeight = errors.New("gross weight, tare the scale")
+	// ErrUnit is returned if a weight can not be converted to a unit.
+	ErrUnit = errors.New("unknown weight unit")
+)
+
+// kilograms are the weights of the units in kilograms.
+var kilograms = map[string]decimal.Decimal{
+	"kg": decimal.NewFromInt(1),
+	"g":  decimal.New(1, -3),
+	"lb": decimal.RequireFromString("0.45359237"),
+}
+
+// Convert converts the weight from a unit to another, the units are kg, g and
+// lb in any case. A weight without the unit is taken as in the target unit,
+// and the same units are not converted even if they are not known. The
+// converted weights are rounded to 6 decimal places.
+func Convert(weight decimal.Decimal, from, to string) (decimal.Decimal, error) {
+	from, to = strings.ToLower(strings.TrimSpace(from)), strings.ToLower(strings.TrimSpace(to))
+	if from == "" || from == to {
+		return weight, nil
+	}
+	fromKG, ok := kilograms[from]
+	if !ok {
+		return decimal.Decimal{}, fmt.Errorf("%w: %q", ErrUnit, from)
+	}
+	toKG, ok := kilograms[to]
+	if !ok {
+		return decimal.Decimal{}, fmt.Errorf("%w: %q", ErrUnit, to)
+	}
+	return weight.Mul(fromKG).Div(toKG).Round(6), nil
+}
+
+// Reading is a weight read from a scale.
+type Reading struct {
+	// Scale is the ID of the scale.
+	Scale  string
+	Weight decimal.Decimal
+	Unit   string
+	Stable bool
+	// Gross is true if the weight is flagged as the gross weight, i.e. with
+	// the tare.
+	Gross bool
+}
+
+// Config of a Scale.
+type Config struct {
+	ID string
+	// Address is the host:port of the scale.
+	Address  string
+	Protocol Protocol
+	// Stations are the stations where the scale is placed.
+	Stations []string
+	// Timeout of reading a stable weight.
+	Timeout time.Duration
+	// StableReadings is the number of the same consecutive readings by which
+	// the weight is stable if the protocol does not flag the stable weights.
+	StableReadings int
+	// NetWeight skips the gross weights if the protocol flags them, so the
+	// collected weights never include the tare.
+	NetWeight bool
+}
+
+// Scale reads the weights from a scale.
+type Scale struct {
+	config Config
+	dialer net.Dialer
+}
+
+// New returns a Scale with the defaults of the unset settings.
+func New(config Config) *Scale {
+	if config.Timeout <= 0 {
+		config.Timeout = DefaultTimeout
+	}
+	if config.StableReadings <= 0 {
+		config.StableReadings = DefaultStableReadings
+	}
+	return &Scale{config: config}
+}
+
+// Read returns the first stable weight read from the scale. A connection is
+// made for every reading, so the scale is free to the other clients, e.g. the
+// indicator software, between the readings.
+func (s *Scale) Read(ctx context.Context) (Reading, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.config.Timeout)
+	defer cancel()
+
+	conn, err := s.dialer.DialContext(ctx, "tcp", s.config.Address)
+	if err != nil {
+		return Reading{}, fmt.Errorf("scale %s: %w", s.config.ID, err)
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := conn.SetDeadline(deadline); err != nil {
+			return Reading{}, fmt.Errorf("scale %s: %w", s.config.ID, err)
+		}
+	}
+
+	r, err := s.read(conn)
+	if err != nil {
+		return Reading{}, fmt.Errorf("scale %s: %w", s.config.ID, err)
+	}
+	r.Scale = s.config.ID
+	return r, nil
+}
+
+func (s *Scale) read(conn net.Conn) (Reading, error) {
+	protocol := s.config.Protocol
+	request := protocol.Request()
+	scanner := bufio.NewScanner(conn)
+	scanner.Split(scanLines)
+
+	var (
+		last  Reading
+		count int
+		gross bool
+	)
+	for {
+		if request != nil {
+			if _, err := conn.Write(request); err != nil {
+				return Reading{}, err
+			}
+		}
+		r, err := s.next(scanner)
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				if count > 0 {
+					return Reading{}, ErrNotStable
+				}
+				if gross {
+					return Reading{}, ErrGrossWeight
+				}
+			}
+			return Reading{}, err
+		}
+		if s.config.NetWeight && r.Gross {
+			gross = true
+			continue
+		}
+
+		if protocol.ReportsStability() {
+			if r.Stable {
+				return r, nil
+			}
+			count++
+			continue
+		}
+		if count > 0 && r.Weight.Equal(last.Weight) && r.Unit == last.Unit {
+			count++
+		} else {
+			count = 1
+		}
+		last = r
+		if count >= s.config.StableReadings {
+			last.Stable = true
+			return last, nil
+		}
+	}
+}
+
+// next returns the next weight sent by the scale.
+func (s *Scale) next(scanner *bufio.Scanner) (Reading, error) {
+	for scanner.Scan() {
+		r, ok, err := s.config.Protocol.Parse(scanner.Text())
+		if err != nil {
+			return Reading{}, err
+		}
+		if ok {
+			return r, nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return Reading{}, err
+	}
+	return Reading{}, errors.New("connection closed")
+}
+
+// scanLines splits the data by CR, LF or CRLF, and skips the empty lines.
+func scanLines(data []byte, atEOF bool) (int, []byte, error) {
+	start := 0
+	for start < len(data) && (data[start] == '\r' || data[start] == '\n') {
+		start++
+	}
+	if i := bytes.IndexAny(data[start:], "\r\n"); i >= 0 {
+		return start + i + 1, data[start : start+i], nil
+	}
+	if atEOF && start < len(data) {
+		return len(data), data[start:], nil
+	}
+	return start, nil, nil
+}
+
+// Registry maps the stations to their scales.
+type Registry struct {
+	stations map[string]*Scale
+}
+
+// NewRegistry returns a Registry of the scales. A station can have only one
+// scale.
+func NewRegistry(configs []Config) (*Registry, error) {
+	r := &Registry{stations: make(map[string]*Scale)}
+	for _, config := range configs {
+		if config.Protocol == nil {
+			return nil, fmt.Errorf("missing protocol of scale %s", config.ID)
+		}
+		s := New(config)
+		for _, station := range config.Stations {
+			if other, ok := r.stations[station]; ok {
+				return nil, fmt.Errorf("station %s has both scale %s and %s", station, other.config.ID, config.ID)
+			}
+			r.stations[station] = s
+		}
+	}
+	return r, nil
+}
+
+// Read returns the stable weight read from the scale of the station.
+func (r *Registry) Read(ctx context.Context, station string) (Reading, error) {
+	s, ok := r.stations[station]
+	if !ok {
+		return Reading{}, fmt.Errorf("station %s: %w", station, ErrNoScale)
+	}
+	return s.Read(ctx)
+}
@@ -0,0 +1,236 @@
+package scale
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseProtocol(t *testing.T) {
+	tests := []struct {
+		protocol string
+		line     string
+		want     Reading
+		wantOK   bool
+		wantErr  error
+	}{
+		{protocol: "and", line: "ST,GS,+00012.34  kg", want: Reading{Weight: decimal.RequireFromString("12.34"), Unit: "kg", Stable: true, Gross: true}, wantOK: true},
+		{protocol: "and", line: "ST,TR,+00000.80  kg"},
+		{protocol: "and", line: "US,NT,-00001.50 kg", want: Reading{Weight: decimal.RequireFromString("-1.5"), Unit: "kg"}, wantOK: true},
+		{protocol: "and", line: "OL,GS,+9999999 kg", wantErr: ErrOverload},
+		{protocol: "and", line: "hello"},
+		{protocol: "sics", line: "S S      12.340 kg", want: Reading{Weight: decimal.RequireFromString("12.34"), Unit: "kg", Stable: true}, wantOK: true},
+		{protocol: "sics", line: "S D       2.5 g", want: Reading{Weight: decimal.RequireFromString("2.5"), Unit: "g"}, wantOK: true},
+		{protocol: "sics", line: "S I"},
+		{protocol: "sics", line: "S +", wantErr: ErrOverload},
+		{protocol: "sics", line: "ES"},
+		{protocol: "plain", line: " + 12.5kg", want: Reading{Weight: decimal.RequireFromString("12.5"), Unit: "kg"}, wantOK: true},
+		{protocol: "plain", line: "300", want: Reading{Weight: decimal.RequireFromString("300")}, wantOK: true},
+		{protocol: "plain", line: "weight?"},
+		{
+			protocol: `regexp:^(?P<stable>S)?\s*W=(?P<weight>[0-9.]+)$`,
+			line:     "S W=7.25",
+			want:     Reading{Weight: decimal.RequireFromString("7.25"), Stable: true},
+			wantOK:   true,
+		},
+		{
+			protocol: `regexp:^(?P<stable>S)?\s*W=(?P<weight>[0-9.]+)$`,
+			line:     "W=7.20",
+			want:     Reading{Weight: decimal.RequireFromString("7.2")},
+			wantOK:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.protocol+" "+tt.line, func(t *testing.T) {
+			p, err := ParseProtocol(tt.protocol)
+			assert.NoError(t, err)
+			got, ok, err := p.Parse(tt.line)
+			assert.Equal(t, tt.wantErr, err)
+			assert.Equal(t, tt.wantOK, ok)
+			if ok {
+				assert.True(t, tt.want.Weight.Equal(got.Weight), "weight %s", got.Weight)
+				assert.Equal(t, tt.want.Unit, got.Unit)
+				assert.Equal(t, tt.want.Stable, got.Stable)
+				assert.Equal(t, tt.want.Gross, got.Gross)
+			}
+		})
+	}
+
+	for _, name := range []string{"unknown", "regexp:(", `regexp:^(?P<value>[0-9]+)$`} {
+		_, err := ParseProtocol(name)
+		assert.Error(t, err, name)
+	}
+}
+
+// serve serves a scale stand-in on a local port, which writes the lines of
+// each connection after the request if any.
+func serve(t *testing.T, request string, lines ...string) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				for _, line := range lines {
+					if request != "" {
+						got, err := r.ReadString('\n')
+						if err != nil || got != request {
+							return
+						}
+					}
+					if _, err := conn.Write([]byte(line)); err != nil {
+						return
+					}
+				}
+				// keep the connection open until the client gives up.
+				_, _ = r.ReadByte()
+			}()
+		}
+	}()
+	return l.Addr().String()
+}
+
+func newTestScale(t *testing.T, protocol string, address string) *Scale {
+	return newNetScale(t, protocol, address, false)
+}
+
+func newNetScale(t *testing.T, protocol string, address string, net bool) *Scale {
+	p, err := ParseProtocol(protocol)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return New(Config{
+		ID:        "SCALE-1",
+		Address:   address,
+		Protocol:  p,
+		Timeout:   500 * time.Millisecond,
+		NetWeight: net,
+	})
+}
+
+func TestScale_Read(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	{ // continuous with the stable flag
+		address := serve(t, "", "US,GS,+00010.00 kg\r\n", "US,GS,+00012.00 kg\r\n", "ST,GS,+00012.30 kg\r\n")
+		got, err := newTestScale(t, "and", address).Read(ctx)
+		assert.NoError(err)
+		assert.Equal("SCALE-1", got.Scale)
+		assert.Equal("12.3", got.Weight.String())
+		assert.Equal("kg", got.Unit)
+		assert.True(got.Stable)
+	}
+	{ // polled
+		address := serve(t, "SI\r\n", "S D 1.0 kg\r\n", "S I\r\nS S 1.5 kg\r\n")
+		got, err := newTestScale(t, "sics", address).Read(ctx)
+		assert.NoError(err)
+		assert.Equal("1.5", got.Weight.String())
+	}
+	{ // stable by the same consecutive readings
+		address := serve(t, "", "5.0\n5.1\n", "5.1\n", "\r\n5.1\n")
+		got, err := newTestScale(t, "plain", address).Read(ctx)
+		assert.NoError(err)
+		assert.Equal("5.1", got.Weight.String())
+		assert.True(got.Stable)
+	}
+	{ // not stable
+		address := serve(t, "", "US,GS,+00010.00 kg\r\n")
+		_, err := newTestScale(t, "and", address).Read(ctx)
+		assert.True(errors.Is(err, ErrNotStable), "%v", err)
+	}
+	{ // net weight
+		address := serve(t, "", "ST,GS,+00012.30 kg\r\n", "ST,NT,+00011.50 kg\r\n")
+		got, err := newNetScale(t, "and", address, true).Read(ctx)
+		assert.NoError(err)
+		assert.Equal("11.5", got.Weight.String())
+		assert.False(got.Gross)
+	}
+	{ // gross weight only
+		address := serve(t, "", "ST,GS,+00012.30 kg\r\n")
+		_, err := newNetScale(t, "and", address, true).Read(ctx)
+		assert.True(errors.Is(err, ErrGrossWeight), "%v", err)
+	}
+	{ // overload
+		address := serve(t, "", "OL,GS,+9999999 kg\r\n")
+		_, err := newTestScale(t, "and", address).Read(ctx)
+		assert.True(errors.Is(err, ErrOverload), "%v", err)
+	}
+	{ // unreachable
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		assert.NoError(err)
+		address := l.Addr().String()
+		l.Close()
+		_, err = newTestScale(t, "and", address).Read(ctx)
+		assert.Error(err)
+	}
+}
+
+func TestConvert(t *testing.T) {
+	tests := []struct {
+		weight   string
+		from, to string
+		want     string
+		wantErr  bool
+	}{
+		{weight: "1.5", from: "kg", to: "KG", want: "1.5"},
+		{weight: "1.5", from: "", to: "g", want: "1.5"},
+		{weight: "1.5", from: "kg", to: "g", want: "1500"},
+		{weight: "250", from: "g", to: "kg", want: "0.25"},
+		{weight: "2", from: "lb", to: "kg", want: "0.907185"},
+		{weight: "1", from: "kg", to: "lb", want: "2.204623"},
+		{weight: "3", from: "pcs", to: "PCS", want: "3"},
+		{weight: "1", from: "kg", to: "PCS", wantErr: true},
+		{weight: "1", from: "oz", to: "kg", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.weight+tt.from+"->"+tt.to, func(t *testing.T) {
+			got, err := Convert(decimal.RequireFromString(tt.weight), tt.from, tt.to)
+			if tt.wantErr {
+				assert.True(t, errors.Is(err, ErrUnit), "%v", err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got.String())
+		})
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	assert := assert.New(t)
+	p, err := ParseProtocol("and")
+	assert.NoError(err)
+
+	_, err = NewRegistry([]Config{
+		{ID: "S1", Protocol: p, Stations: []string{"A"}},
+		{ID: "S2", Protocol: p, Stations: []string{"B", "A"}},
+	})
+	assert.EqualError(err, "station A has both scale S1 and S2")
+	_, err = NewRegistry([]Config{{ID: "S1", Stations: []string{"A"}}})
+	assert.EqualError(err, "missing protocol of scale S1")
+
+	address := serve(t, "", "ST,GS,+00001.00 kg\r\n")
+	r, err := NewRegistry([]Config{{ID: "S1", Address: address, Protocol: p, Stations: []string{"A"}}})
+	assert.NoError(err)
+	got, err := r.Read(context.Background(), "A")
+	assert.NoError(err)
+	assert.Equal("S1", got.Scale)
+	assert.Equal("1", got.Weight.String())
+
+	_, err = r.Read(context.Background(), "B")
+	assert.True(errors.Is(err, ErrNoScale))
+}
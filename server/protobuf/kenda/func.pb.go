@@ -93,6 +93,26 @@ const (
 	FunctionOperationID_MES_FEED                           FunctionOperationID = 69
 	FunctionOperationID_MES_COLLECT                        FunctionOperationID = 70
 	FunctionOperationID_LIST_WORK_ORDERS_RATE              FunctionOperationID = 71
+	FunctionOperationID_MANAGE_ROLE_PERMISSIONS            FunctionOperationID = 72
+	FunctionOperationID_LIST_USER_SESSIONS                 FunctionOperationID = 73
+	FunctionOperationID_REVOKE_USER_SESSIONS               FunctionOperationID = 74
+	FunctionOperationID_LIST_LOGIN_LOCKOUTS                FunctionOperationID = 75
+	FunctionOperationID_UNLOCK_LOGIN_LOCKOUT               FunctionOperationID = 76
+	FunctionOperationID_IMPORT_ACCOUNTS                    FunctionOperationID = 77
+	FunctionOperationID_REVERSE_COLLECT                    FunctionOperationID = 78
+	FunctionOperationID_UNFEED                             FunctionOperationID = 79
+	FunctionOperationID_LIST_DEFECT_REASONS                FunctionOperationID = 80
+	FunctionOperationID_CREATE_DEFECT_REASON               FunctionOperationID = 81
+	FunctionOperationID_UPDATE_DEFECT_REASON               FunctionOperationID = 82
+	FunctionOperationID_SYNC_OPERATIONS                    FunctionOperationID = 83
+	FunctionOperationID_GET_SCALE_WEIGHT                   FunctionOperationID = 84
+	FunctionOperationID_LIST_FEED_RECORDS                  FunctionOperationID = 85
+	FunctionOperationID_LIST_COLLECT_RECORDS               FunctionOperationID = 86
+	FunctionOperationID_TRACE_RESOURCES                    FunctionOperationID = 87
+	FunctionOperationID_CREATE_STATION_DOWNTIME            FunctionOperationID = 88
+	FunctionOperationID_GET_STATION_OEE                    FunctionOperationID = 89
+	FunctionOperationID_SPLIT_WORK_ORDER                   FunctionOperationID = 90
+	FunctionOperationID_MERGE_WORK_ORDERS                  FunctionOperationID = 91
 )
 
 var FunctionOperationID_name = map[int32]string{
@@ -164,6 +184,26 @@ var FunctionOperationID_name = map[int32]string{
 	69: "MES_FEED",
 	70: "MES_COLLECT",
 	71: "LIST_WORK_ORDERS_RATE",
+	72: "MANAGE_ROLE_PERMISSIONS",
+	73: "LIST_USER_SESSIONS",
+	74: "REVOKE_USER_SESSIONS",
+	75: "LIST_LOGIN_LOCKOUTS",
+	76: "UNLOCK_LOGIN_LOCKOUT",
+	77: "IMPORT_ACCOUNTS",
+	78: "REVERSE_COLLECT",
+	79: "UNFEED",
+	80: "LIST_DEFECT_REASONS",
+	81: "CREATE_DEFECT_REASON",
+	82: "UPDATE_DEFECT_REASON",
+	83: "SYNC_OPERATIONS",
+	84: "GET_SCALE_WEIGHT",
+	85: "LIST_FEED_RECORDS",
+	86: "LIST_COLLECT_RECORDS",
+	87: "TRACE_RESOURCES",
+	88: "CREATE_STATION_DOWNTIME",
+	89: "GET_STATION_OEE",
+	90: "SPLIT_WORK_ORDER",
+	91: "MERGE_WORK_ORDERS",
 }
 
 var FunctionOperationID_value = map[string]int32{
@@ -235,6 +275,26 @@ var FunctionOperationID_value = map[string]int32{
 	"MES_FEED":                           69,
 	"MES_COLLECT":                        70,
 	"LIST_WORK_ORDERS_RATE":              71,
+	"MANAGE_ROLE_PERMISSIONS":            72,
+	"LIST_USER_SESSIONS":                 73,
+	"REVOKE_USER_SESSIONS":               74,
+	"LIST_LOGIN_LOCKOUTS":                75,
+	"UNLOCK_LOGIN_LOCKOUT":               76,
+	"IMPORT_ACCOUNTS":                    77,
+	"REVERSE_COLLECT":                    78,
+	"UNFEED":                             79,
+	"LIST_DEFECT_REASONS":                80,
+	"CREATE_DEFECT_REASON":               81,
+	"UPDATE_DEFECT_REASON":               82,
+	"SYNC_OPERATIONS":                    83,
+	"GET_SCALE_WEIGHT":                   84,
+	"LIST_FEED_RECORDS":                  85,
+	"LIST_COLLECT_RECORDS":               86,
+	"TRACE_RESOURCES":                    87,
+	"CREATE_STATION_DOWNTIME":            88,
+	"GET_STATION_OEE":                    89,
+	"SPLIT_WORK_ORDER":                   90,
+	"MERGE_WORK_ORDERS":                  91,
 }
 
 func (x FunctionOperationID) String() string {
@@ -252,54 +312,66 @@ func init() {
 func init() { proto.RegisterFile("func.proto", fileDescriptor_6b1bdb44c2d3501c) }
 
 var fileDescriptor_6b1bdb44c2d3501c = []byte{
-	// 784 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x74, 0x55, 0xfb, 0x73, 0x1b, 0x35,
-	0x10, 0xe6, 0xd5, 0x52, 0xd4, 0xa4, 0xd9, 0xc8, 0x49, 0xdb, 0xa4, 0x69, 0x28, 0x01, 0x0a, 0x14,
-	0x28, 0x8f, 0xf2, 0x7e, 0xcb, 0xd2, 0xde, 0x59, 0xc3, 0x59, 0xba, 0x59, 0xe9, 0x30, 0xe1, 0x17,
-	0x4d, 0x29, 0x65, 0x86, 0x61, 0xc6, 0xe9, 0x74, 0xda, 0xff, 0x80, 0x3f, 0x9c, 0x59, 0xf9, 0xe4,
-	0xbb, 0xa6, 0xee, 0x4f, 0xb6, 0xbf, 0x6f, 0x57, 0xbb, 0xfb, 0xed, 0x27, 0x59, 0x88, 0xbf, 0x9f,
-	0x2e, 0x1f, 0xdc, 0x7d, 0xf4, 0xf8, 0xec, 0xc9, 0x99, 0xbc, 0xf0, 0xef, 0xc3, 0xe5, 0x5f, 0xf7,
-	0xef, 0xfc, 0xb7, 0x2d, 0x26, 0xd5, 0xd3, 0xe5, 0x83, 0x27, 0xff, 0x9c, 0x2d, 0xfd, 0xa3, 0x87,
-	0x8f, 0xef, 0xf3, 0x17, 0x6b, 0xe4, 0xbe, 0xd8, 0xad, 0x31, 0xa6, 0x80, 0xf4, 0x1b, 0x52, 0x0a,
-	0x51, 0xc5, 0x2e, 0xc0, 0x4b, 0x72, 0x4f, 0x00, 0xc3, 0x53, 0x45, 0xda, 0x1b, 0x4c, 0xd6, 0x55,
-	0x1e, 0x5e, 0x96, 0x52, 0x5c, 0xe9, 0x5a, 0xa3, 0x22, 0x16, 0x02, 0x5e, 0x91, 0x27, 0xe2, 0x98,
-	0x23, 0x9f, 0xc5, 0xfb, 0x83, 0x52, 0x63, 0x43, 0x84, 0x57, 0xe5, 0x44, 0xec, 0x70, 0x0c, 0xfe,
-	0x1e, 0xd1, 0x99, 0x64, 0xd4, 0x69, 0x80, 0xd7, 0xe4, 0x81, 0xd8, 0x67, 0x50, 0x7b, 0x17, 0xc9,
-	0x37, 0x49, 0x11, 0xaa, 0x55, 0xfc, 0x05, 0x79, 0x5d, 0xec, 0x31, 0x35, 0xf3, 0x8d, 0x49, 0x84,
-	0x2a, 0x78, 0xb7, 0x62, 0x2e, 0x96, 0xa4, 0x96, 0xbc, 0xe9, 0x74, 0x4c, 0xf1, 0xb4, 0xc5, 0x15,
-	0xf5, 0xba, 0x3c, 0x14, 0x57, 0xc7, 0x54, 0x4d, 0xbe, 0x6b, 0x57, 0xdc, 0xa5, 0x32, 0x4e, 0xe1,
-	0x32, 0xfa, 0x46, 0x69, 0x8b, 0x50, 0xdb, 0x72, 0x8c, 0x90, 0xbb, 0x62, 0x3b, 0x87, 0x36, 0xaa,
-	0x2f, 0x7a, 0x59, 0x6e, 0x89, 0x4b, 0xca, 0x98, 0x0c, 0xc1, 0x96, 0xbc, 0x29, 0x0e, 0x34, 0x21,
-	0x0f, 0xcb, 0x43, 0x5a, 0xef, 0x52, 0xd0, 0x33, 0x34, 0x5d, 0x63, 0x5d, 0x0d, 0xdb, 0xa5, 0x8d,
-	0x0d, 0xdc, 0x15, 0x4e, 0xed, 0x75, 0xda, 0x40, 0xef, 0x94, 0x2e, 0x0b, 0x97, 0xab, 0x83, 0x04,
-	0xb1, 0xc5, 0xd5, 0xe7, 0x2a, 0x22, 0x59, 0xd5, 0xc0, 0xae, 0xbc, 0x2a, 0x24, 0xc7, 0x2d, 0x14,
-	0xe1, 0xcc, 0x77, 0xa1, 0x5f, 0x8f, 0x64, 0x71, 0x06, 0x2c, 0x92, 0x72, 0x41, 0x69, 0x3e, 0x09,
-	0x26, 0xbc, 0xb9, 0xd1, 0xa8, 0xd6, 0x04, 0xd8, 0x93, 0x37, 0xc4, 0xb5, 0x11, 0xd6, 0x92, 0xd7,
-	0x18, 0xfa, 0x95, 0xed, 0xcb, 0x63, 0x71, 0xc8, 0x64, 0xa9, 0x9a, 0x08, 0x83, 0xef, 0x48, 0xf7,
-	0xb5, 0x0e, 0xd6, 0x63, 0xda, 0x88, 0x43, 0x50, 0xce, 0x3d, 0x64, 0x09, 0xa7, 0xd6, 0x99, 0x75,
-	0x0e, 0xdc, 0xe0, 0x8d, 0xea, 0x99, 0x72, 0x35, 0xa6, 0x2e, 0x20, 0xa5, 0x56, 0x85, 0xb0, 0xf0,
-	0x64, 0xe0, 0x88, 0xc7, 0xe3, 0xb4, 0xa4, 0x15, 0x91, 0x45, 0x82, 0x9b, 0xdc, 0x6b, 0x2f, 0x70,
-	0xc1, 0x8e, 0x47, 0xce, 0x2b, 0xd8, 0x9b, 0x8c, 0x19, 0x6c, 0x70, 0x84, 0xdd, 0x2a, 0xdb, 0x23,
-	0xdf, 0xf4, 0x0b, 0x7d, 0x8b, 0xc7, 0xcc, 0x05, 0x54, 0x17, 0x67, 0x9e, 0xec, 0x1f, 0x68, 0x92,
-	0xd2, 0xda, 0x77, 0x2e, 0xc2, 0x09, 0x6f, 0x24, 0x93, 0x9d, 0xdb, 0x40, 0xbf, 0x3d, 0x6a, 0xa5,
-	0x60, 0xef, 0x8c, 0x5a, 0x29, 0xd8, 0xbb, 0xa3, 0x56, 0x0a, 0x76, 0x9b, 0xb1, 0xac, 0xce, 0xe0,
-	0xd1, 0xf7, 0xf8, 0xb6, 0x65, 0x2c, 0x74, 0xd3, 0x01, 0x7e, 0x9f, 0xe1, 0xdc, 0x45, 0xd9, 0x7c,
-	0xd6, 0xf8, 0x83, 0x51, 0xf5, 0x9e, 0x80, 0x3b, 0xf2, 0x9a, 0x98, 0x9c, 0xb3, 0x50, 0x0e, 0xfe,
-	0x70, 0xd4, 0x42, 0x09, 0xfe, 0x88, 0x8d, 0xf2, 0xcc, 0xb9, 0xfc, 0x89, 0xf0, 0xb1, 0xbc, 0x2d,
-	0x4e, 0x5e, 0xbc, 0xdc, 0x34, 0x3d, 0xcd, 0x3d, 0xc3, 0x5d, 0xde, 0x5a, 0xce, 0x5f, 0x07, 0xf6,
-	0xef, 0xc3, 0x27, 0x79, 0xb8, 0xb6, 0xb1, 0x03, 0x05, 0x9f, 0xb2, 0x65, 0x8c, 0x5f, 0xb8, 0xc6,
-	0x2b, 0xf3, 0xfc, 0xd1, 0xf0, 0x99, 0x3c, 0x12, 0xd7, 0x7b, 0x0f, 0x2c, 0x3c, 0xfd, 0x9a, 0x3c,
-	0x99, 0xe1, 0xc5, 0xf9, 0x9c, 0xcd, 0x9f, 0x6b, 0x0d, 0x5c, 0x80, 0x7b, 0xc5, 0x86, 0xa3, 0x04,
-	0x6e, 0x91, 0xe6, 0xab, 0x09, 0xbf, 0x28, 0x2f, 0x45, 0x16, 0x75, 0xcc, 0x7c, 0x29, 0x77, 0xc4,
-	0x65, 0x66, 0xa2, 0xf7, 0x4d, 0xb2, 0x06, 0xbe, 0x62, 0xa3, 0x55, 0x88, 0x26, 0x69, 0xdf, 0x34,
-	0xa8, 0x23, 0x7c, 0xcd, 0x66, 0x19, 0xcb, 0x13, 0xe0, 0x1b, 0x56, 0x2c, 0x8c, 0xae, 0xa0, 0xf6,
-	0xae, 0xb2, 0x35, 0x7c, 0x5b, 0xae, 0xdc, 0x39, 0xfc, 0xbb, 0xe7, 0x15, 0xb6, 0x11, 0x03, 0x7c,
-	0xcf, 0xa6, 0x6b, 0xc9, 0xba, 0x0d, 0x1a, 0xc3, 0x0f, 0xbc, 0xc3, 0x9c, 0x64, 0xb0, 0x55, 0x14,
-	0xe7, 0xe8, 0x62, 0xbe, 0x91, 0x3f, 0xf2, 0x05, 0x2e, 0x07, 0x55, 0x9e, 0xf7, 0x11, 0x6c, 0xcd,
-	0x0b, 0x86, 0x9f, 0x58, 0x9e, 0xa1, 0x46, 0xed, 0x92, 0xef, 0x22, 0xfc, 0xbc, 0x1e, 0xbf, 0x67,
-	0x7c, 0x8b, 0xa4, 0xa2, 0x27, 0xf8, 0x85, 0x2d, 0xd5, 0xfb, 0x64, 0xd0, 0x0e, 0x94, 0xbc, 0x25,
-	0x8e, 0x7a, 0x4b, 0x8d, 0x74, 0x4e, 0x15, 0xf9, 0x79, 0xaa, 0x6c, 0x83, 0x30, 0xe5, 0xf7, 0x7c,
-	0xbd, 0xc5, 0x96, 0x70, 0xc3, 0x00, 0x9a, 0x1f, 0xc4, 0x39, 0x86, 0xc4, 0x72, 0x02, 0xb2, 0xd2,
-	0xfc, 0xab, 0xe8, 0x5a, 0xf1, 0x18, 0xe7, 0x57, 0x99, 0x88, 0x9d, 0x57, 0xff, 0x79, 0x31, 0xff,
-	0x29, 0xdd, 0xfb, 0x3f, 0x00, 0x00, 0xff, 0xff, 0x1d, 0x9b, 0x97, 0xd9, 0xa2, 0x06, 0x00, 0x00,
+	// 963 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x74, 0x56, 0x69, 0x73, 0x1c, 0x35,
+	0x10, 0xe5, 0x4a, 0x08, 0x8a, 0x13, 0xb7, 0x65, 0x3b, 0x89, 0x1d, 0xc7, 0x04, 0x03, 0x01, 0x02,
+	0x84, 0x23, 0xdc, 0xb7, 0x2c, 0xf5, 0xce, 0x0a, 0xcf, 0x48, 0x43, 0x4b, 0xe3, 0x8d, 0xc3, 0x07,
+	0x55, 0x08, 0xa1, 0x8a, 0xa2, 0xca, 0x4e, 0xa5, 0x92, 0x1f, 0xcb, 0xbf, 0xa1, 0x5a, 0x3b, 0x9a,
+	0x1d, 0xdb, 0xcb, 0x27, 0xef, 0xbe, 0x27, 0xa9, 0xbb, 0xdf, 0xeb, 0xee, 0xb5, 0x10, 0x7f, 0xbd,
+	0x38, 0x7e, 0x7c, 0xef, 0xe9, 0xb3, 0x93, 0xe7, 0x27, 0xf2, 0xc2, 0x3f, 0x4f, 0x8e, 0xff, 0x7c,
+	0x74, 0xf7, 0x5f, 0x10, 0xeb, 0x93, 0x17, 0xc7, 0x8f, 0x9f, 0xff, 0x7d, 0x72, 0xec, 0x9f, 0x3e,
+	0x79, 0xf6, 0x88, 0x3f, 0x58, 0x23, 0x37, 0xc5, 0x5a, 0x85, 0x31, 0x05, 0xa4, 0x43, 0xa4, 0x14,
+	0xa2, 0x8a, 0x5d, 0x80, 0x97, 0xe4, 0x86, 0x00, 0x86, 0xf7, 0x15, 0x69, 0x6f, 0x30, 0x59, 0x37,
+	0xf1, 0xf0, 0xb2, 0x94, 0xe2, 0x6a, 0xd7, 0x1a, 0x15, 0xb1, 0x10, 0xf0, 0x8a, 0xdc, 0x13, 0xbb,
+	0x7c, 0xf2, 0x34, 0xde, 0x3f, 0x94, 0x6a, 0x1b, 0x22, 0xbc, 0x2a, 0xd7, 0xc5, 0x2a, 0x9f, 0xc1,
+	0x07, 0x11, 0x9d, 0x49, 0x46, 0x1d, 0x05, 0x78, 0x4d, 0x6e, 0x89, 0x4d, 0x06, 0xb5, 0x77, 0x91,
+	0x7c, 0x9d, 0x14, 0xa1, 0x9a, 0x9f, 0xbf, 0x20, 0x6f, 0x88, 0x0d, 0xa6, 0xa6, 0xbe, 0x36, 0x89,
+	0x50, 0x05, 0xef, 0xe6, 0xcc, 0xc5, 0x72, 0xa9, 0x25, 0x6f, 0x3a, 0x1d, 0x53, 0x3c, 0x6a, 0x71,
+	0x4e, 0xbd, 0x2e, 0xb7, 0xc5, 0xb5, 0x31, 0x55, 0x91, 0xef, 0xda, 0x39, 0x77, 0xa9, 0x94, 0x53,
+	0xb8, 0x8c, 0xbe, 0x51, 0xd2, 0x22, 0xd4, 0xb6, 0x3c, 0x23, 0xe4, 0x9a, 0xb8, 0x92, 0x8f, 0xd6,
+	0xaa, 0x0f, 0x7a, 0x59, 0xae, 0x88, 0x4b, 0xca, 0x98, 0x0c, 0xc1, 0x8a, 0xbc, 0x25, 0xb6, 0x34,
+	0xa1, 0x8a, 0xf3, 0x22, 0xad, 0x77, 0x29, 0xe8, 0x29, 0x9a, 0xae, 0xb6, 0xae, 0x82, 0x2b, 0x25,
+	0x8d, 0x25, 0xdc, 0x55, 0xbe, 0xda, 0xeb, 0xb4, 0x84, 0x5e, 0x2d, 0x59, 0x16, 0x2e, 0x47, 0x07,
+	0x09, 0x62, 0x85, 0xa3, 0x37, 0x2a, 0x22, 0x59, 0x55, 0xc3, 0x9a, 0xbc, 0x26, 0x24, 0x9f, 0x9b,
+	0x29, 0xc2, 0xa9, 0xef, 0x42, 0x6f, 0x8f, 0x64, 0x71, 0x16, 0x58, 0x24, 0xe5, 0x82, 0xd2, 0xfc,
+	0x12, 0xac, 0xb3, 0x73, 0xa3, 0x52, 0xad, 0x09, 0xb0, 0x21, 0x6f, 0x8a, 0xeb, 0x23, 0xac, 0x25,
+	0xaf, 0x31, 0xf4, 0x96, 0x6d, 0xca, 0x5d, 0xb1, 0xcd, 0x64, 0x89, 0x9a, 0x08, 0x83, 0xef, 0x48,
+	0xf7, 0xb1, 0xb6, 0x86, 0x32, 0x6d, 0xc4, 0xc5, 0xa1, 0x7c, 0x77, 0x9b, 0x25, 0xdc, 0xb7, 0xce,
+	0x0c, 0x77, 0xe0, 0x26, 0x3b, 0xaa, 0xa7, 0xca, 0x55, 0x98, 0xba, 0x80, 0x94, 0x5a, 0x15, 0xc2,
+	0xcc, 0x93, 0x81, 0x1d, 0x2e, 0x8f, 0xaf, 0x25, 0xad, 0x88, 0x2c, 0x12, 0xdc, 0xe2, 0x5c, 0x7b,
+	0x81, 0x0b, 0xb6, 0x3b, 0xea, 0xbc, 0x82, 0xbd, 0xc9, 0x98, 0xc1, 0x1a, 0x47, 0xd8, 0xed, 0xe2,
+	0x1e, 0xf9, 0xba, 0x37, 0xf4, 0x2d, 0x2e, 0x33, 0x07, 0x50, 0x5d, 0x9c, 0x7a, 0xb2, 0x0f, 0xd1,
+	0x24, 0xa5, 0xb5, 0xef, 0x5c, 0x84, 0x3d, 0x76, 0x24, 0x93, 0x9d, 0x5b, 0x42, 0xbf, 0x3d, 0x4a,
+	0xa5, 0x60, 0xef, 0x8c, 0x52, 0x29, 0xd8, 0xbb, 0xa3, 0x54, 0x0a, 0x76, 0x87, 0xb1, 0xac, 0xce,
+	0xa2, 0x47, 0xdf, 0xe3, 0x69, 0xcb, 0x58, 0xe8, 0xf6, 0x17, 0xf0, 0xfb, 0x0c, 0xf3, 0xa7, 0xc1,
+	0xf9, 0xac, 0xf1, 0x07, 0xa3, 0xe8, 0x3d, 0x01, 0x77, 0xe5, 0x75, 0xb1, 0x7e, 0xa6, 0x85, 0xf2,
+	0xe1, 0x0f, 0x47, 0x29, 0x94, 0xc3, 0x1f, 0x71, 0xa3, 0x9c, 0x7a, 0x97, 0xff, 0x22, 0x7c, 0x2c,
+	0xef, 0x88, 0xbd, 0xff, 0x37, 0x37, 0xed, 0x1f, 0xe5, 0x9c, 0xe1, 0x1e, 0xbb, 0x96, 0xef, 0x0f,
+	0x07, 0xfb, 0xfd, 0xf0, 0x49, 0x2e, 0xae, 0xad, 0xed, 0x82, 0x82, 0x4f, 0xb9, 0x65, 0x8c, 0x9f,
+	0xb9, 0xda, 0x2b, 0x73, 0xfe, 0x69, 0xf8, 0x4c, 0xee, 0x88, 0x1b, 0x7d, 0x0f, 0xcc, 0x3c, 0x1d,
+	0x24, 0x4f, 0x66, 0xb1, 0x71, 0x3e, 0xe7, 0xe6, 0xcf, 0xb1, 0x16, 0x5c, 0x80, 0xfb, 0xa5, 0x0d,
+	0x47, 0x17, 0x38, 0x45, 0x6a, 0xe6, 0x15, 0x7e, 0x51, 0x36, 0x45, 0x16, 0x75, 0xcc, 0x7c, 0x29,
+	0x57, 0xc5, 0x65, 0x66, 0xa2, 0xf7, 0x75, 0xb2, 0x06, 0xbe, 0xe2, 0x46, 0x9b, 0x20, 0x9a, 0xa4,
+	0x7d, 0x5d, 0xa3, 0x8e, 0xf0, 0x35, 0x37, 0xcb, 0x58, 0x9e, 0x00, 0xdf, 0xb0, 0x62, 0x61, 0x34,
+	0x82, 0xda, 0xbb, 0x89, 0xad, 0xe0, 0xdb, 0x32, 0x72, 0x67, 0xf0, 0xef, 0xce, 0x2b, 0x6c, 0x23,
+	0x06, 0xf8, 0x9e, 0x9b, 0xae, 0x25, 0xeb, 0x96, 0x68, 0x0c, 0x3f, 0xb0, 0x87, 0xf9, 0x92, 0xc1,
+	0x56, 0x51, 0x6c, 0xd0, 0xc5, 0x3c, 0x91, 0x3f, 0xf2, 0x00, 0x97, 0x87, 0x26, 0x9e, 0xfd, 0x08,
+	0xb6, 0x62, 0x83, 0xe1, 0x27, 0x96, 0x67, 0x11, 0xa3, 0x72, 0xc9, 0x77, 0x11, 0x7e, 0x1e, 0xca,
+	0xef, 0x19, 0xdf, 0x22, 0xa9, 0xe8, 0x09, 0x7e, 0xe1, 0x96, 0xea, 0xfb, 0x64, 0xa1, 0x1d, 0x28,
+	0x79, 0x5b, 0xec, 0xf4, 0x2d, 0xb5, 0x80, 0x43, 0x9a, 0x90, 0x6f, 0xd2, 0xc4, 0xd6, 0x08, 0xfb,
+	0xbc, 0xcf, 0x07, 0x17, 0x5b, 0xc2, 0x25, 0x05, 0x68, 0x5e, 0x88, 0x0d, 0x86, 0xc4, 0x72, 0x02,
+	0xb2, 0xd2, 0xfc, 0xad, 0xe8, 0x3a, 0xe1, 0x32, 0xce, 0x5a, 0x99, 0x88, 0x3b, 0xaf, 0x62, 0x5d,
+	0x1a, 0xe5, 0x54, 0x85, 0xf3, 0x11, 0x6d, 0x91, 0x1a, 0x1b, 0x42, 0x16, 0x7f, 0x3a, 0x88, 0x99,
+	0x57, 0x44, 0xc0, 0x1e, 0xb7, 0x5c, 0x25, 0xe1, 0xa1, 0x3f, 0xc0, 0x33, 0xcc, 0xaf, 0x83, 0x92,
+	0xb5, 0xaf, 0xac, 0x4b, 0xb5, 0xd7, 0x07, 0xbe, 0x8b, 0x01, 0x0e, 0xf8, 0x4a, 0xe7, 0xf8, 0xfb,
+	0x69, 0x0a, 0x6a, 0x5e, 0xfa, 0xb6, 0x69, 0x3d, 0xc5, 0x32, 0xaa, 0x01, 0x1a, 0x06, 0x09, 0x0f,
+	0x91, 0x02, 0x0e, 0x65, 0x38, 0x29, 0xc4, 0xc5, 0xce, 0xe5, 0x1a, 0xfd, 0xc8, 0xb2, 0x09, 0xea,
+	0xd8, 0xff, 0x28, 0x05, 0x68, 0xf3, 0x62, 0x9b, 0x0b, 0x7a, 0x8a, 0x82, 0xdf, 0x72, 0x0a, 0xad,
+	0x39, 0xcf, 0x10, 0x47, 0x0b, 0x47, 0x4e, 0xf7, 0x76, 0xe5, 0x52, 0xc2, 0xb0, 0xfc, 0xb5, 0xaa,
+	0x31, 0xcd, 0xd0, 0x56, 0xd3, 0x08, 0x71, 0xd8, 0x0c, 0xb9, 0x73, 0x09, 0xb5, 0x27, 0x13, 0xa0,
+	0x1b, 0x06, 0xb3, 0x4f, 0x76, 0x60, 0x0e, 0xf9, 0xed, 0x48, 0x4a, 0xe3, 0x60, 0x57, 0x80, 0x19,
+	0xab, 0x7e, 0xe6, 0x27, 0x8b, 0x2d, 0x8e, 0xb6, 0x41, 0x78, 0x50, 0x7e, 0x05, 0x0b, 0xe3, 0x11,
+	0xe1, 0x28, 0xb7, 0x5b, 0x9e, 0xef, 0x51, 0xf7, 0x3c, 0xe4, 0x6c, 0x1a, 0xa4, 0x53, 0x03, 0x1c,
+	0xe0, 0xf7, 0x3f, 0x2e, 0xe6, 0xff, 0x34, 0xee, 0xff, 0x37, 0x00, 0x6a, 0xdd, 0x40, 0x76, 0x77,
+	0x08, 0x00, 0x00,
 }
@@ -3,6 +3,13 @@ package server
 import (
 	"context"
 	"errors"
+	"net"
+	"net/url"
+	"strconv"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
 
 	"gitlab.kenda.com.tw/kenda/mcom"
 	mcomImpl "gitlab.kenda.com.tw/kenda/mcom/impl"
@@ -45,3 +52,21 @@ func RegisterDataManager(configs configs.Configs) (mcom.DataManager, error) {
 		options...,
 	)
 }
+
+// RegisterDatabase connects to the database storing the data maintained by MUI
+// itself, which shares the same PostgreSQL schema with the data manager.
+func RegisterDatabase(configs configs.Configs) (*gorm.DB, error) {
+	dsn := url.URL{
+		Scheme: "postgres",
+		User:   url.UserPassword(configs.PostgreSQL.UserName, configs.PostgreSQL.Password),
+		Host:   net.JoinHostPort(configs.PostgreSQL.Address, strconv.Itoa(configs.PostgreSQL.Port)),
+		Path:   configs.PostgreSQL.Name,
+	}
+	if configs.PostgreSQL.Schema != "" {
+		dsn.RawQuery = url.Values{"search_path": {configs.PostgreSQL.Schema}}.Encode()
+	}
+
+	return gorm.Open(postgres.Open(dsn.String()), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+}
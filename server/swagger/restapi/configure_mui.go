@@ -3,7 +3,9 @@
 package restapi
 
 import (
+	"context"
 	"crypto/tls"
+	stdErrors "errors"
 	"fmt"
 	"io/ioutil"
 	"log"
@@ -13,21 +15,33 @@ import (
 	"time"
 
 	"github.com/go-openapi/errors"
+	"github.com/go-openapi/loads"
 	"github.com/go-openapi/runtime"
 	"github.com/go-openapi/swag"
 	"github.com/gorilla/handlers"
 	"github.com/rs/cors"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
-	"gopkg.in/yaml.v2"
+	"gorm.io/gorm"
 
 	"gitlab.kenda.com.tw/kenda/mcom"
+	mcomErrors "gitlab.kenda.com.tw/kenda/mcom/errors"
+	mcomRoles "gitlab.kenda.com.tw/kenda/mcom/utils/roles"
 
 	"gitlab.kenda.com.tw/kenda/mui/server"
 	"gitlab.kenda.com.tw/kenda/mui/server/configs"
+	"gitlab.kenda.com.tw/kenda/mui/server/database"
 	mcomImpl "gitlab.kenda.com.tw/kenda/mui/server/impl/handlers/mcom"
+	handlerUtils "gitlab.kenda.com.tw/kenda/mui/server/impl/handlers/mcom/utils"
+	"gitlab.kenda.com.tw/kenda/mui/server/impl/utils/idrule"
+	"gitlab.kenda.com.tw/kenda/mui/server/impl/utils/lockout"
+	"gitlab.kenda.com.tw/kenda/mui/server/impl/utils/oee"
+	"gitlab.kenda.com.tw/kenda/mui/server/impl/utils/password"
+	"gitlab.kenda.com.tw/kenda/mui/server/impl/utils/plant"
 	"gitlab.kenda.com.tw/kenda/mui/server/impl/utils/role"
+	"gitlab.kenda.com.tw/kenda/mui/server/impl/utils/scale"
 	"gitlab.kenda.com.tw/kenda/mui/server/middleware"
+	"gitlab.kenda.com.tw/kenda/mui/server/protobuf/kenda"
 	"gitlab.kenda.com.tw/kenda/mui/server/swagger/restapi/operations"
 )
 
@@ -50,12 +64,7 @@ func parseConfigurations(filePath string) (*configs.Configs, error) {
 		return nil, err
 	}
 
-	var cfgs configs.Configs
-	if err := yaml.UnmarshalStrict(configsFile, &cfgs); err != nil {
-		return nil, err
-	}
-
-	return &cfgs, nil
+	return configs.Load(configsFile)
 }
 
 func configureAPI(api *operations.MuiAPI) http.Handler {
@@ -65,11 +74,160 @@ func configureAPI(api *operations.MuiAPI) http.Handler {
 	if err != nil {
 		log.Fatalf("failed to parse configurations file. err= %s", err.Error())
 	}
+	if options.CheckConfig {
+		os.Exit(checkConfigurations(*configurations))
+	}
 
 	setLogger(configurations.DevMode) // api.Logger will be using log.Printf
 
-	if err := role.InitPermission(configurations.FunctionRolePermissions); err != nil {
-		zap.L().Fatal("failed to initialize permission", zap.Error(err))
+	passwordPolicy := password.Policy{
+		MinLength:        configurations.PasswordPolicy.MinLength,
+		RequireUppercase: configurations.PasswordPolicy.RequireUppercase,
+		RequireLowercase: configurations.PasswordPolicy.RequireLowercase,
+		RequireDigit:     configurations.PasswordPolicy.RequireDigit,
+		RequireSymbol:    configurations.PasswordPolicy.RequireSymbol,
+		History:          configurations.PasswordPolicy.History,
+		MaxAge:           configurations.PasswordPolicy.MaxAge,
+	}
+
+	// [NOTE] if you want try a test without real api, please switch import path from `/server/impl/mcom` to `/server/impl/mock`
+	serviceConfig := mcomImpl.ServiceConfig{
+		TokenLifeTime:  time.Duration(configurations.TokenExpiredSeconds) * time.Second,
+		FontPath:       configurations.FontPath,
+		PasswordPolicy: passwordPolicy,
+	}
+
+	var (
+		handler http.Handler
+		plants  []*plantAPI
+	)
+	if len(configurations.Plants) == 0 {
+		db, err := server.RegisterDatabase(*configurations)
+		if err != nil {
+			zap.L().Fatal("failed to register database", zap.Error(err))
+		}
+		p := configurePlantAPI(api, *configurations, db, serviceConfig, configs.Check)
+		handler = p.handler
+		plants = append(plants, p)
+	} else {
+		// the shared sections are checked once here, and the inherited ones by
+		// every plant with its own stations.
+		if report := configs.Check(context.Background(), *configurations, newCheckOptions(nil)); !logCheckReport(report) {
+			zap.L().Fatal("invalid configurations, run with --check-config for the full report")
+		}
+
+		spec, err := loads.Analyzed(SwaggerJSON, "")
+		if err != nil {
+			zap.L().Fatal("failed to load swagger spec", zap.Error(err))
+		}
+		routes := make([]plant.Plant, len(configurations.Plants))
+		for i, cfg := range configurations.Plants {
+			plantConfigs := configurations.ForPlant(cfg)
+			plantDB, err := server.RegisterDatabase(plantConfigs)
+			if err != nil {
+				zap.L().Fatal("failed to register database", zap.String("plant", cfg.Name), zap.Error(err))
+			}
+
+			p := configurePlantAPI(operations.NewMuiAPI(spec), plantConfigs, plantDB, serviceConfig, configs.CheckPlant)
+			plants = append(plants, p)
+			routes[i] = plant.Plant{
+				Name:        cfg.Name,
+				Departments: cfg.Departments,
+				Handler:     p.handler,
+				LookupToken: p.lookupToken,
+			}
+		}
+		if handler, err = plant.NewRouter(routes); err != nil {
+			zap.L().Fatal("failed to route plants", zap.Error(err))
+		}
+	}
+
+	// Protected data endpoints
+	// api.ProtectedGetDataHandler = protected.GetDataHandlerFunc(protectedImpl.GetData)
+
+	api.PreServerShutdown = func() {}
+
+	api.ServerShutdown = func() {
+		zap.L().Info("Closing DataManager Services...")
+		for _, p := range plants {
+			p.close()
+		}
+	}
+
+	return setupGlobalMiddleware(api.Context().BasePath(), handler, configurations.CorsAllowedOrigins)
+}
+
+// plantAPI is the API of a plant, or the only one if the multi-plant mode is
+// not enabled.
+type plantAPI struct {
+	handler  http.Handler
+	dm       mcom.DataManager
+	sessions database.SessionStore
+	db       *gorm.DB
+	// stopWatch stops watching the permission changes of the other replicas.
+	stopWatch context.CancelFunc
+}
+
+// configurePlantAPI registers the handlers of the plant to the api, and the
+// stores of the plant, including the role permissions, are kept in db. The
+// configurations are checked by check before any handler is registered.
+func configurePlantAPI(api *operations.MuiAPI, cfgs configs.Configs, db *gorm.DB, serviceConfig mcomImpl.ServiceConfig,
+	check func(context.Context, configs.Configs, configs.CheckOptions) configs.Report) *plantAPI {
+	sessionStore, err := database.NewSessionStore(db)
+	if err != nil {
+		zap.L().Fatal("failed to initialize session store", zap.Error(err))
+	}
+	lockoutEventStore, err := database.NewLockoutEventStore(db)
+	if err != nil {
+		zap.L().Fatal("failed to initialize lockout event store", zap.Error(err))
+	}
+	loginFailureStore, err := database.NewLoginFailureStore(db)
+	if err != nil {
+		zap.L().Fatal("failed to initialize login failure store", zap.Error(err))
+	}
+	passwordStore, err := database.NewPasswordStore(db)
+	if err != nil {
+		zap.L().Fatal("failed to initialize password store", zap.Error(err))
+	}
+	collectStore, err := database.NewCollectStore(db)
+	if err != nil {
+		zap.L().Fatal("failed to initialize collect store", zap.Error(err))
+	}
+	feedStore, err := database.NewFeedStore(db)
+	if err != nil {
+		zap.L().Fatal("failed to initialize feed store", zap.Error(err))
+	}
+	defectStore, err := database.NewDefectStore(db)
+	if err != nil {
+		zap.L().Fatal("failed to initialize defect store", zap.Error(err))
+	}
+	syncStore, err := database.NewSyncStore(db)
+	if err != nil {
+		zap.L().Fatal("failed to initialize sync store", zap.Error(err))
+	}
+	counterStore, err := database.NewCounterStore(db)
+	if err != nil {
+		zap.L().Fatal("failed to initialize counter store", zap.Error(err))
+	}
+	holdStore, err := database.NewHoldStore(db)
+	if err != nil {
+		zap.L().Fatal("failed to initialize hold store", zap.Error(err))
+	}
+	recordStore, err := database.NewRecordStore(db)
+	if err != nil {
+		zap.L().Fatal("failed to initialize record store", zap.Error(err))
+	}
+	stationLogStore, err := database.NewStationLogStore(db)
+	if err != nil {
+		zap.L().Fatal("failed to initialize station log store", zap.Error(err))
+	}
+	workOrderImportStore, err := database.NewWorkOrderImportStore(db)
+	if err != nil {
+		zap.L().Fatal("failed to initialize work order import store", zap.Error(err))
+	}
+	workOrderStore, err := database.NewWorkOrderStore(db)
+	if err != nil {
+		zap.L().Fatal("failed to initialize work order store", zap.Error(err))
 	}
 
 	api.ServeError = errors.ServeError
@@ -77,37 +235,262 @@ func configureAPI(api *operations.MuiAPI) http.Handler {
 	api.JSONConsumer = runtime.JSONConsumer()
 	api.JSONProducer = runtime.JSONProducer()
 
-	dm, err := server.RegisterDataManager(*configurations)
+	dm, err := server.RegisterDataManager(cfgs)
 	if err != nil {
 		zap.L().Fatal("failed to register data manager", zap.Error(err))
 	}
+	if report := check(context.Background(), cfgs, newCheckOptions(dm)); !logCheckReport(report) {
+		zap.L().Fatal("invalid configurations, run with --check-config for the full report")
+	}
 
-	// [NOTE] if you want try a test without real api, please switch import path from `/server/impl/mcom` to `/server/impl/mock`
-	serviceConfig := mcomImpl.ServiceConfig{
-		TokenLifeTime:         time.Duration(configurations.TokenExpiredSeconds) * time.Second,
-		Printers:              configurations.Printers,
-		FontPath:              configurations.FontPath,
-		StationFunctionConfig: configurations.StationFunctionConfig,
-		MesPath:               configurations.MesPath,
+	// the permissions of configurations are only used to seed the database
+	// of every plant.
+	permissionStore, err := database.NewPermissionStore(db)
+	if err != nil {
+		zap.L().Fatal("failed to initialize permission store", zap.Error(err))
+	}
+	serviceConfig.PermissionManager, err = role.NewManager(context.Background(), permissionStore, cfgs.FunctionRolePermissions)
+	if err != nil {
+		zap.L().Fatal("failed to initialize permission", zap.Error(err))
+	}
+	// the permissions changed by the other replicas are loaded in the background.
+	watchCtx, stopWatch := context.WithCancel(context.Background())
+	go serviceConfig.PermissionManager.Watch(watchCtx, role.WatchInterval)
+
+	serviceConfig.Printers = cfgs.Printers
+	serviceConfig.StationFunctionConfig = cfgs.StationFunctionConfig
+	serviceConfig.MesPath = cfgs.MesPath
+	serviceConfig.SessionStore = sessionStore
+	loginProtection := cfgs.LoginProtection
+	serviceConfig.LoginLockouts = lockout.NewTracker(lockout.Config{
+		MaxAccountFailures: loginProtection.MaxAccountFailures,
+		MaxIPFailures:      loginProtection.MaxIPFailures,
+		LockoutDuration:    loginProtection.LockoutDuration,
+		FailureWindow:      loginProtection.FailureWindow,
+		Delay:              loginProtection.Delay,
+		MaxDelay:           loginProtection.MaxDelay,
+	}, loginFailureStore)
+	serviceConfig.LockoutEventStore = lockoutEventStore
+	serviceConfig.TrustedProxies, err = handlerUtils.ParseTrustedProxies(cfgs.TrustedProxies)
+	if err != nil {
+		zap.L().Fatal("failed to parse trusted proxies", zap.Error(err))
+	}
+	serviceConfig.PasswordStore = passwordStore
+	serviceConfig.CollectStore = collectStore
+	serviceConfig.FeedStore = feedStore
+	serviceConfig.DefectStore = defectStore
+	serviceConfig.SyncStore = syncStore
+	serviceConfig.HoldStore = holdStore
+	serviceConfig.RecordStore = recordStore
+	serviceConfig.StationLogStore = stationLogStore
+	serviceConfig.WorkOrderImportStore = workOrderImportStore
+	serviceConfig.WorkOrderStore = workOrderStore
+	serviceConfig.CycleTimeControl = cfgs.OEE.CycleTimeControl
+	serviceConfig.IDRules, err = idrule.NewGenerator(idrule.Config{
+		Default:      idPatterns(cfgs.IDRules.Default),
+		Stations:     idPatternsMap(cfgs.IDRules.Stations),
+		ProductTypes: idPatternsMap(cfgs.IDRules.ProductTypes),
+	}, counterStore)
+	if err != nil {
+		zap.L().Fatal("failed to initialize id rules", zap.Error(err))
+	}
+	serviceConfig.Scales, err = newScales(cfgs.Scales)
+	if err != nil {
+		zap.L().Fatal("failed to initialize scales", zap.Error(err))
+	}
+	serviceConfig.Shifts, err = newShifts(cfgs.OEE.Shifts)
+	if err != nil {
+		zap.L().Fatal("failed to initialize shifts", zap.Error(err))
 	}
 	if err := mcomImpl.RegisterHandlers(dm, api, serviceConfig); err != nil {
 		zap.L().Fatal("failed to register handlers", zap.Error(err))
 	}
 
-	// Protected data endpoints
-	// api.ProtectedGetDataHandler = protected.GetDataHandlerFunc(protectedImpl.GetData)
+	return &plantAPI{
+		handler:   checkServerAlive(dm, api.Serve(setupMiddleware)),
+		dm:        dm,
+		sessions:  sessionStore,
+		db:        db,
+		stopWatch: stopWatch,
+	}
+}
 
-	api.PreServerShutdown = func() {}
+// lookupToken implements plant.TokenLookup.
+func (p *plantAPI) lookupToken(ctx context.Context, token string) (time.Time, bool, error) {
+	session, err := p.sessions.GetSessionByToken(ctx, token)
+	if err != nil {
+		if stdErrors.Is(err, database.ErrRecordNotFound) {
+			return time.Time{}, false, nil
+		}
+		return time.Time{}, false, err
+	}
+	if session.RevokedAt != nil || !time.Now().Before(session.ExpiresAt) {
+		return time.Time{}, false, nil
+	}
+	return session.ExpiresAt, true, nil
+}
 
-	api.ServerShutdown = func() {
-		role.ClearPermission()
-		zap.L().Info("Closing DataManager Services...")
-		if err := dm.Close(); err != nil {
-			zap.L().Error("server shutdown error..", zap.Error(err))
+func (p *plantAPI) close() {
+	p.stopWatch()
+	if err := p.dm.Close(); err != nil {
+		zap.L().Error("server shutdown error..", zap.Error(err))
+	}
+	closeDatabase(p.db)
+}
+
+func closeDatabase(db *gorm.DB) {
+	if sqlDB, err := db.DB(); err == nil {
+		if err := sqlDB.Close(); err != nil {
+			zap.L().Error("failed to close database", zap.Error(err))
 		}
 	}
+}
+
+// checkConfigurations prints the report of the configurations and returns
+// the exit code, which is non-zero if the configurations have any error.
+// Every plant is checked with its own stations in the multi-plant mode.
+func checkConfigurations(cfgs configs.Configs) int {
+	if len(cfgs.Plants) == 0 {
+		return checkPlantConfigurations(cfgs, configs.Check)
+	}
 
-	return setupGlobalMiddleware(api.Context().BasePath(), dm, api.Serve(setupMiddleware), configurations.CorsAllowedOrigins)
+	code := 0
+	report := configs.Check(context.Background(), cfgs, newCheckOptions(nil))
+	if _, err := report.WriteTo(os.Stdout); err != nil {
+		log.Println("failed to write the report:", err)
+	}
+	if report.HasErrors() {
+		code = 1
+	}
+	for _, p := range cfgs.Plants {
+		fmt.Printf("\nplant %s:\n", p.Name)
+		if c := checkPlantConfigurations(cfgs.ForPlant(p), configs.CheckPlant); c != 0 {
+			code = c
+		}
+	}
+	return code
+}
+
+func checkPlantConfigurations(cfgs configs.Configs, check func(context.Context, configs.Configs, configs.CheckOptions) configs.Report) int {
+	var opts configs.CheckOptions
+	dm, dmErr := server.RegisterDataManager(cfgs)
+	if dmErr != nil {
+		fmt.Printf("failed to register data manager, the stations are not checked: %v\n", dmErr)
+		opts = newCheckOptions(nil)
+	} else {
+		defer dm.Close()
+		opts = newCheckOptions(dm)
+	}
+
+	report := check(context.Background(), cfgs, opts)
+	if _, err := report.WriteTo(os.Stdout); err != nil {
+		log.Println("failed to write the report:", err)
+	}
+	if dmErr != nil || report.HasErrors() {
+		return 1
+	}
+	return 0
+}
+
+// newCheckOptions returns the references to check the configurations, the
+// stations are checked only if dm is not nil.
+func newCheckOptions(dm mcom.DataManager) configs.CheckOptions {
+	var opts configs.CheckOptions
+	for id, name := range kenda.FunctionOperationID_name {
+		// the server status is not guarded by any permission.
+		if kenda.FunctionOperationID(id) != kenda.FunctionOperationID_GET_SERVER_STATUS {
+			opts.Functions = append(opts.Functions, name)
+		}
+	}
+	for name := range mcomRoles.Role_value {
+		opts.Roles = append(opts.Roles, name)
+	}
+	opts.ParseIDRule = func(pattern string) error {
+		_, err := idrule.Parse(pattern)
+		return err
+	}
+	opts.ParseScaleProtocol = func(name string) error {
+		_, err := scale.ParseProtocol(name)
+		return err
+	}
+	if dm != nil {
+		opts.StationExists = func(ctx context.Context, id string) (bool, error) {
+			if _, err := dm.GetStation(ctx, mcom.GetStationRequest{ID: id}); err != nil {
+				if e, ok := mcomErrors.As(err); ok && e.Code == mcomErrors.Code_STATION_NOT_FOUND {
+					return false, nil
+				}
+				return false, err
+			}
+			return true, nil
+		}
+	}
+	return opts
+}
+
+func idPatterns(rule configs.IDRule) idrule.Patterns {
+	return idrule.Patterns{
+		LotNumber:  rule.LotNumber,
+		ResourceID: rule.ResourceID,
+	}
+}
+
+func idPatternsMap(rules map[string]configs.IDRule) map[string]idrule.Patterns {
+	patterns := make(map[string]idrule.Patterns, len(rules))
+	for k, rule := range rules {
+		patterns[k] = idPatterns(rule)
+	}
+	return patterns
+}
+
+func newScales(cfgs []configs.Scale) (*scale.Registry, error) {
+	scales := make([]scale.Config, len(cfgs))
+	for i, cfg := range cfgs {
+		protocol, err := scale.ParseProtocol(cfg.Protocol)
+		if err != nil {
+			return nil, fmt.Errorf("scale %s: %v", cfg.ID, err)
+		}
+		scales[i] = scale.Config{
+			ID:             cfg.ID,
+			Address:        cfg.Address,
+			Protocol:       protocol,
+			Stations:       cfg.Stations,
+			Timeout:        cfg.Timeout,
+			StableReadings: cfg.StableReadings,
+			NetWeight:      cfg.NetWeight,
+		}
+	}
+	return scale.NewRegistry(scales)
+}
+
+func newShifts(cfgs []configs.Shift) ([]oee.Shift, error) {
+	shifts := make([]oee.Shift, len(cfgs))
+	for i, cfg := range cfgs {
+		start, err := oee.ParseClock(cfg.Start)
+		if err != nil {
+			return nil, fmt.Errorf("shift %s: %v", cfg.Name, err)
+		}
+		shifts[i] = oee.Shift{
+			Name:  cfg.Name,
+			Start: start,
+		}
+	}
+	return shifts, nil
+}
+
+// logCheckReport logs the problems of the configurations and reports whether
+// the server can run with them.
+func logCheckReport(report configs.Report) bool {
+	for _, section := range report.Sections {
+		for _, problem := range section.Problems {
+			logf := zap.L().Warn
+			if problem.Severity == configs.SeverityError {
+				logf = zap.L().Error
+			}
+			logf("configuration problem", zap.String("section", section.Section), zap.String("problem", problem.Message))
+		}
+	}
+	zap.L().Info("configurations checked", zap.Int("sections", len(report.Sections)))
+	return !report.HasErrors()
 }
 
 // The TLS configuration before HTTPS server starts.
@@ -151,9 +534,8 @@ func checkServerAlive(dm mcom.DataManager, next http.Handler) http.Handler {
 
 // The middleware configuration happens before anything, this middleware also applies to serving the swagger.json document.
 // So this is a good place to plug in a panic handling middleware, logging and metrics
-func setupGlobalMiddleware(apiBasePath string, dm mcom.DataManager, handler http.Handler, corsAllowedOrigins []string) http.Handler {
+func setupGlobalMiddleware(apiBasePath string, handler http.Handler, corsAllowedOrigins []string) http.Handler {
 	handler = middleware.LoggingMiddleware(handler)
-	handler = checkServerAlive(dm, handler)
 	handler = middleware.MaybeServeUI(apiBasePath, configurations.UIDir, handler)
 	handler = handlers.RecoveryHandler(handlers.PrintRecoveryStack(true))(handler)
 	// default without cors handler.
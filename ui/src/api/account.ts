@@ -55,6 +55,53 @@ export const deleteAccount = (employeeID: string) =>
     method: 'delete'
   })
 
+export const getUserSessions = (employeeID: string) =>
+  request({
+    url: `/account/sessions/${employeeID}`,
+    method: 'get'
+  })
+
+export const revokeUserSessions = (employeeID: string) =>
+  request({
+    url: `/account/sessions/${employeeID}`,
+    method: 'delete'
+  })
+
+export const revokeUserSession = (employeeID: string, sessionID: string) =>
+  request({
+    url: `/account/sessions/${employeeID}/${sessionID}`,
+    method: 'delete'
+  })
+
+export const getLoginLockouts = () =>
+  request({
+    url: '/account/lockouts',
+    method: 'get'
+  })
+
+export const unlockLoginLockout = (type: 'ACCOUNT' | 'IP', target: string) =>
+  request({
+    url: `/account/lockouts/${type}/${encodeURIComponent(target)}`,
+    method: 'delete'
+  })
+
+export const getLockoutEvents = (since?: string) =>
+  request({
+    url: '/account/lockout-events',
+    method: 'get',
+    params: { since }
+  })
+
+export const uploadAccounts = (data: FormData) =>
+  request({
+    url: '/account/authorization/upload',
+    method: 'post',
+    headers: {
+      'Content-Type': 'multipart/form-data'
+    },
+    data
+  })
+
 export const login = (data: any) =>
   request({
     url: '/user/login',
@@ -74,3 +121,9 @@ export const changePassword = (data: any) =>
     method: 'put',
     data
   })
+
+export const getPermissions = () =>
+  request({
+    url: '/user/permissions',
+    method: 'get'
+  })
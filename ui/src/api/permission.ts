@@ -0,0 +1,34 @@
+import request from '@/utils/request'
+
+export const getRolePermissions = () =>
+  request({
+    url: '/role-permissions',
+    method: 'get'
+  })
+
+export const createRolePermission = (data: any) =>
+  request({
+    url: '/role-permissions',
+    method: 'post',
+    data
+  })
+
+export const updateRolePermission = (functionOperationID: string, data: any) =>
+  request({
+    url: `/role-permissions/${functionOperationID}`,
+    method: 'put',
+    data
+  })
+
+export const deleteRolePermission = (functionOperationID: string, version: number) =>
+  request({
+    url: `/role-permissions/${functionOperationID}`,
+    method: 'delete',
+    params: { version }
+  })
+
+export const getRolePermissionHistory = (functionOperationID: string) =>
+  request({
+    url: `/role-permissions/${functionOperationID}/history`,
+    method: 'get'
+  })
@@ -13,3 +13,123 @@ export const collect = (stationID: string, data: any) =>
     method: 'post',
     data
   })
+
+export const reverseCollect = (workOrderID: string, sequence: number, data: { reason: string; quantity?: string }) =>
+  request({
+    url: `/production-flow/collect/work-order/${workOrderID}/sequence/${sequence}/reverse`,
+    method: 'post',
+    data
+  })
+
+export const unfeed = (workOrderID: string, batch: number, data: any) =>
+  request({
+    url: `/production-flow/unfeed/work-order/${workOrderID}/batch/${batch}`,
+    method: 'post',
+    data
+  })
+
+export const listDefectReasons = () =>
+  request({
+    url: '/production-flow/defect-reasons',
+    method: 'get'
+  })
+
+export const createDefectReason = (data: { code: string; kind: 'DEFECT' | 'SCRAP'; description?: string; disabled?: boolean }) =>
+  request({
+    url: '/production-flow/defect-reasons',
+    method: 'post',
+    data
+  })
+
+export const updateDefectReason = (code: string, data: { kind: 'DEFECT' | 'SCRAP'; description?: string; disabled?: boolean }) =>
+  request({
+    url: `/production-flow/defect-reasons/${code}`,
+    method: 'put',
+    data
+  })
+
+export interface SyncOperation {
+  ID: string
+  kind: 'FEED' | 'COLLECT' | 'BIND' | 'SIGN_IN'
+  stationID?: string
+  clientTime: string
+  payload: any
+}
+
+export const syncOperations = (data: { operations: SyncOperation[]; stopOnError?: boolean }) =>
+  request({
+    url: '/production-flow/sync',
+    method: 'post',
+    data
+  })
+
+export const getScaleWeight = (stationID: string) =>
+  request({
+    url: `/production-flow/scale/station/${stationID}`,
+    method: 'get'
+  })
+
+export interface RecordQuery {
+  workOrderID?: string
+  batch?: number
+  stationID?: string
+  operator?: string
+  productID?: string
+  since?: string
+  until?: string
+  page?: number
+  limit?: number
+}
+
+export const listFeedRecords = (params: RecordQuery) =>
+  request({
+    url: '/production-flow/records/feed',
+    method: 'get',
+    params
+  })
+
+export const listCollectRecords = (params: RecordQuery) =>
+  request({
+    url: '/production-flow/records/collect',
+    method: 'get',
+    params
+  })
+
+export interface TraceQuery {
+  resourceID?: string
+  lotNumber?: string
+  direction?: 'backward' | 'forward'
+  depth?: number
+}
+
+export const traceResources = (params: TraceQuery) =>
+  request({
+    url: '/production-flow/trace',
+    method: 'get',
+    params
+  })
+
+export const exportTrace = (params: TraceQuery & { format?: 'xlsx' | 'json' }) =>
+  request({
+    url: '/production-flow/trace/export',
+    method: 'get',
+    headers: {
+      Accept: 'application/octet-stream'
+    },
+    responseType: 'arraybuffer',
+    params
+  })
+
+export interface OEEQuery {
+  stationID?: string
+  since: string
+  until: string
+  granularity?: 'shift' | 'day'
+}
+
+export const getStationOEE = (params: OEEQuery) =>
+  request({
+    url: '/production-flow/oee',
+    method: 'get',
+    params
+  })
@@ -142,3 +142,13 @@ export const stationSignOut = (data: any) =>
     method: 'post',
     data
   })
+
+export const createStationDowntime = (
+  stationID: string,
+  data: { reason: string; startedAt: string; endedAt: string }
+) =>
+  request({
+    url: `/station/${stationID}/downtime`,
+    method: 'post',
+    data
+  })
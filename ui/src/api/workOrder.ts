@@ -21,6 +21,20 @@ export const updateWorkOrder = (id: string, data: any) =>
     data
   })
 
+export const splitWorkOrder = (id: string, data: { station?: string; planDate?: string; batches?: number; quantity?: string; updateAt: string }) =>
+  request({
+    url: `/work-orders/${id}/split`,
+    method: 'post',
+    data
+  })
+
+export const mergeWorkOrders = (id: string, updateAt: string, workOrders: { ID: string; updateAt: string }[]) =>
+  request({
+    url: `/work-orders/${id}/merge`,
+    method: 'post',
+    data: { updateAt, workOrders }
+  })
+
 export const getStationScheduleList = (station: string, date: string) =>
   request({
     url: `/schedulings/station/${station}/date/${date}`,
@@ -54,12 +68,79 @@ export const getProductionRate = (departmentID: string, params: any) =>
     params
   })
   
-export const uploadWorkOrders = (department: string, data: any) =>
+export const uploadWorkOrders = (department: string, data: any, dryRun = false) =>
   request({
     url: `/work-orders/upload/department/${department}`,
     method: 'post',
     headers: {
       'Content-Type': 'multipart/form-data'
     },
+    params: { dryRun },
     data: data
   })
+
+export const commitWorkOrderImport = (previewID: string) =>
+  request({
+    url: `/work-orders/upload/preview/${previewID}`,
+    method: 'post'
+  })
+
+export const downloadWorkOrderTemplate = (format: 'xlsx' | 'csv' = 'xlsx') =>
+  request({
+    url: '/work-orders/upload/template',
+    method: 'get',
+    headers: {
+      Accept: 'application/octet-stream'
+    },
+    responseType: 'arraybuffer',
+    params: { format }
+  })
+
+export interface ExportParams {
+  format?: 'xlsx' | 'csv'
+  lang?: 'tw' | 'cn' | 'en' | 'vi'
+}
+
+export interface WorkOrderExportParams extends ExportParams {
+  workDate: string
+}
+
+export interface ProductionRateExportParams extends ExportParams {
+  workStartDate: string
+  workEndDate: string
+  orderName?: string
+  descending?: boolean
+}
+
+export const exportWorkOrders = (stationID: string, params: WorkOrderExportParams) =>
+  request({
+    url: `/production-flow/work-orders/station/${stationID}/export`,
+    method: 'get',
+    headers: {
+      Accept: 'application/octet-stream'
+    },
+    responseType: 'arraybuffer',
+    params
+  })
+
+export const exportStationSchedule = (station: string, date: string, params: ExportParams = {}) =>
+  request({
+    url: `/schedulings/station/${station}/date/${date}/export`,
+    method: 'get',
+    headers: {
+      Accept: 'application/octet-stream'
+    },
+    responseType: 'arraybuffer',
+    params
+  })
+
+export const exportProductionRate = (departmentID: string, params: ProductionRateExportParams) =>
+  request({
+    url: `/work-orders-rate/department/${departmentID}/export`,
+    method: 'get',
+    headers: {
+      Accept: 'application/octet-stream'
+    },
+    responseType: 'arraybuffer',
+    params
+  })
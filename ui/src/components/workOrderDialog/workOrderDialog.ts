@@ -33,6 +33,7 @@ export default class extends Vue {
   private dateValue = moment(GetDate(0)).format('YYYY-MM-DD')
   private dialog = false
   private targetWorkOrder = ''
+  private targetUpdateAt = ''
   private targetAction = ''
   @Prop() private departmentOIDValue!: string
 
@@ -316,6 +317,7 @@ export default class extends Vue {
 
   private rowDataToFormat(rowData: any) {
     this.targetWorkOrder = rowData.ID
+    this.targetUpdateAt = rowData.updateAt
     rowData.batchCalculation = !(rowData.batchSize === this.BatchSize.FixedQuantity)
     this.tempWorkOrderData = cloneDeep(rowData)
     this.tempWorkOrderData.preBatchSize = this.tempAddWorkInfo.batchSize
@@ -394,7 +396,7 @@ export default class extends Vue {
     (this.$refs.workOrderDataForm as Form).validate(async valid => {
       if (valid) {
         this.tempWorkOrderData.batchSize = (this.tempWorkOrderData.batchCalculation === false) ? this.BatchSize.FixedQuantity.toString() : this.BatchSize.PlanQuantity.toString()
-        const data = await updateWorkOrder(this.targetWorkOrder, this.returnWorkOrderAPiFormat([this.tempWorkOrderData], false)[0])
+        const data = await updateWorkOrder(this.targetWorkOrder, { ...this.returnWorkOrderAPiFormat([this.tempWorkOrderData], false)[0], updateAt: this.targetUpdateAt })
         if ((await data).status === 200) {
           this.$notify({
             title: (this.$t('share.success')).toString(),
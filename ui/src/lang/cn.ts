@@ -135,7 +135,9 @@ export default {
     logInAgain: '重新登入',
     oldPassword: '旧密码',
     newPassword: '新密码',
-    checkNewPassword: '确认新密码'
+    checkNewPassword: '确认新密码',
+    plant: '厂区',
+    selectPlant: '请选择厂区'
   },
   language: {
     traditionalChinese: '繁體中文',
@@ -383,6 +385,7 @@ export default {
     errorCode_403: '无权限',
     errorCode_404: '找不到资料',
     errorCode_408: '连线逾时',
+    errorCode_409: '资料已被其他用户修改，请重新整理后再试',
     errorCode_10000: '无此帐号或密码错误',
     errorCode_10100: '该使用者无此权限',
     errorCode_10300: '无法识别该令牌',
@@ -135,7 +135,9 @@ export default {
     logInAgain: 'Login again',
     oldPassword: 'Old password',
     newPassword: 'New password',
-    checkNewPassword: 'Confirm new password'
+    checkNewPassword: 'Confirm new password',
+    plant: 'Plant',
+    selectPlant: 'Please select the plant'
   },
   language: {
     traditionalChinese: '繁體中文',
@@ -383,6 +385,7 @@ export default {
     errorCode_403: 'No permission',
     errorCode_404: 'Data not found',
     errorCode_408: 'Connection timeout',
+    errorCode_409: 'The data has been modified by another user, please refresh and try again',
     errorCode_10000: 'No such account or wrong password',
     errorCode_10100: 'This user does not have this permission',
     errorCode_10300: 'The token cannot be recognized',
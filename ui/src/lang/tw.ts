@@ -135,7 +135,9 @@ export default {
     logInAgain: '重新登入',
     oldPassword: '舊密碼',
     newPassword: '新密碼',
-    checkNewPassword: '確認新密碼'
+    checkNewPassword: '確認新密碼',
+    plant: '廠區',
+    selectPlant: '請選擇廠區'
   },
   language: {
     traditionalChinese: '繁體中文',
@@ -383,6 +385,7 @@ export default {
     errorCode_403: '無權限',
     errorCode_404: '找不到資料',
     errorCode_408: '連線逾時',
+    errorCode_409: '資料已被其他使用者修改，請重新整理後再試',
     errorCode_10000: '無此帳號或密碼錯誤',
     errorCode_10100: '該使用者無此權限',
     errorCode_10300: '無法識別該令牌',
@@ -121,7 +121,9 @@ export default {
     logInAgain: 'Đăng nhập lại',
     oldPassword: 'Mật mã cũ',
     newPassword: 'Mật mã mới',
-    checkNewPassword: 'Xác nhận mật mã mới'
+    checkNewPassword: 'Xác nhận mật mã mới',
+    plant: 'Nhà máy',
+    selectPlant: 'Vui lòng chọn nhà máy'
   },
   language: {
     traditionalChinese: '繁體中文',
@@ -308,6 +310,7 @@ export default {
     errorCode_403: 'Không có quyền hạn',
     errorCode_404: 'Tìm không thấy dữ liệu',
     errorCode_408: 'Kết nối quá hạn',
+    errorCode_409: 'Dữ liệu đã bị người dùng khác sửa đổi, vui lòng làm mới và thử lại',
     errorCode_10000: 'Không có tài khoản hoặc mật mã sai',
     errorCode_10100: 'Người sử dụng không có quyền hạn',
     errorCode_10300: 'Mã thông báo không được công nhận',
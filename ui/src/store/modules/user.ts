@@ -18,7 +18,7 @@ export interface IUserState {
   workDate: string
   selectStationsInfo: string[]
   feedAndCollectMode: string
-
+  passwordExpired: boolean
 }
 
 @Module({ dynamic: true, store, name: 'user' })
@@ -36,6 +36,7 @@ class User extends VuexModule implements IUserState {
   public station = getStation() || ''
   public selectStationsInfo = getSelectStationsInfo() || []
   public feedAndCollectMode = getFeedAndCollectMode() || ''
+  public passwordExpired = false
 
   @Mutation
   private SET_TOKEN(token: string) {
@@ -92,6 +93,11 @@ class User extends VuexModule implements IUserState {
     this.feedAndCollectMode = feedAndCollectMode
   }
 
+  @Mutation
+  private SET_PASSWORD_EXPIRED(passwordExpired: boolean) {
+    this.passwordExpired = passwordExpired
+  }
+
   @Mutation
   private SET_SELECT_STATIONS_INFO(selectStationsInfo: string[]) {
     this.selectStationsInfo = selectStationsInfo
@@ -122,6 +128,7 @@ class User extends VuexModule implements IUserState {
     this.SET_LOGIN_TYPE(loginType.toString())
     this.SET_GROUP(group.toString())
     this.SET_LOGIN_WORKDATE(workDate)
+    this.SET_PASSWORD_EXPIRED(data.passwordExpired || false)
   }
 
   @Action({ rawError: true })
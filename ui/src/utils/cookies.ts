@@ -11,6 +11,11 @@ export const getToken = () => Cookies.get(tokenKey)
 export const setToken = (token: string) => Cookies.set(tokenKey, token)
 export const removeToken = () => Cookies.remove(tokenKey)
 
+// the plant signed in at in the multi-plant mode.
+const plantKey = 'plant'
+export const getPlant = () => Cookies.get(plantKey)
+export const setPlant = (plant: string) => Cookies.set(plantKey, plant)
+
 const languageKey = 'language'
 export const getLanguage = () => Cookies.get(languageKey)
 export const setLanguage = (language: string) => Cookies.set(languageKey, language)
@@ -1,6 +1,7 @@
 import axios from 'axios'
 import { MessageBox, Notification } from 'element-ui'
 import { UserModule } from '@/store/modules/user'
+import { getPlant } from '@/utils/cookies'
 import i18n from '@/lang'
 
 declare global {
@@ -20,6 +21,11 @@ service.interceptors.request.use(
     if (UserModule.token) {
       config.headers['x-mui-auth-key'] = UserModule.token
     }
+    // the server routes the requests by the plant in the multi-plant mode.
+    const plant = getPlant()
+    if (window.config.Plants && plant) {
+      config.headers['X-Plant'] = plant
+    }
     return config
   },
   (error) => {
@@ -68,6 +74,8 @@ service.interceptors.response.use(
             Notification.warning({ title: i18n.t('share.errorMessage').toString() + ': ' + error.response.status, message: i18n.t('errorCodes.errorCode_404').toString() })
           } else if (error.response.status === 408) {
             Notification.warning({ title: i18n.t('share.errorMessage').toString() + ': ' + error.response.status, message: i18n.t('errorCodes.errorCode_408').toString() })
+          } else if (error.response.status === 409 && !error.response.data.code) {
+            Notification.warning({ title: i18n.t('share.errorMessage').toString() + ': ' + error.response.status, message: i18n.t('errorCodes.errorCode_409').toString() })
           } else {
             if (error.response.data.code !== undefined) {
               Notification.warning({ title: i18n.t('share.errorMessage').toString() + ': ' + error.response.data.code, message: i18n.t('errorCodes.' + code).toString() })
@@ -7,6 +7,7 @@ import { UserModule } from '@/store/modules/user'
 import LangSelect from '@/components/LangSelect/index.vue'
 import moment from 'moment'
 import { GetDate } from '@/utils'
+import { getPlant, setPlant } from '@/utils/cookies'
 @Component({
   name: 'Login',
   components: {
@@ -23,6 +24,10 @@ export default class extends Vue {
     workDate: moment(GetDate(0)).format('YYYY-MM-DD')
   }
 
+  // the plants to sign in at in the multi-plant mode.
+  private plants: string[] = window.config.Plants || []
+  private plant = getPlant() || ''
+
   private passwordType = 'password'
   private loading = false
   private redirect?: string
@@ -78,9 +83,14 @@ export default class extends Vue {
           let checkTag = false
           checkTag = this.checkLogInData()
           if (checkTag === true) {
+            if (this.plants.length !== 0) {
+              setPlant(this.plant)
+            }
             await UserModule.Login(this.loginForm)
+            // the expired password has to be changed first.
+            const path = UserModule.passwordExpired ? '/editPassword' : '/'
             // eslint-disable-next-line
-            this.$router.push({ path: '/' }, () => { })
+            this.$router.push({ path }, () => { })
             setTimeout(() => {
               this.loading = false
             }, 0.5 * 1000)
@@ -106,6 +116,15 @@ export default class extends Vue {
   }
 
   private checkLogInData() {
+    if (this.plants.length !== 0 && this.plants.indexOf(this.plant) === -1) {
+      this.$notify({
+        title: (this.$t('share.errorMessage')).toString(),
+        message: (this.$t('login.selectPlant')).toString(),
+        type: 'warning',
+        duration: 2000
+      })
+      return false
+    }
     if (this.loginForm.loginType !== 2) {
       this.loginForm.group = 0
       this.loginForm.workDate = ''
@@ -2,13 +2,15 @@
 import { Component, Vue } from 'vue-property-decorator'
 import Sortable from 'sortablejs'
 import { defaultStationScheduleListData, getDepartmentStationList } from '@/api/station'
-import { getStationScheduleList, updateWorkOrderSequence } from '@/api/workOrder'
+import { ExportParams, exportStationSchedule, getStationScheduleList, updateWorkOrderSequence } from '@/api/workOrder'
 import { preMaterialResourceBarcode } from '@/api/resource'
 import { BatchSize, GetDate } from '@/utils'
 import moment from 'moment'
 import { getAllDepartment } from '@/api/unspecified'
 import Decimal from 'decimal.js'
 import WorkOrderDialog from '@/components/workOrderDialog/workOrderDialog.vue'
+import { AppModule } from '@/store/modules/app'
+import { saveAs } from 'file-saver'
 
 const statusTable = [
   { key: '0', status: 'status.pending' },
@@ -109,7 +111,8 @@ export default class extends Vue {
       return {
         ID: v.ID,
         forceToAbort: false,
-        sequence: v.sequence
+        sequence: v.sequence,
+        updateAt: v.updateAt
       }
     })
 
@@ -119,6 +122,18 @@ export default class extends Vue {
     })
   }
 
+  private async onExportStationSchedule() {
+    try {
+      const { data } = await exportStationSchedule(this.stationValue, moment(this.dateValue).format('YYYY-MM-DD'), {
+        lang: AppModule.language as ExportParams['lang']
+      })
+      const fileName = this.stationValue + '-' + moment(this.dateValue).format('YYYYMMDD') + '.xlsx'
+      saveAs(new Blob([data], { type: 'application/octet-stream' }), fileName)
+    } catch {
+      // the failed request has been notified by the request interceptor.
+    }
+  }
+
   private openDetailInfo(row: any) {
     this.tempStationScheduleListData = row
     this.dialogDetailFormVisible = true
@@ -155,7 +170,8 @@ export default class extends Vue {
         return {
           ID: v.ID,
           forceToAbort: true,
-          sequence: v.sequence
+          sequence: v.sequence,
+          updateAt: v.updateAt
         }
       })
       try {
@@ -185,7 +201,8 @@ export default class extends Vue {
       return {
         ID: v.ID,
         forceToAbort: false,
-        sequence: i + 1
+        sequence: i + 1,
+        updateAt: v.updateAt
       }
     })
     try {
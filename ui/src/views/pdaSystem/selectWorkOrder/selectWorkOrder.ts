@@ -2,13 +2,15 @@
 import { Component, Vue } from 'vue-property-decorator'
 import { validateRequire } from '@/utils'
 import { UserModule } from '@/store/modules/user'
-import { changeWorkOrderStatus, getWorkOrderList, getWorkOrderInfo } from '@/api/workOrder'
+import { changeWorkOrderStatus, ExportParams, exportWorkOrders, getWorkOrderList, getWorkOrderInfo } from '@/api/workOrder'
 import { getStationList, stationSignIn } from '@/api/station'
 import { getStationOperator } from '@/api/site'
 import { PDAModule } from '@/store/modules/pda'
 import { MessageBox } from 'element-ui'
 import i18n from '@/lang'
 import { getStationConfig } from '@/api/ui'
+import { AppModule } from '@/store/modules/app'
+import { saveAs } from 'file-saver'
 
 @Component({
   name: 'selectWorkOrder'
@@ -127,6 +129,19 @@ export default class extends Vue {
     this.workOrderInfoList = data
   }
 
+  private async onExportWorkOrders() {
+    try {
+      const { data } = await exportWorkOrders(this.tempSelectWorkOrderInfo.stationID, {
+        workDate: UserModule.workDate,
+        lang: AppModule.language as ExportParams['lang']
+      })
+      const fileName = this.tempSelectWorkOrderInfo.stationID + '-' + UserModule.workDate + '.xlsx'
+      saveAs(new Blob([data], { type: 'application/octet-stream' }), fileName)
+    } catch {
+      // the failed request has been notified by the request interceptor.
+    }
+  }
+
   private async getStationInfo() {
     const stationInfo = {
       site: {